@@ -0,0 +1,454 @@
+// Package account adds the pages where logged-in users manage their own
+// account: display name, email address, password (requiring the current
+// one), avatar, and username when users log in with one. When the auth
+// store keeps sessions (auth.SessionStore), they can also see where
+// they're logged in and log other devices out.
+//
+// An email change only takes effect once confirmed from the new inbox.
+// The old address is told about the request and gets a link to undo it,
+// which works both before and after the change is confirmed.
+//
+// Wire mounts it at /account when Config.Account is set. To mount it
+// yourself:
+//
+//	acct := account.New(store, kit.Mail, kit.Signer)
+//	acct.BaseURL = "https://app.example.com"
+//	acct.Avatars = account.NewDirStorage("public/avatars", "/avatars")
+//	acct.Mount(app)
+//
+// The pages render views.PageAccount, so apps can restyle them like
+// Buffkit's other pages.
+package account
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/quota"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// Defaults for Account.
+const (
+	DefaultConfirmTTL    = 24 * time.Hour
+	DefaultRevertTTL     = 7 * 24 * time.Hour
+	DefaultMaxAvatarSize = 2 << 20 // 2 MiB
+	MinPasswordLength    = 8
+	maxDisplayNameLength = 100
+)
+
+// ErrNoBaseURL is returned when mailing an email change link without
+// BaseURL.
+var ErrNoBaseURL = errors.New("account: BaseURL is needed to email links")
+
+// Account serves the account pages for users in Store.
+type Account struct {
+	Store  auth.ProfileStore
+	Sender mail.Sender
+
+	// Signer signs the email confirmation and revert links.
+	Signer *secure.URLSigner
+
+	// BaseURL is the absolute URL of the app, e.g.
+	// "https://app.example.com", for the links in emails. It's required,
+	// so the links never follow a request's Host header.
+	BaseURL string
+
+	// Avatars stores uploaded avatars. Nil disables avatar upload.
+	Avatars AvatarStorage
+
+	// Usernames lets users pick the username they log in with. Store
+	// must implement auth.UsernameStore.
+	Usernames bool
+
+	// Sessions adds a page listing where the user is logged in, where
+	// they can log other devices out. Store must implement
+	// auth.SessionStore.
+	Sessions bool
+
+	// Path is where Mount puts the pages. Defaults to "/account".
+	Path string
+
+	// ConfirmTTL is how long the link confirming a new email address
+	// stays valid. Defaults to DefaultConfirmTTL.
+	ConfirmTTL time.Duration
+
+	// RevertTTL is how long the link sent to the old address can undo an
+	// email change. Defaults to DefaultRevertTTL.
+	RevertTTL time.Duration
+
+	// MaxAvatarSize limits avatar uploads, in bytes. Defaults to
+	// DefaultMaxAvatarSize.
+	MaxAvatarSize int64
+
+	// Quota, when set, counts each user's avatar against their storage.
+	// Nil doesn't limit it.
+	Quota *quota.Quota
+
+	// Clock dates the emailed links and email verifications. Defaults to
+	// clock.Real.
+	Clock clock.Clock
+}
+
+// New creates an Account with default settings.
+func New(store auth.ProfileStore, sender mail.Sender, signer *secure.URLSigner) *Account {
+	return &Account{
+		Store:         store,
+		Sender:        sender,
+		Signer:        signer,
+		Path:          "/account",
+		ConfirmTTL:    DefaultConfirmTTL,
+		RevertTTL:     DefaultRevertTTL,
+		MaxAvatarSize: DefaultMaxAvatarSize,
+	}
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (a *Account) Routes() [][2]string {
+	routes := [][2]string{
+		{http.MethodGet, a.Path},
+		{http.MethodPost, a.Path + "/profile"},
+		{http.MethodPost, a.Path + "/email"},
+		{http.MethodGet, a.Path + "/email/confirm"},
+		{http.MethodGet, a.Path + "/email/revert"},
+		{http.MethodPost, a.Path + "/password"},
+	}
+	if a.Avatars != nil {
+		routes = append(routes, [2]string{http.MethodPost, a.Path + "/avatar"})
+	}
+	if a.Usernames {
+		routes = append(routes, [2]string{http.MethodPost, a.Path + "/username"})
+	}
+	if a.Sessions {
+		routes = append(routes,
+			[2]string{http.MethodGet, a.Path + "/sessions"},
+			[2]string{http.MethodPost, a.Path + "/sessions/{id}/end"},
+			[2]string{http.MethodPost, a.Path + "/sessions/end-others"},
+		)
+	}
+	return routes
+}
+
+// Mount adds the account routes to app. Every page requires login except
+// the emailed links, which are authenticated by their signatures.
+func (a *Account) Mount(app *buffalo.App) {
+	app.GET(a.Path, auth.RequireLogin(a.Show))
+	app.POST(a.Path+"/profile", auth.RequireLogin(a.UpdateProfile))
+	app.POST(a.Path+"/email", auth.RequireLogin(a.UpdateEmail))
+	app.GET(a.Path+"/email/confirm", a.ConfirmEmail)
+	app.GET(a.Path+"/email/revert", a.RevertEmail)
+	app.POST(a.Path+"/password", auth.RequireLogin(a.UpdatePassword))
+	if a.Avatars != nil {
+		app.POST(a.Path+"/avatar", auth.RequireLogin(a.UploadAvatar))
+	}
+	if a.Usernames {
+		app.POST(a.Path+"/username", auth.RequireLogin(a.UpdateUsername))
+	}
+	if a.Sessions {
+		app.GET(a.Path+"/sessions", auth.RequireLogin(a.ShowSessions))
+		app.POST(a.Path+"/sessions/end-others", auth.RequireLogin(a.EndOtherSessions))
+		app.POST(a.Path+"/sessions/{id}/end", auth.RequireLogin(a.EndSession))
+	}
+}
+
+// Show renders the account page.
+func (a *Account) Show(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+	return a.render(c, http.StatusOK, user, nil)
+}
+
+// UpdateProfile changes the display name.
+func (a *Account) UpdateProfile(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+
+	name := strings.TrimSpace(c.Request().FormValue("display_name"))
+	if len(name) > maxDisplayNameLength {
+		return a.render(c, http.StatusUnprocessableEntity, user,
+			[]string{fmt.Sprintf("Display name must be at most %d characters", maxDisplayNameLength)})
+	}
+	if err := a.Store.UpdateDisplayName(c, user.ID, name); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return a.done(c, "Profile updated")
+}
+
+// UpdateUsername changes the username the user logs in with.
+func (a *Account) UpdateUsername(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+	store, ok := a.Store.(auth.UsernameStore)
+	if !ok {
+		return c.Error(http.StatusInternalServerError, fmt.Errorf("account: usernames need an auth.UsernameStore, got %T", a.Store))
+	}
+
+	username := auth.NormalizeUsername(c.Request().FormValue("username"))
+	if username == user.Username {
+		return a.done(c, "Username unchanged")
+	}
+	if err := auth.ValidateUsername(username); err != nil {
+		msg := err.Error()
+		return a.render(c, http.StatusUnprocessableEntity, user, []string{strings.ToUpper(msg[:1]) + msg[1:]})
+	}
+
+	err = store.UpdateUsername(c, user.ID, username)
+	if errors.Is(err, auth.ErrUsernameTaken) {
+		return a.render(c, http.StatusUnprocessableEntity, user, []string{"That username is already taken"})
+	}
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return a.done(c, "Username changed to "+username)
+}
+
+// UpdateEmail starts an email change. Nothing changes until the user
+// opens the confirmation link sent to the new address; the old address
+// is notified and gets a link to undo the change.
+func (a *Account) UpdateEmail(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(c.Request().FormValue("email")))
+	if !strings.Contains(email, "@") {
+		return a.render(c, http.StatusUnprocessableEntity, user, []string{"Enter a valid email address"})
+	}
+	if strings.EqualFold(email, user.Email) {
+		return a.done(c, "Email address unchanged")
+	}
+	if taken, err := a.Store.ExistsEmail(c, email); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	} else if taken {
+		return a.render(c, http.StatusUnprocessableEntity, user, []string{"That email address is already in use"})
+	}
+
+	if err := a.Store.SetPendingEmail(c, user.ID, email); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := a.sendEmailChange(c, user, email); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return a.done(c, "Check "+email+" for a link to confirm the change")
+}
+
+// sendEmailChange sends the confirmation link to the new address and the
+// notice with a revert link to the old one.
+func (a *Account) sendEmailChange(c buffalo.Context, user *auth.User, email string) error {
+	claims := map[string]string{"user": user.ID, "old": user.Email, "email": email}
+
+	confirm, err := a.link("/email/confirm", a.ConfirmTTL, DefaultConfirmTTL, claims)
+	if err != nil {
+		return err
+	}
+	err = a.Sender.Send(c, mail.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Text:    "Confirm this is your new email address by opening:\n\n" + confirm + "\n",
+		HTML:    `<p>Confirm this is your new email address:</p><p><a href="` + html.EscapeString(confirm) + `">Confirm email address</a></p>`,
+	})
+	if err != nil {
+		return err
+	}
+
+	revert, err := a.link("/email/revert", a.RevertTTL, DefaultRevertTTL, claims)
+	if err != nil {
+		return err
+	}
+	return a.Sender.Send(c, mail.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Text: "Someone asked to change your account's email address to " + email + ".\n\n" +
+			"If this wasn't you, undo it by opening:\n\n" + revert + "\n",
+		HTML: `<p>Someone asked to change your account's email address to ` + html.EscapeString(email) + `.</p>` +
+			`<p>If this wasn't you, <a href="` + html.EscapeString(revert) + `">undo the change</a>.</p>`,
+	})
+}
+
+// link signs a link to p under the account path, at BaseURL.
+func (a *Account) link(p string, ttl, fallback time.Duration, claims map[string]string) (string, error) {
+	if a.BaseURL == "" {
+		return "", ErrNoBaseURL
+	}
+	if ttl <= 0 {
+		ttl = fallback
+	}
+	link, err := a.Signer.Sign(a.Path+p, clock.Or(a.Clock).Now().Add(ttl), claims)
+	if err != nil {
+		return "", fmt.Errorf("account: sign link: %w", err)
+	}
+	return strings.TrimSuffix(a.BaseURL, "/") + link, nil
+}
+
+// verifyLink checks the signature of the emailed link being served and
+// loads its user. When it returns nil the response is handled.
+func (a *Account) verifyLink(c buffalo.Context) (*auth.User, map[string]string, error) {
+	claims, err := a.Signer.Verify(c.Request().URL)
+	if errors.Is(err, secure.ErrExpiredSignature) {
+		return nil, nil, c.Error(http.StatusGone, err)
+	}
+	if err != nil {
+		return nil, nil, c.Error(http.StatusForbidden, err)
+	}
+	user, err := a.Store.ByID(c, claims["user"])
+	if err != nil {
+		return nil, nil, c.Error(http.StatusGone, errLinkUsed)
+	}
+	return user, claims, nil
+}
+
+var errLinkUsed = errors.New("account: this link is no longer valid")
+
+// ConfirmEmail completes a pending email change from the link sent to the
+// new address. Opening it proves the user owns the address, so it's
+// marked verified.
+func (a *Account) ConfirmEmail(c buffalo.Context) error {
+	user, claims, err := a.verifyLink(c)
+	if user == nil {
+		return err
+	}
+	if user.Email != claims["old"] || user.PendingEmail != claims["email"] {
+		return c.Error(http.StatusGone, errLinkUsed)
+	}
+
+	err = a.Store.UpdateEmail(c, user.ID, claims["email"])
+	if errors.Is(err, auth.ErrUserExists) {
+		return c.Error(http.StatusConflict, errors.New("account: that email address is already in use"))
+	}
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := a.Store.MarkEmailVerified(c, user.ID, clock.Or(a.Clock).Now()); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	// The session identifies the user by email
+	if auth.GetUserSession(c) == claims["old"] {
+		auth.SetUserSession(c, claims["email"])
+	}
+	return a.done(c, "Email address changed to "+claims["email"])
+}
+
+// RevertEmail undoes an email change from the link sent to the old
+// address: a pending change is cancelled, and a confirmed one is rolled
+// back to the old address.
+func (a *Account) RevertEmail(c buffalo.Context) error {
+	user, claims, err := a.verifyLink(c)
+	if user == nil {
+		return err
+	}
+
+	switch {
+	case user.Email == claims["old"] && user.PendingEmail == claims["email"]:
+		err = a.Store.SetPendingEmail(c, user.ID, "")
+	case user.Email == claims["email"]:
+		err = a.Store.UpdateEmail(c, user.ID, claims["old"])
+		if err == nil {
+			// The link arrived at the old address, so it's still theirs
+			err = a.Store.MarkEmailVerified(c, user.ID, clock.Or(a.Clock).Now())
+		}
+		if err == nil && auth.GetUserSession(c) == claims["email"] {
+			auth.SetUserSession(c, claims["old"])
+		}
+	default:
+		return c.Error(http.StatusGone, errLinkUsed)
+	}
+	if errors.Is(err, auth.ErrUserExists) {
+		return c.Error(http.StatusConflict, errors.New("account: the old email address is now in use"))
+	}
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return a.done(c, "Email change undone. Your address is "+claims["old"])
+}
+
+// UpdatePassword changes the password after checking the current one,
+// and logs the user's other devices out.
+func (a *Account) UpdatePassword(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+
+	r := c.Request()
+	current, next := r.FormValue("current_password"), r.FormValue("new_password")
+	switch {
+	case auth.CheckPassword(current, user.PasswordDigest) != nil:
+		return a.render(c, http.StatusUnprocessableEntity, user, []string{"Current password is incorrect"})
+	case len(next) < MinPasswordLength:
+		return a.render(c, http.StatusUnprocessableEntity, user,
+			[]string{fmt.Sprintf("New password must be at least %d characters", MinPasswordLength)})
+	case next != r.FormValue("password_confirmation"):
+		return a.render(c, http.StatusUnprocessableEntity, user, []string{"New passwords don't match"})
+	}
+
+	digest, err := auth.HashPassword(next)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := a.Store.UpdatePassword(c, user.ID, digest); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := auth.PasswordChanged(c, user, "account"); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if auth.GetUserSession(c) == "" {
+		c.Flash().Add("success", "Password changed. Please log in with your new password.")
+		return c.Redirect(http.StatusSeeOther, auth.LoginPath())
+	}
+	return a.done(c, "Password changed")
+}
+
+// currentUser loads the logged-in user from the store. RequireLogin has
+// already run, so a missing user means the account was removed and the
+// visitor is sent to log in. A nil user means the response is handled;
+// the handler returns err as is.
+func (a *Account) currentUser(c buffalo.Context) (*auth.User, error) {
+	user, err := a.Store.ByEmail(c, auth.GetUserSession(c))
+	if errors.Is(err, auth.ErrUserNotFound) {
+		return nil, c.Redirect(http.StatusSeeOther, auth.LoginPath())
+	}
+	if err != nil {
+		return nil, c.Error(http.StatusInternalServerError, err)
+	}
+	return user, nil
+}
+
+// render shows the account page with errors from the last submission.
+func (a *Account) render(c buffalo.Context, status int, user *auth.User, errs []string) error {
+	return views.Render(c, status, views.PageAccount, map[string]any{
+		"user":         user,
+		"account_path": a.Path,
+		"avatars":      a.Avatars != nil,
+		"usernames":    a.Usernames,
+		"sessions":     a.Sessions,
+		// Plush treats a nil *time.Time as set, so pass a bool
+		"email_verified": user.EmailVerifiedAt != nil,
+		"errors":         errs,
+	})
+}
+
+// done redirects back to the account page with a success message.
+func (a *Account) done(c buffalo.Context, message string) error {
+	c.Flash().Add("success", message)
+	return c.Redirect(http.StatusSeeOther, a.Path)
+}
+
+// compile-time check that the memory store can back the account pages
+var _ auth.ProfileStore = (*auth.MemoryStore)(nil)
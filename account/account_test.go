@@ -0,0 +1,391 @@
+package account_test
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/account"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/geoip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAccountApp(t *testing.T, avatars account.AvatarStorage) (*buffkittest.App, *buffkittest.Client) {
+	t.Helper()
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Account: true, BaseURL: "https://app.example.com", Avatars: avatars},
+	})
+
+	digest, err := auth.HashPassword("old-password")
+	require.NoError(t, err)
+	user := &auth.User{Email: "ada@example.com", DisplayName: "Ada", PasswordDigest: digest}
+	require.NoError(t, app.Kit.AuthStore.Create(context.Background(), user))
+
+	return app, buffkittest.LoginAs(t, app, user)
+}
+
+func currentUser(t *testing.T, app *buffkittest.App, email string) *auth.User {
+	t.Helper()
+	user, err := app.Kit.AuthStore.ByEmail(context.Background(), email)
+	require.NoError(t, err)
+	return user
+}
+
+func TestAccountPage(t *testing.T) {
+	app, client := newAccountApp(t, nil)
+
+	buffkittest.AssertRedirect(t, app.Client().Get("/account"), "/login")
+
+	res := client.Get("/account")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertElement(t, res.Body.String(), "input", "name", "display_name", "value", "Ada")
+	buffkittest.AssertText(t, res.Body.String(), "ada@example.com (not verified)")
+	buffkittest.AssertNoElement(t, res.Body.String(), "input", "name", "avatar")
+}
+
+func TestUpdateProfile(t *testing.T) {
+	app, client := newAccountApp(t, nil)
+
+	res := client.Post("/account/profile", url.Values{"display_name": {"  Ada Lovelace "}})
+	buffkittest.AssertRedirect(t, res, "/account")
+	assert.Equal(t, "Ada Lovelace", currentUser(t, app, "ada@example.com").DisplayName)
+
+	res = client.Get("/account")
+	buffkittest.AssertText(t, res.Body.String(), "Profile updated")
+
+	res = client.Post("/account/profile", url.Values{"display_name": {strings.Repeat("x", 101)}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+}
+
+// emailLink returns the request URI of the first link in the last
+// message sent to email.
+func emailLink(t *testing.T, app *buffkittest.App, email string) string {
+	t.Helper()
+	msg, ok := app.Mailbox().LastTo(email)
+	require.True(t, ok, "no mail to %s", email)
+	links := msg.ExtractLinks()
+	require.NotEmpty(t, links)
+	link, err := url.Parse(links[0])
+	require.NoError(t, err)
+	return link.RequestURI()
+}
+
+func TestUpdateEmail(t *testing.T) {
+	app, client := newAccountApp(t, nil)
+	ctx := context.Background()
+	require.NoError(t, app.Kit.AuthStore.Create(ctx, &auth.User{Email: "taken@example.com"}))
+
+	res := client.Post("/account/email", url.Values{"email": {"taken@example.com"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "already in use")
+
+	res = client.Post("/account/email", url.Values{"email": {"Ada@Lovelace.test"}})
+	buffkittest.AssertRedirect(t, res, "/account")
+
+	// Nothing changes until the new address confirms
+	user := currentUser(t, app, "ada@example.com")
+	assert.Equal(t, "ada@lovelace.test", user.PendingEmail)
+	res = client.Get("/account")
+	require.Equal(t, http.StatusOK, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "Waiting for confirmation from ada@lovelace.test")
+
+	confirm := emailLink(t, app, "ada@lovelace.test")
+	notice, ok := app.Mailbox().LastTo("ada@example.com")
+	require.True(t, ok)
+	assert.Contains(t, notice.Text, "ada@lovelace.test")
+
+	t.Run("tampered link", func(t *testing.T) {
+		res := app.Client().Get(strings.Replace(confirm, "lovelace", "evil", 1))
+		assert.Equal(t, http.StatusForbidden, res.Code)
+	})
+
+	res = client.Get(confirm)
+	buffkittest.AssertRedirect(t, res, "/account")
+	user = currentUser(t, app, "ada@lovelace.test")
+	assert.Empty(t, user.PendingEmail)
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	// The session follows the new address
+	res = client.Get("/account")
+	require.Equal(t, http.StatusOK, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "ada@lovelace.test (verified)")
+
+	t.Run("confirm link is single use", func(t *testing.T) {
+		res := app.Client().Get(confirm)
+		assert.Equal(t, http.StatusGone, res.Code)
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		res := client.Post("/account/email", url.Values{"email": {"ada@later.test"}})
+		buffkittest.AssertRedirect(t, res, "/account")
+		link := emailLink(t, app, "ada@later.test")
+
+		app.Clock.Advance(account.DefaultConfirmTTL + time.Minute)
+		res = app.Client().Get(link)
+		assert.Equal(t, http.StatusGone, res.Code)
+		assert.Equal(t, "ada@lovelace.test", currentUser(t, app, "ada@lovelace.test").Email)
+	})
+}
+
+func TestEmailLinksUseBaseURL(t *testing.T) {
+	app, client := newAccountApp(t, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/account/email", strings.NewReader(url.Values{"email": {"ada@lovelace.test"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Host = "evil.test"
+	buffkittest.AssertRedirect(t, client.Do(req), "/account")
+
+	for _, to := range []string{"ada@lovelace.test", "ada@example.com"} {
+		msg, ok := app.Mailbox().LastTo(to)
+		require.True(t, ok)
+		links := msg.ExtractLinks()
+		require.NotEmpty(t, links)
+		assert.True(t, strings.HasPrefix(links[0], "https://app.example.com/account/email/"), links[0])
+	}
+
+	_, err := buffkit.Wire(buffalo.New(buffalo.Options{Env: "test"}), buffkit.Config{AuthSecret: []byte("secret"), Account: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "BaseURL")
+}
+
+func TestRevertEmail(t *testing.T) {
+	t.Run("before confirmation", func(t *testing.T) {
+		app, client := newAccountApp(t, nil)
+		res := client.Post("/account/email", url.Values{"email": {"mallory@example.com"}})
+		buffkittest.AssertRedirect(t, res, "/account")
+		confirm := emailLink(t, app, "mallory@example.com")
+
+		res = app.Client().Get(emailLink(t, app, "ada@example.com"))
+		buffkittest.AssertRedirect(t, res, "/account")
+		assert.Empty(t, currentUser(t, app, "ada@example.com").PendingEmail)
+
+		// The cancelled change can't be confirmed
+		res = app.Client().Get(confirm)
+		assert.Equal(t, http.StatusGone, res.Code)
+		assert.Equal(t, "ada@example.com", currentUser(t, app, "ada@example.com").Email)
+	})
+
+	t.Run("after confirmation", func(t *testing.T) {
+		app, client := newAccountApp(t, nil)
+		res := client.Post("/account/email", url.Values{"email": {"mallory@example.com"}})
+		buffkittest.AssertRedirect(t, res, "/account")
+		revert := emailLink(t, app, "ada@example.com")
+
+		res = client.Get(emailLink(t, app, "mallory@example.com"))
+		buffkittest.AssertRedirect(t, res, "/account")
+		currentUser(t, app, "mallory@example.com")
+
+		// Revert links outlive confirm links
+		app.Clock.Advance(account.DefaultConfirmTTL + time.Hour)
+		res = client.Get(revert)
+		buffkittest.AssertRedirect(t, res, "/account")
+		user := currentUser(t, app, "ada@example.com")
+		assert.NotNil(t, user.EmailVerifiedAt)
+
+		// The session follows the restored address
+		res = client.Get("/account")
+		require.Equal(t, http.StatusOK, res.Code)
+		buffkittest.AssertText(t, res.Body.String(), "ada@example.com (verified)")
+
+		res = app.Client().Get(revert)
+		assert.Equal(t, http.StatusGone, res.Code)
+	})
+}
+
+func TestUpdateUsername(t *testing.T) {
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Account: true, BaseURL: "https://app.example.com", LoginIdentifier: auth.LoginWithEmailOrUsername},
+	})
+	require.NoError(t, app.Kit.AuthStore.Create(context.Background(), &auth.User{Email: "grace@example.com", Username: "grace"}))
+	client := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com"})
+
+	res := client.Get("/account")
+	buffkittest.AssertElement(t, res.Body.String(), "input", "name", "username")
+
+	res = client.Post("/account/username", url.Values{"username": {"Grace"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "already taken")
+
+	res = client.Post("/account/username", url.Values{"username": {"a!"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+
+	res = client.Post("/account/username", url.Values{"username": {" Ada.L "}})
+	buffkittest.AssertRedirect(t, res, "/account")
+	assert.Equal(t, "ada.l", currentUser(t, app, "ada@example.com").Username)
+}
+
+func TestUpdatePassword(t *testing.T) {
+	app, client := newAccountApp(t, nil)
+
+	for name, form := range map[string]url.Values{
+		"wrong current password": {"current_password": {"nope"}, "new_password": {"new-password"}, "password_confirmation": {"new-password"}},
+		"too short":              {"current_password": {"old-password"}, "new_password": {"short"}, "password_confirmation": {"short"}},
+		"mismatched":             {"current_password": {"old-password"}, "new_password": {"new-password"}, "password_confirmation": {"other-password"}},
+	} {
+		res := client.Post("/account/password", form)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code, name)
+	}
+
+	res := client.Post("/account/password", url.Values{
+		"current_password":      {"old-password"},
+		"new_password":          {"new-password"},
+		"password_confirmation": {"new-password"},
+	})
+	buffkittest.AssertRedirect(t, res, "/account")
+	assert.NoError(t, auth.CheckPassword("new-password", currentUser(t, app, "ada@example.com").PasswordDigest))
+}
+
+func TestPasswordChangeLogsOutOtherDevices(t *testing.T) {
+	app, client := newAccountApp(t, nil)
+	ctx := context.Background()
+	store := app.Kit.AuthStore.(auth.SessionStore)
+	user := currentUser(t, app, "ada@example.com")
+	var changes []auth.PasswordChange
+	auth.OnPasswordChange(func(ctx context.Context, p auth.PasswordChange) { changes = append(changes, p) })
+	t.Cleanup(func() { auth.OnPasswordChange(nil); auth.UseLogoutOnPasswordChange(false) })
+
+	change := func(from, to string) *httptest.ResponseRecorder {
+		require.NoError(t, store.CreateSession(ctx, &auth.Session{ID: "phone", UserID: user.ID, LastSeenAt: time.Now()}))
+		return client.Post("/account/password", url.Values{
+			"current_password": {from}, "new_password": {to}, "password_confirmation": {to},
+		})
+	}
+
+	buffkittest.AssertRedirect(t, change("old-password", "new-password"), "/account")
+	_, err := store.Session(ctx, "phone")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	sessions, err := store.UserSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1, "this device stays logged in")
+	require.Len(t, changes, 1)
+	assert.Equal(t, auth.PasswordChange{
+		UserID: user.ID, Via: "account", IP: changes[0].IP, UserAgent: changes[0].UserAgent,
+		SessionsEnded: 1, KeptCurrent: true, At: changes[0].At,
+	}, changes[0])
+
+	auth.UseLogoutOnPasswordChange(true)
+	buffkittest.AssertRedirect(t, change("new-password", "newer-password"), "/login")
+	sessions, err = store.UserSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	assert.Equal(t, 2, changes[1].SessionsEnded)
+	assert.False(t, changes[1].KeptCurrent)
+	buffkittest.AssertRedirect(t, client.Get("/account"), "/login")
+}
+
+func uploadAvatar(client *buffkittest.Client, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("avatar", "me.png")
+	_, _ = part.Write(data)
+	_ = w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/account/avatar", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return client.Do(req)
+}
+
+func TestUploadAvatar(t *testing.T) {
+	dir := t.TempDir()
+	app, client := newAccountApp(t, account.NewDirStorage(dir, "/avatars/"))
+
+	res := client.Get("/account")
+	buffkittest.AssertElement(t, res.Body.String(), "input", "name", "avatar")
+
+	res = uploadAvatar(client, []byte("not an image"))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+	res = uploadAvatar(client, png)
+	buffkittest.AssertRedirect(t, res, "/account")
+
+	avatar := currentUser(t, app, "ada@example.com").AvatarURL
+	require.True(t, strings.HasPrefix(avatar, "/avatars/") && strings.HasSuffix(avatar, ".png"), avatar)
+	saved, err := os.ReadFile(filepath.Join(dir, strings.TrimPrefix(avatar, "/avatars/")))
+	require.NoError(t, err)
+	assert.Equal(t, png, saved)
+
+	res = uploadAvatar(client, append(png, make([]byte, account.DefaultMaxAvatarSize)...))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+}
+
+func TestAvatarQuota(t *testing.T) {
+	ctx := context.Background()
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Account: true, BaseURL: "https://app.example.com", Avatars: account.NewDirStorage(t.TempDir(), "/avatars"), StorageQuota: 1000},
+	})
+	user := &auth.User{Email: "ada@example.com"}
+	require.NoError(t, app.Kit.AuthStore.Create(ctx, user))
+	client := buffkittest.LoginAs(t, app, user)
+	require.NotNil(t, app.Kit.Account.Quota)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 592)...)
+	buffkittest.AssertRedirect(t, uploadAvatar(client, png), "/account")
+	buffkittest.AssertRedirect(t, uploadAvatar(client, png), "/account")
+	used, limit, err := app.Kit.Quota.Usage(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), used, "a new avatar replaces the old one's size")
+	assert.Equal(t, int64(1000), limit)
+
+	require.NoError(t, app.Kit.Quota.Reserve(ctx, user.ID, "attachment:1", 300))
+	res := uploadAvatar(client, append(png, make([]byte, 200)...))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "You don't have room for this upload")
+}
+
+func TestSessionsPage(t *testing.T) {
+	app, client := newAccountApp(t, nil)
+	ctx := context.Background()
+	store := app.Kit.AuthStore.(auth.SessionStore)
+	user := currentUser(t, app, "ada@example.com")
+
+	res := client.Get("/account")
+	buffkittest.AssertElement(t, res.Body.String(), "a", "href", "/account/sessions")
+
+	phone := &auth.Session{
+		ID: "phone", UserID: user.ID, IP: "81.2.69.142", LastSeenAt: time.Now(),
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) Version/17.5 Mobile/15E148 Safari/604.1",
+		Location:  geoip.Location{City: "Berlin", CountryCode: "DE"},
+	}
+	require.NoError(t, store.CreateSession(ctx, phone))
+	other := &auth.Session{ID: "grace-laptop", UserID: "grace@example.com", LastSeenAt: time.Now()}
+	require.NoError(t, store.CreateSession(ctx, other))
+
+	res = client.Get("/account/sessions")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertText(t, res.Body.String(), "Safari on iOS — Berlin, DE")
+	buffkittest.AssertText(t, res.Body.String(), "This device")
+	buffkittest.AssertElement(t, res.Body.String(), "form", "action", "/account/sessions/phone/end")
+	buffkittest.AssertNoElement(t, res.Body.String(), "form", "action", "/account/sessions/grace-laptop/end")
+
+	// Other users' sessions can't be ended
+	res = client.Post("/account/sessions/grace-laptop/end", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	buffkittest.AssertRedirect(t, client.Post("/account/sessions/phone/end", nil), "/account/sessions")
+	_, err := store.Session(ctx, "phone")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+
+	require.NoError(t, store.CreateSession(ctx, phone))
+	buffkittest.AssertRedirect(t, client.Post("/account/sessions/end-others", nil), "/account/sessions")
+	sessions, err := store.UserSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	// Ending this device's session logs it out
+	buffkittest.AssertRedirect(t, client.Post("/account/sessions/"+sessions[0].ID+"/end", nil), "/login")
+	buffkittest.AssertRedirect(t, client.Get("/account"), "/login")
+}
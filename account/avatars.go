@@ -0,0 +1,138 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/quota"
+)
+
+// AvatarStorage saves uploaded avatar images and returns the URL they're
+// served from. Implement it to keep avatars in object storage or a CDN.
+type AvatarStorage interface {
+	SaveAvatar(ctx context.Context, userID, ext string, r io.Reader) (url string, err error)
+}
+
+// avatarTypes are the image types accepted as avatars, by sniffed
+// content type, with the extension they're stored under.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// DirStorage keeps avatars as files in Dir, served by the app at
+// URLPrefix (e.g. Dir "public/avatars" and URLPrefix "/avatars").
+type DirStorage struct {
+	Dir       string
+	URLPrefix string
+}
+
+// NewDirStorage creates a DirStorage.
+func NewDirStorage(dir, urlPrefix string) *DirStorage {
+	return &DirStorage{Dir: dir, URLPrefix: strings.TrimSuffix(urlPrefix, "/")}
+}
+
+// SaveAvatar writes r to a new file with a random name, so a changed
+// avatar gets a new URL and caches never serve the old one.
+func (s *DirStorage) SaveAvatar(ctx context.Context, userID, ext string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("account: avatar dir: %w", err)
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(b) + ext
+
+	f, err := os.Create(filepath.Join(s.Dir, name))
+	if err != nil {
+		return "", fmt.Errorf("account: save avatar: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("account: save avatar: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("account: save avatar: %w", err)
+	}
+	return s.URLPrefix + "/" + name, nil
+}
+
+// UploadAvatar stores the "avatar" file from a multipart form. The
+// image type is sniffed from the content rather than trusted from the
+// client.
+func (a *Account) UploadAvatar(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+
+	maxSize := a.MaxAvatarSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAvatarSize
+	}
+	// Leave room for the multipart framing around the file
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxSize+4096)
+
+	file, header, err := c.Request().FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return a.render(c, http.StatusRequestEntityTooLarge, user, []string{avatarSizeMessage(maxSize)})
+		}
+		return a.render(c, http.StatusUnprocessableEntity, user, []string{"Choose an image to upload"})
+	}
+	defer func() { _ = file.Close() }()
+	if header.Size > maxSize {
+		return a.render(c, http.StatusRequestEntityTooLarge, user, []string{avatarSizeMessage(maxSize)})
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	if int64(len(data)) > maxSize {
+		return a.render(c, http.StatusRequestEntityTooLarge, user, []string{avatarSizeMessage(maxSize)})
+	}
+	ext, ok := avatarTypes[http.DetectContentType(data)]
+	if !ok {
+		return a.render(c, http.StatusUnprocessableEntity, user, []string{"Avatar must be a PNG, JPEG, GIF, or WebP image"})
+	}
+
+	if a.Quota != nil {
+		// Replaces the previous avatar's size, as it replaces the avatar
+		if err := a.Quota.Reserve(c, user.ID, "avatar", int64(len(data))); err != nil {
+			var exceeded *quota.ExceededError
+			if errors.As(err, &exceeded) {
+				return a.render(c, http.StatusRequestEntityTooLarge, user, []string{exceeded.PublicMessage()})
+			}
+			return c.Error(http.StatusInternalServerError, err)
+		}
+	}
+
+	url, err := a.Avatars.SaveAvatar(c, user.ID, ext, bytes.NewReader(data))
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := a.Store.UpdateAvatarURL(c, user.ID, url); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return a.done(c, "Avatar updated")
+}
+
+func avatarSizeMessage(max int64) string {
+	return fmt.Sprintf("Avatar must be at most %d KB", max>>10)
+}
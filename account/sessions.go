@@ -0,0 +1,115 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// sessionStore returns the store as an auth.SessionStore, or renders an
+// error when it isn't one. A nil store means the response is handled.
+func (a *Account) sessionStore(c buffalo.Context) (auth.SessionStore, error) {
+	store, ok := a.Store.(auth.SessionStore)
+	if !ok {
+		return nil, c.Error(http.StatusInternalServerError, fmt.Errorf("account: sessions need an auth.SessionStore, got %T", a.Store))
+	}
+	return store, nil
+}
+
+// ShowSessions lists where the user is logged in, as "Chrome on macOS —
+// Berlin, DE", with the current device first.
+func (a *Account) ShowSessions(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+	store, err := a.sessionStore(c)
+	if store == nil {
+		return err
+	}
+	list, err := store.UserSessions(c, user.ID)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	current := auth.CurrentSessionID(c)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].ID == current && list[j].ID != current
+	})
+	return views.Render(c, http.StatusOK, views.PageSessions, map[string]any{
+		"user":            user,
+		"sessions":        list,
+		"current_session": current,
+		"account_path":    a.Path,
+	})
+}
+
+// EndSession logs one of the user's devices out.
+func (a *Account) EndSession(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+	store, err := a.sessionStore(c)
+	if store == nil {
+		return err
+	}
+
+	// Someone else's session is treated as missing
+	s, err := store.Session(c, c.Param("id"))
+	if errors.Is(err, auth.ErrSessionNotFound) || (err == nil && s.UserID != user.ID) {
+		return c.Error(http.StatusNotFound, auth.ErrSessionNotFound)
+	}
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := store.DeleteSession(c, s.ID); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if s.ID == auth.CurrentSessionID(c) {
+		return auth.LogoutHandler(c)
+	}
+	c.Flash().Add("success", s.Device()+" was logged out")
+	return c.Redirect(http.StatusSeeOther, a.Path+"/sessions")
+}
+
+// EndOtherSessions logs out every device but this one.
+func (a *Account) EndOtherSessions(c buffalo.Context) error {
+	user, err := a.currentUser(c)
+	if user == nil {
+		return err
+	}
+	store, err := a.sessionStore(c)
+	if store == nil {
+		return err
+	}
+	list, err := store.UserSessions(c, user.ID)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	current := auth.CurrentSessionID(c)
+	ended := 0
+	for _, s := range list {
+		if s.ID == current {
+			continue
+		}
+		if err := store.DeleteSession(c, s.ID); err != nil {
+			return c.Error(http.StatusInternalServerError, err)
+		}
+		ended++
+	}
+	c.Flash().Add("success", fmt.Sprintf("Logged out of %d other %s", ended, plural(ended, "device", "devices")))
+	return c.Redirect(http.StatusSeeOther, a.Path+"/sessions")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,301 @@
+// Package analytics counts page views and events on the app's own
+// servers, without third-party scripts or cookies:
+//
+//	app.Use(kit.Analytics.Middleware) // Wire does this with Config.Analytics
+//
+//	<bk-analytics></bk-analytics>
+//	<button onclick="bkTrack('signup-click')">Sign up</button>
+//
+// Page views are recorded on the server as HTML pages are served. Events
+// from the browser are sent to the collect endpoint, which takes
+// navigator.sendBeacon's requests.
+//
+// Visitors are counted by a hash of their IP address and user agent with
+// a secret salt and the date, so no cookie is set, no address is stored,
+// and a visitor can't be followed from one day to the next. Requests with
+// Do Not Track or Global Privacy Control set, and bots, aren't counted.
+//
+// Raw events are rolled up into daily counts by the analytics:rollup job
+// (or the buffkit:analytics:rollup task), after which they're deleted
+// once they're older than Retention. The dashboard at Path shows the
+// counts.
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/internalpath"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/useragent"
+)
+
+// PageView is the Name of page view events.
+const PageView = "pageview"
+
+// DefaultRetention is how long raw events are kept when Retention isn't
+// set. Daily counts are kept for good.
+const DefaultRetention = 7 * 24 * time.Hour
+
+// maxBody limits what the collect endpoint reads.
+const maxBody = 4 << 10
+
+// maxField limits the length of stored names, paths and referrers.
+const maxField = 512
+
+// Event is a page view or an event sent from the browser.
+type Event struct {
+	Name     string          `json:"name" db:"name"` // PageView or the app's own, e.g. "signup-click"
+	Path     string          `json:"path" db:"path"`
+	Referrer string          `json:"referrer" db:"referrer"` // the referring site's host, "" for direct visits
+	Visitor  string          `json:"visitor" db:"visitor"`   // the day's hash of the visitor
+	Device   useragent.Class `json:"device" db:"device"`
+	At       time.Time       `json:"at" db:"created_at"`
+}
+
+// Analytics records events and serves the collect endpoint and dashboard.
+type Analytics struct {
+	Store Store
+
+	// Salt keys the visitor hash, so it can't be reversed by hashing
+	// every address. Wire uses the current secret of AuthSecret or
+	// AuthSecrets.
+	Salt []byte
+
+	// Path is where the dashboard is mounted; "/analytics" when empty.
+	Path string
+
+	// CollectPath is the endpoint events are sent to; "/__collect" when
+	// empty.
+	CollectPath string
+
+	// Skip lists path prefixes whose page views aren't recorded, in
+	// addition to /assets, the dashboard, the collect endpoint and
+	// Buffkit's own endpoints (see internalpath).
+	Skip []string
+
+	// Retention is how long raw events are kept after they're rolled up;
+	// DefaultRetention when zero.
+	Retention time.Duration
+
+	// CanView says who may see the dashboard. Nil lets no one.
+	CanView func(c buffalo.Context) bool
+
+	Clock clock.Clock
+}
+
+// New creates an Analytics keeping events in store.
+func New(store Store, salt []byte) *Analytics {
+	return &Analytics{Store: store, Salt: salt}
+}
+
+// Routes returns the routes Mount adds.
+func (a *Analytics) Routes() [][2]string {
+	return [][2]string{
+		{http.MethodPost, a.collectPath()},
+		{http.MethodGet, a.path()},
+	}
+}
+
+// Mount adds the collect endpoint and the dashboard to app. The
+// dashboard requires login, and CanView. The collect endpoint takes
+// posts without a CSRF token, as beacons can't send one; apps using
+// Buffalo's CSRF middleware should skip it for Collect.
+func (a *Analytics) Mount(app *buffalo.App) {
+	app.POST(a.collectPath(), a.Collect)
+	app.GET(a.path(), auth.RequireLogin(a.Dashboard))
+}
+
+// Record stores an event from the request, filling in its visitor,
+// device and time. Bots and visitors asking not to be tracked are
+// skipped.
+func (a *Analytics) Record(c buffalo.Context, e Event) error {
+	r := c.Request()
+	if !Trackable(r) {
+		return nil
+	}
+	e.At = clock.Or(a.Clock).Now().UTC()
+	e.Device = useragent.Parse(r.UserAgent()).Device
+	e.Visitor = a.visitor(r, e.At)
+	e.Name = truncate(e.Name)
+	e.Path = truncate(e.Path)
+	e.Referrer = truncate(e.Referrer)
+	return a.Store.Record(c, e)
+}
+
+// Trackable reports whether r may be counted: it isn't from a bot, and
+// doesn't carry Do Not Track or Global Privacy Control.
+func Trackable(r *http.Request) bool {
+	if r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1" {
+		return false
+	}
+	return !useragent.Parse(r.UserAgent()).Bot()
+}
+
+// Middleware records a page view for each HTML page served: successful
+// GET requests answered with text/html that aren't htmx partials or
+// under a skipped path. Failing to record is logged, not returned.
+func (a *Analytics) Middleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		err := next(c)
+		r := c.Request()
+		if err != nil || r.Method != http.MethodGet || r.Header.Get("HX-Request") == "true" {
+			return err
+		}
+		if !strings.HasPrefix(c.Response().Header().Get("Content-Type"), "text/html") || a.skipped(r.URL.Path) {
+			return err
+		}
+		if status := responseStatus(c); status >= 300 {
+			return err
+		}
+		e := Event{Name: PageView, Path: r.URL.Path, Referrer: externalHost(r.Referer(), r.Host)}
+		if rerr := a.Record(c, e); rerr != nil && !errors.Is(rerr, readonly.ErrReadOnly) {
+			c.Logger().WithField("error", rerr).Error("analytics: record page view")
+		}
+		return err
+	}
+}
+
+// collected is what the collect endpoint accepts, as JSON (sent as
+// text/plain by sendBeacon) or form fields. URL is the page the event
+// happened on, and Referrer is document.referrer.
+type collected struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Referrer string `json:"referrer"`
+}
+
+// Collect records an event the browser sent, answering 204 No Content.
+// Page views can be sent too, with the name "pageview", for pages the
+// middleware doesn't see, such as ones served from a cache.
+func (a *Analytics) Collect(c buffalo.Context) error {
+	r := c.Request()
+	var in collected
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		in = collected{Name: r.FormValue("name"), URL: r.FormValue("url"), Referrer: r.FormValue("referrer")}
+	} else {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+		if err != nil {
+			return c.Error(http.StatusBadRequest, err)
+		}
+		if err := json.Unmarshal(body, &in); err != nil {
+			return c.Error(http.StatusBadRequest, errors.New("analytics: send JSON or form fields"))
+		}
+	}
+	if strings.TrimSpace(in.Name) == "" {
+		return c.Error(http.StatusBadRequest, errors.New("analytics: event needs a name"))
+	}
+
+	e := Event{Name: strings.TrimSpace(in.Name), Referrer: externalHost(in.Referrer, r.Host)}
+	if u, err := url.Parse(in.URL); err == nil {
+		e.Path = u.Path
+	}
+	if err := a.Record(c, e); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return c.Render(http.StatusNoContent, nil)
+}
+
+// visitor hashes the request's address and user agent with the salt
+// and the day.
+func (a *Analytics) visitor(r *http.Request, at time.Time) string {
+	mac := hmac.New(sha256.New, a.Salt)
+	_, _ = io.WriteString(mac, "analytics visitor|"+at.Format("2006-01-02")+"|"+clientIP(r)+"|"+r.UserAgent())
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func (a *Analytics) skipped(p string) bool {
+	if internalpath.Is(p) {
+		return true
+	}
+	prefixes := append([]string{"/assets/", a.path(), a.collectPath()}, a.Skip...)
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Analytics) path() string {
+	if a.Path != "" {
+		return strings.TrimSuffix(a.Path, "/")
+	}
+	return "/analytics"
+}
+
+func (a *Analytics) collectPath() string {
+	if a.CollectPath != "" {
+		return a.CollectPath
+	}
+	return "/__collect"
+}
+
+func (a *Analytics) retention() time.Duration {
+	if a.Retention > 0 {
+		return a.Retention
+	}
+	return DefaultRetention
+}
+
+func (a *Analytics) canView(c buffalo.Context) bool {
+	return a.CanView != nil && a.CanView(c)
+}
+
+// responseStatus is the status written so far, or 200 when it can't be
+// told.
+func responseStatus(c buffalo.Context) int {
+	if res, ok := c.Response().(*buffalo.Response); ok && res.Status != 0 {
+		return res.Status
+	}
+	return http.StatusOK
+}
+
+// externalHost is the host of referrer, or "" when it's empty, invalid
+// or this site.
+func externalHost(referrer, self string) string {
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if selfHost, _, err := net.SplitHostPort(self); err == nil {
+		self = selfHost
+	}
+	if host == strings.TrimPrefix(strings.ToLower(self), "www.") {
+		return ""
+	}
+	return host
+}
+
+// clientIP is the first address in X-Forwarded-For when behind a proxy,
+// else the connection's.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func truncate(s string) string {
+	if len(s) > maxField {
+		return s[:maxField]
+	}
+	return s
+}
@@ -0,0 +1,272 @@
+package analytics_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/analytics"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/useragent"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	firefox = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:131.0) Gecko/20100101 Firefox/131.0"
+	iphone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	bot     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+// htmlString renders a Plush string as HTML, so its components expand.
+type htmlString struct{ render.Renderer }
+
+func (htmlString) ContentType() string { return "text/html; charset=utf-8" }
+
+func newApp(t *testing.T) (*buffkittest.App, *clock.Fake) {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Analytics: true, Clock: clk},
+		Setup: func(app *buffalo.App) {
+			app.GET("/pricing", func(c buffalo.Context) error {
+				return c.Render(http.StatusOK, htmlString{render.String(`<h1>Pricing</h1><bk-analytics></bk-analytics>`)})
+			})
+			app.GET("/healthz", func(c buffalo.Context) error {
+				return c.Render(http.StatusOK, htmlString{render.String(`ok`)})
+			})
+			app.GET("/api/prices", func(c buffalo.Context) error {
+				return c.Render(http.StatusOK, render.JSON(map[string]int{"pro": 10}))
+			})
+		},
+	})
+	require.NotNil(t, app.Kit.Analytics)
+	return app, clk
+}
+
+// visit requests path like a browser with user agent ua from ip.
+func visit(app *buffkittest.App, path, ua, ip string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("User-Agent", ua)
+	req.RemoteAddr = ip + ":51234"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return app.Client().Do(req)
+}
+
+func events(t *testing.T, a *analytics.Analytics, clk clock.Clock) []analytics.Event {
+	t.Helper()
+	now := clk.Now()
+	list, err := a.Store.Events(context.Background(), now.Add(-24*time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	return list
+}
+
+func TestPageViews(t *testing.T) {
+	app, clk := newApp(t)
+
+	res := visit(app, "/pricing?plan=pro", firefox, "203.0.113.5", map[string]string{"Referer": "https://news.example.com/item?id=1"})
+	require.Equal(t, http.StatusOK, res.Code)
+	visit(app, "/pricing", iphone, "203.0.113.6", map[string]string{"Referer": "http://example.com/"})
+
+	// Not counted
+	visit(app, "/pricing", bot, "203.0.113.7", nil)
+	visit(app, "/pricing", firefox, "203.0.113.8", map[string]string{"DNT": "1"})
+	visit(app, "/pricing", firefox, "203.0.113.8", map[string]string{"Sec-GPC": "1"})
+	visit(app, "/pricing", firefox, "203.0.113.8", map[string]string{"HX-Request": "true"})
+	visit(app, "/api/prices", firefox, "203.0.113.8", nil)
+	visit(app, "/healthz", firefox, "203.0.113.8", nil)
+	visit(app, "/missing", firefox, "203.0.113.8", nil)
+
+	list := events(t, app.Kit.Analytics, clk)
+	require.Len(t, list, 2)
+	assert.Equal(t, analytics.PageView, list[0].Name)
+	assert.True(t, strings.HasPrefix(list[0].Path, "/pricing"), list[0].Path)
+	assert.NotContains(t, list[0].Path, "plan=pro", "query strings aren't kept")
+	assert.Equal(t, "news.example.com", list[0].Referrer)
+	assert.Equal(t, useragent.Desktop, list[0].Device)
+	assert.Equal(t, "", list[1].Referrer, "the site's own pages aren't referrers")
+	assert.Equal(t, useragent.Mobile, list[1].Device)
+	assert.NotEqual(t, list[0].Visitor, list[1].Visitor)
+	assert.NotContains(t, list[0].Visitor, "203.0.113.5")
+}
+
+func TestVisitorRotatesDaily(t *testing.T) {
+	app, clk := newApp(t)
+
+	visit(app, "/pricing", firefox, "203.0.113.5", nil)
+	visit(app, "/pricing", firefox, "203.0.113.5", nil)
+	clk.Advance(24 * time.Hour)
+	visit(app, "/pricing", firefox, "203.0.113.5", nil)
+
+	list := events(t, app.Kit.Analytics, clk)
+	require.Len(t, list, 3)
+	assert.Equal(t, list[0].Visitor, list[1].Visitor, "the same visitor the same day")
+	assert.NotEqual(t, list[1].Visitor, list[2].Visitor, "visitors can't be followed across days")
+}
+
+func TestCollect(t *testing.T) {
+	app, clk := newApp(t)
+	client := app.Client()
+
+	res := visit(app, "/pricing", firefox, "203.0.113.5", nil)
+	assert.Contains(t, res.Body.String(), "window.bkTrack")
+	assert.Contains(t, res.Body.String(), `"/__collect"`)
+
+	// sendBeacon posts a string as text/plain
+	req := httptest.NewRequest(http.MethodPost, "/__collect", strings.NewReader(
+		`{"name":"signup-click","url":"https://example.com/pricing?plan=pro","referrer":"https://search.example.org/"}`))
+	req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+	req.Header.Set("User-Agent", firefox)
+	res = client.Do(req)
+	assert.Equal(t, http.StatusNoContent, res.Code, res.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/__collect", strings.NewReader("name=download&url=%2Fdocs"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", firefox)
+	assert.Equal(t, http.StatusNoContent, client.Do(req).Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/__collect", strings.NewReader(`{"url":"/docs"}`))
+	assert.Equal(t, http.StatusBadRequest, client.Do(req).Code)
+
+	list := events(t, app.Kit.Analytics, clk)
+	var collected []analytics.Event
+	for _, e := range list {
+		if e.Name != analytics.PageView {
+			collected = append(collected, e)
+		}
+	}
+	require.Len(t, collected, 2)
+	assert.Equal(t, "signup-click", collected[0].Name)
+	assert.Equal(t, "/pricing", collected[0].Path)
+	assert.Equal(t, "search.example.org", collected[0].Referrer)
+	assert.Equal(t, "download", collected[1].Name)
+	assert.Equal(t, "/docs", collected[1].Path)
+}
+
+func TestRollupAndReport(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+	a := analytics.New(analytics.NewMemoryStore(), []byte("salt"))
+	a.Clock = clk
+	ctx := context.Background()
+
+	yesterday := time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)
+	today := clk.Now()
+	for _, e := range []analytics.Event{
+		{Name: analytics.PageView, Path: "/", Visitor: "a", Device: useragent.Desktop, At: yesterday},
+		{Name: analytics.PageView, Path: "/pricing", Referrer: "news.example.com", Visitor: "a", Device: useragent.Desktop, At: yesterday},
+		{Name: analytics.PageView, Path: "/", Visitor: "b", Device: useragent.Mobile, At: yesterday},
+		{Name: "signup-click", Path: "/pricing", Visitor: "a", At: yesterday},
+		{Name: analytics.PageView, Path: "/", Visitor: "c", Device: useragent.Mobile, At: today},
+		{Name: analytics.PageView, Path: "/", Visitor: "old", At: yesterday.AddDate(0, 0, -30)},
+	} {
+		require.NoError(t, a.Store.Record(ctx, e))
+	}
+
+	days, err := a.RollupRecent(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 6, days, "every finished day still kept")
+	rows, err := a.Store.Daily(ctx, time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Contains(t, rows, analytics.Daily{Day: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), Dimension: analytics.DimensionTotal, Count: 3, Visitors: 2})
+
+	n, err := a.Prune(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// Today isn't rolled up yet, so it's counted from its events
+	r, err := a.Report(ctx, today.AddDate(0, 0, -6), today.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), r.Views)
+	assert.Equal(t, int64(3), r.Visitors)
+	require.Len(t, r.Days, 7)
+	assert.Equal(t, int64(3), r.Days[5].Views)
+	assert.Equal(t, int64(1), r.Days[6].Views)
+	assert.Equal(t, []analytics.Count{{Value: "/", Count: 3, Visitors: 3}, {Value: "/pricing", Count: 1, Visitors: 1}}, r.Pages)
+	assert.Equal(t, []analytics.Count{{Value: "news.example.com", Count: 1, Visitors: 1}}, r.Referrers)
+	assert.Equal(t, []analytics.Count{{Value: "desktop", Count: 2, Visitors: 1}, {Value: "mobile", Count: 2, Visitors: 2}}, r.Devices)
+	assert.Equal(t, []analytics.Count{{Value: "signup-click", Count: 1, Visitors: 1}}, r.Events)
+}
+
+func TestDashboard(t *testing.T) {
+	app, _ := newApp(t)
+	app.Kit.Analytics.CanView = func(c buffalo.Context) bool {
+		user := auth.CurrentUser(c)
+		return user != nil && user.Email == "admin@example.com"
+	}
+	visit(app, "/pricing", firefox, "203.0.113.5", map[string]string{"Referer": "https://news.example.com/"})
+	visit(app, "/pricing", iphone, "203.0.113.6", nil)
+
+	buffkittest.AssertRedirect(t, app.Client().Get("/analytics"), "/login")
+
+	ada := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com"})
+	assert.Equal(t, http.StatusForbidden, ada.Get("/analytics").Code)
+
+	admin := buffkittest.LoginAs(t, app, &auth.User{Email: "admin@example.com"})
+	res := admin.Get("/analytics?days=7")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	body := res.Body.String()
+	buffkittest.AssertText(t, body, "2 page views from 2 visitors")
+	buffkittest.AssertElement(t, body, "a", "href", "/analytics?days=7", "aria-current", "page")
+	buffkittest.AssertText(t, body, "2026-10-11")
+	buffkittest.AssertText(t, body, "2026-10-17")
+	assert.NotContains(t, body, "2026-10-10", "a row per day of the period")
+	buffkittest.AssertText(t, body, "news.example.com")
+
+	assert.Len(t, events(t, app.Kit.Analytics, app.Kit.Analytics.Clock), 2, "the dashboard isn't counted")
+}
+
+func TestStores(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	schema, err := os.ReadFile("../db/migrations/analytics/20261017140000_create_analytics.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for name, store := range map[string]analytics.Store{
+		"memory": analytics.NewMemoryStore(),
+		"sql":    analytics.NewSQLStore(db, "sqlite"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+			for i, path := range []string{"/a", "/b", "/c"} {
+				require.NoError(t, store.Record(ctx, analytics.Event{
+					Name: analytics.PageView, Path: path, Visitor: "v", Device: useragent.Tablet, At: day.Add(time.Duration(i) * 12 * time.Hour),
+				}))
+			}
+			list, err := store.Events(ctx, day, day.AddDate(0, 0, 1))
+			require.NoError(t, err)
+			require.Len(t, list, 2)
+			assert.Equal(t, "/a", list[0].Path)
+			assert.Equal(t, useragent.Tablet, list[1].Device)
+			assert.True(t, day.Add(12*time.Hour).Equal(list[1].At))
+
+			require.NoError(t, store.SaveDaily(ctx, day, []analytics.Daily{{Day: day, Dimension: "path", Value: "/a", Count: 9, Visitors: 1}}))
+			require.NoError(t, store.SaveDaily(ctx, day, []analytics.Daily{{Day: day, Dimension: "path", Value: "/a", Count: 1, Visitors: 1}}))
+			rows, err := store.Daily(ctx, day, day.AddDate(0, 0, 1))
+			require.NoError(t, err)
+			require.Len(t, rows, 1, "saving a day replaces it")
+			assert.Equal(t, int64(1), rows[0].Count)
+			assert.True(t, day.Equal(rows[0].Day))
+
+			n, err := store.DeleteEvents(ctx, day.AddDate(0, 0, 1))
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+		})
+	}
+}
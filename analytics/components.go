@@ -0,0 +1,30 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+)
+
+// trackScript defines bkTrack(name), which sends an event to the collect
+// endpoint with sendBeacon, so it's delivered even as the page unloads.
+const trackScript = `<script>window.bkTrack=function(name){var body=JSON.stringify({name:name,url:location.href,referrer:document.referrer});if(navigator.sendBeacon&&navigator.sendBeacon(%[1]s,body))return;fetch(%[1]s,{method:"POST",body:body,keepalive:true,credentials:"same-origin"})};</script>`
+
+// RegisterComponents registers <bk-analytics>, which defines the
+// bkTrack(name) function pages call to record events:
+//
+//	<bk-analytics></bk-analytics>
+//	<button onclick="bkTrack('signup-click')">Sign up</button>
+//
+// Page views don't need it; the middleware records them.
+func (a *Analytics) RegisterComponents(r *components.Registry) {
+	r.RegisterContext("bk-analytics", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		endpoint, err := json.Marshal(a.collectPath())
+		if err != nil {
+			return nil, err
+		}
+		return []byte(fmt.Sprintf(trackScript, endpoint)), nil
+	})
+}
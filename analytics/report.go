@@ -0,0 +1,291 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/jobs"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// RollupTask is the job that rolls up events into daily counts and
+// deletes those past Retention.
+const RollupTask = "analytics:rollup"
+
+// Dimensions of daily counts.
+const (
+	DimensionTotal    = "total"    // every page view; Value is ""
+	DimensionPath     = "path"     // page views by path
+	DimensionReferrer = "referrer" // page views by referring site
+	DimensionDevice   = "device"   // page views by device class
+	DimensionEvent    = "event"    // other events by name
+)
+
+// Daily is a day's count of one value of a dimension, e.g. the page
+// views of "/pricing".
+type Daily struct {
+	Day       time.Time `json:"day" db:"day"` // midnight UTC
+	Dimension string    `json:"dimension" db:"dimension"`
+	Value     string    `json:"value" db:"value"`
+	Count     int64     `json:"count" db:"count"`
+	Visitors  int64     `json:"visitors" db:"visitors"` // different visitors that day
+}
+
+// Count is a value's total over a report's period.
+type Count struct {
+	Value    string
+	Count    int64
+	Visitors int64
+}
+
+// DayCount is a day's page views and visitors.
+type DayCount struct {
+	Day      time.Time
+	Views    int64
+	Visitors int64
+}
+
+// Report is the counts of a period.
+type Report struct {
+	From, To time.Time
+
+	// Views and Visitors are the period's page views and the sum of each
+	// day's visitors. Visitors aren't recognized from one day to the
+	// next, so someone visiting on two days counts twice.
+	Views    int64
+	Visitors int64
+
+	// Days has every day of the period, oldest first, including those
+	// with no views.
+	Days []DayCount
+
+	// Pages, Referrers, Devices and Events are the period's counts by
+	// path, referring site, device class and event name, most first.
+	Pages     []Count
+	Referrers []Count
+	Devices   []Count
+	Events    []Count
+}
+
+// Rollup counts day's events into daily counts, replacing any it had.
+func (a *Analytics) Rollup(ctx context.Context, day time.Time) error {
+	day = startOfDay(day)
+	events, err := a.Store.Events(ctx, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return fmt.Errorf("analytics: %w", err)
+	}
+	if err := a.Store.SaveDaily(ctx, day, rollup(day, events)); err != nil {
+		return fmt.Errorf("analytics: %w", err)
+	}
+	return nil
+}
+
+// RollupRecent rolls up every finished day whose events are all still
+// kept, so a missed run is caught up by the next, and returns how many
+// days it rolled up.
+func (a *Analytics) RollupRecent(ctx context.Context) (int, error) {
+	now := clock.Or(a.Clock).Now()
+	day := startOfDay(now.Add(-a.retention()))
+	if day.Before(now.Add(-a.retention())) {
+		day = day.AddDate(0, 0, 1)
+	}
+	n := 0
+	for today := startOfDay(now); day.Before(today); day = day.AddDate(0, 0, 1) {
+		if err := a.Rollup(ctx, day); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Prune deletes events older than Retention, and returns how many it
+// deleted. Roll them up first.
+func (a *Analytics) Prune(ctx context.Context) (int, error) {
+	return a.Store.DeleteEvents(ctx, clock.Or(a.Clock).Now().Add(-a.retention()))
+}
+
+// Schedule handles RollupTask on runtime and runs it daily, on the low
+// queue.
+func (a *Analytics) Schedule(runtime *jobs.Runtime) error {
+	runtime.HandleFunc(RollupTask, func(ctx context.Context, t *asynq.Task) error {
+		if _, err := a.RollupRecent(ctx); err != nil {
+			return err
+		}
+		_, err := a.Prune(ctx)
+		return err
+	})
+	return runtime.Every(24*time.Hour, RollupTask, map[string]string{}, asynq.Queue("low"))
+}
+
+// Report returns the counts of the days from from up to, not including,
+// to. Days that haven't been rolled up, such as today, are counted from
+// their events.
+func (a *Analytics) Report(ctx context.Context, from, to time.Time) (Report, error) {
+	from, to = startOfDay(from), startOfDay(to)
+	rows, err := a.Store.Daily(ctx, from, to)
+	if err != nil {
+		return Report{}, fmt.Errorf("analytics: %w", err)
+	}
+	rolled := make(map[time.Time]bool)
+	for _, row := range rows {
+		rolled[row.Day] = true
+	}
+
+	var missing time.Time
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !rolled[day] {
+			missing = day
+			break
+		}
+	}
+	if !missing.IsZero() {
+		events, err := a.Store.Events(ctx, missing, to)
+		if err != nil {
+			return Report{}, fmt.Errorf("analytics: %w", err)
+		}
+		byDay := make(map[time.Time][]Event)
+		for _, e := range events {
+			day := startOfDay(e.At)
+			if !rolled[day] {
+				byDay[day] = append(byDay[day], e)
+			}
+		}
+		for day, dayEvents := range byDay {
+			rows = append(rows, rollup(day, dayEvents)...)
+		}
+	}
+	return report(from, to, rows), nil
+}
+
+// Dashboard renders views.PageAnalytics for the last "days" days (7,
+// 30 or 90; 30 by default), including today.
+func (a *Analytics) Dashboard(c buffalo.Context) error {
+	if !a.canView(c) {
+		return c.Error(http.StatusForbidden, errors.New("analytics: not allowed"))
+	}
+	days, err := strconv.Atoi(c.Param("days"))
+	if err != nil || (days != 7 && days != 90) {
+		days = 30
+	}
+	to := startOfDay(clock.Or(a.Clock).Now()).AddDate(0, 0, 1)
+	r, err := a.Report(c, to.AddDate(0, 0, -days), to)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return views.Render(c, http.StatusOK, views.PageAnalytics, map[string]any{
+		"report":         r,
+		"days":           days,
+		"analytics_path": a.path(),
+	})
+}
+
+// rollup counts events, all of day, by each dimension.
+func rollup(day time.Time, events []Event) []Daily {
+	type key struct{ dimension, value string }
+	counts := make(map[key]*Daily)
+	visitors := make(map[key]map[string]bool)
+	add := func(dimension, value, visitor string) {
+		k := key{dimension, value}
+		if counts[k] == nil {
+			counts[k] = &Daily{Day: day, Dimension: dimension, Value: value}
+			visitors[k] = make(map[string]bool)
+		}
+		counts[k].Count++
+		visitors[k][visitor] = true
+	}
+	for _, e := range events {
+		if e.Name != PageView {
+			add(DimensionEvent, e.Name, e.Visitor)
+			continue
+		}
+		add(DimensionTotal, "", e.Visitor)
+		add(DimensionPath, e.Path, e.Visitor)
+		add(DimensionDevice, string(e.Device), e.Visitor)
+		if e.Referrer != "" {
+			add(DimensionReferrer, e.Referrer, e.Visitor)
+		}
+	}
+
+	rows := make([]Daily, 0, len(counts))
+	for k, d := range counts {
+		d.Visitors = int64(len(visitors[k]))
+		rows = append(rows, *d)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Dimension != rows[j].Dimension {
+			return rows[i].Dimension < rows[j].Dimension
+		}
+		return rows[i].Value < rows[j].Value
+	})
+	return rows
+}
+
+// report sums rows into the report of the days from from to to.
+func report(from, to time.Time, rows []Daily) Report {
+	r := Report{From: from, To: to}
+	totals := make(map[time.Time]DayCount)
+	byDimension := map[string]map[string]*Count{
+		DimensionPath:     {},
+		DimensionReferrer: {},
+		DimensionDevice:   {},
+		DimensionEvent:    {},
+	}
+	for _, row := range rows {
+		if row.Dimension == DimensionTotal {
+			totals[row.Day] = DayCount{Day: row.Day, Views: row.Count, Visitors: row.Visitors}
+			r.Views += row.Count
+			r.Visitors += row.Visitors
+			continue
+		}
+		counts, ok := byDimension[row.Dimension]
+		if !ok {
+			continue
+		}
+		if counts[row.Value] == nil {
+			counts[row.Value] = &Count{Value: row.Value}
+		}
+		counts[row.Value].Count += row.Count
+		counts[row.Value].Visitors += row.Visitors
+	}
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		count, ok := totals[day]
+		if !ok {
+			count = DayCount{Day: day}
+		}
+		r.Days = append(r.Days, count)
+	}
+	r.Pages = sorted(byDimension[DimensionPath])
+	r.Referrers = sorted(byDimension[DimensionReferrer])
+	r.Devices = sorted(byDimension[DimensionDevice])
+	r.Events = sorted(byDimension[DimensionEvent])
+	return r
+}
+
+// sorted lists counts, most first.
+func sorted(counts map[string]*Count) []Count {
+	list := make([]Count, 0, len(counts))
+	for _, c := range counts {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Value < list[j].Value
+	})
+	return list
+}
+
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
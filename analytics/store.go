@@ -0,0 +1,239 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+	"github.com/johnjansen/buffkit/useragent"
+)
+
+// Store keeps raw events and their daily counts. MemoryStore suits tests
+// and development; SQLStore keeps them in the database.
+type Store interface {
+	// Record saves an event.
+	Record(ctx context.Context, e Event) error
+
+	// Events returns the events from from up to, not including, to, oldest
+	// first.
+	Events(ctx context.Context, from, to time.Time) ([]Event, error)
+
+	// SaveDaily replaces the counts of day with rows.
+	SaveDaily(ctx context.Context, day time.Time, rows []Daily) error
+
+	// Daily returns the counts of the days from from up to, not including,
+	// to.
+	Daily(ctx context.Context, from, to time.Time) ([]Daily, error)
+
+	// DeleteEvents deletes events from before before, and returns how
+	// many it deleted.
+	DeleteEvents(ctx context.Context, before time.Time) (int, error)
+}
+
+// MemoryStore keeps events and counts in memory, for tests and
+// development.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	events []Event
+	daily  map[time.Time][]Daily
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{daily: make(map[time.Time][]Daily)}
+}
+
+func (s *MemoryStore) Record(ctx context.Context, e Event) error {
+	if err := readonly.Check("analytics.Record"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *MemoryStore) Events(ctx context.Context, from, to time.Time) ([]Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var events []Event
+	for _, e := range s.events {
+		if !e.At.Before(from) && e.At.Before(to) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events, nil
+}
+
+func (s *MemoryStore) SaveDaily(ctx context.Context, day time.Time, rows []Daily) error {
+	if err := readonly.Check("analytics.SaveDaily"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.daily[day.UTC()] = append([]Daily(nil), rows...)
+	return nil
+}
+
+func (s *MemoryStore) Daily(ctx context.Context, from, to time.Time) ([]Daily, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var rows []Daily
+	for day, dayRows := range s.daily {
+		if !day.Before(from) && day.Before(to) {
+			rows = append(rows, dayRows...)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Day.Before(rows[j].Day) })
+	return rows, nil
+}
+
+func (s *MemoryStore) DeleteEvents(ctx context.Context, before time.Time) (int, error) {
+	if err := readonly.Check("analytics.DeleteEvents"); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.events[:0]
+	for _, e := range s.events {
+		if !e.At.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	n := len(s.events) - len(kept)
+	s.events = kept
+	return n, nil
+}
+
+// SQLStore keeps events and counts in the analytics_events and
+// analytics_daily tables created by the db/migrations/analytics
+// migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates an analytics store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) Record(ctx context.Context, e Event) error {
+	if err := readonly.Check("analytics.Record"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO analytics_events (name, path, referrer, visitor, device, created_at) VALUES (?, ?, ?, ?, ?, ?)"),
+		e.Name, e.Path, e.Referrer, e.Visitor, string(e.Device), e.At)
+	return err
+}
+
+func (s *SQLStore) Events(ctx context.Context, from, to time.Time) ([]Event, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT name, path, referrer, visitor, device, created_at FROM analytics_events WHERE created_at >= ? AND created_at < ? ORDER BY created_at"),
+		from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var device string
+		if err := rows.Scan(&e.Name, &e.Path, &e.Referrer, &e.Visitor, &device, &e.At); err != nil {
+			return nil, err
+		}
+		e.Device = useragent.Class(device)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLStore) SaveDaily(ctx context.Context, day time.Time, rows []Daily) error {
+	if err := readonly.Check("analytics.SaveDaily"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM analytics_daily WHERE day = ?"), day); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		_, err := tx.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+			"INSERT INTO analytics_daily (day, dimension, value, count, visitors) VALUES (?, ?, ?, ?, ?)"),
+			day, row.Dimension, row.Value, row.Count, row.Visitors)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Daily(ctx context.Context, from, to time.Time) ([]Daily, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT day, dimension, value, count, visitors FROM analytics_daily WHERE day >= ? AND day < ? ORDER BY day"),
+		from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var daily []Daily
+	for rows.Next() {
+		var d Daily
+		if err := rows.Scan(&d.Day, &d.Dimension, &d.Value, &d.Count, &d.Visitors); err != nil {
+			return nil, err
+		}
+		d.Day = d.Day.UTC()
+		daily = append(daily, d)
+	}
+	return daily, rows.Err()
+}
+
+func (s *SQLStore) DeleteEvents(ctx context.Context, before time.Time) (int, error) {
+	if err := readonly.Check("analytics.DeleteEvents"); err != nil {
+		return 0, err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM analytics_events WHERE created_at < ?"), before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
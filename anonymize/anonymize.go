@@ -0,0 +1,333 @@
+// Package anonymize scrubs personal data out of a copy of a production
+// database, so staging can be refreshed from it safely. Anonymizers are
+// registered per column:
+//
+//	anonymize.Register("customers", "email", anonymize.Email)
+//	anonymize.Register("customers", "phone", anonymize.Null)
+//	anonymize.Register("customers", "notes", anonymize.Fixed("Lorem ipsum"))
+//
+// and buffalo task buffkit:db:anonymize runs them all. The columns of
+// Buffkit's own tables (users, sessions, invitations, ...) are
+// registered out of the box.
+//
+// Replacements come from a keyed hash of the original value, so equal
+// values get equal replacements within a run: an email still matches
+// across tables, and unique columns stay unique. The key is random for
+// each run, so replacements can't be matched against guesses.
+package anonymize
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+)
+
+// Anonymizer returns the replacement for one distinct, non-empty value of
+// a column. Returning nil sets the column to NULL.
+type Anonymizer func(v Value) any
+
+// Value is a value being anonymized.
+type Value struct {
+	Table  string
+	Column string
+	Text   string
+
+	key []byte
+}
+
+// Hash returns a hex keyed hash of Text, the same for equal values
+// within a run.
+func (v Value) Hash() string {
+	mac := hmac.New(sha256.New, v.key)
+	mac.Write([]byte(v.Text))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pick chooses one of choices by the value's hash.
+func (v Value) pick(choices []string) string {
+	sum, _ := hex.DecodeString(v.Hash()[:16])
+	return choices[binary.BigEndian.Uint64(sum)%uint64(len(choices))]
+}
+
+var firstNames = []string{
+	"Ada", "Alan", "Barbara", "Claude", "Dennis", "Edsger", "Frances", "Grace",
+	"Hedy", "Ivan", "Joan", "Ken", "Linus", "Margaret", "Niklaus", "Radia",
+	"Rob", "Sophie", "Tim", "Whitfield",
+}
+
+var lastNames = []string{
+	"Allen", "Backus", "Cerf", "Dijkstra", "Engelbart", "Floyd", "Goldberg",
+	"Hamilton", "Hopper", "Kay", "Knuth", "Lamport", "Liskov", "Perlman",
+	"Ritchie", "Shannon", "Thompson", "Turing", "Wilson", "Wirth",
+}
+
+// Email replaces an address with user-<hash>@example.com. Addresses that
+// differ only in case get the same replacement.
+func Email(v Value) any {
+	v.Text = strings.ToLower(strings.TrimSpace(v.Text))
+	return "user-" + v.Hash()[:16] + "@example.com"
+}
+
+// FirstName replaces a first name with a made-up one.
+func FirstName(v Value) any {
+	return v.pick(firstNames)
+}
+
+// LastName replaces a last name with a made-up one.
+func LastName(v Value) any {
+	v.Text = "last:" + v.Text
+	return v.pick(lastNames)
+}
+
+// Name replaces a full name with a made-up first and last name, and a
+// number from the hash, so different people rarely share one.
+func Name(v Value) any {
+	return FirstName(v).(string) + " " + LastName(v).(string) + " " + v.Hash()[:4]
+}
+
+// Username replaces a username with user_<hash>.
+func Username(v Value) any {
+	return "user_" + v.Hash()[:16]
+}
+
+// Token replaces a secret, such as a token or password digest, with a
+// random one that matches nothing. It isn't derived from the original.
+func Token(v Value) any {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IP replaces an IP address with one from 192.0.2.0/24, the range
+// reserved for documentation.
+func IP(v Value) any {
+	sum, _ := hex.DecodeString(v.Hash()[:2])
+	return fmt.Sprintf("192.0.2.%d", sum[0])
+}
+
+// Null clears the value.
+func Null(v Value) any {
+	return nil
+}
+
+// Fixed replaces every value with value.
+func Fixed(value any) Anonymizer {
+	return func(Value) any { return value }
+}
+
+// Rule anonymizes one column.
+type Rule struct {
+	Table      string
+	Column     string
+	Anonymizer Anonymizer
+}
+
+var (
+	rulesMu sync.Mutex
+	rules   []Rule
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Register anonymizes column of table with a, replacing any anonymizer
+// already registered for it. table may be schema-qualified.
+func Register(table, column string, a Anonymizer) error {
+	if !identifier.MatchString(table) || !identifier.MatchString(column) || strings.Contains(column, ".") {
+		return fmt.Errorf("anonymize: invalid column %q.%q", table, column)
+	}
+	if a == nil {
+		return fmt.Errorf("anonymize: %s.%s: nil Anonymizer", table, column)
+	}
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	for i, r := range rules {
+		if r.Table == table && r.Column == column {
+			rules[i].Anonymizer = a
+			return nil
+		}
+	}
+	rules = append(rules, Rule{Table: table, Column: column, Anonymizer: a})
+	return nil
+}
+
+// Rules returns the registered rules, in the order they were first
+// registered.
+func Rules() []Rule {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	return append([]Rule(nil), rules...)
+}
+
+func init() {
+	for _, r := range []Rule{
+		{"users", "email", Email},
+		{"users", "pending_email", Email},
+		{"users", "username", Username},
+		{"users", "first_name", FirstName},
+		{"users", "last_name", LastName},
+		{"users", "display_name", Name},
+		{"users", "avatar_url", Null},
+		{"users", "password_digest", Token},
+		{"users", "email_verification_token", Null},
+		{"users", "password_reset_token", Null},
+		{"users", "totp_secret", Null},
+		{"users", "recovery_codes", Null},
+		{"users", "last_login_ip", IP},
+		{"sessions", "token", Token},
+		{"sessions", "ip_address", IP},
+		{"sessions", "user_agent", Null},
+		{"login_attempts", "email", Email},
+		{"login_attempts", "ip_address", IP},
+		{"login_attempts", "user_agent", Null},
+		{"auth_audit_logs", "ip_address", IP},
+		{"auth_audit_logs", "user_agent", Null},
+		{"user_devices", "ip_address", IP},
+		{"user_devices", "device_name", Null},
+		{"org_invitations", "email", Email},
+		{"mail_campaign_recipients", "email", Email},
+		{"comments", "author_name", Name},
+	} {
+		_ = Register(r.Table, r.Column, r.Anonymizer)
+	}
+}
+
+// Result is what a Runner did to one column.
+type Result struct {
+	Table  string
+	Column string
+
+	// Values is how many distinct values were replaced.
+	Values int
+
+	// Skipped is set when the table or column doesn't exist, such as
+	// the tables of features the app doesn't use.
+	Skipped bool
+}
+
+// Runner applies rules to a database.
+type Runner struct {
+	DB      *sql.DB
+	Dialect string
+
+	// Rules are the rules applied. Defaults to Rules().
+	Rules []Rule
+
+	// Key keys the hashes replacements come from. Defaults to random
+	// bytes for each run.
+	Key []byte
+
+	// BatchSize is how many values are replaced per transaction.
+	// Defaults to 500.
+	BatchSize int
+}
+
+// NewRunner creates a Runner for db with the registered rules.
+func NewRunner(db *sql.DB, dialect string) *Runner {
+	return &Runner{DB: db, Dialect: dialect}
+}
+
+// Run applies the rules column by column. Each column's distinct values
+// are read into memory, then replaced wherever they appear. Columns that
+// don't exist are skipped; any other failure stops the run.
+func (r *Runner) Run(ctx context.Context) ([]Result, error) {
+	rules := r.Rules
+	if rules == nil {
+		rules = Rules()
+	}
+	key := r.Key
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("anonymize: %w", err)
+		}
+	}
+
+	var results []Result
+	for _, rule := range rules {
+		if !identifier.MatchString(rule.Table) || !identifier.MatchString(rule.Column) {
+			return results, fmt.Errorf("anonymize: invalid column %q.%q", rule.Table, rule.Column)
+		}
+		result := Result{Table: rule.Table, Column: rule.Column}
+		if !r.exists(ctx, rule) {
+			result.Skipped = true
+			results = append(results, result)
+			continue
+		}
+		n, err := r.column(ctx, rule, key)
+		result.Values = n
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("anonymize: %s.%s: %w", rule.Table, rule.Column, err)
+		}
+	}
+	return results, nil
+}
+
+// exists reports whether rule's column can be selected.
+func (r *Runner) exists(ctx context.Context, rule Rule) bool {
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+rule.Column+" FROM "+rule.Table+" WHERE 1 = 0")
+	if err != nil {
+		return false
+	}
+	_ = rows.Close()
+	return true
+}
+
+func (r *Runner) column(ctx context.Context, rule Rule, key []byte) (int, error) {
+	rows, err := r.DB.QueryContext(ctx, "SELECT DISTINCT "+rule.Column+" FROM "+rule.Table+
+		" WHERE "+rule.Column+" IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	batch := r.BatchSize
+	if batch <= 0 {
+		batch = 500
+	}
+	update := sqlutil.Rebind(r.Dialect, "UPDATE "+rule.Table+" SET "+rule.Column+" = ? WHERE "+rule.Column+" = ?")
+	done := 0
+	for start := 0; start < len(values); start += batch {
+		end := min(start+batch, len(values))
+		tx, err := r.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return done, err
+		}
+		for _, v := range values[start:end] {
+			replacement := rule.Anonymizer(Value{Table: rule.Table, Column: rule.Column, Text: v, key: key})
+			if _, err := tx.ExecContext(ctx, update, replacement, v); err != nil {
+				_ = tx.Rollback()
+				return done, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return done, err
+		}
+		done = end
+	}
+	return done, nil
+}
@@ -0,0 +1,125 @@
+package anonymize_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/johnjansen/buffkit/anonymize"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	schema, err := os.ReadFile("../db/migrations/auth/0001_create_users.up.sql")
+	require.NoError(t, err)
+	for _, stmt := range strings.Split(string(schema), ";") {
+		if strings.TrimSpace(stmt) != "" {
+			_, err = db.Exec(stmt)
+			require.NoError(t, err)
+		}
+	}
+	return db
+}
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	_, err := db.Exec(`INSERT INTO users (id, email, password_digest, first_name, display_name, password_reset_token, last_login_ip) VALUES
+		('1', 'ada@example.org', '$2a$10$ada', 'Ada', 'Ada Lovelace', 'reset-ada', '203.0.113.7'),
+		('2', 'bob@example.org', '$2a$10$bob', 'Bob', '', NULL, NULL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO login_attempts (id, email, ip_address) VALUES
+		('a', 'ADA@example.org', '203.0.113.7'), ('b', 'ada@example.org', '198.51.100.1')`)
+	require.NoError(t, err)
+
+	runner := anonymize.NewRunner(db, "sqlite")
+	runner.Key = []byte("test")
+	runner.BatchSize = 1
+	results, err := runner.Run(ctx)
+	require.NoError(t, err)
+
+	byColumn := map[string]anonymize.Result{}
+	for _, r := range results {
+		byColumn[r.Table+"."+r.Column] = r
+	}
+	assert.Equal(t, 2, byColumn["users.email"].Values)
+	assert.Equal(t, 1, byColumn["users.display_name"].Values, "empty values are left alone")
+	assert.Equal(t, 2, byColumn["login_attempts.email"].Values)
+	assert.True(t, byColumn["users.pending_email"].Skipped, "columns added by later migrations are skipped")
+	assert.True(t, byColumn["comments.author_name"].Skipped)
+
+	var email, digest, first, display, ip string
+	var reset sql.NullString
+	require.NoError(t, db.QueryRow(`SELECT email, password_digest, first_name, display_name, password_reset_token, last_login_ip
+		FROM users WHERE id = '1'`).Scan(&email, &digest, &first, &display, &reset, &ip))
+	assert.Regexp(t, `^user-[0-9a-f]{16}@example\.com$`, email)
+	assert.Len(t, digest, 64)
+	assert.NotEqual(t, "Ada", first)
+	assert.NotContains(t, display, "Lovelace")
+	assert.False(t, reset.Valid)
+	assert.Regexp(t, `^192\.0\.2\.\d+$`, ip)
+
+	var bob string
+	require.NoError(t, db.QueryRow(`SELECT email FROM users WHERE id = '2'`).Scan(&bob))
+	assert.NotEqual(t, email, bob)
+
+	rows, err := db.Query(`SELECT email FROM login_attempts ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var attempt string
+		require.NoError(t, rows.Scan(&attempt))
+		assert.Equal(t, email, attempt, "the same address is replaced the same way everywhere, whatever its case")
+	}
+}
+
+func TestReplacementsDependOnTheKey(t *testing.T) {
+	v := anonymize.Value{Text: "ada@example.org"}
+	assert.Equal(t, anonymize.Email(v), anonymize.Email(anonymize.Value{Text: " Ada@Example.org"}))
+	assert.NotEqual(t, anonymize.Email(v), anonymize.Email(anonymize.Value{Text: "bob@example.org"}))
+	assert.Nil(t, anonymize.Null(v))
+	assert.Equal(t, "x", anonymize.Fixed("x")(v))
+	assert.NotEqual(t, anonymize.Token(v), anonymize.Token(v))
+
+	db := openDB(t)
+	_, err := db.Exec(`INSERT INTO users (id, email, password_digest) VALUES ('1', 'ada@example.org', 'x')`)
+	require.NoError(t, err)
+	runner := anonymize.NewRunner(db, "sqlite")
+	runner.Rules = []anonymize.Rule{{Table: "users", Column: "email", Anonymizer: anonymize.Email}}
+	_, err = runner.Run(context.Background())
+	require.NoError(t, err)
+	var email string
+	require.NoError(t, db.QueryRow(`SELECT email FROM users`).Scan(&email))
+	assert.NotEqual(t, anonymize.Email(v), email, "each run picks a random key")
+}
+
+func TestRegister(t *testing.T) {
+	require.NoError(t, anonymize.Register("customers", "phone", anonymize.Null))
+	require.NoError(t, anonymize.Register("customers", "phone", anonymize.Fixed("555-0100")))
+	var found []anonymize.Rule
+	for _, r := range anonymize.Rules() {
+		if r.Table == "customers" {
+			found = append(found, r)
+		}
+	}
+	require.Len(t, found, 1, "registering a column again replaces its anonymizer")
+	assert.Equal(t, "555-0100", found[0].Anonymizer(anonymize.Value{Text: "+1 202 555 0199"}))
+
+	assert.Error(t, anonymize.Register("customers; DROP TABLE users", "phone", anonymize.Null))
+	assert.Error(t, anonymize.Register("customers", "a.b", anonymize.Null))
+	assert.Error(t, anonymize.Register("customers", "phone", nil))
+
+	runner := anonymize.NewRunner(openDB(t), "sqlite")
+	runner.Rules = []anonymize.Rule{{Table: "users", Column: "email = email; --", Anonymizer: anonymize.Null}}
+	_, err := runner.Run(context.Background())
+	assert.Error(t, err)
+}
@@ -2,10 +2,20 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+	"github.com/johnjansen/buffkit/views"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -13,9 +23,25 @@ import (
 type User struct {
 	ID             string `json:"id" db:"id"`
 	Email          string `json:"email" db:"email"`
+	Username       string `json:"username,omitempty" db:"username"`
 	DisplayName    string `json:"name" db:"name"`
 	PasswordDigest string `json:"-" db:"password_digest"`
 	IsActive       bool   `json:"is_active" db:"is_active"`
+
+	AvatarURL       string     `json:"avatar_url,omitempty" db:"avatar_url"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+
+	// PendingEmail is the address the user asked to change to, until
+	// they confirm it from that inbox.
+	PendingEmail string `json:"pending_email,omitempty" db:"pending_email"`
+
+	// DeactivatedAt is set when the user was deactivated, e.g. by an
+	// identity provider through SCIM. Deactivated users can't log in.
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty" db:"deactivated_at"`
+
+	// Role is the user's role, such as RoleAdmin, when the store keeps
+	// them (RoleStore).
+	Role string `json:"role,omitempty" db:"role"`
 }
 
 // Name returns the user's name as a method for compatibility
@@ -27,7 +53,10 @@ func (u *User) Name() string {
 	return u.Email
 }
 
-// UserStore defines the minimal interface for user storage
+// UserStore defines the minimal interface for user storage. Lookups of
+// unknown users return an error matching ErrNotFound, and writes that
+// clash with another user one matching ErrConflict; all methods stop
+// with the context's error once it's done.
 type UserStore interface {
 	Create(ctx context.Context, user *User) error
 	ByEmail(ctx context.Context, email string) (*User, error)
@@ -36,14 +65,54 @@ type UserStore interface {
 	ExistsEmail(ctx context.Context, email string) (bool, error)
 }
 
+// ProfileStore is a UserStore that also lets users edit their own
+// account, as the account pages need.
+type ProfileStore interface {
+	UserStore
+	UpdateDisplayName(ctx context.Context, id, name string) error
+	// UpdateEmail changes the user's email and clears EmailVerifiedAt.
+	// It returns ErrUserExists if another user has the address.
+	UpdateEmail(ctx context.Context, id, email string) error
+	MarkEmailVerified(ctx context.Context, id string, at time.Time) error
+	UpdateAvatarURL(ctx context.Context, id, url string) error
+	// SetPendingEmail records an email change awaiting confirmation;
+	// an empty email cancels it.
+	SetPendingEmail(ctx context.Context, id, email string) error
+}
+
+// ProvisioningStore is a ProfileStore that an identity provider can
+// manage, as the SCIM endpoint needs.
+type ProvisioningStore interface {
+	ProfileStore
+	// ListUsers returns up to limit users, ordered by ID, after skipping
+	// offset, along with the total number of users.
+	ListUsers(ctx context.Context, offset, limit int) ([]*User, int, error)
+	// SetDeactivated deactivates the user at the given time; nil
+	// reactivates them.
+	SetDeactivated(ctx context.Context, id string, at *time.Time) error
+}
+
 var (
 	// Global store instance
 	globalStore UserStore
 
+	// Where unauthenticated users are sent; Wire changes it when Buffkit
+	// is mounted under a prefix
+	loginPath = "/login"
+
+	// Where the login form links users who forgot their password, when
+	// password resets are mounted
+	forgotPasswordPath string
+
+	// Where users go after logging in when there's no safe return_to,
+	// and the hosts an absolute return_to may point at
+	afterLoginPath = "/"
+	returnToHosts  []string
+
 	// Errors
-	ErrUserNotFound       = errors.New("user not found")
+	ErrUserNotFound       = NotFoundError("user not found")
 	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrUserExists         = errors.New("user already exists")
+	ErrUserExists         = ConflictError("user already exists")
 )
 
 // UseStore sets the global user store
@@ -56,49 +125,321 @@ func GetStore() UserStore {
 	return globalStore
 }
 
-// LoginFormHandler serves the login form - ONLY what the feature asks for
+// UseLoginPath sets the path of the login form that RequireLogin and
+// LogoutHandler redirect to. Wire calls it with Config.MountPath applied.
+func UseLoginPath(p string) {
+	loginPath = p
+}
+
+// LoginPath returns the path of the login form, "/login" by default.
+func LoginPath() string {
+	return loginPath
+}
+
+// UseForgotPasswordPath sets the path the login form links to for users
+// who forgot their password. Wire calls it when Config.PasswordReset is
+// set; empty removes the link.
+func UseForgotPasswordPath(p string) {
+	forgotPasswordPath = p
+}
+
+// UseAfterLogin sets where LoginHandler sends users with no return_to
+// (path, "/" by default) and the hosts an absolute return_to URL may
+// point at. Wire calls it with Config.DefaultAfterLoginPath and
+// Config.ReturnToHosts.
+func UseAfterLogin(path string, hosts []string) {
+	if path == "" {
+		path = "/"
+	}
+	afterLoginPath = path
+	returnToHosts = hosts
+}
+
+// returnToKey is the session key RequireLogin stores the requested URL in.
+const returnToKey = "return_to"
+
+// SafeReturnTo reports whether target is safe to redirect to after
+// login: a path on this site ("/account", not "//evil.test"), or an
+// http(s) URL whose host is allowed by UseAfterLogin. Anything else could
+// turn the login form into an open redirect.
+func SafeReturnTo(target string) bool {
+	if target == "" || strings.ContainsAny(target, "\\\r\n") {
+		return false
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	for _, host := range returnToHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// AfterLogin returns where to send a user who just logged in: the URL
+// RequireLogin saved, else the return_to the client sent, else the
+// default, whichever is first safe. It clears the saved URL.
+func AfterLogin(c buffalo.Context, requested string) string {
+	saved, _ := c.Session().Get(returnToKey).(string)
+	c.Session().Delete(returnToKey)
+	for _, target := range []string{saved, requested} {
+		if SafeReturnTo(target) {
+			return target
+		}
+	}
+	return afterLoginPath
+}
+
+// LoginFormHandler serves the login form, rendered as views.PageLogin
 func LoginFormHandler(c buffalo.Context) error {
-	// Simple HTML form - no fancy features
-	html := `<html><body><h1>Login</h1><form method="POST" action="/login">
-		<input type="email" name="email" placeholder="Email" required>
-		<input type="password" name="password" placeholder="Password" required>
-		<button type="submit">Login</button>
-		</form></body></html>`
+	return views.Render(c, http.StatusOK, views.PageLogin, loginData("", nil, c.Param("return_to")))
+}
+
+// loginData is the data for views.PageLogin and views.PageLoginForm.
+// login is what was typed as the email or username. An unsafe returnTo
+// is dropped rather than echoed back into the form.
+func loginData(login string, errs []string, returnTo string) map[string]any {
+	if !SafeReturnTo(returnTo) {
+		returnTo = ""
+	}
+	return map[string]any{
+		"login_path":           loginPath,
+		"email":                login,
+		"identifier":           string(loginIdentifier),
+		"errors":               errs,
+		"return_to":            returnTo,
+		"forgot_password_path": forgotPasswordPath,
+	}
+}
 
-	c.Response().WriteHeader(http.StatusOK)
-	_, err := c.Response().Write([]byte(html))
-	return err
+// credentials is the body of a login request, as a form or JSON. Login
+// is the email or username, depending on the login identifier; Email is
+// accepted in its place.
+type credentials struct {
+	Login    string `json:"login"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	ReturnTo string `json:"return_to"`
 }
 
-// LoginHandler processes login - ONLY what the feature asks for
+// LoginHandler checks the email and password against the global store
+// and starts a session. On success the user goes back to the page
+// RequireLogin turned them away from, or to a return_to sent with the
+// login, if it passes SafeReturnTo; otherwise to the after-login path.
+// The response depends on the request:
+//
+//   - JSON (a JSON body or Accept: application/json) gets
+//     {"ok": true, "user": ..., "redirect": "/"} or 401 with
+//     {"ok": false, "errors": [...]}.
+//   - htmx (HX-Request: true) gets an HX-Redirect header on success, or
+//     views.PageLoginForm with the errors to swap in place of the form.
+//   - A plain form post is redirected on success, or gets views.PageLogin
+//     again with 422 and the errors.
 func LoginHandler(c buffalo.Context) error {
-	// Feature doesn't specify actual login logic, just that route exists
-	// Minimal implementation: acknowledge the POST request
-	c.Response().WriteHeader(http.StatusOK)
-	_, err := c.Response().Write([]byte("Login POST received"))
-	return err
+	var creds credentials
+	if isJSONBody(c.Request()) {
+		if err := json.NewDecoder(c.Request().Body).Decode(&creds); err != nil {
+			return c.Render(http.StatusBadRequest, render.JSON(map[string]any{
+				"ok":     false,
+				"errors": []string{"invalid JSON body"},
+			}))
+		}
+	} else {
+		creds.Login = c.Request().FormValue("login")
+		creds.Email = c.Request().FormValue("email")
+		creds.Password = c.Request().FormValue("password")
+		creds.ReturnTo = c.Request().FormValue("return_to")
+	}
+	if creds.Login == "" {
+		creds.Login = creds.Email
+	}
+	creds.Login = strings.TrimSpace(creds.Login)
+
+	user, err := authenticate(c, creds)
+	if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+		return err
+	}
+	if err != nil {
+		recordLoginAttempt(c, creds.Login, nil, false)
+		errs := []string{ErrInvalidCredentials.Error()}
+		switch {
+		case wantsJSON(c.Request()):
+			return c.Render(http.StatusUnauthorized, render.JSON(map[string]any{"ok": false, "errors": errs}))
+		case isHTMX(c.Request()):
+			// htmx doesn't swap 4xx responses by default, so the form
+			// with its errors goes back as a 200
+			return views.Render(c, http.StatusOK, views.PageLoginForm, loginData(creds.Login, errs, creds.ReturnTo))
+		default:
+			return views.Render(c, http.StatusUnprocessableEntity, views.PageLogin, loginData(creds.Login, errs, creds.ReturnTo))
+		}
+	}
+
+	return CompleteLogin(c, user, creds.ReturnTo)
 }
 
-// LogoutHandler processes logout - ONLY what the feature asks for
+// CompleteLogin starts a session for user and responds as a successful
+// login does, sending them to AfterLogin(c, requested). The login is
+// logged with where it came from, and recorded as a Session when the
+// store keeps them. Sign-in methods
+// other than the password form, such as SAML, finish with it once
+// they've identified the user.
+func CompleteLogin(c buffalo.Context, user *User, requested string) error {
+	SetUserSession(c, user.Email)
+	setSessionClaims(c, user)
+	stampLogin(c)
+	s, newDevice, err := startSession(c, user)
+	if err != nil {
+		return err
+	}
+	recordLoginAttempt(c, "", user, newDevice)
+	if newDevice && newDeviceLogin != nil {
+		newDeviceLogin(c, user, s)
+	}
+	target := AfterLogin(c, requested)
+	return redirectAfterAuth(c, target, map[string]any{"ok": true, "user": user, "redirect": target})
+}
+
+// authenticate returns the user with creds, or ErrInvalidCredentials
+// whether the email or username is unknown, the password is wrong, or
+// the user is deactivated. Other store errors are returned as they are.
+// The UseAuthenticator function, when set, decides first.
+func authenticate(ctx context.Context, creds credentials) (*User, error) {
+	defer timing.Start(ctx, timing.Auth)()
+
+	if globalStore == nil || creds.Login == "" || creds.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	if authenticator != nil {
+		user, err := authenticator(ctx, creds.Login, creds.Password)
+		if err == nil && user.DeactivatedAt != nil {
+			return nil, ErrInvalidCredentials
+		}
+		if !errors.Is(err, ErrUseLocalPassword) {
+			return user, err
+		}
+	}
+	user, err := lookupLogin(ctx, creds.Login)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if CheckPassword(creds.Password, user.PasswordDigest) != nil || user.DeactivatedAt != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// LogoutHandler ends the session. JSON requests get {"ok": true}, htmx
+// requests an HX-Redirect to the login form, and forms a redirect there.
 func LogoutHandler(c buffalo.Context) error {
-	// Feature doesn't specify actual logout logic, just that route exists
-	// Minimal implementation: acknowledge the POST request
+	endSession(c)
 	ClearUserSession(c)
-	return c.Redirect(http.StatusSeeOther, "/login")
+	return redirectAfterAuth(c, loginPath, map[string]any{"ok": true})
+}
+
+// redirectAfterAuth sends the client to path in the way it understands:
+// the JSON body for JSON clients, HX-Redirect for htmx, or a 303.
+func redirectAfterAuth(c buffalo.Context, path string, body map[string]any) error {
+	switch {
+	case wantsJSON(c.Request()):
+		return c.Render(http.StatusOK, render.JSON(body))
+	case isHTMX(c.Request()):
+		c.Response().Header().Set("HX-Redirect", path)
+		return c.Render(http.StatusOK, render.String(""))
+	default:
+		return c.Redirect(http.StatusSeeOther, path)
+	}
+}
+
+func isJSONBody(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
 }
 
-// RequireLogin middleware - feature asks for this specifically
+func wantsJSON(r *http.Request) bool {
+	return isJSONBody(r) || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// ContextKey is the key RequireLogin stores the signed-in *User under in
+// the Buffalo context.
+const ContextKey = "current_user"
+
+// RequireLogin redirects visitors without a session, or whose Session
+// was ended, to the login form.
+// For GET requests it saves the requested URL in the session first, so
+// LoginHandler can send them back there afterwards. Logins that outlived
+// the SessionTimeouts are ended and sent there too, with
+// SessionExpiredMessage. Deactivated users are logged out on their next
+// request. Signed-in requests get the user set under ContextKey.
 func RequireLogin(next buffalo.Handler) buffalo.Handler {
 	return func(c buffalo.Context) error {
 		// Check if user is in session
 		if GetUserSession(c) == "" {
-			// Feature says "should be redirected to login"
-			return c.Redirect(http.StatusSeeOther, "/login")
+			return redirectToLogin(c)
+		}
+		if sessionExpired(c) {
+			endSession(c)
+			ClearUserSession(c)
+			c.Flash().Add("warning", SessionExpiredMessage)
+			return redirectToLogin(c)
+		}
+		// A session ended from another device logs this one out
+		live, err := checkSession(c)
+		if err != nil {
+			return err
+		}
+		if !live {
+			c.Session().Delete(sessionIDKey)
+			ClearUserSession(c)
+			return c.Redirect(http.StatusSeeOther, loginPath)
+		}
+		user := CurrentUser(c)
+		if user.DeactivatedAt != nil {
+			endSession(c)
+			ClearUserSession(c)
+			return c.Redirect(http.StatusSeeOther, loginPath)
 		}
+		c.Set(ContextKey, user)
 		return next(c)
 	}
 }
 
+// redirectToLogin sends the visitor to the login form, remembering the
+// page they asked for on GET requests.
+func redirectToLogin(c buffalo.Context) error {
+	if c.Request().Method == http.MethodGet && !isHTMX(c.Request()) {
+		c.Session().Set(returnToKey, requestedURL(c.Request()))
+	}
+	return c.Redirect(http.StatusSeeOther, loginPath)
+}
+
+// requestedURL is the URL to return to after login. It's a path, unless
+// the login form is on another host (Config.AuthHosts), where a path
+// would resolve against the wrong host.
+func requestedURL(r *http.Request) string {
+	if !strings.HasPrefix(loginPath, "//") {
+		return r.URL.RequestURI()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
 // Session helpers - minimal implementation for what tests need
 func SetUserSession(c buffalo.Context, userID string) {
 	c.Session().Set("user_id", userID)
@@ -115,28 +456,12 @@ func GetUserSession(c buffalo.Context) string {
 
 func ClearUserSession(c buffalo.Context) {
 	c.Session().Delete("user_id")
+	c.Session().Delete(claimsKey)
+	c.Session().Delete(loginAtKey)
+	c.Session().Delete(seenAtKey)
 	_ = c.Session().Save()
 }
 
-// CurrentUser gets the current user from context - feature asks for this
-func CurrentUser(c buffalo.Context) *User {
-	userID := GetUserSession(c)
-	if userID == "" {
-		return nil
-	}
-
-	// If we have a store, try to get the user
-	if globalStore != nil {
-		user, err := globalStore.ByEmail(context.Background(), userID)
-		if err == nil {
-			return user
-		}
-	}
-
-	// Return a minimal user with just the ID
-	return &User{ID: userID}
-}
-
 // Password helpers - needed for "logged in as valid user" step
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -150,6 +475,20 @@ func CheckPassword(password, hash string) error {
 // Simple in-memory store for testing - ONLY what's needed
 type MemoryStore struct {
 	users map[string]*User
+
+	// usedInvitations maps registration invitation IDs to the user who
+	// registered with them. Concurrent registrations race for an
+	// invitation, so invitationsMu guards it.
+	usedInvitations map[string]string
+	invitationsMu   sync.Mutex
+
+	// resetTokens holds each user's password reset token by user ID
+	resetTokens map[string]resetToken
+
+	// sessions holds each login's Session by ID. RequireLogin reads and
+	// writes it from concurrent requests, so sessionsMu guards it.
+	sessions   map[string]*Session
+	sessionsMu sync.Mutex
 }
 
 // NewSQLStore is a stub to satisfy compilation - NOT IMPLEMENTED per BDD
@@ -167,14 +506,26 @@ func RegisterAuthJobs(mux interface{}, store interface{}) {
 
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		users: make(map[string]*User),
+		users:           make(map[string]*User),
+		usedInvitations: make(map[string]string),
 	}
 }
 
 func (m *MemoryStore) Create(ctx context.Context, user *User) error {
+	if err := readonly.Check("auth.Create"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if _, exists := m.users[user.Email]; exists {
 		return ErrUserExists
 	}
+	if user.Username != "" {
+		if _, err := m.ByUsername(ctx, user.Username); err == nil {
+			return ErrUsernameTaken
+		}
+	}
 	if user.ID == "" {
 		user.ID = user.Email // Simple ID generation
 	}
@@ -183,6 +534,9 @@ func (m *MemoryStore) Create(ctx context.Context, user *User) error {
 }
 
 func (m *MemoryStore) ByEmail(ctx context.Context, email string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if user, ok := m.users[email]; ok {
 		return user, nil
 	}
@@ -190,6 +544,12 @@ func (m *MemoryStore) ByEmail(ctx context.Context, email string) (*User, error)
 }
 
 func (m *MemoryStore) UpdatePassword(ctx context.Context, id string, passwordDigest string) error {
+	if err := readonly.Check("auth.UpdatePassword"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	for _, user := range m.users {
 		if user.ID == id {
 			user.PasswordDigest = passwordDigest
@@ -200,11 +560,17 @@ func (m *MemoryStore) UpdatePassword(ctx context.Context, id string, passwordDig
 }
 
 func (m *MemoryStore) ExistsEmail(ctx context.Context, email string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	_, exists := m.users[email]
 	return exists, nil
 }
 
 func (m *MemoryStore) ByID(ctx context.Context, id string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	for _, user := range m.users {
 		if user.ID == id {
 			return user, nil
@@ -212,3 +578,124 @@ func (m *MemoryStore) ByID(ctx context.Context, id string) (*User, error) {
 	}
 	return nil, ErrUserNotFound
 }
+
+func (m *MemoryStore) UpdateDisplayName(ctx context.Context, id, name string) error {
+	if err := readonly.Check("auth.UpdateDisplayName"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user, err := m.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.DisplayName = name
+	return nil
+}
+
+func (m *MemoryStore) UpdateEmail(ctx context.Context, id, email string) error {
+	if err := readonly.Check("auth.UpdateEmail"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user, err := m.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if other, ok := m.users[email]; ok && other != user {
+		return ErrUserExists
+	}
+	// Users are keyed by email, so move the record
+	delete(m.users, user.Email)
+	user.Email = email
+	user.EmailVerifiedAt = nil
+	if user.PendingEmail == email {
+		user.PendingEmail = ""
+	}
+	m.users[email] = user
+	return nil
+}
+
+func (m *MemoryStore) MarkEmailVerified(ctx context.Context, id string, at time.Time) error {
+	if err := readonly.Check("auth.MarkEmailVerified"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user, err := m.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.EmailVerifiedAt = &at
+	return nil
+}
+
+func (m *MemoryStore) UpdateAvatarURL(ctx context.Context, id, url string) error {
+	if err := readonly.Check("auth.UpdateAvatarURL"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user, err := m.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.AvatarURL = url
+	return nil
+}
+
+func (m *MemoryStore) SetPendingEmail(ctx context.Context, id, email string) error {
+	if err := readonly.Check("auth.SetPendingEmail"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user, err := m.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.PendingEmail = email
+	return nil
+}
+
+func (m *MemoryStore) ListUsers(ctx context.Context, offset, limit int) ([]*User, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	users := make([]*User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	total := len(users)
+	if offset > total {
+		offset = total
+	}
+	users = users[offset:]
+	if limit >= 0 && limit < len(users) {
+		users = users[:limit]
+	}
+	return users, total, nil
+}
+
+func (m *MemoryStore) SetDeactivated(ctx context.Context, id string, at *time.Time) error {
+	if err := readonly.Check("auth.SetDeactivated"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user, err := m.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.DeactivatedAt = at
+	return nil
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loginApp(t *testing.T) *buffalo.App {
+	t.Helper()
+	store := NewMemoryStore()
+	digest, err := HashPassword("secret123")
+	require.NoError(t, err)
+	require.NoError(t, store.Create(context.Background(), &User{Email: "ada@example.com", PasswordDigest: digest}))
+
+	previous := globalStore
+	UseStore(store)
+	t.Cleanup(func() { UseStore(previous) })
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.POST("/login", LoginHandler)
+	app.POST("/logout", LogoutHandler)
+	return app
+}
+
+func postLogin(app *buffalo.App, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoginForm(t *testing.T) {
+	app := loginApp(t)
+
+	ok := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}.Encode(), nil)
+	assert.Equal(t, http.StatusSeeOther, ok.Code)
+	assert.Equal(t, "/", ok.Header().Get("Location"))
+	assert.NotEmpty(t, ok.Result().Cookies(), "a session cookie should be set")
+
+	bad := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"wrong"}}.Encode(), nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, bad.Code)
+	assert.Contains(t, bad.Body.String(), "<h1>Login</h1>")
+	assert.Contains(t, bad.Body.String(), ErrInvalidCredentials.Error())
+	assert.Contains(t, bad.Body.String(), `value="ada@example.com"`)
+}
+
+func TestLoginJSON(t *testing.T) {
+	app := loginApp(t)
+	headers := map[string]string{"Content-Type": "application/json"}
+
+	ok := postLogin(app, `{"email":"ada@example.com","password":"secret123"}`, headers)
+	require.Equal(t, http.StatusOK, ok.Code, ok.Body.String())
+	var body struct {
+		OK   bool `json:"ok"`
+		User struct {
+			Email string `json:"email"`
+		} `json:"user"`
+	}
+	require.NoError(t, json.Unmarshal(ok.Body.Bytes(), &body))
+	assert.True(t, body.OK)
+	assert.Equal(t, "ada@example.com", body.User.Email)
+	assert.NotContains(t, ok.Body.String(), "password")
+
+	bad := postLogin(app, `{"email":"ada@example.com","password":"nope"}`, headers)
+	assert.Equal(t, http.StatusUnauthorized, bad.Code)
+	assert.JSONEq(t, `{"ok":false,"errors":["invalid email or password"]}`, bad.Body.String())
+
+	malformed := postLogin(app, `{`, headers)
+	assert.Equal(t, http.StatusBadRequest, malformed.Code)
+}
+
+func TestLoginHTMX(t *testing.T) {
+	app := loginApp(t)
+	headers := map[string]string{"HX-Request": "true"}
+
+	ok := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}.Encode(), headers)
+	assert.Equal(t, http.StatusOK, ok.Code)
+	assert.Equal(t, "/", ok.Header().Get("HX-Redirect"))
+
+	bad := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"wrong"}}.Encode(), headers)
+	assert.Equal(t, http.StatusOK, bad.Code)
+	assert.Contains(t, bad.Body.String(), `id="login-form"`)
+	assert.NotContains(t, bad.Body.String(), "<h1>Login</h1>", "htmx gets the form alone")
+	assert.Contains(t, bad.Body.String(), ErrInvalidCredentials.Error())
+}
+
+func TestLogoutNegotiation(t *testing.T) {
+	app := loginApp(t)
+
+	for name, tc := range map[string]struct {
+		headers map[string]string
+		code    int
+		check   func(*httptest.ResponseRecorder)
+	}{
+		"form": {nil, http.StatusSeeOther, func(rec *httptest.ResponseRecorder) {
+			assert.Equal(t, "/login", rec.Header().Get("Location"))
+		}},
+		"json": {map[string]string{"Accept": "application/json"}, http.StatusOK, func(rec *httptest.ResponseRecorder) {
+			assert.JSONEq(t, `{"ok":true}`, rec.Body.String())
+		}},
+		"htmx": {map[string]string{"HX-Request": "true"}, http.StatusOK, func(rec *httptest.ResponseRecorder) {
+			assert.Equal(t, "/login", rec.Header().Get("HX-Redirect"))
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/logout", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			assert.Equal(t, tc.code, rec.Code)
+			tc.check(rec)
+		})
+	}
+}
+
+func TestSafeReturnTo(t *testing.T) {
+	UseAfterLogin("", []string{"app.example.com"})
+	t.Cleanup(func() { UseAfterLogin("", nil) })
+
+	for target, safe := range map[string]bool{
+		"/account?tab=billing":           true,
+		"https://app.example.com/inbox":  true,
+		"http://APP.example.com:8080/x":  true,
+		"":                               false,
+		"account":                        false,
+		"//evil.test/phish":              false,
+		"/\\evil.test":                   false,
+		"https://evil.test/":             false,
+		"https://app.example.com.evil/":  false,
+		"javascript:alert(1)":            false,
+		"/ok\r\nSet-Cookie: session=bad": false,
+	} {
+		assert.Equal(t, safe, SafeReturnTo(target), target)
+	}
+}
+
+func TestLoginReturnsToRequestedPage(t *testing.T) {
+	app := loginApp(t)
+	app.GET("/account", RequireLogin(func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, nil)
+	}))
+	UseAfterLogin("/dashboard", nil)
+	t.Cleanup(func() { UseAfterLogin("", nil) })
+
+	creds := url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}
+
+	t.Run("back to the page RequireLogin turned away", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "/account?tab=billing", nil))
+		require.Equal(t, http.StatusSeeOther, rec.Code)
+
+		login := httptest.NewRequest("POST", "/login", strings.NewReader(creds.Encode()))
+		login.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range rec.Result().Cookies() {
+			login.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, login)
+		// Buffalo adds the trailing slash to the path it routed
+		assert.Equal(t, "/account/?tab=billing", res.Header().Get("Location"))
+	})
+
+	t.Run("return_to from the form", func(t *testing.T) {
+		withReturn := url.Values{"return_to": {"/settings"}}
+		for k, v := range creds {
+			withReturn[k] = v
+		}
+		rec := postLogin(app, withReturn.Encode(), nil)
+		assert.Equal(t, "/settings", rec.Header().Get("Location"))
+	})
+
+	t.Run("unsafe return_to falls back to the default", func(t *testing.T) {
+		rec := postLogin(app, `{"email":"ada@example.com","password":"secret123","return_to":"https://evil.test/"}`,
+			map[string]string{"Content-Type": "application/json"})
+		assert.Contains(t, rec.Body.String(), `"redirect":"/dashboard"`)
+	})
+}
+
+func TestValidateUsername(t *testing.T) {
+	for _, name := range []string{"ada", "ada.lovelace", "ada_99", "a-b", strings.Repeat("a", MaxUsernameLength)} {
+		assert.NoError(t, ValidateUsername(name), name)
+	}
+	for _, name := range []string{"", "ab", "Ada", "ada@example.com", "_ada", ".ada", "ada lovelace", strings.Repeat("a", MaxUsernameLength+1)} {
+		assert.ErrorIs(t, ValidateUsername(name), ErrInvalidUsername, name)
+	}
+}
+
+func TestLoginWithUsername(t *testing.T) {
+	app := loginApp(t)
+	store := globalStore.(*MemoryStore)
+	ctx := context.Background()
+	user, err := store.ByEmail(ctx, "ada@example.com")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateUsername(ctx, user.ID, "ada"))
+	t.Cleanup(func() { UseLoginIdentifier("") })
+
+	login := func(form url.Values) int {
+		form.Set("password", "secret123")
+		return postLogin(app, form.Encode(), nil).Code
+	}
+
+	UseLoginIdentifier(LoginWithEmail)
+	assert.Equal(t, http.StatusSeeOther, login(url.Values{"email": {"ada@example.com"}}))
+	assert.Equal(t, http.StatusUnprocessableEntity, login(url.Values{"login": {"ada"}}))
+
+	UseLoginIdentifier(LoginWithUsername)
+	assert.Equal(t, http.StatusSeeOther, login(url.Values{"login": {" Ada "}}))
+	assert.Equal(t, http.StatusUnprocessableEntity, login(url.Values{"login": {"ada@example.com"}}))
+
+	UseLoginIdentifier(LoginWithEmailOrUsername)
+	assert.Equal(t, http.StatusSeeOther, login(url.Values{"login": {"ada"}}))
+	assert.Equal(t, http.StatusSeeOther, login(url.Values{"login": {"ada@example.com"}}))
+
+	rec := postLogin(app, url.Values{"login": {"ada"}, "password": {"wrong"}}.Encode(), nil)
+	assert.Contains(t, rec.Body.String(), `name="login" placeholder="Email or username" value="ada"`)
+
+	t.Run("usernames are unique", func(t *testing.T) {
+		err := store.Create(ctx, &User{Email: "other@example.com", Username: "ada"})
+		assert.ErrorIs(t, err, ErrUsernameTaken)
+
+		other := &User{Email: "other@example.com"}
+		require.NoError(t, store.Create(ctx, other))
+		assert.ErrorIs(t, store.UpdateUsername(ctx, other.ID, "ada"), ErrUsernameTaken)
+	})
+}
+
+// brokenStore is a store whose database has gone away.
+type brokenStore struct{ *MemoryStore }
+
+func (brokenStore) ByEmail(ctx context.Context, email string) (*User, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestStoreErrors(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	require.NoError(t, store.Create(ctx, &User{Email: "ada@example.com", Username: "ada"}))
+
+	_, err := store.ByEmail(ctx, "bob@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.EqualError(t, err, "user not found")
+	assert.ErrorIs(t, store.Create(ctx, &User{Email: "ada@example.com"}), ErrConflict)
+	assert.ErrorIs(t, store.Create(ctx, &User{Email: "ada2@example.com", Username: "ada"}), ErrConflict)
+	require.NoError(t, store.CreateInvited(ctx, &User{Email: "grace@example.com"}, "inv", time.Now()))
+	assert.ErrorIs(t, store.CreateInvited(ctx, &User{Email: "alan@example.com"}, "inv", time.Now()), ErrConflict)
+	_, err = store.ByEmail(ctx, "alan@example.com")
+	assert.ErrorIs(t, err, ErrNotFound, "a used invitation creates nobody")
+	assert.NotErrorIs(t, ErrUserNotFound, ErrConflict)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = store.ByEmail(canceled, "ada@example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, store.UpdateDisplayName(canceled, "ada@example.com", "Ada"), context.Canceled)
+
+	// A store failure isn't a wrong password
+	app := loginApp(t)
+	UseStore(brokenStore{store})
+	res := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}.Encode(), nil)
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUseLocalPassword is returned by a UseAuthenticator function that
+// leaves the login to the store's password check.
+var ErrUseLocalPassword = errors.New("auth: check the local password")
+
+// What UseAuthenticator sets
+var authenticator func(ctx context.Context, login, password string) (*User, error)
+
+// UseAuthenticator sets a function that checks logins somewhere other
+// than the store, such as a directory (auth/ldap). LoginHandler calls it
+// with the email or username and password as typed. It returns the
+// user, who must be in the store, or ErrInvalidCredentials to refuse the
+// login, or ErrUseLocalPassword to check the store's password as if it
+// weren't set. Other errors fail the request. It replaces any earlier
+// one; nil removes it.
+func UseAuthenticator(fn func(ctx context.Context, login, password string) (*User, error)) {
+	authenticator = fn
+}
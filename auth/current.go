@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+const (
+	// currentKey is where CurrentUser keeps the user it loaded for the
+	// rest of the request.
+	currentKey = "buffkit_current_user"
+
+	// claimsOnlyKey marks a request ClaimsOnly covers.
+	claimsOnlyKey = "buffkit_claims_only"
+
+	// claimsKey is the session value holding the user's claims.
+	claimsKey = "user_claims"
+)
+
+// current is a user CurrentUser loaded, and the session's user_id it was
+// loaded for, so logging in or out mid-request isn't answered from it.
+type current struct {
+	login string
+	user  *User
+}
+
+// What UsePreload sets
+var preload func(c buffalo.Context, user *User) error
+
+// UsePreload sets a function that loads what pages need along with the
+// current user, such as their roles or permissions, and stores it with
+// c.Set. It runs once per request, when CurrentUser loads the user from
+// the store, and not in ClaimsOnly requests. Errors are logged and the
+// user is returned anyway. It replaces any earlier one; nil removes it.
+//
+//	auth.UsePreload(func(c buffalo.Context, user *auth.User) error {
+//	    roles, err := roleStore.ForUser(c, user.ID)
+//	    c.Set("roles", roles)
+//	    return err
+//	})
+func UsePreload(fn func(c buffalo.Context, user *User) error) {
+	preload = fn
+}
+
+// CurrentUser returns the logged-in user, or nil. The user is loaded
+// from the store once per request and kept for the rest of it, so
+// helpers, components and middleware can all call CurrentUser. Without
+// a store, or if the lookup fails, it returns a User with only ID set.
+func CurrentUser(c buffalo.Context) *User {
+	login := GetUserSession(c)
+	if login == "" {
+		return nil
+	}
+	if cur, ok := c.Value(currentKey).(*current); ok && cur.login == login {
+		return cur.user
+	}
+
+	user := loadCurrentUser(c, login)
+	c.Set(currentKey, &current{login: login, user: user})
+	return user
+}
+
+func loadCurrentUser(c buffalo.Context, login string) *User {
+	if claimsOnly, _ := c.Value(claimsOnlyKey).(bool); claimsOnly {
+		if user := sessionClaims(c, login); user != nil {
+			return user
+		}
+	}
+
+	defer timing.Start(c, timing.Auth)()
+	if globalStore == nil {
+		return &User{ID: login}
+	}
+	user, err := globalStore.ByEmail(c, login)
+	if err != nil {
+		return &User{ID: login}
+	}
+	setSessionClaims(c, user)
+	if preload != nil {
+		if err := preload(c, user); err != nil {
+			c.Logger().WithField("user", user.ID).Errorf("auth: preload: %v", err)
+		}
+	}
+	return user
+}
+
+// ClaimsOnly is middleware for busy pages that only show who's logged
+// in. CurrentUser builds the user from the claims saved in the session
+// at its last full load, without a store lookup:
+//
+//	app.GET("/", auth.ClaimsOnly(HomeHandler))
+//
+// The claims are the user's ID, email, username, name, avatar and
+// verification, as they were when last loaded; other fields are zero.
+// Sessions without claims, or whose claims are for another user, load
+// the user as usual. Routes behind RequireLogin still check the session
+// is live.
+func ClaimsOnly(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		c.Set(claimsOnlyKey, true)
+		return next(c)
+	}
+}
+
+// claims is what the session keeps of a user for ClaimsOnly.
+type claims struct {
+	ID              string     `json:"id"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username,omitempty"`
+	DisplayName     string     `json:"name,omitempty"`
+	AvatarURL       string     `json:"avatar_url,omitempty"`
+	IsActive        bool       `json:"is_active,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+}
+
+// setSessionClaims saves user's claims in the session, if they've
+// changed.
+func setSessionClaims(c buffalo.Context, user *User) {
+	data, err := json.Marshal(claims{
+		ID: user.ID, Email: user.Email, Username: user.Username, DisplayName: user.DisplayName,
+		AvatarURL: user.AvatarURL, IsActive: user.IsActive, EmailVerifiedAt: user.EmailVerifiedAt,
+	})
+	if err != nil {
+		return
+	}
+	if saved, _ := c.Session().Get(claimsKey).(string); saved != string(data) {
+		c.Session().Set(claimsKey, string(data))
+	}
+}
+
+// sessionClaims returns the user the session's claims describe, or nil
+// if they're missing or for someone other than login.
+func sessionClaims(c buffalo.Context, login string) *User {
+	saved, _ := c.Session().Get(claimsKey).(string)
+	var cl claims
+	if saved == "" || json.Unmarshal([]byte(saved), &cl) != nil || cl.Email != login {
+		return nil
+	}
+	return &User{
+		ID: cl.ID, Email: cl.Email, Username: cl.Username, DisplayName: cl.DisplayName,
+		AvatarURL: cl.AvatarURL, IsActive: cl.IsActive, EmailVerifiedAt: cl.EmailVerifiedAt,
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts user lookups.
+type countingStore struct {
+	*MemoryStore
+	lookups int
+}
+
+func (s *countingStore) ByEmail(ctx context.Context, email string) (*User, error) {
+	s.lookups++
+	return s.MemoryStore.ByEmail(ctx, email)
+}
+
+func TestCurrentUser(t *testing.T) {
+	app := loginApp(t)
+	store := &countingStore{MemoryStore: globalStore.(*MemoryStore)}
+	UseStore(store)
+
+	preloads := 0
+	UsePreload(func(c buffalo.Context, user *User) error {
+		preloads++
+		c.Set("roles", []string{"editor"})
+		return errors.New("permissions unavailable")
+	})
+	t.Cleanup(func() { UsePreload(nil) })
+
+	var seen []*User
+	page := func(c buffalo.Context) error {
+		for range 3 {
+			seen = append(seen, CurrentUser(c))
+		}
+		if roles, ok := c.Value("roles").([]string); ok {
+			return c.Render(http.StatusOK, render.String(roles[0]))
+		}
+		return c.Render(http.StatusOK, render.String("no roles"))
+	}
+	app.GET("/page", page)
+	app.GET("/busy", ClaimsOnly(page))
+	app.GET("/private", RequireLogin(func(c buffalo.Context) error {
+		user, _ := c.Value(ContextKey).(*User)
+		require.NotNil(t, user)
+		return c.Render(http.StatusOK, render.String(user.Email))
+	}))
+
+	login := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}.Encode(), nil)
+	require.Equal(t, http.StatusSeeOther, login.Code)
+	cookies := login.Result().Cookies()
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if set := rec.Result().Cookies(); len(set) > 0 {
+			cookies = set
+		}
+		return rec
+	}
+
+	store.lookups = 0
+	res := get("/page")
+	assert.Equal(t, "editor", res.Body.String())
+	assert.Equal(t, 1, store.lookups, "loaded once per request")
+	assert.Equal(t, 1, preloads)
+	require.Len(t, seen, 3)
+	assert.Same(t, seen[0], seen[2])
+	assert.Equal(t, "ada@example.com", seen[0].Email)
+
+	seen = nil
+	res = get("/busy")
+	assert.Equal(t, "no roles", res.Body.String(), "claims-only requests skip preloading")
+	assert.Equal(t, 1, store.lookups, "claims-only requests don't hit the store")
+	assert.Equal(t, "ada@example.com", seen[0].Email)
+	assert.Equal(t, store.users["ada@example.com"].ID, seen[0].ID)
+
+	res = get("/private")
+	assert.Equal(t, "ada@example.com", res.Body.String())
+	assert.Equal(t, 2, store.lookups)
+
+	seen, cookies = nil, nil
+	get("/page")
+	assert.Nil(t, seen[0], "no session, no user")
+	assert.Equal(t, 2, preloads, "nothing to preload for visitors")
+}
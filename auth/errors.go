@@ -0,0 +1,44 @@
+package auth
+
+import "errors"
+
+// Kinds of store error. Every store error that means a record is missing
+// or clashes with another matches one of these with errors.Is, in this
+// package and in the others that build on it (orgs, tenancy, mail), so
+// handlers can branch on the kind without knowing the store:
+//
+//	switch {
+//	case errors.Is(err, auth.ErrNotFound):
+//	    return c.Error(http.StatusNotFound, err)
+//	case errors.Is(err, auth.ErrConflict):
+//	    return c.Error(http.StatusConflict, err)
+//	}
+//
+// Stores also give up once their context is done, returning its error
+// (context.Canceled or DeadlineExceeded), possibly wrapped.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// NotFoundError returns a new error with message msg that is also
+// ErrNotFound, for stores' own sentinels such as ErrUserNotFound.
+func NotFoundError(msg string) error {
+	return &kindError{msg: msg, kind: ErrNotFound}
+}
+
+// ConflictError returns a new error with message msg that is also
+// ErrConflict, for stores' own sentinels such as ErrUserExists.
+func ConflictError(msg string) error {
+	return &kindError{msg: msg, kind: ErrConflict}
+}
+
+// kindError is a sentinel error of a kind.
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func (e *kindError) Error() string { return e.msg }
+
+func (e *kindError) Unwrap() error { return e.kind }
@@ -3,6 +3,8 @@ package auth
 import (
 	"context"
 	"time"
+
+	"github.com/johnjansen/buffkit/clock"
 )
 
 // ExtendedUserStore is a stub interface to satisfy jobs package compilation
@@ -20,16 +22,35 @@ type ExtendedUserStore interface {
 
 // Make MemoryStore implement ExtendedUserStore minimally
 func (m *MemoryStore) IncrementFailedLoginAttempts(ctx context.Context, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// Stub - do nothing for now
 	return nil
 }
 
 func (m *MemoryStore) ResetFailedLoginAttempts(ctx context.Context, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// Stub - do nothing for now
 	return nil
 }
 
 func (m *MemoryStore) CleanupSessions(ctx context.Context, maxAge, maxInactivity time.Duration) (int, error) {
-	// Stub - do nothing for now, return 0 sessions cleaned
-	return 0, nil
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	now := clock.Or(sessionTimeouts.Clock).Now()
+	cleaned := 0
+	for id, s := range m.sessions {
+		if (maxAge > 0 && now.Sub(s.CreatedAt) > maxAge) ||
+			(maxInactivity > 0 && now.Sub(s.LastSeenAt) > maxInactivity) {
+			delete(m.sessions, id)
+			cleaned++
+		}
+	}
+	return cleaned, nil
 }
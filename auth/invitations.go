@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/johnjansen/buffkit/readonly"
+)
+
+// ErrInvitationUsed is returned when a registration invitation has
+// already been used.
+var ErrInvitationUsed = ConflictError("invitation already used")
+
+// InvitationStore is a UserStore that records used registration
+// invitations, so each invitation link registers one user.
+type InvitationStore interface {
+	UserStore
+	InvitationUsed(ctx context.Context, id string) (bool, error)
+	// CreateInvited creates user and records that they registered with
+	// invitation id, as one step. It returns ErrInvitationUsed, creating
+	// nobody, if the invitation was already used, so concurrent
+	// registrations with the same link create one user.
+	CreateInvited(ctx context.Context, user *User, id string, at time.Time) error
+}
+
+func (m *MemoryStore) InvitationUsed(ctx context.Context, id string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.invitationsMu.Lock()
+	defer m.invitationsMu.Unlock()
+	_, used := m.usedInvitations[id]
+	return used, nil
+}
+
+func (m *MemoryStore) CreateInvited(ctx context.Context, user *User, id string, at time.Time) error {
+	if err := readonly.Check("auth.CreateInvited"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.invitationsMu.Lock()
+	defer m.invitationsMu.Unlock()
+	if _, used := m.usedInvitations[id]; used {
+		return ErrInvitationUsed
+	}
+	if err := m.Create(ctx, user); err != nil {
+		return err
+	}
+	if m.usedInvitations == nil {
+		m.usedInvitations = make(map[string]string)
+	}
+	m.usedInvitations[id] = user.ID
+	return nil
+}
@@ -0,0 +1,339 @@
+// Package ldap lets users log in with their LDAP or Active Directory
+// password. The login form's email or username is looked up in the
+// directory, using a service account or an anonymous bind, and the
+// password is checked by binding as the entry found. The entry's
+// attributes fill in the user's email, name and username.
+//
+// Users are matched by email address, so an existing account is linked
+// on its first directory login. With Config.CreateUsers, unknown users
+// get an account; otherwise they're refused. With
+// Config.FallbackToLocal, logins the directory doesn't know, or made
+// while it can't be reached, are checked against the store's passwords,
+// so local accounts such as an emergency admin keep working.
+//
+// Wire sets it up when Config.LDAP is set. To set it up yourself:
+//
+//	dir, err := ldap.New(store, ldap.Config{
+//	    URL:          "ldaps://ldap.example.com",
+//	    BaseDN:       "ou=people,dc=example,dc=com",
+//	    BindDN:       "cn=buffkit,ou=services,dc=example,dc=com",
+//	    BindPassword: os.Getenv("LDAP_PASSWORD"),
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	auth.UseAuthenticator(dir.Authenticate)
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/johnjansen/buffkit/auth"
+)
+
+// DefaultUserFilter matches the login against the attributes OpenLDAP
+// and Active Directory usually keep usernames and emails in.
+const DefaultUserFilter = "(|(uid=%s)(sAMAccountName=%s)(mail=%s)(userPrincipalName=%s))"
+
+// Errors returned by Authenticate.
+var (
+	ErrUnavailable = errors.New("ldap: the directory can't be reached")
+	ErrNoEmail     = errors.New("ldap: the directory entry has no email address")
+	ErrAmbiguous   = errors.New("ldap: more than one directory entry matches the login")
+)
+
+// Config configures the directory.
+type Config struct {
+	// URL is the directory's address: "ldaps://host" (port 636),
+	// or "ldap://host" (port 389) with StartTLS. Required.
+	URL string
+
+	// StartTLS upgrades an ldap:// connection to TLS before sending any
+	// password. Leave it off only for a directory on a trusted network.
+	StartTLS bool
+
+	// TLSConfig is used for ldaps:// and StartTLS. Defaults to verifying
+	// the server's certificate against the system roots.
+	TLSConfig *tls.Config
+
+	// BindDN and BindPassword are the service account users are looked
+	// up with. Empty binds anonymously.
+	BindDN       string
+	BindPassword string
+
+	// BaseDN is where users are searched for, with its subtree.
+	// Required.
+	BaseDN string
+
+	// UserFilter finds the entry for a login, with each %s replaced by
+	// the escaped login. Defaults to DefaultUserFilter. Add conditions to
+	// limit who can log in, such as a group:
+	//
+	//	(&(objectClass=person)(memberOf=cn=staff,ou=groups,dc=example,dc=com)(uid=%s))
+	UserFilter string
+
+	// EmailAttribute holds the user's email. Defaults to "mail", then
+	// "userPrincipalName" when it looks like an address.
+	EmailAttribute string
+
+	// NameAttribute holds the user's display name. Defaults to
+	// "displayName", then "cn", then the given name and surname.
+	NameAttribute string
+
+	// UsernameAttribute holds the username given to new users, when the
+	// store keeps usernames. Defaults to "uid", then "sAMAccountName".
+	UsernameAttribute string
+
+	// CreateUsers creates an account the first time someone in the
+	// directory logs in. Without it only existing users can log in.
+	CreateUsers bool
+
+	// FallbackToLocal checks the store's password for logins the
+	// directory has no entry for, or when it can't be reached. Without
+	// it they're refused, or fail, respectively.
+	FallbackToLocal bool
+
+	// Timeout limits connecting and each request. Defaults to 10
+	// seconds.
+	Timeout time.Duration
+}
+
+// Directory checks passwords against an LDAP directory for users in
+// Store.
+type Directory struct {
+	Store  auth.UserStore
+	Config Config
+}
+
+// New creates a directory from cfg.
+func New(store auth.UserStore, cfg Config) (*Directory, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("ldap: URL must be an ldap:// or ldaps:// URL, got %q", cfg.URL)
+	}
+	if u.Scheme == "ldaps" && cfg.StartTLS {
+		return nil, errors.New("ldap: StartTLS is for ldap:// URLs; ldaps:// is already TLS")
+	}
+	if cfg.BaseDN == "" {
+		return nil, errors.New("ldap: BaseDN is required")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = DefaultUserFilter
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, fmt.Errorf("ldap: UserFilter must contain %%s for the login, got %q", cfg.UserFilter)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Directory{Store: store, Config: cfg}, nil
+}
+
+// Authenticate checks login and password against the directory and
+// returns the user they belong to, for auth.UseAuthenticator. It
+// returns auth.ErrInvalidCredentials when the password is wrong, the
+// directory has no entry for the login, or it has no account for the
+// entry, and auth.ErrUseLocalPassword where Config.FallbackToLocal
+// applies.
+func (d *Directory) Authenticate(ctx context.Context, login, password string) (*auth.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entry, err := d.bind(login, password)
+	switch {
+	case entry == nil && err == nil:
+		if d.Config.FallbackToLocal {
+			return nil, auth.ErrUseLocalPassword
+		}
+		return nil, auth.ErrInvalidCredentials
+	case errors.Is(err, ErrUnavailable) && d.Config.FallbackToLocal:
+		return nil, auth.ErrUseLocalPassword
+	case err != nil:
+		return nil, err
+	}
+	return d.user(ctx, entry)
+}
+
+// bind finds login's entry and binds as it with password. It returns a
+// nil entry when there isn't one.
+func (d *Directory) bind(login, password string) (*goldap.Entry, error) {
+	// Binding with an empty password is an anonymous bind that
+	// succeeds, so it never counts
+	if password == "" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if d.Config.BindDN != "" {
+		err = conn.Bind(d.Config.BindDN, d.Config.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap: bind as %q: %w", d.Config.BindDN, err)
+	}
+
+	filter := strings.ReplaceAll(d.Config.UserFilter, "%s", goldap.EscapeFilter(login))
+	result, err := conn.Search(goldap.NewSearchRequest(
+		d.Config.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		2, int(d.Config.Timeout.Seconds()), false, filter, d.attributes(), nil))
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap: search: %w", err)
+	}
+	switch {
+	case len(result.Entries) == 0:
+		return nil, nil
+	case len(result.Entries) > 1:
+		return nil, ErrAmbiguous
+	}
+
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, auth.ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap: bind as %q: %w", entry.DN, err)
+	}
+	return entry, nil
+}
+
+// dial connects to the directory, upgrading to TLS when configured.
+func (d *Directory) dial() (*goldap.Conn, error) {
+	tlsConfig := d.Config.TLSConfig
+	if tlsConfig == nil {
+		u, _ := url.Parse(d.Config.URL)
+		tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	conn, err := goldap.DialURL(d.Config.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: d.Config.Timeout}),
+		goldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	conn.SetTimeout(d.Config.Timeout)
+	if d.Config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: StartTLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// user finds the user entry is for, creating them when
+// Config.CreateUsers allows, and keeps their name in step with the
+// directory.
+func (d *Directory) user(ctx context.Context, entry *goldap.Entry) (*auth.User, error) {
+	email := strings.ToLower(strings.TrimSpace(d.email(entry)))
+	if !strings.Contains(email, "@") {
+		return nil, fmt.Errorf("%w: %s", ErrNoEmail, entry.DN)
+	}
+	name := d.displayName(entry)
+
+	user, err := d.Store.ByEmail(ctx, email)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		if !d.Config.CreateUsers {
+			return nil, auth.ErrInvalidCredentials
+		}
+		return d.create(ctx, entry, email, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if profiles, ok := d.Store.(auth.ProfileStore); ok && name != "" && name != user.DisplayName {
+		if err := profiles.UpdateDisplayName(ctx, user.ID, name); err != nil {
+			return nil, err
+		}
+		user.DisplayName = name
+	}
+	return user, nil
+}
+
+// create adds the user for a directory entry. They have no password of
+// their own, so they can only log in through the directory.
+func (d *Directory) create(ctx context.Context, entry *goldap.Entry, email, name string) (*auth.User, error) {
+	// The directory vouches for the address
+	now := time.Now()
+	user := &auth.User{Email: email, DisplayName: name, EmailVerifiedAt: &now, IsActive: true}
+	if usernames, ok := d.Store.(auth.UsernameStore); ok {
+		username := auth.NormalizeUsername(d.username(entry))
+		if auth.ValidateUsername(username) == nil {
+			if taken, err := usernames.ExistsUsername(ctx, username); err == nil && !taken {
+				user.Username = username
+			}
+		}
+	}
+	if err := d.Store.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// attributes are the attributes to fetch with an entry.
+func (d *Directory) attributes() []string {
+	attrs := []string{"mail", "userPrincipalName", "displayName", "cn", "givenName", "sn", "uid", "sAMAccountName"}
+	for _, a := range []string{d.Config.EmailAttribute, d.Config.NameAttribute, d.Config.UsernameAttribute} {
+		if a != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// email is the configured email attribute, else mail, else a
+// userPrincipalName that looks like an address.
+func (d *Directory) email(e *goldap.Entry) string {
+	if d.Config.EmailAttribute != "" {
+		return attribute(e, d.Config.EmailAttribute)
+	}
+	if v := attribute(e, "mail"); v != "" {
+		return v
+	}
+	if v := attribute(e, "userPrincipalName"); strings.Contains(v, "@") {
+		return v
+	}
+	return ""
+}
+
+// displayName is the configured name attribute, else a common one, else
+// the given name and surname.
+func (d *Directory) displayName(e *goldap.Entry) string {
+	if d.Config.NameAttribute != "" {
+		return attribute(e, d.Config.NameAttribute)
+	}
+	if v := attribute(e, "displayName", "cn"); v != "" {
+		return v
+	}
+	return strings.TrimSpace(attribute(e, "givenName") + " " + attribute(e, "sn"))
+}
+
+// username is the configured username attribute, else a common one.
+func (d *Directory) username(e *goldap.Entry) string {
+	if d.Config.UsernameAttribute != "" {
+		return attribute(e, d.Config.UsernameAttribute)
+	}
+	return attribute(e, "uid", "sAMAccountName")
+}
+
+// attribute returns the first value of the first of names the entry
+// has, ignoring case.
+func attribute(e *goldap.Entry, names ...string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(e.GetEqualFoldAttributeValue(name)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
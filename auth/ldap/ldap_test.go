@@ -0,0 +1,272 @@
+package ldap_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/auth/ldap"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entry is a user in a testDirectory.
+type entry struct {
+	password string
+	attrs    map[string]string
+}
+
+// testDirectory is an LDAP server that answers simple binds and finds
+// entries whose attributes appear in the search filter.
+type testDirectory struct {
+	URL string
+
+	mu       sync.Mutex
+	entries  map[string]entry
+	searches []string
+}
+
+func newDirectory(t *testing.T) *testDirectory {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	d := &testDirectory{
+		URL: "ldap://" + ln.Addr().String(),
+		entries: map[string]entry{
+			"cn=service,dc=example,dc=com": {password: "service"},
+			"uid=grace,ou=people,dc=example,dc=com": {password: "cobol", attrs: map[string]string{
+				"uid": "grace", "mail": "Grace@example.com", "cn": "Grace Hopper",
+			}},
+			"uid=ada,ou=people,dc=example,dc=com": {password: "engine", attrs: map[string]string{
+				"uid": "ada", "mail": "ada@example.com", "givenName": "Ada", "sn": "Lovelace",
+			}},
+		},
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id := req.Children[0].Value
+		op := req.Children[1]
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			code := goldap.LDAPResultInvalidCredentials
+			dn, _ := op.Children[1].Value.(string)
+			d.mu.Lock()
+			e, ok := d.entries[dn]
+			d.mu.Unlock()
+			if ok && e.password == op.Children[2].Data.String() {
+				code = goldap.LDAPResultSuccess
+			}
+			conn.Write(response(id, goldap.ApplicationBindResponse, code).Bytes())
+		case goldap.ApplicationSearchRequest:
+			filter, _ := goldap.DecompileFilter(op.Children[6])
+			d.mu.Lock()
+			d.searches = append(d.searches, filter)
+			for dn, e := range d.entries {
+				if !matches(e, filter) {
+					continue
+				}
+				found := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "entry")
+				found.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "dn"))
+				attrs := ber.NewSequence("attributes")
+				for name, value := range e.attrs {
+					attr := ber.NewSequence("attribute")
+					attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+					values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+					values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+					attr.AppendChild(values)
+					attrs.AppendChild(attr)
+				}
+				found.AppendChild(attrs)
+				msg := ber.NewSequence("message")
+				msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "id"))
+				msg.AppendChild(found)
+				conn.Write(msg.Bytes())
+			}
+			d.mu.Unlock()
+			conn.Write(response(id, goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+// matches reports whether filter compares one of e's attributes against
+// its value.
+func matches(e entry, filter string) bool {
+	for name, value := range e.attrs {
+		if strings.Contains(filter, "("+name+"="+goldap.EscapeFilter(value)+")") {
+			return true
+		}
+	}
+	return false
+}
+
+// response is an LDAPResult message with code.
+func response(id any, tag ber.Tag, code int) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matched"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "message"))
+	msg := ber.NewSequence("message")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "id"))
+	msg.AppendChild(result)
+	return msg
+}
+
+func config(d *testDirectory) ldap.Config {
+	return ldap.Config{
+		URL:          d.URL,
+		BaseDN:       "ou=people,dc=example,dc=com",
+		BindDN:       "cn=service,dc=example,dc=com",
+		BindPassword: "service",
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	store := auth.NewMemoryStore()
+	for name, cfg := range map[string]ldap.Config{
+		"no URL":          {BaseDN: "dc=example,dc=com"},
+		"http URL":        {URL: "http://ldap.example.com", BaseDN: "dc=example,dc=com"},
+		"no BaseDN":       {URL: "ldap://ldap.example.com"},
+		"StartTLS on TLS": {URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", StartTLS: true},
+		"filter sans %s":  {URL: "ldap://ldap.example.com", BaseDN: "dc=example,dc=com", UserFilter: "(uid=grace)"},
+	} {
+		_, err := ldap.New(store, cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	d := newDirectory(t)
+	store := auth.NewMemoryStore()
+	require.NoError(t, store.Create(ctx, &auth.User{Email: "grace@example.com", DisplayName: "Amazing Grace"}))
+	dir, err := ldap.New(store, config(d))
+	require.NoError(t, err)
+
+	user, err := dir.Authenticate(ctx, "grace", "cobol")
+	require.NoError(t, err)
+	assert.Equal(t, "grace@example.com", user.Email, "matched by email")
+	assert.Equal(t, "Grace Hopper", user.DisplayName, "the name follows the directory")
+	assert.Contains(t, d.searches[0], "(uid=grace)")
+
+	_, err = dir.Authenticate(ctx, "grace", "fortran")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = dir.Authenticate(ctx, "grace", "")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = dir.Authenticate(ctx, "ada", "engine")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials, "no account without CreateUsers")
+	_, err = dir.Authenticate(ctx, "nobody", "secret")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	_, err = dir.Authenticate(ctx, "*)(uid=grace", "cobol")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	assert.Contains(t, d.searches[len(d.searches)-1], `\2a\29\28uid=grace`, "the login is escaped")
+
+	dir.Config.CreateUsers = true
+	user, err = dir.Authenticate(ctx, "ada", "engine")
+	require.NoError(t, err)
+	assert.Equal(t, "Ada Lovelace", user.DisplayName)
+	assert.Equal(t, "ada", user.Username)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.Empty(t, user.PasswordDigest, "only the directory knows the password")
+	_, err = store.ByEmail(ctx, "ada@example.com")
+	assert.NoError(t, err)
+
+	dir.Config.BindPassword = "wrong"
+	_, err = dir.Authenticate(ctx, "ada", "engine")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, auth.ErrInvalidCredentials), "a broken service account isn't the user's fault")
+}
+
+func TestFallbackToLocal(t *testing.T) {
+	ctx := context.Background()
+	d := newDirectory(t)
+	store := auth.NewMemoryStore()
+	dir, err := ldap.New(store, config(d))
+	require.NoError(t, err)
+
+	_, err = dir.Authenticate(ctx, "admin@example.com", "secret")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	dir.Config.FallbackToLocal = true
+	_, err = dir.Authenticate(ctx, "admin@example.com", "secret")
+	assert.ErrorIs(t, err, auth.ErrUseLocalPassword, "unknown to the directory")
+	_, err = dir.Authenticate(ctx, "grace", "fortran")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials, "a wrong directory password isn't retried locally")
+
+	u, _ := url.Parse(d.URL)
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	u.Host = down.Addr().String()
+	down.Close()
+	dir.Config.URL = u.String()
+	_, err = dir.Authenticate(ctx, "grace", "cobol")
+	assert.ErrorIs(t, err, auth.ErrUseLocalPassword, "the directory is down")
+	dir.Config.FallbackToLocal = false
+	_, err = dir.Authenticate(ctx, "grace", "cobol")
+	assert.ErrorIs(t, err, ldap.ErrUnavailable)
+}
+
+func TestLDAPLogin(t *testing.T) {
+	d := newDirectory(t)
+	cfg := config(d)
+	cfg.CreateUsers = true
+	cfg.FallbackToLocal = true
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{LDAP: &cfg},
+		Setup: func(a *buffalo.App) {
+			a.GET("/me", buffkit.RequireLogin(func(c buffalo.Context) error {
+				return c.Render(http.StatusOK, render.String(auth.CurrentUser(c).Email))
+			}))
+		},
+	})
+	t.Cleanup(func() { auth.UseAuthenticator(nil) })
+	require.NotNil(t, app.Kit.LDAP)
+
+	digest, err := auth.HashPassword("local-secret")
+	require.NoError(t, err)
+	require.NoError(t, app.Kit.AuthStore.Create(context.Background(), &auth.User{Email: "admin@example.com", PasswordDigest: digest}))
+
+	login := func(login, password string) *buffkittest.Client {
+		client := app.Client()
+		res := client.Post("/login", url.Values{"login": {login}, "password": {password}})
+		require.Equal(t, http.StatusSeeOther, res.Code, login)
+		return client
+	}
+	assert.Equal(t, "grace@example.com", login("grace", "cobol").Get("/me").Body.String())
+	assert.Equal(t, "admin@example.com", login("admin@example.com", "local-secret").Get("/me").Body.String())
+
+	res := app.Client().Post("/login", url.Values{"login": {"grace"}, "password": {"wrong"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/clock"
+)
+
+// PasswordChange is a user's password being changed or reset, for an
+// audit log.
+type PasswordChange struct {
+	UserID string
+
+	// Via says what changed it, such as "account" for the user on the
+	// account pages, "reset" for a password reset link, "scim" for an
+	// identity provider, or "task" for buffalo task
+	// buffkit:users:reset-password.
+	Via string
+
+	// IP and UserAgent are the request's, for changes made in one.
+	IP        string
+	UserAgent string
+
+	// SessionsEnded is how many of the user's sessions were logged out.
+	SessionsEnded int
+
+	// KeptCurrent is set when the session that made the change stayed
+	// logged in.
+	KeptCurrent bool
+
+	At time.Time
+}
+
+var (
+	passwordChange         func(ctx context.Context, p PasswordChange)
+	logoutOnPasswordChange bool
+)
+
+// OnPasswordChange sets a function called after every password change,
+// for an audit log. It replaces any earlier one; nil removes it. Changes
+// are also logged through the request's logger.
+func OnPasswordChange(fn func(ctx context.Context, p PasswordChange)) {
+	passwordChange = fn
+}
+
+// RecordPasswordChange passes p to OnPasswordChange's function.
+// PasswordChanged calls it; password changes made outside a request,
+// such as by a task, call it themselves.
+func RecordPasswordChange(ctx context.Context, p PasswordChange) {
+	if passwordChange != nil {
+		passwordChange(ctx, p)
+	}
+}
+
+// EndSessions logs the user out of all their sessions but keep, which
+// may be empty, and returns how many it ended. It does nothing when the
+// store doesn't keep sessions (SessionStore).
+func EndSessions(ctx context.Context, userID, keep string) (int, error) {
+	store, ok := globalStore.(SessionStore)
+	if !ok {
+		return 0, nil
+	}
+	list, err := store.UserSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	ended := 0
+	for _, s := range list {
+		if s.ID == keep {
+			continue
+		}
+		if err := store.DeleteSession(ctx, s.ID); err != nil {
+			return ended, err
+		}
+		ended++
+	}
+	return ended, nil
+}
+
+// UseLogoutOnPasswordChange sets whether PasswordChanged also logs out
+// the session that made the change. Wire calls it with
+// Config.LogoutOnPasswordChange.
+func UseLogoutOnPasswordChange(logout bool) {
+	logoutOnPasswordChange = logout
+}
+
+// PasswordChanged logs user out everywhere after their password was
+// changed or reset, so a stolen session doesn't outlive the password it
+// was stolen with, and reports the change to OnPasswordChange's
+// function. The request's own session stays logged in unless
+// UseLogoutOnPasswordChange says otherwise. Sessions can only be ended
+// when the store keeps them (SessionStore); with any other store they
+// stay logged in and a warning is logged.
+//
+// Call it after saving the new password; via is PasswordChange.Via.
+func PasswordChanged(c buffalo.Context, user *User, via string) error {
+	r := c.Request()
+	p := PasswordChange{
+		UserID:    user.ID,
+		Via:       via,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		At:        clock.Or(sessionTimeouts.Clock).Now(),
+	}
+
+	// The request's session is kept when it's the user's own
+	own := GetUserSession(c) == user.Email
+	keep := ""
+	if own && !logoutOnPasswordChange {
+		keep = CurrentSessionID(c)
+		p.KeptCurrent = true
+	}
+	ended, err := EndSessions(c, user.ID, keep)
+	if err != nil {
+		return err
+	}
+	p.SessionsEnded = ended
+	if _, ok := globalStore.(SessionStore); !ok {
+		c.Logger().WithField("user", p.UserID).
+			Warn("auth: password changed but the auth store doesn't keep sessions, so other sessions stay logged in")
+	}
+	if own && !p.KeptCurrent {
+		c.Session().Delete(sessionIDKey)
+		ClearUserSession(c)
+	}
+
+	c.Logger().WithFields(map[string]any{
+		"user":           p.UserID,
+		"via":            p.Via,
+		"ip":             p.IP,
+		"sessions_ended": p.SessionsEnded,
+	}).Info("auth: password changed")
+	RecordPasswordChange(c, p)
+	return nil
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/logger"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordChangedWithoutSessionStore(t *testing.T) {
+	// Only the UserStore methods, so no sessions are kept
+	store := struct{ UserStore }{NewMemoryStore()}
+	previous := globalStore
+	UseStore(store)
+	t.Cleanup(func() { UseStore(previous) })
+	clk := clock.NewFake(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	UseSessionTimeouts(SessionTimeouts{Clock: clk})
+	t.Cleanup(func() { UseSessionTimeouts(SessionTimeouts{}) })
+
+	var changes []PasswordChange
+	OnPasswordChange(func(ctx context.Context, p PasswordChange) { changes = append(changes, p) })
+	t.Cleanup(func() { OnPasswordChange(nil) })
+
+	var logs bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&logs)
+	app := buffalo.New(buffalo.Options{Env: "test", Logger: logger.Logrus{FieldLogger: base}})
+	app.POST("/changed", func(c buffalo.Context) error {
+		if err := PasswordChanged(c, &User{ID: "u", Email: "ada@example.com"}, "task"); err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, render.String("ok"))
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/changed", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.Len(t, changes, 1)
+	assert.Zero(t, changes[0].SessionsEnded)
+	assert.Equal(t, clk.Now(), changes[0].At)
+	assert.Contains(t, logs.String(), "doesn't keep sessions")
+}
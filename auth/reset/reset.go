@@ -0,0 +1,313 @@
+// Package reset adds the pages where users who forgot their password
+// set a new one:
+//
+//   - /forgot-password asks for the account's email and mails a link to
+//     it. The page says the same whether or not the email is registered,
+//     and the mail is sent in the background either way, so neither the
+//     answer nor how long it takes tells who has an account.
+//   - /reset-password/{token} is the link. It sets the new password,
+//     logs the user out everywhere else (auth.PasswordChanged), and sends
+//     them to the login page.
+//
+// Each link works once, and only for TTL after it was sent; asking again
+// replaces it. Only the token's hash is stored (auth.ResetTokenStore).
+// Links always point at BaseURL, never at the request's Host header,
+// which anyone can forge.
+//
+// Wire mounts it (under MountPath and AuthPath) when
+// Config.PasswordReset is set. The pages render views.PageForgotPassword
+// and views.PageResetPassword, so apps can restyle them like Buffkit's
+// other pages.
+package reset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/account"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// DefaultTTL is how long a reset link stays valid.
+const DefaultTTL = time.Hour
+
+// SuccessMessage is flashed under "success" on the login page after a
+// reset.
+const SuccessMessage = "Your password has been reset. Log in with your new password."
+
+// SendTask is the job type that mails reset links when Queue is set.
+const SendTask = "buffkit:password_reset"
+
+// ErrNoBaseURL is returned when mailing a reset link without BaseURL.
+var ErrNoBaseURL = errors.New("reset: BaseURL is needed to email reset links")
+
+// Queue is the jobs runtime reset links are mailed from;
+// *jobs.Runtime implements it.
+type Queue interface {
+	HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error)
+	EnqueueIn(delay time.Duration, taskType string, payload interface{}) error
+}
+
+// Reset serves the password reset pages for users in Store.
+type Reset struct {
+	Store  auth.ResetTokenStore
+	Sender mail.Sender
+
+	// ForgotPath is where Mount puts the page that asks for an email.
+	// Defaults to "/forgot-password".
+	ForgotPath string
+
+	// ResetPath is where Mount puts the reset links, with the token
+	// after it. Defaults to "/reset-password".
+	ResetPath string
+
+	// BaseURL is the absolute URL of the app, e.g.
+	// "https://app.example.com", for the links in emails. It's required.
+	BaseURL string
+
+	// Queue mails reset links as SendTask jobs, which Mount registers.
+	// Without one they're mailed from a goroutine; Wait waits for those.
+	Queue Queue
+
+	// TTL is how long reset links stay valid. Defaults to DefaultTTL.
+	TTL time.Duration
+
+	// Clock dates reset links and checks their expiry. Defaults to
+	// clock.Real.
+	Clock clock.Clock
+
+	// sending counts the goroutines mailing links
+	sending sync.WaitGroup
+}
+
+// sendPayload is a SendTask job.
+type sendPayload struct {
+	Email string `json:"email"`
+}
+
+// New creates a Reset with default settings.
+func New(store auth.ResetTokenStore, sender mail.Sender) *Reset {
+	return &Reset{
+		Store:      store,
+		Sender:     sender,
+		ForgotPath: "/forgot-password",
+		ResetPath:  "/reset-password",
+		TTL:        DefaultTTL,
+	}
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (r *Reset) Routes() [][2]string {
+	return [][2]string{
+		{http.MethodGet, r.ForgotPath},
+		{http.MethodPost, r.ForgotPath},
+		{http.MethodGet, r.ResetPath + "/{token}"},
+		{http.MethodPost, r.ResetPath + "/{token}"},
+	}
+}
+
+// Mount adds the password reset routes to app, and the SendTask handler
+// to Queue.
+func (r *Reset) Mount(app *buffalo.App) {
+	if r.Queue != nil {
+		r.Queue.HandleFunc(SendTask, func(ctx context.Context, t *asynq.Task) error {
+			var p sendPayload
+			if err := json.Unmarshal(t.Payload(), &p); err != nil {
+				return fmt.Errorf("reset: %w", err)
+			}
+			return r.Send(ctx, p.Email)
+		})
+	}
+	app.GET(r.ForgotPath, r.ShowForgot)
+	app.POST(r.ForgotPath, r.Forgot)
+	app.GET(r.ResetPath+"/{token}", r.ShowReset)
+	app.POST(r.ResetPath+"/{token}", r.Reset)
+}
+
+// ShowForgot renders the form asking for the account's email.
+func (r *Reset) ShowForgot(c buffalo.Context) error {
+	return views.Render(c, http.StatusOK, views.PageForgotPassword, r.forgotData("", false, nil))
+}
+
+// Forgot mails a reset link to the email posted, if it belongs to an
+// active user, and says it was sent either way. The mail goes out in the
+// background whether or not the user exists, so known and unknown
+// emails take the same time to answer.
+func (r *Reset) Forgot(c buffalo.Context) error {
+	email := strings.ToLower(strings.TrimSpace(c.Request().FormValue("email")))
+	if !strings.Contains(email, "@") {
+		return views.Render(c, http.StatusUnprocessableEntity, views.PageForgotPassword,
+			r.forgotData(email, false, []string{"Enter a valid email address"}))
+	}
+
+	if r.Queue != nil {
+		if err := r.Queue.EnqueueIn(0, SendTask, sendPayload{Email: email}); err != nil {
+			return c.Error(http.StatusInternalServerError, err)
+		}
+	} else {
+		logger := c.Logger()
+		ctx := context.WithoutCancel(c)
+		r.sending.Add(1)
+		go func() {
+			defer r.sending.Done()
+			if err := r.Send(ctx, email); err != nil {
+				logger.WithField("error", err).Error("reset: send reset link")
+			}
+		}()
+	}
+	return views.Render(c, http.StatusOK, views.PageForgotPassword, r.forgotData(email, true, nil))
+}
+
+// Send mails a new reset link to email if it belongs to a user who isn't
+// deactivated, replacing any earlier link. It does nothing for other
+// emails.
+func (r *Reset) Send(ctx context.Context, email string) error {
+	if r.BaseURL == "" {
+		return ErrNoBaseURL
+	}
+	user, err := r.Store.ByEmail(ctx, email)
+	if errors.Is(err, auth.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.DeactivatedAt != nil {
+		return nil
+	}
+
+	token, err := auth.NewResetToken(ctx, r.Store, user.ID, clock.Or(r.Clock).Now())
+	if err != nil {
+		return err
+	}
+	link := strings.TrimSuffix(r.BaseURL, "/") + r.ResetPath + "/" + token
+	expires := inWords(r.ttl())
+	err = r.Sender.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Text: "Someone asked to reset the password for your account. Set a new one by opening:\n\n" + link + "\n\n" +
+			"The link expires in " + expires + ". If you didn't ask, you can ignore this email.\n",
+		HTML: `<p>Someone asked to reset the password for your account.</p><p><a href="` + html.EscapeString(link) + `">Set a new password</a></p>` +
+			`<p>The link expires in ` + expires + `. If you didn't ask, you can ignore this email.</p>`,
+	})
+	if err != nil {
+		return fmt.Errorf("reset: send reset link: %w", err)
+	}
+	return nil
+}
+
+// Wait waits for the reset links being mailed from goroutines.
+func (r *Reset) Wait() {
+	r.sending.Wait()
+}
+
+// user returns the user the request's token resets the password of. A
+// bad token renders the page saying so and returns a nil user.
+func (r *Reset) user(c buffalo.Context) (*auth.User, error) {
+	user, err := auth.ResetTokenUser(c, r.Store, c.Param("token"), clock.Or(r.Clock).Now(), r.ttl())
+	if errors.Is(err, auth.ErrResetTokenInvalid) {
+		return nil, views.Render(c, http.StatusGone, views.PageResetPassword, r.resetData(c, true, nil))
+	}
+	if err != nil {
+		return nil, c.Error(http.StatusInternalServerError, err)
+	}
+	return user, nil
+}
+
+// ShowReset renders the new password form.
+func (r *Reset) ShowReset(c buffalo.Context) error {
+	user, err := r.user(c)
+	if user == nil {
+		return err
+	}
+	return views.Render(c, http.StatusOK, views.PageResetPassword, r.resetData(c, false, nil))
+}
+
+// Reset sets the new password, uses up the link, and logs the user out
+// everywhere before sending them to the login page.
+func (r *Reset) Reset(c buffalo.Context) error {
+	user, err := r.user(c)
+	if user == nil {
+		return err
+	}
+
+	req := c.Request()
+	password := req.FormValue("password")
+	fail := func(msg string) error {
+		return views.Render(c, http.StatusUnprocessableEntity, views.PageResetPassword, r.resetData(c, false, []string{msg}))
+	}
+	switch {
+	case len(password) < account.MinPasswordLength:
+		return fail(fmt.Sprintf("Password must be at least %d characters", account.MinPasswordLength))
+	case password != req.FormValue("password_confirmation"):
+		return fail("Passwords don't match")
+	}
+
+	digest, err := auth.HashPassword(password)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := r.Store.SetResetToken(c, user.ID, "", time.Time{}); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := r.Store.UpdatePassword(c, user.ID, digest); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := auth.PasswordChanged(c, user, "reset"); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	c.Flash().Add("success", SuccessMessage)
+	return c.Redirect(http.StatusSeeOther, auth.LoginPath())
+}
+
+func (r *Reset) ttl() time.Duration {
+	if r.TTL <= 0 {
+		return DefaultTTL
+	}
+	return r.TTL
+}
+
+// inWords says d in whole hours or minutes, e.g. "1 hour".
+func inWords(d time.Duration) string {
+	n, unit := int(d/time.Minute), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		n, unit = int(d/time.Hour), "hour"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+func (r *Reset) forgotData(email string, sent bool, errs []string) map[string]any {
+	return map[string]any{
+		"forgot_password_path": r.ForgotPath,
+		"email":                email,
+		"sent":                 sent,
+		"errors":               errs,
+	}
+}
+
+func (r *Reset) resetData(c buffalo.Context, invalid bool, errs []string) map[string]any {
+	return map[string]any{
+		"reset_password_path":  r.ResetPath + "/" + c.Param("token"),
+		"forgot_password_path": r.ForgotPath,
+		"invalid":              invalid,
+		"errors":               errs,
+	}
+}
+
+// compile-time check that the memory store can back password resets
+var _ auth.ResetTokenStore = (*auth.MemoryStore)(nil)
@@ -0,0 +1,166 @@
+package reset_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/auth/reset"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetLink finds the reset link mailed to ada and returns its path.
+func resetLink(t *testing.T, app *buffkittest.App) string {
+	t.Helper()
+	app.Kit.PasswordReset.Wait()
+	msg, ok := app.Mailbox().LastTo("ada@example.com")
+	require.True(t, ok, "a reset link was mailed")
+	link := regexp.MustCompile(`https://app\.example\.com(/reset-password/\S+)`).FindStringSubmatch(msg.Text)
+	require.NotNil(t, link, msg.Text)
+	return link[1]
+}
+
+func newResetApp(t *testing.T) *buffkittest.App {
+	t.Helper()
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{PasswordReset: true, BaseURL: "https://app.example.com"},
+	})
+	t.Cleanup(func() { auth.UseForgotPasswordPath("") })
+	digest, err := auth.HashPassword("old-secret")
+	require.NoError(t, err)
+	// Without IsActive, like users provisioned through SCIM or SAML
+	require.NoError(t, app.Kit.AuthStore.Create(context.Background(), &auth.User{
+		Email: "ada@example.com", PasswordDigest: digest,
+	}))
+	return app
+}
+
+func passwords(password, confirmation string) url.Values {
+	return url.Values{"password": {password}, "password_confirmation": {confirmation}}
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newResetApp(t)
+	ctx := context.Background()
+	var changes []auth.PasswordChange
+	auth.OnPasswordChange(func(ctx context.Context, p auth.PasswordChange) { changes = append(changes, p) })
+	t.Cleanup(func() { auth.OnPasswordChange(nil) })
+
+	res := app.Client().Get("/login")
+	buffkittest.AssertElement(t, res.Body.String(), "a", "href", "/forgot-password")
+
+	client := app.Client()
+	res = client.Get("/forgot-password")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	res = client.Post("/forgot-password", url.Values{"email": {" Ada@Example.com "}})
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertText(t, res.Body.String(), "sent it a link")
+	link := resetLink(t, app)
+
+	res = client.Get(link)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertElement(t, res.Body.String(), "input", "name", "password_confirmation")
+
+	res = client.Post(link, passwords("short", "short"))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "at least 8 characters")
+	res = client.Post(link, passwords("new-secret", "other-secret"))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "don't match")
+
+	res = client.Post(link, passwords("new-secret", "new-secret"))
+	buffkittest.AssertRedirect(t, res, "/login")
+	buffkittest.AssertText(t, client.Get("/login").Body.String(), reset.SuccessMessage)
+	user, err := app.Kit.AuthStore.ByEmail(ctx, "ada@example.com")
+	require.NoError(t, err)
+	assert.NoError(t, auth.CheckPassword("new-secret", user.PasswordDigest))
+	require.Len(t, changes, 1)
+	assert.Equal(t, "reset", changes[0].Via)
+
+	assert.Equal(t, http.StatusGone, client.Get(link).Code, "links work once")
+	assert.Equal(t, http.StatusGone, client.Post(link, passwords("third-secret", "third-secret")).Code)
+	assert.Equal(t, http.StatusGone, client.Get("/reset-password/made-up").Code)
+}
+
+func TestForgotPasswordRevealsNothing(t *testing.T) {
+	app := newResetApp(t)
+
+	known := app.Client().Post("/forgot-password", url.Values{"email": {"ada@example.com"}})
+	unknown := app.Client().Post("/forgot-password", url.Values{"email": {"eve@example.com"}})
+	assert.Equal(t, known.Code, unknown.Code)
+	buffkittest.AssertText(t, unknown.Body.String(), "sent it a link")
+	app.Kit.PasswordReset.Wait()
+	_, ok := app.Mailbox().LastTo("eve@example.com")
+	assert.False(t, ok)
+
+	res := app.Client().Post("/forgot-password", url.Values{"email": {"ada"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+
+	ctx := context.Background()
+	user, err := app.Kit.AuthStore.ByEmail(ctx, "ada@example.com")
+	require.NoError(t, err)
+	now := app.Clock.Now()
+	require.NoError(t, app.Kit.AuthStore.(auth.ProvisioningStore).SetDeactivated(ctx, user.ID, &now))
+	app.Client().Post("/forgot-password", url.Values{"email": {"ada@example.com"}})
+	app.Kit.PasswordReset.Wait()
+	app.Mailbox().AssertSentCount(t, 1)
+}
+
+func TestResetLinkExpires(t *testing.T) {
+	app := newResetApp(t)
+	client := app.Client()
+
+	client.Post("/forgot-password", url.Values{"email": {"ada@example.com"}})
+	first := resetLink(t, app)
+	client.Post("/forgot-password", url.Values{"email": {"ada@example.com"}})
+	second := resetLink(t, app)
+	assert.Equal(t, http.StatusGone, client.Get(first).Code, "asking again replaces the link")
+	assert.Equal(t, http.StatusOK, client.Get(second).Code)
+
+	app.Clock.Advance(reset.DefaultTTL)
+	res := client.Get(second)
+	assert.Equal(t, http.StatusGone, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "invalid or has expired")
+}
+
+func TestPasswordResetNeedsBaseURL(t *testing.T) {
+	_, err := buffkit.Wire(buffalo.New(buffalo.Options{Env: "test"}), buffkit.Config{AuthSecret: []byte("secret"), PasswordReset: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "BaseURL", "links mustn't follow the request's Host header")
+
+	r := reset.New(auth.NewMemoryStore(), nil)
+	assert.ErrorIs(t, r.Send(context.Background(), "ada@example.com"), reset.ErrNoBaseURL)
+}
+
+func TestResetTokens(t *testing.T) {
+	ctx := context.Background()
+	store := auth.NewMemoryStore()
+	require.NoError(t, store.Create(ctx, &auth.User{ID: "u", Email: "ada@example.com"}))
+	now := time.Now()
+
+	token, err := auth.NewResetToken(ctx, store, "u", now)
+	require.NoError(t, err)
+	user, err := auth.ResetTokenUser(ctx, store, token, now.Add(59*time.Minute), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "u", user.ID)
+
+	_, sentAt, err := store.ByResetToken(ctx, token)
+	assert.ErrorIs(t, err, auth.ErrNotFound, "only the hash is stored")
+	assert.True(t, sentAt.IsZero())
+
+	_, err = auth.ResetTokenUser(ctx, store, token, now.Add(time.Hour), time.Hour)
+	assert.ErrorIs(t, err, auth.ErrResetTokenInvalid)
+	require.NoError(t, store.SetResetToken(ctx, "u", "", time.Time{}))
+	_, err = auth.ResetTokenUser(ctx, store, token, now, time.Hour)
+	assert.ErrorIs(t, err, auth.ErrResetTokenInvalid)
+	_, err = auth.NewResetToken(ctx, store, "nobody", now)
+	assert.ErrorIs(t, err, auth.ErrUserNotFound)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/johnjansen/buffkit/readonly"
+)
+
+// ErrResetTokenInvalid is returned for a password reset token that's
+// unknown, already used, or expired.
+var ErrResetTokenInvalid = NotFoundError("password reset link is invalid or has expired")
+
+// ResetTokenStore is a UserStore that keeps a password reset token for
+// each user, in the users table's password_reset_token and
+// password_reset_sent_at columns. Only the token's hash
+// (HashResetToken) is stored, so the stored tokens can't be used to
+// reset passwords.
+type ResetTokenStore interface {
+	UserStore
+	// SetResetToken saves the hash of the user's reset token and when it
+	// was sent, replacing any earlier one. An empty hash clears it.
+	SetResetToken(ctx context.Context, userID, hash string, sentAt time.Time) error
+	// ByResetToken returns the user whose reset token has hash, and when
+	// it was sent. It returns ErrUserNotFound if no user has it.
+	ByResetToken(ctx context.Context, hash string) (*User, time.Time, error)
+}
+
+// resetToken is a user's password reset token in the memory store.
+type resetToken struct {
+	hash   string
+	sentAt time.Time
+}
+
+// NewResetToken creates a password reset token for userID, replacing
+// any earlier one, stores its hash as sent at now, and returns the token
+// for the link.
+func NewResetToken(ctx context.Context, store ResetTokenStore, userID string, now time.Time) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("auth: reset token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := store.SetResetToken(ctx, userID, HashResetToken(token), now); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetTokenUser returns the user token resets the password of, or
+// ErrResetTokenInvalid if it's unknown, was sent ttl or more before now,
+// or the user is deactivated.
+func ResetTokenUser(ctx context.Context, store ResetTokenStore, token string, now time.Time, ttl time.Duration) (*User, error) {
+	if token == "" {
+		return nil, ErrResetTokenInvalid
+	}
+	user, sentAt, err := store.ByResetToken(ctx, HashResetToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if now.Sub(sentAt) >= ttl || user.DeactivatedAt != nil {
+		return nil, ErrResetTokenInvalid
+	}
+	return user, nil
+}
+
+// HashResetToken returns the hash a ResetTokenStore keeps for token.
+func HashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *MemoryStore) SetResetToken(ctx context.Context, userID, hash string, sentAt time.Time) error {
+	if err := readonly.Check("auth.SetResetToken"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := m.ByID(ctx, userID); err != nil {
+		return err
+	}
+	if hash == "" {
+		delete(m.resetTokens, userID)
+		return nil
+	}
+	if m.resetTokens == nil {
+		m.resetTokens = make(map[string]resetToken)
+	}
+	m.resetTokens[userID] = resetToken{hash: hash, sentAt: sentAt}
+	return nil
+}
+
+func (m *MemoryStore) ByResetToken(ctx context.Context, hash string) (*User, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+	for userID, t := range m.resetTokens {
+		if t.hash == hash {
+			user, err := m.ByID(ctx, userID)
+			return user, t.sentAt, err
+		}
+	}
+	return nil, time.Time{}, ErrUserNotFound
+}
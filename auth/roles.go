@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/johnjansen/buffkit/readonly"
+)
+
+// RoleAdmin is the role buffalo task buffkit:users:promote gives by
+// default.
+const RoleAdmin = "admin"
+
+// RoleStore is a UserStore that keeps a role for each user, such as
+// RoleAdmin, in User.Role.
+type RoleStore interface {
+	UserStore
+	// SetRole changes the user's role; empty removes it.
+	SetRole(ctx context.Context, id, role string) error
+}
+
+// SetRole changes the user's role.
+func (m *MemoryStore) SetRole(ctx context.Context, id, role string) error {
+	if err := readonly.Check("auth.SetRole"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user, err := m.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.Role = role
+	return nil
+}
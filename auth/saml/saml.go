@@ -0,0 +1,171 @@
+// Package saml lets users log in through a SAML 2.0 identity provider
+// (Okta, Entra ID, ADFS, Shibboleth, ...), for deployments where OIDC
+// isn't available. It implements the service provider side of
+// SP-initiated SSO: a metadata endpoint to register with the identity
+// provider, a login route that redirects to it, and an assertion
+// consumer service (ACS) that validates the signed response and logs the
+// user in.
+//
+// Users are matched by email address, so an existing account is linked
+// on its first SAML login. With Config.CreateUsers, unknown users get an
+// account; otherwise they're refused.
+//
+// Wire mounts it at /saml (under MountPath and AuthPath) when
+// Config.SAML is set. To mount it yourself:
+//
+//	sp, err := saml.New(store, saml.Config{
+//	    RootURL:     "https://app.example.com",
+//	    IDPMetadata: metadataXML,
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	sp.Mount(app)
+//
+// Register RootURL + "/saml/metadata" with the identity provider, and link
+// to /saml/login from the login page.
+package saml
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Config configures the service provider.
+type Config struct {
+	// RootURL is the app's public base URL, e.g. "https://app.example.com".
+	// The metadata and ACS URLs the identity provider sees are built
+	// from it. Required.
+	RootURL string
+
+	// Path is where the SAML routes are mounted. Defaults to "/saml".
+	Path string
+
+	// EntityID identifies the app to the identity provider. Defaults to
+	// the metadata URL.
+	EntityID string
+
+	// IDPMetadata is the identity provider's metadata XML, as downloaded
+	// from its admin console. Its signing certificate is what assertions
+	// are checked against. Required.
+	IDPMetadata []byte
+
+	// Key and Certificate, when set, sign authentication requests and let
+	// the identity provider encrypt assertions. Key must be an RSA or
+	// ECDSA private key. Optional.
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+
+	// EmailAttribute names the assertion attribute holding the user's
+	// email. Empty tries the usual names ("email", "mail", and their URI
+	// forms) and then the NameID.
+	EmailAttribute string
+
+	// NameAttribute names the attribute holding the display name for new
+	// users. Empty tries "displayName", "name", "cn", and then the given
+	// and family names.
+	NameAttribute string
+
+	// CreateUsers creates an account the first time someone the identity
+	// provider vouches for logs in. Without it only existing users can
+	// log in through SAML.
+	CreateUsers bool
+}
+
+// SP is a SAML service provider for users in Store.
+type SP struct {
+	Store  auth.UserStore
+	Config Config
+
+	sp *gosaml.ServiceProvider
+}
+
+// New creates a service provider from cfg.
+func New(store auth.UserStore, cfg Config) (*SP, error) {
+	if cfg.Path == "" {
+		cfg.Path = "/saml"
+	}
+	root, err := url.Parse(strings.TrimSuffix(cfg.RootURL, "/"))
+	if err != nil || root.Scheme == "" || root.Host == "" {
+		return nil, fmt.Errorf("saml: RootURL must be an absolute URL, got %q", cfg.RootURL)
+	}
+	if len(cfg.IDPMetadata) == 0 {
+		return nil, errors.New("saml: IDPMetadata is required")
+	}
+	idp, err := samlsp.ParseMetadata(cfg.IDPMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("saml: parse IdP metadata: %w", err)
+	}
+
+	sp := &gosaml.ServiceProvider{
+		EntityID:          cfg.EntityID,
+		Key:               cfg.Key,
+		Certificate:       cfg.Certificate,
+		MetadataURL:       *root.JoinPath(cfg.Path, "metadata"),
+		AcsURL:            *root.JoinPath(cfg.Path, "acs"),
+		IDPMetadata:       idp,
+		AuthnNameIDFormat: gosaml.EmailAddressNameIDFormat,
+	}
+	if cfg.Key != nil {
+		if cfg.Certificate == nil {
+			return nil, errors.New("saml: Key needs a Certificate")
+		}
+		sp.SignatureMethod = signatureMethod(cfg.Key)
+	}
+	if sp.GetSSOBindingLocation(gosaml.HTTPRedirectBinding) == "" {
+		return nil, errors.New("saml: IdP metadata has no HTTP-Redirect SSO endpoint")
+	}
+
+	return &SP{Store: store, Config: cfg, sp: sp}, nil
+}
+
+// signatureMethod picks the SHA-256 signature method for key's type.
+func signatureMethod(key crypto.Signer) string {
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		return dsig.ECDSASHA256SignatureMethod
+	}
+	return dsig.RSASHA256SignatureMethod
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (s *SP) Routes() [][2]string {
+	return [][2]string{
+		{http.MethodGet, s.Config.Path + "/metadata"},
+		{http.MethodGet, s.Config.Path + "/login"},
+		{http.MethodPost, s.Config.Path + "/acs"},
+	}
+}
+
+// Mount adds the SAML routes to app.
+func (s *SP) Mount(app *buffalo.App) {
+	app.GET(s.Config.Path+"/metadata", s.Metadata)
+	app.GET(s.Config.Path+"/login", s.Login)
+	app.POST(s.Config.Path+"/acs", s.ACS)
+}
+
+// Metadata serves the service provider metadata XML to register with the
+// identity provider.
+func (s *SP) Metadata(c buffalo.Context) error {
+	body, err := xml.MarshalIndent(s.sp.Metadata(), "", "  ")
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	w := c.Response()
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	return err
+}
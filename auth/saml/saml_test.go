@@ -0,0 +1,239 @@
+package saml_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"html"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/auth/saml"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIDP is an identity provider that vouches for whoever Session says.
+type testIDP struct {
+	*gosaml.IdentityProvider
+	Session *gosaml.Session
+	sp      *gosaml.EntityDescriptor
+}
+
+func (p *testIDP) GetSession(http.ResponseWriter, *http.Request, *gosaml.IdpAuthnRequest) *gosaml.Session {
+	return p.Session
+}
+
+func (p *testIDP) GetServiceProvider(*http.Request, string) (*gosaml.EntityDescriptor, error) {
+	return p.sp, nil
+}
+
+func newIDP(t *testing.T) *testIDP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	p := &testIDP{Session: &gosaml.Session{
+		ID:             "session",
+		NameID:         "grace@example.com",
+		UserEmail:      "grace@example.com",
+		UserCommonName: "Grace Hopper",
+	}}
+	p.IdentityProvider = &gosaml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		Logger:                  logger.DefaultLogger,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.test", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.test", Path: "/sso"},
+		ServiceProviderProvider: p,
+		SessionProvider:         p,
+	}
+	return p
+}
+
+func newSAMLApp(t *testing.T, idp *testIDP, createUsers bool) *buffkittest.App {
+	t.Helper()
+	metadata, err := xml.Marshal(idp.Metadata())
+	require.NoError(t, err)
+
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{SAML: &saml.Config{
+			RootURL:     "https://app.test",
+			IDPMetadata: metadata,
+			CreateUsers: createUsers,
+		}},
+		Setup: func(app *buffalo.App) {
+			app.GET("/whoami", auth.RequireLogin(func(c buffalo.Context) error {
+				return c.Render(http.StatusOK, render.String(auth.GetUserSession(c)))
+			}))
+		},
+	})
+
+	res := app.Client().Get("/saml/metadata")
+	require.Equal(t, http.StatusOK, res.Code)
+	idp.sp = &gosaml.EntityDescriptor{}
+	require.NoError(t, xml.Unmarshal(res.Body.Bytes(), idp.sp))
+	return app
+}
+
+var formField = regexp.MustCompile(`name="(SAMLResponse|RelayState)" value="([^"]*)"`)
+
+// signIn starts a login with client and returns the form the identity
+// provider posts back to the ACS.
+func signIn(t *testing.T, idp *testIDP, client *buffkittest.Client, path string) url.Values {
+	t.Helper()
+	res := client.Get(path)
+	require.Equal(t, http.StatusFound, res.Code, res.Body.String())
+	location := res.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, "https://idp.test/sso?"), location)
+
+	rec := httptest.NewRecorder()
+	idp.ServeSSO(rec, httptest.NewRequest(http.MethodGet, location, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	form := url.Values{}
+	for _, m := range formField.FindAllStringSubmatch(rec.Body.String(), -1) {
+		form.Set(m[1], html.UnescapeString(m[2]))
+	}
+	require.NotEmpty(t, form.Get("SAMLResponse"))
+	return form
+}
+
+func TestMetadata(t *testing.T) {
+	idp := newIDP(t)
+	newSAMLApp(t, idp, false)
+
+	assert.Equal(t, "https://app.test/saml/metadata", idp.sp.EntityID)
+	require.Len(t, idp.sp.SPSSODescriptors, 1)
+	acs := idp.sp.SPSSODescriptors[0].AssertionConsumerServices
+	require.NotEmpty(t, acs)
+	assert.Equal(t, "https://app.test/saml/acs", acs[0].Location)
+}
+
+func TestLogin(t *testing.T) {
+	t.Run("creates a user", func(t *testing.T) {
+		idp := newIDP(t)
+		app := newSAMLApp(t, idp, true)
+		client := app.Client()
+
+		res := client.Post("/saml/acs", signIn(t, idp, client, "/saml/login?return_to=/dashboard"))
+		buffkittest.AssertRedirect(t, res, "/dashboard")
+
+		user, err := app.Kit.AuthStore.ByEmail(context.Background(), "grace@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "Grace Hopper", user.DisplayName)
+		assert.NotNil(t, user.EmailVerifiedAt)
+
+		res = client.Get("/whoami")
+		assert.Equal(t, "grace@example.com", res.Body.String())
+	})
+
+	t.Run("links an existing user", func(t *testing.T) {
+		idp := newIDP(t)
+		app := newSAMLApp(t, idp, false)
+		require.NoError(t, app.Kit.AuthStore.Create(context.Background(), &auth.User{Email: "grace@example.com"}))
+		client := app.Client()
+
+		// RequireLogin's saved page wins, as with the password form
+		res := client.Get("/whoami")
+		require.Equal(t, http.StatusSeeOther, res.Code)
+
+		res = client.Post("/saml/acs", signIn(t, idp, client, "/saml/login"))
+		buffkittest.AssertRedirect(t, res, "/whoami/")
+		res = client.Get("/whoami")
+		assert.Equal(t, "grace@example.com", res.Body.String())
+	})
+
+	t.Run("refuses unknown users", func(t *testing.T) {
+		idp := newIDP(t)
+		app := newSAMLApp(t, idp, false)
+		client := app.Client()
+
+		res := client.Post("/saml/acs", signIn(t, idp, client, "/saml/login"))
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		res = client.Get("/whoami")
+		assert.Equal(t, http.StatusSeeOther, res.Code)
+	})
+
+	t.Run("refuses deactivated users", func(t *testing.T) {
+		idp := newIDP(t)
+		app := newSAMLApp(t, idp, true)
+		now := time.Now()
+		require.NoError(t, app.Kit.AuthStore.Create(context.Background(),
+			&auth.User{Email: "grace@example.com", DeactivatedAt: &now}))
+		client := app.Client()
+
+		res := client.Post("/saml/acs", signIn(t, idp, client, "/saml/login"))
+		assert.Equal(t, http.StatusForbidden, res.Code)
+	})
+}
+
+func TestRejectsBadResponses(t *testing.T) {
+	idp := newIDP(t)
+	app := newSAMLApp(t, idp, true)
+
+	t.Run("tampered", func(t *testing.T) {
+		client := app.Client()
+		form := signIn(t, idp, client, "/saml/login")
+		raw, err := base64.StdEncoding.DecodeString(form.Get("SAMLResponse"))
+		require.NoError(t, err)
+		forged := strings.ReplaceAll(string(raw), "grace@example.com", "admin@example.com")
+		form.Set("SAMLResponse", base64.StdEncoding.EncodeToString([]byte(forged)))
+
+		res := client.Post("/saml/acs", form)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+		_, err = app.Kit.AuthStore.ByEmail(context.Background(), "admin@example.com")
+		assert.ErrorIs(t, err, auth.ErrUserNotFound)
+	})
+
+	t.Run("not started by this browser", func(t *testing.T) {
+		form := signIn(t, idp, app.Client(), "/saml/login")
+		res := app.Client().Post("/saml/acs", form)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		client := app.Client()
+		form := signIn(t, idp, client, "/saml/login")
+		res := client.Post("/saml/acs", form)
+		require.Equal(t, http.StatusSeeOther, res.Code)
+
+		res = client.Post("/saml/acs", form)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+	})
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	_, err := saml.New(auth.NewMemoryStore(), saml.Config{RootURL: "app.test", IDPMetadata: []byte("<x/>")})
+	assert.ErrorContains(t, err, "RootURL")
+
+	_, err = saml.New(auth.NewMemoryStore(), saml.Config{RootURL: "https://app.test"})
+	assert.ErrorContains(t, err, "IDPMetadata")
+}
@@ -0,0 +1,244 @@
+package saml
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+)
+
+// Errors returned, with 403, when a SAML login is refused.
+var (
+	ErrInvalidResponse = errors.New("saml: the identity provider's response is invalid")
+	ErrNoEmail         = errors.New("saml: the identity provider didn't send an email address")
+	ErrUnknownUser     = errors.New("saml: no account for this email address")
+	ErrDeactivated     = errors.New("saml: this account is deactivated")
+)
+
+// requestTTL is how long a login started at the identity provider may
+// take to come back to the ACS.
+const requestTTL = 10 * time.Minute
+
+// tracked is what Login remembers about an authentication request until
+// the response arrives.
+type tracked struct {
+	ID       string `json:"id"`
+	ReturnTo string `json:"return_to,omitempty"`
+}
+
+// Login redirects to the identity provider with an authentication request.
+// Where the user goes afterwards follows auth.AfterLogin: the page
+// RequireLogin saved, or a safe return_to query parameter.
+//
+// The request is tracked in its own short-lived cookie rather than the
+// session: the response comes back as a cross-site POST, which browsers
+// don't send the Lax session cookie with.
+func (s *SP) Login(c buffalo.Context) error {
+	req, err := s.sp.MakeAuthenticationRequest(
+		s.sp.GetSSOBindingLocation(gosaml.HTTPRedirectBinding),
+		gosaml.HTTPRedirectBinding, gosaml.HTTPPostBinding)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	relayState, err := randomToken()
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	redirect, err := req.Redirect(relayState, s.sp)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	value, err := json.Marshal(tracked{ID: req.ID, ReturnTo: auth.AfterLogin(c, c.Param("return_to"))})
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	http.SetCookie(c.Response(), s.cookie(relayState, base64.RawURLEncoding.EncodeToString(value), int(requestTTL.Seconds())))
+	return c.Redirect(http.StatusFound, redirect.String())
+}
+
+// ACS receives the identity provider's response, checks its signature,
+// audience, validity window, and that it answers a request this browser
+// started, then logs the user in.
+func (s *SP) ACS(c buffalo.Context) error {
+	r := c.Request()
+	if err := r.ParseForm(); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	var t tracked
+	relayState := r.PostForm.Get("RelayState")
+	if cookie, err := r.Cookie(s.cookieName(relayState)); err == nil && relayState != "" {
+		if raw, err := base64.RawURLEncoding.DecodeString(cookie.Value); err == nil {
+			_ = json.Unmarshal(raw, &t)
+		}
+		http.SetCookie(c.Response(), s.cookie(relayState, "", -1))
+	}
+	var requestIDs []string
+	if t.ID != "" {
+		requestIDs = []string{t.ID}
+	}
+
+	assertion, err := s.sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		// The details say what was wrong with the response, which helps
+		// an attacker more than the user, so they only go to the log
+		var invalid *gosaml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			c.Logger().Warnf("saml: rejected response: %v", invalid.PrivateErr)
+		}
+		return c.Error(http.StatusForbidden, ErrInvalidResponse)
+	}
+
+	user, err := s.user(c, assertion)
+	if errors.Is(err, ErrNoEmail) || errors.Is(err, ErrUnknownUser) || errors.Is(err, ErrDeactivated) {
+		return c.Error(http.StatusForbidden, err)
+	}
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return auth.CompleteLogin(c, user, t.ReturnTo)
+}
+
+// user finds the user the assertion is about, creating them when
+// Config.CreateUsers allows.
+func (s *SP) user(ctx context.Context, assertion *gosaml.Assertion) (*auth.User, error) {
+	email := strings.ToLower(strings.TrimSpace(s.email(assertion)))
+	if !strings.Contains(email, "@") {
+		return nil, ErrNoEmail
+	}
+
+	user, err := s.Store.ByEmail(ctx, email)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		if !s.Config.CreateUsers {
+			return nil, ErrUnknownUser
+		}
+		user = &auth.User{Email: email, DisplayName: s.displayName(assertion)}
+		// The identity provider has vouched for the address
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := s.Store.Create(ctx, user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DeactivatedAt != nil {
+		return nil, ErrDeactivated
+	}
+	return user, nil
+}
+
+// Attribute names identity providers commonly use.
+var (
+	emailAttributes = []string{
+		"email", "mail", "emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	}
+	nameAttributes = []string{
+		"displayname", "name", "cn",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"urn:oid:2.5.4.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+	}
+	givenNameAttributes = []string{
+		"givenname", "firstname", "urn:oid:2.5.4.42",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+	}
+	familyNameAttributes = []string{
+		"sn", "surname", "lastname", "urn:oid:2.5.4.4",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+	}
+)
+
+// email is the configured email attribute, else a common one, else the
+// NameID when it looks like an address.
+func (s *SP) email(a *gosaml.Assertion) string {
+	if s.Config.EmailAttribute != "" {
+		return attribute(a, s.Config.EmailAttribute)
+	}
+	if v := attribute(a, emailAttributes...); v != "" {
+		return v
+	}
+	if a.Subject != nil && a.Subject.NameID != nil && strings.Contains(a.Subject.NameID.Value, "@") {
+		return a.Subject.NameID.Value
+	}
+	return ""
+}
+
+// displayName is the configured name attribute, else a common one, else
+// the given and family names.
+func (s *SP) displayName(a *gosaml.Assertion) string {
+	if s.Config.NameAttribute != "" {
+		return attribute(a, s.Config.NameAttribute)
+	}
+	if v := attribute(a, nameAttributes...); v != "" {
+		return v
+	}
+	given, family := attribute(a, givenNameAttributes...), attribute(a, familyNameAttributes...)
+	return strings.TrimSpace(given + " " + family)
+}
+
+// attribute returns the first value of the first attribute whose name or
+// friendly name matches one of names, ignoring case.
+func attribute(a *gosaml.Assertion, names ...string) string {
+	for _, name := range names {
+		for _, stmt := range a.AttributeStatements {
+			for _, attr := range stmt.Attributes {
+				if !strings.EqualFold(attr.Name, name) && !strings.EqualFold(attr.FriendlyName, name) {
+					continue
+				}
+				for _, v := range attr.Values {
+					if v := strings.TrimSpace(v.Value); v != "" {
+						return v
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// cookieName is the cookie tracking the request with relayState.
+func (s *SP) cookieName(relayState string) string {
+	return "saml_" + relayState
+}
+
+// cookie is the tracking cookie for relayState. Over HTTPS it's
+// SameSite=None so the identity provider's POST carries it.
+func (s *SP) cookie(relayState, value string, maxAge int) *http.Cookie {
+	secure := strings.HasPrefix(s.sp.AcsURL.Scheme, "https")
+	cookie := &http.Cookie{
+		Name:     s.cookieName(relayState),
+		Value:    value,
+		Path:     s.Config.Path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+	}
+	if secure {
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// randomToken returns a random URL-safe token for the relay state.
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
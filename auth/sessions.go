@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/geoip"
+	"github.com/johnjansen/buffkit/useragent"
+)
+
+// ErrSessionNotFound is returned for sessions that ended or never existed.
+var ErrSessionNotFound = NotFoundError("session not found")
+
+// sessionIDKey is the cookie session key holding the Session's ID.
+const sessionIDKey = "session_id"
+
+// Session is one login on one device. When the user store implements
+// SessionStore, every login starts one, so users can see where they're
+// logged in and log other devices out, and RequireLogin turns away
+// sessions that were ended.
+type Session struct {
+	ID         string         `json:"id" db:"id"`
+	UserID     string         `json:"user_id" db:"user_id"`
+	IP         string         `json:"ip" db:"ip"`
+	UserAgent  string         `json:"user_agent" db:"user_agent"`
+	Location   geoip.Location `json:"location"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time      `json:"last_seen_at" db:"last_seen_at"`
+}
+
+// Device describes the browser and operating system from the user
+// agent, such as "Chrome on macOS".
+func (s *Session) Device() string {
+	return s.DeviceInfo().String()
+}
+
+// DeviceInfo is what the session's user agent says about the device.
+func (s *Session) DeviceInfo() useragent.Info {
+	return useragent.Parse(s.UserAgent)
+}
+
+// Description is the device and, when known, where it is:
+// "Chrome on macOS — Berlin, DE".
+func (s *Session) Description() string {
+	if where := s.Location.String(); where != "" {
+		return s.Device() + " — " + where
+	}
+	return s.Device()
+}
+
+// SessionStore is a UserStore that keeps each login's Session.
+type SessionStore interface {
+	UserStore
+	CreateSession(ctx context.Context, s *Session) error
+	// Session returns ErrSessionNotFound for an ended session.
+	Session(ctx context.Context, id string) (*Session, error)
+	// UserSessions returns the user's sessions, most recently seen first.
+	UserSessions(ctx context.Context, userID string) ([]*Session, error)
+	TouchSession(ctx context.Context, id string, at time.Time) error
+	DeleteSession(ctx context.Context, id string) error
+}
+
+// LoginAttempt is a login by any method, successful or not, with where it
+// came from.
+type LoginAttempt struct {
+	Login     string // the email or username given
+	UserID    string // empty when the login failed
+	Success   bool
+	IP        string
+	UserAgent string
+	Location  geoip.Location
+	Device    useragent.Info
+	// NewDevice is set on a successful login from a browser and
+	// operating system none of the user's sessions has used. It's only
+	// known when the store keeps sessions, and a user's first login isn't
+	// new.
+	NewDevice bool
+	At        time.Time
+}
+
+var (
+	locator        geoip.Locator
+	loginAttempt   func(ctx context.Context, a LoginAttempt)
+	newDeviceLogin func(ctx context.Context, user *User, s *Session)
+)
+
+// UseLocator sets how login attempts and sessions are located. Wire calls
+// it with the database in Config.GeoIPDatabase. Nil leaves them without a
+// location.
+func UseLocator(l geoip.Locator) {
+	locator = l
+}
+
+// OnLoginAttempt sets a function called with every login attempt, for an
+// audit log. It replaces any earlier one; nil removes it. Attempts are
+// also logged through the request's logger.
+func OnLoginAttempt(fn func(ctx context.Context, a LoginAttempt)) {
+	loginAttempt = fn
+}
+
+// OnNewDevice sets a function called after a user logs in from a new
+// device, as LoginAttempt.NewDevice describes, with the Session it
+// started. Wire sets one that emails the user when
+// Config.NewDeviceAlerts is on. It replaces any earlier one; nil removes
+// it.
+func OnNewDevice(fn func(ctx context.Context, user *User, s *Session)) {
+	newDeviceLogin = fn
+}
+
+// locate returns where ip is, or an empty Location when no locator is set
+// or it can't tell.
+func locate(ip string) geoip.Location {
+	if locator == nil || ip == "" {
+		return geoip.Location{}
+	}
+	loc, err := locator.Locate(ip)
+	if err != nil {
+		return geoip.Location{}
+	}
+	return loc
+}
+
+// recordLoginAttempt logs the attempt and passes it to OnLoginAttempt's
+// function.
+func recordLoginAttempt(c buffalo.Context, login string, user *User, newDevice bool) {
+	r := c.Request()
+	a := LoginAttempt{
+		Login:     login,
+		Success:   user != nil,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Device:    useragent.Parse(r.UserAgent()),
+		NewDevice: newDevice,
+		At:        clock.Or(sessionTimeouts.Clock).Now(),
+	}
+	if user != nil {
+		a.UserID = user.ID
+		if a.Login == "" {
+			a.Login = user.Email
+		}
+	}
+	a.Location = locate(a.IP)
+
+	msg := "auth: login failed"
+	if a.Success {
+		msg = "auth: login succeeded"
+	}
+	c.Logger().WithFields(map[string]any{
+		"login":      a.Login,
+		"ip":         a.IP,
+		"location":   a.Location.String(),
+		"device":     a.Device.String(),
+		"new_device": a.NewDevice,
+	}).Info(msg)
+	if loginAttempt != nil {
+		loginAttempt(c, a)
+	}
+}
+
+// startSession records a Session for user's new login when the store
+// keeps them, reporting whether it's from a new device.
+func startSession(c buffalo.Context, user *User) (*Session, bool, error) {
+	store, ok := globalStore.(SessionStore)
+	if !ok {
+		return nil, false, nil
+	}
+	r := c.Request()
+	now := clock.Or(sessionTimeouts.Clock).Now()
+	s := &Session{
+		ID:         newSessionID(),
+		UserID:     user.ID,
+		IP:         clientIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	s.Location = locate(s.IP)
+
+	existing, err := store.UserSessions(c, user.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	newDevice := len(existing) > 0
+	device := s.DeviceInfo()
+	for _, e := range existing {
+		if e.DeviceInfo().SameDevice(device) {
+			newDevice = false
+			break
+		}
+	}
+
+	if err := store.CreateSession(c, s); err != nil {
+		return nil, false, err
+	}
+	c.Session().Set(sessionIDKey, s.ID)
+	return s, newDevice, nil
+}
+
+// CurrentSessionID returns the ID of the request's Session, or "" when
+// sessions aren't kept.
+func CurrentSessionID(c buffalo.Context) string {
+	id, _ := c.Session().Get(sessionIDKey).(string)
+	return id
+}
+
+// checkSession reports whether the request's Session is still live,
+// updating when it was last seen. Logins from before sessions were kept
+// have no Session and stay valid.
+func checkSession(c buffalo.Context) (bool, error) {
+	store, ok := globalStore.(SessionStore)
+	id := CurrentSessionID(c)
+	if !ok || id == "" {
+		return true, nil
+	}
+	s, err := store.Session(c, id)
+	if errors.Is(err, ErrSessionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// Throttled like the idle timeout, so every request doesn't write to
+	// the store
+	if now := clock.Or(sessionTimeouts.Clock).Now(); now.Sub(s.LastSeenAt) >= sessionTimeouts.touchInterval() {
+		if err := store.TouchSession(c, id, now); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// endSession deletes the request's Session, if any.
+func endSession(c buffalo.Context) {
+	if store, ok := globalStore.(SessionStore); ok {
+		if id := CurrentSessionID(c); id != "" {
+			_ = store.DeleteSession(c, id)
+		}
+	}
+	c.Session().Delete(sessionIDKey)
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// clientIP is the address the request came from: the first address in
+// X-Forwarded-For when behind a proxy, else the connection's.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func (m *MemoryStore) CreateSession(ctx context.Context, s *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	if m.sessions == nil {
+		m.sessions = make(map[string]*Session)
+	}
+	saved := *s
+	m.sessions[s.ID] = &saved
+	return nil
+}
+
+func (m *MemoryStore) Session(ctx context.Context, id string) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	found := *s
+	return &found, nil
+}
+
+func (m *MemoryStore) UserSessions(ctx context.Context, userID string) ([]*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	var out []*Session
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			found := *s
+			out = append(out, &found)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeenAt.After(out[j].LastSeenAt) })
+	return out, nil
+}
+
+func (m *MemoryStore) TouchSession(ctx context.Context, id string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	s.LastSeenAt = at
+	return nil
+}
+
+func (m *MemoryStore) DeleteSession(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// compile-time check that the memory store keeps sessions
+var _ SessionStore = (*MemoryStore)(nil)
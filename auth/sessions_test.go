@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/geoip"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chromeOnMac = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+
+func TestSessions(t *testing.T) {
+	app := loginApp(t)
+	app.GET("/private", RequireLogin(func(c buffalo.Context) error { return c.Render(http.StatusOK, render.String("ok")) }))
+	store := globalStore.(*MemoryStore)
+
+	UseLocator(geoip.Func(func(ip string) (geoip.Location, error) {
+		return geoip.Location{City: "Berlin", Country: "Germany", CountryCode: "DE"}, nil
+	}))
+	var attempts []LoginAttempt
+	OnLoginAttempt(func(ctx context.Context, a LoginAttempt) { attempts = append(attempts, a) })
+	t.Cleanup(func() { UseLocator(nil); OnLoginAttempt(nil) })
+
+	bad := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"wrong"}}.Encode(),
+		map[string]string{"X-Forwarded-For": "81.2.69.142, 10.0.0.1"})
+	assert.Equal(t, http.StatusUnprocessableEntity, bad.Code)
+	ok := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}.Encode(),
+		map[string]string{"User-Agent": chromeOnMac})
+	require.Equal(t, http.StatusSeeOther, ok.Code)
+
+	require.Len(t, attempts, 2)
+	assert.False(t, attempts[0].Success)
+	assert.Equal(t, "81.2.69.142", attempts[0].IP)
+	assert.Equal(t, "Berlin, DE", attempts[0].Location.String())
+	assert.True(t, attempts[1].Success)
+	assert.Equal(t, "ada@example.com", attempts[1].UserID)
+
+	sessions, err := store.UserSessions(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "Chrome on macOS — Berlin, DE", sessions[0].Description())
+
+	get := func(cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/private", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusOK, get(ok.Result().Cookies()).Code)
+
+	// Ending the session from elsewhere logs the device out
+	require.NoError(t, store.DeleteSession(context.Background(), sessions[0].ID))
+	res := get(ok.Result().Cookies())
+	assert.Equal(t, http.StatusSeeOther, res.Code)
+	assert.Equal(t, "/login", res.Header().Get("Location"))
+}
+
+func TestDeactivatedUserLoggedOut(t *testing.T) {
+	app := loginApp(t)
+	app.GET("/private", RequireLogin(func(c buffalo.Context) error { return c.Render(http.StatusOK, render.String("ok")) }))
+	store := globalStore.(*MemoryStore)
+
+	ok := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}.Encode(), nil)
+	require.Equal(t, http.StatusSeeOther, ok.Code)
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/private", nil)
+		for _, c := range ok.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusOK, get().Code)
+
+	// Deactivation alone logs the user out, even with their session kept
+	now := time.Now()
+	require.NoError(t, store.SetDeactivated(context.Background(), "ada@example.com", &now))
+	res := get()
+	assert.Equal(t, http.StatusSeeOther, res.Code)
+	assert.Equal(t, "/login", res.Header().Get("Location"))
+}
+
+func TestCleanupSessions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	UseSessionTimeouts(SessionTimeouts{Clock: clock.NewFake(now)})
+	t.Cleanup(func() { UseSessionTimeouts(SessionTimeouts{}) })
+	for _, s := range []*Session{
+		{ID: "old", UserID: "u", CreatedAt: now.Add(-48 * time.Hour), LastSeenAt: now},
+		{ID: "idle", UserID: "u", CreatedAt: now, LastSeenAt: now.Add(-2 * time.Hour)},
+		{ID: "live", UserID: "u", CreatedAt: now, LastSeenAt: now},
+	} {
+		require.NoError(t, store.CreateSession(ctx, s))
+	}
+
+	n, err := store.CleanupSessions(ctx, 24*time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = store.Session(ctx, "live")
+	assert.NoError(t, err)
+	_, err = store.Session(ctx, "old")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	require.NoError(t, store.Create(ctx, &User{ID: "u", Email: "ada@example.com"}))
+	require.NoError(t, readonly.Default.Enable(ctx, ""))
+	t.Cleanup(readonly.Default.Reset)
+
+	assert.ErrorIs(t, store.UpdatePassword(ctx, "u", "digest"), readonly.ErrReadOnly)
+	assert.ErrorIs(t, store.Create(ctx, &User{ID: "v", Email: "bob@example.com"}), readonly.ErrReadOnly)
+	_, err := store.ByEmail(ctx, "ada@example.com")
+	assert.NoError(t, err, "reads carry on")
+
+	now := time.Now()
+	require.NoError(t, store.CreateSession(ctx, &Session{ID: "s", UserID: "u", CreatedAt: now, LastSeenAt: now}), "users can still sign in")
+	assert.NoError(t, store.TouchSession(ctx, "s", now.Add(time.Minute)))
+	assert.NoError(t, store.DeleteSession(ctx, "s"))
+}
+
+func TestNewDevice(t *testing.T) {
+	app := loginApp(t)
+	var attempts []LoginAttempt
+	var alerted []*Session
+	OnLoginAttempt(func(ctx context.Context, a LoginAttempt) { attempts = append(attempts, a) })
+	OnNewDevice(func(ctx context.Context, user *User, s *Session) { alerted = append(alerted, s) })
+	t.Cleanup(func() { OnLoginAttempt(nil); OnNewDevice(nil) })
+
+	login := func(ua string) {
+		res := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}.Encode(),
+			map[string]string{"User-Agent": ua})
+		require.Equal(t, http.StatusSeeOther, res.Code)
+	}
+	login(chromeOnMac)
+	login(strings.Replace(chromeOnMac, "Chrome/126.0", "Chrome/127.0", 1))
+	login("Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1")
+
+	require.Len(t, attempts, 3)
+	assert.False(t, attempts[0].NewDevice, "the first login isn't new")
+	assert.False(t, attempts[1].NewDevice, "a browser update isn't new")
+	assert.True(t, attempts[2].NewDevice)
+	assert.Equal(t, "Safari on iOS", attempts[2].Device.String())
+	require.Len(t, alerted, 1)
+	assert.Equal(t, "Safari on iOS", alerted[0].Device())
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	clk := clock.NewFake(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	UseSessionTimeouts(SessionTimeouts{Idle: 30 * time.Minute, Absolute: 2 * time.Hour, Clock: clk})
+	t.Cleanup(func() { UseSessionTimeouts(SessionTimeouts{}) })
+
+	app := loginApp(t)
+	app.GET("/login", LoginFormHandler)
+	app.GET("/private", RequireLogin(func(c buffalo.Context) error { return c.Render(http.StatusOK, render.String("ok")) }))
+	store := globalStore.(*MemoryStore)
+
+	var cookies []*http.Cookie
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		// The last cookie sent wins, as in a browser
+		for _, set := range rec.Result().Cookies() {
+			cookies = slices.DeleteFunc(cookies, func(c *http.Cookie) bool { return c.Name == set.Name })
+			cookies = append(cookies, set)
+		}
+		return rec
+	}
+	login := func() {
+		res := postLogin(app, url.Values{"email": {"ada@example.com"}, "password": {"secret123"}}.Encode(), nil)
+		require.Equal(t, http.StatusSeeOther, res.Code)
+		cookies = res.Result().Cookies()
+	}
+
+	// Activity keeps an idle login going
+	login()
+	sessions, err := store.UserSessions(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, clk.Now(), sessions[0].CreatedAt, "the Session starts on the clock")
+	for range 3 {
+		clk.Advance(20 * time.Minute)
+		require.Equal(t, http.StatusOK, get("/private").Code)
+	}
+	sessions, err = store.UserSessions(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, clk.Now(), sessions[0].LastSeenAt, "the Session is touched too")
+
+	// ...until it's left alone
+	clk.Advance(31 * time.Minute)
+	res := get("/private")
+	assert.Equal(t, http.StatusSeeOther, res.Code)
+	assert.Equal(t, "/login", res.Header().Get("Location"))
+	_, err = store.Session(context.Background(), sessions[0].ID)
+	assert.ErrorIs(t, err, ErrSessionNotFound, "the timed out Session is ended")
+	page := get("/login")
+	assert.Contains(t, page.Body.String(), SessionExpiredMessage)
+	assert.Equal(t, http.StatusSeeOther, get("/private").Code, "logged out for good")
+
+	// However active, a login ends after the absolute timeout
+	login()
+	for range 5 {
+		clk.Advance(20 * time.Minute)
+		require.Equal(t, http.StatusOK, get("/private").Code)
+	}
+	clk.Advance(20 * time.Minute)
+	assert.Equal(t, http.StatusSeeOther, get("/private").Code)
+}
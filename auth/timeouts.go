@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/clock"
+)
+
+const (
+	// loginAtKey and seenAtKey are the cookie session keys holding when
+	// the login started and when it was last active, in Unix seconds.
+	loginAtKey = "login_at"
+	seenAtKey  = "seen_at"
+)
+
+// SessionExpiredMessage is the flash RequireLogin leaves, under
+// "warning", for users it sends back to the login form because their
+// login timed out.
+const SessionExpiredMessage = "Your session has expired. Please log in again."
+
+// SessionTimeouts limit how long a login lasts. Zero durations don't
+// limit it.
+type SessionTimeouts struct {
+	// Idle ends a login after this long without a request to a route
+	// behind RequireLogin. Each such request renews it.
+	Idle time.Duration
+
+	// Absolute ends a login this long after it started, however active
+	// the user is.
+	Absolute time.Duration
+
+	// TouchInterval is how stale the last activity may get before a
+	// request records it, in the session and in the user's Session when
+	// the store keeps them, so every request doesn't write. Defaults to
+	// a minute, or a tenth of Idle when that's shorter.
+	TouchInterval time.Duration
+
+	// Clock defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// touchInterval returns TouchInterval or its default.
+func (t SessionTimeouts) touchInterval() time.Duration {
+	if t.TouchInterval > 0 {
+		return t.TouchInterval
+	}
+	if t.Idle > 0 && t.Idle/10 < time.Minute {
+		return t.Idle / 10
+	}
+	return time.Minute
+}
+
+// What UseSessionTimeouts sets
+var sessionTimeouts SessionTimeouts
+
+// UseSessionTimeouts sets how long logins last. Wire calls it with
+// Config.SessionIdleTimeout and Config.SessionMaxAge.
+func UseSessionTimeouts(t SessionTimeouts) {
+	sessionTimeouts = t
+}
+
+// stampLogin records in the session that a login starts now.
+func stampLogin(c buffalo.Context) {
+	now := clock.Or(sessionTimeouts.Clock).Now().Unix()
+	c.Session().Set(loginAtKey, now)
+	c.Session().Set(seenAtKey, now)
+}
+
+// sessionExpired reports whether the request's login has timed out,
+// renewing its idle timeout when it hasn't. Logins from before the
+// timeouts were set are timed from their first request after.
+func sessionExpired(c buffalo.Context) bool {
+	t := sessionTimeouts
+	if t.Idle <= 0 && t.Absolute <= 0 {
+		return false
+	}
+	now := clock.Or(t.Clock).Now()
+	session := c.Session()
+
+	loginAt, ok := session.Get(loginAtKey).(int64)
+	if !ok {
+		loginAt = now.Unix()
+		session.Set(loginAtKey, loginAt)
+	}
+	seenAt, ok := session.Get(seenAtKey).(int64)
+	if !ok {
+		seenAt = now.Unix()
+	}
+
+	if t.Absolute > 0 && now.Sub(time.Unix(loginAt, 0)) >= t.Absolute {
+		return true
+	}
+	idle := now.Sub(time.Unix(seenAt, 0))
+	if t.Idle > 0 && idle >= t.Idle {
+		return true
+	}
+	if !ok || idle >= t.touchInterval() {
+		session.Set(seenAtKey, now.Unix())
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/johnjansen/buffkit/readonly"
+)
+
+// LoginIdentifier says what users may identify themselves with when
+// logging in.
+type LoginIdentifier string
+
+// Login identifiers for UseLoginIdentifier.
+const (
+	LoginWithEmail           LoginIdentifier = "email"
+	LoginWithUsername        LoginIdentifier = "username"
+	LoginWithEmailOrUsername LoginIdentifier = "email_or_username"
+)
+
+// Valid reports whether id is one of the LoginWith constants.
+func (id LoginIdentifier) Valid() bool {
+	switch id {
+	case LoginWithEmail, LoginWithUsername, LoginWithEmailOrUsername:
+		return true
+	}
+	return false
+}
+
+// AcceptsEmail reports whether users may log in with their email.
+func (id LoginIdentifier) AcceptsEmail() bool {
+	return id == LoginWithEmail || id == LoginWithEmailOrUsername
+}
+
+// AcceptsUsername reports whether users may log in with a username.
+func (id LoginIdentifier) AcceptsUsername() bool {
+	return id == LoginWithUsername || id == LoginWithEmailOrUsername
+}
+
+// What LoginHandler accepts
+var loginIdentifier = LoginWithEmail
+
+// UseLoginIdentifier sets what LoginHandler accepts; empty means
+// LoginWithEmail. Wire calls it with Config.LoginIdentifier.
+func UseLoginIdentifier(id LoginIdentifier) {
+	if id == "" {
+		id = LoginWithEmail
+	}
+	loginIdentifier = id
+}
+
+// CurrentLoginIdentifier returns what LoginHandler accepts.
+func CurrentLoginIdentifier() LoginIdentifier {
+	return loginIdentifier
+}
+
+// UsernameStore is a UserStore that also knows users by username, as
+// logging in with usernames needs. Usernames are stored normalized (see
+// NormalizeUsername).
+type UsernameStore interface {
+	UserStore
+	ByUsername(ctx context.Context, username string) (*User, error)
+	ExistsUsername(ctx context.Context, username string) (bool, error)
+	// UpdateUsername changes the user's username; empty removes it. It
+	// returns ErrUsernameTaken if another user has it.
+	UpdateUsername(ctx context.Context, id, username string) error
+}
+
+// Username limits.
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+)
+
+var (
+	// ErrUsernameTaken is returned when another user has the username.
+	ErrUsernameTaken = ConflictError("username already taken")
+
+	// ErrInvalidUsername is wrapped by ValidateUsername's errors.
+	ErrInvalidUsername = errors.New("invalid username")
+)
+
+// NormalizeUsername returns username as it's stored and looked up:
+// trimmed and lowercased.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// ValidateUsername checks a normalized username: 3 to 32 lowercase
+// letters, digits, '.', '_', or '-', starting with a letter or digit.
+// Without an '@' a username can never be mistaken for an email.
+func ValidateUsername(username string) error {
+	if len(username) < MinUsernameLength || len(username) > MaxUsernameLength {
+		return fmt.Errorf("%w: must be %d to %d characters", ErrInvalidUsername, MinUsernameLength, MaxUsernameLength)
+	}
+	for i, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case (r == '.' || r == '_' || r == '-') && i > 0:
+		default:
+			return fmt.Errorf("%w: use lowercase letters, digits, '.', '_', or '-', starting with a letter or digit", ErrInvalidUsername)
+		}
+	}
+	return nil
+}
+
+// lookupLogin finds the user for what was typed in the login form: an
+// email when it has an '@', otherwise a username, as far as the login
+// identifier allows.
+func lookupLogin(ctx context.Context, login string) (*User, error) {
+	if strings.Contains(login, "@") {
+		if !loginIdentifier.AcceptsEmail() {
+			return nil, ErrUserNotFound
+		}
+		return globalStore.ByEmail(ctx, login)
+	}
+	store, ok := globalStore.(UsernameStore)
+	if !ok || !loginIdentifier.AcceptsUsername() {
+		return nil, ErrUserNotFound
+	}
+	return store.ByUsername(ctx, NormalizeUsername(login))
+}
+
+func (m *MemoryStore) ByUsername(ctx context.Context, username string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, user := range m.users {
+		if user.Username != "" && user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (m *MemoryStore) ExistsUsername(ctx context.Context, username string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	_, err := m.ByUsername(ctx, username)
+	return err == nil, nil
+}
+
+func (m *MemoryStore) UpdateUsername(ctx context.Context, id, username string) error {
+	if err := readonly.Check("auth.UpdateUsername"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	user, err := m.ByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if other, err := m.ByUsername(ctx, username); err == nil && other != user {
+		return ErrUsernameTaken
+	}
+	user.Username = username
+	return nil
+}
@@ -0,0 +1,25 @@
+package buffkit
+
+import (
+	"fmt"
+	"time"
+)
+
+// BarcodeURL returns a signed link to an image of value as a barcode, for
+// emails, PDFs and other places a <bk-qr> or <bk-barcode> can't go.
+// image is the kind and format: qr.svg, qr.png, code128.svg or
+// code128.png:
+//
+//	src, err := buffkit.BarcodeURL("qr.png", ticket.URL, 30*24*time.Hour)
+//
+// The link stops working after expiry. Links are signed so the app
+// doesn't serve barcodes of anyone's choosing; for a different QR error
+// correction level or PNG scale, sign the level and scale parameters
+// along with value using SignURL. The value is in the link, so keep
+// secrets, such as two-factor enrollment keys, in <bk-qr> instead.
+func BarcodeURL(image, value string, expiry time.Duration) (string, error) {
+	if globalKit == nil || globalKit.Signer == nil {
+		return "", fmt.Errorf("buffkit: BarcodeURL called before Wire")
+	}
+	return SignURL(globalKit.Config.mountPath("/barcodes/"+image), expiry, map[string]string{"value": value})
+}
@@ -0,0 +1,176 @@
+// Package barcode draws QR codes and Code 128 barcodes on the server,
+// as SVG for pages and PNG for emails and PDFs. Pages usually use the
+// <bk-qr> and <bk-barcode> components (see components.RegisterBarcodes);
+// images elsewhere are served by Handler through signed links, so the
+// app doesn't become an open barcode service:
+//
+//	code, err := barcode.QR("https://example.com/tickets/42", barcode.M)
+//	svg := code.SVG(200)
+package barcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// Code is a drawn barcode: a grid of dark and light modules. A linear
+// barcode is a single row of bars.
+type Code struct {
+	// width and height are in modules, without the quiet zone.
+	width, height int
+
+	// rowHeight is how many modules tall each row is drawn: 1 for QR
+	// codes, the bars' height for linear barcodes.
+	rowHeight int
+
+	// quiet is the light margin scanners need, in modules. Linear
+	// barcodes only need it at the sides.
+	quiet int
+
+	dark []bool
+}
+
+// Size returns the code's width and height in modules, quiet zone
+// included.
+func (c *Code) Size() (width, height int) {
+	return c.width + 2*c.quiet, c.height*c.rowHeight + 2*c.quietY()
+}
+
+func (c *Code) quietY() int {
+	if c.rowHeight > 1 {
+		return 0
+	}
+	return c.quiet
+}
+
+// SVG returns the code as an SVG image. width sets its width in pixels,
+// with the height to scale; 0 leaves sizing to CSS.
+func (c *Code) SVG(width int) []byte {
+	w, h := c.Size()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d"`, w, h)
+	if width > 0 {
+		fmt.Fprintf(&b, ` width="%d" height="%d"`, width, width*h/w)
+	}
+	fmt.Fprintf(&b, ` shape-rendering="crispEdges"><rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, w, h)
+	for y := 0; y < c.height; y++ {
+		for x := 0; x < c.width; {
+			if !c.dark[y*c.width+x] {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < c.width && c.dark[y*c.width+x+run] {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv%dh-%dz", x+c.quiet, y*c.rowHeight+c.quietY(), run, c.rowHeight, run)
+			x += run
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.Bytes()
+}
+
+// PNG returns the code as a PNG image, scale pixels to a module.
+func (c *Code) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		return nil, fmt.Errorf("barcode: scale %d is less than 1", scale)
+	}
+	w, h := c.Size()
+	img := image.NewPaletted(image.Rect(0, 0, w*scale, h*scale), color.Palette{color.White, color.Black})
+	for y := 0; y < c.height; y++ {
+		for x := 0; x < c.width; x++ {
+			if !c.dark[y*c.width+x] {
+				continue
+			}
+			top := (y*c.rowHeight + c.quietY()) * scale
+			left := (x + c.quiet) * scale
+			for py := top; py < top+c.rowHeight*scale; py++ {
+				for px := left; px < left+scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Encode encodes value as the barcode kind names: "qr", at level, or
+// "code128".
+func Encode(kind, value string, level Level) (*Code, error) {
+	switch kind {
+	case "qr":
+		return QR(value, level)
+	case "code128":
+		return Code128(value)
+	}
+	return nil, fmt.Errorf("barcode: unknown kind %q", kind)
+}
+
+// maxScale caps the scale of PNGs Handler serves.
+const maxScale = 20
+
+// Handler serves barcode images through links signed by signer. Mount
+// it with the image's name as a parameter:
+//
+//	app.GET("/barcodes/{image}", barcode.Handler(signer))
+//
+// The image's name is the kind and format, such as qr.svg or
+// code128.png. The value query parameter is what to encode; level sets
+// a QR code's error correction and scale a PNG's pixels per module.
+// Links that aren't validly signed are refused, as by
+// secure.SignedURLMiddleware.
+func Handler(signer *secure.URLSigner) buffalo.Handler {
+	return secure.SignedURLMiddleware(signer)(serve)
+}
+
+func serve(c buffalo.Context) error {
+	kind, format, _ := strings.Cut(c.Param("image"), ".")
+	if kind != "qr" && kind != "code128" || format != "svg" && format != "png" {
+		return c.Error(http.StatusNotFound, fmt.Errorf("barcode: no image %q", c.Param("image")))
+	}
+	level, err := ParseLevel(c.Param("level"))
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	code, err := Encode(kind, c.Param("value"), level)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	// The link's signature pins what it shows, so it can be cached
+	c.Response().Header().Set("Cache-Control", "private, max-age=86400")
+	if format == "svg" {
+		c.Response().Header().Set("Content-Type", "image/svg+xml")
+		c.Response().WriteHeader(http.StatusOK)
+		_, err = c.Response().Write(code.SVG(0))
+		return err
+	}
+	scale := 8
+	if s := c.Param("scale"); s != "" {
+		if scale, err = strconv.Atoi(s); err != nil || scale < 1 || scale > maxScale {
+			return c.Error(http.StatusBadRequest, fmt.Errorf("barcode: scale must be 1 to %d", maxScale))
+		}
+	}
+	b, err := code.PNG(scale)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Content-Type", "image/png")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = c.Response().Write(b)
+	return err
+}
@@ -0,0 +1,294 @@
+package barcode
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapacity(t *testing.T) {
+	// Byte mode capacities from ISO/IEC 18004 table 7, by version and
+	// level L, M, Q, H
+	want := map[int][4]int{
+		1:  {17, 14, 11, 7},
+		2:  {32, 26, 20, 14},
+		3:  {53, 42, 32, 24},
+		4:  {78, 62, 46, 34},
+		5:  {106, 84, 60, 44},
+		6:  {134, 106, 74, 58},
+		7:  {154, 122, 86, 64},
+		10: {271, 213, 151, 119},
+		40: {2953, 2331, 1663, 1273},
+	}
+	for version, capacities := range want {
+		for level, capacity := range capacities {
+			got := (8*dataCodewords(version, Level(level)) - 4 - countBits(version)) / 8
+			assert.Equal(t, capacity, got, "version %d level %d", version, level)
+		}
+	}
+	// Every version and level splits into whole blocks
+	for version := 1; version <= 40; version++ {
+		for level := L; level <= H; level++ {
+			assert.Greater(t, rawModules(version)/8/eccBlocks[level][version], eccPerBlock[level][version])
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD at 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, rsRemainder(data, rsDivisor(10)))
+}
+
+func TestPatterns(t *testing.T) {
+	assert.Equal(t, 0b111011111000100, formatBits(L, 0))
+	assert.Equal(t, 0b101010000010010, formatBits(M, 0))
+	assert.Equal(t, 0b011010101011111, formatBits(Q, 0))
+	assert.Equal(t, 0b001011010001001, formatBits(H, 0))
+	assert.Equal(t, 0b000111110010010100, versionBits(7))
+
+	assert.Nil(t, alignmentPositions(1))
+	assert.Equal(t, []int{6, 18}, alignmentPositions(2))
+	assert.Equal(t, []int{6, 22, 38}, alignmentPositions(7))
+	assert.Equal(t, []int{6, 26, 46, 66}, alignmentPositions(14))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPositions(32))
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, alignmentPositions(40))
+}
+
+// decode reads a QR code back: it checks the format information, removes
+// the mask, checks each block's error correction and returns the value.
+func decode(t *testing.T, code *Code) string {
+	t.Helper()
+	size := code.width
+	version := (size - 17) / 4
+	at := func(x, y int) bool { return code.dark[y*size+x] }
+
+	// The first copy of the format information, read as drawn
+	var format int
+	for _, p := range [][2]int{{0, 8}, {1, 8}, {2, 8}, {3, 8}, {4, 8}, {5, 8}, {7, 8}, {8, 8}, {8, 7}, {8, 5}, {8, 4}, {8, 3}, {8, 2}, {8, 1}, {8, 0}} {
+		format <<= 1
+		if at(p[0], p[1]) {
+			format |= 1
+		}
+	}
+	var level Level
+	mask := -1
+	for l := L; l <= H; l++ {
+		for m := 0; m < 8; m++ {
+			if formatBits(l, m) == format {
+				level, mask = l, m
+			}
+		}
+	}
+	require.NotEqual(t, -1, mask, "format information")
+
+	// Unmask and read the codewords
+	q := newQR(version)
+	q.drawFunctionPatterns(level)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			q.modules[y][x] = at(x, y)
+		}
+	}
+	q.applyMask(mask)
+	raw := rawModules(version) / 8
+	codewords := make([]byte, 0, raw)
+	var bits bitBuffer
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = size - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if !q.function[y][x] {
+					bits = append(bits, q.modules[y][x])
+				}
+			}
+		}
+	}
+	codewords = append(codewords, bits[:raw*8].bytes()...)
+
+	// Undo the interleaving and check every block's syndromes are zero
+	blocks := eccBlocks[level][version]
+	eccLen := eccPerBlock[level][version]
+	short := blocks - raw%blocks
+	shortLen := raw / blocks
+	all := make([][]byte, blocks)
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range all {
+			if i == shortLen-eccLen && j < short {
+				continue
+			}
+			all[j] = append(all[j], codewords[k])
+			k++
+		}
+	}
+	var data []byte
+	for _, block := range all {
+		alpha := byte(1)
+		for i := 0; i < eccLen; i++ {
+			var syndrome byte
+			for _, b := range block {
+				syndrome = gfMul(syndrome, alpha) ^ b
+			}
+			require.Zero(t, syndrome, "syndrome %d", i)
+			alpha = gfMul(alpha, 2)
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	// Byte mode, length, then the value
+	var stream bitBuffer
+	for _, b := range data {
+		stream.append(int(b), 8)
+	}
+	read := func(n int) int {
+		v := 0
+		for _, bit := range stream[:n] {
+			v <<= 1
+			if bit {
+				v |= 1
+			}
+		}
+		stream = stream[n:]
+		return v
+	}
+	require.Equal(t, 0b0100, read(4), "byte mode")
+	n := read(countBits(version))
+	value := make([]byte, n)
+	for i := range value {
+		value[i] = byte(read(8))
+	}
+	return string(value)
+}
+
+func TestQR(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		level   Level
+		version int
+	}{
+		{"", M, 1},
+		{"HELLO WORLD", Q, 1},
+		{"otpauth://totp/Acme:ada@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Acme", M, 5},
+		{"héllo wörld ✓", H, 3},
+		{strings.Repeat("0123456789", 30), H, 18},
+		{strings.Repeat("buffkit ", 200), L, 29},
+	} {
+		t.Run(fmt.Sprintf("%d-%d", len(tc.value), tc.level), func(t *testing.T) {
+			code, err := QR(tc.value, tc.level)
+			require.NoError(t, err)
+			assert.Equal(t, tc.version*4+17, code.width)
+			assert.Equal(t, tc.value, decode(t, code))
+		})
+	}
+
+	_, err := QR(strings.Repeat("x", 2954), L)
+	assert.ErrorIs(t, err, ErrTooLong)
+	_, err = QR("x", Level(7))
+	assert.Error(t, err)
+}
+
+func TestCode128(t *testing.T) {
+	seen := make(map[string]bool)
+	for i, p := range code128Patterns {
+		sum := 0
+		for _, w := range p {
+			sum += int(w - '0')
+		}
+		assert.Equal(t, 11, sum, "symbol %d", i)
+		assert.False(t, seen[p], "symbol %d repeats", i)
+		seen[p] = true
+	}
+
+	// Start B, P, J, J, 1, 2, 3, C, checksum, stop: 11 modules a symbol
+	// and 13 for the stop
+	code, err := Code128("PJJ123C")
+	require.NoError(t, err)
+	assert.Equal(t, 9*11+13, code.width)
+	w, h := code.Size()
+	assert.Equal(t, code.width+20, w)
+	assert.Equal(t, code128Height, h)
+	assert.True(t, code.dark[0], "starts with a bar")
+	assert.True(t, code.dark[code.width-1], "ends with a bar")
+
+	// Even digits pack two to a symbol
+	code, err = Code128("12345678")
+	require.NoError(t, err)
+	assert.Equal(t, 6*11+13, code.width)
+
+	_, err = Code128("")
+	assert.Error(t, err)
+	_, err = Code128("naïve")
+	assert.Error(t, err)
+}
+
+func TestImages(t *testing.T) {
+	code, err := QR("https://example.com", M)
+	require.NoError(t, err)
+
+	svg := string(code.SVG(200))
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 33 33" width="200" height="200"`), svg)
+	assert.Contains(t, svg, "M4 4h7v1h-7z", "top of the finder")
+	assert.Contains(t, string(code.SVG(0)), `viewBox="0 0 33 33" shape-rendering`, "sized by CSS")
+
+	b, err := code.PNG(3)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, 99, img.Bounds().Dx())
+	r, _, _, _ := img.At(12, 12).RGBA()
+	assert.Zero(t, r, "finder is dark")
+	r, _, _, _ = img.At(0, 0).RGBA()
+	assert.NotZero(t, r, "quiet zone is light")
+	_, err = code.PNG(0)
+	assert.Error(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	signer := secure.NewURLSigner([]byte("test-secret"))
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/barcodes/{image}", Handler(signer))
+	get := func(path string, claims map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		link, err := signer.Sign(path, time.Now().Add(time.Hour), claims)
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+		return rec
+	}
+
+	rec := get("/barcodes/qr.svg", map[string]string{"value": "https://example.com", "level": "H"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `viewBox="0 0 37 37"`, "version 3 at level H")
+
+	rec = get("/barcodes/code128.png", map[string]string{"value": "SHIP-1", "scale": "2"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+
+	assert.Equal(t, http.StatusNotFound, get("/barcodes/qr.gif", map[string]string{"value": "x"}).Code)
+	assert.Equal(t, http.StatusNotFound, get("/barcodes/ean.svg", map[string]string{"value": "x"}).Code)
+	assert.Equal(t, http.StatusBadRequest, get("/barcodes/qr.png", map[string]string{"value": "x", "scale": "500"}).Code)
+	assert.Equal(t, http.StatusBadRequest, get("/barcodes/code128.svg", map[string]string{"value": "naïve"}).Code)
+
+	// Unsigned links are refused
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/barcodes/qr.svg?value=phish", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
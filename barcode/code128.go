@@ -0,0 +1,83 @@
+package barcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// code128Patterns are the bar and space widths of Code 128's symbols,
+// by value. 103, 104 and 105 start code sets A, B and C.
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232",
+}
+
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = "2331112"
+)
+
+// code128Height is the height of Code 128 bars, in modules.
+const code128Height = 40
+
+// Code128 encodes value as a Code 128 barcode, the linear barcode most
+// shipping labels, tickets and stock systems read. value may hold
+// printable ASCII only. All-digit values of even length are packed two
+// digits to a symbol, which makes them half as wide.
+func Code128(value string) (*Code, error) {
+	if value == "" {
+		return nil, errors.New("barcode: Code 128 needs a value")
+	}
+	digits := len(value)%2 == 0
+	for _, r := range value {
+		if r < ' ' || r > '~' {
+			return nil, fmt.Errorf("barcode: Code 128 can't encode %q", r)
+		}
+		if r < '0' || r > '9' {
+			digits = false
+		}
+	}
+
+	var symbols []int
+	if digits {
+		symbols = append(symbols, code128StartC)
+		for i := 0; i < len(value); i += 2 {
+			symbols = append(symbols, int(value[i]-'0')*10+int(value[i+1]-'0'))
+		}
+	} else {
+		symbols = append(symbols, code128StartB)
+		for i := 0; i < len(value); i++ {
+			symbols = append(symbols, int(value[i]-' '))
+		}
+	}
+	checksum := symbols[0]
+	for i, s := range symbols[1:] {
+		checksum += (i + 1) * s
+	}
+	symbols = append(symbols, checksum%103)
+
+	code := &Code{height: 1, quiet: 10, rowHeight: code128Height}
+	bars := func(widths string) {
+		for i, w := range widths {
+			for n := 0; n < int(w-'0'); n++ {
+				code.dark = append(code.dark, i%2 == 0)
+			}
+		}
+	}
+	for _, s := range symbols {
+		bars(code128Patterns[s])
+	}
+	bars(code128Stop)
+	code.width = len(code.dark)
+	return code, nil
+}
@@ -0,0 +1,32 @@
+package buffkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBarcodeURL(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret"), MountPath: "/kit"})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	link, err := BarcodeURL("qr.png", "https://example.com/tickets/42", time.Hour)
+	require.NoError(t, err)
+	assert.Contains(t, link, "/kit/barcodes/qr.png?")
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kit/barcodes/qr.png?value=phish", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
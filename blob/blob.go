@@ -0,0 +1,122 @@
+// Package blob stores files for the rest of Buffkit: export and PDF
+// downloads, import uploads and mail attachments all go through a
+// Store, so moving them to object storage is one line of Config:
+//
+//	buffkit.Config{
+//	    Blobs: blob.NewS3("https://s3.eu-west-1.amazonaws.com", "eu-west-1", "acme-files", key, secret),
+//	}
+//
+// DirStore keeps files on local disk, S3Store in S3 or any store that
+// speaks its API (MinIO, R2, GCS through NewGCS), and MemoryStore in
+// memory for tests. Objects are private; Server hands them out through
+// signed, expiring links. Objects under TempPrefix are deleted once
+// they're DefaultTempMaxAge old (see Policy).
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get for a key with no object.
+var ErrNotFound = errors.New("blob: not found")
+
+// TempPrefix is where temporary objects go. Server's default policy
+// deletes them after DefaultTempMaxAge.
+const TempPrefix = "tmp/"
+
+// DefaultTempMaxAge is how long objects under TempPrefix are kept.
+const DefaultTempMaxAge = 24 * time.Hour
+
+// Store keeps objects by key. Keys are slash-separated paths of
+// letters, digits, '.', '-' and '_', such as "exports/3f2a.csv".
+type Store interface {
+	// Put writes the object at key, replacing any that's there.
+	// contentType may be empty to go by the key's extension.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+
+	// Get opens the object at key, or returns ErrNotFound. The caller
+	// closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, Info, error)
+
+	// Delete removes the object at key. A missing object isn't an error.
+	Delete(ctx context.Context, key string) error
+
+	// List returns the objects whose keys start with prefix.
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
+
+// Info describes an object.
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string // Empty in List results from S3Store
+	ModTime     time.Time
+}
+
+// Policy expires objects: those under Prefix are deleted by Prune once
+// they're older than MaxAge, like an S3 lifecycle rule.
+type Policy struct {
+	Prefix string
+	MaxAge time.Duration
+}
+
+// Prune deletes the objects in store that policies have expired as of
+// now, and returns how many it deleted.
+func Prune(ctx context.Context, store Store, now time.Time, policies ...Policy) (int, error) {
+	deleted := 0
+	for _, p := range policies {
+		if p.MaxAge <= 0 {
+			continue
+		}
+		objects, err := store.List(ctx, p.Prefix)
+		if err != nil {
+			return deleted, err
+		}
+		for _, o := range objects {
+			if now.Sub(o.ModTime) <= p.MaxAge {
+				continue
+			}
+			if err := store.Delete(ctx, o.Key); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// keyPattern matches valid keys, one segment at a time.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)*$`)
+
+// CheckKey returns an error if key isn't a valid key.
+func CheckKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("blob: invalid key %q", key)
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "." || seg == ".." {
+			return fmt.Errorf("blob: invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+// ContentType returns the content type of key by its extension.
+func ContentType(key string) string {
+	ext := path.Ext(key)
+	if ext == ".csv" {
+		return "text/csv; charset=utf-8"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
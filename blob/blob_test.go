@@ -0,0 +1,130 @@
+package blob_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/blob"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]blob.Store{
+		"memory": blob.NewMemoryStore(),
+		"dir":    blob.NewDirStore(t.TempDir()),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			require.NoError(t, store.Put(ctx, "exports/a.csv", strings.NewReader("id\n1\n"), ""))
+			require.NoError(t, store.Put(ctx, "exports/b.pdf", strings.NewReader("%PDF"), "application/pdf"))
+			require.NoError(t, store.Put(ctx, "tmp/imports/c.csv", strings.NewReader("x"), ""))
+			require.NoError(t, store.Put(ctx, "exports/a.csv", strings.NewReader("id\n2\n"), ""), "Put replaces")
+
+			r, info, err := store.Get(ctx, "exports/a.csv")
+			require.NoError(t, err)
+			data, _ := io.ReadAll(r)
+			_ = r.Close()
+			assert.Equal(t, "id\n2\n", string(data))
+			assert.Equal(t, int64(5), info.Size)
+			assert.Equal(t, "text/csv; charset=utf-8", info.ContentType)
+			assert.False(t, info.ModTime.IsZero())
+
+			objects, err := store.List(ctx, "exports/")
+			require.NoError(t, err)
+			var keys []string
+			for _, o := range objects {
+				keys = append(keys, o.Key)
+			}
+			assert.ElementsMatch(t, []string{"exports/a.csv", "exports/b.pdf"}, keys)
+
+			require.NoError(t, store.Delete(ctx, "exports/a.csv"))
+			require.NoError(t, store.Delete(ctx, "exports/a.csv"), "deleting a missing object is fine")
+			_, _, err = store.Get(ctx, "exports/a.csv")
+			assert.ErrorIs(t, err, blob.ErrNotFound)
+
+			for _, key := range []string{"", "/etc/passwd", "../secrets", "a//b", "a/../b", "with space.txt", "trailing/"} {
+				assert.Error(t, store.Put(ctx, key, strings.NewReader("x"), ""), key)
+			}
+		})
+	}
+}
+
+func TestDirStoreLeavesNothingOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	store := blob.NewDirStore(dir)
+	err := store.Put(context.Background(), "exports/a.csv", io.MultiReader(strings.NewReader("partial"), failingReader{}), "")
+	require.Error(t, err)
+	entries, _ := os.ReadDir(filepath.Join(dir, "exports"))
+	assert.Empty(t, entries)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("disk on fire") }
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+	store := blob.NewMemoryStore()
+	store.Clock = clk
+	require.NoError(t, store.Put(ctx, "tmp/old.csv", strings.NewReader("x"), ""))
+	require.NoError(t, store.Put(ctx, "invoices/old.pdf", strings.NewReader("x"), ""))
+	clk.Advance(blob.DefaultTempMaxAge)
+	require.NoError(t, store.Put(ctx, "tmp/new.csv", strings.NewReader("x"), ""))
+	clk.Advance(time.Minute)
+
+	server := blob.NewServer(store, secure.NewURLSigner([]byte("secret")))
+	server.Clock = clk
+	count, err := server.Prune(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	objects, _ := store.List(ctx, "")
+	require.Len(t, objects, 2)
+	assert.Equal(t, "invoices/old.pdf", objects[0].Key, "only temporary objects expire by default")
+	assert.Equal(t, "tmp/new.csv", objects[1].Key)
+}
+
+func TestServer(t *testing.T) {
+	store := blob.NewMemoryStore()
+	require.NoError(t, store.Put(context.Background(), "invoices/2026/42.pdf", strings.NewReader("%PDF-1.7"), ""))
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Blobs: store},
+		Setup:  func(*buffalo.App) {},
+	})
+	require.NotNil(t, app.Kit.Blobs)
+	require.Same(t, store, app.Kit.Blobs.Store)
+
+	link, err := app.Kit.Blobs.URL("invoices/2026/42.pdf", "invoice-42.pdf", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	res := app.Client().Get(link)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	assert.Equal(t, "%PDF-1.7", res.Body.String())
+	assert.Equal(t, "application/pdf", res.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=invoice-42.pdf`, res.Header().Get("Content-Disposition"))
+
+	res = app.Client().Get(strings.Replace(link, "42.pdf", "43.pdf", 1))
+	assert.Equal(t, http.StatusForbidden, res.Code, "the link is signed")
+	res = app.Client().Get("/blobs/invoices/2026/42.pdf")
+	assert.Equal(t, http.StatusForbidden, res.Code, "objects are private")
+
+	link, err = app.Kit.Blobs.URL("invoices/2026/43.pdf", "", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, app.Client().Get(link).Code)
+	link, err = app.Kit.Blobs.URL("invoices/2026/42.pdf", "", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGone, app.Client().Get(link).Code)
+}
@@ -0,0 +1,136 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/johnjansen/buffkit/readonly"
+)
+
+// DirStore keeps objects as files under Dir, at their keys. Content
+// types go by the keys' extensions. The worker and the web process must
+// both see Dir.
+type DirStore struct {
+	Dir string
+}
+
+// NewDirStore creates a DirStore in dir.
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{Dir: dir}
+}
+
+// tempPrefix starts the names of files being written, which List skips.
+const tempPrefix = ".put-"
+
+// Put writes r to a temporary file and renames it into place, so
+// readers never see half an object and a failed write leaves nothing.
+func (s *DirStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := readonly.Check("blob.Put"); err != nil {
+		return err
+	}
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("blob: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("blob: %w", err)
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("blob: put %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get opens the file at key. The returned file is an io.ReadSeeker.
+func (s *DirStore) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, Info{}, err
+	}
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, Info{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Info{}, fmt.Errorf("blob: get %s: %w", key, err)
+	}
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		_ = f.Close()
+		return nil, Info{}, ErrNotFound
+	}
+	return f, s.info(key, stat), nil
+}
+
+// Delete removes the file at key.
+func (s *DirStore) Delete(ctx context.Context, key string) error {
+	if err := readonly.Check("blob.Delete"); err != nil {
+		return err
+	}
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("blob: delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// List walks Dir for the files whose keys start with prefix.
+func (s *DirStore) List(ctx context.Context, prefix string) ([]Info, error) {
+	var objects []Info
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) || CheckKey(key) != nil {
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return nil // removed while walking
+		}
+		objects = append(objects, s.info(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("blob: list %s: %w", prefix, err)
+	}
+	return objects, nil
+}
+
+func (s *DirStore) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+func (s *DirStore) info(key string, stat fs.FileInfo) Info {
+	return Info{Key: key, Size: stat.Size(), ContentType: ContentType(key), ModTime: stat.ModTime()}
+}
@@ -0,0 +1,101 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/readonly"
+)
+
+// MemoryStore keeps objects in memory, for tests and development.
+type MemoryStore struct {
+	// Clock stamps objects' ModTime. Defaults to clock.Real.
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info Info
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]memoryObject)}
+}
+
+// Put reads r into memory.
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := readonly.Check("blob.Put"); err != nil {
+		return err
+	}
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("blob: put %s: %w", key, err)
+	}
+	if contentType == "" {
+		contentType = ContentType(key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{data: data, info: Info{
+		Key:         key,
+		Size:        int64(len(data)),
+		ContentType: contentType,
+		ModTime:     clock.Or(s.Clock).Now(),
+	}}
+	return nil
+}
+
+// Get returns a reader over the object, which is an io.ReadSeeker.
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, Info{}, ErrNotFound
+	}
+	return readSeekNopCloser{bytes.NewReader(o.data)}, o.info, nil
+}
+
+// Delete removes the object.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	if err := readonly.Check("blob.Delete"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// List returns the objects under prefix, sorted by key.
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var objects []Info
+	for key, o := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, o.info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error { return nil }
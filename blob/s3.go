@@ -0,0 +1,337 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/readonly"
+)
+
+// S3Store keeps objects in an S3 bucket, or in any store with an
+// S3-compatible API such as MinIO, Cloudflare R2 or Google Cloud Storage.
+// Requests are signed with AWS Signature Version 4 and address the
+// bucket by path (Endpoint/Bucket/key), which every such store accepts.
+type S3Store struct {
+	// Endpoint is the API's URL, e.g. "https://s3.eu-west-1.amazonaws.com"
+	// or "http://localhost:9000" for MinIO.
+	Endpoint string
+
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// HTTPClient sends the requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Clock dates the request signatures. Defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// NewS3 creates an S3Store for bucket at endpoint.
+func NewS3(endpoint, region, bucket, accessKey, secretKey string) *S3Store {
+	return &S3Store{
+		Endpoint:  strings.TrimSuffix(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	}
+}
+
+// NewGCS creates a store for a Google Cloud Storage bucket through its
+// S3-compatible XML API, with an HMAC key made for a service account.
+func NewGCS(bucket, accessKey, secretKey string) *S3Store {
+	return NewS3("https://storage.googleapis.com", "auto", bucket, accessKey, secretKey)
+}
+
+// Put uploads r. It's spooled to a temporary file first, as S3 needs
+// the length and hash of the body before it's sent.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := readonly.Check("blob.Put"); err != nil {
+		return err
+	}
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	spool, err := os.CreateTemp("", "buffkit-blob-*")
+	if err != nil {
+		return fmt.Errorf("blob: put %s: %w", key, err)
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), r)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return fmt.Errorf("blob: put %s: %w", key, err)
+	}
+
+	if contentType == "" {
+		contentType = ContentType(key)
+	}
+	req, err := s.request(ctx, http.MethodPut, key, nil, io.NopCloser(spool), hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	res, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("blob: put %s: %w", key, err)
+	}
+	_ = res.Body.Close()
+	return nil
+}
+
+// Get downloads the object. The body streams from S3, so it isn't an
+// io.ReadSeeker.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, Info{}, err
+	}
+	req, err := s.request(ctx, http.MethodGet, key, nil, nil, emptyHash)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return nil, Info{}, fmt.Errorf("blob: get %s: %w", key, err)
+	}
+	info := Info{Key: key, Size: res.ContentLength, ContentType: res.Header.Get("Content-Type")}
+	info.ModTime, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+	return res.Body, info, nil
+}
+
+// Delete removes the object.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := readonly.Check("blob.Delete"); err != nil {
+		return err
+	}
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodDelete, key, nil, nil, emptyHash)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("blob: delete %s: %w", key, err)
+	}
+	_ = res.Body.Close()
+	return nil
+}
+
+// listResult is the part of a ListObjectsV2 response List reads.
+type listResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List pages through the bucket's objects under prefix.
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Info, error) {
+	var objects []Info
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		req, err := s.request(ctx, http.MethodGet, "", query, nil, emptyHash)
+		if err != nil {
+			return nil, err
+		}
+		res, err := s.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("blob: list %s: %w", prefix, err)
+		}
+		var page listResult
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		_ = res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("blob: list %s: %w", prefix, err)
+		}
+		for _, c := range page.Contents {
+			objects = append(objects, Info{Key: c.Key, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// emptyHash is the SHA-256 of an empty body.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// request builds a signed request for key in the bucket, or for the
+// bucket itself when key is empty.
+func (s *S3Store) request(ctx context.Context, method, key string, query url.Values, body io.ReadCloser, payloadHash string) (*http.Request, error) {
+	u := s.Endpoint + "/" + escapePath(s.Bucket)
+	if key != "" {
+		u += "/" + escapePath(key)
+	}
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("blob: %w", err)
+	}
+	if body != nil {
+		req.Body = body
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, payloadHash, "s3", s.Region, s.AccessKey, s.SecretKey, clock.Or(s.Clock).Now())
+	return req, nil
+}
+
+// do sends req, turning 404 into ErrNotFound and other failures into
+// errors carrying S3's message.
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	var body struct {
+		Code    string
+		Message string
+	}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if xml.Unmarshal(data, &body) != nil || body.Code == "" {
+		return nil, fmt.Errorf("%s", res.Status)
+	}
+	return nil, fmt.Errorf("%s: %s", body.Code, body.Message)
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to req,
+// covering its host and X-Amz-* headers.
+func signV4(req *http.Request, payloadHash, service, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexHash(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalQuery encodes query sorted by name, with every byte except
+// the unreserved characters percent-encoded.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapePath percent-encodes a key for a URL path, leaving its slashes.
+func escapePath(p string) string {
+	return uriEncode(p, false)
+}
+
+// uriEncode percent-encodes s as SigV4 expects: everything but letters,
+// digits, '-', '.', '_' and '~', and '/' too when encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
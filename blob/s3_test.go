@@ -0,0 +1,138 @@
+package blob
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case from AWS's Signature Version 4 test suite.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	signV4(req, emptyHash, "service", "us-east-1", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestURIEncode(t *testing.T) {
+	assert.Equal(t, "exports/a%20b.csv", escapePath("exports/a b.csv"))
+	assert.Equal(t, "a%2Fb~c", uriEncode("a/b~c", true))
+	assert.Equal(t, "a=1&b=x%2By&b=y", canonicalQuery(map[string][]string{"b": {"y", "x+y"}, "a": {"1"}}))
+}
+
+// fakeS3 is enough of the S3 API for S3Store: path-style object PUT,
+// GET and DELETE, and ListObjectsV2 in pages of one.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ak/") ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>Unsigned</Message></Error>")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/bucket":
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = string(data)
+		f.types[key] = r.Header.Get("Content-Type")
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[key])
+		_, _ = io.WriteString(w, data)
+	case r.Method == http.MethodDelete:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) && key > r.URL.Query().Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var page listResult
+	if len(keys) > 0 {
+		page.Contents = append(page.Contents, struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}{keys[0], int64(len(f.objects[keys[0]])), time.Now().UTC()})
+	}
+	if len(keys) > 1 {
+		page.IsTruncated = true
+		page.NextContinuationToken = keys[0]
+	}
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listResult
+	}{listResult: page})
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(&fakeS3{objects: map[string]string{}, types: map[string]string{}})
+	defer server.Close()
+	store := NewS3(server.URL+"/", "us-east-1", "bucket", "ak", "sk")
+
+	require.NoError(t, store.Put(ctx, "exports/a.csv", strings.NewReader("id\n1\n"), ""))
+	require.NoError(t, store.Put(ctx, "exports/b.pdf", strings.NewReader("%PDF"), ""))
+	require.NoError(t, store.Put(ctx, "tmp/c.csv", strings.NewReader("x"), ""))
+
+	r, info, err := store.Get(ctx, "exports/a.csv")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	assert.Equal(t, "id\n1\n", string(data))
+	assert.Equal(t, "text/csv; charset=utf-8", info.ContentType)
+
+	objects, err := store.List(ctx, "exports/")
+	require.NoError(t, err)
+	require.Len(t, objects, 2, "List follows continuation tokens")
+	assert.Equal(t, "exports/a.csv", objects[0].Key)
+	assert.Equal(t, int64(5), objects[0].Size)
+	assert.Equal(t, "exports/b.pdf", objects[1].Key)
+
+	require.NoError(t, store.Delete(ctx, "exports/a.csv"))
+	require.NoError(t, store.Delete(ctx, "exports/a.csv"))
+	_, _, err = store.Get(ctx, "exports/a.csv")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	store.AccessKey = "wrong"
+	err = store.Put(ctx, "exports/a.csv", strings.NewReader("x"), "")
+	assert.EqualError(t, err, "blob: put exports/a.csv: AccessDenied: Unsigned")
+}
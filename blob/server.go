@@ -0,0 +1,163 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// PruneTask is the job that applies Server.Policies.
+const PruneTask = "blob:prune"
+
+// Server serves private objects through signed links, and prunes
+// expired ones:
+//
+//	link, err := kit.Blobs.URL("invoices/42.pdf", "invoice-42.pdf", time.Now().Add(time.Hour))
+type Server struct {
+	Store  Store
+	Signer *secure.URLSigner
+
+	// Path is where Mount serves objects, with the key after it.
+	// Defaults to "/blobs".
+	Path string
+
+	// Policies expire objects; Prune applies them. Defaults to deleting
+	// objects under TempPrefix after DefaultTempMaxAge.
+	Policies []Policy
+
+	// Clock decides when links expire and objects are old. Defaults to
+	// clock.Real.
+	Clock clock.Clock
+}
+
+// NewServer creates a Server for store's objects, signing links with
+// signer.
+func NewServer(store Store, signer *secure.URLSigner) *Server {
+	return &Server{
+		Store:    store,
+		Signer:   signer,
+		Path:     "/blobs",
+		Policies: []Policy{{Prefix: TempPrefix, MaxAge: DefaultTempMaxAge}},
+	}
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (s *Server) Routes() [][2]string {
+	return [][2]string{{http.MethodGet, s.Path + "/{key:.+}"}}
+}
+
+// Mount serves objects at Path.
+func (s *Server) Mount(app *buffalo.App) {
+	app.GET(s.Path+"/{key:.+}", s.Handler)
+}
+
+// URL returns a link to the object at key that works until expires.
+// The object downloads as filename, or opens in the browser when
+// filename is empty.
+func (s *Server) URL(key, filename string, expires time.Time) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	var claims map[string]string
+	if filename != "" {
+		claims = map[string]string{"name": filename}
+	}
+	link, err := s.Signer.Sign(s.Path+"/"+key, expires, claims)
+	if err != nil {
+		return "", fmt.Errorf("blob: sign %s: %w", key, err)
+	}
+	return link, nil
+}
+
+// Handler serves the object to whoever has a valid link to it. Tampered
+// links get 403 and expired ones 410 Gone.
+func (s *Server) Handler(c buffalo.Context) error {
+	return secure.SignedURLMiddleware(s.Signer)(s.serve)(c)
+}
+
+func (s *Server) serve(c buffalo.Context) error {
+	var name string
+	if claims, ok := c.Value(secure.SignedClaimsKey).(map[string]string); ok {
+		name = claims["name"]
+	}
+	return Serve(c.Response(), c.Request(), s.Store, c.Param("key"), name)
+}
+
+// Serve writes the object at key to w, as an attachment named filename
+// unless that's empty. Objects that can seek answer range and
+// conditional requests.
+func Serve(w http.ResponseWriter, r *http.Request, store Store, key, filename string) error {
+	if CheckKey(key) != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	body, info, err := store.Get(r.Context(), key)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = ContentType(key)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", ContentDisposition(filename))
+	}
+	if rs, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, rs)
+		return nil
+	}
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// ContentDisposition returns the Content-Disposition header that
+// downloads a file as filename.
+func ContentDisposition(filename string) string {
+	if v := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return "attachment"
+}
+
+// Prune deletes the objects Policies have expired.
+func (s *Server) Prune(ctx context.Context) (int, error) {
+	return Prune(ctx, s.Store, clock.Or(s.Clock).Now(), s.Policies...)
+}
+
+// HandlePrune is the handler for PruneTask.
+func (s *Server) HandlePrune(ctx context.Context, t *asynq.Task) error {
+	count, err := s.Prune(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("Blob: Pruned %d expired objects", count)
+	}
+	return nil
+}
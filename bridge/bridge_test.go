@@ -0,0 +1,85 @@
+package bridge_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/bridge"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge(t *testing.T) {
+	ctx := context.Background()
+	runtime, err := jobs.NewRuntime(jobs.MemoryRedisURL)
+	require.NoError(t, err)
+	defer runtime.Shutdown()
+
+	var mu sync.Mutex
+	var payments []string
+	runtime.HandleFunc("payment:completed", func(ctx context.Context, task *asynq.Task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		payments = append(payments, string(task.Payload()))
+		return nil
+	})
+
+	transport := bridge.NewMemory()
+	b := bridge.New(transport, runtime)
+	require.NoError(t, b.Export("orders", "shop.orders"))
+	b.Import("payments.completed", "payment:completed")
+	require.NoError(t, runtime.Start())
+	require.NoError(t, b.Start())
+	defer func() { _ = b.Stop() }()
+
+	// Exports: jobs stream -> topic
+	id, err := runtime.Publish(ctx, "orders", map[string]int{"order": 42})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(transport.Messages()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	msg := transport.Messages()[0]
+	assert.Equal(t, "shop.orders", msg.Topic)
+	assert.Equal(t, id, string(msg.Key))
+	assert.JSONEq(t, `{"order": 42}`, string(msg.Data))
+
+	// Imports: topic -> job
+	require.NoError(t, transport.Publish(ctx, bridge.Message{Topic: "payments.completed", Data: []byte(`{"payment":7}`)}))
+	require.NoError(t, transport.Publish(ctx, bridge.Message{Topic: "payments.completed", Data: []byte("not json")}))
+	require.NoError(t, transport.Publish(ctx, bridge.Message{Topic: "payments.refunded", Data: []byte(`{}`)}))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(payments) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{`{"payment":7}`, `"not json"`}, payments)
+}
+
+func TestOpen(t *testing.T) {
+	transport, err := bridge.Open("kafka://kafka-1:9092,kafka-2:9092")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, transport.(*bridge.Kafka).Brokers)
+
+	transport, err = bridge.Open("memory://")
+	require.NoError(t, err)
+	assert.IsType(t, &bridge.Memory{}, transport)
+
+	for _, url := range []string{"kafka://", "amqp://rabbit:5672", "localhost:4222"} {
+		_, err := bridge.Open(url)
+		assert.Error(t, err, url)
+	}
+}
+
+func TestWire(t *testing.T) {
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{EventBridgeURL: "memory://"},
+		Jobs:   true,
+	})
+	require.NotNil(t, app.Kit.Bridge)
+	assert.IsType(t, &bridge.Memory{}, app.Kit.Bridge.Transport)
+	assert.Same(t, app.Kit.Jobs, app.Kit.Bridge.Jobs)
+}
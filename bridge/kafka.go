@@ -0,0 +1,106 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaRetryDelay is how long a Kafka subscriber waits before handling a
+// failed message again.
+const kafkaRetryDelay = 5 * time.Second
+
+// Kafka is a Transport over Kafka. Groups are consumer groups. A message
+// whose handler fails is retried until it succeeds, holding back the
+// rest of its partition, and its offset is committed after that.
+type Kafka struct {
+	Brokers []string
+
+	// Dialer connects subscribers, e.g. with TLS or SASL. Nil uses
+	// kafka.DefaultDialer.
+	Dialer *kafka.Dialer
+
+	// Transport connects the publisher, e.g. with TLS or SASL. Nil uses
+	// kafka.DefaultTransport.
+	Transport kafka.RoundTripper
+
+	once    sync.Once
+	writer  *kafka.Writer
+	readers sync.WaitGroup
+}
+
+// NewKafka creates a Transport for the cluster with brokers. It connects
+// when first used.
+func NewKafka(brokers []string) *Kafka {
+	return &Kafka{Brokers: brokers}
+}
+
+// Publish writes msg to its topic, partitioned by key.
+func (k *Kafka) Publish(ctx context.Context, msg Message) error {
+	k.once.Do(func() {
+		k.writer = &kafka.Writer{
+			Addr:                   kafka.TCP(k.Brokers...),
+			Balancer:               &kafka.Hash{},
+			Transport:              k.Transport,
+			AllowAutoTopicCreation: true,
+		}
+	})
+	return k.writer.WriteMessages(ctx, kafka.Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Data})
+}
+
+// Subscribe reads topic as a member of the consumer group until ctx is
+// done.
+func (k *Kafka) Subscribe(ctx context.Context, topic, group string, handle func(context.Context, Message) error) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: k.Brokers,
+		GroupID: group,
+		Topic:   topic,
+		Dialer:  k.Dialer,
+	})
+
+	k.readers.Add(1)
+	go func() {
+		defer k.readers.Done()
+		defer func() { _ = reader.Close() }()
+		for {
+			m, err := reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() == nil && !errors.Is(err, context.Canceled) {
+					log.Printf("Bridge: reading %s failed: %v", topic, err)
+				}
+				return
+			}
+			msg := Message{Topic: m.Topic, Key: m.Key, Data: m.Value}
+			for {
+				err := handle(ctx, msg)
+				if err == nil {
+					break
+				}
+				log.Printf("Bridge: %s message at offset %d failed, retrying in %s: %v", topic, m.Offset, kafkaRetryDelay, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(kafkaRetryDelay):
+				}
+			}
+			if err := reader.CommitMessages(ctx, m); err != nil && ctx.Err() == nil {
+				log.Printf("Bridge: committing %s offset %d failed: %v", topic, m.Offset, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close waits for subscribers whose context is done and closes the
+// publisher.
+func (k *Kafka) Close() error {
+	k.readers.Wait()
+	if k.writer != nil {
+		return k.writer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Memory is an in-process Transport for tests and development. Publish
+// hands each message to one subscriber per group, on the caller's
+// goroutine, and keeps a copy for Messages.
+type Memory struct {
+	mu        sync.Mutex
+	subs      []*memorySub
+	published []Message
+}
+
+type memorySub struct {
+	ctx    context.Context
+	topic  string
+	group  string
+	handle func(context.Context, Message) error
+}
+
+// NewMemory creates an empty in-process Transport.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Publish delivers msg to the topic's subscribers. Handler errors are
+// logged, as a real broker would leave them to the consumer.
+func (m *Memory) Publish(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	m.published = append(m.published, msg)
+	var targets []*memorySub
+	seen := make(map[string]bool)
+	for _, s := range m.subs {
+		if s.topic == msg.Topic && s.ctx.Err() == nil && !seen[s.group] {
+			seen[s.group] = true
+			targets = append(targets, s)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range targets {
+		if err := s.handle(s.ctx, msg); err != nil {
+			log.Printf("Bridge: %s message failed: %v", msg.Topic, err)
+		}
+	}
+	return nil
+}
+
+// Subscribe adds handle as a subscriber until ctx is done.
+func (m *Memory) Subscribe(ctx context.Context, topic, group string, handle func(context.Context, Message) error) error {
+	sub := &memorySub{ctx: ctx, topic: topic, group: group, handle: handle}
+	m.mu.Lock()
+	m.subs = append(m.subs, sub)
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, s := range m.subs {
+			if s == sub {
+				m.subs = append(m.subs[:i], m.subs[i+1:]...)
+				break
+			}
+		}
+	}()
+	return nil
+}
+
+// Messages returns every message published so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.published...)
+}
+
+// Close does nothing; Memory holds no connections.
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/nats-io/nats.go"
+)
+
+// KeyHeader carries a message's Key on NATS, which has no keys of its own.
+const KeyHeader = "Buffkit-Key"
+
+// NATS is a Transport over core NATS. Topics are subjects and groups are
+// queue groups. Core NATS doesn't redeliver, so a message whose handler
+// fails is logged and dropped.
+type NATS struct {
+	Conn *nats.Conn
+}
+
+// NewNATS connects to the NATS server at url. The connection retries in
+// the background, so the app starts while NATS is unreachable.
+func NewNATS(url string, opts ...nats.Option) (*NATS, error) {
+	opts = append([]nats.Option{nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1)}, opts...)
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("bridge: connect to NATS: %w", err)
+	}
+	return &NATS{Conn: conn}, nil
+}
+
+// Publish sends msg to its subject.
+func (n *NATS) Publish(ctx context.Context, msg Message) error {
+	m := nats.NewMsg(msg.Topic)
+	m.Data = msg.Data
+	if len(msg.Key) > 0 {
+		m.Header.Set(KeyHeader, string(msg.Key))
+	}
+	return n.Conn.PublishMsg(m)
+}
+
+// Subscribe joins the queue group for topic until ctx is done.
+func (n *NATS) Subscribe(ctx context.Context, topic, group string, handle func(context.Context, Message) error) error {
+	sub, err := n.Conn.QueueSubscribe(topic, group, func(m *nats.Msg) {
+		msg := Message{Topic: m.Subject, Key: []byte(m.Header.Get(KeyHeader)), Data: m.Data}
+		if err := handle(ctx, msg); err != nil {
+			log.Printf("Bridge: dropped %s message: %v", m.Subject, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = sub.Drain()
+	}()
+	return nil
+}
+
+// Close drains the subscriptions and closes the connection.
+func (n *NATS) Close() error {
+	return n.Conn.Drain()
+}
@@ -0,0 +1,264 @@
+// Package buffkittest provides helpers for testing apps built on Buffkit,
+// so they don't need their own scaffolding for databases, mail, and
+// sessions:
+//
+//	func TestDashboard(t *testing.T) {
+//	    app := buffkittest.NewApp(t, buffkittest.Options{
+//	        Setup: func(a *buffalo.App) {
+//	            a.GET("/dashboard", buffkit.RequireLogin(DashboardHandler))
+//	        },
+//	    })
+//
+//	    res := app.Client().Get("/dashboard")
+//	    buffkittest.AssertRedirect(t, res, "/login")
+//
+//	    res = buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com"}).Get("/dashboard")
+//	    buffkittest.AssertText(t, res.Body.String(), "Welcome back")
+//	}
+//
+// Wire installs some package-level state (the auth store, mail sender,
+// and views engine), so tests using NewApp shouldn't run in parallel.
+package buffkittest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/migrations"
+	_ "github.com/mattn/go-sqlite3" // in-memory test database
+)
+
+// Options configures NewApp.
+type Options struct {
+	// Config is the base Buffkit configuration. NewApp fills in a test
+	// AuthSecret and the in-memory database, and always uses the
+	// development mail sender, so mail is captured rather than sent.
+	Config buffkit.Config
+
+	// Clock overrides the fake clock NewApp installs; rarely needed.
+	// Config.Clock takes precedence if set.
+	Clock clock.Clock
+
+	// Jobs starts an in-process Redis (miniredis) and configures the
+	// jobs runtime against it, so enqueuing works without a real server.
+	Jobs bool
+
+	// NoDB skips the in-memory SQLite database.
+	NoDB bool
+
+	// Setup registers the app's own routes and middleware. It runs before
+	// Wire, because routes added afterwards are shadowed by Buffkit's
+	// asset server.
+	Setup func(app *buffalo.App)
+}
+
+// App is a wired Buffalo app for tests. Everything it starts is shut
+// down when the test finishes.
+type App struct {
+	*buffalo.App
+	Kit *buffkit.Kit
+
+	// DB is the in-memory SQLite database with Buffkit's migrations
+	// applied, or nil with Options.NoDB.
+	DB *sql.DB
+
+	// Redis is the in-process Redis behind the jobs runtime, or nil
+	// unless Options.Jobs is set.
+	Redis *miniredis.Miniredis
+
+	// Clock is the fake clock Buffkit runs on, starting at the real time.
+	// Advance it to expire signed links or trigger SSE heartbeats. Nil
+	// when Options.Clock or Config.Clock supplied a different clock.
+	Clock *clock.Fake
+
+	t testing.TB
+}
+
+var dbCounter atomic.Int64
+
+// NewApp builds a Buffalo app, wires Buffkit into it with test-friendly
+// defaults, and registers cleanup with t. It fails the test if anything
+// can't be set up.
+func NewApp(t testing.TB, opts Options) *App {
+	t.Helper()
+
+	cfg := opts.Config
+	if len(cfg.Secrets()) == 0 {
+		cfg.AuthSecret = []byte("buffkittest-secret")
+	}
+	cfg.SMTPAddr = ""
+
+	a := &App{t: t}
+
+	if cfg.Clock == nil {
+		cfg.Clock = opts.Clock
+	}
+	if cfg.Clock == nil {
+		a.Clock = clock.NewFake(time.Now())
+		cfg.Clock = a.Clock
+	}
+
+	if !opts.NoDB && cfg.DB == nil {
+		// A named shared-cache database, so every connection in the pool
+		// sees the same data, unique per app so tests don't share it
+		dsn := fmt.Sprintf("file:buffkittest%d?mode=memory&cache=shared", dbCounter.Add(1))
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			t.Fatalf("buffkittest: open database: %v", err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+
+		runner := migrations.NewRunner(db, buffkit.Migrations(), "sqlite")
+		if err := runner.Migrate(context.Background()); err != nil {
+			t.Fatalf("buffkittest: migrate: %v", err)
+		}
+		cfg.DB, cfg.Dialect = db, "sqlite"
+	}
+	a.DB = cfg.DB
+
+	if opts.Jobs {
+		a.Redis = miniredis.RunT(t)
+		cfg.RedisURL = "redis://" + a.Redis.Addr()
+	}
+
+	a.App = buffalo.New(buffalo.Options{Env: "test"})
+	if opts.Setup != nil {
+		opts.Setup(a.App)
+	}
+
+	kit, err := buffkit.Wire(a.App, cfg)
+	if err != nil {
+		t.Fatalf("buffkittest: wire: %v", err)
+	}
+	t.Cleanup(kit.Shutdown)
+	a.Kit = kit
+
+	return a
+}
+
+// Mail returns the messages sent so far, oldest first.
+func (a *App) Mail() []mail.Message {
+	if dev, ok := a.Kit.Mail.(*mail.DevSender); ok {
+		return dev.GetMessages()
+	}
+	return nil
+}
+
+// Mailbox returns the app's DevSender for queries such as LastTo, Find,
+// and AssertSentCount. It fails the test if the app sends real mail.
+func (a *App) Mailbox() *mail.DevSender {
+	a.t.Helper()
+	dev, ok := a.Kit.Mail.(*mail.DevSender)
+	if !ok {
+		a.t.Fatalf("buffkittest: app mail sender is %T, not *mail.DevSender", a.Kit.Mail)
+	}
+	return dev
+}
+
+// Client returns a client with no session, like a new visitor.
+func (a *App) Client() *Client {
+	return &Client{app: a, cookies: make(map[string]*http.Cookie)}
+}
+
+// loginCount numbers the sessions LoginAs records.
+var loginCount atomic.Int64
+
+// LoginAs returns a client logged in as user. The user is added to the
+// auth store if it isn't there yet; only Email is required.
+func LoginAs(t testing.TB, app *App, user *auth.User) *Client {
+	t.Helper()
+
+	ctx := context.Background()
+	stored, err := app.Kit.AuthStore.ByEmail(ctx, user.Email)
+	if err != nil {
+		if err := app.Kit.AuthStore.Create(ctx, user); err != nil {
+			t.Fatalf("buffkittest: create user %s: %v", user.Email, err)
+		}
+		stored = user
+	}
+
+	// Issue a session cookie exactly as the app's own store would
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, err := app.SessionStore.New(req, app.SessionName)
+	if err != nil {
+		t.Fatalf("buffkittest: new session: %v", err)
+	}
+	session.Values["user_id"] = user.Email
+
+	// Record the login as a device, as logging in through the form does
+	if store, ok := app.Kit.AuthStore.(auth.SessionStore); ok {
+		now := time.Now()
+		s := &auth.Session{
+			ID: fmt.Sprintf("buffkittest-%d", loginCount.Add(1)), UserID: stored.ID,
+			IP: "192.0.2.1", UserAgent: "buffkittest", CreatedAt: now, LastSeenAt: now,
+		}
+		if err := store.CreateSession(ctx, s); err != nil {
+			t.Fatalf("buffkittest: create session: %v", err)
+		}
+		session.Values["session_id"] = s.ID
+	}
+	if err := session.Save(req, rec); err != nil {
+		t.Fatalf("buffkittest: save session: %v", err)
+	}
+
+	client := app.Client()
+	client.keep(rec.Result().Cookies())
+	return client
+}
+
+// Client makes requests against an App, keeping cookies between requests
+// like a browser would.
+type Client struct {
+	app     *App
+	cookies map[string]*http.Cookie
+}
+
+// Do serves req and records the response. Cookies from earlier responses
+// are sent, and cookies set by this one are kept.
+func (c *Client) Do(req *http.Request) *httptest.ResponseRecorder {
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	c.app.ServeHTTP(rec, req)
+	c.keep(rec.Result().Cookies())
+	return rec
+}
+
+// Get requests path.
+func (c *Client) Get(path string) *httptest.ResponseRecorder {
+	return c.Do(httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+// Post submits form to path, form-encoded.
+func (c *Client) Post(path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.Do(req)
+}
+
+// keep stores cookies, dropping any the response expired.
+func (c *Client) keep(cookies []*http.Cookie) {
+	for _, cookie := range cookies {
+		if cookie.MaxAge < 0 {
+			delete(c.cookies, cookie.Name)
+			continue
+		}
+		c.cookies[cookie.Name] = cookie
+	}
+}
@@ -0,0 +1,67 @@
+package buffkittest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/mail"
+)
+
+func dashboard(c buffalo.Context) error {
+	user := auth.CurrentUser(c)
+	_ = mail.Send(c, mail.Message{To: user.Email, Subject: "Visited"})
+	c.Response().Header().Set("Content-Type", "text/html")
+	_, err := c.Response().Write([]byte(`<html><body><h1>Hello   ` + user.Email + `</h1><a href="/logout" class="nav">Out</a></body></html>`))
+	return err
+}
+
+func TestNewApp(t *testing.T) {
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Jobs: true,
+		Setup: func(a *buffalo.App) {
+			a.GET("/dashboard", buffkit.RequireLogin(dashboard))
+		},
+	})
+
+	t.Run("anonymous visitors are redirected", func(t *testing.T) {
+		res := app.Client().Get("/dashboard")
+		buffkittest.AssertRedirect(t, res, "/login")
+	})
+
+	t.Run("logged in", func(t *testing.T) {
+		client := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com"})
+		res := client.Get("/dashboard")
+		if res.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", res.Code, res.Body.String())
+		}
+		buffkittest.AssertText(t, res.Body.String(), "Hello ada@example.com")
+		buffkittest.AssertElement(t, res.Body.String(), "a", "href", "/logout", "class", "nav")
+		buffkittest.AssertNoElement(t, res.Body.String(), "form")
+
+		if sent := app.Mail(); len(sent) != 1 || sent[0].To != "ada@example.com" {
+			t.Errorf("Mail() = %+v", sent)
+		}
+		app.Mailbox().AssertSentCount(t, 1)
+		if _, ok := app.Mailbox().LastTo("ada@example.com"); !ok {
+			t.Error("no mail to ada@example.com")
+		}
+	})
+
+	t.Run("database is migrated", func(t *testing.T) {
+		var n int
+		if err := app.DB.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM job_runs").Scan(&n); err != nil {
+			t.Fatalf("query job_runs: %v", err)
+		}
+	})
+
+	t.Run("jobs run against miniredis", func(t *testing.T) {
+		if err := app.Kit.Jobs.Enqueue("email:send", map[string]string{"to": "ada@example.com"}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package buffkittest
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// AssertText fails the test unless the visible text of body (tags
+// stripped, whitespace collapsed) contains want.
+func AssertText(t testing.TB, body, want string) {
+	t.Helper()
+	if text := Text(body); !strings.Contains(text, want) {
+		t.Errorf("expected page text to contain %q, got %q", want, text)
+	}
+}
+
+// AssertElement fails the test unless body has at least one tag element
+// with the given attributes, passed as name/value pairs:
+//
+//	buffkittest.AssertElement(t, body, "input", "name", "email", "type", "email")
+func AssertElement(t testing.TB, body, tag string, attrs ...string) {
+	t.Helper()
+	if CountElements(body, tag, attrs...) == 0 {
+		t.Errorf("expected a <%s> element with %v", tag, attrs)
+	}
+}
+
+// AssertNoElement is the opposite of AssertElement.
+func AssertNoElement(t testing.TB, body, tag string, attrs ...string) {
+	t.Helper()
+	if n := CountElements(body, tag, attrs...); n > 0 {
+		t.Errorf("expected no <%s> element with %v, found %d", tag, attrs, n)
+	}
+}
+
+// AssertRedirect fails the test unless res is a 3xx redirect to location.
+// A trailing slash on either side is ignored, as Buffalo adds one to paths.
+func AssertRedirect(t testing.TB, res *httptest.ResponseRecorder, location string) {
+	t.Helper()
+	if res.Code < 300 || res.Code >= 400 {
+		t.Errorf("expected a redirect to %s, got status %d", location, res.Code)
+		return
+	}
+	got := res.Header().Get("Location")
+	if strings.TrimSuffix(got, "/") != strings.TrimSuffix(location, "/") {
+		t.Errorf("expected a redirect to %s, got %s", location, got)
+	}
+}
+
+// CountElements returns how many tag elements in body have all the given
+// attributes (name/value pairs). Unparseable HTML counts as none.
+func CountElements(body, tag string, attrs ...string) int {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == tag && hasAttrs(n, attrs) {
+			count++
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return count
+}
+
+// Text returns the visible text of body: text outside script and style
+// elements, with whitespace collapsed to single spaces.
+func Text(body string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteString(" ")
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func hasAttrs(n *html.Node, attrs []string) bool {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		found := false
+		for _, a := range n.Attr {
+			if a.Key == attrs[i] && a.Val == attrs[i+1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,330 @@
+package buffkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gobuffalo/plush/v4"
+	"github.com/johnjansen/buffkit/importmap"
+)
+
+const (
+	// AssetManifestPath is where buffkit:build writes the asset manifest,
+	// relative to the app's root. It maps each file under public/assets
+	// to its fingerprinted copy, e.g. "css/app.css" to
+	// "css/app-1a2b3c4d.css".
+	AssetManifestPath = "public/assets/manifest.json"
+
+	// ImportMapLockPath is where buffkit:build writes the resolved import
+	// map, relative to the app's root: every pin's URL, with local files
+	// fingerprinted, and each URL's integrity hash.
+	ImportMapLockPath = "config/importmap.lock.json"
+)
+
+// BuildProblem is a broken template or reference Build found.
+type BuildProblem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p BuildProblem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+	return p.File + ": " + p.Message
+}
+
+// ImportMapLock is the import map buffkit:build resolved. It's a valid
+// import map, with the integrity of every URL.
+type ImportMapLock struct {
+	Imports   map[string]string `json:"imports"`
+	Integrity map[string]string `json:"integrity"`
+}
+
+// BuildReport is what Build found and wrote.
+type BuildReport struct {
+	// Templates is how many Plush templates compiled.
+	Templates int
+
+	// Assets is the asset manifest.
+	Assets map[string]string
+
+	// ImportMap is the import map lock.
+	ImportMap ImportMapLock
+
+	// Problems are the broken templates and references. Nothing is
+	// written when there are any.
+	Problems []BuildProblem
+}
+
+var (
+	// componentTag finds component tags in templates
+	componentTag = regexp.MustCompile(`<(bk-[a-z0-9-]+)`)
+
+	// assetCall finds assetPath calls with a literal file
+	assetCall = regexp.MustCompile(`assetPath\(\s*"([^"]+)"\s*\)`)
+
+	// fingerprinted matches a file name Build or importmap:vendor wrote,
+	// with the first 8 hex digits of its SHA-256 before the extension
+	fingerprinted = regexp.MustCompile(`-([0-9a-f]{8})(\.[^./]+)?$`)
+)
+
+// Build prepares the app in dir, its root directory, for deploying:
+//
+//   - It compiles every Plush template under templates, so syntax errors
+//     fail the build rather than a request.
+//   - It checks that every <bk-*> tag in them names a registered
+//     component, and every assetPath("...") a file that exists.
+//   - It copies each file under public/assets to a fingerprinted name
+//     and writes the manifest to AssetManifestPath; assetPath serves the
+//     copies, which can be cached forever.
+//   - It resolves the import map, fetching remote pins to check they
+//     load, and writes it with integrity hashes to ImportMapLockPath.
+//
+// Nothing is written when it finds problems, or with dryRun. Wire reads
+// the manifest and lock when not in DevMode. The buffkit:build task runs
+// it for the environment's configuration.
+func (k *Kit) Build(ctx context.Context, dir string, dryRun bool) (*BuildReport, error) {
+	report := &BuildReport{}
+	if err := k.buildTemplates(dir, report); err != nil {
+		return nil, err
+	}
+	copies, err := buildAssets(dir, report)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.buildImportMap(ctx, dir, report); err != nil {
+		return nil, err
+	}
+	if len(report.Problems) > 0 || dryRun {
+		return report, nil
+	}
+
+	assets := filepath.Join(dir, "public", "assets")
+	for file, data := range copies {
+		if err := os.WriteFile(filepath.Join(assets, filepath.FromSlash(report.Assets[file])), data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeJSON(filepath.Join(dir, AssetManifestPath), report.Assets); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(filepath.Join(dir, ImportMapLockPath), report.ImportMap); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// buildTemplates compiles the Plush templates under dir/templates and
+// checks their components and assets. The .html files in
+// templates/buffkit are left out, as there they may be html/template.
+func (k *Kit) buildTemplates(dir string, report *BuildReport) error {
+	components := make(map[string]bool)
+	for _, name := range k.Components.Names() {
+		components[name] = true
+	}
+	components["bk-slot"] = true
+
+	root := os.DirFS(dir)
+	err := fs.WalkDir(root, "templates", func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == "templates" {
+			return fs.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		plushFile := strings.Contains(path.Base(p), ".plush.")
+		if !plushFile && (strings.HasPrefix(p, templatesDir+"/") || (path.Ext(p) != ".html" && path.Ext(p) != ".md")) {
+			return nil
+		}
+		src, err := fs.ReadFile(root, p)
+		if err != nil {
+			return err
+		}
+
+		if _, err := plush.Parse(string(src)); err != nil {
+			report.Problems = append(report.Problems, BuildProblem{File: p, Message: err.Error()})
+		} else {
+			report.Templates++
+		}
+		for _, m := range componentTag.FindAllSubmatchIndex(src, -1) {
+			if name := string(src[m[2]:m[3]]); !components[name] {
+				report.Problems = append(report.Problems, BuildProblem{
+					File: p, Line: lineAt(src, m[0]), Message: "no component " + name + " is registered",
+				})
+			}
+		}
+		for _, m := range assetCall.FindAllSubmatchIndex(src, -1) {
+			if file := string(src[m[2]:m[3]]); !assetExists(dir, file) {
+				report.Problems = append(report.Problems, BuildProblem{
+					File: p, Line: lineAt(src, m[0]), Message: "no asset public/assets/" + file,
+				})
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// buildAssets fingerprints the files under dir/public/assets into
+// report.Assets and returns the copies to write, by file. Files that
+// are already fingerprinted copies are skipped.
+func buildAssets(dir string, report *BuildReport) (map[string][]byte, error) {
+	report.Assets = make(map[string]string)
+	copies := make(map[string][]byte)
+	assets := os.DirFS(filepath.Join(dir, "public", "assets"))
+	err := fs.WalkDir(assets, ".", func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == "." {
+			return fs.SkipDir
+		}
+		if err != nil || d.IsDir() || p == path.Base(AssetManifestPath) {
+			return err
+		}
+		data, err := fs.ReadFile(assets, p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])[:8]
+		if m := fingerprinted.FindStringSubmatch(p); m != nil && m[1] == hash {
+			return nil
+		}
+		ext := path.Ext(p)
+		report.Assets[p] = strings.TrimSuffix(p, ext) + "-" + hash + ext
+		copies[p] = data
+		return nil
+	})
+	return copies, err
+}
+
+// buildImportMap resolves the import map into report.ImportMap,
+// pointing local files at their fingerprinted copies. The controllers
+// Buffkit serves itself keep their URLs.
+func (k *Kit) buildImportMap(ctx context.Context, dir string, report *BuildReport) error {
+	lock := ImportMapLock{Imports: k.ImportMap.List(), Integrity: make(map[string]string)}
+	names := make([]string, 0, len(lock.Imports))
+	for name := range lock.Imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		url := lock.Imports[name]
+		var data []byte
+		var err error
+		switch {
+		case strings.HasSuffix(url, "/") || strings.HasPrefix(url, importmap.ControllersPath+"/"):
+			continue
+		case strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://"):
+			data, err = fetch(ctx, url)
+		case strings.HasPrefix(url, "/assets/"):
+			file := strings.TrimPrefix(url, "/assets/")
+			data, err = readAsset(dir, file)
+			if hashed, ok := report.Assets[file]; ok {
+				url = "/assets/" + hashed
+				lock.Imports[name] = url
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			report.Problems = append(report.Problems, BuildProblem{
+				File: "import map", Message: fmt.Sprintf("%s (%s): %v", name, lock.Imports[name], err),
+			})
+			continue
+		}
+		sum := sha256.Sum256(data)
+		lock.Integrity[url] = "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	report.ImportMap = lock
+	return ctx.Err()
+}
+
+// fetch downloads a remote pin.
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// readAsset reads a file under public/assets, the app's or else
+// Buffkit's.
+func readAsset(dir, file string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "public", "assets", filepath.FromSlash(file)))
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = fs.ReadFile(publicFS, "public/assets/"+file)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = errors.New("no such file under public/assets")
+		}
+	}
+	return data, err
+}
+
+// assetExists reports whether file is under public/assets.
+func assetExists(dir, file string) bool {
+	_, err := readAsset(dir, strings.TrimPrefix(file, "/"))
+	return err == nil
+}
+
+// lineAt returns the line offset is on.
+func lineAt(src []byte, offset int) int {
+	return strings.Count(string(src[:offset]), "\n") + 1
+}
+
+// writeJSON writes v to file as indented JSON, creating its directory.
+func writeJSON(file string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0o644)
+}
+
+// loadBuild reads the asset manifest and import map lock buffkit:build
+// wrote, if it has, from the app's root.
+func loadBuild() (assets map[string]string, lock *ImportMapLock, err error) {
+	if data, err := os.ReadFile(AssetManifestPath); err == nil {
+		if err := json.Unmarshal(data, &assets); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", AssetManifestPath, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	if data, err := os.ReadFile(ImportMapLockPath); err == nil {
+		lock = &ImportMapLock{}
+		if err := json.Unmarshal(data, lock); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", ImportMapLockPath, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	return assets, lock, nil
+}
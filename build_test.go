@@ -0,0 +1,100 @@
+package buffkit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lib.js" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("export default 1;"))
+	}))
+	defer cdn.Close()
+
+	kit, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	for name := range kit.ImportMap.List() {
+		kit.ImportMap.Unpin(name)
+	}
+	kit.ImportMap.Pin("app", "/assets/js/app.js")
+	kit.ImportMap.Pin("index", "/assets/js/index.js")
+	kit.ImportMap.Pin("lib", cdn.URL+"/lib.js")
+	kit.ImportMap.Pin("gone", cdn.URL+"/gone.js")
+
+	dir := t.TempDir()
+	write := func(file, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("public/assets/js/app.js", "console.log('app');")
+	write("public/assets/css/app.css", "body { margin: 0 }")
+	write("templates/index.plush.html", `<bk-code>Go</bk-code>
+<link rel="stylesheet" href="<%= assetPath("css/app.css") %>">
+<bk-missing></bk-missing>
+<img src="<%= assetPath("images/logo.png") %>">`)
+	write("templates/broken.html", `<%= link(%>`)
+	write("templates/buffkit/auth/login.html", `{{ template "not plush" }}`)
+
+	report, err := kit.Build(context.Background(), dir, false)
+	require.NoError(t, err)
+	var problems []string
+	for _, p := range report.Problems {
+		problems = append(problems, p.String())
+	}
+	assert.Len(t, problems, 4, problems)
+	assert.Contains(t, problems, "templates/index.plush.html:3: no component bk-missing is registered")
+	assert.Contains(t, problems, "templates/index.plush.html:4: no asset public/assets/images/logo.png")
+	assert.Contains(t, problems[0], "templates/broken.html: ", "Plush syntax errors fail the build")
+	assert.Contains(t, problems, "import map: gone ("+cdn.URL+"/gone.js): 404 Not Found")
+	assert.NoFileExists(t, filepath.Join(dir, AssetManifestPath), "nothing is written with problems")
+
+	kit.ImportMap.Unpin("gone")
+	write("templates/index.plush.html", `<bk-code>Go</bk-code> <%= assetPath("css/app.css") %> <%= assetPath("js/index.js") %>`)
+	write("templates/broken.html", `<%= if (true) { %>closed<% } %>`)
+	report, err = kit.Build(context.Background(), dir, true)
+	require.NoError(t, err)
+	require.Empty(t, report.Problems)
+	assert.Equal(t, 2, report.Templates)
+	assert.NoFileExists(t, filepath.Join(dir, AssetManifestPath), "a dry run writes nothing")
+
+	report, err = kit.Build(context.Background(), dir, false)
+	require.NoError(t, err)
+	require.Empty(t, report.Problems)
+	assert.Equal(t, map[string]string{"js/app.js": "js/app-355a0f5a.js", "css/app.css": "css/app-997facec.css"}, report.Assets)
+	data, err := os.ReadFile(filepath.Join(dir, "public/assets/css", filepath.Base(report.Assets["css/app.css"])))
+	require.NoError(t, err)
+	assert.Equal(t, "body { margin: 0 }", string(data))
+
+	var lock ImportMapLock
+	data, err = os.ReadFile(filepath.Join(dir, ImportMapLockPath))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &lock))
+	assert.Equal(t, "/assets/"+report.Assets["js/app.js"], lock.Imports["app"], "local pins point at the copies")
+	assert.Equal(t, "/assets/js/index.js", lock.Imports["index"], "Buffkit's own assets stay put")
+	assert.Len(t, lock.Integrity, 3)
+	assert.Regexp(t, `^sha256-`, lock.Integrity[cdn.URL+"/lib.js"])
+
+	report, err = kit.Build(context.Background(), dir, false)
+	require.NoError(t, err)
+	assert.Len(t, report.Assets, 2, "the copies aren't fingerprinted again")
+
+	kit.Assets = report.Assets
+	assetPath := kit.Helpers(nil)["assetPath"].(func(string) string)
+	assert.Equal(t, "/assets/"+report.Assets["css/app.css"], assetPath("css/app.css"))
+	assert.Equal(t, "/assets/js/index.js", assetPath("js/index.js"))
+}
@@ -0,0 +1,193 @@
+// Package clock abstracts time so expiry, scheduling, and heartbeat logic
+// can be tested without sleeping. Production code uses Real; tests inject
+// a Fake and move it forward explicitly:
+//
+//	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+//	signer.SetClock(clk)
+//	link, _ := signer.Sign("/report", clk.Now().Add(time.Hour), nil)
+//	clk.Advance(2 * time.Hour) // link has now expired
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates timers.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the part of *time.Ticker Buffkit uses, as an interface so a
+// Fake can drive it.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the wall clock.
+var Real Clock = realClock{}
+
+// Or returns c, or Real when c is nil. Types with an optional clock use
+// it so their zero value keeps working.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+// Fake is a Clock that only moves when told to. Timers and tickers fire
+// during Advance and Set, in deadline order, as they would have in real
+// time. Like time.Ticker, a fake ticker drops ticks its reader hasn't
+// kept up with. Safe for concurrent use.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	period   time.Duration // zero for one-shot timers
+	ch       chan time.Time
+	stopped  bool
+}
+
+// NewFake returns a fake clock reading now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{deadline: f.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.ch <- f.now
+		return t.ch
+	}
+	f.timers = append(f.timers, t)
+	return t.ch
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{deadline: f.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.timers = append(f.timers, t)
+	return &fakeTicker{clock: f, timer: t}
+}
+
+// Advance moves the clock forward by d, firing any timers that come due.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing any timers that come due. Moving
+// backwards fires nothing.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		next := f.nextDue(t)
+		if next == nil {
+			break
+		}
+		f.now = next.deadline
+		select {
+		case next.ch <- f.now:
+		default: // reader is behind; drop the tick like time.Ticker
+		}
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			next.stopped = true
+		}
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+	f.prune()
+}
+
+// Timers returns how many timers and tickers are waiting, so tests can
+// wait until the code under test has started one before advancing.
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prune()
+	return len(f.timers)
+}
+
+// nextDue returns the timer with the earliest deadline at or before t.
+func (f *Fake) nextDue(t time.Time) *fakeTimer {
+	active := make([]*fakeTimer, 0, len(f.timers))
+	for _, timer := range f.timers {
+		if !timer.stopped && !timer.deadline.After(t) {
+			active = append(active, timer)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		return active[i].deadline.Before(active[j].deadline)
+	})
+	return active[0]
+}
+
+func (f *Fake) prune() {
+	kept := f.timers[:0]
+	for _, timer := range f.timers {
+		if !timer.stopped {
+			kept = append(kept, timer)
+		}
+	}
+	f.timers = kept
+}
+
+type fakeTicker struct {
+	clock *Fake
+	timer *fakeTimer
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.timer.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.timer.stopped = true
+}
@@ -0,0 +1,79 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnjansen/buffkit/clock"
+)
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAfter(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	ch := clk.After(time.Minute)
+
+	clk.Advance(59 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("fired early")
+	default:
+	}
+
+	clk.Advance(time.Second)
+	select {
+	case at := <-ch:
+		if !at.Equal(epoch.Add(time.Minute)) {
+			t.Errorf("fired at %v", at)
+		}
+	default:
+		t.Fatal("did not fire")
+	}
+	if clk.Timers() != 0 {
+		t.Errorf("Timers() = %d after firing", clk.Timers())
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	ticker := clk.NewTicker(10 * time.Second)
+
+	var ticks []time.Time
+	for i := 0; i < 3; i++ {
+		clk.Advance(10 * time.Second)
+		ticks = append(ticks, <-ticker.C())
+	}
+	if !ticks[2].Equal(epoch.Add(30 * time.Second)) {
+		t.Errorf("third tick at %v", ticks[2])
+	}
+
+	// A reader that falls behind gets one tick, not a backlog
+	clk.Advance(time.Minute)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Error("ticks should not queue up")
+	default:
+	}
+
+	ticker.Stop()
+	clk.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Error("stopped ticker fired")
+	default:
+	}
+	if !clk.Now().Equal(epoch.Add(150 * time.Second)) {
+		t.Errorf("Now() = %v", clk.Now())
+	}
+}
+
+func TestOr(t *testing.T) {
+	if clock.Or(nil) != clock.Real {
+		t.Error("Or(nil) should be Real")
+	}
+	clk := clock.NewFake(epoch)
+	if clock.Or(clk) != clk {
+		t.Error("Or should keep a non-nil clock")
+	}
+}
@@ -18,10 +18,12 @@ func main() {
 		fmt.Println("  buffkit:migrate       - Apply all pending database migrations")
 		fmt.Println("  buffkit:migrate:status - Show migration status")
 		fmt.Println("  buffkit:migrate:down  - Rollback the last N migrations (default: 1)")
+		fmt.Println("  buffkit:doctor        - Check the database, Redis, SMTP and secrets")
 		fmt.Println("  jobs:worker          - Start the background job worker")
 		fmt.Println("  jobs:scheduler       - Start the job scheduler")
 		fmt.Println("")
-		fmt.Println("Use 'grift list' to see all available tasks")
+		fmt.Println("Use 'grift list' to see all available tasks, and")
+		fmt.Println("'grift TASK --help' for a task's arguments and flags")
 		os.Exit(1)
 	}
 
@@ -0,0 +1,481 @@
+// Package comments adds threaded comments to anything in an app: posts,
+// products, tickets. Comments belong to a target, named by type and ID,
+// are written in markdown, and can be replied to. Authors can delete
+// their own; moderators can delete and restore anyone's. Deleting only
+// hides a comment, so the replies under it keep their place.
+//
+// Wire mounts the routes when Config.Comments is set, and registers the
+// <bk-comments> and <bk-comment-form> components:
+//
+//	<bk-comments target="posts:<%= post.ID %>"></bk-comments>
+//
+// Apps decide who moderates, and hook in notifications:
+//
+//	kit.Comments.CanModerate = func(c buffalo.Context, target comments.Target) bool {
+//	    return isEditor(c)
+//	}
+//	kit.Comments.OnComment(func(ctx context.Context, comment, parent *comments.Comment) {
+//	    if parent != nil && parent.Author != comment.Author {
+//	        _ = kit.Jobs.EnqueueEmail(parent.Author, "New reply to your comment", comment.Body)
+//	    }
+//	})
+package comments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+)
+
+// DefaultMaxLength is the longest comment, in characters, when
+// Comments.MaxLength isn't set.
+const DefaultMaxLength = 10000
+
+// Default rate limit: how many comments a user may post per window.
+const (
+	DefaultRateLimit  = 5
+	DefaultRateWindow = time.Minute
+)
+
+var (
+	// ErrNotFound is returned for an unknown comment ID.
+	ErrNotFound = auth.NotFoundError("comments: comment not found")
+
+	// ErrRateLimited is returned when a user posts more comments than
+	// the rate limit allows.
+	ErrRateLimited = errors.New("comments: posting too quickly")
+)
+
+// ValidationError is why a comment can't be posted, worded for the
+// person who wrote it.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "comments: " + e.Message
+}
+
+// Target is what a comment is about: a record of some type, such as
+// the post with ID 42.
+type Target struct {
+	Type string
+	ID   string
+}
+
+// String returns the target as "type:id", as components and forms take
+// it.
+func (t Target) String() string {
+	return t.Type + ":" + t.ID
+}
+
+// ParseTarget parses a target written as "type:id", such as "posts:42".
+func ParseTarget(s string) (Target, error) {
+	typ, id, ok := strings.Cut(s, ":")
+	if !ok || typ == "" || id == "" || len(typ) > 64 || len(id) > 255 || strings.ContainsAny(s, " \t\r\n") {
+		return Target{}, fmt.Errorf("comments: target %q must look like type:id", s)
+	}
+	return Target{Type: typ, ID: id}, nil
+}
+
+// Comment is one comment on a target.
+type Comment struct {
+	ID     string
+	Target Target
+
+	// ParentID is the comment this replies to, or "" for a comment on
+	// the target itself.
+	ParentID string
+
+	// Author is the user ID of who wrote the comment, and AuthorName
+	// their name when they wrote it.
+	Author     string
+	AuthorName string
+
+	// Body is the comment's markdown.
+	Body string
+
+	CreatedAt time.Time
+
+	// DeletedAt is when the comment was deleted, and DeletedBy who by.
+	// Deleted comments are hidden, but kept for their replies and for
+	// moderators to restore.
+	DeletedAt *time.Time
+	DeletedBy string
+}
+
+// Deleted reports whether the comment has been deleted.
+func (c *Comment) Deleted() bool {
+	return c.DeletedAt != nil
+}
+
+// Node is a comment in a thread, with its replies.
+type Node struct {
+	*Comment
+	Replies []*Node
+}
+
+// Store keeps comments. MemoryStore suits tests and development;
+// SQLStore keeps them in the database.
+type Store interface {
+	Create(ctx context.Context, comment *Comment) error
+
+	// Comment returns the comment with id, or ErrNotFound.
+	Comment(ctx context.Context, id string) (*Comment, error)
+
+	// Thread returns every comment on target, deleted ones included,
+	// oldest first.
+	Thread(ctx context.Context, target Target) ([]*Comment, error)
+
+	// CountSince counts the comments author has posted since since, for
+	// rate limiting.
+	CountSince(ctx context.Context, author string, since time.Time) (int, error)
+
+	// SetDeleted marks the comment deleted at at by by, or restores it
+	// when at is nil.
+	SetDeleted(ctx context.Context, id string, at *time.Time, by string) error
+}
+
+// Comments posts, moderates and shows comments.
+type Comments struct {
+	Store Store
+
+	// Path is where the routes are mounted. Defaults to "/comments".
+	Path string
+
+	// LoginPath is linked from the form for visitors who aren't logged
+	// in. Defaults to auth.LoginPath().
+	LoginPath string
+
+	// MaxLength is the longest comment, in characters. Defaults to
+	// DefaultMaxLength.
+	MaxLength int
+
+	// RateLimit is how many comments a user may post per RateWindow.
+	// Zero uses DefaultRateLimit and DefaultRateWindow; negative turns
+	// rate limiting off.
+	RateLimit  int
+	RateWindow time.Duration
+
+	// CanComment reports whether the current user may comment on
+	// target, e.g. to lock a thread. Nil lets any logged-in user.
+	CanComment func(c buffalo.Context, target Target) bool
+
+	// CanModerate reports whether the current user may delete and
+	// restore anyone's comments on target. Nil means nobody can; authors
+	// can always delete their own.
+	CanModerate func(c buffalo.Context, target Target) bool
+
+	// Clock is used for timestamps and rate limiting. Nil uses the real
+	// clock.
+	Clock clock.Clock
+
+	mu         sync.RWMutex
+	onComment  []func(ctx context.Context, comment, parent *Comment)
+	onModerate []func(ctx context.Context, comment *Comment)
+}
+
+// New creates a Comments that keeps comments in store.
+func New(store Store) *Comments {
+	return &Comments{Store: store}
+}
+
+// OnComment registers a hook that runs after a comment is posted, with
+// the comment it replies to, if any. Hooks are where notifications go:
+//
+//	kit.Comments.OnComment(func(ctx context.Context, comment, parent *comments.Comment) {
+//	    notifyFollowers(ctx, comment.Target, comment)
+//	})
+//
+// Hooks run in the request, so anything slow, like sending email,
+// belongs in a job.
+func (m *Comments) OnComment(fn func(ctx context.Context, comment, parent *Comment)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onComment = append(m.onComment, fn)
+}
+
+// OnModerate registers a hook that runs after a comment is deleted or
+// restored; comment.Deleted says which.
+func (m *Comments) OnModerate(fn func(ctx context.Context, comment *Comment)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onModerate = append(m.onModerate, fn)
+}
+
+// Post checks and saves comment, setting its ID and CreatedAt, then runs
+// the OnComment hooks. Invalid comments return a *ValidationError, and
+// authors over the rate limit ErrRateLimited.
+func (m *Comments) Post(ctx context.Context, comment *Comment) error {
+	comment.Body = strings.TrimSpace(comment.Body)
+	if comment.Body == "" {
+		return &ValidationError{Message: "Write a comment first"}
+	}
+	if n := utf8.RuneCountInString(comment.Body); n > m.maxLength() {
+		return &ValidationError{Message: fmt.Sprintf("Comments can be at most %d characters; this one is %d", m.maxLength(), n)}
+	}
+
+	var parent *Comment
+	if comment.ParentID != "" {
+		var err error
+		parent, err = m.Store.Comment(ctx, comment.ParentID)
+		if errors.Is(err, ErrNotFound) || (err == nil && (parent.Target != comment.Target || parent.Deleted())) {
+			return &ValidationError{Message: "The comment you replied to is gone"}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	now := clock.Or(m.Clock).Now()
+	if limit, window := m.rateLimit(); limit > 0 {
+		n, err := m.Store.CountSince(ctx, comment.Author, now.Add(-window))
+		if err != nil {
+			return err
+		}
+		if n >= limit {
+			return ErrRateLimited
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	comment.ID, comment.CreatedAt = id, now
+	if err := m.Store.Create(ctx, comment); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	hooks := m.onComment
+	m.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, comment, parent)
+	}
+	return nil
+}
+
+// Delete hides the comment with id, recording by as who deleted it, and
+// runs the OnModerate hooks.
+func (m *Comments) Delete(ctx context.Context, id, by string) (*Comment, error) {
+	now := clock.Or(m.Clock).Now()
+	return m.setDeleted(ctx, id, &now, by)
+}
+
+// Restore shows the deleted comment with id again, and runs the
+// OnModerate hooks.
+func (m *Comments) Restore(ctx context.Context, id string) (*Comment, error) {
+	return m.setDeleted(ctx, id, nil, "")
+}
+
+func (m *Comments) setDeleted(ctx context.Context, id string, at *time.Time, by string) (*Comment, error) {
+	if err := m.Store.SetDeleted(ctx, id, at, by); err != nil {
+		return nil, err
+	}
+	comment, err := m.Store.Comment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	hooks := m.onModerate
+	m.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, comment)
+	}
+	return comment, nil
+}
+
+// Thread returns the comments on target as a tree: comments on the
+// target itself, oldest first, each with its replies. Deleted comments
+// are included; Node.Deleted says which they are.
+func (m *Comments) Thread(ctx context.Context, target Target) ([]*Node, error) {
+	all, err := m.Store.Thread(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]*Node, len(all))
+	for _, comment := range all {
+		nodes[comment.ID] = &Node{Comment: comment}
+	}
+	var roots []*Node
+	for _, comment := range all {
+		node := nodes[comment.ID]
+		if parent, ok := nodes[comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, nil
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (m *Comments) Routes() [][2]string {
+	p := m.path()
+	return [][2]string{
+		{http.MethodPost, p},
+		{http.MethodPost, p + "/{id}/delete"},
+		{http.MethodPost, p + "/{id}/restore"},
+	}
+}
+
+// Mount adds the routes to app. They all require login.
+func (m *Comments) Mount(app *buffalo.App) {
+	p := m.path()
+	app.POST(p, auth.RequireLogin(m.Create))
+	app.POST(p+"/{id}/delete", auth.RequireLogin(m.DeleteHandler))
+	app.POST(p+"/{id}/restore", auth.RequireLogin(m.RestoreHandler))
+}
+
+// Create posts the comment in the form: the target, the parent being
+// replied to (if any) and the body. It redirects back to the return_to
+// field, to the new comment, or with a "danger" flash saying what was
+// wrong.
+func (m *Comments) Create(c buffalo.Context) error {
+	target, err := ParseTarget(c.Request().FormValue("target"))
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	if !m.canComment(c, target) {
+		return c.Error(http.StatusForbidden, fmt.Errorf("comments: can't comment on %s", target))
+	}
+
+	comment := &Comment{
+		Target:   target,
+		ParentID: c.Request().FormValue("parent"),
+		Author:   auth.GetUserSession(c),
+		Body:     c.Request().FormValue("body"),
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		comment.AuthorName = user.Name()
+	}
+	back := returnTo(c)
+	var invalid *ValidationError
+	switch err := m.Post(c, comment); {
+	case errors.As(err, &invalid):
+		c.Flash().Add("danger", invalid.Message)
+		return c.Redirect(http.StatusSeeOther, back)
+	case errors.Is(err, ErrRateLimited):
+		c.Flash().Add("danger", "You're commenting too quickly. Wait a minute and try again.")
+		return c.Redirect(http.StatusSeeOther, back)
+	case err != nil:
+		return err
+	}
+	return c.Redirect(http.StatusSeeOther, back+"#comment-"+comment.ID)
+}
+
+// DeleteHandler deletes the comment in the id parameter, for its author
+// or a moderator, and redirects back to the return_to field.
+func (m *Comments) DeleteHandler(c buffalo.Context) error {
+	comment, err := m.Store.Comment(c, c.Param("id"))
+	if errors.Is(err, ErrNotFound) {
+		return c.Error(http.StatusNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+	user := auth.GetUserSession(c)
+	if comment.Author != user && !m.canModerate(c, comment.Target) {
+		return c.Error(http.StatusForbidden, fmt.Errorf("comments: %s can't delete comment %s", user, comment.ID))
+	}
+	if !comment.Deleted() {
+		if _, err := m.Delete(c, comment.ID, user); err != nil {
+			return err
+		}
+	}
+	return c.Redirect(http.StatusSeeOther, returnTo(c)+"#comment-"+comment.ID)
+}
+
+// RestoreHandler restores the deleted comment in the id parameter, for
+// moderators, and redirects back to the return_to field.
+func (m *Comments) RestoreHandler(c buffalo.Context) error {
+	comment, err := m.Store.Comment(c, c.Param("id"))
+	if errors.Is(err, ErrNotFound) {
+		return c.Error(http.StatusNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+	if !m.canModerate(c, comment.Target) {
+		return c.Error(http.StatusForbidden, fmt.Errorf("comments: %s can't restore comment %s", auth.GetUserSession(c), comment.ID))
+	}
+	if comment.Deleted() {
+		if _, err := m.Restore(c, comment.ID); err != nil {
+			return err
+		}
+	}
+	return c.Redirect(http.StatusSeeOther, returnTo(c)+"#comment-"+comment.ID)
+}
+
+func (m *Comments) canComment(c buffalo.Context, target Target) bool {
+	if auth.GetUserSession(c) == "" {
+		return false
+	}
+	return m.CanComment == nil || m.CanComment(c, target)
+}
+
+func (m *Comments) canModerate(c buffalo.Context, target Target) bool {
+	return auth.GetUserSession(c) != "" && m.CanModerate != nil && m.CanModerate(c, target)
+}
+
+func (m *Comments) path() string {
+	if m.Path != "" {
+		return strings.TrimSuffix(m.Path, "/")
+	}
+	return "/comments"
+}
+
+func (m *Comments) maxLength() int {
+	if m.MaxLength > 0 {
+		return m.MaxLength
+	}
+	return DefaultMaxLength
+}
+
+func (m *Comments) rateLimit() (int, time.Duration) {
+	if m.RateLimit == 0 {
+		return DefaultRateLimit, DefaultRateWindow
+	}
+	window := m.RateWindow
+	if window <= 0 {
+		window = DefaultRateWindow
+	}
+	return m.RateLimit, window
+}
+
+// returnTo is the request's return_to field if it's a path on this
+// site, or "/".
+func returnTo(c buffalo.Context) string {
+	back := c.Request().FormValue("return_to")
+	if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.HasPrefix(back, `/\`) {
+		return "/"
+	}
+	// The comment's anchor replaces any the page had
+	if u, err := url.Parse(back); err == nil {
+		u.Fragment = ""
+		back = u.String()
+	}
+	return back
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("comments: id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
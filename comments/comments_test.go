@@ -0,0 +1,251 @@
+package comments_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/comments"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var post = comments.Target{Type: "posts", ID: "42"}
+
+func postPage(c buffalo.Context) error {
+	c.Response().Header().Set("Content-Type", "text/html")
+	_, err := c.Response().Write([]byte(`<html><body><h1>Hello</h1><bk-comments target="posts:42"></bk-comments></body></html>`))
+	return err
+}
+
+func newApp(t *testing.T) *buffkittest.App {
+	t.Helper()
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Comments: true},
+		Setup: func(a *buffalo.App) {
+			a.GET("/posts/42", postPage)
+		},
+	})
+	require.NotNil(t, app.Kit.Comments)
+	app.Kit.Comments.CanModerate = func(c buffalo.Context, target comments.Target) bool {
+		return auth.GetUserSession(c) == "mod@example.com"
+	}
+	return app
+}
+
+// comment posts body on the post as client, replying to parent if set,
+// and returns where it was redirected.
+func comment(t *testing.T, client *buffkittest.Client, body, parent string) string {
+	t.Helper()
+	res := client.Post("/comments", url.Values{
+		"target":    {"posts:42"},
+		"parent":    {parent},
+		"body":      {body},
+		"return_to": {"/posts/42#top"},
+	})
+	require.Equal(t, http.StatusSeeOther, res.Code, res.Body.String())
+	return res.Header().Get("Location")
+}
+
+func TestThread(t *testing.T) {
+	app := newApp(t)
+	ctx := context.Background()
+	ada := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com", DisplayName: "Ada"})
+	grace := buffkittest.LoginAs(t, app, &auth.User{Email: "grace@example.com", DisplayName: "Grace"})
+
+	var notified []string
+	app.Kit.Comments.OnComment(func(ctx context.Context, comment, parent *comments.Comment) {
+		if parent != nil {
+			notified = append(notified, parent.Author+" <- "+comment.AuthorName)
+		}
+	})
+
+	res := app.Client().Get("/posts/42")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertText(t, res.Body.String(), "No comments yet.")
+	buffkittest.AssertElement(t, res.Body.String(), "a", "href", "/login")
+	buffkittest.AssertNoElement(t, res.Body.String(), "textarea")
+
+	posted := comment(t, ada, "Nice **post** <script>alert(1)</script>", "")
+	require.True(t, strings.HasPrefix(posted, "/posts/42#comment-"), posted)
+	id := strings.TrimPrefix(posted, "/posts/42#comment-")
+	replyID := strings.TrimPrefix(comment(t, grace, "Agreed", id), "/posts/42#comment-")
+	assert.Equal(t, []string{"ada@example.com <- Grace"}, notified)
+
+	body := grace.Get("/posts/42").Body.String()
+	assert.Contains(t, body, "<strong>post</strong>", "markdown is rendered")
+	assert.NotContains(t, body, "<script>alert", "and sanitized")
+	buffkittest.AssertElement(t, body, "li", "id", "comment-"+id)
+	buffkittest.AssertElement(t, body, "input", "name", "parent", "value", id)
+	buffkittest.AssertElement(t, body, "textarea", "name", "body")
+	buffkittest.AssertElement(t, body, "form", "action", "/comments/"+replyID+"/delete")
+	buffkittest.AssertNoElement(t, body, "form", "action", "/comments/"+id+"/delete")
+	nodes, err := app.Kit.Comments.Thread(ctx, post)
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	require.Len(t, nodes[0].Replies, 1)
+	assert.Equal(t, "Agreed", nodes[0].Replies[0].Body)
+
+	// Grace can't delete Ada's comment, but a moderator can, and the
+	// reply keeps its place
+	assert.Equal(t, http.StatusForbidden, grace.Post("/comments/"+id+"/delete", url.Values{}).Code)
+	var moderated []bool
+	app.Kit.Comments.OnModerate(func(ctx context.Context, comment *comments.Comment) {
+		moderated = append(moderated, comment.Deleted())
+	})
+	mod := buffkittest.LoginAs(t, app, &auth.User{Email: "mod@example.com", DisplayName: "Mod"})
+	res = mod.Post("/comments/"+id+"/delete", url.Values{"return_to": {"/posts/42"}})
+	buffkittest.AssertRedirect(t, res, "/posts/42#comment-"+id)
+
+	body = grace.Get("/posts/42").Body.String()
+	buffkittest.AssertText(t, body, "This comment was deleted.")
+	assert.NotContains(t, body, "<strong>post</strong>")
+	assert.Contains(t, body, "Agreed")
+	body = mod.Get("/posts/42").Body.String()
+	assert.Contains(t, body, "<strong>post</strong>", "moderators still see it")
+	buffkittest.AssertElement(t, body, "form", "action", "/comments/"+id+"/restore")
+
+	// Replies to deleted comments are refused
+	assert.Equal(t, "/posts/42", comment(t, grace, "Still there?", id))
+
+	// Once the reply goes too, the deleted comment disappears
+	require.Equal(t, http.StatusSeeOther, grace.Post("/comments/"+replyID+"/delete", url.Values{}).Code)
+	body = ada.Get("/posts/42").Body.String()
+	assert.NotContains(t, body, "This comment was deleted.")
+	buffkittest.AssertText(t, body, "No comments yet.")
+
+	assert.Equal(t, http.StatusForbidden, ada.Post("/comments/"+id+"/restore", url.Values{}).Code)
+	require.Equal(t, http.StatusSeeOther, mod.Post("/comments/"+id+"/restore", url.Values{}).Code)
+	restored, err := app.Kit.Comments.Store.Comment(ctx, id)
+	require.NoError(t, err)
+	assert.False(t, restored.Deleted())
+	assert.Equal(t, []bool{true, true, false}, moderated)
+
+	assert.Equal(t, http.StatusNotFound, mod.Post("/comments/nope/delete", url.Values{}).Code)
+}
+
+func TestPost(t *testing.T) {
+	app := newApp(t)
+	ada := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com", DisplayName: "Ada"})
+
+	// Visitors must log in
+	buffkittest.AssertRedirect(t, app.Client().Post("/comments", url.Values{"target": {"posts:42"}, "body": {"Hi"}}), "/login")
+
+	assert.Equal(t, http.StatusBadRequest, ada.Post("/comments", url.Values{"target": {"nope"}, "body": {"Hi"}}).Code)
+	assert.Equal(t, "/posts/42", comment(t, ada, "   ", ""), "blank comments go back")
+	app.Kit.Comments.MaxLength = 10
+	assert.Equal(t, "/posts/42", comment(t, ada, "far too long for this", ""))
+	app.Kit.Comments.MaxLength = 0
+
+	// Off-site return_to is ignored
+	res := ada.Post("/comments", url.Values{"target": {"posts:42"}, "body": {"Hi"}, "return_to": {"//evil.example"}})
+	assert.True(t, strings.HasPrefix(res.Header().Get("Location"), "/#comment-"), res.Header().Get("Location"))
+
+	// Locked threads refuse comments and say so
+	app.Kit.Comments.CanComment = func(c buffalo.Context, target comments.Target) bool { return false }
+	assert.Equal(t, http.StatusForbidden, ada.Post("/comments", url.Values{"target": {"posts:42"}, "body": {"Hi"}}).Code)
+	buffkittest.AssertText(t, ada.Get("/posts/42").Body.String(), "Comments are closed.")
+}
+
+func TestRateLimit(t *testing.T) {
+	app := newApp(t)
+	ctx := context.Background()
+	m := app.Kit.Comments
+	m.RateLimit, m.RateWindow = 2, time.Minute
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, m.Post(ctx, &comments.Comment{Target: post, Author: "ada@example.com", Body: "Hi"}))
+	}
+	err := m.Post(ctx, &comments.Comment{Target: post, Author: "ada@example.com", Body: "Hi"})
+	assert.ErrorIs(t, err, comments.ErrRateLimited)
+	assert.NoError(t, m.Post(ctx, &comments.Comment{Target: post, Author: "grace@example.com", Body: "Hi"}), "limits are per author")
+
+	app.Clock.Advance(time.Minute + time.Second)
+	assert.NoError(t, m.Post(ctx, &comments.Comment{Target: post, Author: "ada@example.com", Body: "Hi"}))
+
+	m.RateLimit = -1
+	for i := 0; i < 5; i++ {
+		require.NoError(t, m.Post(ctx, &comments.Comment{Target: post, Author: "ada@example.com", Body: "Hi"}))
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	target, err := comments.ParseTarget("posts:42")
+	require.NoError(t, err)
+	assert.Equal(t, post, target)
+	target, err = comments.ParseTarget("products:sku:9")
+	require.NoError(t, err)
+	assert.Equal(t, "sku:9", target.ID)
+
+	for _, bad := range []string{"", "posts", "posts:", ":42", "posts:4 2"} {
+		_, err := comments.ParseTarget(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestStores(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	schema, err := os.ReadFile("../db/migrations/comments/20261017110000_create_comments.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for name, store := range map[string]comments.Store{
+		"memory": comments.NewMemoryStore(),
+		"sql":    comments.NewSQLStore(db, "sqlite"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+			first := &comments.Comment{ID: "c1", Target: post, Author: "ada@example.com", AuthorName: "Ada", Body: "First", CreatedAt: now}
+			second := &comments.Comment{ID: "c2", Target: post, ParentID: "c1", Author: "grace@example.com", Body: "Second", CreatedAt: now.Add(time.Minute)}
+			other := &comments.Comment{ID: "c3", Target: comments.Target{Type: "posts", ID: "7"}, Author: "ada@example.com", Body: "Elsewhere", CreatedAt: now}
+			for _, c := range []*comments.Comment{second, first, other} {
+				require.NoError(t, store.Create(ctx, c))
+			}
+
+			thread, err := store.Thread(ctx, post)
+			require.NoError(t, err)
+			require.Len(t, thread, 2)
+			assert.Equal(t, "c1", thread[0].ID)
+			assert.Equal(t, "Ada", thread[0].AuthorName)
+			assert.Equal(t, "c1", thread[1].ParentID)
+
+			n, err := store.CountSince(ctx, "ada@example.com", now)
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+			n, err = store.CountSince(ctx, "ada@example.com", now.Add(time.Second))
+			require.NoError(t, err)
+			assert.Zero(t, n)
+
+			deleted := now.Add(time.Hour)
+			require.NoError(t, store.SetDeleted(ctx, "c1", &deleted, "mod@example.com"))
+			got, err := store.Comment(ctx, "c1")
+			require.NoError(t, err)
+			require.True(t, got.Deleted())
+			assert.True(t, deleted.Equal(*got.DeletedAt))
+			assert.Equal(t, "mod@example.com", got.DeletedBy)
+
+			require.NoError(t, store.SetDeleted(ctx, "c1", nil, ""))
+			got, err = store.Comment(ctx, "c1")
+			require.NoError(t, err)
+			assert.False(t, got.Deleted())
+
+			assert.ErrorIs(t, store.SetDeleted(ctx, "missing", nil, ""), comments.ErrNotFound)
+			_, err = store.Comment(ctx, "missing")
+			assert.ErrorIs(t, err, comments.ErrNotFound)
+		})
+	}
+}
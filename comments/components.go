@@ -0,0 +1,230 @@
+package comments
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// commentsCSS lays out threads with the theme tokens.
+const commentsCSS = `.bk-comments ol { list-style: none; margin: 0; padding: 0; }
+.bk-comment { margin: 0 0 1rem; }
+.bk-comment header { display: flex; gap: 0.5rem; align-items: baseline; }
+.bk-comment time, .bk-comment-deleted, .bk-comments-empty { color: var(--bk-muted, #71717a); }
+.bk-comment-body pre { padding: 0.75rem; overflow-x: auto; background: var(--bk-surface, #f4f4f5); border-radius: var(--bk-radius, 6px); }
+.bk-comment-actions { display: flex; gap: 0.75rem; align-items: start; }
+.bk-comment-actions form { display: inline; }
+.bk-comment-replies { margin-top: 0.75rem !important; padding-left: 1.25rem !important; border-left: 2px solid var(--bk-border, #e4e4e7); }
+.bk-comment-form textarea { display: block; width: 100%; margin: 0.25rem 0 0.5rem; }`
+
+// RegisterComponents registers <bk-comments>, a target's thread with the
+// form to comment on it, and <bk-comment-form>, the form alone:
+//
+//	<bk-comments target="posts:<%= post.ID %>"></bk-comments>
+//	<bk-comment-form target="posts:<%= post.ID %>"></bk-comment-form>
+//
+// Comments are rendered from markdown, sanitized. Each has a Reply form
+// and, for its author or a moderator, a Delete button; moderators also
+// see deleted comments, with a Restore button. form="false" leaves the
+// thread's form out. After posting, people come back to return-to,
+// which defaults to the current page.
+func (m *Comments) RegisterComponents(r *components.Registry) {
+	r.RegisterContext("bk-comments", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		target, err := ParseTarget(attrs["target"])
+		if err != nil {
+			return nil, fmt.Errorf("bk-comments: %w", err)
+		}
+		if c == nil {
+			return nil, fmt.Errorf("bk-comments: %s must be rendered for a request", target)
+		}
+		return m.renderThread(c, target, componentReturnTo(c, attrs), attrs["form"] != "false")
+	})
+	r.RegisterContext("bk-comment-form", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		target, err := ParseTarget(attrs["target"])
+		if err != nil {
+			return nil, fmt.Errorf("bk-comment-form: %w", err)
+		}
+		if c == nil {
+			return nil, fmt.Errorf("bk-comment-form: %s must be rendered for a request", target)
+		}
+		var b strings.Builder
+		m.writeNewComment(&b, c, target, componentReturnTo(c, attrs))
+		return []byte(b.String()), nil
+	})
+	r.RegisterCSS("bk-comments", commentsCSS)
+	r.RegisterCSS("bk-comment-form", commentsCSS)
+}
+
+func componentReturnTo(c buffalo.Context, attrs map[string]string) string {
+	if back, ok := attrs["return-to"]; ok {
+		return back
+	}
+	return c.Request().URL.RequestURI()
+}
+
+// threadView is what a render of a thread needs to know about the viewer.
+type threadView struct {
+	target    Target
+	returnTo  string
+	user      string
+	comment   bool
+	moderate  bool
+	csrfToken string
+}
+
+func (m *Comments) renderThread(c buffalo.Context, target Target, returnTo string, showForm bool) ([]byte, error) {
+	nodes, err := m.Thread(c, target)
+	if err != nil {
+		return nil, err
+	}
+	v := &threadView{
+		target:    target,
+		returnTo:  returnTo,
+		user:      auth.GetUserSession(c),
+		comment:   m.canComment(c, target),
+		moderate:  m.canModerate(c, target),
+		csrfToken: secure.CSRFToken(c),
+	}
+
+	var b strings.Builder
+	b.WriteString(`<section class="bk-comments" aria-label="Comments">`)
+	visible := v.visible(nodes)
+	if len(visible) == 0 {
+		b.WriteString(`<p class="bk-comments-empty">No comments yet.</p>`)
+	} else {
+		b.WriteString(`<ol class="bk-comment-list">`)
+		for _, node := range visible {
+			m.writeComment(&b, v, node)
+		}
+		b.WriteString(`</ol>`)
+	}
+	if showForm {
+		m.writeNewComment(&b, c, target, returnTo)
+	}
+	b.WriteString(`</section>`)
+	return []byte(b.String()), nil
+}
+
+// visible returns the nodes the viewer sees: all of them for
+// moderators, otherwise all but deleted comments with no replies left
+// to show.
+func (v *threadView) visible(nodes []*Node) []*Node {
+	var out []*Node
+	for _, node := range nodes {
+		if v.moderate || !node.Deleted() || len(v.visible(node.Replies)) > 0 {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+func (m *Comments) writeComment(b *strings.Builder, v *threadView, node *Node) {
+	class := "bk-comment"
+	if node.Deleted() {
+		class += " bk-comment-is-deleted"
+	}
+	fmt.Fprintf(b, `<li class="%s" id="comment-%s"><article>`, class, html.EscapeString(node.ID))
+	if node.Deleted() && !v.moderate {
+		b.WriteString(`<p class="bk-comment-deleted">This comment was deleted.</p>`)
+	} else {
+		name := node.AuthorName
+		if name == "" {
+			name = "Unknown"
+		}
+		fmt.Fprintf(b, `<header><strong class="bk-comment-author">%s</strong> <time datetime="%s">%s</time>`,
+			html.EscapeString(name), node.CreatedAt.UTC().Format(time.RFC3339), node.CreatedAt.UTC().Format("2 Jan 2006 15:04"))
+		if node.Deleted() {
+			b.WriteString(` <span class="bk-comment-deleted">Deleted</span>`)
+		}
+		b.WriteString(`</header>`)
+		fmt.Fprintf(b, `<div class="bk-comment-body">%s</div>`, components.Markdown(node.Body))
+		m.writeActions(b, v, node)
+	}
+	b.WriteString(`</article>`)
+	if replies := v.visible(node.Replies); len(replies) > 0 {
+		b.WriteString(`<ol class="bk-comment-replies">`)
+		for _, reply := range replies {
+			m.writeComment(b, v, reply)
+		}
+		b.WriteString(`</ol>`)
+	}
+	b.WriteString(`</li>`)
+}
+
+func (m *Comments) writeActions(b *strings.Builder, v *threadView, node *Node) {
+	reply := v.comment && !node.Deleted()
+	remove := !node.Deleted() && (v.user == node.Author || v.moderate)
+	restore := node.Deleted() && v.moderate
+	if !reply && !remove && !restore {
+		return
+	}
+	b.WriteString(`<footer class="bk-comment-actions">`)
+	if reply {
+		b.WriteString(`<details class="bk-comment-reply"><summary>Reply</summary>`)
+		m.writeForm(b, v.csrfToken, v.target, node.ID, v.returnTo)
+		b.WriteString(`</details>`)
+	}
+	if remove {
+		m.writeButton(b, v, node.ID, "delete", "Delete")
+	}
+	if restore {
+		m.writeButton(b, v, node.ID, "restore", "Restore")
+	}
+	b.WriteString(`</footer>`)
+}
+
+// writeButton writes a form that posts to the comment's action.
+func (m *Comments) writeButton(b *strings.Builder, v *threadView, id, action, label string) {
+	fmt.Fprintf(b, `<form method="POST" action="%s/%s/%s">`, html.EscapeString(m.path()), html.EscapeString(id), action)
+	writeHidden(b, v.csrfToken, v.returnTo)
+	fmt.Fprintf(b, `<button type="submit">%s</button></form>`, label)
+}
+
+// writeNewComment writes the form for a new comment on target, or why
+// the viewer can't comment.
+func (m *Comments) writeNewComment(b *strings.Builder, c buffalo.Context, target Target, returnTo string) {
+	switch {
+	case auth.GetUserSession(c) == "":
+		login := m.LoginPath
+		if login == "" {
+			login = auth.LoginPath()
+		}
+		fmt.Fprintf(b, `<p class="bk-comments-login"><a href="%s">Log in</a> to comment.</p>`, html.EscapeString(login))
+	case !m.canComment(c, target):
+		b.WriteString(`<p class="bk-comments-closed">Comments are closed.</p>`)
+	default:
+		m.writeForm(b, secure.CSRFToken(c), target, "", returnTo)
+	}
+}
+
+// writeForm writes the form for a comment on target, replying to parent
+// if it's set.
+func (m *Comments) writeForm(b *strings.Builder, csrfToken string, target Target, parent, returnTo string) {
+	id, label, button := "bk-comment-body", "Comment", "Post comment"
+	if parent != "" {
+		id, label, button = "bk-comment-body-"+parent, "Reply", "Post reply"
+	}
+	fmt.Fprintf(b, `<form class="bk-comment-form" method="POST" action="%s">`, html.EscapeString(m.path()))
+	writeHidden(b, csrfToken, returnTo)
+	fmt.Fprintf(b, `<input type="hidden" name="target" value="%s">`, html.EscapeString(target.String()))
+	if parent != "" {
+		fmt.Fprintf(b, `<input type="hidden" name="parent" value="%s">`, html.EscapeString(parent))
+	}
+	fmt.Fprintf(b, `<label for="%[1]s">%[2]s</label><textarea id="%[1]s" name="body" rows="4" maxlength="%[3]d" required></textarea>`,
+		html.EscapeString(id), label, m.maxLength())
+	fmt.Fprintf(b, `<button type="submit">%s</button></form>`, button)
+}
+
+// writeHidden writes the CSRF token and return_to fields.
+func writeHidden(b *strings.Builder, csrfToken, returnTo string) {
+	if csrfToken != "" {
+		fmt.Fprintf(b, `<input type="hidden" name="authenticity_token" value="%s">`, html.EscapeString(csrfToken))
+	}
+	fmt.Fprintf(b, `<input type="hidden" name="return_to" value="%s">`, html.EscapeString(returnTo))
+}
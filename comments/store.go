@@ -0,0 +1,223 @@
+package comments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// MemoryStore keeps comments in memory, for tests and development.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	comments map[string]*Comment
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{comments: make(map[string]*Comment)}
+}
+
+// clone copies comment, so callers can't change what's stored.
+func clone(comment *Comment) *Comment {
+	copied := *comment
+	if comment.DeletedAt != nil {
+		at := *comment.DeletedAt
+		copied.DeletedAt = &at
+	}
+	return &copied
+}
+
+func (s *MemoryStore) Create(ctx context.Context, comment *Comment) error {
+	if err := readonly.Check("comments.Create"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.comments[comment.ID] = clone(comment)
+	return nil
+}
+
+func (s *MemoryStore) Comment(ctx context.Context, id string) (*Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	comment, ok := s.comments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(comment), nil
+}
+
+func (s *MemoryStore) Thread(ctx context.Context, target Target) ([]*Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*Comment
+	for _, comment := range s.comments {
+		if comment.Target == target {
+			out = append(out, clone(comment))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (s *MemoryStore) CountSince(ctx context.Context, author string, since time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, comment := range s.comments {
+		if comment.Author == author && !comment.CreatedAt.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) SetDeleted(ctx context.Context, id string, at *time.Time, by string) error {
+	if err := readonly.Check("comments.SetDeleted"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	comment, ok := s.comments[id]
+	if !ok {
+		return ErrNotFound
+	}
+	comment.DeletedAt, comment.DeletedBy = nil, by
+	if at != nil {
+		deleted := *at
+		comment.DeletedAt = &deleted
+	}
+	return nil
+}
+
+// SQLStore keeps comments in the comments table created by the
+// db/migrations/comments migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates a comment store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+const commentColumns = "id, target_type, target_id, parent_id, author, author_name, body, created_at, deleted_at, deleted_by"
+
+func (s *SQLStore) Create(ctx context.Context, comment *Comment) error {
+	if err := readonly.Check("comments.Create"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO comments ("+commentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		comment.ID, comment.Target.Type, comment.Target.ID, comment.ParentID, comment.Author, comment.AuthorName,
+		comment.Body, comment.CreatedAt, comment.DeletedAt, comment.DeletedBy)
+	return err
+}
+
+func (s *SQLStore) Comment(ctx context.Context, id string) (*Comment, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	comment, err := scanComment(s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT "+commentColumns+" FROM comments WHERE id = ?"), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return comment, err
+}
+
+func (s *SQLStore) Thread(ctx context.Context, target Target) ([]*Comment, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT "+commentColumns+" FROM comments WHERE target_type = ? AND target_id = ? ORDER BY created_at, id"),
+		target.Type, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, comment)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLStore) CountSince(ctx context.Context, author string, since time.Time) (int, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var n int
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT COUNT(*) FROM comments WHERE author = ? AND created_at >= ?"), author, since).Scan(&n)
+	return n, err
+}
+
+func (s *SQLStore) SetDeleted(ctx context.Context, id string, at *time.Time, by string) error {
+	if err := readonly.Check("comments.SetDeleted"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"UPDATE comments SET deleted_at = ?, deleted_by = ? WHERE id = ?"), at, by, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanner is a *sql.Row or *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row scanner) (*Comment, error) {
+	var comment Comment
+	var deletedAt sql.NullTime
+	err := row.Scan(&comment.ID, &comment.Target.Type, &comment.Target.ID, &comment.ParentID, &comment.Author,
+		&comment.AuthorName, &comment.Body, &comment.CreatedAt, &deletedAt, &comment.DeletedBy)
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		comment.DeletedAt = &deletedAt.Time
+	}
+	return &comment, nil
+}
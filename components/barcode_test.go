@@ -0,0 +1,44 @@
+package components_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/components/componenttest"
+)
+
+func TestBarcodeComponents(t *testing.T) {
+	registry := components.NewRegistry()
+	registry.RegisterBarcodes()
+
+	componenttest.Assert(t, registry, "bk-qr",
+		componenttest.Case{Name: "default", Attrs: map[string]string{"value": "https://example.com"}},
+		componenttest.Case{Name: "sized", Attrs: map[string]string{"value": "https://example.com", "size": "120", "level": "H", "label": "Scan <me>"}},
+	)
+	componenttest.Assert(t, registry, "bk-barcode",
+		componenttest.Case{Name: "default", Attrs: map[string]string{"value": "SHIP-1"}},
+	)
+
+	out, err := registry.Render("bk-barcode", map[string]string{"value": "SHIP-1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `aria-label="SHIP-1"`) {
+		t.Errorf("expected the value as the label in:\n%s", out)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		attrs map[string]string
+	}{
+		{"bk-qr", map[string]string{"value": "x", "level": "Z"}},
+		{"bk-qr", map[string]string{"value": "x", "size": "big"}},
+		{"bk-qr", map[string]string{"value": strings.Repeat("x", 3000)}},
+		{"bk-barcode", map[string]string{}},
+	} {
+		if _, err := registry.Render(tc.name, tc.attrs, nil); err == nil {
+			t.Errorf("expected an error for %s %v", tc.name, tc.attrs)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package components
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"golang.org/x/net/html"
+)
+
+// chartCSS styles chart labels with the theme tokens.
+const chartCSS = `.bk-chart { display: inline-block; vertical-align: middle; overflow: visible; }
+.bk-chart text { font: 10px var(--bk-font, sans-serif); fill: var(--bk-muted, #71717a); }`
+
+// chartLabelHeight is the room left under line and bar charts for labels.
+const chartLabelHeight = 16
+
+// ChartData is the series a chart plots, with an optional label per value.
+type ChartData struct {
+	Values []float64
+	Labels []string
+}
+
+// ChartProvider supplies the data for <bk-chart data="name">, given the
+// request (nil outside one) and the chart's attributes.
+type ChartProvider func(c buffalo.Context, attrs map[string]string) (ChartData, error)
+
+// RegisterChartData makes p the source of <bk-chart data="name">.
+// Registering again replaces the provider.
+func (r *Registry) RegisterChartData(name string, p ChartProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.charts[name] = p
+}
+
+// RegisterChart registers <bk-chart>, which draws a sparkline, line or
+// bar chart as inline SVG, so dashboards need no charting library. The
+// values come from attributes or from a provider registered with
+// RegisterChartData:
+//
+//	<bk-chart type="sparkline" values="3,5,2,8"></bk-chart>
+//	<bk-chart type="bar" values="12,7,9" labels="Mon,Tue,Wed" title="Signups"></bk-chart>
+//	<bk-chart type="line" data="signups" width="400" height="120"></bk-chart>
+//
+// The type defaults to line. Charts use --bk-primary for their color and
+// carry their title, or a summary of the values, for screen readers.
+func (r *Registry) RegisterChart() {
+	r.RegisterContext("bk-chart", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		data, err := r.chartData(c, attrs)
+		if err != nil {
+			return nil, err
+		}
+		return renderChart(attrs, data)
+	})
+	r.RegisterCSS("bk-chart", chartCSS)
+}
+
+// chartData returns the chart's values from its provider or attributes.
+func (r *Registry) chartData(c buffalo.Context, attrs map[string]string) (ChartData, error) {
+	if name := attrs["data"]; name != "" {
+		r.mu.RLock()
+		p, ok := r.charts[name]
+		r.mu.RUnlock()
+		if !ok {
+			return ChartData{}, fmt.Errorf("bk-chart: unknown data %q", name)
+		}
+		return p(c, attrs)
+	}
+
+	var data ChartData
+	for _, field := range splitList(attrs["values"]) {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return ChartData{}, fmt.Errorf("bk-chart: bad value %q", field)
+		}
+		data.Values = append(data.Values, v)
+	}
+	data.Labels = splitList(attrs["labels"])
+	return data, nil
+}
+
+// splitList splits a comma-separated attribute, trimming each item.
+func splitList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	items := strings.Split(s, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+func renderChart(attrs map[string]string, data ChartData) ([]byte, error) {
+	kind := attrOr(attrs, "type", "line")
+	width, height := 300.0, 150.0
+	if kind == "sparkline" {
+		width, height = 100, 24
+	}
+	var err error
+	if width, err = chartSize(attrs, "width", width); err != nil {
+		return nil, err
+	}
+	if height, err = chartSize(attrs, "height", height); err != nil {
+		return nil, err
+	}
+
+	title := attrs["title"]
+	if title == "" {
+		title = chartSummary(kind, data.Values)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="bk-chart bk-chart-%s" xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" role="img" aria-label="%s"><title>%s</title>`,
+		kind, num(width), num(height), num(width), num(height), html.EscapeString(title), html.EscapeString(title))
+
+	switch kind {
+	case "sparkline":
+		if len(data.Values) > 0 {
+			writeLine(&b, data.Values, 1, 1, width-2, height-2)
+		}
+	case "line":
+		plotHeight := height - chartLabelHeight
+		writeAxis(&b, width, plotHeight)
+		if len(data.Values) > 0 {
+			writeLine(&b, data.Values, 4, 4, width-8, plotHeight-8)
+		}
+		writeLabels(&b, data.Labels, len(data.Values), 4, width-8, height, false)
+	case "bar":
+		plotHeight := height - chartLabelHeight
+		writeBars(&b, data, width, plotHeight)
+		writeLabels(&b, data.Labels, len(data.Values), 0, width, height, true)
+	default:
+		return nil, fmt.Errorf("bk-chart: unknown type %q", kind)
+	}
+
+	b.WriteString("</svg>")
+	return []byte(b.String()), nil
+}
+
+// chartSize reads a positive size attribute, or returns def.
+func chartSize(attrs map[string]string, name string, def float64) (float64, error) {
+	s := attrs[name]
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 || v > 10000 {
+		return 0, fmt.Errorf("bk-chart: bad %s %q", name, s)
+	}
+	return v, nil
+}
+
+// chartSummary describes values for a chart without a title.
+func chartSummary(kind string, values []float64) string {
+	if len(values) == 0 {
+		return "No data"
+	}
+	lo, hi := valueRange(values)
+	return fmt.Sprintf("%s chart of %d values from %s to %s, ending at %s",
+		strings.ToUpper(kind[:1])+kind[1:], len(values), num(lo), num(hi), num(values[len(values)-1]))
+}
+
+func valueRange(values []float64) (lo, hi float64) {
+	lo, hi = values[0], values[0]
+	for _, v := range values[1:] {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	return lo, hi
+}
+
+// writeLine draws values as a polyline filling the box at x, y.
+func writeLine(b *strings.Builder, values []float64, x, y, w, h float64) {
+	lo, hi := valueRange(values)
+	points := make([]string, len(values))
+	for i, v := range values {
+		px := x + w/2
+		if len(values) > 1 {
+			px = x + float64(i)*w/float64(len(values)-1)
+		}
+		py := y + h/2
+		if hi > lo {
+			py = y + (hi-v)/(hi-lo)*h
+		}
+		points[i] = num(px) + "," + num(py)
+	}
+	fmt.Fprintf(b, `<polyline points="%s" fill="none" stroke="var(--bk-primary, #2563eb)" stroke-width="1.5" stroke-linejoin="round" stroke-linecap="round"/>`,
+		strings.Join(points, " "))
+}
+
+// writeAxis draws the baseline under a plot of height h.
+func writeAxis(b *strings.Builder, w, h float64) {
+	fmt.Fprintf(b, `<line x1="0" y1="%s" x2="%s" y2="%s" stroke="var(--bk-border, #e4e4e7)"/>`, num(h), num(w), num(h))
+}
+
+// writeBars draws a bar per value from the zero line, which sits at the
+// bottom unless there are negative values.
+func writeBars(b *strings.Builder, data ChartData, w, h float64) {
+	if len(data.Values) == 0 {
+		writeAxis(b, w, h)
+		return
+	}
+	lo, hi := valueRange(data.Values)
+	lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+	scale := 0.0
+	if hi > lo {
+		scale = (h - 4) / (hi - lo)
+	}
+	zero := 4 + hi*scale
+	slot := w / float64(len(data.Values))
+	for i, v := range data.Values {
+		top, height := zero-v*scale, v*scale
+		if v < 0 {
+			top, height = zero, -v*scale
+		}
+		label := num(v)
+		if i < len(data.Labels) && data.Labels[i] != "" {
+			label = data.Labels[i] + ": " + label
+		}
+		fmt.Fprintf(b, `<rect x="%s" y="%s" width="%s" height="%s" fill="var(--bk-primary, #2563eb)"><title>%s</title></rect>`,
+			num(float64(i)*slot+slot*0.1), num(top), num(slot*0.8), num(height), html.EscapeString(label))
+	}
+	writeAxis(b, w, zero)
+}
+
+// writeLabels writes labels along the bottom, under the points of a line
+// or, when centered, the middle of each bar slot.
+func writeLabels(b *strings.Builder, labels []string, n int, x, w, height float64, centered bool) {
+	for i, label := range labels {
+		if i >= n || label == "" {
+			continue
+		}
+		var px float64
+		switch {
+		case centered:
+			px = x + (float64(i)+0.5)*w/float64(n)
+		case n > 1:
+			px = x + float64(i)*w/float64(n-1)
+		default:
+			px = x + w/2
+		}
+		fmt.Fprintf(b, `<text x="%s" y="%s" text-anchor="middle">%s</text>`, num(px), num(height-4), html.EscapeString(label))
+	}
+}
+
+// num formats a coordinate with at most two decimals.
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,51 @@
+package components_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/components/componenttest"
+)
+
+func TestChartComponent(t *testing.T) {
+	registry := components.NewRegistry()
+	registry.RegisterChart()
+
+	componenttest.Assert(t, registry, "bk-chart",
+		componenttest.Case{Name: "sparkline", Attrs: map[string]string{"type": "sparkline", "values": "3, 5, 2, 8"}},
+		componenttest.Case{Name: "line", Attrs: map[string]string{"values": "1,4,2", "labels": "Jan,Feb,Mar", "title": "Signups <30d>"}},
+		componenttest.Case{Name: "bar", Attrs: map[string]string{"type": "bar", "values": "4,-2,6", "labels": "Mon,Tue,Wed", "width": "120", "height": "80"}},
+		componenttest.Case{Name: "empty", Attrs: map[string]string{"type": "bar"}},
+	)
+
+	for _, attrs := range []map[string]string{
+		{"values": "1,two"},
+		{"values": "1", "type": "pie"},
+		{"values": "1", "width": "-5"},
+		{"data": "missing"},
+	} {
+		if _, err := registry.Render("bk-chart", attrs, nil); err == nil {
+			t.Errorf("expected an error for %v", attrs)
+		}
+	}
+}
+
+func TestChartDataProvider(t *testing.T) {
+	registry := components.NewRegistry()
+	registry.RegisterChart()
+	registry.RegisterChartData("signups", func(c buffalo.Context, attrs map[string]string) (components.ChartData, error) {
+		return components.ChartData{Values: []float64{2, 9}, Labels: []string{"May", "June"}}, nil
+	})
+
+	out, err := registry.Render("bk-chart", map[string]string{"type": "bar", "data": "signups"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`aria-label="Bar chart of 2 values from 2 to 9, ending at 9"`, `<title>June: 9</title>`, `>May</text>`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %s in:\n%s", want, out)
+		}
+	}
+}
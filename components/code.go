@@ -0,0 +1,112 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"golang.org/x/net/html"
+)
+
+// CodeStylesheet is the URL of the highlighting stylesheet, served from
+// Buffkit's public assets. An app shadows it by shipping its own
+// public/assets/css/bk-code.css.
+const CodeStylesheet = "/assets/css/bk-code.css"
+
+// Highlighting styles for CodeCSS: the light one by default, the dark one
+// when the OS prefers dark.
+const (
+	codeStyleLight = "github"
+	codeStyleDark  = "github-dark"
+)
+
+// codeClassPrefix keeps the highlighter's short token classes (k, s, nf,
+// ...) from colliding with the app's CSS.
+const codeClassPrefix = "bk-"
+
+// The formatters are built once: they cache each style's classes, which
+// would otherwise be worked out again on every render.
+var (
+	codeFormatter = chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.ClassPrefix(codeClassPrefix),
+	)
+	codeLinesFormatter = chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.ClassPrefix(codeClassPrefix),
+		chromahtml.WithLineNumbers(true),
+	)
+)
+
+// Highlight returns code as HTML with syntax highlighting for language
+// (a name or alias such as "go", "js" or "sql"), as a <pre> whose tokens
+// carry classes the CodeStylesheet colors. An unknown or empty language
+// is guessed from the code, falling back to plain text.
+func Highlight(code, language string) (string, error) {
+	return highlight(code, language, false)
+}
+
+func highlight(code, language string, lineNumbers bool) (string, error) {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Analyse(code)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return "", err
+	}
+
+	formatter := codeFormatter
+	if lineNumbers {
+		formatter = codeLinesFormatter
+	}
+	var b strings.Builder
+	if err := formatter.Format(&b, styles.Get(codeStyleLight), tokens); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// CodeCSS returns the stylesheet served at CodeStylesheet, for apps that
+// want to start their own from it.
+func CodeCSS() (string, error) {
+	var b strings.Builder
+	b.WriteString("/* Generated by components.CodeCSS; shadow this file to restyle <bk-code> */\n")
+	if err := codeFormatter.WriteCSS(&b, styles.Get(codeStyleLight)); err != nil {
+		return "", err
+	}
+	b.WriteString("@media (prefers-color-scheme: dark) {\n")
+	if err := codeFormatter.WriteCSS(&b, styles.Get(codeStyleDark)); err != nil {
+		return "", err
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// RegisterCode registers <bk-code>, which highlights its content on the
+// server, so pages don't need a client-side highlighter:
+//
+//	<bk-code language="go" line-numbers="true">
+//	    func main() {
+//	        fmt.Println("hi")
+//	    }
+//	</bk-code>
+//
+// The content is dedented and shown verbatim. Link the stylesheet from
+// the layout: <link rel="stylesheet" href="/assets/css/bk-code.css">.
+func (r *Registry) RegisterCode() {
+	r.Register("bk-code", func(attrs, slots map[string]string) ([]byte, error) {
+		code := html.UnescapeString(dedent(slots["default"])) + "\n"
+		highlighted, err := highlight(code, attrs["language"], attrs["line-numbers"] == "true")
+		if err != nil {
+			return nil, fmt.Errorf("bk-code: %w", err)
+		}
+		return []byte(`<div class="bk-code">` + highlighted + `</div>`), nil
+	})
+}
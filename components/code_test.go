@@ -0,0 +1,43 @@
+package components_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/components/componenttest"
+)
+
+func TestCodeComponent(t *testing.T) {
+	registry := components.NewRegistry()
+	registry.RegisterCode()
+
+	componenttest.Assert(t, registry, "bk-code",
+		componenttest.Case{Name: "go", Attrs: map[string]string{"language": "go"},
+			Slots: map[string]string{"default": "\n    if a &lt; b {\n        return &#34;x&#34;\n    }\n  "}},
+		componenttest.Case{Name: "line-numbers", Attrs: map[string]string{"language": "sql", "line-numbers": "true"},
+			Slots: map[string]string{"default": "SELECT 1;\nSELECT 2;"}},
+		componenttest.Case{Name: "plain", Attrs: map[string]string{"language": "no-such-language"},
+			Slots: map[string]string{"default": "just &lt;text&gt;"}},
+	)
+}
+
+func TestHighlight(t *testing.T) {
+	out, err := components.Highlight(`x := "<b>"`, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `<span class="bk-s">&#34;&lt;b&gt;&#34;</span>`) {
+		t.Errorf("expected a highlighted, escaped string in:\n%s", out)
+	}
+
+	css, err := components.CodeCSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{".bk-chroma .bk-k {", "@media (prefers-color-scheme: dark) {"} {
+		if !strings.Contains(css, want) {
+			t.Errorf("expected %s in the stylesheet", want)
+		}
+	}
+}
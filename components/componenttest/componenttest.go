@@ -0,0 +1,110 @@
+// Package componenttest snapshot-tests components against golden HTML
+// files. Each case renders a registered component with fixture attributes
+// and slots and compares the output with testdata/<component>/<case>.html:
+//
+//	func TestButton(t *testing.T) {
+//	    registry := components.NewRegistry()
+//	    app.RegisterComponents(registry)
+//
+//	    componenttest.Assert(t, registry, "bk-button",
+//	        componenttest.Case{Name: "primary", Attrs: map[string]string{"variant": "primary"},
+//	            Slots: map[string]string{"default": "Save"}},
+//	        componenttest.Case{Name: "link", Attrs: map[string]string{"href": "/docs"}},
+//	    )
+//	}
+//
+// Run the tests with -update to write or refresh the golden files, then
+// review the diff before committing them:
+//
+//	go test ./... -run TestButton -update
+//
+// The package registers the -update flag itself, so test packages that
+// import it must not define their own.
+package componenttest
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/johnjansen/buffkit/components"
+)
+
+// Dir is the directory golden files live under, relative to the package
+// being tested.
+var Dir = "testdata"
+
+func init() {
+	// Another golden-file helper initialized first may already own -update;
+	// share it rather than panicking on the redefinition
+	if flag.Lookup("update") == nil {
+		flag.Bool("update", false, "rewrite componenttest golden files")
+	}
+}
+
+// Case is one rendering of a component.
+type Case struct {
+	Name  string            // Golden file name, e.g. "primary" for primary.html
+	Attrs map[string]string // Attributes on the component tag
+	Slots map[string]string // Slot content; "default" is the tag's body
+}
+
+// Assert renders component once per case, as a subtest named after the
+// case, and fails when the output differs from the golden file. Leading and
+// trailing whitespace is ignored.
+func Assert(t *testing.T, registry *components.Registry, component string, cases ...Case) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			t.Helper()
+			out, err := registry.Render(component, c.Attrs, c.Slots)
+			if err != nil {
+				t.Fatalf("componenttest: render %s: %v", component, err)
+			}
+			got := strings.TrimSpace(string(out))
+			path := GoldenPath(component, c.Name)
+
+			if updating() {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatalf("componenttest: %v", err)
+				}
+				if err := os.WriteFile(path, []byte(got+"\n"), 0o644); err != nil {
+					t.Fatalf("componenttest: %v", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				t.Fatalf("componenttest: golden file %s is missing; run go test with -update to create it", path)
+			}
+			if err != nil {
+				t.Fatalf("componenttest: %v", err)
+			}
+			if got != strings.TrimSpace(string(want)) {
+				t.Errorf("componenttest: %s %q doesn't match %s (run with -update if the change is intended)\n--- want\n%s\n+++ got\n%s",
+					component, c.Name, path, strings.TrimSpace(string(want)), got)
+			}
+		})
+	}
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// GoldenPath returns the golden file for a component's case.
+func GoldenPath(component, name string) string {
+	return filepath.Join(Dir, component, unsafeName.ReplaceAllString(name, "_")+".html")
+}
+
+func updating() bool {
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	v, _ := strconv.ParseBool(f.Value.String())
+	return v
+}
@@ -0,0 +1,52 @@
+package componenttest
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"testing"
+
+	"github.com/johnjansen/buffkit/components"
+)
+
+func badgeRegistry() *components.Registry {
+	registry := components.NewRegistry()
+	registry.Register("bk-badge", func(attrs, slots map[string]string) ([]byte, error) {
+		tone := attrs["tone"]
+		if tone == "" {
+			tone = "neutral"
+		}
+		label := components.Slots(slots).GetOr("default", "New")
+		return []byte(fmt.Sprintf(`<span class="badge badge-%s">%s</span>`, html.EscapeString(tone), label)), nil
+	})
+	return registry
+}
+
+func TestAssert(t *testing.T) {
+	Assert(t, badgeRegistry(), "bk-badge",
+		Case{Name: "default"},
+		Case{Name: "warning", Attrs: map[string]string{"tone": "warning"}, Slots: map[string]string{"default": "Overdue"}},
+	)
+}
+
+func TestAssertUpdate(t *testing.T) {
+	dir := Dir
+	Dir = t.TempDir()
+	defer func() { Dir = dir }()
+
+	if err := flag.Set("update", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = flag.Set("update", "false") }()
+
+	Assert(t, badgeRegistry(), "bk-badge", Case{Name: "tone/danger", Attrs: map[string]string{"tone": "danger"}})
+
+	got, err := os.ReadFile(GoldenPath("bk-badge", "tone/danger"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<span class=\"badge badge-danger\">New</span>\n"; string(got) != want {
+		t.Errorf("golden file = %q, want %q", got, want)
+	}
+}
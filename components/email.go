@@ -0,0 +1,140 @@
+package components
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Email layout components. Mail clients ignore most of CSS: no flexbox or
+// grid, <style> blocks stripped by some webmail, and Outlook renders with
+// Word. These components write the markup that survives them - nested
+// presentation tables with every style inlined - so mail templates can
+// describe a layout instead:
+//
+//	<bk-email-layout preheader="Your weekly summary">
+//	    <bk-slot name="header"><strong>Acme</strong></bk-slot>
+//	    <bk-email-row>
+//	        <h1>Hi {{.User.Name}}</h1>
+//	        <p>You have {{len .Data}} new comments.</p>
+//	    </bk-email-row>
+//	    <bk-email-row>
+//	        <bk-slot name="left">This week</bk-slot>
+//	        <bk-slot name="right">Last week</bk-slot>
+//	    </bk-email-row>
+//	    <bk-email-row><bk-email-button href="https://app.example.com">Open Acme</bk-email-button></bk-email-row>
+//	    <bk-slot name="footer">You get this because you signed up.</bk-slot>
+//	</bk-email-layout>
+//
+// Mail templates registered with mail.RegisterTemplate get them expanded
+// in their HTML automatically once buffkit.Wire has run.
+
+// Email defaults, overridable per tag with attributes.
+const (
+	emailWidth      = "600"
+	emailBackground = "#f4f4f5"
+	emailSurface    = "#ffffff"
+	emailText       = "#18181b"
+	emailMuted      = "#71717a"
+	emailAccent     = "#2563eb"
+	emailFont       = "-apple-system, BlinkMacSystemFont, 'Segoe UI', Helvetica, Arial, sans-serif"
+)
+
+// RegisterEmail registers the email layout components: bk-email-layout,
+// bk-email-row and bk-email-button. Wire registers them on the shared
+// registry; register your own under the same names to restyle them.
+func (r *Registry) RegisterEmail() {
+	r.Register("bk-email-layout", renderEmailLayout)
+	r.Register("bk-email-row", renderEmailRow)
+	r.Register("bk-email-button", renderEmailButton)
+}
+
+// renderEmailLayout renders the message frame: a full-width background
+// table holding a centered column of at most width pixels.
+//
+// Attributes: width (600), background, surface (the column's color),
+// color (text), font, preheader (inbox preview text, hidden in the body).
+// Slots: header and footer, around the default slot.
+func renderEmailLayout(attrs, slots map[string]string) ([]byte, error) {
+	s := Slots(slots)
+	width := attrOr(attrs, "width", emailWidth)
+	font := attrOr(attrs, "font", emailFont)
+
+	var b strings.Builder
+	if preheader := attrs["preheader"]; preheader != "" {
+		fmt.Fprintf(&b, `<div style="display:none;max-height:0;overflow:hidden;mso-hide:all;">%s</div>`, html.EscapeString(preheader))
+	}
+	fmt.Fprintf(&b, `<table role="presentation" width="100%%" cellpadding="0" cellspacing="0" border="0" style="background-color:%s;">`, attrOr(attrs, "background", emailBackground))
+	b.WriteString(`<tr><td align="center" style="padding:24px 12px;">`)
+	fmt.Fprintf(&b, `<table role="presentation" width="%s" cellpadding="0" cellspacing="0" border="0" style="width:100%%;max-width:%spx;">`, width, width)
+	if s.Has("header") {
+		fmt.Fprintf(&b, `<tr><td style="padding:0 24px 16px;font-family:%s;font-size:14px;color:%s;">%s</td></tr>`, font, emailMuted, s["header"])
+	}
+	fmt.Fprintf(&b, `<tr><td style="background-color:%s;border-radius:8px;font-family:%s;font-size:16px;line-height:1.5;color:%s;">%s</td></tr>`,
+		attrOr(attrs, "surface", emailSurface), font, attrOr(attrs, "color", emailText), s["default"])
+	if s.Has("footer") {
+		fmt.Fprintf(&b, `<tr><td align="center" style="padding:16px 24px 0;font-family:%s;font-size:12px;line-height:1.5;color:%s;">%s</td></tr>`, font, emailMuted, s["footer"])
+	}
+	b.WriteString(`</table></td></tr></table>`)
+	return []byte(b.String()), nil
+}
+
+// renderEmailRow renders a full-width band of the layout. With left and
+// right slots it becomes two columns, inline blocks that sit side by side
+// and stack on screens too narrow for both, with no media query needed.
+//
+// Attributes: padding ("16px 24px"), background, align (left).
+func renderEmailRow(attrs, slots map[string]string) ([]byte, error) {
+	s := Slots(slots)
+	padding := attrOr(attrs, "padding", "16px 24px")
+	align := attrOr(attrs, "align", "left")
+
+	var b strings.Builder
+	b.WriteString(`<table role="presentation" width="100%" cellpadding="0" cellspacing="0" border="0"`)
+	if bg := attrs["background"]; bg != "" {
+		fmt.Fprintf(&b, ` style="background-color:%s;"`, html.EscapeString(bg))
+	}
+	fmt.Fprintf(&b, `><tr><td align="%s" style="padding:%s;">`, html.EscapeString(align), html.EscapeString(padding))
+	if s.Has("left") || s.Has("right") {
+		// font-size:0 removes the gap between the inline blocks
+		b.WriteString(`<div style="font-size:0;">`)
+		for _, name := range []string{"left", "right"} {
+			fmt.Fprintf(&b, `<div style="display:inline-block;width:100%%;max-width:270px;vertical-align:top;font-size:16px;text-align:%s;">%s</div>`, html.EscapeString(align), s[name])
+		}
+		b.WriteString(`</div>`)
+	}
+	b.WriteString(s["default"])
+	b.WriteString(`</td></tr></table>`)
+	return []byte(b.String()), nil
+}
+
+// renderEmailButton renders a "bulletproof" button: a colored table cell
+// around the link, so the button keeps its background in clients that
+// drop padding on links.
+//
+// Attributes: href (required), background, color, align (center).
+func renderEmailButton(attrs, slots map[string]string) ([]byte, error) {
+	href := attrs["href"]
+	if href == "" {
+		return nil, errors.New("bk-email-button needs an href")
+	}
+	background := attrOr(attrs, "background", emailAccent)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<table role="presentation" cellpadding="0" cellspacing="0" border="0" align="%s" style="margin:0 auto;">`, attrOr(attrs, "align", "center"))
+	fmt.Fprintf(&b, `<tr><td align="center" bgcolor="%s" style="border-radius:6px;background-color:%s;">`, background, background)
+	fmt.Fprintf(&b, `<a href="%s" target="_blank" style="display:inline-block;padding:12px 24px;font-family:%s;font-size:16px;font-weight:bold;line-height:1.25;color:%s;text-decoration:none;border-radius:6px;">%s</a>`,
+		html.EscapeString(href), emailFont, attrOr(attrs, "color", "#ffffff"), slots["default"])
+	b.WriteString(`</td></tr></table>`)
+	return []byte(b.String()), nil
+}
+
+// attrOr returns the escaped attribute, or fallback when it's missing.
+func attrOr(attrs map[string]string, name, fallback string) string {
+	if v := attrs[name]; v != "" {
+		return html.EscapeString(v)
+	}
+	return html.EscapeString(fallback)
+}
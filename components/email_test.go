@@ -0,0 +1,57 @@
+package components_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/components/componenttest"
+)
+
+func emailRegistry() *components.Registry {
+	registry := components.NewRegistry()
+	registry.RegisterEmail()
+	return registry
+}
+
+func TestEmailComponents(t *testing.T) {
+	registry := emailRegistry()
+
+	componenttest.Assert(t, registry, "bk-email-layout",
+		componenttest.Case{Name: "default", Slots: map[string]string{"default": "<p>Hello</p>"}},
+		componenttest.Case{Name: "framed",
+			Attrs: map[string]string{"width": "480", "preheader": "Your <weekly> summary"},
+			Slots: map[string]string{"header": "Acme", "default": "<p>Hello</p>", "footer": "Unsubscribe"}},
+	)
+	componenttest.Assert(t, registry, "bk-email-row",
+		componenttest.Case{Name: "default", Slots: map[string]string{"default": "<p>Body</p>"}},
+		componenttest.Case{Name: "columns", Attrs: map[string]string{"background": "#fafafa"},
+			Slots: map[string]string{"left": "This week", "right": "Last week"}},
+	)
+	componenttest.Assert(t, registry, "bk-email-button",
+		componenttest.Case{Name: "default", Attrs: map[string]string{"href": "https://example.com/?a=1&b=2"},
+			Slots: map[string]string{"default": "Open"}},
+	)
+
+	if _, err := registry.Render("bk-email-button", nil, map[string]string{"default": "Open"}); err == nil {
+		t.Error("expected an error for a button without href")
+	}
+}
+
+func TestExpandEmail(t *testing.T) {
+	out, err := emailRegistry().Expand([]byte(`<bk-email-layout><bk-email-row>` +
+		`<bk-email-button href="/go">Go</bk-email-button></bk-email-row></bk-email-layout>`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := string(out)
+	if strings.Contains(html, "<bk-") {
+		t.Errorf("expected every component expanded, got %s", html)
+	}
+	if strings.Count(html, "<table") != 4 {
+		t.Errorf("expected layout, row and button tables, got %s", html)
+	}
+	if !strings.Contains(html, `<a href="/go"`) {
+		t.Errorf("expected the button link, got %s", html)
+	}
+}
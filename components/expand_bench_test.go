@@ -0,0 +1,145 @@
+package components
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// benchRegistry registers the kind of small components pages are built
+// from: a card with slots, a badge and a wrapper that nests.
+func benchRegistry() *Registry {
+	r := NewRegistry()
+	r.Register("bk-card", func(attrs, slots map[string]string) ([]byte, error) {
+		s := Slots(slots)
+		return []byte(`<div class="bk-card bk-card-` + attrOr(attrs, "variant", "plain") + `"><h3>` +
+			s.GetOr("title", "Untitled") + `</h3><div class="body">` + s["default"] + `</div></div>`), nil
+	})
+	r.Register("bk-badge", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<span class="bk-badge">` + slots["default"] + `</span>`), nil
+	})
+	r.Register("bk-box", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<div class="bk-box">` + slots["default"] + `</div>`), nil
+	})
+	r.RegisterCSS("bk-card", ".bk-card { padding: 1rem; }")
+	r.RegisterCSS("bk-badge", ".bk-badge { font-size: 0.75rem; }")
+	return r
+}
+
+// benchPage returns a page with n cards, each holding a title slot and a
+// badge.
+func benchPage(n int) []byte {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><title>Bench</title></head><body><main>")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `<bk-card variant="primary"><bk-slot name="title">Item %d</bk-slot><p>Some text about item %d.</p><bk-badge>new</bk-badge></bk-card>`, i, i)
+	}
+	b.WriteString("</main></body></html>")
+	return []byte(b.String())
+}
+
+// benchNestedPage returns a page with depth components nested in each
+// other.
+func benchNestedPage(depth int) []byte {
+	return []byte("<!DOCTYPE html><html><head></head><body>" +
+		strings.Repeat("<bk-box>", depth) + "<p>deep</p>" + strings.Repeat("</bk-box>", depth) +
+		"</body></html>")
+}
+
+// Allocation budget for expanding a page, as documented in the README:
+// each component may allocate perComponentAllocs times, counting its
+// share of the page around it, plus perPageAllocs for the page itself.
+const (
+	perComponentAllocs = 32
+	perPageAllocs      = 100
+)
+
+func TestExpansionAllocationBudget(t *testing.T) {
+	registry := benchRegistry()
+	for _, n := range []int{100, 1000} {
+		page := benchPage(n)
+		components := 2 * n // a card and a badge per item
+
+		allocs := testing.AllocsPerRun(5, func() {
+			if _, err := expandComponents(page, registry, "", false); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if budget := float64(perPageAllocs + components*perComponentAllocs); allocs > budget {
+			t.Errorf("%d components: %.0f allocations, budget is %.0f", components, allocs, budget)
+		}
+	}
+}
+
+func TestExpanderMiddlewareSkipsPagesWithoutComponents(t *testing.T) {
+	page := "<!DOCTYPE html>\n<html><head></head><body><p>Plain &amp; simple</p></body></html>\n"
+	app := buffalo.New(buffalo.Options{})
+	app.Use(ExpanderMiddleware(benchRegistry(), false))
+	app.GET("/", func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, render.Func("text/html", func(w io.Writer, d render.Data) error {
+			_, err := w.Write([]byte(page))
+			return err
+		}))
+	})
+
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	if res.Body.String() != page {
+		t.Errorf("expected the page untouched, got %q", res.Body.String())
+	}
+}
+
+func BenchmarkExpand(b *testing.B) {
+	registry := benchRegistry()
+	pages := []struct {
+		name string
+		page []byte
+	}{
+		{"100", benchPage(50)},
+		{"1000", benchPage(500)},
+		{"nested-50", benchNestedPage(50)},
+		{"plain", benchPage(0)},
+	}
+	for _, p := range pages {
+		b.Run(p.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(p.page)))
+			for i := 0; i < b.N; i++ {
+				if _, err := expandComponents(p.page, registry, "", false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExpanderMiddleware(b *testing.B) {
+	for _, n := range []int{50, 500} {
+		page := benchPage(n)
+		app := buffalo.New(buffalo.Options{})
+		app.Use(ExpanderMiddleware(benchRegistry(), false))
+		app.GET("/", func(c buffalo.Context) error {
+			return c.Render(http.StatusOK, render.Func("text/html", func(w io.Writer, d render.Data) error {
+				_, err := w.Write(page)
+				return err
+			}))
+		})
+
+		b.Run(fmt.Sprint(2*n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				res := httptest.NewRecorder()
+				app.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+				if res.Code != http.StatusOK {
+					b.Fatalf("status %d", res.Code)
+				}
+			}
+		})
+	}
+}
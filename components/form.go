@@ -0,0 +1,139 @@
+package components
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/forms"
+	"github.com/johnjansen/buffkit/secure"
+	"golang.org/x/net/html"
+)
+
+// formCSS styles the error summary with the theme tokens.
+const formCSS = `.bk-form-errors { margin: 0 0 1rem; padding: 0.75rem 1rem; border: 2px solid var(--bk-danger, #dc2626); border-radius: var(--bk-radius, 6px); }
+.bk-form-errors h2 { margin: 0 0 0.5rem; font-size: 1rem; color: var(--bk-danger, #dc2626); }
+.bk-form-errors ul { margin: 0; padding-left: 1.25rem; }
+.bk-form-errors a { color: var(--bk-danger, #dc2626); }`
+
+// RegisterForm registers <bk-form>, a form that takes care of the
+// plumbing around its fields:
+//
+//	<bk-form action="/posts/<%= post.ID %>" method="PUT" hx="true" hx-target="#post">
+//	    <input id="title" name="title" value="<%= post.Title %>">
+//	    <button>Save</button>
+//	</bk-form>
+//
+// It adds the CSRF token field, sends PUT, PATCH and DELETE as a POST
+// with a _method field (which Buffalo's method override honours), and
+// lists the errors recorded with forms.SetErrors in an error summary
+// that screen readers announce. Each message links to the input whose
+// id is its field name. With hx="true" the form also submits through
+// htmx. Other attributes are copied to the <form>.
+func (r *Registry) RegisterForm() {
+	r.RegisterContext("bk-form", renderForm)
+	r.RegisterCSS("bk-form", formCSS)
+}
+
+func renderForm(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+	method := strings.ToUpper(attrs["method"])
+	if method == "" {
+		method = http.MethodPost
+	}
+	formMethod := method
+	switch method {
+	case http.MethodGet, http.MethodPost:
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		formMethod = http.MethodPost
+	default:
+		return nil, fmt.Errorf("bk-form: unsupported method %q", method)
+	}
+	action := attrs["action"]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<form action="%s" method="%s"`, html.EscapeString(action), formMethod)
+	if attrs["hx"] == "true" {
+		fmt.Fprintf(&b, ` hx-%s="%s"`, strings.ToLower(method), html.EscapeString(action))
+	}
+	for _, name := range sortedAttrNames(attrs) {
+		switch name {
+		case "action", "method", "hx":
+			continue
+		}
+		if !validAttrName(name) {
+			continue
+		}
+		fmt.Fprintf(&b, ` %s="%s"`, name, html.EscapeString(attrs[name]))
+	}
+	b.WriteString(">")
+
+	if c != nil && method != http.MethodGet {
+		if token := secure.CSRFToken(c); token != "" {
+			fmt.Fprintf(&b, `<input type="hidden" name="authenticity_token" value="%s">`, html.EscapeString(token))
+		}
+	}
+	if formMethod != method {
+		fmt.Fprintf(&b, `<input type="hidden" name="_method" value="%s">`, method)
+	}
+	if c != nil {
+		writeErrorSummary(&b, forms.ErrorsFor(c))
+	}
+	b.WriteString(slots["default"])
+	b.WriteString("</form>")
+	return []byte(b.String()), nil
+}
+
+// writeErrorSummary writes the error summary for errs, if there are any.
+func writeErrorSummary(b *strings.Builder, errs forms.Errors) {
+	if !errs.Any() {
+		return
+	}
+	count := 0
+	for _, field := range errs.Fields() {
+		count += len(errs.Get(field))
+	}
+	title := "There is a problem"
+	if count > 1 {
+		title = fmt.Sprintf("There are %d problems", count)
+	}
+
+	b.WriteString(`<div class="bk-form-errors" role="alert" tabindex="-1" aria-labelledby="bk-form-errors-title">`)
+	fmt.Fprintf(b, `<h2 id="bk-form-errors-title">%s</h2><ul>`, title)
+	for _, field := range errs.Fields() {
+		for _, msg := range errs.Get(field) {
+			if field == "" {
+				fmt.Fprintf(b, `<li>%s</li>`, html.EscapeString(msg))
+			} else {
+				fmt.Fprintf(b, `<li><a href="#%s">%s</a></li>`, html.EscapeString(field), html.EscapeString(msg))
+			}
+		}
+	}
+	b.WriteString(`</ul></div>`)
+}
+
+// sortedAttrNames returns the attribute names in attrs, sorted, so
+// rendering is deterministic.
+func sortedAttrNames(attrs map[string]string) []string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validAttrName reports whether name is safe to copy into markup as an
+// attribute name, e.g. class, data-id or hx-on:click.
+func validAttrName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-_:.@", r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package components_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/forms"
+)
+
+// renderForm serves page through the expander, with errs recorded on
+// the request, and returns the body.
+func renderForm(t *testing.T, page string, errs forms.Errors) string {
+	t.Helper()
+	registry := components.NewRegistry()
+	registry.RegisterForm()
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(components.ExpanderMiddleware(registry, false))
+	app.GET("/page", func(c buffalo.Context) error {
+		c.Set("authenticity_token", "tok<en>")
+		if errs != nil {
+			forms.SetErrors(c, errs)
+		}
+		return c.Render(http.StatusOK, render.Func("text/html", func(w io.Writer, _ render.Data) error {
+			_, err := io.WriteString(w, page)
+			return err
+		}))
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Body.String()
+}
+
+func TestFormComponent(t *testing.T) {
+	body := renderForm(t, `<html><head></head><body><bk-form action="/posts/1" method="put" class="post" hx="true" hx-target="#post"><input id="title" name="title"></bk-form></body></html>`, nil)
+
+	for _, want := range []string{
+		`<form action="/posts/1" method="POST" hx-put="/posts/1" class="post" hx-target="#post">`,
+		`<input type="hidden" name="authenticity_token" value="tok&lt;en&gt;"/>`,
+		`<input type="hidden" name="_method" value="PUT"/>`,
+		`<input id="title" name="title"/></form>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "bk-form-errors\"") {
+		t.Errorf("expected no error summary without errors, got:\n%s", body)
+	}
+}
+
+func TestFormComponentGET(t *testing.T) {
+	body := renderForm(t, `<html><body><bk-form action="/search" method="get"><input name="q"></bk-form></body></html>`, nil)
+	if !strings.Contains(body, `<form action="/search" method="GET">`) {
+		t.Errorf("expected a GET form, got:\n%s", body)
+	}
+	if strings.Contains(body, "authenticity_token") || strings.Contains(body, "_method") {
+		t.Errorf("expected no CSRF or override fields on a GET form, got:\n%s", body)
+	}
+}
+
+func TestFormComponentErrorSummary(t *testing.T) {
+	errs := forms.Errors{}
+	errs.Add("title", "Enter a title")
+	errs.Add("", "Could not <save>")
+	body := renderForm(t, `<html><body><bk-form action="/posts"><input id="title" name="title"></bk-form></body></html>`, errs)
+
+	for _, want := range []string{
+		`<div class="bk-form-errors" role="alert" tabindex="-1" aria-labelledby="bk-form-errors-title">`,
+		`<h2 id="bk-form-errors-title">There are 2 problems</h2>`,
+		`<li>Could not &lt;save&gt;</li><li><a href="#title">Enter a title</a></li>`,
+		`.bk-form-errors {`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package components
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	gfm "github.com/gobuffalo/github_flavored_markdown"
+	"golang.org/x/net/html"
+)
+
+// markdownCSS styles rendered markdown with the theme tokens.
+const markdownCSS = `.bk-markdown table { border-collapse: collapse; }
+.bk-markdown th, .bk-markdown td { padding: 0.25rem 0.75rem; border: 1px solid var(--bk-border, #e4e4e7); }
+.bk-markdown pre { padding: 0.75rem; overflow-x: auto; background: var(--bk-surface, #f4f4f5); border-radius: var(--bk-radius, 6px); }
+.bk-markdown .anchor { display: none; }`
+
+// codeBlock matches a fenced code block with a language, as rendered by
+// Markdown.
+var codeBlock = regexp.MustCompile(`(?s)<div class="highlight highlight-([^"]*)"><pre>(.*?)</pre></div>`)
+
+// Markdown renders text as GitHub Flavored Markdown (CommonMark plus
+// tables, fenced code and task lists), sanitized so it's safe to show
+// even when users wrote it: scripts, event handlers and javascript:
+// links are removed.
+func Markdown(text string) string {
+	return string(gfm.Markdown([]byte(text)))
+}
+
+// highlightCode highlights the fenced code blocks with a language in
+// rendered markdown, as Highlight does.
+func highlightCode(rendered string) string {
+	return codeBlock.ReplaceAllStringFunc(rendered, func(block string) string {
+		m := codeBlock.FindStringSubmatch(block)
+		code, err := Highlight(html.UnescapeString(m[2]), html.UnescapeString(m[1]))
+		if err != nil {
+			return block
+		}
+		return fmt.Sprintf(`<div class="highlight highlight-%s">%s</div>`, m[1], code)
+	})
+}
+
+// RegisterMarkdown registers <bk-markdown>, which renders markdown from
+// its text attribute or, failing that, its content:
+//
+//	<bk-markdown text="<%= post.Body %>"></bk-markdown>
+//	<bk-markdown highlight="true">
+//	    ## Install
+//	    ```sh
+//	    go get github.com/johnjansen/buffkit
+//	    ```
+//	</bk-markdown>
+//
+// Content is dedented first, so it can follow the template's
+// indentation. It arrives as HTML, so entities stay entities in text,
+// which markdown shows as the characters, but are decoded inside fenced
+// code blocks, which show text verbatim. Prefer the text attribute for user-provided markdown,
+// which Plush escapes on the way in. highlight="true" highlights the code
+// blocks like <bk-code>, colored by the CodeStylesheet.
+func (r *Registry) RegisterMarkdown() {
+	r.Register("bk-markdown", func(attrs, slots map[string]string) ([]byte, error) {
+		text, ok := attrs["text"]
+		if !ok {
+			text = unescapeFences(dedent(slots["default"]))
+		}
+		rendered := Markdown(text)
+		if attrs["highlight"] == "true" {
+			rendered = highlightCode(rendered)
+		}
+		return []byte(`<div class="bk-markdown">` + rendered + `</div>`), nil
+	})
+	r.RegisterCSS("bk-markdown", markdownCSS)
+}
+
+// dedent removes the indentation common to every non-blank line of s,
+// and any blank lines around it.
+func dedent(s string) string {
+	lines := strings.Split(s, "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	indent := ""
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if i == 0 {
+			indent = lead
+		}
+		for !strings.HasPrefix(lead, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, indent)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unescapeFences decodes the HTML entities inside the fenced code blocks
+// of text.
+func unescapeFences(text string) string {
+	lines := strings.Split(text, "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fence = trimmed[:3]
+		case fence != "" && strings.HasPrefix(trimmed, fence):
+			fence = ""
+		case fence != "":
+			lines[i] = html.UnescapeString(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
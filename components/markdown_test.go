@@ -0,0 +1,57 @@
+package components_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnjansen/buffkit/components"
+)
+
+func TestMarkdownSanitizes(t *testing.T) {
+	out := components.Markdown("Hi <script>alert(1)</script> [x](javascript:alert(1)) <b onclick=\"x()\">bold</b>\n\n| a | b |\n|---|---|\n| 1 | 2 |\n")
+	for _, unwanted := range []string{"<script", "javascript:", "onclick"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("expected %s to be removed, got:\n%s", unwanted, out)
+		}
+	}
+	for _, want := range []string{"<b>bold</b>", "<th>a</th>", "<td>2</td>"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMarkdownComponent(t *testing.T) {
+	registry := components.NewRegistry()
+	registry.RegisterMarkdown()
+
+	out, err := registry.Render("bk-markdown", map[string]string{"text": "**Hello** & <i>welcome</i>"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out); got != "<div class=\"bk-markdown\"><p><strong>Hello</strong> &amp; <i>welcome</i></p>\n</div>" {
+		t.Errorf("unexpected output %q", got)
+	}
+
+	// Indented content, as it appears in a template, with a code block
+	content := "\n    Some &lt;text&gt;\n\n    ```go\n    if a &lt; b {\n        return \"x\"\n    }\n    ```\n  "
+	out, err = registry.Render("bk-markdown", map[string]string{"highlight": "true"}, map[string]string{"default": content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<p>Some &lt;text&gt;</p>",
+		`<div class="highlight highlight-go"><pre class="bk-chroma"><code><span class="bk-line"><span class="bk-cl"><span class="bk-k">if</span>`,
+		`<span class="bk-p">&lt;</span>`,
+		`<span class="bk-s">&#34;x&#34;</span>`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %s in:\n%s", want, out)
+		}
+	}
+
+	out, _ = registry.Render("bk-markdown", nil, map[string]string{"default": "```go\nif a {}\n```"})
+	if strings.Contains(string(out), "<span") {
+		t.Errorf("expected no highlighting by default, got:\n%s", out)
+	}
+}
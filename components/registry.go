@@ -15,9 +15,15 @@
 //	    <p>Card content goes here</p>
 //	</bk-card>
 //
+// A renderer can also leave <bk-slot> elements in its output to mark where
+// slot content goes; their children are the default used when the caller
+// doesn't fill that slot:
+//
+//	<div class="card"><bk-slot name="footer">No footer</bk-slot></div>
+//
 // The system supports:
 //   - Custom attributes passed to components
-//   - Named slots for content distribution
+//   - Named slots for content distribution, with default content
 //   - Nested components
 //   - Shadowing (apps can override built-in components)
 //
@@ -27,12 +33,22 @@ package components
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/tenancy"
+	"github.com/johnjansen/buffkit/timing"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // Renderer is a function that renders a component.
@@ -51,6 +67,31 @@ import (
 // attributes and content into HTML, making them easy to test and reason about.
 type Renderer func(attrs map[string]string, slots map[string]string) ([]byte, error)
 
+// ContextRenderer renders a component that needs the request it's
+// rendered for, e.g. a form embedding the CSRF token. c is nil when the
+// component is rendered outside a request, through Render or Expand.
+type ContextRenderer func(c buffalo.Context, attrs map[string]string, slots map[string]string) ([]byte, error)
+
+// Slots is the slot content passed to a Renderer, keyed by slot name.
+// Convert the renderer's slots argument to use its helpers:
+//
+//	footer := components.Slots(slots).GetOr("footer", "<small>No footer</small>")
+type Slots map[string]string
+
+// GetOr returns the content of the named slot, or fallback when the caller
+// didn't provide it (or provided only whitespace).
+func (s Slots) GetOr(name, fallback string) string {
+	if content := s[name]; strings.TrimSpace(content) != "" {
+		return content
+	}
+	return fallback
+}
+
+// Has reports whether the caller provided non-blank content for the slot.
+func (s Slots) Has(name string) bool {
+	return strings.TrimSpace(s[name]) != ""
+}
+
 // Registry manages server-side components.
 // It's the central repository for all registered components in the application.
 // Components are registered by name (e.g., "bk-button") with their renderer function.
@@ -61,6 +102,41 @@ type Registry struct {
 	// components maps component names to their renderer functions.
 	// Names should follow the pattern "bk-*" to avoid conflicts with HTML elements.
 	components map[string]Renderer
+
+	// contextual maps component names to renderers that receive the
+	// request. A name is in components or contextual, never both.
+	contextual map[string]ContextRenderer
+
+	// overrides maps a scope (a tenant ID) to renderers that shadow the
+	// shared components for that scope only.
+	overrides map[string]map[string]Renderer
+
+	// styles maps component names to their CSS, emitted only on pages
+	// that use the component.
+	styles map[string]string
+
+	// datasets maps dataset names to the data <bk-table> renders.
+	datasets map[string]Dataset
+
+	// charts maps data source names to the providers <bk-chart> plots.
+	charts map[string]ChartProvider
+
+	// timeouts bound component renders for a request, by name; "" is
+	// the default for components without their own.
+	timeouts map[string]time.Duration
+
+	// prefetchers see a page's components before any of them renders.
+	prefetchers map[string]Prefetcher
+
+	// usage counts renders when TrackUsage is on (dev mode), else nil.
+	usage *Usage
+
+	// tablesPath is where TableHandler is mounted, set by RegisterTable.
+	tablesPath string
+
+	// mu protects the maps; overrides may be registered while serving
+	// requests, e.g. when a tenant's theme is loaded lazily.
+	mu sync.RWMutex
 }
 
 // NewRegistry creates a new component registry.
@@ -71,7 +147,14 @@ type Registry struct {
 //	app.Use(components.ExpanderMiddleware(registry))
 func NewRegistry() *Registry {
 	return &Registry{
-		components: make(map[string]Renderer),
+		components:  make(map[string]Renderer),
+		contextual:  make(map[string]ContextRenderer),
+		overrides:   make(map[string]map[string]Renderer),
+		styles:      make(map[string]string),
+		datasets:    make(map[string]Dataset),
+		charts:      make(map[string]ChartProvider),
+		timeouts:    make(map[string]time.Duration),
+		prefetchers: make(map[string]Prefetcher),
 	}
 }
 
@@ -89,7 +172,118 @@ func NewRegistry() *Registry {
 // Components can be overridden by registering a new renderer with the same name.
 // This allows apps to customize built-in components.
 func (r *Registry) Register(name string, renderer Renderer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.components[name] = renderer
+	delete(r.contextual, name)
+}
+
+// RegisterContext adds a component whose renderer receives the request:
+//
+//	registry.RegisterContext("bk-greeting", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+//	    if c == nil {
+//	        return []byte("Hello"), nil
+//	    }
+//	    return []byte("Hello " + c.Param("name")), nil
+//	})
+//
+// It replaces a component registered with Register under the same name,
+// and vice versa.
+func (r *Registry) RegisterContext(name string, renderer ContextRenderer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.contextual[name] = renderer
+	delete(r.components, name)
+}
+
+// Prefetcher is told about a component on the page being expanded before
+// any component renders, so it can queue what the component will load.
+type Prefetcher func(c buffalo.Context, attrs map[string]string)
+
+// RegisterPrefetch has p see each <name> on a page before the page's
+// components render, so their data loads in one batch rather than one
+// query per component (see the loader package):
+//
+//	registry.RegisterPrefetch("bk-avatar", func(c buffalo.Context, attrs map[string]string) {
+//	    Users.Queue(c, attrs["user-id"])
+//	})
+//
+// Prefetchers only run for requests, not for Expand.
+func (r *Registry) RegisterPrefetch(name string, p Prefetcher) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prefetchers[name] = p
+}
+
+// RegisterFor adds a component override for a single scope, typically a
+// tenant ID. During expansion, a request whose tenant matches scope gets
+// this renderer instead of the shared one:
+//
+//	registry.RegisterFor(tenant.ID, "bk-header", acmeHeader)
+//
+// Other tenants keep rendering the shared component.
+func (r *Registry) RegisterFor(scope, name string, renderer Renderer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.overrides[scope] == nil {
+		r.overrides[scope] = make(map[string]Renderer)
+	}
+	r.overrides[scope][name] = renderer
+}
+
+// RegisterCSS associates CSS with a component. When the expansion
+// middleware renders a page, it collects the CSS of the components that
+// page actually uses and injects it once, in a single <style> block in
+// <head>. Pages that don't use the component never carry its CSS:
+//
+//	registry.Register("bk-alert", renderAlert)
+//	registry.RegisterCSS("bk-alert", `.bk-alert { padding: 1rem; border-radius: 4px; }`)
+//
+// Registering again replaces the component's CSS.
+func (r *Registry) RegisterCSS(name, css string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.styles[name] = css
+}
+
+// CSSFor returns the combined CSS for the named components, in name order
+// with duplicates removed. Components without CSS are skipped.
+func (r *Registry) CSSFor(names ...string) string {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var b strings.Builder
+	for i, name := range sorted {
+		if i > 0 && sorted[i-1] == name {
+			continue
+		}
+		css := strings.TrimSpace(r.styles[name])
+		if css == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "/* %s */\n%s\n", name, css)
+	}
+	return b.String()
+}
+
+// Names returns the names of the shared components, sorted. Per-scope
+// overrides aren't included.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.components)+len(r.contextual))
+	for name := range r.components {
+		names = append(names, name)
+	}
+	for name := range r.contextual {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // RegisterDefaults is deprecated and does nothing.
@@ -112,16 +306,181 @@ func (r *Registry) RegisterDefaults() {
 // If the component doesn't exist, an error is returned and the original
 // tag is preserved in the HTML (graceful degradation).
 //
+// A renderer that panics does not take the whole response down with it.
+// The panic is recovered, logged with its stack trace, and returned as a
+// *PanicError so callers can decide how to present the failure.
+//
 // This method is called by the expansion middleware when it encounters
 // a <bk-*> tag in the HTML.
 func (r *Registry) Render(name string, attrs map[string]string, slots map[string]string) ([]byte, error) {
-	renderer, exists := r.components[name]
+	return r.RenderFor("", name, attrs, slots)
+}
+
+// RenderFor renders a component, preferring the override registered for
+// scope and falling back to the shared component. An empty scope always
+// uses the shared component.
+func (r *Registry) RenderFor(scope, name string, attrs map[string]string, slots map[string]string) ([]byte, error) {
+	return r.renderIn(nil, scope, name, attrs, slots)
+}
+
+// RenderContext is RenderFor bounded by ctx: it fails with ctx's error
+// once ctx is done, and enforces the component's timeout (SetTimeout).
+// When ctx is the request's buffalo.Context, components registered with
+// RegisterContext receive it, carrying the deadline.
+func (r *Registry) RenderContext(ctx context.Context, scope, name string, attrs map[string]string, slots map[string]string) ([]byte, error) {
+	return r.renderIn(ctx, scope, name, attrs, slots)
+}
+
+// SetTimeout limits how long the named component may take to render for
+// a request, or every component without a timeout of its own when name
+// is "". A component that takes longer is abandoned with a *TimeoutError
+// and the expander leaves its tag in place. Zero removes the limit.
+func (r *Registry) SetTimeout(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d <= 0 {
+		delete(r.timeouts, name)
+		return
+	}
+	r.timeouts[name] = d
+}
+
+// TimeoutError is returned when a component exceeds its timeout.
+type TimeoutError struct {
+	Component string
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("component %s timed out after %s", e.Component, e.Timeout)
+}
+
+// Unwrap makes errors.Is(err, context.DeadlineExceeded) hold.
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// renderIn renders a component bounded by ctx, which may be nil. When
+// ctx is a buffalo.Context it's also the request contextual components
+// receive.
+func (r *Registry) renderIn(ctx context.Context, scope, name string, attrs map[string]string, slots map[string]string) ([]byte, error) {
+	r.mu.RLock()
+	renderer, exists := r.overrides[scope][name]
+	var contextual ContextRenderer
+	var isContextual bool
+	if !exists || scope == "" {
+		renderer, exists = r.components[name]
+		if contextual, isContextual = r.contextual[name]; isContextual {
+			exists = true
+		}
+	}
+	timeout, ok := r.timeouts[name]
+	if !ok {
+		timeout = r.timeouts[""]
+	}
+	usage := r.usage
+	r.mu.RUnlock()
+
 	if !exists {
 		// Return error so the original tag is preserved
 		// This allows graceful degradation if a component isn't registered
 		return nil, fmt.Errorf("component %s not found", name)
 	}
 
+	// Only a request is worth bounding; Render alone runs to completion
+	c, _ := ctx.(buffalo.Context)
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+	if isContextual {
+		if c != nil && timeout > 0 {
+			c = deadlineContext{Context: c, ctx: ctx}
+		}
+		renderer = func(attrs, slots map[string]string) ([]byte, error) {
+			return contextual(c, attrs, slots)
+		}
+	}
+
+	var out []byte
+	var err error
+	if ctx != nil && timeout > 0 {
+		out, err = renderWithin(ctx, timeout, name, renderer, attrs, slots)
+	} else {
+		out, err = safeRender(name, renderer, attrs, slots)
+	}
+	if err == nil && usage != nil {
+		usage.record(name, attrs, out)
+	}
+	return out, err
+}
+
+// renderWithin runs the renderer until ctx is done. A renderer that
+// ignores ctx keeps running in the background, but the page no longer
+// waits for it.
+func renderWithin(ctx context.Context, timeout time.Duration, name string, renderer Renderer, attrs, slots map[string]string) ([]byte, error) {
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := safeRender(name, renderer, attrs, slots)
+		done <- result{out, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.out, res.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("Components: %s timed out after %s", name, timeout)
+			return nil, &TimeoutError{Component: name, Timeout: timeout}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// deadlineContext is a request context bounded by a component's timeout.
+type deadlineContext struct {
+	buffalo.Context
+	ctx context.Context
+}
+
+func (c deadlineContext) Deadline() (time.Time, bool) { return c.ctx.Deadline() }
+func (c deadlineContext) Done() <-chan struct{}       { return c.ctx.Done() }
+func (c deadlineContext) Err() error                  { return c.ctx.Err() }
+
+// PanicError is returned by Render when a component's renderer panics.
+// It carries the recovered value so the expansion middleware can emit a
+// useful placeholder in development mode.
+type PanicError struct {
+	Component string      // Name of the component that panicked
+	Value     interface{} // Value passed to panic()
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("component %s panicked: %v", e.Component, e.Value)
+}
+
+// safeRender calls the renderer and converts a panic into a *PanicError.
+// WHY: Renderers are app code and may dereference nil data or index out
+// of range. One broken component should not crash whole-page rendering.
+func safeRender(name string, renderer Renderer, attrs, slots map[string]string) (out []byte, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("Components: %s panicked during render: %v\n%s", name, rec, debug.Stack())
+			out = nil
+			err = &PanicError{Component: name, Value: rec}
+		}
+	}()
+
 	return renderer(attrs, slots)
 }
 
@@ -141,6 +500,12 @@ func (r *Registry) Render(name string, attrs map[string]string, slots map[string
 // When devMode is true, component boundary comments are added to help
 // with debugging (e.g., <!-- bk-button --> ... <!-- /bk-button -->).
 //
+// A handler that flushes (views.Stream does) switches the response to
+// streaming: what it wrote so far is expanded and sent at once, and so on
+// at every flush. A component must be written whole between flushes, and
+// the CSS of components first used after the <head> was sent goes in a
+// <style> right before them.
+//
 // Usage:
 //
 //	app.Use(components.ExpanderMiddleware(registry, devMode))
@@ -156,19 +521,63 @@ func ExpanderMiddleware(registry *Registry, devMode bool) buffalo.MiddlewareFunc
 			// before sending to the client.
 			wrapper := &responseWrapper{
 				ResponseWriter: c.Response(),
-				body:           &bytes.Buffer{},
+				body:           getBuffer(),
 				statusCode:     http.StatusOK,
 			}
+			defer putBuffer(wrapper.body)
 
-			// Replace response writer with our wrapper
-			oldWriter := c.Response()
-			c.Set("res", wrapper)
+			// Resolve the tenant so its component overrides take effect
+			scope := ""
+			if t := tenancy.Current(c); t != nil {
+				scope = t.ID
+			}
+			wrapper.stream = &expansion{c: c, registry: registry, scope: scope, devMode: devMode}
 
-			// Call the actual handler
-			err := next(c)
+			// Route the handler's writes into our wrapper. Buffalo's
+			// own Render writes through its *buffalo.Response, so swap
+			// the writer inside that; otherwise hand the handler a
+			// context whose Response is the wrapper.
+			oldWriter := c.Response()
+			var err error
+			if res, ok := oldWriter.(*buffalo.Response); ok {
+				wrapper.ResponseWriter = res.ResponseWriter
+				res.ResponseWriter = wrapper
+				// SkipExpansion hands the handler the real writer back
+				skipped := false
+				c.Set(skipExpansionKey, func() {
+					if !skipped && !wrapper.streaming && res.ResponseWriter == wrapper {
+						skipped = true
+						res.ResponseWriter = wrapper.ResponseWriter
+					}
+				})
+				err = next(c)
+				if skipped {
+					return err
+				}
+				res.ResponseWriter = wrapper.ResponseWriter
+				// Only the wrapper saw the status; let it be written for
+				// real, unless streaming already has
+				res.Status = 0
+				if wrapper.streaming {
+					defer func() {
+						res.Status = wrapper.statusCode
+						res.Size += wrapper.written
+					}()
+				}
+			} else {
+				err = next(&capturingContext{Context: c, res: wrapper})
+			}
 
-			// Restore original writer for final output
-			c.Set("res", oldWriter)
+			// A streamed response has started; send the rest of it
+			if wrapper.streaming {
+				if sendErr := wrapper.send(); err == nil {
+					err = sendErr
+				}
+				if err == nil {
+					err = wrapper.err
+				}
+				return err
+			}
 
 			if err != nil {
 				return err
@@ -176,8 +585,10 @@ func ExpanderMiddleware(registry *Registry, devMode bool) buffalo.MiddlewareFunc
 
 			// Only process HTML responses.
 			// Skip JSON, images, downloads, etc.
+			// Pages without components go out as they were written,
+			// without the cost of parsing them
 			contentType := wrapper.Header().Get("Content-Type")
-			if !strings.Contains(contentType, "text/html") {
+			if !strings.Contains(contentType, "text/html") || !hasTag(wrapper.body.Bytes(), "bk-") {
 				// Write original content unchanged
 				oldWriter.WriteHeader(wrapper.statusCode)
 				_, writeErr := oldWriter.Write(wrapper.body.Bytes())
@@ -185,8 +596,9 @@ func ExpanderMiddleware(registry *Registry, devMode bool) buffalo.MiddlewareFunc
 			}
 
 			// Expand components in the captured HTML
-			expanded, err := expandComponents(wrapper.body.Bytes(), registry, devMode)
-			if err != nil {
+			expanded := getBuffer()
+			defer putBuffer(expanded)
+			if err := expandInto(expanded, c, wrapper.body.Bytes(), registry, scope, devMode); err != nil {
 				// On error, send original HTML
 				// Better to show unexpanded components than error page
 				oldWriter.WriteHeader(wrapper.statusCode)
@@ -196,12 +608,19 @@ func ExpanderMiddleware(registry *Registry, devMode bool) buffalo.MiddlewareFunc
 
 			// Write the expanded HTML to the client
 			oldWriter.WriteHeader(wrapper.statusCode)
-			_, err = oldWriter.Write(expanded)
+			_, err = oldWriter.Write(expanded.Bytes())
 			return err
 		}
 	}
 }
 
+// Expand expands the <bk-*> tags in an HTML document outside of a
+// request, using the shared components. The mail package uses it for
+// HTML message bodies. The result is always a whole document.
+func (r *Registry) Expand(content []byte) ([]byte, error) {
+	return expandComponents(content, r, "", false)
+}
+
 // expandComponents expands all <bk-*> tags in HTML.
 // This function parses the HTML, finds all component tags, and replaces them
 // with their rendered output.
@@ -212,105 +631,356 @@ func ExpanderMiddleware(registry *Registry, devMode bool) buffalo.MiddlewareFunc
 //  3. Extract attributes and slot content from each component
 //  4. Call the component's renderer
 //  5. Replace the component tag with rendered HTML
-//  6. Serialize the modified tree back to HTML
+//  6. Parse the page again with the rendered HTML in place, normalizing it
+//  7. Serialize the modified tree back to HTML
 //
-// Components can be nested - inner components are expanded first.
+// Components can be nested - inner components are expanded first, so
+// an outer component's slots hold their rendered HTML. Output a renderer
+// produces is not expanded again.
 // If a component fails to render, it's left unchanged (graceful degradation).
 //
 // TODO: This is a simplified implementation. Production version should:
-//   - Handle component recursion limits
 //   - Preserve HTML comments and doctype
-//   - Optimize for large documents
-func expandComponents(htmlContent []byte, registry *Registry, devMode bool) ([]byte, error) {
+func expandComponents(htmlContent []byte, registry *Registry, scope string, devMode bool) ([]byte, error) {
+	return expandComponentsIn(nil, htmlContent, registry, scope, devMode)
+}
+
+// expandComponentsIn is expandComponents for the request c, which
+// components registered with RegisterContext receive. c may be nil.
+func expandComponentsIn(c buffalo.Context, htmlContent []byte, registry *Registry, scope string, devMode bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := expandInto(&buf, c, htmlContent, registry, scope, devMode); err != nil {
+		return htmlContent, err
+	}
+	return buf.Bytes(), nil
+}
+
+// expandInto is expandComponentsIn writing the expanded page to buf, so
+// the middleware can reuse its buffers from one request to the next.
+func expandInto(buf *bytes.Buffer, c buffalo.Context, htmlContent []byte, registry *Registry, scope string, devMode bool) error {
+	defer timing.Start(c, timing.Components)()
+
 	doc, err := html.Parse(bytes.NewReader(htmlContent))
 	if err != nil {
-		return htmlContent, err
+		return err
+	}
+
+	e := &expansion{c: c, registry: registry, scope: scope, devMode: devMode}
+	e.prefetch(doc)
+	if err := e.expand(doc); err != nil {
+		return err
 	}
 
-	// Walk the tree and expand components.
-	// This is a recursive function that processes nodes depth-first.
-	var expand func(*html.Node) error
-	expand = func(n *html.Node) error {
-		if n.Type == html.ElementNode && strings.HasPrefix(n.Data, "bk-") {
-			// Found a component tag - extract its data
-			componentName := n.Data
+	// Parse the page again with the components' output in place, which
+	// normalizes that output as parsing each component's would have
+	if e.raw {
+		page := getBuffer()
+		defer putBuffer(page)
+		if err := html.Render(page, doc); err != nil {
+			return err
+		}
+		if doc, err = html.Parse(bytes.NewReader(page.Bytes())); err != nil {
+			return err
+		}
+	}
+
+	// Emit the CSS of the components actually used, once
+	if css := registry.CSSFor(e.used...); css != "" {
+		injectStyles(doc, css)
+	}
 
-			// Extract attributes from the component tag
-			attrs := make(map[string]string)
-			for _, attr := range n.Attr {
-				attrs[attr.Key] = attr.Val
+	// Render the modified tree back to HTML
+	return html.Render(buf, doc)
+}
+
+// expansion is the state of expanding one page for the request c, which
+// may be nil.
+type expansion struct {
+	c        buffalo.Context
+	registry *Registry
+	scope    string
+	devMode  bool
+
+	// Names of components rendered on this page, for CSS emission
+	used []string
+	// Whether component output went into the tree unparsed
+	raw bool
+	// Components whose CSS a streamed page has already sent
+	styled map[string]bool
+}
+
+// prefetch runs the prefetchers of the components in the tree under n.
+func (e *expansion) prefetch(n *html.Node) {
+	if e.c == nil {
+		return
+	}
+	e.registry.mu.RLock()
+	prefetchers := make(map[string]Prefetcher, len(e.registry.prefetchers))
+	for name, p := range e.registry.prefetchers {
+		prefetchers[name] = p
+	}
+	e.registry.mu.RUnlock()
+	if len(prefetchers) == 0 {
+		return
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if p, ok := prefetchers[n.Data]; ok {
+				attrs := make(map[string]string, len(n.Attr))
+				for _, attr := range n.Attr {
+					attrs[attr.Key] = attr.Val
+				}
+				p(e.c, attrs)
 			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+}
 
-			// Extract slot content (named and default slots)
-			slots := extractSlots(n)
+// expand expands the components in the tree under n.
+// This is a recursive function that processes nodes depth-first.
+func (e *expansion) expand(n *html.Node) error {
+	if n.Type == html.ElementNode && strings.HasPrefix(n.Data, "bk-") && n.Data != "bk-slot" {
+		// Found a component tag - extract its data
+		componentName := n.Data
 
-			// Render the component
-			rendered, err := registry.Render(n.Data, attrs, slots)
-			if err != nil {
-				// Keep original tag if rendering fails
-				// This allows the page to still work even if a component breaks
-				return nil
+		// Expand nested components first, so this component's slots
+		// receive their rendered output rather than raw <bk-*> tags
+		for child := n.FirstChild; child != nil; {
+			next := child.NextSibling
+			if err := e.expand(child); err != nil {
+				return err
 			}
+			child = next
+		}
 
-			// Parse the rendered HTML fragment
-			renderedDoc, err := html.ParseFragment(bytes.NewReader(rendered), &html.Node{
-				Type: html.ElementNode,
-				Data: "div",
-			})
-			if err != nil {
+		// Extract attributes from the component tag
+		attrs := make(map[string]string, len(n.Attr))
+		for _, attr := range n.Attr {
+			attrs[attr.Key] = attr.Val
+		}
+
+		// Extract slot content (named and default slots)
+		slots := extractSlots(n)
+
+		// Render the component
+		rendered, err := e.registry.renderIn(e.c, e.scope, n.Data, attrs, slots)
+		if err != nil {
+			// In development, replace a panicking component with a
+			// placeholder comment so the failure is visible in the source
+			var panicErr *PanicError
+			if e.devMode && errors.As(err, &panicErr) {
+				n.Parent.InsertBefore(&html.Node{
+					Type: html.CommentNode,
+					Data: " " + componentName + " render error: " + sanitizeComment(panicErr.Value) + " ",
+				}, n)
+				n.Parent.RemoveChild(n)
 				return nil
 			}
-
-			// Add component boundary comments in development mode
-			if devMode {
-				// Add start comment
-				startComment := &html.Node{
+			var timeoutErr *TimeoutError
+			if e.devMode && errors.As(err, &timeoutErr) {
+				n.Parent.InsertBefore(&html.Node{
 					Type: html.CommentNode,
-					Data: fmt.Sprintf(" %s ", componentName),
-				}
-				n.Parent.InsertBefore(startComment, n)
+					Data: " " + sanitizeComment(timeoutErr.Error()) + " ",
+				}, n)
+				n.Parent.RemoveChild(n)
+				return nil
 			}
 
-			// Replace the component node with rendered nodes
-			for _, newNode := range renderedDoc {
-				n.Parent.InsertBefore(newNode, n)
+			// The request is gone; stop rendering for it
+			if e.c != nil && e.c.Err() != nil {
+				return e.c.Err()
 			}
 
-			// Add end comment in development mode
-			if devMode {
-				endComment := &html.Node{
-					Type: html.CommentNode,
-					Data: fmt.Sprintf(" /%s ", componentName),
-				}
-				n.Parent.InsertBefore(endComment, n)
+			// Keep original tag if rendering fails
+			// This allows the page to still work even if a component breaks
+			return nil
+		}
+
+		// Fill <bk-slot> placeholders left in the rendered output with
+		// the caller's content, or their own default content. Output
+		// without any goes into the tree as is, to be parsed with the
+		// rest of the page at the end: a parse per component is most
+		// of what expansion would otherwise cost.
+		var renderedDoc []*html.Node
+		if hasTag(rendered, "bk-slot") {
+			parsed, err := parseFragment(rendered)
+			if err != nil {
+				return nil
 			}
+			renderedDoc = fillSlots(parsed, slots)
+		} else {
+			renderedDoc = []*html.Node{{Type: html.RawNode, Data: string(rendered)}}
+			e.raw = true
+		}
+		e.used = append(e.used, componentName)
 
-			n.Parent.RemoveChild(n)
+		// Add component boundary comments in development mode
+		if e.devMode {
+			// Add start comment
+			startComment := &html.Node{
+				Type: html.CommentNode,
+				Data: " " + componentName + " ",
+			}
+			n.Parent.InsertBefore(startComment, n)
+		}
 
-			return nil
+		// Replace the component node with rendered nodes
+		for _, newNode := range renderedDoc {
+			n.Parent.InsertBefore(newNode, n)
 		}
 
-		// Not a component - recurse to children
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if err := expand(c); err != nil {
-				return err
+		// Add end comment in development mode
+		if e.devMode {
+			endComment := &html.Node{
+				Type: html.CommentNode,
+				Data: " /" + componentName + " ",
 			}
+			n.Parent.InsertBefore(endComment, n)
 		}
 
+		n.Parent.RemoveChild(n)
+
 		return nil
 	}
 
-	if err := expand(doc); err != nil {
-		return htmlContent, err
+	// Not a component - recurse to children.
+	// Capture the next sibling first: expanding a child removes it
+	// from the tree, which clears its NextSibling pointer.
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if err := e.expand(c); err != nil {
+			return err
+		}
+		c = next
 	}
 
-	// Render the modified tree back to HTML
-	var buf bytes.Buffer
-	if err := html.Render(&buf, doc); err != nil {
-		return htmlContent, err
+	return nil
+}
+
+// injectStyles appends a <style data-bk-components> block to the
+// document's <head>.
+func injectStyles(doc *html.Node, css string) {
+	var head *html.Node
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if head != nil {
+			return
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Head {
+			head = n
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	if head == nil {
+		return
 	}
 
-	return buf.Bytes(), nil
+	head.AppendChild(styleElement(css))
+}
+
+// styleElement returns a <style data-bk-components> element holding css.
+func styleElement(css string) *html.Node {
+	// Style contents are raw text; make sure CSS can't close the element
+	css = strings.ReplaceAll(css, "</style", `<\/style`)
+
+	style := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "style",
+		DataAtom: atom.Style,
+		Attr:     []html.Attribute{{Key: "data-bk-components"}},
+	}
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: "\n" + css})
+	return style
+}
+
+// parseFragment parses HTML as the children of a <div>.
+func parseFragment(content []byte) ([]*html.Node, error) {
+	return html.ParseFragment(bytes.NewReader(content), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "div",
+		DataAtom: atom.Div,
+	})
+}
+
+// fillSlots replaces <bk-slot name="..."> elements in a component's
+// rendered output. A slot the caller provided is replaced by the caller's
+// content; otherwise the element is replaced by its own children, which
+// act as the slot's default content:
+//
+//	<footer><bk-slot name="footer">&copy; Acme</bk-slot></footer>
+//
+// An unnamed <bk-slot> refers to the default slot.
+func fillSlots(nodes []*html.Node, slots map[string]string) []*html.Node {
+	// Hang the fragment off a temporary root so top-level slots can be
+	// replaced like any other
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && c.Data == "bk-slot" {
+				name := "default"
+				for _, attr := range c.Attr {
+					if attr.Key == "name" {
+						name = attr.Val
+						break
+					}
+				}
+
+				if Slots(slots).Has(name) {
+					if provided, err := parseFragment([]byte(slots[name])); err == nil {
+						for _, p := range provided {
+							n.InsertBefore(p, c)
+						}
+					}
+				} else {
+					// Default content may itself contain slots
+					walk(c)
+					for d := c.FirstChild; d != nil; {
+						dn := d.NextSibling
+						c.RemoveChild(d)
+						n.InsertBefore(d, c)
+						d = dn
+					}
+				}
+				n.RemoveChild(c)
+			} else {
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(root)
+
+	var result []*html.Node
+	for c := root.FirstChild; c != nil; {
+		next := c.NextSibling
+		root.RemoveChild(c)
+		result = append(result, c)
+		c = next
+	}
+	return result
+}
+
+// sanitizeComment makes a value safe to embed in an HTML comment.
+// A "--" sequence would terminate the comment early and leak the rest
+// of the message into the page as markup.
+func sanitizeComment(v interface{}) string {
+	return strings.ReplaceAll(fmt.Sprint(v), "--", "- -")
 }
 
 // extractSlots extracts named slots from a component node.
@@ -334,7 +1004,9 @@ func expandComponents(htmlContent []byte, registry *Registry, devMode bool) ([]b
 // The component renderer can then place this content appropriately.
 func extractSlots(n *html.Node) map[string]string {
 	slots := make(map[string]string)
-	var defaultSlot bytes.Buffer
+	defaultSlot, slotBuf := getBuffer(), getBuffer()
+	defer putBuffer(defaultSlot)
+	defer putBuffer(slotBuf)
 
 	// Iterate through the component's children
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
@@ -349,14 +1021,14 @@ func extractSlots(n *html.Node) map[string]string {
 			}
 
 			// Extract the slot's content
-			var slotBuf bytes.Buffer
+			slotBuf.Reset()
 			for sc := c.FirstChild; sc != nil; sc = sc.NextSibling {
-				_ = html.Render(&slotBuf, sc)
+				_ = html.Render(slotBuf, sc)
 			}
 			slots[slotName] = slotBuf.String()
 		} else {
 			// Not a slot - this goes in the default slot
-			_ = html.Render(&defaultSlot, c)
+			_ = html.Render(defaultSlot, c)
 		}
 	}
 
@@ -368,6 +1040,32 @@ func extractSlots(n *html.Node) map[string]string {
 	return slots
 }
 
+// skipExpansionKey is where ExpanderMiddleware keeps, in the Buffalo
+// context, the func that takes the request out of expansion.
+const skipExpansionKey = "components.skip_expansion"
+
+// SkipExpansion sends the rest of the request c's response as the handler
+// writes it, unbuffered and unexpanded, for routes that must stream or
+// aren't pages (file downloads, SSE, webhooks). Call it before writing
+// anything; buffkit.Skip does. It does nothing outside ExpanderMiddleware.
+func SkipExpansion(c buffalo.Context) {
+	if skip, ok := c.Value(skipExpansionKey).(func()); ok {
+		skip()
+	}
+}
+
+// capturingContext is a buffalo.Context whose Response is the
+// middleware's responseWrapper, so everything the handler writes (through
+// c.Render or directly) is buffered for expansion.
+type capturingContext struct {
+	buffalo.Context
+	res http.ResponseWriter
+}
+
+func (c *capturingContext) Response() http.ResponseWriter {
+	return c.res
+}
+
 // responseWrapper captures response for processing.
 // This allows the middleware to buffer the entire response before
 // processing it for component expansion.
@@ -378,6 +1076,12 @@ type responseWrapper struct {
 	http.ResponseWriter               // Embed the original ResponseWriter
 	body                *bytes.Buffer // Buffer to capture response body
 	statusCode          int           // HTTP status code to preserve
+
+	// Set once the handler flushes; see Flush
+	stream    *expansion // expands the chunks as they're sent
+	streaming bool       // whether the status has been sent
+	written   int        // bytes sent so far
+	err       error      // the first error sending a chunk
 }
 
 func (w *responseWrapper) WriteHeader(statusCode int) {
@@ -387,3 +1091,41 @@ func (w *responseWrapper) WriteHeader(statusCode int) {
 func (w *responseWrapper) Write(b []byte) (int, error) {
 	return w.body.Write(b)
 }
+
+// hasTag reports whether content may contain a tag whose name starts with
+// prefix (lowercase), ignoring case as HTML does, so a page or a
+// component's output with nothing to expand needn't be parsed.
+func hasTag(content []byte, prefix string) bool {
+	for {
+		i := bytes.IndexByte(content, '<')
+		if i < 0 || len(content)-i-1 < len(prefix) {
+			return false
+		}
+		content = content[i+1:]
+		if bytes.EqualFold(content[:len(prefix)], []byte(prefix)) {
+			return true
+		}
+	}
+}
+
+// maxPooledBuffer is the largest buffer kept for reuse; the occasional
+// huge page shouldn't pin its memory for good.
+const maxPooledBuffer = 1 << 20
+
+// bufferPool recycles the buffers expansion goes through: the captured
+// response, slot contents and the expanded page.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
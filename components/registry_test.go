@@ -0,0 +1,309 @@
+package components
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/loader"
+)
+
+func TestRenderRecoversFromPanic(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("bk-broken", func(attrs, slots map[string]string) ([]byte, error) {
+		var m map[string]string
+		m["boom"] = "x" // nil map write panics
+		return nil, nil
+	})
+
+	_, err := registry.Render("bk-broken", nil, nil)
+	if err == nil {
+		t.Fatal("expected an error from a panicking renderer")
+	}
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected *PanicError, got %T", err)
+	}
+	if panicErr.Component != "bk-broken" {
+		t.Errorf("expected component bk-broken, got %s", panicErr.Component)
+	}
+}
+
+func TestExpandComponentsIsolatesPanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("bk-broken", func(attrs, slots map[string]string) ([]byte, error) {
+		panic("kaboom -- really")
+	})
+	registry.Register("bk-ok", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte("<span>fine</span>"), nil
+	})
+
+	page := []byte(`<html><body><bk-broken></bk-broken><bk-ok></bk-ok></body></html>`)
+
+	t.Run("dev mode emits placeholder comment", func(t *testing.T) {
+		out, err := expandComponents(page, registry, "", true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		html := string(out)
+		if !strings.Contains(html, "<!-- bk-broken render error: kaboom - - really -->") {
+			t.Errorf("expected placeholder comment, got %s", html)
+		}
+		if !strings.Contains(html, "<span>fine</span>") {
+			t.Errorf("expected sibling component to render, got %s", html)
+		}
+	})
+
+	t.Run("production keeps original tag", func(t *testing.T) {
+		out, err := expandComponents(page, registry, "", false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		html := string(out)
+		if !strings.Contains(html, "<bk-broken></bk-broken>") {
+			t.Errorf("expected original tag to be preserved, got %s", html)
+		}
+		if strings.Contains(html, "kaboom") {
+			t.Errorf("panic details must not leak in production, got %s", html)
+		}
+		if !strings.Contains(html, "<span>fine</span>") {
+			t.Errorf("expected sibling component to render, got %s", html)
+		}
+	})
+}
+
+func TestRenderForPrefersScopedOverride(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("bk-logo", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte("default"), nil
+	})
+	registry.RegisterFor("acme", "bk-logo", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte("acme"), nil
+	})
+
+	for scope, want := range map[string]string{"": "default", "acme": "acme", "globex": "default"} {
+		out, err := registry.RenderFor(scope, "bk-logo", nil, nil)
+		if err != nil {
+			t.Fatalf("scope %q: unexpected error: %v", scope, err)
+		}
+		if string(out) != want {
+			t.Errorf("scope %q: expected %q, got %q", scope, want, out)
+		}
+	}
+}
+
+func TestSlotDefaults(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("bk-panel", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<section><h2><bk-slot name="title">Untitled</bk-slot></h2>` +
+			`<bk-slot><p>Nothing here yet</p></bk-slot>` +
+			`<footer><bk-slot name="footer">&copy; Acme</bk-slot></footer></section>`), nil
+	})
+
+	t.Run("defaults are used for missing slots", func(t *testing.T) {
+		out, err := expandComponents([]byte(`<html><body><bk-panel></bk-panel></body></html>`), registry, "", false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `<section><h2>Untitled</h2><p>Nothing here yet</p><footer>© Acme</footer></section>`
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %s, got %s", want, out)
+		}
+	})
+
+	t.Run("provided slots replace defaults", func(t *testing.T) {
+		page := `<html><body><bk-panel><bk-slot name="title">Reports</bk-slot><em>3 new</em></bk-panel></body></html>`
+		out, err := expandComponents([]byte(page), registry, "", false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `<section><h2>Reports</h2><em>3 new</em><footer>© Acme</footer></section>`
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %s, got %s", want, out)
+		}
+		if strings.Contains(string(out), "bk-slot") {
+			t.Errorf("expected no bk-slot elements left, got %s", out)
+		}
+	})
+}
+
+func TestSlotsGetOr(t *testing.T) {
+	slots := Slots{"title": "Hello", "blank": "  \n"}
+	if got := slots.GetOr("title", "x"); got != "Hello" {
+		t.Errorf("expected provided slot, got %q", got)
+	}
+	if got := slots.GetOr("blank", "fallback"); got != "fallback" {
+		t.Errorf("expected fallback for blank slot, got %q", got)
+	}
+	if got := slots.GetOr("missing", "fallback"); got != "fallback" {
+		t.Errorf("expected fallback for missing slot, got %q", got)
+	}
+}
+
+func TestComponentCSSEmission(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("bk-alert", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<div class="bk-alert">` + slots["default"] + `</div>`), nil
+	})
+	registry.Register("bk-badge", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<span class="bk-badge"></span>`), nil
+	})
+	registry.RegisterCSS("bk-alert", ".bk-alert { padding: 1rem; }")
+	registry.RegisterCSS("bk-badge", ".bk-badge { color: red; }")
+
+	page := `<html><head><title>t</title></head><body><bk-alert>one</bk-alert><bk-alert>two</bk-alert></body></html>`
+	out, err := expandComponents([]byte(page), registry, "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := string(out)
+
+	if strings.Count(html, ".bk-alert { padding: 1rem; }") != 1 {
+		t.Errorf("expected alert CSS exactly once, got %s", html)
+	}
+	if strings.Contains(html, ".bk-badge") {
+		t.Errorf("expected unused component CSS to be left out, got %s", html)
+	}
+	if !strings.Contains(html, `<style data-bk-components="">`) || strings.Index(html, "<style") > strings.Index(html, "</head>") {
+		t.Errorf("expected a single style block in head, got %s", html)
+	}
+
+	t.Run("pages without styled components get no style block", func(t *testing.T) {
+		out, err := expandComponents([]byte(`<html><body><p>plain</p></body></html>`), registry, "", false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(string(out), "<style") {
+			t.Errorf("expected no style block, got %s", out)
+		}
+	})
+}
+
+func TestNestedComponentsExpandInnerFirst(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("bk-outer", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<div class="outer">` + slots["default"] + `<aside>` + slots["side"] + `</aside></div>`), nil
+	})
+	registry.Register("bk-inner", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<b>` + attrs["label"] + `</b>`), nil
+	})
+
+	page := `<html><body><bk-outer><bk-inner label="one"></bk-inner><bk-slot name="side"><bk-inner label="two"></bk-inner></bk-slot></bk-outer></body></html>`
+	out, err := expandComponents([]byte(page), registry, "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `<div class="outer"><b>one</b><aside><b>two</b></aside></div>`
+	if !strings.Contains(string(out), want) {
+		t.Errorf("expected %s, got %s", want, out)
+	}
+}
+
+func TestRenderContextTimeouts(t *testing.T) {
+	registry := NewRegistry()
+	release := make(chan struct{})
+	registry.Register("bk-slow", func(attrs, slots map[string]string) ([]byte, error) {
+		<-release
+		return []byte("<span>late</span>"), nil
+	})
+	registry.RegisterContext("bk-aware", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		if _, ok := c.Deadline(); !ok {
+			return nil, errors.New("expected a deadline")
+		}
+		<-c.Done()
+		return nil, c.Err()
+	})
+	registry.Register("bk-fast", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte("<span>fast</span>"), nil
+	})
+	registry.SetTimeout("", 20*time.Millisecond)
+	registry.SetTimeout("bk-fast", time.Second)
+
+	_, err := registry.RenderContext(context.Background(), "", "bk-slow", nil, nil)
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Timeout != 20*time.Millisecond || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a 20ms *TimeoutError, got %v", err)
+	}
+	if out, err := registry.RenderContext(context.Background(), "", "bk-fast", nil, nil); err != nil || string(out) != "<span>fast</span>" {
+		t.Errorf("expected bk-fast to render, got %q, %v", out, err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := registry.RenderContext(canceled, "", "bk-fast", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled render to fail, got %v", err)
+	}
+
+	// Contextual components see the deadline on the request
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(ExpanderMiddleware(registry, true))
+	app.GET("/", func(c buffalo.Context) error {
+		c.Response().Header().Set("Content-Type", "text/html")
+		_, err := c.Response().Write([]byte(`<html><body><bk-aware></bk-aware><bk-fast></bk-fast></body></html>`))
+		return err
+	})
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "<!-- component bk-aware timed out after 20ms -->") {
+		t.Errorf("expected a timeout placeholder in dev mode, got %s", body)
+	}
+	if !strings.Contains(body, "<span>fast</span>") {
+		t.Errorf("expected bk-fast to render, got %s", body)
+	}
+
+	// Render outside a request isn't bounded
+	registry.SetTimeout("", 0)
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+	if out, err := registry.Render("bk-slow", nil, nil); err != nil || string(out) != "<span>late</span>" {
+		t.Errorf("expected Render to wait, got %q, %v", out, err)
+	}
+}
+
+func TestPrefetchBatchesLoads(t *testing.T) {
+	var batches [][]string
+	users := loader.New(func(ctx context.Context, ids []string) (map[string]string, error) {
+		batches = append(batches, ids)
+		names := make(map[string]string)
+		for _, id := range ids {
+			names[id] = "user " + id
+		}
+		return names, nil
+	})
+
+	registry := NewRegistry()
+	registry.RegisterContext("bk-avatar", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		name, err := users.Load(c, attrs["user-id"])
+		if err != nil {
+			return nil, err
+		}
+		return []byte(`<img alt="` + name + `">`), nil
+	})
+	registry.RegisterPrefetch("bk-avatar", func(c buffalo.Context, attrs map[string]string) {
+		users.Queue(c, attrs["user-id"])
+	})
+
+	app := buffalo.New(buffalo.Options{})
+	app.Use(loader.Middleware)
+	app.Use(ExpanderMiddleware(registry, false))
+	app.GET("/", func(c buffalo.Context) error {
+		c.Response().Header().Set("Content-Type", "text/html")
+		_, err := c.Response().Write([]byte(`<html><body><bk-avatar user-id="1"></bk-avatar><p><bk-avatar user-id="2"></bk-avatar></p><bk-avatar user-id="1"></bk-avatar></body></html>`))
+		return err
+	})
+
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(res.Body.String(), `<img alt="user 1"/><p><img alt="user 2"/></p><img alt="user 1"/>`) {
+		t.Errorf("expected the avatars rendered, got %s", res.Body.String())
+	}
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Errorf("expected one batch of both users, got %v", batches)
+	}
+}
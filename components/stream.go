@@ -0,0 +1,177 @@
+package components
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/johnjansen/buffkit/timing"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Flush sends what the handler has written so far, with its components
+// expanded, and flushes the connection. The first flush sends the status
+// too, so the response is streamed from then on. An error sending is
+// kept for the middleware to return, since Flush can't.
+func (w *responseWrapper) Flush() {
+	if w.err != nil {
+		return
+	}
+	if !w.streaming {
+		w.streaming = true
+		w.ResponseWriter.WriteHeader(w.statusCode)
+	}
+	if w.err = w.send(); w.err != nil {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// send writes what's buffered to the client, expanded if it's HTML.
+func (w *responseWrapper) send() error {
+	defer w.body.Reset()
+	out := w.body.Bytes()
+	if strings.Contains(w.Header().Get("Content-Type"), "text/html") && hasTag(out, "bk-") {
+		chunk := getBuffer()
+		defer putBuffer(chunk)
+		if err := w.stream.expandChunk(chunk, out); err != nil {
+			return err
+		}
+		out = chunk.Bytes()
+	}
+	n, err := w.ResponseWriter.Write(out)
+	w.written += n
+	return err
+}
+
+// expandChunk writes chunk, part of a page being streamed, to buf with
+// its components expanded. A chunk isn't a whole document, so rather than
+// parse it, expandChunk copies it as it is up to each component, and
+// parses only the component. A component cut off by the end of the chunk
+// is sent unexpanded.
+func (e *expansion) expandChunk(buf *bytes.Buffer, chunk []byte) error {
+	defer timing.Start(e.c, timing.Components)()
+
+	span := getBuffer()
+	defer putBuffer(span)
+
+	z := html.NewTokenizer(bytes.NewReader(chunk))
+	depth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return z.Err()
+		}
+
+		// Keep the token as written; TagName lowercases it in place
+		out := buf
+		if depth > 0 {
+			out = span
+		}
+		start := out.Len()
+		out.Write(z.Raw())
+		if tt != html.StartTagToken && tt != html.EndTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, _ := z.TagName()
+		if !bytes.HasPrefix(name, []byte("bk-")) {
+			continue
+		}
+
+		switch {
+		case depth == 0 && (tt == html.EndTagToken || string(name) == "bk-slot"):
+			continue
+		case depth == 0:
+			// A component starts: collect it whole before expanding
+			span.Write(buf.Bytes()[start:])
+			buf.Truncate(start)
+			if tt == html.StartTagToken {
+				depth = 1
+				continue
+			}
+		case tt == html.StartTagToken:
+			depth++
+			continue
+		case tt == html.EndTagToken:
+			depth--
+		}
+		if depth == 0 {
+			if err := e.expandSpan(buf, span.Bytes()); err != nil {
+				return err
+			}
+			span.Reset()
+		}
+	}
+
+	buf.Write(span.Bytes())
+	return nil
+}
+
+// expandSpan writes the expansion of span, the markup of one component,
+// to buf, after the CSS of any component the page hasn't styled yet.
+func (e *expansion) expandSpan(buf *bytes.Buffer, span []byte) error {
+	nodes, err := parseFragment(span)
+	if err != nil {
+		buf.Write(span)
+		return nil
+	}
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+
+	e.used, e.raw = e.used[:0], false
+	e.prefetch(root)
+	if err := e.expand(root); err != nil {
+		return err
+	}
+
+	// Normalize the output, as expanding a whole page does
+	if e.raw {
+		rendered := getBuffer()
+		defer putBuffer(rendered)
+		for n := root.FirstChild; n != nil; n = n.NextSibling {
+			if err := html.Render(rendered, n); err != nil {
+				return err
+			}
+		}
+		if nodes, err = parseFragment(rendered.Bytes()); err != nil {
+			return err
+		}
+	} else {
+		nodes = nodes[:0]
+		for n := root.FirstChild; n != nil; n = n.NextSibling {
+			nodes = append(nodes, n)
+		}
+	}
+
+	if e.styled == nil {
+		e.styled = make(map[string]bool)
+	}
+	var unstyled []string
+	for _, name := range e.used {
+		if !e.styled[name] {
+			e.styled[name] = true
+			unstyled = append(unstyled, name)
+		}
+	}
+	if css := e.registry.CSSFor(unstyled...); css != "" {
+		if err := html.Render(buf, styleElement(css)); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range nodes {
+		if err := html.Render(buf, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package components_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+)
+
+// flushRecorder records what had been sent at each flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	chunks []string
+}
+
+func (r *flushRecorder) Flush() {
+	r.chunks = append(r.chunks, r.Body.String())
+	r.ResponseRecorder.Flush()
+}
+
+func TestExpanderStreamsFlushedChunks(t *testing.T) {
+	registry := components.NewRegistry()
+	registry.Register("bk-badge", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<span class="badge">` + slots["default"] + `</span>`), nil
+	})
+	registry.Register("bk-box", func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<div class="box">` + slots["default"] + `</div>`), nil
+	})
+	registry.RegisterCSS("bk-badge", ".badge { color: red; }")
+
+	app := buffalo.New(buffalo.Options{})
+	app.Use(components.ExpanderMiddleware(registry, false))
+	app.GET("/", func(c buffalo.Context) error {
+		w := c.Response()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`<!DOCTYPE html><html><head><title>Report</title></head><body><BK-BADGE>head</BK-BADGE>`))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(`<main><bk-box><bk-badge>one</bk-badge></bk-box><bk-badge/><p>&lt;bk-badge&gt;</p><script>"<bk-badge>"</script>`))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(`<bk-box>cut off</main></body></html>`))
+		return nil
+	})
+
+	res := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	app.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+
+	if res.Code != http.StatusCreated {
+		t.Errorf("expected the handler's status, got %d", res.Code)
+	}
+	if len(res.chunks) < 2 {
+		t.Fatalf("expected the flushes to reach the client, got %d", len(res.chunks))
+	}
+
+	first := `<!DOCTYPE html><html><head><title>Report</title></head><body><style data-bk-components="">
+/* bk-badge */
+.badge { color: red; }
+</style><span class="badge">head</span>`
+	if res.chunks[0] != first {
+		t.Errorf("expected the first chunk expanded as written, got %q", res.chunks[0])
+	}
+
+	second := strings.TrimPrefix(res.chunks[1], res.chunks[0])
+	want := `<main><div class="box"><span class="badge">one</span></div><span class="badge"></span><p>&lt;bk-badge&gt;</p><script>"<bk-badge>"</script>`
+	if second != want {
+		t.Errorf("expected the second chunk expanded without more CSS, got %q", second)
+	}
+
+	rest := strings.TrimPrefix(res.Body.String(), res.chunks[1])
+	if rest != `<bk-box>cut off</main></body></html>` {
+		t.Errorf("expected an unfinished component sent as written, got %q", rest)
+	}
+}
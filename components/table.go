@@ -0,0 +1,403 @@
+package components
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"golang.org/x/net/html"
+)
+
+// DefaultPerPage is the page size of a table whose dataset doesn't set one.
+const DefaultPerPage = 25
+
+// tableCSS styles tables with the theme tokens.
+const tableCSS = `.bk-table table { width: 100%; border-collapse: collapse; }
+.bk-table th, .bk-table td { padding: 0.5rem 0.75rem; border-bottom: 1px solid var(--bk-border, #e4e4e7); text-align: left; }
+.bk-table th a { color: inherit; text-decoration: none; }
+.bk-table-filter, .bk-table-footer { display: flex; gap: 0.5rem; align-items: center; margin: 0.5rem 0; }
+.bk-table-footer { justify-content: space-between; color: var(--bk-muted, #71717a); }
+.bk-table-empty { text-align: center; color: var(--bk-muted, #71717a); }`
+
+// Column is a column of a dataset. Key names the value in each row.
+type Column struct {
+	Key      string
+	Label    string
+	Sortable bool
+}
+
+// TableQuery is what a table is showing: the sort column and direction,
+// the filter text, and the page (from 1), or for a dataset paged by
+// cursor, the cursor the page starts after ("" for the first). PerPage
+// is 0 for a CSV export, which wants every matching row.
+type TableQuery struct {
+	Sort    string
+	Desc    bool
+	Filter  string
+	Page    int
+	After   string
+	PerPage int
+}
+
+// TablePage is one page of a dataset, with the number of rows matching
+// the filter across all pages. A dataset paged by cursor returns the
+// cursor of the next page in Next ("" on the last page) and needn't
+// count the rows.
+type TablePage struct {
+	Rows  []map[string]string
+	Total int
+	Next  string
+}
+
+// Dataset is the data behind a <bk-table>. Load returns the page q asks
+// for; it runs for every render and export, so it's also where to check
+// the user may see the data. Searchable shows the filter box.
+//
+// Cursor pages the table by cursor rather than by number, for tables too
+// big for OFFSET: Load gets q.After and returns TablePage.Next, and the
+// table links to the first and next pages only. The paginate package
+// makes the cursors and the queries.
+type Dataset struct {
+	Columns    []Column
+	PerPage    int
+	Searchable bool
+	Cursor     bool
+	Load       func(c buffalo.Context, q TableQuery) (TablePage, error)
+}
+
+// RowsDataset returns a searchable dataset that filters, sorts and pages
+// the rows from rows in memory, for tables small enough to load whole.
+// The filter matches any column, ignoring case.
+func RowsDataset(columns []Column, rows func(c buffalo.Context) ([]map[string]string, error)) Dataset {
+	return Dataset{
+		Columns:    columns,
+		Searchable: true,
+		Load: func(c buffalo.Context, q TableQuery) (TablePage, error) {
+			all, err := rows(c)
+			if err != nil {
+				return TablePage{}, err
+			}
+
+			var matched []map[string]string
+			filter := strings.ToLower(q.Filter)
+			for _, row := range all {
+				if filter == "" || rowContains(row, columns, filter) {
+					matched = append(matched, row)
+				}
+			}
+			if q.Sort != "" {
+				sort.SliceStable(matched, func(i, j int) bool {
+					a, b := matched[i][q.Sort], matched[j][q.Sort]
+					if q.Desc {
+						return lessValue(b, a)
+					}
+					return lessValue(a, b)
+				})
+			}
+
+			page := TablePage{Total: len(matched)}
+			if q.PerPage <= 0 {
+				page.Rows = matched
+				return page, nil
+			}
+			start := (q.Page - 1) * q.PerPage
+			if start < len(matched) {
+				page.Rows = matched[start:min(start+q.PerPage, len(matched))]
+			}
+			return page, nil
+		},
+	}
+}
+
+func rowContains(row map[string]string, columns []Column, filter string) bool {
+	for _, col := range columns {
+		if strings.Contains(strings.ToLower(row[col.Key]), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// lessValue orders numbers numerically and anything else as text.
+func lessValue(a, b string) bool {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// RegisterDataset makes ds available to <bk-table dataset="name">.
+// Registering again replaces the dataset.
+func (r *Registry) RegisterDataset(name string, ds Dataset) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.datasets[name] = ds
+}
+
+func (r *Registry) dataset(name string) (Dataset, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ds, ok := r.datasets[name]
+	return ds, ok
+}
+
+// RegisterTable registers <bk-table>, which renders a registered dataset
+// with sortable headers, a filter box, paging and a CSV export link:
+//
+//	<bk-table dataset="users"></bk-table>
+//
+// The table reads its state from the page's sort, dir, q and page query
+// parameters, so links work without JavaScript. With htmx, sorting,
+// filtering and paging fetch just the table from TableHandler, which
+// must be mounted at path/{dataset} and also serves the CSV exports.
+func (r *Registry) RegisterTable(path string) {
+	r.RegisterContext("bk-table", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		name := attrs["dataset"]
+		ds, ok := r.dataset(name)
+		if !ok {
+			return nil, fmt.Errorf("bk-table: unknown dataset %q", name)
+		}
+		if c == nil {
+			return nil, fmt.Errorf("bk-table: %s must be rendered for a request", name)
+		}
+		return renderTable(c, path, name, ds)
+	})
+	r.mu.Lock()
+	r.tablesPath = path
+	r.mu.Unlock()
+	r.RegisterCSS("bk-table", tableCSS)
+}
+
+// TableHandler serves the table of the dataset in the "dataset" route
+// parameter, for htmx swaps, or its rows as CSV with ?format=csv:
+//
+//	app.GET("/tables/{dataset}", registry.TableHandler)
+func (r *Registry) TableHandler(c buffalo.Context) error {
+	name := c.Param("dataset")
+	ds, ok := r.dataset(name)
+	if !ok {
+		return c.Error(http.StatusNotFound, fmt.Errorf("unknown dataset %q", name))
+	}
+
+	if c.Param("format") == "csv" {
+		q := tableQuery(c, ds)
+		q.Page, q.After, q.PerPage = 1, "", 0
+		page, err := ds.Load(c, q)
+		if err != nil {
+			return err
+		}
+		c.Response().Header().Set("Content-Type", "text/csv; charset=utf-8")
+		c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+		c.Response().WriteHeader(http.StatusOK)
+		return writeTableCSV(c.Response(), ds.Columns, page.Rows)
+	}
+
+	r.mu.RLock()
+	path := r.tablesPath
+	r.mu.RUnlock()
+	out, err := renderTable(c, path, name, ds)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = c.Response().Write(out)
+	return err
+}
+
+// tableQuery reads the table state from the request, ignoring a sort
+// column that isn't sortable and clamping the page.
+func tableQuery(c buffalo.Context, ds Dataset) TableQuery {
+	q := TableQuery{
+		Filter:  c.Param("q"),
+		Desc:    c.Param("dir") == "desc",
+		PerPage: ds.PerPage,
+	}
+	if q.PerPage <= 0 {
+		q.PerPage = DefaultPerPage
+	}
+	for _, col := range ds.Columns {
+		if col.Sortable && col.Key == c.Param("sort") {
+			q.Sort = col.Key
+		}
+	}
+	if q.Sort == "" {
+		q.Desc = false
+	}
+	q.Page, _ = strconv.Atoi(c.Param("page"))
+	if q.Page < 1 || ds.Cursor {
+		q.Page = 1
+	}
+	if ds.Cursor {
+		q.After = c.Param("after")
+	}
+	return q
+}
+
+// values encodes q as query parameters, leaving out defaults.
+func (q TableQuery) values() url.Values {
+	v := url.Values{}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+		if q.Desc {
+			v.Set("dir", "desc")
+		}
+	}
+	if q.Filter != "" {
+		v.Set("q", q.Filter)
+	}
+	if q.Page > 1 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.After != "" {
+		v.Set("after", q.After)
+	}
+	return v
+}
+
+func renderTable(c buffalo.Context, path, name string, ds Dataset) ([]byte, error) {
+	q := tableQuery(c, ds)
+	page, err := ds.Load(c, q)
+	if err != nil {
+		return nil, err
+	}
+	pages := max(1, (page.Total+q.PerPage-1)/q.PerPage)
+
+	id := html.EscapeString("bk-table-" + name)
+	endpoint := strings.TrimSuffix(path, "/") + "/" + url.PathEscape(name)
+	// link renders an anchor to the table in state to, which works as a
+	// plain link and as an htmx swap of the table
+	link := func(to TableQuery, extra, label string) string {
+		query := "?" + to.values().Encode()
+		return fmt.Sprintf(`<a href="%s" hx-get="%s" hx-target="#%s" hx-swap="outerHTML"%s>%s</a>`,
+			html.EscapeString(query), html.EscapeString(endpoint+query), id, extra, label)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div id="%s" class="bk-table">`, id)
+
+	if ds.Searchable {
+		fmt.Fprintf(&b, `<form class="bk-table-filter" method="GET" hx-get="%s" hx-target="#%s" hx-swap="outerHTML">`, html.EscapeString(endpoint), id)
+		fmt.Fprintf(&b, `<input type="search" name="q" value="%s" aria-label="Filter">`, html.EscapeString(q.Filter))
+		if q.Sort != "" {
+			fmt.Fprintf(&b, `<input type="hidden" name="sort" value="%s">`, html.EscapeString(q.Sort))
+			if q.Desc {
+				b.WriteString(`<input type="hidden" name="dir" value="desc">`)
+			}
+		}
+		b.WriteString(`<button type="submit">Filter</button></form>`)
+	}
+
+	b.WriteString(`<table><thead><tr>`)
+	for _, col := range ds.Columns {
+		label := html.EscapeString(col.Label)
+		if !col.Sortable {
+			fmt.Fprintf(&b, `<th scope="col">%s</th>`, label)
+			continue
+		}
+		// Sorting goes back to the first page; a sorted column toggles
+		to := TableQuery{Sort: col.Key, Filter: q.Filter, Page: 1}
+		sortAttr := ""
+		if q.Sort == col.Key {
+			to.Desc = !q.Desc
+			sortAttr = ` aria-sort="ascending"`
+			if q.Desc {
+				sortAttr = ` aria-sort="descending"`
+			}
+		}
+		fmt.Fprintf(&b, `<th scope="col"%s>%s</th>`, sortAttr, link(to, "", label))
+	}
+	b.WriteString(`</tr></thead><tbody>`)
+	for _, row := range page.Rows {
+		b.WriteString(`<tr>`)
+		for _, col := range ds.Columns {
+			fmt.Fprintf(&b, `<td>%s</td>`, html.EscapeString(row[col.Key]))
+		}
+		b.WriteString(`</tr>`)
+	}
+	if len(page.Rows) == 0 {
+		fmt.Fprintf(&b, `<tr><td class="bk-table-empty" colspan="%d">No rows</td></tr>`, len(ds.Columns))
+	}
+	b.WriteString(`</tbody></table>`)
+
+	b.WriteString(`<div class="bk-table-footer"><nav aria-label="Pagination">`)
+	if ds.Cursor {
+		// Only the way forward and back to the start are known
+		if q.After != "" {
+			first := q
+			first.After = ""
+			b.WriteString(link(first, ` rel="first"`, "First"))
+		}
+		if page.Next != "" {
+			next := q
+			next.After = page.Next
+			if q.After != "" {
+				b.WriteString(" ")
+			}
+			b.WriteString(link(next, ` rel="next"`, "Next"))
+		}
+	} else {
+		if q.Page > 1 {
+			prev := q
+			prev.Page = min(q.Page-1, pages)
+			b.WriteString(link(prev, ` rel="prev"`, "Previous") + " ")
+		}
+		fmt.Fprintf(&b, `<span>Page %d of %d</span>`, q.Page, pages)
+		if q.Page < pages {
+			next := q
+			next.Page = q.Page + 1
+			b.WriteString(" " + link(next, ` rel="next"`, "Next"))
+		}
+	}
+	b.WriteString(`</nav>`)
+	export := q.values()
+	export.Del("page")
+	export.Del("after")
+	export.Set("format", "csv")
+	fmt.Fprintf(&b, `<a class="bk-table-export" href="%s" download>Download CSV</a>`, html.EscapeString(endpoint+"?"+export.Encode()))
+	b.WriteString(`</div></div>`)
+	return []byte(b.String()), nil
+}
+
+// writeTableCSV writes a header of column labels, then rows.
+func writeTableCSV(w io.Writer, columns []Column, rows []map[string]string) error {
+	out := csv.NewWriter(w)
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		record[i] = col.Label
+	}
+	if err := out.Write(record); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		for i, col := range columns {
+			record[i] = CSVCell(row[col.Key])
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// CSVCell returns value so that spreadsheets show it rather than
+// evaluate it as a formula. Numbers, negative ones included, are left
+// alone.
+func CSVCell(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
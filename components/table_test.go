@@ -0,0 +1,203 @@
+package components_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/paginate"
+)
+
+// tableApp serves a page with a <bk-table> of fruit at /page and the
+// table endpoint at /tables/{dataset}.
+func tableApp() *buffalo.App {
+	registry := components.NewRegistry()
+	registry.RegisterTable("/tables")
+	columns := []components.Column{
+		{Key: "name", Label: "Name", Sortable: true},
+		{Key: "count", Label: "Count", Sortable: true},
+		{Key: "note", Label: "Note"},
+	}
+	ds := components.RowsDataset(columns, func(c buffalo.Context) ([]map[string]string, error) {
+		return []map[string]string{
+			{"name": "apple", "count": "10", "note": "crisp"},
+			{"name": "banana", "count": "9", "note": "=HYPERLINK(\"x\")"},
+			{"name": "cherry", "count": "100", "note": "<red>"},
+		}, nil
+	})
+	ds.PerPage = 2
+	registry.RegisterDataset("fruit", ds)
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(components.ExpanderMiddleware(registry, false))
+	app.GET("/page", func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, render.Func("text/html", func(w io.Writer, _ render.Data) error {
+			_, err := io.WriteString(w, `<html><head></head><body><bk-table dataset="fruit"></bk-table></body></html>`)
+			return err
+		}))
+	})
+	app.GET("/tables/{dataset}", registry.TableHandler)
+	return app
+}
+
+func getTable(t *testing.T, app *buffalo.App, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestTableComponent(t *testing.T) {
+	rec := getTable(t, tableApp(), "/page")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`<div id="bk-table-fruit" class="bk-table">`,
+		`hx-get="/tables/fruit" hx-target="#bk-table-fruit"`,
+		`<th scope="col"><a href="?sort=name" hx-get="/tables/fruit?sort=name" hx-target="#bk-table-fruit" hx-swap="outerHTML">Name</a></th>`,
+		`<th scope="col">Note</th>`,
+		`<tr><td>apple</td><td>10</td><td>crisp</td></tr><tr><td>banana</td>`,
+		`<span>Page 1 of 2</span>`,
+		`rel="next">Next</a>`,
+		`<a class="bk-table-export" href="/tables/fruit?format=csv" download="">Download CSV</a>`,
+		`.bk-table table {`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "cherry") {
+		t.Errorf("expected cherry on the second page, got:\n%s", body)
+	}
+}
+
+func TestTableSortFilterAndPage(t *testing.T) {
+	app := tableApp()
+
+	// Numeric sort, descending
+	body := getTable(t, app, "/tables/fruit?sort=count&dir=desc").Body.String()
+	if !strings.Contains(body, `<td>cherry</td><td>100</td><td>&lt;red&gt;</td></tr><tr><td>apple</td>`) {
+		t.Errorf("expected rows sorted by count, got:\n%s", body)
+	}
+	if !strings.Contains(body, `<th scope="col" aria-sort="descending"><a href="?sort=count"`) {
+		t.Errorf("expected the sorted header to toggle, got:\n%s", body)
+	}
+
+	body = getTable(t, app, "/tables/fruit?q=AN").Body.String()
+	if !strings.Contains(body, "banana") || strings.Contains(body, "apple") {
+		t.Errorf("expected only banana to match, got:\n%s", body)
+	}
+	if !strings.Contains(body, `<input type="search" name="q" value="AN" aria-label="Filter">`) {
+		t.Errorf("expected the filter to be kept, got:\n%s", body)
+	}
+
+	body = getTable(t, app, "/tables/fruit?sort=name&page=2").Body.String()
+	if !strings.Contains(body, "<td>cherry</td>") || !strings.Contains(body, `<span>Page 2 of 2</span>`) {
+		t.Errorf("expected the second page, got:\n%s", body)
+	}
+	if !strings.Contains(body, `<a href="?sort=name" hx-get="/tables/fruit?sort=name" hx-target="#bk-table-fruit" hx-swap="outerHTML" rel="prev">`) {
+		t.Errorf("expected a link to the first page, got:\n%s", body)
+	}
+
+	// Only sortable columns sort
+	body = getTable(t, app, "/tables/fruit?sort=note&dir=desc").Body.String()
+	if !strings.Contains(body, `<tr><td>apple</td>`) {
+		t.Errorf("expected the unsortable column to be ignored, got:\n%s", body)
+	}
+}
+
+func TestTableCursor(t *testing.T) {
+	names := []string{"apple", "banana", "cherry", "damson", "elder"}
+	order := paginate.Order("name")
+	registry := components.NewRegistry()
+	registry.RegisterTable("/tables")
+	var after []string
+	registry.RegisterDataset("fruit", components.Dataset{
+		Columns: []components.Column{{Key: "name", Label: "Name"}},
+		PerPage: 2,
+		Cursor:  true,
+		Load: func(c buffalo.Context, q components.TableQuery) (components.TablePage, error) {
+			after = append(after, q.After)
+			cursor, err := paginate.ParseCursor(q.After)
+			if err != nil {
+				return components.TablePage{}, err
+			}
+			var rows []map[string]string
+			for _, name := range names {
+				if len(cursor) == 0 || name > cursor[0] {
+					rows = append(rows, map[string]string{"name": name})
+				}
+			}
+			if q.PerPage == 0 {
+				return components.TablePage{Rows: rows}, nil
+			}
+			rows, more := paginate.Split(rows, q.PerPage)
+			page := components.TablePage{Rows: rows}
+			if more {
+				page.Next = order.CursorFor(rows[len(rows)-1]).String()
+			}
+			return page, nil
+		},
+	})
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/tables/{dataset}", registry.TableHandler)
+
+	body := getTable(t, app, "/tables/fruit").Body.String()
+	next := paginate.Cursor{"banana"}.String()
+	if !strings.Contains(body, `<tr><td>apple</td></tr><tr><td>banana</td></tr></tbody>`) {
+		t.Errorf("expected the first two rows, got:\n%s", body)
+	}
+	if !strings.Contains(body, `<nav aria-label="Pagination"><a href="?after=`+next+`"`) || strings.Contains(body, "Page 1") || strings.Contains(body, "First") {
+		t.Errorf("expected only a next link, got:\n%s", body)
+	}
+
+	body = getTable(t, app, "/tables/fruit?after="+next).Body.String()
+	if !strings.Contains(body, `<tr><td>cherry</td></tr><tr><td>damson</td></tr></tbody>`) {
+		t.Errorf("expected the second page, got:\n%s", body)
+	}
+	if !strings.Contains(body, `rel="first">First</a> <a href="?after=`+paginate.Cursor{"damson"}.String()+`"`) {
+		t.Errorf("expected first and next links, got:\n%s", body)
+	}
+
+	body = getTable(t, app, "/tables/fruit?after="+paginate.Cursor{"damson"}.String()).Body.String()
+	if !strings.Contains(body, `<td>elder</td>`) || strings.Contains(body, `rel="next"`) {
+		t.Errorf("expected the last page, got:\n%s", body)
+	}
+
+	// The export starts from the beginning
+	after = nil
+	if got := getTable(t, app, "/tables/fruit?format=csv&after="+next).Body.String(); got != "Name\napple\nbanana\ncherry\ndamson\nelder\n" {
+		t.Errorf("unexpected CSV:\n%s", got)
+	}
+	if len(after) != 1 || after[0] != "" {
+		t.Errorf("expected the export to load from the start, got %q", after)
+	}
+}
+
+func TestTableCSVExport(t *testing.T) {
+	rec := getTable(t, tableApp(), "/tables/fruit?format=csv&sort=count")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="fruit.csv"` {
+		t.Errorf("unexpected Content-Disposition %q", got)
+	}
+	want := "Name,Count,Note\nbanana,9,\"'=HYPERLINK(\"\"x\"\")\"\napple,10,crisp\ncherry,100,<red>\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("unexpected CSV:\n%s", got)
+	}
+}
+
+func TestTableUnknownDataset(t *testing.T) {
+	if rec := getTable(t, tableApp(), "/tables/missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
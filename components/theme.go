@@ -0,0 +1,167 @@
+package components
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// Theme is the set of design tokens components style themselves with,
+// as CSS custom properties: the token "primary" is var(--bk-primary).
+// Light holds every token; Dark overrides the ones that change in dark
+// mode. Component CSS should use the tokens instead of literal colors so
+// it follows the theme:
+//
+//	registry.RegisterCSS("bk-alert", `.bk-alert { background: var(--bk-surface); color: var(--bk-text); }`)
+type Theme struct {
+	Light map[string]string
+	Dark  map[string]string
+}
+
+// DefaultTheme is the theme Wire registers.
+var DefaultTheme = Theme{
+	Light: map[string]string{
+		"bg":           "#ffffff",
+		"surface":      "#f4f4f5",
+		"text":         "#18181b",
+		"muted":        "#71717a",
+		"border":       "#e4e4e7",
+		"primary":      "#2563eb",
+		"primary-text": "#ffffff",
+		"success":      "#16a34a",
+		"warning":      "#d97706",
+		"danger":       "#dc2626",
+		"radius":       "6px",
+		"font":         "system-ui, -apple-system, 'Segoe UI', sans-serif",
+	},
+	Dark: map[string]string{
+		"bg":      "#18181b",
+		"surface": "#27272a",
+		"text":    "#f4f4f5",
+		"muted":   "#a1a1aa",
+		"border":  "#3f3f46",
+		"primary": "#60a5fa",
+		"success": "#4ade80",
+		"warning": "#fbbf24",
+		"danger":  "#f87171",
+	},
+}
+
+// Theme modes, as stored in the preference cookie and accepted by
+// <bk-theme mode="...">. ThemeSystem follows the operating system.
+const (
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+	ThemeSystem = "system"
+)
+
+// ThemeCookie is the cookie holding the user's theme preference.
+const ThemeCookie = "bk_theme"
+
+// CSS returns the theme's custom properties for mode. The system mode
+// carries both palettes, switching on prefers-color-scheme.
+func (t Theme) CSS(mode string) string {
+	var b strings.Builder
+	switch mode {
+	case ThemeDark:
+		writeTokens(&b, ":root", "dark", t.Light, t.Dark)
+	case ThemeLight:
+		writeTokens(&b, ":root", "light", t.Light)
+	default:
+		writeTokens(&b, ":root", "light dark", t.Light)
+		b.WriteString("@media (prefers-color-scheme: dark) {\n")
+		writeTokens(&b, ":root", "", t.Dark)
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// writeTokens writes a rule declaring the tokens of palettes, later
+// palettes overriding earlier ones, in name order.
+func writeTokens(b *strings.Builder, selector, colorScheme string, palettes ...map[string]string) {
+	tokens := make(map[string]string)
+	for _, palette := range palettes {
+		for name, value := range palette {
+			tokens[name] = value
+		}
+	}
+	names := make([]string, 0, len(tokens))
+	for name := range tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(b, "%s {\n", selector)
+	if colorScheme != "" {
+		fmt.Fprintf(b, "  color-scheme: %s;\n", colorScheme)
+	}
+	for _, name := range names {
+		fmt.Fprintf(b, "  --bk-%s: %s;\n", name, tokens[name])
+	}
+	b.WriteString("}\n")
+}
+
+// RegisterTheme registers <bk-theme>, which renders t's tokens in a
+// <style> element. Its mode attribute picks the palette; pass the user's
+// preference with the theme() template helper:
+//
+//	<bk-theme mode="<%= theme() %>"></bk-theme>
+//
+// Registering again replaces the theme.
+func (r *Registry) RegisterTheme(t Theme) {
+	r.Register("bk-theme", func(attrs, slots map[string]string) ([]byte, error) {
+		css := strings.ReplaceAll(t.CSS(attrs["mode"]), "</style", `<\/style`)
+		return []byte("<style data-bk-theme>\n" + css + "</style>"), nil
+	})
+}
+
+// ThemePreference returns the theme mode the user picked, or ThemeSystem
+// if they haven't.
+func ThemePreference(c buffalo.Context) string {
+	cookie, err := c.Request().Cookie(ThemeCookie)
+	if err != nil || !validThemeMode(cookie.Value) {
+		return ThemeSystem
+	}
+	return cookie.Value
+}
+
+func validThemeMode(mode string) bool {
+	return mode == ThemeLight || mode == ThemeDark || mode == ThemeSystem
+}
+
+// ThemeHandler saves the "theme" form field (light, dark or system) as
+// the user's preference for a year, then sends them back to the local
+// path in "return_to", or /. htmx requests get HX-Refresh so the page
+// re-renders in the new theme:
+//
+//	<form method="POST" action="/theme">
+//	    <input type="hidden" name="return_to" value="<%= request.URL.Path %>">
+//	    <button name="theme" value="dark">Dark</button>
+//	</form>
+func ThemeHandler(c buffalo.Context) error {
+	mode := c.Request().FormValue("theme")
+	if !validThemeMode(mode) {
+		return c.Error(http.StatusUnprocessableEntity, fmt.Errorf("unknown theme %q", mode))
+	}
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     ThemeCookie,
+		Value:    mode,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		c.Response().Header().Set("HX-Refresh", "true")
+		return c.Render(http.StatusOK, render.String(""))
+	}
+	back := c.Request().FormValue("return_to")
+	if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.HasPrefix(back, `/\`) {
+		back = "/"
+	}
+	return c.Redirect(http.StatusSeeOther, back)
+}
@@ -0,0 +1,100 @@
+package components_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+)
+
+func TestThemeCSS(t *testing.T) {
+	theme := components.Theme{
+		Light: map[string]string{"bg": "#fff", "radius": "4px"},
+		Dark:  map[string]string{"bg": "#000"},
+	}
+
+	light := theme.CSS(components.ThemeLight)
+	if !strings.Contains(light, "--bk-bg: #fff;") || strings.Contains(light, "#000") {
+		t.Errorf("expected only the light palette, got:\n%s", light)
+	}
+
+	dark := theme.CSS(components.ThemeDark)
+	if !strings.Contains(dark, "--bk-bg: #000;") || !strings.Contains(dark, "--bk-radius: 4px;") || strings.Contains(dark, "#fff") {
+		t.Errorf("expected dark overrides on top of the light tokens, got:\n%s", dark)
+	}
+
+	system := theme.CSS(components.ThemeSystem)
+	if !strings.Contains(system, "@media (prefers-color-scheme: dark)") || !strings.Contains(system, "--bk-bg: #000;") {
+		t.Errorf("expected a prefers-color-scheme switch, got:\n%s", system)
+	}
+}
+
+func TestThemeComponent(t *testing.T) {
+	registry := components.NewRegistry()
+	registry.RegisterTheme(components.DefaultTheme)
+
+	out, err := registry.Expand([]byte(`<html><head></head><body><bk-theme mode="dark"></bk-theme></body></html>`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := string(out)
+	if !strings.Contains(html, "<style data-bk-theme=\"\">") || !strings.Contains(html, "--bk-bg: #18181b;") {
+		t.Errorf("expected the dark tokens in a style element, got %s", html)
+	}
+}
+
+func TestThemeHandler(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.POST("/theme", components.ThemeHandler)
+	app.GET("/pref", func(c buffalo.Context) error {
+		_, err := c.Response().Write([]byte(components.ThemePreference(c)))
+		return err
+	})
+
+	post := func(form url.Values, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/theme", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(url.Values{"theme": {"dark"}, "return_to": {"/settings"}}, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/settings" {
+		t.Fatalf("expected a redirect to /settings, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == components.ThemeCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != "dark" {
+		t.Fatalf("expected the preference cookie, got %v", rec.Result().Cookies())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/pref", nil)
+	req.AddCookie(cookie)
+	pref := httptest.NewRecorder()
+	app.ServeHTTP(pref, req)
+	if pref.Body.String() != "dark" {
+		t.Errorf("expected the saved preference, got %q", pref.Body.String())
+	}
+
+	if rec := post(url.Values{"theme": {"light"}, "return_to": {"//evil.example.com"}}, nil); rec.Header().Get("Location") != "/" {
+		t.Errorf("expected off-site return_to to fall back to /, got %s", rec.Header().Get("Location"))
+	}
+	if rec := post(url.Values{"theme": {"system"}}, http.Header{"Hx-Request": {"true"}}); rec.Header().Get("HX-Refresh") != "true" {
+		t.Errorf("expected HX-Refresh for htmx, got %v", rec.Header())
+	}
+	if rec := post(url.Values{"theme": {"sepia"}}, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for an unknown theme, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,177 @@
+package components
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"golang.org/x/net/html"
+)
+
+// variantAttrs are the attributes whose values tell a component's
+// variants apart, e.g. <bk-button variant="primary" size="sm">.
+var variantAttrs = []string{"variant", "type", "size", "mode"}
+
+// maxExampleBytes caps the rendered example kept per component.
+const maxExampleBytes = 4096
+
+// ComponentUsage is what Usage knows about one component.
+type ComponentUsage struct {
+	Name         string            `json:"name"`
+	Renders      int               `json:"renders"`
+	Variants     map[string]int    `json:"variants"`
+	LastRendered time.Time         `json:"last_rendered,omitempty"`
+	LastAttrs    map[string]string `json:"last_attrs,omitempty"`
+	LastOutput   string            `json:"last_output,omitempty"`
+}
+
+// Usage counts the components rendered since it started, by variant,
+// keeping the latest rendering of each as an example. It helps find
+// components nothing uses, and hot ones worth caching.
+type Usage struct {
+	mu         sync.Mutex
+	components map[string]*ComponentUsage
+	now        func() time.Time
+}
+
+// variant names the variant attrs describe, e.g. "variant=primary
+// size=sm", or "default" if they're all unset.
+func variant(attrs map[string]string) string {
+	var parts []string
+	for _, name := range variantAttrs {
+		if v := attrs[name]; v != "" {
+			parts = append(parts, name+"="+v)
+		}
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, " ")
+}
+
+func (u *Usage) record(name string, attrs map[string]string, out []byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	cu, ok := u.components[name]
+	if !ok {
+		cu = &ComponentUsage{Name: name, Variants: make(map[string]int)}
+		u.components[name] = cu
+	}
+	cu.Renders++
+	cu.Variants[variant(attrs)]++
+	cu.LastRendered = u.now()
+	cu.LastAttrs = make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		cu.LastAttrs[k] = v
+	}
+	if len(out) > maxExampleBytes {
+		out = out[:maxExampleBytes]
+	}
+	cu.LastOutput = string(out)
+}
+
+// TrackUsage starts counting renders, and returns the counts. Wire turns
+// it on in dev mode; tracking again keeps the existing counts.
+func (r *Registry) TrackUsage() *Usage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.usage == nil {
+		r.usage = &Usage{components: make(map[string]*ComponentUsage), now: time.Now}
+	}
+	return r.usage
+}
+
+// Usage returns the usage of every registered component, busiest first,
+// including the ones that haven't rendered (with no renders). It's empty
+// unless TrackUsage was called.
+func (r *Registry) Usage() []ComponentUsage {
+	r.mu.RLock()
+	usage := r.usage
+	r.mu.RUnlock()
+	if usage == nil {
+		return nil
+	}
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	var list []ComponentUsage
+	for _, name := range r.Names() {
+		cu := ComponentUsage{Name: name, Variants: map[string]int{}}
+		if tracked, ok := usage.components[name]; ok {
+			cu = *tracked
+			cu.Variants = make(map[string]int, len(tracked.Variants))
+			for k, v := range tracked.Variants {
+				cu.Variants[k] = v
+			}
+		}
+		list = append(list, cu)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Renders > list[j].Renders })
+	return list
+}
+
+// UsageHandler renders the component usage as an HTML page, or JSON with
+// ?format=json. Wire mounts it at /__components/usage in DevMode.
+func (r *Registry) UsageHandler(c buffalo.Context) error {
+	usage := r.Usage()
+	if c.Param("format") == "json" {
+		c.Response().Header().Set("Content-Type", "application/json")
+		c.Response().WriteHeader(http.StatusOK)
+		return json.NewEncoder(c.Response()).Encode(usage)
+	}
+
+	var page strings.Builder
+	page.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Component usage</title>
+    <style>
+        body { font-family: system-ui, sans-serif; padding: 20px; }
+        table { border-collapse: collapse; width: 100%; }
+        th, td { text-align: left; padding: 6px 10px; border-bottom: 1px solid #ddd; vertical-align: top; }
+        th { background: #f5f5f5; }
+        .unused { color: #999; }
+        pre { white-space: pre-wrap; max-width: 60ch; font-size: 0.85em; }
+    </style>
+</head>
+<body>
+    <h1>Component usage (Development)</h1>
+`)
+	unused := 0
+	for _, cu := range usage {
+		if cu.Renders == 0 {
+			unused++
+		}
+	}
+	fmt.Fprintf(&page, "    <p>%d component(s), %d not rendered since the server started.</p>\n", len(usage), unused)
+	page.WriteString("    <table>\n        <tr><th>Component</th><th>Renders</th><th>Variants</th><th>Last rendered</th><th>Example</th></tr>\n")
+
+	for _, cu := range usage {
+		if cu.Renders == 0 {
+			fmt.Fprintf(&page, "        <tr class=\"unused\"><td><code>%s</code></td><td>0</td><td></td><td>never</td><td></td></tr>\n", html.EscapeString(cu.Name))
+			continue
+		}
+		variants := make([]string, 0, len(cu.Variants))
+		for v := range cu.Variants {
+			variants = append(variants, v)
+		}
+		sort.Slice(variants, func(i, j int) bool { return cu.Variants[variants[i]] > cu.Variants[variants[j]] })
+		for i, v := range variants {
+			variants[i] = fmt.Sprintf("%s (%d)", html.EscapeString(v), cu.Variants[v])
+		}
+		fmt.Fprintf(&page, "        <tr><td><code>%s</code></td><td>%d</td><td>%s</td><td>%s</td><td><details><summary>HTML</summary><pre>%s</pre></details></td></tr>\n",
+			html.EscapeString(cu.Name), cu.Renders, strings.Join(variants, "<br>"),
+			cu.LastRendered.Format(time.RFC3339), html.EscapeString(cu.LastOutput))
+	}
+
+	page.WriteString("    </table>\n</body>\n</html>\n")
+	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err := c.Response().Write([]byte(page.String()))
+	return err
+}
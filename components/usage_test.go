@@ -0,0 +1,80 @@
+package components_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+)
+
+func TestUsage(t *testing.T) {
+	registry := components.NewRegistry()
+	button := func(attrs, slots map[string]string) ([]byte, error) {
+		return []byte(`<button class="` + attrs["variant"] + `">`), nil
+	}
+	registry.Register("bk-button", button)
+	registry.Register("bk-unused", button)
+
+	// Renders before tracking aren't counted
+	registry.Render("bk-button", nil, nil)
+	if got := registry.Usage(); got != nil {
+		t.Fatalf("expected no usage before tracking, got %v", got)
+	}
+
+	registry.TrackUsage()
+	registry.Render("bk-button", map[string]string{"variant": "primary"}, nil)
+	registry.Render("bk-button", map[string]string{"variant": "primary", "size": "sm"}, nil)
+	registry.Render("bk-button", map[string]string{"variant": "<danger>"}, nil)
+	registry.Render("bk-missing", nil, nil)
+
+	usage := registry.Usage()
+	if len(usage) != 2 {
+		t.Fatalf("expected both registered components, got %v", usage)
+	}
+	if usage[0].Name != "bk-button" || usage[0].Renders != 3 {
+		t.Errorf("expected bk-button first with 3 renders, got %+v", usage[0])
+	}
+	if got := usage[0].Variants["variant=primary"]; got != 1 {
+		t.Errorf("expected 1 primary render, got %d (%v)", got, usage[0].Variants)
+	}
+	if got := usage[0].Variants["variant=primary size=sm"]; got != 1 {
+		t.Errorf("expected 1 small primary render, got %d", got)
+	}
+	if usage[0].LastOutput != `<button class="<danger>">` || usage[0].LastAttrs["variant"] != "<danger>" {
+		t.Errorf("expected the last render as the example, got %+v", usage[0])
+	}
+	if usage[1].Name != "bk-unused" || usage[1].Renders != 0 {
+		t.Errorf("expected bk-unused with no renders, got %+v", usage[1])
+	}
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/usage", registry.UsageHandler)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"2 component(s), 1 not rendered",
+		`<tr class="unused"><td><code>bk-unused</code>`,
+		"variant=&lt;danger&gt; (1)",
+		"&lt;button class=&#34;&lt;danger&gt;&#34;&gt;",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in:\n%s", want, body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/usage?format=json", nil))
+	var decoded []components.ComponentUsage
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0].Renders != 3 {
+		t.Errorf("unexpected JSON usage %+v", decoded)
+	}
+}
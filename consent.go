@@ -0,0 +1,22 @@
+package buffkit
+
+import (
+	"github.com/gobuffalo/buffalo"
+)
+
+// Consented reports whether the visitor accepted cookies of category,
+// as Config.Consent asks them:
+//
+//	if buffkit.Consented(c, "analytics") {
+//		c.Set("analytics_id", analyticsID)
+//	}
+//
+// Required categories are always accepted. Without Config.Consent
+// nothing is asked, so everything is. Templates can call
+// consented("analytics") for the same thing.
+func Consented(c buffalo.Context, category string) bool {
+	if globalKit == nil || globalKit.Consent == nil {
+		return true
+	}
+	return globalKit.Consent.Allowed(c, category)
+}
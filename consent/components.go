@@ -0,0 +1,75 @@
+package consent
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// bannerCSS pins the banner to the bottom of the page with the theme
+// tokens.
+const bannerCSS = `.bk-consent { position: fixed; inset: auto 1rem 1rem 1rem; z-index: 1000; padding: 1rem; background: var(--bk-surface, #f4f4f5); color: var(--bk-text, #18181b); border: 1px solid var(--bk-border, #e4e4e7); border-radius: var(--bk-radius, 6px); }
+.bk-consent form { display: flex; flex-wrap: wrap; gap: 0.5rem; align-items: center; margin: 0.5rem 0 0; }`
+
+// defaultMessage is the banner's text when it has no content.
+const defaultMessage = "We use cookies to run this site and, with your permission, to understand how it's used."
+
+// RegisterComponents registers the consent components:
+//
+// <bk-consent> is the banner asking visitors to choose, rendered until
+// they have. Its content replaces the default message:
+//
+//	<bk-consent>We use cookies for analytics. <a href="/privacy">Privacy policy</a></bk-consent>
+//
+// It has buttons to accept everything or only what's necessary, both of
+// which send the visitor back to the page they were on, and a link to
+// the preferences page.
+//
+// <bk-consent-gate category="..."> renders its content only for visitors
+// who accepted category, so third-party scripts aren't even sent to
+// those who didn't:
+//
+//	<bk-consent-gate category="analytics"><script src="..."></script></bk-consent-gate>
+func (k *Consent) RegisterComponents(r *components.Registry) {
+	r.RegisterContext("bk-consent", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		if c == nil {
+			return nil, fmt.Errorf("bk-consent must be rendered for a request")
+		}
+		if k.Choice(c).Given {
+			return nil, nil
+		}
+		message := components.Slots(slots).GetOr("default", html.EscapeString(defaultMessage))
+		back := c.Request().URL.RequestURI()
+
+		var b strings.Builder
+		b.WriteString(`<div class="bk-consent" role="dialog" aria-label="Cookie consent">`)
+		fmt.Fprintf(&b, `<p>%s</p>`, message)
+		fmt.Fprintf(&b, `<form method="POST" action="%s">`, html.EscapeString(k.path()))
+		if token := secure.CSRFToken(c); token != "" {
+			fmt.Fprintf(&b, `<input type="hidden" name="authenticity_token" value="%s">`, html.EscapeString(token))
+		}
+		fmt.Fprintf(&b, `<input type="hidden" name="return_to" value="%s">`, html.EscapeString(back))
+		b.WriteString(`<button type="submit" name="accept" value="all">Accept all</button>`)
+		b.WriteString(`<button type="submit" name="accept" value="necessary">Necessary only</button>`)
+		fmt.Fprintf(&b, `<a href="%s?return_to=%s">Choose</a>`, html.EscapeString(k.path()), html.EscapeString(url.QueryEscape(back)))
+		b.WriteString(`</form></div>`)
+		return []byte(b.String()), nil
+	})
+	r.RegisterCSS("bk-consent", bannerCSS)
+
+	r.RegisterContext("bk-consent-gate", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		category := attrs["category"]
+		if category == "" {
+			return nil, fmt.Errorf("bk-consent-gate needs a category")
+		}
+		if c == nil || !k.Allowed(c, category) {
+			return nil, nil
+		}
+		return []byte(slots["default"]), nil
+	})
+}
@@ -0,0 +1,283 @@
+// Package consent asks visitors which kinds of cookies they accept and
+// keeps their answer in a signed cookie, so analytics and marketing
+// scripts are only rendered for visitors who agreed to them:
+//
+//	<bk-consent></bk-consent>  <%# the banner, until they choose %>
+//
+//	<bk-consent-gate category="analytics">
+//	  <script src="https://analytics.example.com/script.js" defer></script>
+//	</bk-consent-gate>
+//
+//	<%= if (consented("marketing")) { %>...<% } %>
+//
+// The preferences page, at Path, lets visitors change their answer
+// later; link to it from the footer.
+//
+// The cookie is signed, so a script can't grant itself consent, and
+// expires after MaxAge, after which visitors are asked again. Bumping
+// Version asks everyone again, e.g. after adding a category.
+package consent
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// CookieName is the cookie holding the visitor's choice.
+const CookieName = "bk_consent"
+
+// DefaultMaxAge is how long a choice lasts when MaxAge isn't set.
+const DefaultMaxAge = 365 * 24 * time.Hour
+
+// Claims of the signed cookie.
+const (
+	categoriesClaim = "c"
+	versionClaim    = "v"
+)
+
+// Category is a kind of cookie visitors accept or refuse.
+type Category struct {
+	Key   string
+	Label string
+	Help  string
+
+	// Required categories are always on and can't be refused, such as
+	// the session cookie that keeps people logged in.
+	Required bool
+}
+
+// DefaultCategories are the categories a Consent asks about when
+// Categories isn't set.
+var DefaultCategories = []Category{
+	{Key: "necessary", Label: "Necessary", Help: "Needed for the site to work, such as keeping you logged in.", Required: true},
+	{Key: "preferences", Label: "Preferences", Help: "Remember choices such as your language and theme."},
+	{Key: "analytics", Label: "Analytics", Help: "Help us understand how the site is used."},
+	{Key: "marketing", Label: "Marketing", Help: "Show you relevant ads on other sites."},
+}
+
+// Choice is what a visitor agreed to.
+type Choice struct {
+	// Given is false until the visitor answers, or when their answer
+	// has expired or was for an earlier Version.
+	Given bool
+
+	// Categories are the keys of the categories they accepted.
+	Categories []string
+}
+
+// Allows reports whether the visitor accepted category.
+func (ch Choice) Allows(category string) bool {
+	for _, c := range ch.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Consent asks for and remembers visitors' cookie preferences.
+type Consent struct {
+	// Signer signs the cookie. Wire uses kit.Signer.
+	Signer *secure.URLSigner
+
+	// Categories are asked about, in order; DefaultCategories when nil.
+	Categories []Category
+
+	// Path is where the preferences page is mounted; "/consent" when
+	// empty. The banner's buttons post there too.
+	Path string
+
+	// MaxAge is how long a choice lasts; DefaultMaxAge when zero.
+	MaxAge time.Duration
+
+	// Version is stored with each choice. Changing it asks everyone
+	// again.
+	Version string
+
+	Clock clock.Clock
+}
+
+// New creates a Consent that signs its cookie with signer.
+func New(signer *secure.URLSigner) *Consent {
+	return &Consent{Signer: signer}
+}
+
+// Routes returns the routes Mount adds.
+func (k *Consent) Routes() [][2]string {
+	p := k.path()
+	return [][2]string{
+		{http.MethodGet, p},
+		{http.MethodPost, p},
+	}
+}
+
+// Mount adds the preferences page to app. It doesn't need a login.
+func (k *Consent) Mount(app *buffalo.App) {
+	p := k.path()
+	app.GET(p, k.Show)
+	app.POST(p, k.Update)
+}
+
+// Choice returns the request's choice, read from its cookie.
+func (k *Consent) Choice(c buffalo.Context) Choice {
+	if choice, ok := c.Value(CookieName).(Choice); ok {
+		// Chosen earlier in this request
+		return choice
+	}
+	cookie, err := c.Request().Cookie(CookieName)
+	if err != nil || k.Signer == nil {
+		return Choice{}
+	}
+	u, err := url.Parse(cookie.Value)
+	if err != nil {
+		return Choice{}
+	}
+	claims, err := k.Signer.Verify(u)
+	if err != nil || claims[versionClaim] != k.Version {
+		return Choice{}
+	}
+	choice := Choice{Given: true}
+	for _, key := range strings.Split(claims[categoriesClaim], ",") {
+		if _, ok := k.category(key); ok {
+			choice.Categories = append(choice.Categories, key)
+		}
+	}
+	return choice
+}
+
+// Allowed reports whether the request may use cookies or scripts of
+// category: always for required categories, otherwise only once the
+// visitor has accepted it. Unknown categories aren't allowed.
+func (k *Consent) Allowed(c buffalo.Context, category string) bool {
+	cat, ok := k.category(category)
+	if !ok {
+		return false
+	}
+	return cat.Required || k.Choice(c).Allows(category)
+}
+
+// Save stores the visitor's choice of categories, always adding the
+// required ones and dropping unknown ones.
+func (k *Consent) Save(c buffalo.Context, categories []string) error {
+	accepted := make(map[string]bool, len(categories))
+	for _, key := range categories {
+		accepted[key] = true
+	}
+	var keys []string
+	for _, cat := range k.categories() {
+		if cat.Required || accepted[cat.Key] {
+			keys = append(keys, cat.Key)
+		}
+	}
+
+	maxAge := k.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	value, err := k.Signer.Sign(k.path(), clock.Or(k.Clock).Now().Add(maxAge), map[string]string{
+		categoriesClaim: strings.Join(keys, ","),
+		versionClaim:    k.Version,
+	})
+	if err != nil {
+		return err
+	}
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Set(CookieName, Choice{Given: true, Categories: keys})
+	return nil
+}
+
+// Field is a category on the preferences page, with whether it's on.
+type Field struct {
+	Category
+	Checked bool
+}
+
+// Show renders the preferences page.
+func (k *Consent) Show(c buffalo.Context) error {
+	choice := k.Choice(c)
+	fields := make([]Field, 0, len(k.categories()))
+	for _, cat := range k.categories() {
+		fields = append(fields, Field{Category: cat, Checked: cat.Required || choice.Allows(cat.Key)})
+	}
+	return views.Render(c, http.StatusOK, views.PageConsent, map[string]any{
+		"categories":   fields,
+		"given":        choice.Given,
+		"consent_path": k.path(),
+		"return_to":    localPath(c.Request().URL.Query().Get("return_to")),
+	})
+}
+
+// Update saves the banner's or the preferences page's answer. "accept"
+// is "all" or "necessary" from the banner's buttons; otherwise the
+// checked "categories" are saved. It sends the visitor back to the local
+// path in "return_to", or to the preferences page.
+func (k *Consent) Update(c buffalo.Context) error {
+	if err := c.Request().ParseForm(); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	var categories []string
+	switch c.Request().FormValue("accept") {
+	case "all":
+		for _, cat := range k.categories() {
+			categories = append(categories, cat.Key)
+		}
+	case "necessary":
+	default:
+		categories = c.Request().Form["categories"]
+	}
+	if err := k.Save(c, categories); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	back := localPath(c.Request().FormValue("return_to"))
+	if back == "" {
+		c.Flash().Add("success", "Your cookie preferences were saved")
+		back = k.path()
+	}
+	return c.Redirect(http.StatusSeeOther, back)
+}
+
+func (k *Consent) categories() []Category {
+	if k.Categories != nil {
+		return k.Categories
+	}
+	return DefaultCategories
+}
+
+func (k *Consent) category(key string) (Category, bool) {
+	for _, cat := range k.categories() {
+		if cat.Key == key {
+			return cat, true
+		}
+	}
+	return Category{}, false
+}
+
+func (k *Consent) path() string {
+	if k.Path != "" {
+		return strings.TrimSuffix(k.Path, "/")
+	}
+	return "/consent"
+}
+
+// localPath returns p if it's a path on this site, else "".
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, `/\`) {
+		return ""
+	}
+	return p
+}
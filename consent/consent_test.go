@@ -0,0 +1,120 @@
+package consent_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/consent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const page = `<html><body><h1>Home</h1>
+<bk-consent-gate category="analytics"><script src="https://analytics.example.com/a.js"></script></bk-consent-gate>
+marketing=<%= consented("marketing") %>
+<bk-consent></bk-consent>
+</body></html>`
+
+// htmlString renders a Plush string as HTML, so its components expand.
+type htmlString struct{ render.Renderer }
+
+func (htmlString) ContentType() string { return "text/html; charset=utf-8" }
+
+func newApp(t *testing.T) *buffkittest.App {
+	t.Helper()
+	return buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Consent: true},
+		Setup: func(app *buffalo.App) {
+			app.GET("/home", func(c buffalo.Context) error {
+				return c.Render(http.StatusOK, htmlString{render.String(page)})
+			})
+		},
+	})
+}
+
+func TestBannerUntilChosen(t *testing.T) {
+	app := newApp(t)
+	client := app.Client()
+
+	body := client.Get("/home?tab=1").Body.String()
+	buffkittest.AssertElement(t, body, "div", "class", "bk-consent")
+	// Buffalo adds a trailing slash to the path
+	buffkittest.AssertElement(t, body, "input", "name", "return_to", "value", "/home/?tab=1")
+	buffkittest.AssertElement(t, body, "a", "href", "/consent?return_to=%2Fhome%2F%3Ftab%3D1")
+	buffkittest.AssertNoElement(t, body, "script", "src", "https://analytics.example.com/a.js")
+	assert.Contains(t, body, "marketing=false")
+
+	res := client.Post("/consent", url.Values{"accept": {"all"}, "return_to": {"/home?tab=1"}})
+	buffkittest.AssertRedirect(t, res, "/home?tab=1")
+
+	body = client.Get("/home").Body.String()
+	buffkittest.AssertNoElement(t, body, "div", "class", "bk-consent")
+	buffkittest.AssertElement(t, body, "script", "src", "https://analytics.example.com/a.js")
+	assert.Contains(t, body, "marketing=true")
+}
+
+func TestNecessaryOnly(t *testing.T) {
+	app := newApp(t)
+	client := app.Client()
+	client.Post("/consent", url.Values{"accept": {"necessary"}, "return_to": {"/home"}})
+
+	body := client.Get("/home").Body.String()
+	buffkittest.AssertNoElement(t, body, "div", "class", "bk-consent")
+	buffkittest.AssertNoElement(t, body, "script", "src", "https://analytics.example.com/a.js")
+	assert.Contains(t, body, "marketing=false")
+}
+
+func TestPreferencesPage(t *testing.T) {
+	app := newApp(t)
+	client := app.Client()
+
+	body := client.Get("/consent").Body.String()
+	buffkittest.AssertElement(t, body, "input", "value", "necessary", "checked", "", "disabled", "")
+	buffkittest.AssertElement(t, body, "input", "value", "analytics")
+	buffkittest.AssertNoElement(t, body, "input", "value", "analytics", "checked", "")
+
+	res := client.Post("/consent", url.Values{"categories": {"analytics", "bogus"}})
+	buffkittest.AssertRedirect(t, res, "/consent")
+	body = client.Get("/consent").Body.String()
+	buffkittest.AssertText(t, body, "Your cookie preferences were saved")
+	buffkittest.AssertElement(t, body, "input", "value", "analytics", "checked", "")
+	buffkittest.AssertNoElement(t, body, "input", "value", "marketing", "checked", "")
+
+	body = client.Get("/home").Body.String()
+	buffkittest.AssertElement(t, body, "script", "src", "https://analytics.example.com/a.js")
+	assert.Contains(t, body, "marketing=false")
+
+	// Offsite return_to is ignored
+	res = client.Post("/consent", url.Values{"accept": {"all"}, "return_to": {"//evil.example.com"}})
+	buffkittest.AssertRedirect(t, res, "/consent")
+}
+
+func TestForgedAndOutdatedCookies(t *testing.T) {
+	app := newApp(t)
+	client := app.Client()
+	client.Post("/consent", url.Values{"accept": {"necessary"}})
+
+	// Rewriting the signed cookie's categories voids it
+	body := app.Client().Do(withCookie(t, "/home", "/consent?c=necessary%2Canalytics&expires=9999999999&signature=forged")).Body.String()
+	buffkittest.AssertElement(t, body, "div", "class", "bk-consent")
+	buffkittest.AssertNoElement(t, body, "script", "src", "https://analytics.example.com/a.js")
+
+	// A new Version asks again
+	app.Kit.Consent.Version = "2"
+	body = client.Get("/home").Body.String()
+	buffkittest.AssertElement(t, body, "div", "class", "bk-consent")
+}
+
+func withCookie(t *testing.T, path, value string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, path, strings.NewReader(""))
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: consent.CookieName, Value: value})
+	return req
+}
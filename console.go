@@ -0,0 +1,249 @@
+package buffkit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/mail"
+)
+
+// consoleCommand is one command of the buffkit:console prompt.
+type consoleCommand struct {
+	usage string
+	desc  string
+	run   func(ctx context.Context, kit *Kit, out io.Writer, args []string) error
+
+	// rest passes everything after the first argument as the second, for
+	// arguments with spaces such as JSON
+	rest bool
+}
+
+// errConsoleUsage is returned by commands given the wrong arguments, for
+// the console to print their usage.
+var errConsoleUsage = errors.New("wrong arguments")
+
+// consoleCommands are the commands buffkit:console understands, by name.
+var consoleCommands = map[string]consoleCommand{
+	"users": {
+		usage: "users [offset] [limit]",
+		desc:  "List users (20 at a time)",
+		run:   consoleUsers,
+	},
+	"user": {
+		usage: "user EMAIL",
+		desc:  "Show a user",
+		run:   consoleUser,
+	},
+	"enqueue": {
+		usage: "enqueue TYPE [JSON]",
+		desc:  "Enqueue a job, e.g. enqueue email:send {\"to\":\"ada@example.com\"}",
+		run:   consoleEnqueue,
+		rest:  true,
+	},
+	"handlers": {
+		usage: "handlers",
+		desc:  "List the job types with handlers",
+		run:   consoleHandlers,
+	},
+	"workers": {
+		usage: "workers",
+		desc:  "List job workers and their last heartbeat",
+		run:   consoleWorkers,
+	},
+	"mail": {
+		usage: "mail TO [SUBJECT]",
+		desc:  "Send a test email through the configured sender",
+		run:   consoleMail,
+	},
+}
+
+// runConsole reads commands from in, one per line, and runs them against
+// kit until in ends or the command is exit. A failing command prints its
+// error and the prompt carries on.
+func runConsole(ctx context.Context, kit *Kit, in io.Reader, out io.Writer) error {
+	fmt.Fprintln(out, "Buffkit console. Type help for commands, exit to leave.")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "buffkit> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		name, args := fields[0], fields[1:]
+		switch name {
+		case "exit", "quit":
+			return nil
+		case "help", "?":
+			consoleHelp(out)
+			continue
+		}
+		cmd, ok := consoleCommands[name]
+		if !ok {
+			fmt.Fprintf(out, "unknown command %q; type help for commands\n", name)
+			continue
+		}
+		if cmd.rest && len(args) > 1 {
+			rest := strings.TrimSpace(line[len(name):])
+			args = []string{args[0], strings.TrimSpace(rest[len(args[0]):])}
+		}
+		err := cmd.run(ctx, kit, out, args)
+		switch {
+		case errors.Is(err, errConsoleUsage):
+			fmt.Fprintf(out, "usage: %s\n", cmd.usage)
+		case err != nil:
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+}
+
+func consoleHelp(out io.Writer) {
+	names := make([]string, 0, len(consoleCommands))
+	for name := range consoleCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := consoleCommands[name]
+		fmt.Fprintf(out, "  %-24s %s\n", cmd.usage, cmd.desc)
+	}
+	fmt.Fprintf(out, "  %-24s %s\n", "exit", "Leave the console")
+}
+
+func consoleUsers(ctx context.Context, kit *Kit, out io.Writer, args []string) error {
+	store, ok := kit.AuthStore.(auth.ProvisioningStore)
+	if !ok {
+		return fmt.Errorf("the user store (%T) can't list users; it needs to be an auth.ProvisioningStore", kit.AuthStore)
+	}
+	offset, limit := 0, 20
+	for i, dst := range []*int{&offset, &limit} {
+		if i < len(args) {
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return errConsoleUsage
+			}
+			*dst = n
+		}
+	}
+
+	users, total, err := store.ListUsers(ctx, offset, limit)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		state := ""
+		if user.DeactivatedAt != nil {
+			state = " (deactivated)"
+		}
+		fmt.Fprintf(out, "  %-20s %s%s\n", user.ID, user.Email, state)
+	}
+	fmt.Fprintf(out, "%d of %d user(s)\n", len(users), total)
+	return nil
+}
+
+func consoleUser(ctx context.Context, kit *Kit, out io.Writer, args []string) error {
+	if len(args) != 1 {
+		return errConsoleUsage
+	}
+	user, err := kit.AuthStore.ByEmail(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	at := func(t *time.Time) string {
+		if t == nil {
+			return "no"
+		}
+		return t.Format(time.RFC3339)
+	}
+	fmt.Fprintf(out, "  ID:          %s\n", user.ID)
+	fmt.Fprintf(out, "  Email:       %s\n", user.Email)
+	fmt.Fprintf(out, "  Name:        %s\n", user.DisplayName)
+	fmt.Fprintf(out, "  Username:    %s\n", user.Username)
+	fmt.Fprintf(out, "  Verified:    %s\n", at(user.EmailVerifiedAt))
+	fmt.Fprintf(out, "  Deactivated: %s\n", at(user.DeactivatedAt))
+	return nil
+}
+
+func consoleEnqueue(ctx context.Context, kit *Kit, out io.Writer, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errConsoleUsage
+	}
+	if kit.Jobs == nil || kit.Jobs.Client == nil {
+		return fmt.Errorf("jobs aren't configured - set Config.RedisURL")
+	}
+	payload := json.RawMessage("{}")
+	if len(args) == 2 {
+		if !json.Valid([]byte(args[1])) {
+			return fmt.Errorf("the payload isn't valid JSON: %s", args[1])
+		}
+		payload = json.RawMessage(args[1])
+	}
+	if err := kit.Jobs.Enqueue(args[0], payload); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Enqueued %s\n", args[0])
+	return nil
+}
+
+func consoleHandlers(ctx context.Context, kit *Kit, out io.Writer, args []string) error {
+	if kit.Jobs == nil {
+		return fmt.Errorf("jobs aren't configured - set Config.RedisURL")
+	}
+	for _, taskType := range kit.Jobs.Handlers() {
+		fmt.Fprintf(out, "  %s\n", taskType)
+	}
+	return nil
+}
+
+func consoleWorkers(ctx context.Context, kit *Kit, out io.Writer, args []string) error {
+	if kit.Jobs == nil || kit.Jobs.Client == nil {
+		return fmt.Errorf("jobs aren't configured - set Config.RedisURL")
+	}
+	workers, err := kit.Jobs.Workers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, w := range workers {
+		state := "alive"
+		if !w.Alive() {
+			state = "dead"
+		}
+		fmt.Fprintf(out, "  %s (pid %d): %s, last heartbeat %s ago\n", w.Hostname, w.PID, state, time.Since(w.LastHeartbeat).Round(time.Second))
+	}
+	fmt.Fprintf(out, "%d worker(s)\n", len(workers))
+	return nil
+}
+
+func consoleMail(ctx context.Context, kit *Kit, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errConsoleUsage
+	}
+	subject := "Test email from the Buffkit console"
+	if len(args) > 1 {
+		subject = strings.Join(args[1:], " ")
+	}
+	err := kit.Mail.Send(ctx, mail.Message{
+		To:      args[0],
+		Subject: subject,
+		Text:    "This is a test email sent from buffkit:console at " + time.Now().Format(time.RFC1123) + ".",
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Sent to %s with %T\n", args[0], kit.Mail)
+	return nil
+}
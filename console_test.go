@@ -0,0 +1,54 @@
+package buffkit
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsole(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret"), RedisURL: "memory://", DevMode: true})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	require.NoError(t, kit.AuthStore.Create(context.Background(), &auth.User{Email: "ada@example.com", DisplayName: "Ada"}))
+
+	script := strings.Join([]string{
+		"users",
+		"user ada@example.com",
+		"user bob@example.com",
+		`enqueue report:build {"month": "2026-09", "format": "pdf"}`,
+		"enqueue report:build {nope",
+		"mail ada@example.com Hello from support",
+		"users many",
+		"bogus",
+		"",
+		"help",
+		"exit",
+		"users",
+	}, "\n")
+	var out bytes.Buffer
+	require.NoError(t, runConsole(context.Background(), kit, strings.NewReader(script), &out))
+
+	output := out.String()
+	assert.Contains(t, output, "  ada@example.com      ada@example.com\n1 of 1 user(s)")
+	assert.Contains(t, output, "  Name:        Ada\n")
+	assert.Contains(t, output, "error: user not found")
+	assert.Contains(t, output, "Enqueued report:build")
+	assert.Contains(t, output, "error: the payload isn't valid JSON: {nope")
+	assert.Contains(t, output, "usage: users [offset] [limit]")
+	assert.Contains(t, output, `unknown command "bogus"`)
+	assert.Contains(t, output, "  enqueue TYPE [JSON]")
+	assert.Equal(t, 1, strings.Count(output, "user(s)"), "exit stops the console")
+
+	sent, ok := kit.Mail.(*mail.DevSender).LastTo("ada@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Hello from support", sent.Subject)
+}
@@ -0,0 +1,52 @@
+package buffkit
+
+import (
+	"database/sql"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/tenancy"
+)
+
+// Key names a value in a request's Buffalo context and the type stored
+// under it, so Set and Get can't disagree about it:
+//
+//	var CartKey buffkit.Key[*Cart] = "cart"
+//
+//	buffkit.Set(c, CartKey, cart)
+//	cart, ok := buffkit.Get(c, CartKey)
+//
+// The value is still stored under the plain string, so templates and
+// c.Value see it as before.
+type Key[T any] string
+
+// The keys Buffkit and Buffalo set themselves. Apps shouldn't store
+// anything else under these names.
+const (
+	// CurrentUserKey holds the signed-in user on routes behind
+	// RequireLogin. auth.CurrentUser works on every route.
+	CurrentUserKey Key[*auth.User] = auth.ContextKey
+
+	// TenantKey holds the tenant tenancy.Middleware resolved.
+	TenantKey Key[*tenancy.Tenant] = tenancy.ContextKey
+
+	// RequestIDKey holds the ID Buffalo's request logger gives each
+	// request.
+	RequestIDKey Key[string] = "request_id"
+
+	// TransactionKey holds the transaction Transactional started,
+	// under TxKey.
+	TransactionKey Key[*sql.Tx] = TxKey
+)
+
+// Set stores v under key in the request's context.
+func Set[T any](c buffalo.Context, key Key[T], v T) {
+	c.Set(string(key), v)
+}
+
+// Get returns the value stored under key, and whether there is one of
+// type T.
+func Get[T any](c buffalo.Context, key Key[T]) (T, bool) {
+	v, ok := c.Value(string(key)).(T)
+	return v, ok
+}
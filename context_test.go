@@ -0,0 +1,57 @@
+package buffkit_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cart struct{ Items int }
+
+var cartKey buffkit.Key[*cart] = "cart"
+
+func TestContextKeys(t *testing.T) {
+	var got string
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Setup: func(a *buffalo.App) {
+			a.GET("/cart", func(c buffalo.Context) error {
+				_, ok := buffkit.Get(c, cartKey)
+				assert.False(t, ok, "nothing set yet")
+
+				buffkit.Set(c, cartKey, &cart{Items: 2})
+				items, ok := buffkit.Get(c, cartKey)
+				require.True(t, ok)
+				assert.Equal(t, 2, items.Items)
+				assert.Same(t, items, c.Value("cart"), "stored under the plain string")
+
+				c.Set("cart", "not a cart")
+				_, ok = buffkit.Get(c, cartKey)
+				assert.False(t, ok, "a value of another type isn't returned")
+
+				id, ok := buffkit.Get(c, buffkit.RequestIDKey)
+				assert.True(t, ok)
+				assert.NotEmpty(t, id)
+				return c.Render(http.StatusOK, render.String("ok"))
+			})
+			a.GET("/me", buffkit.RequireLogin(func(c buffalo.Context) error {
+				user, ok := buffkit.Get(c, buffkit.CurrentUserKey)
+				require.True(t, ok)
+				got = user.Email
+				return c.Render(http.StatusOK, render.String("ok"))
+			}))
+		},
+	})
+
+	require.Equal(t, http.StatusOK, app.Client().Get("/cart").Code)
+
+	client := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com"})
+	require.Equal(t, http.StatusOK, client.Get("/me").Code)
+	assert.Equal(t, "ada@example.com", got)
+}
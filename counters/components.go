@@ -0,0 +1,68 @@
+package counters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+)
+
+// liveScript keeps a counter's elements up to date from its SSE event.
+// The page's counters share one connection.
+const liveScript = `<script>(function(){var s=window.bkCounterSource;if(!s){s=window.bkCounterSource=new EventSource(%[1]s,{withCredentials:true});s.bkEvents={}}var e=%[2]s;if(s.bkEvents[e])return;s.bkEvents[e]=true;s.addEventListener(e,function(m){document.querySelectorAll("[data-bk-counter]").forEach(function(el){if(el.getAttribute("data-bk-counter")===e)el.textContent=m.data})})})();</script>`
+
+// RegisterComponents registers <bk-counter>, which shows a counter's
+// value and keeps it up to date as it changes:
+//
+//	Inbox <bk-counter key="unread:<%= user.ID %>"></bk-counter>
+//
+// With a window, it shows the windowed count instead, as of when the
+// page was rendered; poll it with htmx for a dashboard tile:
+//
+//	<bk-counter key="signups" window="24h"></bk-counter>
+func (c *Counters) RegisterComponents(r *components.Registry) {
+	r.RegisterContext("bk-counter", func(bc buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		key := attrs["key"]
+		if err := validKey(key); err != nil {
+			return nil, fmt.Errorf("bk-counter: %w", err)
+		}
+		var ctx context.Context = context.Background()
+		if bc != nil {
+			ctx = bc
+		}
+
+		if w := attrs["window"]; w != "" {
+			window, err := time.ParseDuration(w)
+			if err != nil {
+				return nil, fmt.Errorf("bk-counter: window %q: %w", w, err)
+			}
+			n, err := c.Count(ctx, key, window)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(fmt.Sprintf(`<span class="bk-counter">%d</span>`, n)), nil
+		}
+
+		n, err := c.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		out := fmt.Sprintf(`<span class="bk-counter" data-bk-counter="%s">%d</span>`, html.EscapeString(Event(key)), n)
+		if c.Publisher != nil {
+			path, err := json.Marshal(c.eventsPath())
+			if err != nil {
+				return nil, err
+			}
+			event, err := json.Marshal(Event(key))
+			if err != nil {
+				return nil, err
+			}
+			out += fmt.Sprintf(liveScript, path, event)
+		}
+		return []byte(out), nil
+	})
+}
@@ -0,0 +1,264 @@
+// Package counters keeps soft real-time counts, such as unread messages,
+// signups today and requests per client, in Redis or, without it, in
+// memory. Plain counters go up and down and push their new value over
+// SSE as they change:
+//
+//	kit.Counters.Incr(ctx, "unread:"+user.ID)
+//	kit.Counters.Reset(ctx, "unread:"+user.ID) // once they've read them
+//
+// and pages show them live with <bk-counter key="unread:<%= user.ID %>">.
+// Windowed counts record events and count those in a recent window:
+//
+//	kit.Counters.Hit(ctx, "signups")
+//	n, err := kit.Counters.Count(ctx, "signups", time.Hour)
+//	perSecond, err := kit.Counters.Rate(ctx, "api:"+key, time.Minute)
+//
+// and Allow is a fixed-window rate limit:
+//
+//	if ok, err := kit.Counters.Allow(ctx, "login:"+ip, 10, time.Minute); err == nil && !ok {
+//	    return c.Error(http.StatusTooManyRequests, errors.New("slow down"))
+//	}
+//
+// Counts are "soft": they aren't transactional with the database and a
+// Redis restart may lose them, so don't keep anything in them that can't
+// be recounted.
+package counters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/johnjansen/buffkit/clock"
+)
+
+// Publisher pushes events over SSE; *ssr.Broker implements it.
+type Publisher interface {
+	BroadcastChannel(channel, eventName string, html []byte)
+}
+
+// resolution is a size of bucket windowed counts are kept in, and how
+// long its buckets are kept.
+type resolution struct {
+	size time.Duration
+	ttl  time.Duration
+	name string
+}
+
+// resolutions are the bucket sizes, finest first. Each Hit adds to a
+// bucket of each, and Count sums the finest that covers the window in at
+// most maxBuckets buckets.
+var resolutions = []resolution{
+	{time.Second, 2 * time.Minute, "s"},
+	{time.Minute, 2 * time.Hour, "m"},
+	{time.Hour, 48 * time.Hour, "h"},
+}
+
+// maxBuckets is the most buckets Count sums.
+const maxBuckets = 120
+
+// MaxWindow is the longest window Count and Rate count over.
+const MaxWindow = 48 * time.Hour
+
+// Counters keeps counters in a Store.
+type Counters struct {
+	Store Store
+
+	// Publisher pushes each plain counter's new value, as the Event(key)
+	// SSE event, when it changes. Nil doesn't push them.
+	Publisher Publisher
+
+	// Channel picks the SSE channel key's changes go to, such as the
+	// channel of the user an unread count belongs to. Nil uses the
+	// global channel, which every connected client gets.
+	Channel func(key string) string
+
+	// EventsPath is where <bk-counter> connects for changes. Defaults to
+	// "/events".
+	EventsPath string
+
+	Clock clock.Clock // Defaults to clock.Real
+}
+
+// New creates Counters kept in store.
+func New(store Store) *Counters {
+	return &Counters{Store: store}
+}
+
+// Event is the SSE event key's changes are pushed as.
+func Event(key string) string {
+	return "counter:" + key
+}
+
+// Incr adds one to key and returns its new value.
+func (c *Counters) Incr(ctx context.Context, key string) (int64, error) {
+	return c.Add(ctx, key, 1)
+}
+
+// Decr takes one from key and returns its new value.
+func (c *Counters) Decr(ctx context.Context, key string) (int64, error) {
+	return c.Add(ctx, key, -1)
+}
+
+// Add adds n, which may be negative, to key and returns its new value.
+func (c *Counters) Add(ctx context.Context, key string, n int64) (int64, error) {
+	if err := validKey(key); err != nil {
+		return 0, err
+	}
+	value, err := c.Store.Add(ctx, key, n, 0)
+	if err != nil {
+		return 0, err
+	}
+	c.publish(key, value)
+	return value, nil
+}
+
+// Get returns key's value, zero if it was never set.
+func (c *Counters) Get(ctx context.Context, key string) (int64, error) {
+	values, err := c.Store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+// Set sets key to n, such as after recounting it from the database.
+func (c *Counters) Set(ctx context.Context, key string, n int64) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	if err := c.Store.Set(ctx, key, n); err != nil {
+		return err
+	}
+	c.publish(key, n)
+	return nil
+}
+
+// Reset sets key back to zero.
+func (c *Counters) Reset(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	if err := c.Store.Delete(ctx, key); err != nil {
+		return err
+	}
+	c.publish(key, 0)
+	return nil
+}
+
+// Hit records an event for key's windowed counts.
+func (c *Counters) Hit(ctx context.Context, key string) error {
+	return c.HitN(ctx, key, 1)
+}
+
+// HitN records n events for key's windowed counts.
+func (c *Counters) HitN(ctx context.Context, key string, n int64) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	now := clock.Or(c.Clock).Now()
+	for _, res := range resolutions {
+		if _, err := c.Store.Add(ctx, bucketKey(key, res, bucket(now, res)), n, res.ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Count returns how many events were recorded for key in the last
+// window, up to MaxWindow. It's counted in whole buckets of a second, a
+// minute or an hour, depending on the window, so the oldest bucket may
+// be partly outside it.
+func (c *Counters) Count(ctx context.Context, key string, window time.Duration) (int64, error) {
+	if window <= 0 || window > MaxWindow {
+		return 0, fmt.Errorf("counters: window %s isn't between 0 and %s", window, MaxWindow)
+	}
+	res := resolutions[len(resolutions)-1]
+	for _, r := range resolutions {
+		if window <= maxBuckets*r.size {
+			res = r
+			break
+		}
+	}
+
+	last := bucket(clock.Or(c.Clock).Now(), res)
+	n := int64((window + res.size - 1) / res.size)
+	keys := make([]string, 0, n)
+	for i := int64(0); i < n; i++ {
+		keys = append(keys, bucketKey(key, res, last-i))
+	}
+	values, err := c.Store.Get(ctx, keys...)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, v := range values {
+		total += v
+	}
+	return total, nil
+}
+
+// Rate returns key's events per second over the last window.
+func (c *Counters) Rate(ctx context.Context, key string, window time.Duration) (float64, error) {
+	n, err := c.Count(ctx, key, window)
+	if err != nil {
+		return 0, err
+	}
+	return float64(n) / window.Seconds(), nil
+}
+
+// Allow counts a request against key's limit per window, and reports
+// whether it's within it. Windows are fixed, starting at multiples of
+// window, so up to twice limit can get through around their boundary.
+func (c *Counters) Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, error) {
+	if err := validKey(key); err != nil {
+		return false, err
+	}
+	if window <= 0 {
+		return false, fmt.Errorf("counters: window %s isn't above 0", window)
+	}
+	start := clock.Or(c.Clock).Now().UnixNano() / int64(window)
+	n, err := c.Store.Add(ctx, "allow:"+key+":"+window.String()+":"+strconv.FormatInt(start, 10), 1, window)
+	if err != nil {
+		return false, err
+	}
+	return n <= limit, nil
+}
+
+// publish pushes key's new value to the pages showing it.
+func (c *Counters) publish(key string, value int64) {
+	if c.Publisher == nil {
+		return
+	}
+	channel := ""
+	if c.Channel != nil {
+		channel = c.Channel(key)
+	}
+	c.Publisher.BroadcastChannel(channel, Event(key), []byte(strconv.FormatInt(value, 10)))
+}
+
+func (c *Counters) eventsPath() string {
+	if c.EventsPath != "" {
+		return c.EventsPath
+	}
+	return "/events"
+}
+
+// bucket numbers the bucket of res that t falls in.
+func bucket(t time.Time, res resolution) int64 {
+	return t.Unix() / int64(res.size/time.Second)
+}
+
+func bucketKey(key string, res resolution, bucket int64) string {
+	return "hits:" + key + ":" + res.name + ":" + strconv.FormatInt(bucket, 10)
+}
+
+// validKey refuses keys that can't be a counter.
+func validKey(key string) error {
+	if key == "" {
+		return errors.New("counters: empty key")
+	}
+	return nil
+}
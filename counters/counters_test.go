@@ -0,0 +1,235 @@
+package counters_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/counters"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type published struct {
+	channel, event, data string
+}
+
+type fakePublisher struct {
+	mu     sync.Mutex
+	events []published
+}
+
+func (p *fakePublisher) BroadcastChannel(channel, eventName string, html []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, published{channel, eventName, string(html)})
+}
+
+func TestStores(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	memory := counters.NewMemoryStore()
+	memory.Clock = fake
+	mr := miniredis.RunT(t)
+	stores := map[string]counters.Store{
+		"memory": memory,
+		"redis":  counters.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+	// expire moves each store's time on past a ttl
+	expire := map[string]func(time.Duration){
+		"memory": fake.Advance,
+		"redis":  mr.FastForward,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			n, err := store.Add(ctx, "a", 2, 0)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+			n, err = store.Add(ctx, "a", -3, 0)
+			require.NoError(t, err)
+			assert.Equal(t, int64(-1), n)
+
+			require.NoError(t, store.Set(ctx, "b", 40))
+			values, err := store.Get(ctx, "a", "b", "missing")
+			require.NoError(t, err)
+			assert.Equal(t, []int64{-1, 40, 0}, values)
+
+			require.NoError(t, store.Delete(ctx, "a"))
+			require.NoError(t, store.Delete(ctx, "a"), "deleting twice is fine")
+			values, err = store.Get(ctx, "a")
+			require.NoError(t, err)
+			assert.Equal(t, []int64{0}, values)
+
+			// the expiry is set when the counter's created, not on each add
+			_, err = store.Add(ctx, "brief", 1, time.Minute)
+			require.NoError(t, err)
+			expire[name](40 * time.Second)
+			n, err = store.Add(ctx, "brief", 1, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+			expire[name](30 * time.Second)
+			values, err = store.Get(ctx, "brief", "b")
+			require.NoError(t, err)
+			assert.Equal(t, []int64{0, 40}, values, "only brief expires")
+		})
+	}
+}
+
+func TestPlainCounters(t *testing.T) {
+	ctx := context.Background()
+	pub := &fakePublisher{}
+	c := counters.New(counters.NewMemoryStore())
+	c.Publisher = pub
+	c.Channel = func(key string) string { return "user:" + strings.TrimPrefix(key, "unread:") }
+
+	n, err := c.Incr(ctx, "unread:7")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = c.Add(ctx, "unread:7", 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = c.Decr(ctx, "unread:7")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	n, err = c.Get(ctx, "unread:7")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+
+	require.NoError(t, c.Set(ctx, "unread:7", 9))
+	require.NoError(t, c.Reset(ctx, "unread:7"))
+	n, err = c.Get(ctx, "unread:7")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	var data []string
+	for _, e := range pub.events {
+		assert.Equal(t, "user:7", e.channel)
+		assert.Equal(t, "counter:unread:7", e.event)
+		data = append(data, e.data)
+	}
+	assert.Equal(t, []string{"1", "5", "4", "9", "0"}, data, "every change is pushed, reads aren't")
+
+	_, err = c.Incr(ctx, "")
+	assert.Error(t, err)
+}
+
+func TestWindowedCounts(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	store := counters.NewMemoryStore()
+	store.Clock = fake
+	c := counters.New(store)
+	c.Clock = fake
+
+	require.NoError(t, c.HitN(ctx, "signups", 3))
+	fake.Advance(30 * time.Second)
+	require.NoError(t, c.Hit(ctx, "signups"))
+
+	n, err := c.Count(ctx, "signups", 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = c.Count(ctx, "signups", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	rate, err := c.Rate(ctx, "signups", time.Minute)
+	require.NoError(t, err)
+	assert.InDelta(t, 4.0/60, rate, 1e-9)
+
+	// longer windows count in minute and hour buckets, kept for longer
+	fake.Advance(90 * time.Minute)
+	n, err = c.Count(ctx, "signups", time.Minute)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = c.Count(ctx, "signups", 2*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	n, err = c.Count(ctx, "signups", 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+
+	_, err = c.Count(ctx, "signups", 0)
+	assert.Error(t, err)
+	_, err = c.Count(ctx, "signups", 72*time.Hour)
+	assert.Error(t, err)
+}
+
+func TestAllow(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	store := counters.NewMemoryStore()
+	store.Clock = fake
+	c := counters.New(store)
+	c.Clock = fake
+
+	for i := 0; i < 3; i++ {
+		ok, err := c.Allow(ctx, "login:1.2.3.4", 3, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := c.Allow(ctx, "login:1.2.3.4", 3, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "the fourth in a minute is over the limit")
+	ok, err = c.Allow(ctx, "login:5.6.7.8", 3, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "limits are per key")
+
+	fake.Advance(time.Minute)
+	ok, err = c.Allow(ctx, "login:1.2.3.4", 3, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "the next window starts again")
+}
+
+func TestComponent(t *testing.T) {
+	ctx := context.Background()
+	c := counters.New(counters.NewMemoryStore())
+	registry := components.NewRegistry()
+	c.RegisterComponents(registry)
+
+	_, err := c.Add(ctx, "unread:7", 3)
+	require.NoError(t, err)
+	out, err := registry.Render("bk-counter", map[string]string{"key": "unread:7"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<span class="bk-counter" data-bk-counter="counter:unread:7">3</span>`, string(out), "no script without a publisher")
+
+	require.NoError(t, c.Hit(ctx, "signups"))
+	out, err = registry.Render("bk-counter", map[string]string{"key": "signups", "window": "24h"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<span class="bk-counter">1</span>`, string(out))
+
+	_, err = registry.Render("bk-counter", map[string]string{"key": "signups", "window": "soon"}, nil)
+	assert.Error(t, err)
+	_, err = registry.Render("bk-counter", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestWire(t *testing.T) {
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Counters: true},
+		Setup: func(a *buffalo.App) {
+			a.GET("/inbox", func(c buffalo.Context) error {
+				c.Response().Header().Set("Content-Type", "text/html")
+				_, err := c.Response().Write([]byte(`<html><body>Inbox <bk-counter key="unread"></bk-counter></body></html>`))
+				return err
+			})
+		},
+	})
+	require.NotNil(t, app.Kit.Counters)
+	_, err := app.Kit.Counters.Add(context.Background(), "unread", 2)
+	require.NoError(t, err)
+
+	res := app.Client().Get("/inbox")
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), `data-bk-counter="counter:unread">2</span>`)
+	assert.Contains(t, res.Body.String(), `new EventSource("/events"`)
+}
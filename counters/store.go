@@ -0,0 +1,194 @@
+package counters
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps counters. MemoryStore suits tests and a single process;
+// RedisStore shares counters between processes.
+type Store interface {
+	// Add adds n to key and returns its new value. A counter that doesn't
+	// exist starts at zero. A ttl above zero expires the counter that
+	// long after it was created; zero keeps it.
+	Add(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+
+	// Get returns the values of keys, zero for those that don't exist.
+	Get(ctx context.Context, keys ...string) ([]int64, error)
+
+	// Set sets key to n, without an expiry.
+	Set(ctx context.Context, key string, n int64) error
+
+	// Delete removes key. Removing an unknown key isn't an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryStore keeps counters in memory, for tests and single-process
+// apps. Expired counters are dropped when they're next read, and swept
+// every sweepEvery adds so windows nobody reads again are freed too.
+type MemoryStore struct {
+	Clock clock.Clock // Defaults to clock.Real
+
+	mu     sync.Mutex
+	values map[string]memoryValue
+	adds   int // since the last sweep
+}
+
+// sweepEvery is how many adds MemoryStore takes between sweeps.
+const sweepEvery = 1000
+
+type memoryValue struct {
+	n         int64
+	expiresAt time.Time // zero never expires
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string]memoryValue)}
+}
+
+// value returns key's value, dropping it if it expired. s.mu is held.
+func (s *MemoryStore) value(key string, now time.Time) (memoryValue, bool) {
+	v, ok := s.values[key]
+	if ok && !v.expiresAt.IsZero() && !now.Before(v.expiresAt) {
+		delete(s.values, key)
+		return memoryValue{}, false
+	}
+	return v, ok
+}
+
+// sweep drops every expired counter. s.mu is held.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, v := range s.values {
+		if !v.expiresAt.IsZero() && !now.Before(v.expiresAt) {
+			delete(s.values, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := clock.Or(s.Clock).Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.adds++; s.adds >= sweepEvery {
+		s.sweep(now)
+		s.adds = 0
+	}
+	v, ok := s.value(key, now)
+	if !ok && ttl > 0 {
+		v.expiresAt = now.Add(ttl)
+	}
+	v.n += n
+	s.values[key] = v
+	return v.n, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, keys ...string) ([]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := clock.Or(s.Clock).Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make([]int64, len(keys))
+	for i, key := range keys {
+		v, _ := s.value(key, now)
+		values[i] = v.n
+	}
+	return values, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, n int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = memoryValue{n: n}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+// redisPrefix namespaces RedisStore's keys.
+const redisPrefix = "buffkit:counters:"
+
+// RedisStore keeps counters in Redis, which expires them itself.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore creates a counter store using client.
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Add(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	pipe := s.client.TxPipeline()
+	incr := pipe.IncrBy(ctx, redisPrefix+key, n)
+	if ttl > 0 {
+		// NX keeps the expiry set when the counter was created
+		pipe.ExpireNX(ctx, redisPrefix+key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("counters: add to %s: %w", key, err)
+	}
+	return incr.Val(), nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, keys ...string) ([]int64, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = redisPrefix + key
+	}
+	raw, err := s.client.MGet(ctx, prefixed...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("counters: get: %w", err)
+	}
+	values := make([]int64, len(keys))
+	for i, v := range raw {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Sscan(str, &values[i]); err != nil {
+			return nil, fmt.Errorf("counters: %s is not a number: %w", keys[i], err)
+		}
+	}
+	return values, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, n int64) error {
+	if err := s.client.Set(ctx, redisPrefix+key, n, 0).Err(); err != nil {
+		return fmt.Errorf("counters: set %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, redisPrefix+key).Err()
+}
+
+// Close closes the store's Redis client.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,36 @@
+package counters
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreSweeps(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Now())
+	store := NewMemoryStore()
+	store.Clock = clk
+
+	// A bucket per minute, never read again once its window has passed
+	for i := range sweepEvery {
+		_, err := store.Add(ctx, fmt.Sprintf("hits:%d", i), 1, time.Minute)
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.Set(ctx, "total", 5))
+	clk.Advance(time.Minute)
+	for range sweepEvery {
+		_, err := store.Add(ctx, "hits:now", 1, time.Minute)
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, store.values, 2, "expired buckets should be freed")
+	values, err := store.Get(ctx, "total", "hits:now")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{5, sweepEvery}, values)
+}
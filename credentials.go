@@ -0,0 +1,404 @@
+package buffkit
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Where credentials live unless told otherwise.
+const (
+	// CredentialsKeyEnv names the environment variable holding the
+	// credentials key, as 64 hex digits. It takes precedence over the key
+	// file, and is how production gets the key.
+	CredentialsKeyEnv = "BUFFKIT_CREDENTIALS_KEY"
+
+	// DefaultCredentialsPath is the encrypted credentials file. It is
+	// safe to commit.
+	DefaultCredentialsPath = "config/credentials.json.enc"
+
+	// DefaultCredentialsKeyPath is the key file buffkit:credentials:edit
+	// creates for development. Never commit it.
+	DefaultCredentialsKeyPath = "config/credentials.key"
+)
+
+// ErrCredentialMissing is returned for credentials that aren't set.
+var ErrCredentialMissing = errors.New("buffkit: credential not set")
+
+// Credentials are the app's secrets, kept in a file encrypted with
+// AES-256-GCM so they can be committed with the code. The file holds
+// JSON; edit it with buffkit:credentials:edit, which opens it decrypted
+// in $EDITOR. At runtime, load it and read values by dotted path:
+//
+//	creds, err := buffkit.LoadCredentials(buffkit.DefaultCredentialsPath)
+//	cfg.AuthSecret = []byte(creds.MustString("auth_secret"))
+//	key, err := creds.String("stripe.secret_key")
+//
+// The key comes from BUFFKIT_CREDENTIALS_KEY, or in development the key
+// file next to the credentials.
+type Credentials struct {
+	values map[string]any
+}
+
+// LoadCredentials decrypts the credentials file at path with the key
+// from CredentialsKeyEnv or, when that isn't set, the key file in the
+// same directory.
+func LoadCredentials(path string) (*Credentials, error) {
+	key, err := credentialsKey(credentialsKeyPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return OpenCredentials(path, key)
+}
+
+// OpenCredentials decrypts the credentials file at path with key.
+func OpenCredentials(path string, key []byte) (*Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("buffkit: credentials: %w", err)
+	}
+	plain, err := DecryptCredentials(data, key)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCredentials(plain)
+}
+
+// ParseCredentials reads decrypted credentials, a JSON object.
+func ParseCredentials(plain []byte) (*Credentials, error) {
+	var values map[string]any
+	dec := json.NewDecoder(bytes.NewReader(plain))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("buffkit: credentials must be a JSON object: %w", err)
+	}
+	return &Credentials{values: values}, nil
+}
+
+// Value returns the credential at path, such as "stripe.secret_key",
+// and whether it's set.
+func (c *Credentials) Value(path string) (any, bool) {
+	var v any = c.values
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, v != nil
+}
+
+// Has reports whether the credential at path is set.
+func (c *Credentials) Has(path string) bool {
+	_, ok := c.Value(path)
+	return ok
+}
+
+// String returns the credential at path, which must be a string or a
+// number.
+func (c *Credentials) String(path string) (string, error) {
+	v, ok := c.Value(path)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrCredentialMissing, path)
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("buffkit: credential %s is a %s, not a string", path, jsonKind(v))
+}
+
+// MustString is String for credentials the app can't start without. It
+// panics if the credential isn't set.
+func (c *Credentials) MustString(path string) string {
+	s, err := c.String(path)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Int returns the credential at path, a whole number or a string
+// holding one.
+func (c *Credentials) Int(path string) (int, error) {
+	s, err := c.String(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("buffkit: credential %s is not a whole number", path)
+	}
+	return n, nil
+}
+
+// Bool returns the credential at path, a boolean or a string holding
+// one.
+func (c *Credentials) Bool(path string) (bool, error) {
+	v, ok := c.Value(path)
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrCredentialMissing, path)
+	}
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("buffkit: credential %s is not true or false", path)
+}
+
+// Duration returns the credential at path, a string such as "15m".
+func (c *Credentials) Duration(path string) (time.Duration, error) {
+	s, err := c.String(path)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("buffkit: credential %s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Map returns the string credentials under path, such as the settings
+// of one service.
+func (c *Credentials) Map(path string) (map[string]string, error) {
+	v, ok := c.Value(path)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCredentialMissing, path)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("buffkit: credential %s is a %s, not an object", path, jsonKind(v))
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		switch v := v.(type) {
+		case string:
+			out[k] = v
+		case json.Number:
+			out[k] = v.String()
+		default:
+			return nil, fmt.Errorf("buffkit: credential %s.%s is a %s, not a string", path, k, jsonKind(v))
+		}
+	}
+	return out, nil
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "list"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// EncryptCredentials encrypts plain with key, 32 bytes, for the
+// credentials file.
+func EncryptCredentials(plain, key []byte) ([]byte, error) {
+	gcm, err := credentialsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("buffkit: credentials: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+	return []byte(base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// DecryptCredentials decrypts a credentials file's contents with key.
+func DecryptCredentials(data, key []byte) ([]byte, error) {
+	gcm, err := credentialsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("buffkit: credentials file is corrupt")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("buffkit: credentials can't be decrypted; is it the right key?")
+	}
+	return plain, nil
+}
+
+func credentialsCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("buffkit: credentials key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewCredentialsKey returns a random key, as the hex digits
+// CredentialsKeyEnv and the key file hold.
+func NewCredentialsKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("buffkit: credentials key: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// credentialsKeyPath is the key file for the credentials at path.
+func credentialsKeyPath(path string) string {
+	return filepath.Join(filepath.Dir(path), filepath.Base(DefaultCredentialsKeyPath))
+}
+
+// credentialsKey reads the key from CredentialsKeyEnv, or keyPath.
+func credentialsKey(keyPath string) ([]byte, error) {
+	text, from := os.Getenv(CredentialsKeyEnv), CredentialsKeyEnv
+	if text == "" {
+		data, err := os.ReadFile(keyPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("buffkit: no credentials key: set %s or create %s", CredentialsKeyEnv, keyPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("buffkit: credentials key: %w", err)
+		}
+		text, from = string(data), keyPath
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(text))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("buffkit: %s must hold 64 hex digits", from)
+	}
+	return key, nil
+}
+
+// editCredentials decrypts the credentials at path, lets edit change
+// them in a private temporary file, and encrypts the result back. When
+// there are no credentials yet it starts them, creating the key file
+// unless CredentialsKeyEnv is set, and returns the key file's path.
+func editCredentials(path string, edit func(file string) error) (created string, err error) {
+	keyPath := credentialsKeyPath(path)
+	_, err = os.Stat(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("buffkit: credentials: %w", err)
+	}
+
+	key, err := credentialsKey(keyPath)
+	if err != nil {
+		// New credentials get a new key file, but existing ones need the
+		// key they were encrypted with
+		if _, statErr := os.Stat(keyPath); exists || os.Getenv(CredentialsKeyEnv) != "" || !errors.Is(statErr, os.ErrNotExist) {
+			return "", err
+		}
+		text, err := NewCredentialsKey()
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(filepath.Dir(keyPath), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(keyPath, []byte(text+"\n"), 0o600); err != nil {
+			return "", err
+		}
+		created = keyPath
+		if key, err = credentialsKey(keyPath); err != nil {
+			return "", err
+		}
+	}
+
+	var plain []byte
+	if exists {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("buffkit: credentials: %w", err)
+		}
+		if plain, err = DecryptCredentials(data, key); err != nil {
+			return "", err
+		}
+	} else {
+		// Start with the one secret every app needs
+		secret, err := NewCredentialsKey()
+		if err != nil {
+			return "", err
+		}
+		plain = []byte("{\n  \"auth_secret\": \"" + secret + "\"\n}\n")
+	}
+
+	tmp, err := os.CreateTemp("", "credentials-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(plain); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := edit(tmp.Name()); err != nil {
+		return "", fmt.Errorf("buffkit: editing credentials: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	if _, err := ParseCredentials(edited); err != nil {
+		return "", fmt.Errorf("%w; nothing was saved", err)
+	}
+	data, err := EncryptCredentials(edited, key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	// Write beside the file and rename, so a failure can't leave it half
+	// written
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return "", err
+	}
+	return created, os.Rename(path+".tmp", path)
+}
+
+// runEditor opens file in $VISUAL or $EDITOR, falling back to vi, and
+// waits for it to close.
+func runEditor(file string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Editors are often set with flags, such as "code --wait"
+	args := append(strings.Fields(editor), file)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,159 @@
+package buffkit
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsEncryption(t *testing.T) {
+	text, err := NewCredentialsKey()
+	require.NoError(t, err)
+	key, err := hex.DecodeString(text)
+	require.NoError(t, err)
+
+	data, err := EncryptCredentials([]byte(`{"a":"b"}`), key)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"a"`)
+	again, err := EncryptCredentials([]byte(`{"a":"b"}`), key)
+	require.NoError(t, err)
+	assert.NotEqual(t, data, again, "each encryption has its own nonce")
+
+	plain, err := DecryptCredentials(data, key)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":"b"}`, string(plain))
+
+	other, _ := NewCredentialsKey()
+	otherKey, _ := hex.DecodeString(other)
+	_, err = DecryptCredentials(data, otherKey)
+	assert.ErrorContains(t, err, "right key")
+	_, err = DecryptCredentials([]byte("not base64!"), key)
+	assert.ErrorContains(t, err, "corrupt")
+	_, err = EncryptCredentials(nil, key[:16])
+	assert.Error(t, err, "AES-256 only")
+}
+
+func TestCredentialsValues(t *testing.T) {
+	creds, err := ParseCredentials([]byte(`{
+		"auth_secret": "s3cret",
+		"stripe": {"secret_key": "sk_test", "retries": 3, "live": false},
+		"smtp": {"port": "587", "timeout": "15s"},
+		"empty": null
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "s3cret", creds.MustString("auth_secret"))
+	key, err := creds.String("stripe.secret_key")
+	require.NoError(t, err)
+	assert.Equal(t, "sk_test", key)
+	n, err := creds.Int("stripe.retries")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = creds.Int("smtp.port")
+	require.NoError(t, err)
+	assert.Equal(t, 587, n)
+	live, err := creds.Bool("stripe.live")
+	require.NoError(t, err)
+	assert.False(t, live)
+	d, err := creds.Duration("smtp.timeout")
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Second, d)
+	smtp, err := creds.Map("smtp")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"port": "587", "timeout": "15s"}, smtp)
+
+	assert.True(t, creds.Has("stripe"))
+	assert.False(t, creds.Has("empty"))
+	assert.False(t, creds.Has("auth_secret.nested"))
+	_, err = creds.String("aws.key")
+	assert.ErrorIs(t, err, ErrCredentialMissing)
+	_, err = creds.String("stripe")
+	assert.ErrorContains(t, err, "object")
+	_, err = creds.Int("auth_secret")
+	assert.Error(t, err)
+	assert.Panics(t, func() { creds.MustString("missing") })
+
+	_, err = ParseCredentials([]byte(`["not", "an", "object"]`))
+	assert.Error(t, err)
+}
+
+func TestEditCredentials(t *testing.T) {
+	t.Setenv(CredentialsKeyEnv, "")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config", "credentials.json.enc")
+
+	// The first edit creates the key and starts with an auth secret
+	created, err := editCredentials(path, func(file string) error {
+		plain, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(plain), `"auth_secret"`)
+		return os.WriteFile(file, []byte(`{"stripe": {"secret_key": "sk_test"}}`), 0o600)
+	})
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "config", "credentials.key")
+	assert.Equal(t, keyPath, created)
+	info, err := os.Stat(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	creds, err := LoadCredentials(path)
+	require.NoError(t, err)
+	assert.Equal(t, "sk_test", creds.MustString("stripe.secret_key"))
+
+	// Later edits see the decrypted credentials and keep the key
+	created, err = editCredentials(path, func(file string) error {
+		plain, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(plain), "sk_test")
+		return os.WriteFile(file, []byte(`{"stripe": {"secret_key": "sk_live"}}`), 0o600)
+	})
+	require.NoError(t, err)
+	assert.Empty(t, created)
+	creds, err = LoadCredentials(path)
+	require.NoError(t, err)
+	assert.Equal(t, "sk_live", creds.MustString("stripe.secret_key"))
+
+	// Invalid JSON and failed editors save nothing
+	_, err = editCredentials(path, func(file string) error {
+		return os.WriteFile(file, []byte(`{"stripe": `), 0o600)
+	})
+	assert.ErrorContains(t, err, "nothing was saved")
+	_, err = editCredentials(path, func(file string) error { return errors.New("editor crashed") })
+	assert.ErrorContains(t, err, "editor crashed")
+	creds, err = LoadCredentials(path)
+	require.NoError(t, err)
+	assert.Equal(t, "sk_live", creds.MustString("stripe.secret_key"))
+
+	// The environment's key takes precedence, and a wrong one is refused
+	// rather than replaced
+	text, _ := NewCredentialsKey()
+	t.Setenv(CredentialsKeyEnv, text)
+	_, err = LoadCredentials(path)
+	assert.ErrorContains(t, err, "right key")
+	_, err = editCredentials(path, func(string) error { return nil })
+	assert.Error(t, err)
+	t.Setenv(CredentialsKeyEnv, "short")
+	_, err = LoadCredentials(path)
+	assert.ErrorContains(t, err, CredentialsKeyEnv)
+
+	// Without a key, existing credentials can't be opened
+	t.Setenv(CredentialsKeyEnv, "")
+	require.NoError(t, os.Remove(keyPath))
+	_, err = editCredentials(path, func(string) error { return nil })
+	assert.ErrorContains(t, err, "no credentials key")
+	_, err = os.Stat(keyPath)
+	assert.True(t, os.IsNotExist(err), "no new key is made for old credentials")
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.False(t, strings.HasSuffix(e.Name(), ".tmp"), e.Name())
+	}
+}
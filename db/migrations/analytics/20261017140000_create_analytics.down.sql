@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS analytics_daily;
+DROP INDEX IF EXISTS idx_analytics_events_created_at;
+DROP TABLE IF EXISTS analytics_events;
@@ -0,0 +1,20 @@
+-- First-party analytics: raw page views and events, and their daily counts
+CREATE TABLE IF NOT EXISTS analytics_events (
+    name VARCHAR(512) NOT NULL,
+    path VARCHAR(512) NOT NULL DEFAULT '',
+    referrer VARCHAR(512) NOT NULL DEFAULT '',
+    visitor VARCHAR(64) NOT NULL,
+    device VARCHAR(32) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_analytics_events_created_at ON analytics_events(created_at);
+
+CREATE TABLE IF NOT EXISTS analytics_daily (
+    day TIMESTAMP NOT NULL,
+    dimension VARCHAR(32) NOT NULL,
+    value VARCHAR(512) NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    visitors BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, dimension, value)
+);
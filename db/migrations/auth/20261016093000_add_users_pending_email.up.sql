@@ -0,0 +1,2 @@
+-- Track an email change until the new address is confirmed
+ALTER TABLE users ADD COLUMN pending_email VARCHAR(255);
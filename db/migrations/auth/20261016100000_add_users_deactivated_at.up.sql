@@ -0,0 +1,2 @@
+-- Users deactivated by an identity provider can't log in
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMP NULL;
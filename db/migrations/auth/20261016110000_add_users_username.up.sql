@@ -0,0 +1,3 @@
+-- Optional usernames for logging in; stored lowercased
+ALTER TABLE users ADD COLUMN username VARCHAR(32);
+CREATE UNIQUE INDEX idx_users_username ON users(username);
@@ -0,0 +1,6 @@
+-- Registration invitations that have been used; each registers one user
+CREATE TABLE IF NOT EXISTS used_invitations (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    used_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Users' roles, such as admin, set with buffalo task buffkit:users:promote
+ALTER TABLE users ADD COLUMN role VARCHAR(50);
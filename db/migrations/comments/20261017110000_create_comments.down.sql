@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_author;
+DROP INDEX IF EXISTS idx_comments_target;
+DROP TABLE IF EXISTS comments;
@@ -0,0 +1,16 @@
+-- Comments on any record, threaded by parent, soft-deleted by moderators
+CREATE TABLE IF NOT EXISTS comments (
+    id VARCHAR(64) PRIMARY KEY,
+    target_type VARCHAR(64) NOT NULL,
+    target_id VARCHAR(255) NOT NULL,
+    parent_id VARCHAR(64) NOT NULL DEFAULT '',
+    author VARCHAR(255) NOT NULL,
+    author_name VARCHAR(255) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP,
+    deleted_by VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_target ON comments(target_type, target_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_author ON comments(author, created_at);
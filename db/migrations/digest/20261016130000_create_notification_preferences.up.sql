@@ -0,0 +1,7 @@
+-- Which digest emails each user wants; a missing row means yes
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id VARCHAR(36) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    PRIMARY KEY (user_id, name)
+);
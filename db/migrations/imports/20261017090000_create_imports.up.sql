@@ -0,0 +1,27 @@
+-- Uploaded CSV imports, their progress, and why rows failed
+CREATE TABLE IF NOT EXISTS imports (
+    id VARCHAR(32) PRIMARY KEY,
+    importer VARCHAR(255) NOT NULL,
+    owner VARCHAR(255) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    channel VARCHAR(255) NOT NULL DEFAULT '',
+    header TEXT NOT NULL,
+    mapping TEXT NOT NULL,
+    state VARCHAR(20) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    total INTEGER NOT NULL DEFAULT 0,
+    processed INTEGER NOT NULL DEFAULT 0,
+    imported INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS import_errors (
+    import_id VARCHAR(32) NOT NULL REFERENCES imports(id) ON DELETE CASCADE,
+    line INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    field VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    PRIMARY KEY (import_id, line, position)
+);
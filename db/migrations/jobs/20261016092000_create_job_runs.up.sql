@@ -0,0 +1,18 @@
+-- Create job_runs table for background job execution history
+-- Supports multiple database dialects (PostgreSQL, MySQL, SQLite)
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id VARCHAR(36) PRIMARY KEY,
+    task_type VARCHAR(255) NOT NULL,
+    task_id VARCHAR(255),
+    queue VARCHAR(100),
+    payload_hash VARCHAR(64) NOT NULL, -- SHA-256 of the payload, never the payload itself
+    result VARCHAR(20) NOT NULL,       -- success, failure
+    error TEXT,
+    retry_count INTEGER NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_task_type ON job_runs(task_type);
+CREATE INDEX IF NOT EXISTS idx_job_runs_started_at ON job_runs(started_at);
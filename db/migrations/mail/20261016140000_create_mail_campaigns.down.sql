@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS mail_campaign_recipients;
+DROP TABLE IF EXISTS mail_campaigns;
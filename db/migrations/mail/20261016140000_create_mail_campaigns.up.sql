@@ -0,0 +1,23 @@
+-- Broadcast campaigns and the status of each recipient's message
+CREATE TABLE IF NOT EXISTS mail_campaigns (
+    id VARCHAR(32) PRIMARY KEY,
+    template VARCHAR(255) NOT NULL,
+    batch_size INTEGER NOT NULL,
+    rate INTEGER NOT NULL DEFAULT 0,
+    state VARCHAR(20) NOT NULL,
+    run INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS mail_campaign_recipients (
+    campaign_id VARCHAR(32) NOT NULL REFERENCES mail_campaigns(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    data TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    error TEXT,
+    sent_at TIMESTAMP,
+    PRIMARY KEY (campaign_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mail_campaign_recipients_status ON mail_campaign_recipients(campaign_id, status);
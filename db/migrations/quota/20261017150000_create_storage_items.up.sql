@@ -0,0 +1,7 @@
+-- Storage quotas: the size of each file a user has stored
+CREATE TABLE IF NOT EXISTS storage_items (
+    user_id VARCHAR(255) NOT NULL,
+    item VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    PRIMARY KEY (user_id, item)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sagas_state;
+DROP TABLE IF EXISTS sagas;
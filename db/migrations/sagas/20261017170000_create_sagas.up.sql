@@ -0,0 +1,14 @@
+-- Sagas: multi-step jobs, the step each has reached and the data its steps pass on
+CREATE TABLE IF NOT EXISTS sagas (
+    id VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    state VARCHAR(20) NOT NULL,
+    step INTEGER NOT NULL DEFAULT 0,
+    data TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sagas_state ON sagas(state);
@@ -0,0 +1,8 @@
+-- Settings values: the application's under the empty scope, and each user's under their ID
+CREATE TABLE IF NOT EXISTS settings (
+    scope VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (scope, name)
+);
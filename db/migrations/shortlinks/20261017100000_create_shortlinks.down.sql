@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_shortlinks_expires_at;
+DROP TABLE IF EXISTS shortlinks;
@@ -0,0 +1,10 @@
+-- Short links: codes that redirect to longer URLs, with their expiry and clicks
+CREATE TABLE IF NOT EXISTS shortlinks (
+    code VARCHAR(64) PRIMARY KEY,
+    url TEXT NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_shortlinks_expires_at ON shortlinks(expires_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_taggings_taggable;
+DROP TABLE IF EXISTS taggings;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,17 @@
+-- Tags, shared by every kind of record, and which records have them
+CREATE TABLE IF NOT EXISTS tags (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS taggings (
+    tag_id VARCHAR(64) NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    taggable_type VARCHAR(64) NOT NULL,
+    taggable_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tag_id, taggable_type, taggable_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_taggings_taggable ON taggings(taggable_type, taggable_id);
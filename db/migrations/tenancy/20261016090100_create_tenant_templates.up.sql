@@ -0,0 +1,12 @@
+-- Per-tenant template overrides
+-- Rows here shadow the app's templates for a single tenant
+
+CREATE TABLE IF NOT EXISTS tenant_templates (
+    tenant_id VARCHAR(36) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (tenant_id, name),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
+);
@@ -0,0 +1,187 @@
+package buffkit
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Deprecation describes a Buffkit API or configuration that still works
+// but is on its way out, and how to move off it.
+type Deprecation struct {
+	// Name is what's deprecated, e.g. "buffkit.NewMigrationRunner" or
+	// `Config.Dialect "sqlite3"`.
+	Name string
+
+	// Since is the Buffkit version that deprecated it.
+	Since string
+
+	// Hint says what to do instead.
+	Hint string
+}
+
+func (d Deprecation) String() string {
+	return fmt.Sprintf("%s is deprecated since Buffkit %s: %s", d.Name, d.Since, d.Hint)
+}
+
+// configDeprecations are the Config usages Wire warns about. When a field
+// is renamed or a default changes, add an entry here so apps hear about
+// it before the old behaviour goes away.
+var configDeprecations = []struct {
+	Deprecation
+	used func(cfg Config) bool
+}{
+	{
+		Deprecation: Deprecation{
+			Name:  `Config.Dialect "sqlite3"`,
+			Since: "0.1.0-alpha",
+			Hint:  `set Dialect to "sqlite"; "sqlite3" is the driver's name, not the dialect's`,
+		},
+		used: func(cfg Config) bool { return cfg.Dialect == "sqlite3" },
+	},
+}
+
+// apiDeprecations are the deprecated identifiers buffkit:upgrade:check
+// looks for in the app's code, by import path.
+var apiDeprecations = map[string]map[string]Deprecation{
+	"github.com/johnjansen/buffkit": {
+		"MigrationRunner": {
+			Name:  "buffkit.MigrationRunner",
+			Since: "0.1.0-alpha",
+			Hint:  "use migrations.Runner",
+		},
+		"NewMigrationRunner": {
+			Name:  "buffkit.NewMigrationRunner",
+			Since: "0.1.0-alpha",
+			Hint:  "use migrations.NewRunner",
+		},
+	},
+	"github.com/johnjansen/buffkit/migrations": {
+		"BuffkitMigrations": {
+			Name:  "migrations.BuffkitMigrations",
+			Since: "0.1.0-alpha",
+			Hint:  "use buffkit.Migrations(), the set buffkit:migrate applies",
+		},
+		"GetBuffkitMigrations": {
+			Name:  "migrations.GetBuffkitMigrations",
+			Since: "0.1.0-alpha",
+			Hint:  "use buffkit.Migrations(), the set buffkit:migrate applies",
+		},
+		"MigrationList": {
+			Name:  "migrations.MigrationList",
+			Since: "0.1.0-alpha",
+			Hint:  "use Runner.Status on buffkit.Migrations()",
+		},
+	},
+}
+
+// ConfigDeprecations returns the deprecated settings cfg uses. Wire logs
+// them; buffkit:upgrade:check lists them with the deprecated APIs the
+// app's code uses.
+func ConfigDeprecations(cfg Config) []Deprecation {
+	var found []Deprecation
+	for _, d := range configDeprecations {
+		if d.used(cfg) {
+			found = append(found, d.Deprecation)
+		}
+	}
+	return found
+}
+
+// logDeprecations logs a warning for each deprecated setting cfg uses.
+func logDeprecations(cfg Config) {
+	for _, d := range ConfigDeprecations(cfg) {
+		log.Printf("Buffkit: deprecated name=%q since=%s hint=%q", d.Name, d.Since, d.Hint)
+	}
+}
+
+// DeprecatedUse is a use of a deprecated Buffkit API in the app's code.
+type DeprecatedUse struct {
+	Deprecation
+
+	// Pos is where it's used, as file:line:column.
+	Pos string
+}
+
+// UpgradeCheck scans the Go files in fsys (usually the app's root) for
+// uses of deprecated Buffkit APIs, in file order. vendor, node_modules,
+// testdata and hidden directories are skipped, as are files that don't
+// parse.
+func UpgradeCheck(fsys fs.FS) ([]DeprecatedUse, error) {
+	var uses []DeprecatedUse
+	fset := token.NewFileSet()
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			base := d.Name()
+			if name != "." && (strings.HasPrefix(base, ".") || base == "vendor" || base == "node_modules" || base == "testdata") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		file, err := parser.ParseFile(fset, name, src, parser.SkipObjectResolution)
+		if err != nil {
+			return nil
+		}
+		uses = append(uses, deprecatedUses(fset, file)...)
+		return nil
+	})
+	return uses, err
+}
+
+// deprecatedUses finds the deprecated identifiers file refers to through
+// its imports.
+func deprecatedUses(fset *token.FileSet, file *ast.File) []DeprecatedUse {
+	// Map the names the file imports Buffkit packages under to their
+	// deprecated identifiers
+	byName := make(map[string]map[string]Deprecation)
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || apiDeprecations[importPath] == nil {
+			continue
+		}
+		name := path.Base(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		byName[name] = apiDeprecations[importPath]
+	}
+	if len(byName) == 0 {
+		return nil
+	}
+
+	var uses []DeprecatedUse
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if d, ok := byName[pkg.Name][sel.Sel.Name]; ok {
+			uses = append(uses, DeprecatedUse{Deprecation: d, Pos: fset.Position(sel.Pos()).String()})
+		}
+		return true
+	})
+	return uses
+}
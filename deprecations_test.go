@@ -0,0 +1,63 @@
+package buffkit
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigDeprecations(t *testing.T) {
+	assert.Empty(t, ConfigDeprecations(Config{Dialect: "sqlite"}))
+
+	found := ConfigDeprecations(Config{Dialect: "sqlite3"})
+	require.Len(t, found, 1)
+	assert.Equal(t, `Config.Dialect "sqlite3"`, found[0].Name)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer log.SetFlags(log.Flags())
+	log.SetFlags(0)
+	logDeprecations(Config{Dialect: "sqlite3"})
+	assert.Equal(t, `Buffkit: deprecated name="Config.Dialect \"sqlite3\"" since=0.1.0-alpha hint="set Dialect to \"sqlite\"; \"sqlite3\" is the driver's name, not the dialect's"`+"\n", buf.String())
+}
+
+func TestUpgradeCheck(t *testing.T) {
+	uses, err := UpgradeCheck(fstest.MapFS{
+		"main.go": {Data: []byte(`package main
+
+import (
+	"github.com/johnjansen/buffkit"
+	bkm "github.com/johnjansen/buffkit/migrations"
+)
+
+func main() {
+	fs := bkm.GetBuffkitMigrations()
+	_ = buffkit.NewMigrationRunner(nil, fs, "sqlite")
+	_ = buffkit.Migrations()
+}
+`)},
+		// Same names from other packages don't count
+		"other/other.go": {Data: []byte(`package other
+
+import "example.com/migrations"
+
+var _ = migrations.MigrationList()
+`)},
+		"vendor/github.com/x/x.go":   {Data: []byte("package x\n\nimport \"github.com/johnjansen/buffkit\"\n\nvar _ = buffkit.MigrationRunner{}\n")},
+		"broken.go":                  {Data: []byte("package main\n\nfunc {")},
+		"templates/index.plush.html": {Data: []byte("buffkit.NewMigrationRunner")},
+	})
+	require.NoError(t, err)
+	require.Len(t, uses, 2)
+	assert.Equal(t, "main.go:9:8", uses[0].Pos)
+	assert.Equal(t, "migrations.GetBuffkitMigrations", uses[0].Name)
+	assert.Equal(t, "main.go:10:6", uses[1].Pos)
+	assert.Equal(t, "use migrations.NewRunner", uses[1].Hint)
+	assert.Equal(t, "buffkit.NewMigrationRunner is deprecated since Buffkit 0.1.0-alpha: use migrations.NewRunner", uses[1].Deprecation.String())
+}
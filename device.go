@@ -0,0 +1,59 @@
+package buffkit
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/useragent"
+)
+
+// DeviceInfo reads the browser, operating system and class of device
+// from the request's User-Agent, for adapting a page to it:
+//
+//	if buffkit.DeviceInfo(c).Mobile() {
+//		return c.Render(200, r.HTML("posts/index.mobile.plush.html"))
+//	}
+//
+// Templates can call device() for the same thing. It's a best guess from
+// a header the client controls, so use it for presentation, not access.
+func DeviceInfo(c buffalo.Context) useragent.Info {
+	return useragent.Parse(c.Request().UserAgent())
+}
+
+// newDeviceAlert emails users when they log in from a new device, as
+// Config.NewDeviceAlerts asks. sessionsURL, when known, links to the
+// page where they can log the device out.
+func newDeviceAlert(sender mail.Sender, sessionsURL string) func(ctx context.Context, user *auth.User, s *auth.Session) {
+	return func(ctx context.Context, user *auth.User, s *auth.Session) {
+		details := s.Description() + "\nIP address: " + s.IP + "\nTime: " + s.CreatedAt.UTC().Format("2 Jan 2006 15:04 MST")
+		text := "Your account was just logged into from a new device:\n\n" + details + "\n\n" +
+			"If this was you, there's nothing to do. If it wasn't, change your password"
+		htmlBody := `<p>Your account was just logged into from a new device:</p><p>` +
+			strings.ReplaceAll(html.EscapeString(details), "\n", "<br>") + `</p>` +
+			`<p>If this was you, there's nothing to do. If it wasn't, change your password`
+		if sessionsURL != "" {
+			text += " and log the device out:\n\n" + sessionsURL + "\n"
+			htmlBody += ` and <a href="` + html.EscapeString(sessionsURL) + `">log the device out</a>.</p>`
+		} else {
+			text += ".\n"
+			htmlBody += `.</p>`
+		}
+
+		err := sender.Send(ctx, mail.Message{
+			To:      user.Email,
+			Subject: "New login from " + s.Device(),
+			Text:    text,
+			HTML:    htmlBody,
+		})
+		if err != nil {
+			// The login already succeeded; a missing alert shouldn't undo it
+			if c, ok := ctx.(buffalo.Context); ok {
+				c.Logger().WithField("error", err).Error("buffkit: send new device alert")
+			}
+		}
+	}
+}
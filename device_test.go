@@ -0,0 +1,61 @@
+package buffkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDeviceAlert(t *testing.T) {
+	sender := mail.NewDevSender()
+	alert := newDeviceAlert(sender, "https://app.example.com/account/sessions")
+	alert(context.Background(), &auth.User{ID: "u1", Email: "ada@example.com"}, &auth.Session{
+		IP:        "81.2.69.142",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:127.0) Gecko/20100101 Firefox/127.0",
+		CreatedAt: time.Date(2024, 6, 1, 9, 30, 0, 0, time.UTC),
+	})
+
+	msg, ok := sender.LastTo("ada@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "New login from Firefox on Windows", msg.Subject)
+	assert.Contains(t, msg.Text, "IP address: 81.2.69.142")
+	assert.Contains(t, msg.Text, "1 Jun 2024 09:30 UTC")
+	assert.Contains(t, msg.Text, "https://app.example.com/account/sessions")
+	assert.Contains(t, msg.HTML, `<a href="https://app.example.com/account/sessions">log the device out</a>`)
+}
+
+func TestWireNewDeviceAlerts(t *testing.T) {
+	t.Cleanup(func() { auth.OnNewDevice(nil) })
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret"), NewDeviceAlerts: true, Account: true, BaseURL: "https://app.example.com"})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	digest, err := auth.HashPassword("secret123")
+	require.NoError(t, err)
+	require.NoError(t, kit.AuthStore.Create(context.Background(), &auth.User{Email: "ada@example.com", PasswordDigest: digest}))
+
+	login := func(ua string) {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("email=ada%40example.com&password=secret123"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", ua)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusSeeOther, rec.Code, rec.Body.String())
+	}
+	login("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36")
+	login("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:127.0) Gecko/20100101 Firefox/127.0")
+
+	sent := kit.Mail.(*mail.DevSender).Find("New login")
+	require.Len(t, sent, 1)
+	assert.Equal(t, "New login from Firefox on Windows", sent[0].Subject)
+	assert.Contains(t, sent[0].Text, "https://app.example.com/account/sessions")
+}
@@ -0,0 +1,236 @@
+// Package digest sends periodic summary emails, such as a weekly activity
+// digest. Apps register a Digest with a builder that gathers what
+// happened for one user; the jobs scheduler then fans each run out into
+// one job per user, which builds the data, renders the digest's mail
+// template, and sends it.
+//
+//	mail.RegisterTemplate("digest/weekly", mail.Template{
+//	    Subject: "Your week: {{len .Data.Comments}} new comments",
+//	    Text:    "Hi {{.User.Name}}, ...",
+//	})
+//	err := kit.Digests.Register(digest.Digest{
+//	    Name:     "weekly",
+//	    Every:    7 * 24 * time.Hour,
+//	    Template: "digest/weekly",
+//	    Build: func(ctx context.Context, user *auth.User, since time.Time) (any, error) {
+//	        comments, err := commentsFor(ctx, user.ID, since)
+//	        if len(comments) == 0 {
+//	            return nil, err // nothing to say, so no email
+//	        }
+//	        return map[string]any{"Comments": comments}, err
+//	    },
+//	})
+//
+// Users who turned a digest off in Preferences don't get it, and
+// deactivated users get nothing.
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/jobs"
+	"github.com/johnjansen/buffkit/mail"
+)
+
+// BuildFunc gathers the digest data for user covering the time since
+// since. Returning nil data skips the user for this run.
+type BuildFunc func(ctx context.Context, user *auth.User, since time.Time) (any, error)
+
+// Digest is a periodic email.
+type Digest struct {
+	// Name identifies the digest in preferences and task types
+	// ("digest:<name>"), e.g. "weekly".
+	Name string
+
+	// Every is how often the digest goes out. Each run covers the
+	// period since the previous one.
+	Every time.Duration
+
+	// Template is the mail template to render. It gets a TemplateData.
+	Template string
+
+	Build BuildFunc
+}
+
+// TemplateData is what a digest's mail template receives.
+type TemplateData struct {
+	User  *auth.User
+	Since time.Time
+	Data  any // from Build
+}
+
+// pageSize is how many users a run loads at a time.
+const pageSize = 100
+
+// Digests runs registered digests on the jobs runtime.
+type Digests struct {
+	Runtime *jobs.Runtime
+	Users   auth.ProvisioningStore
+	Sender  mail.Sender
+
+	// Preferences says who wants which digest. Nil sends every digest
+	// to every active user.
+	Preferences Preferences
+
+	// Clock decides the period each run covers. Defaults to clock.Real.
+	Clock clock.Clock
+
+	digests map[string]Digest
+}
+
+// New creates a Digests sending to users in users.
+func New(runtime *jobs.Runtime, users auth.ProvisioningStore, sender mail.Sender) *Digests {
+	return &Digests{
+		Runtime: runtime,
+		Users:   users,
+		Sender:  sender,
+		digests: make(map[string]Digest),
+	}
+}
+
+// userPayload is the payload of a per-user digest job.
+type userPayload struct {
+	UserID string    `json:"user_id"`
+	Since  time.Time `json:"since"`
+}
+
+// Register adds d, handling its jobs and scheduling it every d.Every
+// while the worker runs.
+func (ds *Digests) Register(d Digest) error {
+	switch {
+	case d.Name == "":
+		return errors.New("digest: Name is required")
+	case d.Every <= 0:
+		return fmt.Errorf("digest: %s: Every must be positive", d.Name)
+	case d.Template == "":
+		return fmt.Errorf("digest: %s: Template is required", d.Name)
+	case d.Build == nil:
+		return fmt.Errorf("digest: %s: Build is required", d.Name)
+	}
+	if _, exists := ds.digests[d.Name]; exists {
+		return fmt.Errorf("digest: %s is already registered", d.Name)
+	}
+	ds.digests[d.Name] = d
+
+	ds.Runtime.HandleFunc(runTask(d.Name), func(ctx context.Context, t *asynq.Task) error {
+		return ds.Run(ctx, d.Name)
+	})
+	ds.Runtime.HandleFunc(sendTask(d.Name), func(ctx context.Context, t *asynq.Task) error {
+		var p userPayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return fmt.Errorf("digest: %s: bad payload: %w", d.Name, err)
+		}
+		return ds.Send(ctx, d.Name, p.UserID, p.Since)
+	})
+	return ds.Runtime.Every(d.Every, runTask(d.Name), map[string]string{}, asynq.Queue("low"))
+}
+
+func runTask(name string) string  { return "digest:" + name }
+func sendTask(name string) string { return "digest:" + name + ":send" }
+
+// Names lists the registered digests, sorted.
+func (ds *Digests) Names() []string {
+	names := make([]string, 0, len(ds.digests))
+	for name := range ds.digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run enqueues one send job per active user who wants digest name,
+// covering the period since the previous run. The scheduler calls it;
+// call it yourself to send a digest now.
+func (ds *Digests) Run(ctx context.Context, name string) error {
+	d, ok := ds.digests[name]
+	if !ok {
+		return fmt.Errorf("digest: no digest named %s", name)
+	}
+	since := clock.Or(ds.Clock).Now().Add(-d.Every)
+
+	queued := 0
+	for offset := 0; ; offset += pageSize {
+		users, total, err := ds.Users.ListUsers(ctx, offset, pageSize)
+		if err != nil {
+			return fmt.Errorf("digest: %s: list users: %w", name, err)
+		}
+		for _, user := range users {
+			if ok, err := ds.wants(ctx, user, name); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+			payload := userPayload{UserID: user.ID, Since: since}
+			if err := ds.Runtime.Enqueue(sendTask(name), payload, asynq.Queue("low")); err != nil {
+				return fmt.Errorf("digest: %s: %w", name, err)
+			}
+			queued++
+		}
+		if offset+len(users) >= total || len(users) == 0 {
+			break
+		}
+	}
+	log.Printf("Digest: Queued %s for %d user(s)", name, queued)
+	return nil
+}
+
+// Send builds and sends digest name to one user, unless they've turned
+// it off or Build has nothing for them.
+func (ds *Digests) Send(ctx context.Context, name, userID string, since time.Time) error {
+	d, ok := ds.digests[name]
+	if !ok {
+		return fmt.Errorf("digest: no digest named %s", name)
+	}
+	user, err := ds.Users.ByID(ctx, userID)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		return nil // removed since the run was queued
+	}
+	if err != nil {
+		return fmt.Errorf("digest: %s: %w", name, err)
+	}
+	// Preferences may have changed since the run was queued
+	if ok, err := ds.wants(ctx, user, name); err != nil || !ok {
+		return err
+	}
+
+	data, err := d.Build(ctx, user, since)
+	if err != nil {
+		return fmt.Errorf("digest: %s: build for %s: %w", name, userID, err)
+	}
+	if data == nil {
+		return nil
+	}
+
+	msg, err := mail.Render(d.Template, user.Email, TemplateData{User: user, Since: since, Data: data})
+	if err != nil {
+		return fmt.Errorf("digest: %s: %w", name, err)
+	}
+	if err := ds.Sender.Send(ctx, msg); err != nil {
+		return fmt.Errorf("digest: %s: send to %s: %w", name, user.Email, err)
+	}
+	return nil
+}
+
+// wants reports whether user should get digest name.
+func (ds *Digests) wants(ctx context.Context, user *auth.User, name string) (bool, error) {
+	if user.DeactivatedAt != nil {
+		return false, nil
+	}
+	if ds.Preferences == nil {
+		return true, nil
+	}
+	ok, err := ds.Preferences.WantsDigest(ctx, user.ID, name)
+	if err != nil {
+		return false, fmt.Errorf("digest: %s: preferences for %s: %w", name, user.ID, err)
+	}
+	return ok, nil
+}
@@ -0,0 +1,179 @@
+package digest_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/digest"
+	"github.com/johnjansen/buffkit/jobs"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/readonly"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	_ = mail.RegisterTemplate("digest/test", mail.Template{
+		Subject: "{{len .Data}} updates since {{.Since.Format \"Jan 2\"}}",
+		Text:    "Hi {{.User.Name}}\n{{range .Data}}- {{.}}\n{{end}}",
+		HTML:    "<p>Hi {{.User.Name}}</p>",
+	})
+}
+
+type fixture struct {
+	digests *digest.Digests
+	sender  *mail.DevSender
+	queue   *asynq.Inspector
+	clock   *clock.Fake
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	redis := miniredis.RunT(t)
+	runtime, err := jobs.NewRuntime("redis://" + redis.Addr())
+	require.NoError(t, err)
+	t.Cleanup(runtime.Shutdown)
+
+	queue := asynq.NewInspector(asynq.RedisClientOpt{Addr: redis.Addr()})
+	t.Cleanup(func() { _ = queue.Close() })
+
+	store := auth.NewMemoryStore()
+	ctx := context.Background()
+	deactivated := time.Now()
+	for _, u := range []*auth.User{
+		{Email: "ada@example.com", DisplayName: "Ada"},
+		{Email: "grace@example.com", DisplayName: "Grace"},
+		{Email: "gone@example.com", DeactivatedAt: &deactivated},
+	} {
+		require.NoError(t, store.Create(ctx, u))
+	}
+
+	f := &fixture{sender: mail.NewDevSender(), queue: queue, clock: clock.NewFake(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))}
+	f.digests = digest.New(runtime, store, f.sender)
+	f.digests.Preferences = digest.NewMemoryPreferences()
+	f.digests.Clock = f.clock
+	return f
+}
+
+func weekly(build digest.BuildFunc) digest.Digest {
+	return digest.Digest{Name: "weekly", Every: 7 * 24 * time.Hour, Template: "digest/test", Build: build}
+}
+
+func TestRegister(t *testing.T) {
+	f := newFixture(t)
+	noop := func(context.Context, *auth.User, time.Time) (any, error) { return nil, nil }
+
+	require.NoError(t, f.digests.Register(weekly(noop)))
+	assert.Error(t, f.digests.Register(weekly(noop)), "duplicate name")
+	assert.Error(t, f.digests.Register(digest.Digest{Name: "daily", Template: "digest/test", Build: noop}), "no interval")
+
+	assert.Equal(t, []string{"weekly"}, f.digests.Names())
+	assert.Contains(t, f.digests.Runtime.Handlers(), "digest:weekly")
+	assert.Contains(t, f.digests.Runtime.Handlers(), "digest:weekly:send")
+	schedules := f.digests.Runtime.Schedules()
+	require.Len(t, schedules, 1)
+	assert.Equal(t, "digest:weekly", schedules[0].TaskType)
+}
+
+func TestRunQueuesUsersWhoWantIt(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	require.NoError(t, f.digests.Register(weekly(func(context.Context, *auth.User, time.Time) (any, error) { return nil, nil })))
+	require.NoError(t, f.digests.Preferences.SetDigest(ctx, "grace@example.com", "weekly", false))
+
+	require.NoError(t, f.digests.Run(ctx, "weekly"))
+
+	tasks, err := f.queue.ListPendingTasks("low")
+	require.NoError(t, err)
+	require.Len(t, tasks, 1, "only Ada: Grace opted out and the third user is deactivated")
+	assert.Equal(t, "digest:weekly:send", tasks[0].Type)
+	assert.Contains(t, string(tasks[0].Payload), `"user_id":"ada@example.com"`)
+	assert.Contains(t, string(tasks[0].Payload), `"since":"2026-10-09T09:00:00Z"`)
+}
+
+func TestSend(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	since := f.clock.Now().Add(-7 * 24 * time.Hour)
+	require.NoError(t, f.digests.Register(weekly(func(ctx context.Context, user *auth.User, from time.Time) (any, error) {
+		assert.Equal(t, since, from)
+		if user.DisplayName == "Grace" {
+			return nil, nil
+		}
+		return []string{"2 new comments", "1 mention"}, nil
+	})))
+
+	require.NoError(t, f.digests.Send(ctx, "weekly", "ada@example.com", since))
+	msg, ok := f.sender.LastTo("ada@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "2 updates since Oct 9", msg.Subject)
+	assert.Equal(t, "Hi Ada\n- 2 new comments\n- 1 mention\n", msg.Text)
+	assert.Equal(t, "<p>Hi Ada</p>", msg.HTML)
+
+	// Nothing to report, opted out, or gone: no mail
+	require.NoError(t, f.digests.Send(ctx, "weekly", "grace@example.com", since))
+	require.NoError(t, f.digests.Preferences.SetDigest(ctx, "ada@example.com", "weekly", false))
+	require.NoError(t, f.digests.Send(ctx, "weekly", "ada@example.com", since))
+	require.NoError(t, f.digests.Send(ctx, "weekly", "nobody@example.com", since))
+	f.sender.AssertSentCount(t, 1)
+
+	assert.Error(t, f.digests.Send(ctx, "monthly", "ada@example.com", since))
+}
+
+func TestSQLPreferences(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	schema, err := os.ReadFile("../db/migrations/digest/20261016130000_create_notification_preferences.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	prefs := digest.NewSQLPreferences(db, "sqlite")
+
+	want, err := prefs.WantsDigest(ctx, "u1", "weekly")
+	require.NoError(t, err)
+	assert.True(t, want, "digests are on by default")
+
+	require.NoError(t, prefs.SetDigest(ctx, "u1", "weekly", false))
+	want, err = prefs.WantsDigest(ctx, "u1", "weekly")
+	require.NoError(t, err)
+	assert.False(t, want)
+
+	require.NoError(t, prefs.SetDigest(ctx, "u1", "weekly", true))
+	want, err = prefs.WantsDigest(ctx, "u1", "weekly")
+	require.NoError(t, err)
+	assert.True(t, want)
+}
+
+func TestPreferencesReadOnlyMode(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	schema, err := os.ReadFile("../db/migrations/digest/20261016130000_create_notification_preferences.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, readonly.Default.Enable(ctx, ""))
+	t.Cleanup(readonly.Default.Reset)
+
+	for name, prefs := range map[string]digest.Preferences{"memory": digest.NewMemoryPreferences(), "sql": digest.NewSQLPreferences(db, "sqlite")} {
+		assert.ErrorIs(t, prefs.SetDigest(ctx, "u1", "weekly", false), readonly.ErrReadOnly, name)
+		want, err := prefs.WantsDigest(ctx, "u1", "weekly")
+		require.NoError(t, err, name)
+		assert.True(t, want, name)
+	}
+}
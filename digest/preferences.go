@@ -0,0 +1,110 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// Preferences records which digests users want. Digests are on until a
+// user turns them off.
+type Preferences interface {
+	WantsDigest(ctx context.Context, userID, name string) (bool, error)
+	SetDigest(ctx context.Context, userID, name string, want bool) error
+}
+
+// MemoryPreferences keeps preferences in memory, for tests and
+// development.
+type MemoryPreferences struct {
+	mu  sync.RWMutex
+	off map[string]bool // userID + "\x00" + name
+}
+
+// NewMemoryPreferences creates an empty MemoryPreferences.
+func NewMemoryPreferences() *MemoryPreferences {
+	return &MemoryPreferences{off: make(map[string]bool)}
+}
+
+func (p *MemoryPreferences) WantsDigest(ctx context.Context, userID, name string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return !p.off[userID+"\x00"+name], nil
+}
+
+func (p *MemoryPreferences) SetDigest(ctx context.Context, userID, name string, want bool) error {
+	if err := readonly.Check("digest.SetDigest"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if want {
+		delete(p.off, userID+"\x00"+name)
+	} else {
+		p.off[userID+"\x00"+name] = true
+	}
+	return nil
+}
+
+// SQLPreferences keeps preferences in the notification_preferences table
+// created by the db/migrations/digest migration.
+type SQLPreferences struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLPreferences creates preferences backed by database/sql.
+func NewSQLPreferences(db *sql.DB, dialect string) *SQLPreferences {
+	return &SQLPreferences{db: db, dialect: dialect}
+}
+
+func (p *SQLPreferences) WantsDigest(ctx context.Context, userID, name string) (bool, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var enabled bool
+	err := p.db.QueryRowContext(ctx,
+		sqlutil.Rebind(p.dialect, "SELECT enabled FROM notification_preferences WHERE user_id = ? AND name = ?"), userID, name).
+		Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("digest: load preference: %w", err)
+	}
+	return enabled, nil
+}
+
+func (p *SQLPreferences) SetDigest(ctx context.Context, userID, name string, want bool) error {
+	if err := readonly.Check("digest.SetDigest"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("digest: save preference: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Delete and insert rather than upsert, whose syntax differs by dialect
+	if _, err := tx.ExecContext(ctx,
+		sqlutil.Rebind(p.dialect, "DELETE FROM notification_preferences WHERE user_id = ? AND name = ?"), userID, name); err != nil {
+		return fmt.Errorf("digest: save preference: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		sqlutil.Rebind(p.dialect, "INSERT INTO notification_preferences (user_id, name, enabled) VALUES (?, ?, ?)"), userID, name, want); err != nil {
+		return fmt.Errorf("digest: save preference: %w", err)
+	}
+	return tx.Commit()
+}
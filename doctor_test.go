@@ -0,0 +1,116 @@
+package buffkit
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/johnjansen/buffkit/jobs"
+	"github.com/johnjansen/buffkit/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// doctorResults indexes checks by name.
+func doctorResults(checks []DoctorCheck) map[string]DoctorCheck {
+	byName := make(map[string]DoctorCheck)
+	for _, check := range checks {
+		byName[check.Name] = check
+	}
+	return byName
+}
+
+func TestDoctor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	redisServer := miniredis.RunT(t)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	require.NoError(t, closed.Close())
+
+	cfg := Config{
+		DB:         db,
+		Dialect:    "postgres",
+		RedisURL:   "redis://" + redisServer.Addr(),
+		SMTPAddr:   closedAddr,
+		AuthSecret: []byte("change-me"),
+	}
+	checks := doctorResults(Doctor(ctx, cfg, nil))
+	assert.Equal(t, DoctorFailed, checks["Database"].Status)
+	assert.Equal(t, `Set Config.Dialect to "sqlite"`, checks["Database"].Fix)
+	assert.Equal(t, DoctorFailed, checks["Migrations"].Status)
+	assert.Equal(t, "Run buffalo task buffkit:migrate", checks["Migrations"].Fix, checks["Migrations"].Detail)
+	assert.Equal(t, DoctorOK, checks["Redis"].Status)
+	assert.Equal(t, DoctorFailed, checks["SMTP"].Status)
+	assert.Equal(t, DoctorFailed, checks["AuthSecret"].Status)
+	assert.Contains(t, checks["AuthSecret"].Detail, "placeholder")
+	assert.NotContains(t, checks, "Templates")
+
+	// Fixed up
+	require.NoError(t, migrations.NewRunner(db, migrationFS, "sqlite").Migrate(ctx))
+	cfg.Dialect, cfg.RedisURL, cfg.SMTPAddr = "sqlite3", jobs.MemoryRedisURL, ""
+	cfg.AuthSecret = []byte("0123456789abcdef0123456789abcdef")
+	cfg.DevMode = true
+	checks = doctorResults(Doctor(ctx, cfg, nil))
+	for _, name := range []string{"Database", "Migrations", "Redis", "AuthSecret"} {
+		assert.Equal(t, DoctorOK, checks[name].Status, "%s: %s", name, checks[name].Detail)
+	}
+	assert.Equal(t, DoctorSkipped, checks["SMTP"].Status)
+
+	// Nothing configured
+	redisAddr := redisServer.Addr()
+	redisServer.Close()
+	checks = doctorResults(Doctor(ctx, Config{RedisURL: "redis://" + redisAddr}, nil))
+	assert.Equal(t, DoctorSkipped, checks["Database"].Status)
+	assert.NotContains(t, checks, "Migrations")
+	assert.Equal(t, DoctorFailed, checks["Redis"].Status)
+	assert.Equal(t, DoctorWarning, checks["SMTP"].Status, "production without SMTP")
+	assert.Equal(t, DoctorFailed, checks["AuthSecret"].Status)
+}
+
+func TestWeakSecret(t *testing.T) {
+	assert.Contains(t, weakSecret([]byte("short")), "is 5 bytes")
+	assert.Contains(t, weakSecret([]byte("my-super-secret-session-key-that-is-long")), "placeholder")
+	assert.Contains(t, weakSecret([]byte(strings.Repeat("ab", 20))), "too few")
+	assert.Empty(t, weakSecret([]byte("8f2c1d9e4b7a6035f1e2d3c4b5a69788")))
+
+	checks := doctorResults(Doctor(context.Background(), Config{
+		DevMode:     true,
+		AuthSecrets: [][]byte{[]byte("8f2c1d9e4b7a6035f1e2d3c4b5a69788"), []byte("old")},
+	}, nil))
+	assert.Equal(t, DoctorWarning, checks["AuthSecret"].Status, "weak secrets only warn in development")
+	assert.Equal(t, "AuthSecrets[1] is 3 bytes; use at least 32", checks["AuthSecret"].Detail)
+}
+
+func TestDoctorShadowing(t *testing.T) {
+	check := doctorShadowing(fstest.MapFS{
+		"templates/buffkit/auth/login.html":         {Data: []byte("login")},
+		"templates/buffkit/errors/error.plush.html": {Data: []byte("error")},
+		"public/assets/css/bk-code.css":             {Data: []byte(".bk-chroma {}")},
+		"public/assets/css/app.css":                 {Data: []byte("body {}")},
+	})
+	assert.Equal(t, DoctorOK, check.Status)
+	assert.Equal(t, "2 page template(s) in templates/buffkit; the app's own /assets/css/bk-code.css replace Buffkit's (recheck them after upgrading)", check.Detail)
+
+	check = doctorShadowing(fstest.MapFS{
+		"templates/buffkit/auth/login.html":       {Data: []byte("login")},
+		"templates/buffkit/auth/login.plush.html": {Data: []byte("login")},
+		"templates/buffkit/auth/signin.html":      {Data: []byte("login")},
+	})
+	assert.Equal(t, DoctorWarning, check.Status)
+	assert.Contains(t, check.Detail, "never rendered: templates/buffkit/auth/signin.html")
+	assert.Contains(t, check.Detail, "templates/buffkit/auth/login.html and templates/buffkit/auth/login.plush.html")
+	assert.Contains(t, check.Fix, "auth/login")
+}
@@ -160,19 +160,26 @@ func BroadcastHandler(kit *buffkit.Kit) buffalo.Handler {
 }
 
 func DashboardHandler(c buffalo.Context) error {
-	user := c.Value("current_user")
 	return c.Render(http.StatusOK, r{}.HTML("dashboard.plush.html", map[string]interface{}{
-		"user": user,
+		"user": currentEmail(c),
 	}))
 }
 
 func ProfileHandler(c buffalo.Context) error {
-	user := c.Value("current_user")
 	return c.Render(http.StatusOK, r{}.HTML("profile.plush.html", map[string]interface{}{
-		"user": user,
+		"user": currentEmail(c),
 	}))
 }
 
+// currentEmail is the signed-in user's email, which RequireLogin puts
+// in the context.
+func currentEmail(c buffalo.Context) string {
+	if user, ok := buffkit.Get(c, buffkit.CurrentUserKey); ok && user != nil {
+		return user.Email
+	}
+	return ""
+}
+
 func StatusHandler(kit *buffkit.Kit) buffalo.Handler {
 	return func(c buffalo.Context) error {
 		status := map[string]interface{}{
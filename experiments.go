@@ -0,0 +1,27 @@
+package buffkit
+
+import (
+	"github.com/gobuffalo/buffalo"
+)
+
+// Variant returns the request's variant of the named experiment, from
+// kit.Experiments, reporting the exposure the first time the request
+// asks:
+//
+//	if buffkit.Variant(c, "checkout-copy") == "urgent" {
+//		c.Set("deadline", offerEnds)
+//	}
+//
+// It returns "" when the experiment isn't defined or Wire hasn't run, so
+// an experiment that's been removed falls back to the page's default.
+// Templates can call variant("checkout-copy") for the same thing.
+func Variant(c buffalo.Context, name string) string {
+	if globalKit == nil || globalKit.Experiments == nil {
+		return ""
+	}
+	variant, err := globalKit.Experiments.Variant(c, name)
+	if err != nil {
+		return ""
+	}
+	return variant
+}
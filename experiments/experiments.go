@@ -0,0 +1,275 @@
+// Package experiments runs A/B tests: each visitor is placed in one
+// variant of an experiment, the page they get is rendered for it on the
+// server, and exposures and conversions are reported so the variants can
+// be compared:
+//
+//	kit.Experiments.Define(experiments.Experiment{Name: "checkout-copy", Variants: []string{"control", "urgent"}})
+//
+//	// in a handler or template
+//	if buffkit.Variant(c, "checkout-copy") == "urgent" { ... }
+//	<%= partial(variantPartial("checkout-copy", "checkout/copy.html")) %>
+//
+//	// once the visitor buys
+//	kit.Experiments.Convert(c, "purchase")
+//
+// Logged-in users are placed by their ID, so they see the same variant
+// on every device; everyone else by the visitor cookie rollouts use.
+// Placement is a hash, not a stored choice, so it needs no table and
+// stays put as long as the experiment's variants and weights do.
+//
+// Each exposure (the first time a request asks for an experiment's
+// variant) and conversion is logged and passed to OnExposure and
+// OnConversion, for sending to an analytics store.
+package experiments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/rollout"
+)
+
+// ErrUndefined is returned for experiments that haven't been defined.
+var ErrUndefined = auth.NotFoundError("experiments: experiment not defined")
+
+// exposedKey is the request context key of the experiments already
+// reported as exposed in the request.
+const exposedKey = "experiments_exposed"
+
+// Experiment is an A/B test and its variants.
+type Experiment struct {
+	// Name identifies the experiment, e.g. "checkout-copy".
+	Name string
+
+	// Variants are the versions visitors are placed in. The first is
+	// conventionally the control.
+	Variants []string
+
+	// Weights, when set, gives each variant's share of visitors, in the
+	// order of Variants; {90, 10} puts one in ten in the second. Equal
+	// shares when empty.
+	Weights []int
+
+	// Winner, once chosen, is the variant everyone gets. Exposures are no
+	// longer reported.
+	Winner string
+}
+
+// Exposure is a visitor being shown an experiment's variant.
+type Exposure struct {
+	Experiment string
+	Variant    string
+	Subject    string // "user:<id>" or "visitor:<id>"
+	At         time.Time
+}
+
+// Conversion is a visitor in an experiment reaching a goal.
+type Conversion struct {
+	Experiment string
+	Variant    string
+	Subject    string
+	Goal       string // e.g. "purchase"
+	At         time.Time
+}
+
+// Experiments holds the defined experiments.
+type Experiments struct {
+	// OnExposure, when set, is called with each exposure.
+	OnExposure func(ctx context.Context, e Exposure)
+
+	// OnConversion, when set, is called with each conversion.
+	OnConversion func(ctx context.Context, cv Conversion)
+
+	Clock clock.Clock
+
+	mu      sync.RWMutex
+	defined map[string]Experiment
+}
+
+// New creates an empty Experiments.
+func New() *Experiments {
+	return &Experiments{defined: make(map[string]Experiment)}
+}
+
+// Define adds an experiment, or replaces one of the same name. It needs
+// at least two variants, and as many weights as variants when it has
+// any.
+func (x *Experiments) Define(e Experiment) error {
+	if e.Name == "" {
+		return errors.New("experiments: experiment needs a name")
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("experiments: %s needs at least two variants", e.Name)
+	}
+	seen := make(map[string]bool, len(e.Variants))
+	for _, v := range e.Variants {
+		if v == "" || seen[v] {
+			return fmt.Errorf("experiments: %s: variant names must be unique and not empty", e.Name)
+		}
+		seen[v] = true
+	}
+	if len(e.Weights) > 0 {
+		if len(e.Weights) != len(e.Variants) {
+			return fmt.Errorf("experiments: %s has %d weights for %d variants", e.Name, len(e.Weights), len(e.Variants))
+		}
+		total := 0
+		for _, w := range e.Weights {
+			if w < 0 {
+				return fmt.Errorf("experiments: %s: weights can't be negative", e.Name)
+			}
+			total += w
+		}
+		if total == 0 {
+			return fmt.Errorf("experiments: %s: weights add up to 0", e.Name)
+		}
+	}
+	if e.Winner != "" && !seen[e.Winner] {
+		return fmt.Errorf("experiments: %s: winner %q isn't a variant", e.Name, e.Winner)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.defined[e.Name] = e
+	return nil
+}
+
+// Experiment returns the named experiment.
+func (x *Experiments) Experiment(name string) (Experiment, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	e, ok := x.defined[name]
+	if !ok {
+		return Experiment{}, ErrUndefined
+	}
+	return e, nil
+}
+
+// Variant returns the request's variant of the named experiment,
+// reporting the exposure the first time the request asks.
+func (x *Experiments) Variant(c buffalo.Context, name string) (string, error) {
+	e, err := x.Experiment(name)
+	if err != nil {
+		return "", err
+	}
+	if e.Winner != "" {
+		return e.Winner, nil
+	}
+	subject := Subject(c)
+	variant := e.place(subject)
+
+	exposed, _ := c.Value(exposedKey).(map[string]bool)
+	if !exposed[name] {
+		if exposed == nil {
+			exposed = make(map[string]bool)
+			c.Set(exposedKey, exposed)
+		}
+		exposed[name] = true
+		c.Logger().WithFields(map[string]any{
+			"experiment": name,
+			"variant":    variant,
+			"subject":    subject,
+		}).Debug("experiments: exposure")
+		if x.OnExposure != nil {
+			x.OnExposure(c, Exposure{Experiment: name, Variant: variant, Subject: subject, At: clock.Or(x.Clock).Now()})
+		}
+	}
+	return variant, nil
+}
+
+// Partial inserts the request's variant into a partial's name, before
+// its extension: "checkout/copy.html" becomes "checkout/copy.urgent.html"
+// for the urgent variant, rendering the _copy.urgent.plush.html partial.
+func (x *Experiments) Partial(c buffalo.Context, name, partial string) (string, error) {
+	variant, err := x.Variant(c, name)
+	if err != nil {
+		return "", err
+	}
+	dir, file := path.Split(partial)
+	base, ext, found := strings.Cut(file, ".")
+	if !found {
+		return dir + base + "." + variant, nil
+	}
+	return dir + base + "." + variant + "." + ext, nil
+}
+
+// Convert reports that the request's visitor reached goal in each of the
+// named experiments, or in every running experiment when none are
+// named. Experiments with a winner are skipped. It doesn't count as an
+// exposure.
+func (x *Experiments) Convert(c buffalo.Context, goal string, names ...string) error {
+	var list []Experiment
+	if len(names) == 0 {
+		x.mu.RLock()
+		for _, e := range x.defined {
+			list = append(list, e)
+		}
+		x.mu.RUnlock()
+	}
+	for _, name := range names {
+		e, err := x.Experiment(name)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, name)
+		}
+		list = append(list, e)
+	}
+
+	subject := Subject(c)
+	now := clock.Or(x.Clock).Now()
+	for _, e := range list {
+		if e.Winner != "" {
+			continue
+		}
+		cv := Conversion{Experiment: e.Name, Variant: e.place(subject), Subject: subject, Goal: goal, At: now}
+		c.Logger().WithFields(map[string]any{
+			"experiment": cv.Experiment,
+			"variant":    cv.Variant,
+			"subject":    cv.Subject,
+			"goal":       goal,
+		}).Info("experiments: conversion")
+		if x.OnConversion != nil {
+			x.OnConversion(c, cv)
+		}
+	}
+	return nil
+}
+
+// Subject is who the request's visitor is for placing them: "user:<id>"
+// when logged in, else "visitor:<id>" from the visitor cookie.
+func Subject(c buffalo.Context) string {
+	if user := auth.CurrentUser(c); user != nil {
+		return "user:" + user.ID
+	}
+	return "visitor:" + rollout.Visitor(c)
+}
+
+// place picks subject's variant by hashing it with the experiment's
+// name, so experiments place visitors independently.
+func (e Experiment) place(subject string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.Name + ":" + subject))
+	sum := h.Sum32()
+	if len(e.Weights) == 0 {
+		return e.Variants[sum%uint32(len(e.Variants))]
+	}
+	total := 0
+	for _, w := range e.Weights {
+		total += w
+	}
+	n := int(sum % uint32(total))
+	for i, w := range e.Weights {
+		if n < w {
+			return e.Variants[i]
+		}
+		n -= w
+	}
+	return e.Variants[len(e.Variants)-1]
+}
@@ -0,0 +1,116 @@
+package experiments_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/experiments"
+	"github.com/johnjansen/buffkit/rollout"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newApp(x *experiments.Experiments) *buffalo.App {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/variant", func(c buffalo.Context) error {
+		v, err := x.Variant(c, "checkout-copy")
+		if err != nil {
+			return err
+		}
+		// Asking again in the same request isn't another exposure
+		if _, err := x.Variant(c, "checkout-copy"); err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, render.String(v))
+	})
+	app.GET("/partial", func(c buffalo.Context) error {
+		p, err := x.Partial(c, "checkout-copy", "checkout/copy.html")
+		if err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, render.String(p))
+	})
+	app.POST("/buy", func(c buffalo.Context) error {
+		if err := x.Convert(c, "purchase"); err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, render.String("ok"))
+	})
+	return app
+}
+
+func get(app *buffalo.App, method, path, visitor string) string {
+	req := httptest.NewRequest(method, path, nil)
+	req.AddCookie(&http.Cookie{Name: rollout.VisitorCookie, Value: visitor})
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec.Body.String()
+}
+
+func TestVariantIsSticky(t *testing.T) {
+	x := experiments.New()
+	require.NoError(t, x.Define(experiments.Experiment{Name: "checkout-copy", Variants: []string{"control", "urgent"}}))
+	var exposures []experiments.Exposure
+	x.OnExposure = func(ctx context.Context, e experiments.Exposure) { exposures = append(exposures, e) }
+	app := newApp(x)
+
+	counts := map[string]int{}
+	for i := 0; i < 400; i++ {
+		id := fmt.Sprint("visitor-", i)
+		v := get(app, "GET", "/variant", id)
+		counts[v]++
+		assert.Equal(t, v, get(app, "GET", "/variant", id), "visitors keep their variant")
+	}
+	assert.InDelta(t, 200, counts["control"], 50)
+	assert.InDelta(t, 200, counts["urgent"], 50)
+
+	require.Len(t, exposures, 800, "one exposure per request")
+	assert.Equal(t, "checkout-copy", exposures[0].Experiment)
+	assert.Equal(t, "visitor:visitor-0", exposures[0].Subject)
+}
+
+func TestWeightsAndWinner(t *testing.T) {
+	x := experiments.New()
+	require.NoError(t, x.Define(experiments.Experiment{Name: "checkout-copy", Variants: []string{"control", "urgent"}, Weights: []int{100, 0}}))
+	app := newApp(x)
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, "control", get(app, "GET", "/variant", fmt.Sprint("visitor-", i)))
+	}
+
+	exposed := 0
+	x.OnExposure = func(ctx context.Context, e experiments.Exposure) { exposed++ }
+	require.NoError(t, x.Define(experiments.Experiment{Name: "checkout-copy", Variants: []string{"control", "urgent"}, Winner: "urgent"}))
+	assert.Equal(t, "urgent", get(app, "GET", "/variant", "visitor-1"))
+	assert.Zero(t, exposed, "a finished experiment isn't reported")
+}
+
+func TestPartialAndConvert(t *testing.T) {
+	x := experiments.New()
+	require.NoError(t, x.Define(experiments.Experiment{Name: "checkout-copy", Variants: []string{"control", "urgent"}, Weights: []int{0, 1}}))
+	var conversions []experiments.Conversion
+	x.OnConversion = func(ctx context.Context, cv experiments.Conversion) { conversions = append(conversions, cv) }
+	app := newApp(x)
+
+	assert.Equal(t, "checkout/copy.urgent.html", get(app, "GET", "/partial", "ada"))
+	get(app, "POST", "/buy", "ada")
+	require.Len(t, conversions, 1)
+	assert.Equal(t, experiments.Conversion{
+		Experiment: "checkout-copy", Variant: "urgent", Subject: "visitor:ada", Goal: "purchase", At: conversions[0].At,
+	}, conversions[0])
+}
+
+func TestDefine(t *testing.T) {
+	x := experiments.New()
+	assert.Error(t, x.Define(experiments.Experiment{Name: "one", Variants: []string{"a"}}))
+	assert.Error(t, x.Define(experiments.Experiment{Name: "dup", Variants: []string{"a", "a"}}))
+	assert.Error(t, x.Define(experiments.Experiment{Name: "weights", Variants: []string{"a", "b"}, Weights: []int{1}}))
+	assert.Error(t, x.Define(experiments.Experiment{Name: "winner", Variants: []string{"a", "b"}, Winner: "c"}))
+
+	_, err := x.Experiment("missing")
+	assert.ErrorIs(t, err, experiments.ErrUndefined)
+}
@@ -0,0 +1,34 @@
+package buffkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/experiments"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariant(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/checkout", func(c buffalo.Context) error {
+		c.Set("chosen", Variant(c, "checkout-copy"))
+		c.Set("missing", Variant(c, "missing"))
+		return c.Render(http.StatusOK, render.New(render.Options{}).String(
+			`handler=<%= chosen %> template=<%= variant("checkout-copy") %> partial=<%= variantPartial("checkout-copy", "checkout/copy.html") %> missing=<%= missing %>`))
+	})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	require.NoError(t, kit.Experiments.Define(experiments.Experiment{
+		Name: "checkout-copy", Variants: []string{"control", "urgent"}, Weights: []int{0, 1},
+	}))
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/checkout", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "handler=urgent template=urgent partial=checkout/copy.urgent.html missing=", rec.Body.String())
+}
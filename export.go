@@ -0,0 +1,78 @@
+package buffkit
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/export"
+)
+
+// StreamCSV sends rows as a CSV download named filename, with header as
+// its first line, writing each row as it comes rather than building the
+// file in memory first:
+//
+//	return buffkit.StreamCSV(c, "orders.csv", []string{"ID", "Total"},
+//	    func(yield func([]string, error) bool) {
+//	        rows, err := db.QueryContext(c, "SELECT id, total FROM orders")
+//	        if err != nil {
+//	            yield(nil, err)
+//	            return
+//	        }
+//	        defer rows.Close()
+//	        for rows.Next() {
+//	            var id, total string
+//	            err := rows.Scan(&id, &total)
+//	            if !yield([]string{id, total}, err) || err != nil {
+//	                return
+//	            }
+//	        }
+//	        if err := rows.Err(); err != nil {
+//	            yield(nil, err)
+//	        }
+//	    })
+//
+// The response is flushed every few hundred rows. An error before
+// anything has been sent is returned, for the usual error page; after
+// that the status has been sent, so StreamCSV logs it and ends the
+// response, leaving the download cut short. Exports too slow for a
+// request can run as jobs instead; see Kit.Exports.
+func StreamCSV(c buffalo.Context, filename string, header []string, rows export.Rows) error {
+	w := &csvResponse{ResponseWriter: c.Response(), filename: filename}
+	if err := export.WriteCSV(w, header, rows); err != nil {
+		if !w.started {
+			return err
+		}
+		c.Logger().Errorf("buffkit: stream csv: %v", err)
+	}
+	return nil
+}
+
+// csvResponse sends the download's headers with the first write, so an
+// export that fails at once can still get an error page.
+type csvResponse struct {
+	http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (w *csvResponse) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", export.ContentDisposition(w.filename))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (w *csvResponse) Write(b []byte) (int, error) {
+	w.start()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *csvResponse) Flush() {
+	w.start()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
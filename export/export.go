@@ -0,0 +1,418 @@
+// Package export writes CSV exports of any size. Exports that finish
+// within a request are streamed straight to the client (see
+// buffkit.StreamCSV). Bigger ones run as background jobs: the job writes
+// the file, then emails the user a signed download link or pushes it to
+// their page over SSE.
+//
+//	err := kit.Exports.Register(export.Export{
+//	    Name:   "orders",
+//	    Header: []string{"ID", "Customer", "Total"},
+//	    Rows: func(ctx context.Context, params map[string]string) export.Rows {
+//	        return ordersFor(ctx, params["org_id"])
+//	    },
+//	})
+//
+//	// In a handler
+//	err = kit.Exports.Start(c, "orders", export.Request{
+//	    Params: map[string]string{"org_id": org.ID},
+//	    Email:  user.Email,
+//	})
+//
+// Rows is an iterator, so rows can be written as they're read from the
+// database without holding the whole export in memory.
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"iter"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/blob"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// DefaultExpiry is how long the download links of exports stay valid
+// when Exports.Expiry isn't set.
+const DefaultExpiry = 24 * time.Hour
+
+// ReadyEvent is the SSE event an export's download link is pushed as.
+// Its data is a link to the file.
+const ReadyEvent = "export:ready"
+
+// flushEvery is how many rows WriteCSV writes between flushes.
+const flushEvery = 500
+
+// Rows yields the rows of an export, and stops with an error if loading
+// them fails.
+type Rows = iter.Seq2[[]string, error]
+
+// WriteCSV writes header, unless it's nil, and then rows to w as CSV.
+// Cells are made safe to open in a spreadsheet (see components.CSVCell). If w is an
+// http.Flusher, it's flushed every few hundred rows so the export
+// streams to the client. It returns the first error from rows or w.
+func WriteCSV(w io.Writer, header []string, rows Rows) error {
+	out := csv.NewWriter(w)
+	flush := func() error {
+		out.Flush()
+		if err := out.Error(); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	if header != nil {
+		if err := out.Write(header); err != nil {
+			return err
+		}
+	}
+	var record []string
+	n := 0
+	for row, err := range rows {
+		if err != nil {
+			return err
+		}
+		record = record[:0]
+		for _, value := range row {
+			record = append(record, components.CSVCell(value))
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+		if n++; n%flushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// Export is a CSV export built by a background job.
+type Export struct {
+	// Name identifies the export in task types ("export:<name>") and
+	// names its file ("<name>.csv").
+	Name string
+
+	Header []string
+
+	// Rows loads the export's rows for the params it was started with.
+	// It runs in the worker, outside any request, so params must say
+	// everything it needs, such as whose data to export; check they may
+	// see it before starting the export.
+	Rows func(ctx context.Context, params map[string]string) Rows
+}
+
+// Request says what to export and where to send the link.
+type Request struct {
+	Params map[string]string
+
+	// Email is mailed the download link, if set.
+	Email string
+
+	// Channel gets the link pushed as a ReadyEvent over SSE, if set; see
+	// ssr.Broker.BroadcastChannel. Every client on the channel gets the
+	// link, and with it the file, so only push to a channel that's the
+	// requester's own (see ssr.Broker.SetChannelResolver); a tenant's
+	// channel is shared by all its users.
+	Channel string
+}
+
+// Queue is the jobs runtime exports run on; *jobs.Runtime implements it.
+type Queue interface {
+	HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error)
+	EnqueueIn(delay time.Duration, taskType string, payload interface{}) error
+}
+
+// Publisher pushes events over SSE; *ssr.Broker implements it.
+type Publisher interface {
+	BroadcastChannel(channel, eventName string, html []byte)
+}
+
+// Exports runs registered exports as background jobs and serves their
+// files through signed links.
+type Exports struct {
+	Queue  Queue
+	Signer *secure.URLSigner
+
+	// Sender mails links to Request.Email.
+	Sender mail.Sender
+
+	// Publisher pushes links to Request.Channel.
+	Publisher Publisher
+
+	// Store keeps export files, under exports/. Nil keeps them in Dir.
+	Store blob.Store
+
+	// Dir is where export files are written when there's no Store. The
+	// worker and the web process must both see it. Defaults to
+	// buffkit-exports in the system's temporary directory.
+	Dir string
+
+	// Path is where Handler is mounted, with the file name after it:
+	// app.GET(Path+"/{file}", Handler). Defaults to "/exports".
+	Path string
+
+	// BaseURL is the absolute URL of the app, e.g.
+	// "https://app.example.com", for links in emails. Exports run
+	// outside a request, so there's no host to go on.
+	BaseURL string
+
+	// Expiry is how long download links stay valid; files are removed
+	// once theirs have expired. Defaults to DefaultExpiry.
+	Expiry time.Duration
+
+	// Clock decides when links expire. Defaults to clock.Real.
+	Clock clock.Clock
+
+	exports map[string]Export
+}
+
+// payload is the payload of an export job.
+type payload struct {
+	Params  map[string]string `json:"params,omitempty"`
+	Email   string            `json:"email,omitempty"`
+	Channel string            `json:"channel,omitempty"`
+}
+
+// New creates an Exports running on queue and signing links with signer.
+func New(queue Queue, signer *secure.URLSigner) *Exports {
+	return &Exports{Queue: queue, Signer: signer, exports: make(map[string]Export)}
+}
+
+// Register adds x and handles its jobs.
+func (e *Exports) Register(x Export) error {
+	switch {
+	case x.Name == "":
+		return errors.New("export: Name is required")
+	case x.Rows == nil:
+		return fmt.Errorf("export: %s: Rows is required", x.Name)
+	}
+	if _, exists := e.exports[x.Name]; exists {
+		return fmt.Errorf("export: %s is already registered", x.Name)
+	}
+	e.exports[x.Name] = x
+
+	e.Queue.HandleFunc(task(x.Name), func(ctx context.Context, t *asynq.Task) error {
+		var p payload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return fmt.Errorf("export: %s: bad payload: %w", x.Name, err)
+		}
+		return e.Run(ctx, x.Name, Request(p))
+	})
+	return nil
+}
+
+func task(name string) string { return "export:" + name }
+
+// Start queues the export name for req. req must have an Email or a
+// Channel to send the link to.
+func (e *Exports) Start(ctx context.Context, name string, req Request) error {
+	if _, ok := e.exports[name]; !ok {
+		return fmt.Errorf("export: %s is not registered", name)
+	}
+	if req.Email == "" && req.Channel == "" {
+		return fmt.Errorf("export: %s: the request needs an Email or Channel to send the link to", name)
+	}
+	return e.Queue.EnqueueIn(0, task(name), payload(req))
+}
+
+// Run writes the export name for req to a file and sends its link. The
+// job Start queues calls it; it's exported for running an export without
+// the queue, such as in tests.
+func (e *Exports) Run(ctx context.Context, name string, req Request) error {
+	x, ok := e.exports[name]
+	if !ok {
+		return fmt.Errorf("export: %s is not registered", name)
+	}
+	return e.Deliver(ctx, File{
+		Name:  x.Name + ".csv",
+		Title: x.Name + " export",
+		Write: func(w io.Writer) error {
+			return WriteCSV(w, x.Header, x.Rows(ctx, req.Params))
+		},
+	}, req)
+}
+
+// File is a file for Deliver to write and send a link to.
+type File struct {
+	// Name is what the file downloads as, such as "invoice-42.pdf". Its
+	// extension sets the Content-Type it's served with.
+	Name string
+
+	// Title is how the email names the file, as in "Your orders export
+	// is ready". Defaults to Name.
+	Title string
+
+	// Write writes the file's content.
+	Write func(w io.Writer) error
+}
+
+// Deliver writes f and sends its signed link to req's Email and
+// Channel, as exports are. It lets other background jobs that make
+// files, such as PDF rendering, hand them out the same way.
+func (e *Exports) Deliver(ctx context.Context, f File, req Request) error {
+	e.prune(ctx)
+
+	file, err := e.write(ctx, f)
+	if err != nil {
+		return fmt.Errorf("export: %s: %w", f.Name, err)
+	}
+
+	expires := clock.Or(e.Clock).Now().Add(e.expiry())
+	link, err := e.Signer.Sign(e.path()+"/"+file, expires, map[string]string{"name": f.Name})
+	if err != nil {
+		return fmt.Errorf("export: %s: sign link: %w", f.Name, err)
+	}
+	log.Printf("Export: ready name=%s file=%s", f.Name, file)
+
+	if req.Channel != "" && e.Publisher != nil {
+		e.Publisher.BroadcastChannel(req.Channel, ReadyEvent, []byte(fmt.Sprintf(`<a href="%s" download>Download %s</a>`,
+			html.EscapeString(link), html.EscapeString(f.Name))))
+	}
+	if req.Email != "" {
+		if e.Sender == nil {
+			return fmt.Errorf("export: %s: no mail sender for %s", f.Name, req.Email)
+		}
+		if e.BaseURL == "" {
+			return fmt.Errorf("export: %s: BaseURL is needed to email links", f.Name)
+		}
+		title := f.Title
+		if title == "" {
+			title = f.Name
+		}
+		link = strings.TrimSuffix(e.BaseURL, "/") + link
+		return e.Sender.Send(ctx, mail.Message{
+			To:      req.Email,
+			Subject: fmt.Sprintf("Your %s is ready", title),
+			Text:    fmt.Sprintf("Download %s until %s:\n\n%s\n", f.Name, expires.UTC().Format(time.RFC1123), link),
+			HTML: fmt.Sprintf(`<p><a href="%s">Download %s</a></p><p>The link works until %s.</p>`,
+				html.EscapeString(link), html.EscapeString(f.Name), expires.UTC().Format(time.RFC1123)),
+		})
+	}
+	return nil
+}
+
+// write writes f to a new object in the store and returns its file
+// name. A failed write leaves no object behind.
+func (e *Exports) write(ctx context.Context, f File) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ext := strings.ToLower(filepath.Ext(f.Name))
+	if !fileExt.MatchString(ext) {
+		ext = ""
+	}
+	name := hex.EncodeToString(b) + ext
+
+	store, prefix := e.store()
+	r, w := io.Pipe()
+	go func() { w.CloseWithError(f.Write(w)) }()
+	err := store.Put(ctx, prefix+name, r, "")
+	_ = r.CloseWithError(err)
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// prune removes the files whose links have expired.
+func (e *Exports) prune(ctx context.Context) {
+	store, prefix := e.store()
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return
+	}
+	cutoff := clock.Or(e.Clock).Now().Add(-e.expiry())
+	for _, o := range objects {
+		if !fileName.MatchString(strings.TrimPrefix(o.Key, prefix)) || o.ModTime.After(cutoff) {
+			continue
+		}
+		if err := store.Delete(ctx, o.Key); err != nil {
+			log.Printf("Export: prune file=%s error=%v", o.Key, err)
+		}
+	}
+}
+
+// fileName matches the names of export files, and fileExt the
+// extensions they keep.
+var (
+	fileName = regexp.MustCompile(`^[0-9a-f]{32}(\.[a-z0-9]{1,8})?$`)
+	fileExt  = regexp.MustCompile(`^\.[a-z0-9]{1,8}$`)
+)
+
+// Handler serves an export file to whoever has a valid link to it.
+// Tampered links get 403 and expired ones 410 Gone.
+func (e *Exports) Handler(c buffalo.Context) error {
+	return secure.SignedURLMiddleware(e.Signer)(e.serve)(c)
+}
+
+func (e *Exports) serve(c buffalo.Context) error {
+	file := c.Param("file")
+	if !fileName.MatchString(file) {
+		return c.Error(http.StatusNotFound, fmt.Errorf("export: no file %q", file))
+	}
+	name := "export" + filepath.Ext(file)
+	if claims, ok := c.Value(secure.SignedClaimsKey).(map[string]string); ok && claims["name"] != "" {
+		name = claims["name"]
+	}
+	store, prefix := e.store()
+	return blob.Serve(c.Response(), c.Request(), store, prefix+file, name)
+}
+
+// ContentDisposition returns the Content-Disposition header that
+// downloads a file as filename.
+func ContentDisposition(filename string) string {
+	return blob.ContentDisposition(filename)
+}
+
+// store returns where files are kept and the prefix of their keys.
+func (e *Exports) store() (blob.Store, string) {
+	if e.Store != nil {
+		return e.Store, "exports/"
+	}
+	return blob.NewDirStore(e.dir()), ""
+}
+
+func (e *Exports) dir() string {
+	if e.Dir != "" {
+		return e.Dir
+	}
+	return filepath.Join(os.TempDir(), "buffkit-exports")
+}
+
+func (e *Exports) path() string {
+	if e.Path != "" {
+		return strings.TrimSuffix(e.Path, "/")
+	}
+	return "/exports"
+}
+
+func (e *Exports) expiry() time.Duration {
+	if e.Expiry > 0 {
+		return e.Expiry
+	}
+	return DefaultExpiry
+}
@@ -0,0 +1,253 @@
+package export_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/export"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rows yields n numbered rows, then fails with err if it isn't nil.
+func rows(n int, err error) export.Rows {
+	return func(yield func([]string, error) bool) {
+		for i := 1; i <= n; i++ {
+			if !yield([]string{fmt.Sprint(i), fmt.Sprintf("row %d", i)}, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf strings.Builder
+	formulas := func(yield func([]string, error) bool) {
+		yield([]string{"=SUM(A1:A9)", "-12.5", "@me", "plain"}, nil)
+	}
+	require.NoError(t, export.WriteCSV(&buf, []string{"A", "B", "C", "D"}, formulas))
+	assert.Equal(t, "A,B,C,D\n'=SUM(A1:A9),-12.5,'@me,plain\n", buf.String())
+
+	// Long exports are flushed as they go
+	rec := httptest.NewRecorder()
+	require.NoError(t, export.WriteCSV(rec, nil, rows(1200, nil)))
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, 1200, strings.Count(rec.Body.String(), "\n"))
+
+	failed := errors.New("connection lost")
+	assert.ErrorIs(t, export.WriteCSV(&buf, nil, rows(3, failed)), failed)
+}
+
+// fakeQueue records queued exports instead of running them.
+type fakeQueue struct {
+	handlers map[string]func(context.Context, *asynq.Task) error
+	queued   []*asynq.Task
+}
+
+func (q *fakeQueue) HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error) {
+	if q.handlers == nil {
+		q.handlers = make(map[string]func(context.Context, *asynq.Task) error)
+	}
+	q.handlers[taskType] = handler
+}
+
+func (q *fakeQueue) EnqueueIn(delay time.Duration, taskType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	q.queued = append(q.queued, asynq.NewTask(taskType, data))
+	return nil
+}
+
+// fakePublisher records pushed events.
+type fakePublisher struct {
+	channel, event, html string
+}
+
+func (p *fakePublisher) BroadcastChannel(channel, eventName string, html []byte) {
+	p.channel, p.event, p.html = channel, eventName, string(html)
+}
+
+type fixture struct {
+	exports   *export.Exports
+	queue     *fakeQueue
+	sender    *mail.DevSender
+	publisher *fakePublisher
+	clock     *clock.Fake
+	app       *buffalo.App
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{
+		queue:     &fakeQueue{},
+		sender:    mail.NewDevSender(),
+		publisher: &fakePublisher{},
+		clock:     clock.NewFake(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)),
+	}
+	signer := secure.NewURLSigner([]byte("test-secret"))
+	signer.SetClock(f.clock)
+	f.exports = export.New(f.queue, signer)
+	f.exports.Sender = f.sender
+	f.exports.Publisher = f.publisher
+	f.exports.Dir = t.TempDir()
+	f.exports.BaseURL = "https://app.example.com"
+	f.exports.Clock = f.clock
+
+	f.app = buffalo.New(buffalo.Options{Env: "test"})
+	f.app.GET("/exports/{file}", f.exports.Handler)
+	return f
+}
+
+func (f *fixture) get(path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	f.app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func orders(err error) export.Export {
+	return export.Export{
+		Name:   "orders",
+		Header: []string{"ID", "Name"},
+		Rows: func(ctx context.Context, params map[string]string) export.Rows {
+			if params["org"] != "acme" {
+				return rows(0, errors.New("unknown org"))
+			}
+			return rows(2, err)
+		},
+	}
+}
+
+func TestRegisterAndStart(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	require.NoError(t, f.exports.Register(orders(nil)))
+	assert.Error(t, f.exports.Register(orders(nil)), "duplicate name")
+	assert.Error(t, f.exports.Register(export.Export{Name: "users"}), "no rows")
+	assert.Contains(t, f.queue.handlers, "export:orders")
+
+	assert.Error(t, f.exports.Start(ctx, "users", export.Request{Email: "ada@example.com"}), "not registered")
+	assert.Error(t, f.exports.Start(ctx, "orders", export.Request{}), "nowhere to send the link")
+	assert.Empty(t, f.queue.queued)
+
+	req := export.Request{Params: map[string]string{"org": "acme"}, Email: "ada@example.com", Channel: "user:1"}
+	require.NoError(t, f.exports.Start(ctx, "orders", req))
+	require.Len(t, f.queue.queued, 1)
+	task := f.queue.queued[0]
+	assert.Equal(t, "export:orders", task.Type())
+	require.NoError(t, f.queue.handlers[task.Type()](ctx, task))
+
+	// The link is mailed and pushed
+	msg, ok := f.sender.LastTo("ada@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Your orders export is ready", msg.Subject)
+	links := msg.ExtractLinks()
+	require.NotEmpty(t, links)
+	assert.True(t, strings.HasPrefix(links[0], "https://app.example.com/exports/"), links[0])
+	assert.Equal(t, "user:1", f.publisher.channel)
+	assert.Equal(t, export.ReadyEvent, f.publisher.event)
+	assert.Contains(t, f.publisher.html, `href="/exports/`)
+
+	rec := f.get(strings.TrimPrefix(links[0], "https://app.example.com"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=orders.csv`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "ID,Name\n1,row 1\n2,row 2\n", rec.Body.String())
+}
+
+func TestDownloadLinks(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	require.NoError(t, f.exports.Register(orders(nil)))
+	require.NoError(t, f.exports.Run(ctx, "orders", export.Request{Params: map[string]string{"org": "acme"}, Channel: "user:1"}))
+	assert.Empty(t, f.sender.GetMessages(), "no email asked for")
+
+	link := strings.Split(f.publisher.html, `"`)[1]
+	link = strings.ReplaceAll(link, "&amp;", "&")
+	require.Equal(t, http.StatusOK, f.get(link).Code)
+
+	assert.Equal(t, http.StatusForbidden, f.get(strings.Replace(link, "/exports/", "/exports/0", 1)).Code, "tampered")
+
+	f.clock.Advance(export.DefaultExpiry + time.Minute)
+	assert.Equal(t, http.StatusGone, f.get(link).Code)
+
+	// The next export removes the expired file
+	files, err := os.ReadDir(f.exports.Dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	old := filepath.Join(f.exports.Dir, files[0].Name())
+	require.NoError(t, os.Chtimes(old, f.clock.Now().Add(-export.DefaultExpiry-time.Minute), f.clock.Now().Add(-export.DefaultExpiry-time.Minute)))
+	require.NoError(t, f.exports.Run(ctx, "orders", export.Request{Params: map[string]string{"org": "acme"}, Channel: "user:1"}))
+	assert.NoFileExists(t, old)
+}
+
+func TestRunFailures(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	require.NoError(t, f.exports.Register(orders(errors.New("connection lost"))))
+
+	err := f.exports.Run(ctx, "orders", export.Request{Params: map[string]string{"org": "acme"}, Email: "ada@example.com"})
+	assert.ErrorContains(t, err, "connection lost")
+	files, _ := os.ReadDir(f.exports.Dir)
+	assert.Empty(t, files, "a failed export leaves no file")
+	assert.Empty(t, f.sender.GetMessages())
+
+	// Emailed links must be absolute
+	f.exports.BaseURL = ""
+	require.NoError(t, f.exports.Register(export.Export{Name: "users", Rows: func(context.Context, map[string]string) export.Rows { return rows(1, nil) }}))
+	assert.ErrorContains(t, f.exports.Run(ctx, "users", export.Request{Email: "ada@example.com"}), "BaseURL")
+}
+
+func TestDeliver(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	file := export.File{
+		Name:  "invoice-42.pdf",
+		Title: "invoice",
+		Write: func(w io.Writer) error {
+			_, err := io.WriteString(w, "%PDF-1.7")
+			return err
+		},
+	}
+	require.NoError(t, f.exports.Deliver(ctx, file, export.Request{Email: "ada@example.com"}))
+
+	msg, ok := f.sender.LastTo("ada@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Your invoice is ready", msg.Subject)
+	links := msg.ExtractLinks()
+	require.NotEmpty(t, links)
+	assert.Contains(t, links[0], ".pdf?")
+
+	rec := f.get(strings.TrimPrefix(links[0], "https://app.example.com"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=invoice-42.pdf", rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "%PDF-1.7", rec.Body.String())
+
+	// A failed write leaves no file behind
+	file.Write = func(io.Writer) error { return errors.New("out of paper") }
+	assert.Error(t, f.exports.Deliver(ctx, file, export.Request{Email: "ada@example.com"}))
+	files, err := os.ReadDir(f.exports.Dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
@@ -0,0 +1,59 @@
+package buffkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/export"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamCSV(t *testing.T) {
+	rows := func(n int, err error) export.Rows {
+		return func(yield func([]string, error) bool) {
+			for i := 0; i < n; i++ {
+				if !yield([]string{"ada@example.com", "=HYPERLINK()"}, nil) {
+					return
+				}
+			}
+			if err != nil {
+				yield(nil, err)
+			}
+		}
+	}
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/users.csv", func(c buffalo.Context) error {
+		return StreamCSV(c, "users.csv", []string{"Email", "Note"}, rows(1000, nil))
+	})
+	app.GET("/broken.csv", func(c buffalo.Context) error {
+		return StreamCSV(c, "broken.csv", []string{"Email"}, rows(0, errors.New("connection lost")))
+	})
+	app.GET("/cut.csv", func(c buffalo.Context) error {
+		return StreamCSV(c, "cut.csv", nil, rows(600, errors.New("connection lost")))
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users.csv", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=users.csv", rec.Header().Get("Content-Disposition"))
+	assert.True(t, rec.Flushed)
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "Email,Note\nada@example.com,'=HYPERLINK()\n"))
+	assert.Equal(t, 1001, strings.Count(rec.Body.String(), "\n"))
+
+	// Failing before anything is sent makes an error page
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/broken.csv", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Disposition"))
+
+	// Failing later cuts the download short
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cut.csv", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 500, strings.Count(rec.Body.String(), "\n"))
+}
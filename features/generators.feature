@@ -18,6 +18,8 @@ Feature: Buffkit Generators
     And the file "models/user.go" should contain "func (user *User) Create"
     And the file "models/user.go" should contain "func FindUser"
     And the file "models/user.go" should contain "func AllUsers"
+    And the file "models/user.go" should contain "LockVersion int"
+    And the file "models/user.go" should contain "buffkit.CheckLockVersion"
     And a migration file matching "db/migrations/core/*_create_users.up.sql" should exist
     And a migration file matching "db/migrations/core/*_create_users.down.sql" should exist
 
@@ -48,6 +50,7 @@ Feature: Buffkit Generators
     And the migration up file should contain "CREATE TABLE products"
     And the migration up file should contain "name VARCHAR(255)"
     And the migration up file should contain "price DECIMAL(10,2)"
+    And the migration up file should contain "lock_version INTEGER NOT NULL DEFAULT 1"
     And a migration file matching "db/migrations/core/*_create_products.down.sql" should exist
     And the migration down file should contain "DROP TABLE IF EXISTS products"
 
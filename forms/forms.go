@@ -0,0 +1,71 @@
+// Package forms carries validation errors from a handler to the form that
+// shows them. A handler that rejects a submission records the errors on
+// the request and re-renders the page; <bk-form> picks them up and
+// renders an error summary at the top of the form:
+//
+//	errs := forms.Errors{}
+//	if title == "" {
+//	    errs.Add("title", "Enter a title")
+//	}
+//	if errs.Any() {
+//	    forms.SetErrors(c, errs)
+//	    return c.Render(http.StatusUnprocessableEntity, r.HTML("posts/new.plush.html"))
+//	}
+package forms
+
+import (
+	"sort"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// contextKey is where SetErrors stores the errors on the request.
+const contextKey = "buffkit.form_errors"
+
+// Errors are validation messages by field name. Messages under the empty
+// field name are about the form as a whole.
+type Errors map[string][]string
+
+// Add records msg against field.
+func (e Errors) Add(field, msg string) {
+	e[field] = append(e[field], msg)
+}
+
+// Any reports whether there are any errors.
+func (e Errors) Any() bool {
+	for _, msgs := range e {
+		if len(msgs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the messages for field.
+func (e Errors) Get(field string) []string {
+	return e[field]
+}
+
+// Fields returns the fields with errors, sorted, with whole-form errors
+// (the empty field name) first.
+func (e Errors) Fields() []string {
+	fields := make([]string, 0, len(e))
+	for field, msgs := range e {
+		if len(msgs) > 0 {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// SetErrors records errs as the validation errors of the request's form.
+func SetErrors(c buffalo.Context, errs Errors) {
+	c.Set(contextKey, errs)
+}
+
+// ErrorsFor returns the errors recorded with SetErrors, or nil.
+func ErrorsFor(c buffalo.Context) Errors {
+	errs, _ := c.Value(contextKey).(Errors)
+	return errs
+}
@@ -0,0 +1,29 @@
+package forms
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	errs := Errors{}
+	if errs.Any() {
+		t.Error("expected no errors")
+	}
+
+	errs.Add("title", "Enter a title")
+	errs.Add("", "Could not save")
+	errs.Add("body", "Too short")
+	errs.Add("title", "Too long")
+	errs["empty"] = nil
+
+	if !errs.Any() {
+		t.Error("expected errors")
+	}
+	if got := errs.Get("title"); !reflect.DeepEqual(got, []string{"Enter a title", "Too long"}) {
+		t.Errorf("unexpected title errors %v", got)
+	}
+	if got := errs.Fields(); !reflect.DeepEqual(got, []string{"", "body", "title"}) {
+		t.Errorf("unexpected fields %v", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/johnjansen/buffkit/tasks"
 	"github.com/markbates/grift/grift"
 )
 
@@ -16,53 +17,50 @@ func init() {
 }
 
 func registerGeneratorTasks() {
-	_ = grift.Namespace("buffkit:generate", func() {
+	generators := []tasks.Task{
 		// Model generator
-		_ = grift.Desc("model", "Generate a model with optional migration")
-		_ = grift.Add("model", generateModel)
+		{Name: "model", Args: "NAME [FIELD:TYPE ...]", Desc: "Generate a model with optional migration", Switches: taggableSwitch, Run: generateModel},
 
 		// Action generator (controllers in Rails)
-		_ = grift.Desc("action", "Generate Buffalo action handlers")
-		_ = grift.Add("action", generateAction)
+		{Name: "action", Args: "RESOURCE [ACTION ...]", Desc: "Generate Buffalo action handlers", Run: generateAction},
 
 		// Resource generator (model + actions + views)
-		_ = grift.Desc("resource", "Generate a complete resource (model, actions, views)")
-		_ = grift.Add("resource", generateResource)
+		{Name: "resource", Args: "NAME [FIELD:TYPE ...]", Desc: "Generate a complete resource (model, actions, views)", Switches: taggableSwitch, Run: generateResource},
 
 		// Migration generator with fields
-		_ = grift.Desc("migration", "Generate a migration with fields")
-		_ = grift.Add("migration", generateMigration)
+		{Name: "migration", Args: "NAME [FIELD:TYPE ...]", Desc: "Generate a migration with fields", Run: generateMigration},
 
 		// Component generator
-		_ = grift.Desc("component", "Generate a server-side component")
-		_ = grift.Add("component", generateComponent)
+		{Name: "component", Args: "NAME", Desc: "Generate a server-side component", Run: generateComponent},
 
 		// Job generator
-		_ = grift.Desc("job", "Generate a background job handler")
-		_ = grift.Add("job", generateJob)
+		{Name: "job", Args: "NAME", Desc: "Generate a background job handler", Run: generateJob},
 
 		// Mailer generator
-		_ = grift.Desc("mailer", "Generate email templates and handler")
-		_ = grift.Add("mailer", generateMailer)
+		{Name: "mailer", Args: "NAME [ACTION ...]", Desc: "Generate email templates and handler", Run: generateMailer},
 
 		// SSE handler generator
-		_ = grift.Desc("sse", "Generate a Server-Sent Events handler")
-		_ = grift.Add("sse", generateSSE)
+		{Name: "sse", Args: "NAME", Desc: "Generate a Server-Sent Events handler", Run: generateSSE},
+	}
+
+	_ = grift.Namespace("buffkit:generate", func() {
+		for _, t := range generators {
+			_ = tasks.Add(t)
+		}
 	})
 
-	// Shorthand aliases
+	// Shorthand aliases, left out of the task list
 	_ = grift.Namespace("g", func() {
-		_ = grift.Add("model", generateModel)
-		_ = grift.Add("action", generateAction)
-		_ = grift.Add("resource", generateResource)
-		_ = grift.Add("migration", generateMigration)
-		_ = grift.Add("component", generateComponent)
-		_ = grift.Add("job", generateJob)
-		_ = grift.Add("mailer", generateMailer)
-		_ = grift.Add("sse", generateSSE)
+		for _, t := range generators {
+			t.Desc = ""
+			_ = tasks.Add(t)
+		}
 	})
 }
 
+// taggableSwitch is the model and resource generators' --taggable.
+var taggableSwitch = map[string]string{"taggable": "Make the model taggable with the tags package"}
+
 // generateModel creates a model struct and optionally a migration
 func generateModel(c *grift.Context) error {
 	if len(c.Args) < 1 {
@@ -84,6 +82,12 @@ import (
 	"time"
 {{if .HasUUID}}	"github.com/gofrs/uuid"{{end}}
 {{if .HasJSON}}	"encoding/json"{{end}}
+
+	"github.com/johnjansen/buffkit"
+{{if .HasEncrypted}}	"github.com/johnjansen/buffkit/secure"{{end}}
+{{if .Taggable}}	"strconv"
+
+	"github.com/johnjansen/buffkit/tags"{{end}}
 )
 
 // {{.Names.Camel}} represents a {{.Names.Snake}} in the database
@@ -92,39 +96,74 @@ type {{.Names.Camel}} struct {
 {{range .Fields}}	{{.Name}} {{if .Nullable}}*{{end}}{{.Type}} ` + "`" + `{{.Tag}}` + "`" + `
 {{end}}	CreatedAt time.Time ` + "`" + `json:"created_at" db:"created_at"` + "`" + `
 	UpdatedAt time.Time ` + "`" + `json:"updated_at" db:"updated_at"` + "`" + `
+
+	// LockVersion is the version the record was loaded at. Update only
+	// saves over that version, and moves it on
+	LockVersion int ` + "`" + `json:"lock_version" db:"lock_version" form:"lock_version"` + "`" + `
 }
 
 // TableName returns the database table name
 func ({{.Names.Lower}} *{{.Names.Camel}}) TableName() string {
 	return "{{.Names.Plural}}"
 }
+{{if .Taggable}}
+// TaggableType names {{.Names.Plural}} to the tags package
+func ({{.Names.Lower}} *{{.Names.Camel}}) TaggableType() string {
+	return "{{.Names.Plural}}"
+}
+
+// TaggableID identifies the {{.Names.Snake}} to the tags package
+func ({{.Names.Lower}} *{{.Names.Camel}}) TaggableID() string {
+	return strconv.Itoa({{.Names.Lower}}.ID)
+}
+
+// Tags returns the {{.Names.Snake}}'s tags, by name
+func ({{.Names.Lower}} *{{.Names.Camel}}) Tags(ctx context.Context, t *tags.Tags) ([]tags.Tag, error) {
+	return t.For(ctx, {{.Names.Lower}})
+}
 
+// SetTags replaces the {{.Names.Snake}}'s tags with the tags named names
+func ({{.Names.Lower}} *{{.Names.Camel}}) SetTags(ctx context.Context, t *tags.Tags, names []string) error {
+	return t.Set(ctx, {{.Names.Lower}}, names)
+}
+{{end}}
 // Create inserts the {{.Names.Snake}} into the database
 func ({{.Names.Lower}} *{{.Names.Camel}}) Create(ctx context.Context, db *sql.DB) error {
 	query := ` + "`" + `
-		INSERT INTO {{.Names.Plural}} ({{.FieldNamesDB}}, created_at, updated_at)
-		VALUES ({{.FieldPlaceholders}}, ?, ?)
+		INSERT INTO {{.Names.Plural}} ({{.FieldNamesDB}}, created_at, updated_at, lock_version)
+		VALUES ({{.FieldPlaceholders}}, ?, ?, 1)
 		RETURNING id` + "`" + `
 
 	now := time.Now()
 	{{.Names.Lower}}.CreatedAt = now
 	{{.Names.Lower}}.UpdatedAt = now
+	{{.Names.Lower}}.LockVersion = 1
 
 	err := db.QueryRowContext(ctx, query, {{.FieldValues}}, now, now).Scan(&{{.Names.Lower}}.ID)
 	return err
 }
 
-// Update updates the {{.Names.Snake}} in the database
+// Update updates the {{.Names.Snake}} in the database, unless it changed
+// since it was loaded at LockVersion: then it returns a
+// *buffkit.StaleRecordError, which matches buffkit.ErrStaleRecord
 func ({{.Names.Lower}} *{{.Names.Camel}}) Update(ctx context.Context, db *sql.DB) error {
 	query := ` + "`" + `
 		UPDATE {{.Names.Plural}}
-		SET {{.UpdateFields}}, updated_at = ?
-		WHERE id = ?` + "`" + `
+		SET {{.UpdateFields}}, updated_at = ?, lock_version = lock_version + 1
+		WHERE id = ? AND lock_version = ?` + "`" + `
 
-	{{.Names.Lower}}.UpdatedAt = time.Now()
+	updatedAt := time.Now()
 
-	_, err := db.ExecContext(ctx, query, {{.FieldValues}}, {{.Names.Lower}}.UpdatedAt, {{.Names.Lower}}.ID)
-	return err
+	res, err := db.ExecContext(ctx, query, {{.FieldValues}}, updatedAt, {{.Names.Lower}}.ID, {{.Names.Lower}}.LockVersion)
+	if err != nil {
+		return err
+	}
+	if err := buffkit.CheckLockVersion(res, "{{.Names.Plural}}", {{.Names.Lower}}.ID); err != nil {
+		return err
+	}
+	{{.Names.Lower}}.UpdatedAt = updatedAt
+	{{.Names.Lower}}.LockVersion++
+	return nil
 }
 
 // Delete removes the {{.Names.Snake}} from the database
@@ -144,6 +183,7 @@ func Find{{.Names.Camel}}(ctx context.Context, db *sql.DB, id int) (*{{.Names.Ca
 {{range .Fields}}		&{{$.Names.Lower}}.{{.Name}},
 {{end}}		&{{.Names.Lower}}.CreatedAt,
 		&{{.Names.Lower}}.UpdatedAt,
+		&{{.Names.Lower}}.LockVersion,
 	)
 
 	if err != nil {
@@ -170,6 +210,7 @@ func All{{.Names.Plural}}(ctx context.Context, db *sql.DB) ([]*{{.Names.Camel}},
 {{range .Fields}}			&{{$.Names.Lower}}.{{.Name}},
 {{end}}			&{{.Names.Lower}}.CreatedAt,
 			&{{.Names.Lower}}.UpdatedAt,
+			&{{.Names.Lower}}.LockVersion,
 		)
 		if err != nil {
 			return nil, err
@@ -187,10 +228,12 @@ func All{{.Names.Plural}}(ctx context.Context, db *sql.DB) ([]*{{.Names.Camel}},
 		"Fields":            fields,
 		"HasUUID":           hasFieldType(fields, "uuid.UUID"),
 		"HasJSON":           hasFieldType(fields, "json.RawMessage"),
+		"HasEncrypted":      hasFieldType(fields, "secure.EncryptedString") || hasFieldType(fields, "secure.DeterministicString"),
 		"FieldNamesDB":      fieldNamesDB(fields),
 		"FieldPlaceholders": fieldPlaceholders(fields),
 		"FieldValues":       fieldValues(fields, names.Lower),
 		"UpdateFields":      updateFields(fields),
+		"Taggable":          tasks.FromContext(c).Switch("taggable"),
 	}
 
 	if err := GenerateFile(modelTemplate, data, modelPath); err != nil {
@@ -198,6 +241,19 @@ func All{{.Names.Plural}}(ctx context.Context, db *sql.DB) ([]*{{.Names.Camel}},
 	}
 
 	fmt.Printf("✅ Generated model: %s\n", modelPath)
+	for _, field := range fields {
+		switch {
+		case field.Encrypted && !strings.HasPrefix(field.Type, "secure."):
+			fmt.Printf("⚠️  %s (%s) is stored as is; only string fields can be encrypted\n", field.Name, field.Type)
+		case field.Deterministic && field.Encrypted:
+			fmt.Printf("🔎 Find %s by %s with: WHERE %s IN (...) and %s.%s.Lookups()\n",
+				names.Plural, field.Name, ToSnake(field.Name), names.Lower, field.Name)
+		}
+	}
+	if tasks.FromContext(c).Switch("taggable") {
+		fmt.Println("\n🏷  Set Config.Tags, and save tags after creating or updating:")
+		fmt.Printf("%s.SetTags(ctx, kit.Tags, tags.Parse(c.Param(\"tags\")))\n", names.Lower)
+	}
 
 	// Optionally generate migration
 	if len(fields) > 0 {
@@ -229,11 +285,13 @@ func generateAction(c *grift.Context) error {
 	actionTemplate := `package actions
 
 import (
-	"net/http"
+{{if .HasUpdate}}	"errors"
+{{end}}	"net/http"
 
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/buffalo/render"
-	"your-app/models"
+{{if .HasUpdate}}	"github.com/johnjansen/buffkit"
+{{end}}	"your-app/models"
 )
 {{range .Actions}}
 // {{$.Names.Plural}}{{. | title}} handles {{. | lower}} action for {{$.Names.Plural}}
@@ -274,6 +332,7 @@ func {{$.Names.Plural}}{{. | title}}(c buffalo.Context) error {
 	}
 
 	c.Set("{{$.Names.Lower}}", {{$.Names.Lower}})
+	c.Set("conflict", "")
 	return c.Render(http.StatusOK, r.HTML("{{$.Names.Plural}}/edit.plush.html"))
 {{else if eq . "update"}}	{{$.Names.Lower}}, err := models.Find{{$.Names.Camel}}(c.Request().Context(), c.Value("db").(*sql.DB), c.Param("id"))
 	if err != nil {
@@ -286,6 +345,17 @@ func {{$.Names.Plural}}{{. | title}}(c buffalo.Context) error {
 
 	if err := {{$.Names.Lower}}.Update(c.Request().Context(), c.Value("db").(*sql.DB)); err != nil {
 		c.Set("{{$.Names.Lower}}", {{$.Names.Lower}})
+		c.Set("conflict", "")
+		var stale *buffkit.StaleRecordError
+		if errors.As(err, &stale) {
+			// Keep their changes in the form, at the version saved
+			// since, so saving again overwrites it knowingly
+			if current, err := models.Find{{$.Names.Camel}}(c.Request().Context(), c.Value("db").(*sql.DB), {{$.Names.Lower}}.ID); err == nil {
+				{{$.Names.Lower}}.LockVersion = current.LockVersion
+			}
+			c.Set("conflict", stale.PublicMessage())
+			return c.Render(http.StatusConflict, r.HTML("{{$.Names.Plural}}/edit.plush.html"))
+		}
 		c.Set("errors", err)
 		return c.Render(http.StatusUnprocessableEntity, r.HTML("{{$.Names.Plural}}/edit.plush.html"))
 	}
@@ -311,8 +381,9 @@ func {{$.Names.Plural}}{{. | title}}(c buffalo.Context) error {
 
 	// Prepare template data
 	data := map[string]interface{}{
-		"Names":   names,
-		"Actions": actions,
+		"Names":     names,
+		"Actions":   actions,
+		"HasUpdate": hasAction(actions, "update"),
 	}
 
 	if err := GenerateFile(actionTemplate, data, actionPath); err != nil {
@@ -349,7 +420,7 @@ func generateResource(c *grift.Context) error {
 
 	for _, view := range views {
 		viewPath := filepath.Join(viewsDir, view+".plush.html")
-		if err := generateView(names, view, viewPath); err != nil {
+		if err := generateView(names, view, viewPath, tasks.FromContext(c).Switch("taggable")); err != nil {
 			return fmt.Errorf("failed to generate view %s: %w", view, err)
 		}
 		fmt.Printf("✅ Generated view: %s\n", viewPath)
@@ -606,6 +677,7 @@ import (
 	"time"
 
 	"github.com/hibiken/asynq"
+	bkjobs "github.com/johnjansen/buffkit/jobs"
 )
 
 // {{.Names.Camel}}Job represents the payload for {{.Names.Snake}} job
@@ -646,39 +718,36 @@ func {{.Names.Camel}}Handler(ctx context.Context, t *asynq.Task) error {
 	}
 }
 
-// Enqueue{{.Names.Camel}} enqueues a new {{.Names.Snake}} job
-func Enqueue{{.Names.Camel}}(client *asynq.Client, data string) error {
+// Enqueue{{.Names.Camel}} enqueues a new {{.Names.Snake}} job.
+// Retries follow the policy set in Register{{.Names.Camel}}Handler.
+func Enqueue{{.Names.Camel}}(runtime *bkjobs.Runtime, data string) error {
 	job := {{.Names.Camel}}Job{
 		ID:        generateJobID(),
 		Data:      data,
 		Timestamp: time.Now(),
 	}
 
-	payload, err := json.Marshal(job)
-	if err != nil {
-		return fmt.Errorf("failed to marshal {{.Names.Snake}} job: %w", err)
-	}
-
-	task := asynq.NewTask("{{.Names.Snake}}", payload)
-
-	// Enqueue with options
-	info, err := client.Enqueue(task,
+	if err := runtime.Enqueue("{{.Names.Snake}}", job,
 		asynq.Queue("default"),
-		asynq.MaxRetry(3),
 		asynq.Timeout(5*time.Minute),
-	)
-
-	if err != nil {
+	); err != nil {
 		return fmt.Errorf("failed to enqueue {{.Names.Snake}} job: %w", err)
 	}
 
-	fmt.Printf("Enqueued {{.Names.Snake}} job %s (task ID: %s)\n", job.ID, info.ID)
+	fmt.Printf("Enqueued {{.Names.Snake}} job %s\n", job.ID)
 	return nil
 }
 
-// Register{{.Names.Camel}}Handler registers the job handler with the mux
-func Register{{.Names.Camel}}Handler(mux *asynq.ServeMux) {
-	mux.HandleFunc("{{.Names.Snake}}", {{.Names.Camel}}Handler)
+// Register{{.Names.Camel}}Handler registers the job handler and its retry policy
+func Register{{.Names.Camel}}Handler(runtime *bkjobs.Runtime) {
+	runtime.HandleFunc("{{.Names.Snake}}", {{.Names.Camel}}Handler)
+
+	// Adjust to suit the job; omit to use bkjobs.DefaultRetryPolicy
+	runtime.SetRetryPolicy("{{.Names.Snake}}", bkjobs.RetryPolicy{
+		MaxRetries: 3,
+		Backoff:    bkjobs.ExponentialBackoff(30*time.Second, 10*time.Minute),
+		Jitter:     0.2,
+	})
 }
 
 // generateJobID generates a unique job ID
@@ -697,7 +766,7 @@ func generateJobID() string {
 
 	fmt.Printf("✅ Generated job handler: %s\n", jobPath)
 	fmt.Printf("\n📝 Register your job handler in your app setup:\n")
-	fmt.Printf("jobs.Register%sHandler(kit.Jobs.Mux)\n", names.Camel)
+	fmt.Printf("jobs.Register%sHandler(kit.Jobs)\n", names.Camel)
 
 	return nil
 }
@@ -971,7 +1040,8 @@ func generateCreateTableSQL(tableName string, fields []Field) string {
 	}
 
 	sql += "    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\n"
-	sql += "    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP\n"
+	sql += "    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\n"
+	sql += "    lock_version INTEGER NOT NULL DEFAULT 1\n"
 	sql += ");"
 
 	return sql
@@ -1018,6 +1088,11 @@ func mapToSQLType(goType string) string {
 		"time.Time":       "TIMESTAMP",
 		"uuid.UUID":       "UUID",
 		"json.RawMessage": "JSONB",
+
+		// Ciphertext is longer than the value; deterministic columns
+		// stay short enough to index
+		"secure.EncryptedString":     "TEXT",
+		"secure.DeterministicString": "VARCHAR(512)",
 	}
 
 	if sqlType, ok := typeMap[goType]; ok {
@@ -1026,6 +1101,15 @@ func mapToSQLType(goType string) string {
 	return "VARCHAR(255)"
 }
 
+func hasAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
 func hasFieldType(fields []Field, fieldType string) bool {
 	for _, field := range fields {
 		if field.Type == fieldType {
@@ -1067,7 +1151,7 @@ func updateFields(fields []Field) string {
 	return strings.Join(updates, ", ")
 }
 
-func generateView(names *NameVariants, view, path string) error {
+func generateView(names *NameVariants, view, path string, taggable bool) error {
 	// Simple view templates
 	templates := map[string]string{
 		"index": `<h1>{{.Names.Title}} List</h1>
@@ -1091,16 +1175,23 @@ func generateView(names *NameVariants, view, path string) error {
 <% } %>`,
 
 		"edit": `<h1>Edit {{.Names.Title}}</h1>
+<%= if (len(conflict) > 0) { %>
+  <p class="conflict"><%= conflict %></p>
+<% } %>
 <%= form_for({{.Names.Lower}}, {action: "/{{.Names.Plural}}/" + {{.Names.Lower}}.ID, method: "PUT"}) { %>
   <%= partial("{{.Names.Plural}}/form.html") %>
   <button type="submit">Update</button>
 <% } %>`,
 
-		"_form": `<!-- Add your form fields here -->
+		"_form": `<input type="hidden" name="lock_version" value="<%= {{.Names.Lower}}.LockVersion %>" />
+<!-- Add your form fields here -->
 <div>
   <label>Field Name</label>
   <input type="text" name="field_name" value="<%= {{.Names.Lower}}.FieldName %>" />
-</div>`,
+</div>{{if .Taggable}}
+<div>
+  <bk-tag-input name="tags" target="{{.Names.Plural}}:<%= {{.Names.Lower}}.ID %>"></bk-tag-input>
+</div>{{end}}`,
 	}
 
 	tmpl, ok := templates[view]
@@ -1109,7 +1200,8 @@ func generateView(names *NameVariants, view, path string) error {
 	}
 
 	data := map[string]interface{}{
-		"Names": names,
+		"Names":    names,
+		"Taggable": taggable,
 	}
 
 	return GenerateFile(tmpl, data, path)
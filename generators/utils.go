@@ -190,10 +190,16 @@ type Field struct {
 	Tag      string
 	Default  string
 	Nullable bool
+
+	// Encrypted string fields are stored encrypted; Deterministic ones
+	// can be searched
+	Encrypted     bool
+	Deterministic bool
 }
 
 // ParseFields parses field definitions from args
-// Format: name:type name:type:nullable
+// Format: name:type name:type:nullable name:string:encrypted
+// name:string:encrypted:deterministic
 func ParseFields(args []string) []Field {
 	fields := make([]Field, 0, len(args))
 
@@ -208,9 +214,24 @@ func ParseFields(args []string) []Field {
 			Type: mapFieldType(parts[1]),
 		}
 
-		// Check for nullable flag
-		if len(parts) > 2 && parts[2] == "nullable" {
-			field.Nullable = true
+		// Check for flags
+		for _, flag := range parts[2:] {
+			switch flag {
+			case "nullable":
+				field.Nullable = true
+			case "encrypted":
+				field.Encrypted = true
+			case "deterministic":
+				field.Deterministic = true
+			}
+		}
+
+		// Encrypted strings are stored through the keyring
+		if field.Encrypted && field.Type == "string" {
+			field.Type = "secure.EncryptedString"
+			if field.Deterministic {
+				field.Type = "secure.DeterministicString"
+			}
 		}
 
 		// Generate JSON tag
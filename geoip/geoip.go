@@ -0,0 +1,120 @@
+// Package geoip finds roughly where an IP address is, so logins, sessions
+// and audit logs can say "Berlin, DE" rather than just an address.
+//
+// Locations come from a MaxMind GeoLite2 (or GeoIP2) City or Country
+// database, which is free with a MaxMind account:
+//
+//	db, err := geoip.Open("GeoLite2-City.mmdb")
+//	loc, _ := db.Locate("81.2.69.142") // Location{City: "London", ...}
+//
+// Wire opens Config.GeoIPDatabase and hands it to the auth package, which
+// annotates login attempts and sessions with it. Any other source can
+// stand in through Func.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Location is where an IP address is. Fields the database doesn't know
+// are empty; private and loopback addresses have no location.
+type Location struct {
+	City        string `json:"city,omitempty"`
+	Country     string `json:"country,omitempty"`      // English name, "Germany"
+	CountryCode string `json:"country_code,omitempty"` // ISO 3166-1, "DE"
+}
+
+// String is "City, CC", or just the country when the city is unknown:
+// "Berlin, DE", "Germany". It is empty for an unknown location.
+func (l Location) String() string {
+	switch {
+	case l.City != "" && l.CountryCode != "":
+		return l.City + ", " + l.CountryCode
+	case l.City != "":
+		return l.City
+	case l.Country != "":
+		return l.Country
+	}
+	return l.CountryCode
+}
+
+// Locator finds the location of an IP address.
+type Locator interface {
+	Locate(ip string) (Location, error)
+}
+
+// Func adapts a function to a Locator.
+type Func func(ip string) (Location, error)
+
+// Locate calls f.
+func (f Func) Locate(ip string) (Location, error) { return f(ip) }
+
+// MaxMind locates addresses with a MaxMind City or Country database.
+type MaxMind struct {
+	reader *geoip2.Reader
+	city   bool
+}
+
+// Open opens the MaxMind database at path, such as GeoLite2-City.mmdb.
+// Close it when done.
+func Open(path string) (*MaxMind, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: open %s: %w", path, err)
+	}
+	kind := reader.Metadata().DatabaseType
+	if !strings.Contains(kind, "City") && !strings.Contains(kind, "Country") {
+		_ = reader.Close()
+		return nil, fmt.Errorf("geoip: %s is a %s database, not a City or Country one", path, kind)
+	}
+	return &MaxMind{reader: reader, city: strings.Contains(kind, "City")}, nil
+}
+
+// Locate returns the location of ip. Private, loopback and unknown
+// addresses give an empty Location; only malformed ones are an error.
+func (m *MaxMind) Locate(ip string) (Location, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, fmt.Errorf("geoip: %q is not an IP address", ip)
+	}
+	addr = addr.Unmap()
+	if !Public(addr) {
+		return Location{}, nil
+	}
+
+	netIP := net.IP(addr.AsSlice())
+	if m.city {
+		rec, err := m.reader.City(netIP)
+		if err != nil {
+			return Location{}, fmt.Errorf("geoip: %w", err)
+		}
+		return Location{
+			City:        rec.City.Names["en"],
+			Country:     rec.Country.Names["en"],
+			CountryCode: rec.Country.IsoCode,
+		}, nil
+	}
+	rec, err := m.reader.Country(netIP)
+	if err != nil {
+		return Location{}, fmt.Errorf("geoip: %w", err)
+	}
+	return Location{Country: rec.Country.Names["en"], CountryCode: rec.Country.IsoCode}, nil
+}
+
+// Close releases the database.
+func (m *MaxMind) Close() error {
+	return m.reader.Close()
+}
+
+// Public reports whether addr is on the public internet, and so can
+// have a location.
+func Public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && !addr.IsPrivate() && !addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() && !addr.IsUnspecified() && !addr.IsMulticast()
+}
@@ -0,0 +1,143 @@
+package geoip_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/johnjansen/buffkit/geoip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocationString(t *testing.T) {
+	assert.Equal(t, "Berlin, DE", geoip.Location{City: "Berlin", Country: "Germany", CountryCode: "DE"}.String())
+	assert.Equal(t, "Germany", geoip.Location{Country: "Germany", CountryCode: "DE"}.String())
+	assert.Equal(t, "DE", geoip.Location{CountryCode: "DE"}.String())
+	assert.Equal(t, "", geoip.Location{}.String())
+}
+
+func TestMaxMind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	require.NoError(t, os.WriteFile(path, testDatabase("GeoLite2-City"), 0o644))
+
+	db, err := geoip.Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	loc, err := db.Locate("81.2.69.142")
+	require.NoError(t, err)
+	assert.Equal(t, geoip.Location{City: "Berlin", Country: "Germany", CountryCode: "DE"}, loc)
+
+	// Addresses outside the database, private ones and IPv4 written as
+	// IPv6 are handled
+	loc, err = db.Locate("82.1.1.1")
+	require.NoError(t, err)
+	assert.Empty(t, loc)
+	loc, err = db.Locate("192.168.1.10")
+	require.NoError(t, err)
+	assert.Empty(t, loc)
+	loc, err = db.Locate("::ffff:81.2.69.142")
+	require.NoError(t, err)
+	assert.Equal(t, "Berlin, DE", loc.String())
+	_, err = db.Locate("not an ip")
+	assert.Error(t, err)
+
+	_, err = geoip.Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+	asn := filepath.Join(t.TempDir(), "GeoLite2-ASN.mmdb")
+	require.NoError(t, os.WriteFile(asn, testDatabase("GeoLite2-ASN"), 0o644))
+	_, err = geoip.Open(asn)
+	assert.ErrorContains(t, err, "not a City or Country")
+}
+
+func TestFunc(t *testing.T) {
+	var l geoip.Locator = geoip.Func(func(ip string) (geoip.Location, error) {
+		if ip == "" {
+			return geoip.Location{}, errors.New("no ip")
+		}
+		return geoip.Location{CountryCode: "NZ"}, nil
+	})
+	loc, err := l.Locate("203.0.113.9")
+	require.NoError(t, err)
+	assert.Equal(t, "NZ", loc.String())
+
+	assert.True(t, geoip.Public(netip.MustParseAddr("81.2.69.142")))
+	assert.False(t, geoip.Public(netip.MustParseAddr("10.0.0.1")))
+	assert.False(t, geoip.Public(netip.MustParseAddr("::1")))
+}
+
+// testDatabase builds a tiny MaxMind database of the given type that
+// places 81.0.0.0/8 in Berlin. See the MaxMind DB format specification:
+// https://maxmind.github.io/MaxMind-DB/
+func testDatabase(kind string) []byte {
+	const nodes = 8
+	const prefix = 81
+
+	// One node per bit of the /8: the matching branch leads on, the
+	// other to "no data" (the node count)
+	var tree []byte
+	for i := 0; i < nodes; i++ {
+		next := uint32(i + 1)
+		if i == nodes-1 {
+			next = nodes + 16 // the first record of the data section
+		}
+		left, right := next, uint32(nodes)
+		if prefix>>(7-i)&1 == 1 {
+			left, right = right, left
+		}
+		tree = append(tree, record24(left)...)
+		tree = append(tree, record24(right)...)
+	}
+
+	data := mmdbMap(
+		"city", mmdbMap("names", mmdbMap("en", mmdbString("Berlin"))),
+		"country", mmdbMap("iso_code", mmdbString("DE"), "names", mmdbMap("en", mmdbString("Germany"))),
+	)
+	metadata := mmdbMap(
+		"binary_format_major_version", mmdbUint(5, 2),
+		"binary_format_minor_version", mmdbUint(5, 0),
+		"build_epoch", append([]byte{0x00 | 1, 2}, 1), // uint64
+		"database_type", mmdbString(kind),
+		"description", mmdbMap(),
+		"ip_version", mmdbUint(5, 4),
+		"languages", []byte{0x00, 4}, // empty array
+		"node_count", mmdbUint(6, nodes),
+		"record_size", mmdbUint(5, 24),
+	)
+
+	out := append(tree, make([]byte, 16)...)
+	out = append(out, data...)
+	out = append(out, "\xAB\xCD\xEFMaxMind.com"...)
+	return append(out, metadata...)
+}
+
+func record24(v uint32) []byte {
+	return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func mmdbString(s string) []byte {
+	return append([]byte{2<<5 | byte(len(s))}, s...)
+}
+
+// mmdbUint encodes v as a uint16 (typ 5) or uint32 (typ 6).
+func mmdbUint(typ byte, v uint32) []byte {
+	b := binary.BigEndian.AppendUint32(nil, v)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return append([]byte{typ<<5 | byte(len(b))}, b...)
+}
+
+// mmdbMap encodes alternating keys and encoded values.
+func mmdbMap(pairs ...any) []byte {
+	out := []byte{7<<5 | byte(len(pairs)/2)}
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, mmdbString(pairs[i].(string))...)
+		out = append(out, pairs[i+1].([]byte)...)
+	}
+	return out
+}
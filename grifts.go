@@ -2,8 +2,11 @@ package buffkit
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"embed"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
@@ -12,8 +15,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/anonymize"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/jobs"
 	"github.com/johnjansen/buffkit/migrations"
 	_ "github.com/johnjansen/buffkit/generators" // Register generator tasks
+	"github.com/johnjansen/buffkit/tasks"
 	"github.com/markbates/grift/grift"
 
 	// Import database drivers
@@ -25,11 +33,32 @@ import (
 //go:embed db/migrations/*/*.sql
 var migrationFS embed.FS
 
+// Migrations returns Buffkit's SQL migrations (db/migrations), the set
+// buffkit:migrate applies. Pass it to migrations.NewRunner to apply them
+// from code, e.g. in tests.
+func Migrations() embed.FS {
+	return migrationFS
+}
+
+// buffkitTasks holds the names of the grift tasks registered below, for
+// Kit.Manifest.
+var buffkitTasks []string
+
 func init() {
 	// Register all Buffkit grift tasks when package is imported
 	fmt.Println("DEBUG: Registering Buffkit grift tasks")
+	before := make(map[string]bool)
+	for _, name := range grift.List() {
+		before[name] = true
+	}
 	registerMigrationTasks()
 	registerJobTasks()
+	registerUserTasks()
+	for _, name := range grift.List() {
+		if !before[name] {
+			buffkitTasks = append(buffkitTasks, name)
+		}
+	}
 	fmt.Println("DEBUG: Finished registering Buffkit grift tasks")
 }
 
@@ -37,124 +66,179 @@ func init() {
 func registerMigrationTasks() {
 	fmt.Println("DEBUG: Registering migration tasks")
 	_ = grift.Namespace("buffkit", func() {
-		_ = grift.Desc("migrate", "Apply all pending database migrations")
-		_ = grift.Add("migrate", func(c *grift.Context) error {
-			fmt.Println("DEBUG: Running buffkit:migrate task")
-			db, dialect, err := getDatabaseConnection()
-			if err != nil {
-				return fmt.Errorf("database connection failed: %w", err)
-			}
-			defer func() { _ = db.Close() }()
-
-			// Create runner with embedded migrations
-			runner := migrations.NewRunner(db, migrationFS, dialect)
-
-			fmt.Println("🚀 Running migrations...")
-			if err := runner.Migrate(context.Background()); err != nil {
-				return fmt.Errorf("migration failed: %w", err)
-			}
-
-			fmt.Println("✅ Migrations complete!")
-			return nil
+		_ = tasks.Add(tasks.Task{
+			Name:  "migrate",
+			Desc:  "Apply pending database migrations",
+			Flags: []tasks.Flag{tasks.Env, tasks.Steps, tasks.DryRun},
+			Run: func(c *grift.Context) error {
+				fmt.Println("DEBUG: Running buffkit:migrate task")
+				opts := tasks.FromContext(c)
+				db, dialect, err := getDatabaseConnection()
+				if err != nil {
+					return fmt.Errorf("database connection failed: %w", err)
+				}
+				defer func() { _ = db.Close() }()
+
+				// Create runner with embedded migrations
+				runner := migrations.NewRunner(db, migrationFS, dialect)
+
+				if opts.DryRun {
+					_, pending, err := runner.Status(context.Background())
+					if err != nil {
+						return fmt.Errorf("failed to get status: %w", err)
+					}
+					if opts.Steps > 0 && opts.Steps < len(pending) {
+						pending = pending[:opts.Steps]
+					}
+					fmt.Printf("🔍 Would apply %d migration(s):\n", len(pending))
+					for _, m := range pending {
+						fmt.Printf("   - %s\n", m)
+					}
+					return nil
+				}
+
+				fmt.Println("🚀 Running migrations...")
+				if err := runner.Up(context.Background(), opts.Steps); err != nil {
+					return fmt.Errorf("migration failed: %w", err)
+				}
+
+				fmt.Println("✅ Migrations complete!")
+				return nil
+			},
 		})
 
-		_ = grift.Desc("migrate:status", "Show migration status")
-		_ = grift.Add("migrate:status", func(c *grift.Context) error {
-			db, dialect, err := getDatabaseConnection()
-			if err != nil {
-				return fmt.Errorf("database connection failed: %w", err)
-			}
-			defer func() { _ = db.Close() }()
+		_ = tasks.Add(tasks.Task{
+			Name:  "migrate:status",
+			Desc:  "Show migration status",
+			Flags: []tasks.Flag{tasks.Env},
+			Run: func(c *grift.Context) error {
+				db, dialect, err := getDatabaseConnection()
+				if err != nil {
+					return fmt.Errorf("database connection failed: %w", err)
+				}
+				defer func() { _ = db.Close() }()
 
-			runner := migrations.NewRunner(db, migrationFS, dialect)
+				runner := migrations.NewRunner(db, migrationFS, dialect)
 
-			applied, pending, err := runner.Status(context.Background())
-			if err != nil {
-				return fmt.Errorf("failed to get status: %w", err)
-			}
+				applied, pending, err := runner.Status(context.Background())
+				if err != nil {
+					return fmt.Errorf("failed to get status: %w", err)
+				}
 
-			fmt.Println("📊 Migration Status")
-			fmt.Println("==================")
+				fmt.Println("📊 Migration Status")
+				fmt.Println("==================")
 
-			if len(applied) > 0 {
-				fmt.Printf("\n✅ Applied (%d):\n", len(applied))
-				for _, m := range applied {
-					fmt.Printf("   - %s\n", m)
+				if len(applied) > 0 {
+					fmt.Printf("\n✅ Applied (%d):\n", len(applied))
+					for _, m := range applied {
+						fmt.Printf("   - %s\n", m)
+					}
+				} else {
+					fmt.Println("\n✅ Applied: none")
 				}
-			} else {
-				fmt.Println("\n✅ Applied: none")
-			}
 
-			if len(pending) > 0 {
-				fmt.Printf("\n⏳ Pending (%d):\n", len(pending))
-				for _, m := range pending {
-					fmt.Printf("   - %s\n", m)
+				if len(pending) > 0 {
+					fmt.Printf("\n⏳ Pending (%d):\n", len(pending))
+					for _, m := range pending {
+						fmt.Printf("   - %s\n", m)
+					}
+				} else {
+					fmt.Println("\n⏳ Pending: none")
 				}
-			} else {
-				fmt.Println("\n⏳ Pending: none")
-			}
 
-			return nil
+				return nil
+			},
 		})
 
-		_ = grift.Desc("migrate:down", "Rollback the last N migrations (default: 1)")
-		_ = grift.Add("migrate:down", func(c *grift.Context) error {
-			// Get N from args, default to 1
-			n := 1
-			if len(c.Args) > 0 {
-				if parsed, err := strconv.Atoi(c.Args[0]); err == nil && parsed > 0 {
-					n = parsed
-				}
-			}
-
-			db, dialect, err := getDatabaseConnection()
-			if err != nil {
-				return fmt.Errorf("database connection failed: %w", err)
-			}
-			defer func() { _ = db.Close() }()
-
-			runner := migrations.NewRunner(db, migrationFS, dialect)
-
-			fmt.Printf("⬇️  Rolling back %d migration(s)...\n", n)
-			if err := runner.Down(context.Background(), n); err != nil {
-				return fmt.Errorf("rollback failed: %w", err)
-			}
-
-			// Add summary message for tests
-			if n == 1 {
-				fmt.Println("Rolled back 1 migration")
-			} else {
-				fmt.Printf("Rolled back %d migrations\n", n)
-			}
-			fmt.Println("✅ Rollback complete!")
-			return nil
+		_ = tasks.Add(tasks.Task{
+			Name:  "migrate:down",
+			Args:  "[N]",
+			Desc:  "Rollback the last N migrations (default: 1)",
+			Flags: []tasks.Flag{tasks.Env, tasks.Steps, tasks.DryRun},
+			Run: func(c *grift.Context) error {
+				// Get N from --steps or args, default to 1
+				opts := tasks.FromContext(c)
+				n := 1
+				if opts.Steps > 0 {
+					n = opts.Steps
+				} else if len(c.Args) > 0 {
+					if parsed, err := strconv.Atoi(c.Args[0]); err == nil && parsed > 0 {
+						n = parsed
+					}
+				}
+
+				db, dialect, err := getDatabaseConnection()
+				if err != nil {
+					return fmt.Errorf("database connection failed: %w", err)
+				}
+				defer func() { _ = db.Close() }()
+
+				runner := migrations.NewRunner(db, migrationFS, dialect)
+
+				if opts.DryRun {
+					applied, _, err := runner.Status(context.Background())
+					if err != nil {
+						return fmt.Errorf("failed to get status: %w", err)
+					}
+					fmt.Printf("🔍 Would roll back %d migration(s):\n", min(n, len(applied)))
+					for i := len(applied) - 1; i >= 0 && i >= len(applied)-n; i-- {
+						fmt.Printf("   - %s\n", applied[i])
+					}
+					return nil
+				}
+
+				fmt.Printf("⬇️  Rolling back %d migration(s)...\n", n)
+				if err := runner.Down(context.Background(), n); err != nil {
+					return fmt.Errorf("rollback failed: %w", err)
+				}
+
+				// Add summary message for tests
+				if n == 1 {
+					fmt.Println("Rolled back 1 migration")
+				} else {
+					fmt.Printf("Rolled back %d migrations\n", n)
+				}
+				fmt.Println("✅ Rollback complete!")
+				return nil
+			},
 		})
 
-		_ = grift.Desc("migrate:create", "Create a new migration file")
-		_ = grift.Add("migrate:create", func(c *grift.Context) error {
-			if len(c.Args) < 1 {
-				return fmt.Errorf("usage: buffalo task buffkit:migrate:create <name> [module]")
-			}
-
-			name := c.Args[0]
-			module := "core"
-			if len(c.Args) > 1 {
-				module = c.Args[1]
-			}
-
-			// Create migration directory if it doesn't exist
-			dir := fmt.Sprintf("db/migrations/%s", module)
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return fmt.Errorf("failed to create directory: %w", err)
-			}
-
-			// Generate timestamp-based filename
-			timestamp := time.Now().Format("20060102150405")
-			upFile := fmt.Sprintf("%s/%s_%s.up.sql", dir, timestamp, name)
-			downFile := fmt.Sprintf("%s/%s_%s.down.sql", dir, timestamp, name)
-
-			// Create up migration with template
-			upContent := fmt.Sprintf(`-- Migration: %s
+		_ = tasks.Add(tasks.Task{
+			Name:  "migrate:create",
+			Args:  "NAME [MODULE]",
+			Desc:  "Create a new migration file",
+			Flags: []tasks.Flag{tasks.DryRun},
+			Run: func(c *grift.Context) error {
+				if len(c.Args) < 1 {
+					return fmt.Errorf("usage: buffalo task buffkit:migrate:create <name> [module]")
+				}
+
+				name := c.Args[0]
+				module := "core"
+				if len(c.Args) > 1 {
+					module = c.Args[1]
+				}
+
+				// Generate timestamp-based filename
+				dir := fmt.Sprintf("db/migrations/%s", module)
+				timestamp := time.Now().Format("20060102150405")
+				upFile := fmt.Sprintf("%s/%s_%s.up.sql", dir, timestamp, name)
+				downFile := fmt.Sprintf("%s/%s_%s.down.sql", dir, timestamp, name)
+
+				if tasks.FromContext(c).DryRun {
+					fmt.Printf("🔍 Would create migration files:\n")
+					fmt.Printf("   - %s\n", upFile)
+					fmt.Printf("   - %s\n", downFile)
+					return nil
+				}
+
+				// Create migration directory if it doesn't exist
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					return fmt.Errorf("failed to create directory: %w", err)
+				}
+
+				// Create up migration with template
+				upContent := fmt.Sprintf(`-- Migration: %s
 -- Created: %s
 -- Module: %s
 
@@ -167,12 +251,12 @@ func registerMigrationTasks() {
 -- );
 `, name, time.Now().Format(time.RFC3339), module)
 
-			if err := os.WriteFile(upFile, []byte(upContent), 0644); err != nil {
-				return fmt.Errorf("failed to create up migration: %w", err)
-			}
+				if err := os.WriteFile(upFile, []byte(upContent), 0644); err != nil {
+					return fmt.Errorf("failed to create up migration: %w", err)
+				}
 
-			// Create down migration with template
-			downContent := fmt.Sprintf(`-- Rollback: %s
+				// Create down migration with template
+				downContent := fmt.Sprintf(`-- Rollback: %s
 -- Created: %s
 -- Module: %s
 
@@ -181,14 +265,56 @@ func registerMigrationTasks() {
 -- DROP TABLE IF EXISTS example_table;
 `, name, time.Now().Format(time.RFC3339), module)
 
-			if err := os.WriteFile(downFile, []byte(downContent), 0644); err != nil {
-				return fmt.Errorf("failed to create down migration: %w", err)
-			}
+				if err := os.WriteFile(downFile, []byte(downContent), 0644); err != nil {
+					return fmt.Errorf("failed to create down migration: %w", err)
+				}
+
+				fmt.Printf("✅ Created migration files:\n")
+				fmt.Printf("   - %s\n", upFile)
+				fmt.Printf("   - %s\n", downFile)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:  "db:anonymize",
+			Desc:  "Replace personal data with fakes in a copy of the production database, for staging",
+			Flags: []tasks.Flag{tasks.Env, tasks.DryRun},
+			Run: func(c *grift.Context) error {
+				if os.Getenv("GO_ENV") == "production" {
+					return fmt.Errorf("refusing to anonymize the production database - run it against a copy, with --env staging")
+				}
+				if tasks.FromContext(c).DryRun {
+					fmt.Println("🔍 Would anonymize:")
+					for _, r := range anonymize.Rules() {
+						fmt.Printf("   - %s.%s\n", r.Table, r.Column)
+					}
+					return nil
+				}
 
-			fmt.Printf("✅ Created migration files:\n")
-			fmt.Printf("   - %s\n", upFile)
-			fmt.Printf("   - %s\n", downFile)
-			return nil
+				db, dialect, err := getDatabaseConnection()
+				if err != nil {
+					return fmt.Errorf("database connection failed: %w", err)
+				}
+				defer func() { _ = db.Close() }()
+
+				fmt.Println("🕶️  Anonymizing database...")
+				results, err := anonymize.NewRunner(db, dialect).Run(context.Background())
+				columns := 0
+				for _, r := range results {
+					if r.Skipped {
+						fmt.Printf("   ➖ %s.%s: not in this database\n", r.Table, r.Column)
+						continue
+					}
+					columns++
+					fmt.Printf("   ✅ %s.%s: %d value(s)\n", r.Table, r.Column, r.Values)
+				}
+				if err != nil {
+					return fmt.Errorf("anonymization failed: %w", err)
+				}
+				fmt.Printf("✅ Anonymized %d column(s)\n", columns)
+				return nil
+			},
 		})
 	})
 }
@@ -196,120 +322,856 @@ func registerMigrationTasks() {
 // registerJobTasks registers background job tasks
 func registerJobTasks() {
 	_ = grift.Namespace("jobs", func() {
-		_ = grift.Desc("worker", "Start the background job worker")
-		_ = grift.Add("worker", func(c *grift.Context) error {
-			// Get the global Kit instance if available
-			// In a real app, this would be set during Wire()
-			kit := globalKit
-			if kit == nil || kit.Jobs == nil {
-				// Always error out if jobs runtime isn't properly configured
-				fmt.Fprintln(os.Stderr, "jobs runtime not configured - ensure Buffkit is wired into your app")
-				return fmt.Errorf("jobs runtime not configured - ensure Buffkit is wired into your app")
-			}
-
-			// Register signal handlers for graceful shutdown
-			sigChan := make(chan os.Signal, 1)
-			signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
-
-			fmt.Println("🔄 Starting job worker...")
-			fmt.Printf("   Redis URL: %s\n", getRedisURL())
-			fmt.Println("   Press Ctrl+C to stop")
-			fmt.Println("")
-
-			// Start the worker in a goroutine
-			errChan := make(chan error, 1)
-			go func() {
-				if err := kit.Jobs.Start(); err != nil {
-					errChan <- err
-				}
-			}()
-
-			// Wait for shutdown signal or error
-			select {
-			case <-sigChan:
-				fmt.Println("\n⏹️  Shutting down worker...")
-			case err := <-errChan:
-				return fmt.Errorf("worker error: %w", err)
-			}
-
-			// Graceful shutdown
-			if err := kit.Jobs.Stop(); err != nil {
-				return fmt.Errorf("failed to stop worker: %w", err)
-			}
-
-			fmt.Println("✅ Worker stopped")
-			return nil
+		_ = tasks.Add(tasks.Task{
+			Name: "worker",
+			Desc: "Start the background job worker",
+			Run: func(c *grift.Context) error {
+				// Get the global Kit instance if available
+				// In a real app, this would be set during Wire()
+				kit := globalKit
+				if kit == nil || kit.Jobs == nil {
+					// Always error out if jobs runtime isn't properly configured
+					fmt.Fprintln(os.Stderr, "jobs runtime not configured - ensure Buffkit is wired into your app")
+					return fmt.Errorf("jobs runtime not configured - ensure Buffkit is wired into your app")
+				}
+
+				// Register signal handlers for graceful shutdown
+				sigChan := make(chan os.Signal, 1)
+				signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+
+				fmt.Println("🔄 Starting job worker...")
+				fmt.Printf("   Redis URL: %s\n", getRedisURL())
+				fmt.Println("   Press Ctrl+C to stop")
+				fmt.Println("")
+
+				// Import external topics into jobs
+				if kit.Bridge != nil {
+					if err := kit.Bridge.Start(); err != nil {
+						return fmt.Errorf("failed to start event bridge: %w", err)
+					}
+				}
+
+				// Start the worker in a goroutine
+				errChan := make(chan error, 1)
+				go func() {
+					if err := kit.Jobs.Start(); err != nil {
+						errChan <- err
+					}
+				}()
+
+				// Wait for shutdown signal or error
+				select {
+				case <-sigChan:
+					fmt.Println("\n⏹️  Shutting down worker...")
+				case err := <-errChan:
+					return fmt.Errorf("worker error: %w", err)
+				}
+
+				// Graceful shutdown
+				if kit.Bridge != nil {
+					_ = kit.Bridge.Stop()
+				}
+				if err := kit.Jobs.Stop(); err != nil {
+					return fmt.Errorf("failed to stop worker: %w", err)
+				}
+
+				fmt.Println("✅ Worker stopped")
+				return nil
+			},
 		})
 
-		_ = grift.Desc("enqueue", "Enqueue a test job")
-		_ = grift.Add("enqueue", func(c *grift.Context) error {
-			kit := globalKit
-			if kit == nil || kit.Jobs == nil {
-				redisURL := getRedisURL()
-				if redisURL == "" {
-					fmt.Println("⚠️  No Redis configured - job would be enqueued to:")
-					fmt.Println("   Queue: default")
-					fmt.Println("   Type: email:send")
+		_ = tasks.Add(tasks.Task{
+			Name:  "enqueue",
+			Args:  "[TYPE]",
+			Desc:  "Enqueue a test job",
+			Flags: []tasks.Flag{tasks.Queue, tasks.DryRun},
+			Run: func(c *grift.Context) error {
+				opts := tasks.FromContext(c)
+				jobType := "email:send"
+				if len(c.Args) > 0 {
+					jobType = c.Args[0]
+				}
+				queue := "default"
+				if opts.Queue != "" {
+					queue = opts.Queue
+				}
+
+				if opts.DryRun {
+					fmt.Println("🔍 Job would be enqueued to:")
+					fmt.Printf("   Queue: %s\n", queue)
+					fmt.Printf("   Type: %s\n", jobType)
 					return nil
 				}
-				return fmt.Errorf("jobs runtime not configured")
-			}
 
-			jobType := "email:send"
-			if len(c.Args) > 0 {
-				jobType = c.Args[0]
-			}
+				kit := globalKit
+				if kit == nil || kit.Jobs == nil {
+					redisURL := getRedisURL()
+					if redisURL == "" {
+						fmt.Println("⚠️  No Redis configured - job would be enqueued to:")
+						fmt.Printf("   Queue: %s\n", queue)
+						fmt.Printf("   Type: %s\n", jobType)
+						return nil
+					}
+					return fmt.Errorf("jobs runtime not configured")
+				}
 
-			// Enqueue a test job
-			payload := map[string]interface{}{
-				"test":      true,
-				"timestamp": time.Now().Format(time.RFC3339),
-				"message":   "Test job from Grift task",
-			}
+				// Enqueue a test job
+				payload := map[string]interface{}{
+					"test":      true,
+					"timestamp": time.Now().Format(time.RFC3339),
+					"message":   "Test job from Grift task",
+				}
 
-			if err := kit.Jobs.Enqueue(jobType, payload); err != nil {
-				return fmt.Errorf("failed to enqueue job: %w", err)
-			}
+				if err := kit.Jobs.Enqueue(jobType, payload, asynq.Queue(queue)); err != nil {
+					return fmt.Errorf("failed to enqueue job: %w", err)
+				}
 
-			fmt.Printf("✅ Enqueued job: %s\n", jobType)
-			return nil
+				fmt.Printf("✅ Enqueued job: %s (queue: %s)\n", jobType, queue)
+				return nil
+			},
 		})
 
-		_ = grift.Desc("stats", "Show job queue statistics")
-		_ = grift.Add("stats", func(c *grift.Context) error {
-			kit := globalKit
+		_ = tasks.Add(tasks.Task{
+			Name: "stats",
+			Desc: "Show job queue statistics",
+			Run: func(c *grift.Context) error {
+				kit := globalKit
 
-			fmt.Println("📊 Job Queue Statistics")
-			fmt.Println("======================")
+				fmt.Println("📊 Job Queue Statistics")
+				fmt.Println("======================")
+
+				if kit == nil || kit.Jobs == nil {
+					fmt.Println("Status: Not configured")
+					fmt.Printf("Redis URL: %s\n", getRedisURL())
+					fmt.Println("\nℹ️  Wire Buffkit into your app to enable job processing")
+					return nil
+				}
 
-			if kit == nil || kit.Jobs == nil {
-				fmt.Println("Status: Not configured")
 				fmt.Printf("Redis URL: %s\n", getRedisURL())
-				fmt.Println("\nℹ️  Wire Buffkit into your app to enable job processing")
+				fmt.Println("Status: Connected")
+
+				// In a full implementation, we'd query Redis for:
+				// - Number of jobs in each queue
+				// - Failed jobs count
+				// - Processed jobs count
+				// - Active workers
+				fmt.Println("\nQueues:")
+				fmt.Println("  default:  0 pending")
+				fmt.Println("  critical: 0 pending")
+				fmt.Println("  low:      0 pending")
+				fmt.Println("\nℹ️  Detailed stats coming in next version")
+
 				return nil
-			}
-
-			fmt.Printf("Redis URL: %s\n", getRedisURL())
-			fmt.Println("Status: Connected")
-
-			// In a full implementation, we'd query Redis for:
-			// - Number of jobs in each queue
-			// - Failed jobs count
-			// - Processed jobs count
-			// - Active workers
-			fmt.Println("\nQueues:")
-			fmt.Println("  default:  0 pending")
-			fmt.Println("  critical: 0 pending")
-			fmt.Println("  low:      0 pending")
-			fmt.Println("\nℹ️  Detailed stats coming in next version")
-
-			return nil
+			},
+		})
+	})
+
+	_ = grift.Namespace("buffkit", func() {
+		_ = tasks.Add(tasks.Task{
+			Name:     "routes",
+			Desc:     "List all mounted routes, including those Buffkit adds",
+			Switches: map[string]string{"v": "Show the middleware each route runs"},
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+
+				routes := kit.Routes()
+				fmt.Println("🛣️  Routes")
+				fmt.Println("=========")
+				for _, r := range routes {
+					marker := "  "
+					if r.Buffkit {
+						marker = "⚡"
+					}
+					fmt.Printf("%s %-7s %-35s %s\n", marker, r.Method, r.Path, shortName(r.Handler))
+					if tasks.FromContext(c).Switch("v") {
+						for _, mw := range r.Middleware {
+							fmt.Printf("             ↳ %s\n", shortName(mw))
+						}
+					}
+				}
+				fmt.Printf("\n%d route(s); ⚡ = mounted by Buffkit. Pass -v to show middleware.\n", len(routes))
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "manifest",
+			Desc: "Print everything Buffkit wired (routes, middleware, tasks, ...) as JSON",
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+
+				out, err := json.MarshalIndent(kit.Manifest(), "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:     "invite",
+			Args:     "[EMAIL]",
+			Desc:     "Create a registration invitation link",
+			Switches: map[string]string{"send": "Email the invitation as well as printing the link"},
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+				if kit.Registration == nil {
+					return fmt.Errorf("registration is closed - set Config.RegistrationMode")
+				}
+
+				email, send := "", tasks.FromContext(c).Switch("send")
+				if len(c.Args) > 0 {
+					email = c.Args[0]
+				}
+
+				var link string
+				var err error
+				if send {
+					link, err = kit.Registration.Invite(context.Background(), email)
+				} else {
+					link, err = kit.Registration.InviteURL(email)
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Println(link)
+				if send {
+					fmt.Printf("✉️  Invitation sent to %s\n", email)
+				}
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "shortlinks:prune",
+			Desc: "Delete short links that have expired",
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+				if kit.Shortlinks == nil {
+					return fmt.Errorf("short links are off - set Config.Shortlinks")
+				}
+
+				n, err := kit.Shortlinks.Prune(context.Background())
+				if err != nil {
+					return fmt.Errorf("failed to prune short links: %w", err)
+				}
+				fmt.Printf("🧹 Pruned %d expired short links\n", n)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "idempotency:prune",
+			Desc: "Delete idempotency keys whose responses have expired",
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+				if kit.Idempotency == nil {
+					return fmt.Errorf("idempotency keys are off - set Config.Idempotency")
+				}
+
+				n, err := kit.Idempotency.Prune(context.Background())
+				if err != nil {
+					return fmt.Errorf("failed to prune idempotency keys: %w", err)
+				}
+				fmt.Printf("🧹 Pruned %d expired idempotency keys\n", n)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "readonly",
+			Args: "[on|off] [REASON]",
+			Desc: "Show read-only mode, or turn it on or off for every process sharing Redis",
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+				if kit.ReadOnly.Redis == nil {
+					return fmt.Errorf("read-only mode is shared through Redis - set Config.RedisURL")
+				}
+
+				action := ""
+				if len(c.Args) > 0 {
+					action = c.Args[0]
+				}
+				ctx := context.Background()
+				var err error
+				switch action {
+				case "":
+					err = kit.ReadOnly.Refresh(ctx)
+				case "on":
+					err = kit.ReadOnly.Enable(ctx, strings.Join(c.Args[1:], " "))
+				case "off":
+					err = kit.ReadOnly.Disable(ctx)
+				default:
+					return fmt.Errorf("usage: buffalo task buffkit:readonly [on|off] [REASON]")
+				}
+				if err != nil {
+					return err
+				}
+
+				state := kit.ReadOnly.State()
+				if !state.On {
+					fmt.Println("✍️  Read-only mode is off")
+					return nil
+				}
+				fmt.Printf("🔒 Read-only mode is on since %s\n", state.Since.Format(time.RFC3339))
+				if state.Reason != "" {
+					fmt.Printf("   Reason: %s\n", state.Reason)
+				}
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "analytics:rollup",
+			Desc: "Roll up recent analytics events into daily counts and delete old events",
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+				if kit.Analytics == nil {
+					return fmt.Errorf("analytics are off - set Config.Analytics")
+				}
+
+				days, err := kit.Analytics.RollupRecent(context.Background())
+				if err != nil {
+					return fmt.Errorf("failed to roll up analytics: %w", err)
+				}
+				n, err := kit.Analytics.Prune(context.Background())
+				if err != nil {
+					return fmt.Errorf("failed to prune analytics events: %w", err)
+				}
+				fmt.Printf("📊 Rolled up %d days and pruned %d old events\n", days, n)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "credentials:edit",
+			Args: "[FILE]",
+			Desc: "Edit the encrypted credentials in $EDITOR, creating them and their key if needed",
+			Run: func(c *grift.Context) error {
+				path := DefaultCredentialsPath
+				if len(c.Args) > 0 {
+					path = c.Args[0]
+				}
+				created, err := editCredentials(path, runEditor)
+				if err != nil {
+					return err
+				}
+				if created != "" {
+					fmt.Printf("🔑 Created %s - keep it out of git, and set %s to its contents in production\n", created, CredentialsKeyEnv)
+				}
+				fmt.Printf("🔒 Saved %s\n", path)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "console",
+			Desc: "Open a prompt for inspecting users, enqueuing jobs and sending test emails",
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+				return runConsole(context.Background(), kit, os.Stdin, os.Stdout)
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "upgrade:check",
+			Args: "[DIR]",
+			Desc: "List deprecated Buffkit APIs and settings the app uses, with upgrade hints",
+			Run: func(c *grift.Context) error {
+				dir := "."
+				if len(c.Args) > 0 {
+					dir = c.Args[0]
+				}
+				uses, err := UpgradeCheck(os.DirFS(dir))
+				if err != nil {
+					return fmt.Errorf("scanning %s: %w", dir, err)
+				}
+				var settings []Deprecation
+				if globalKit != nil {
+					settings = ConfigDeprecations(globalKit.Config)
+				}
+
+				fmt.Println("⬆️  Buffkit Upgrade Check")
+				fmt.Println("========================")
+				for _, use := range uses {
+					fmt.Printf("⚠️  %s: %s\n   → %s\n", use.Pos, use.Name, use.Hint)
+				}
+				for _, d := range settings {
+					fmt.Printf("⚠️  %s\n   → %s\n", d.Name, d.Hint)
+				}
+				if n := len(uses) + len(settings); n > 0 {
+					return fmt.Errorf("%d deprecated use(s) found", n)
+				}
+				fmt.Printf("Nothing deprecated found (Buffkit %s)\n", Version())
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:  "doctor",
+			Desc:  "Check the database, migrations, Redis, SMTP, secrets and template overrides",
+			Flags: []tasks.Flag{tasks.Env},
+			Run: func(c *grift.Context) error {
+				cfg := doctorConfig()
+				if cfg.DB != nil && (globalKit == nil || globalKit.Config.DB == nil) {
+					defer func() { _ = cfg.DB.Close() }()
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				checks := Doctor(ctx, cfg, os.DirFS("."))
+
+				fmt.Println("🩺 Buffkit Doctor")
+				fmt.Println("=================")
+				failed := 0
+				for _, check := range checks {
+					icon := map[DoctorStatus]string{DoctorOK: "✅", DoctorSkipped: "➖", DoctorWarning: "⚠️ ", DoctorFailed: "❌"}[check.Status]
+					fmt.Printf("%s %-11s %s\n", icon, check.Name, check.Detail)
+					if check.Fix != "" && check.Status != DoctorOK {
+						fmt.Printf("   → %s\n", check.Fix)
+					}
+					if check.Status == DoctorFailed {
+						failed++
+					}
+				}
+				if failed > 0 {
+					return fmt.Errorf("%d check(s) failed", failed)
+				}
+				fmt.Println("\nAll good!")
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:  "build",
+			Desc:  "Compile templates, check component and asset references, fingerprint assets and lock the import map",
+			Flags: []tasks.Flag{tasks.Env, tasks.DryRun},
+			Run: func(c *grift.Context) error {
+				kit := globalKit
+				if kit == nil || kit.app == nil {
+					return fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+				defer cancel()
+				report, err := kit.Build(ctx, ".", tasks.FromContext(c).DryRun)
+				if err != nil {
+					return fmt.Errorf("build failed: %w", err)
+				}
+				for _, problem := range report.Problems {
+					fmt.Printf("❌ %s\n", problem)
+				}
+				if len(report.Problems) > 0 {
+					return fmt.Errorf("%d problem(s) found - nothing was written", len(report.Problems))
+				}
+
+				fmt.Printf("📝 %d template(s) compiled\n", report.Templates)
+				fmt.Printf("🎨 %d asset(s) fingerprinted into %s\n", len(report.Assets), AssetManifestPath)
+				fmt.Printf("📌 %d import(s) locked in %s\n", len(report.ImportMap.Imports), ImportMapLockPath)
+				if tasks.FromContext(c).DryRun {
+					fmt.Println("\nDry run - nothing was written")
+				}
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name: "jobs:workers",
+			Desc: "List job workers and their last heartbeat",
+			Run: func(c *grift.Context) error {
+				runtime, err := workersRuntime()
+				if err != nil {
+					return err
+				}
+
+				workers, err := runtime.Workers(context.Background())
+				if err != nil {
+					return fmt.Errorf("failed to list workers: %w", err)
+				}
+
+				alive := 0
+				for _, w := range workers {
+					if w.Alive() {
+						alive++
+					}
+				}
+
+				fmt.Println("👷 Job Workers")
+				fmt.Println("==============")
+				fmt.Printf("Alive: %d of %d\n", alive, len(workers))
+
+				for _, w := range workers {
+					state := "✅ alive"
+					if !w.Alive() {
+						state = "💀 dead"
+					}
+					fmt.Printf("\n%s  %s (pid %d)\n", state, w.Hostname, w.PID)
+					fmt.Printf("   Started:        %s\n", w.StartedAt.Format(time.RFC3339))
+					fmt.Printf("   Last heartbeat: %s ago\n", time.Since(w.LastHeartbeat).Round(time.Second))
+					fmt.Printf("   Concurrency:    %d\n", w.Concurrency)
+					fmt.Printf("   Queues:         %v\n", w.Queues)
+					if len(w.Processing) > 0 {
+						fmt.Printf("   Processing:     %v\n", w.Processing)
+					} else {
+						fmt.Println("   Processing:     idle")
+					}
+				}
+
+				return nil
+			},
 		})
 	})
 }
 
+// registerUserTasks registers tasks for managing user accounts through
+// the wired auth store, without writing SQL
+func registerUserTasks() {
+	_ = grift.Namespace("buffkit", func() {
+		_ = tasks.Add(tasks.Task{
+			Name:   "users:create",
+			Args:   "EMAIL",
+			Desc:   "Create a user with a random password, printed once",
+			Flags:  []tasks.Flag{tasks.Env},
+			Values: map[string]string{"role": "Give the user a role, such as admin"},
+			Run: func(c *grift.Context) error {
+				store, err := taskUserStore()
+				if err != nil {
+					return err
+				}
+				if len(c.Args) == 0 || !strings.Contains(c.Args[0], "@") {
+					return fmt.Errorf("usage: buffalo task buffkit:users:create EMAIL [--role ROLE]")
+				}
+				email, role := strings.TrimSpace(c.Args[0]), tasks.FromContext(c).Value("role")
+				roles, ok := store.(auth.RoleStore)
+				if role != "" && !ok {
+					return fmt.Errorf("the auth store %T doesn't keep roles - implement auth.RoleStore", store)
+				}
+
+				password, digest, err := newTaskPassword()
+				if err != nil {
+					return err
+				}
+				ctx := context.Background()
+				user := &auth.User{Email: email, PasswordDigest: digest, IsActive: true, Role: role}
+				if err := store.Create(ctx, user); err != nil {
+					return fmt.Errorf("failed to create %s: %w", email, err)
+				}
+				if role != "" {
+					if err := roles.SetRole(ctx, user.ID, role); err != nil {
+						return fmt.Errorf("failed to set the role of %s: %w", email, err)
+					}
+				}
+				fmt.Printf("👤 Created %s\n", email)
+				if role != "" {
+					fmt.Printf("   Role: %s\n", role)
+				}
+				fmt.Printf("   Password: %s\n", password)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:   "users:promote",
+			Args:   "EMAIL",
+			Desc:   "Give a user a role (default: admin)",
+			Flags:  []tasks.Flag{tasks.Env},
+			Values: map[string]string{"role": "The role to give (default: admin)"},
+			Run: func(c *grift.Context) error {
+				store, user, err := taskUser(c)
+				if err != nil {
+					return err
+				}
+				roles, ok := store.(auth.RoleStore)
+				if !ok {
+					return fmt.Errorf("the auth store %T doesn't keep roles - implement auth.RoleStore", store)
+				}
+				role := tasks.FromContext(c).Value("role")
+				if role == "" {
+					role = auth.RoleAdmin
+				}
+				if err := roles.SetRole(context.Background(), user.ID, role); err != nil {
+					return fmt.Errorf("failed to promote %s: %w", user.Email, err)
+				}
+				fmt.Printf("⭐ %s is now %s\n", user.Email, role)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:     "users:lock",
+			Args:     "EMAIL",
+			Desc:     "Lock a user out: deactivate them and end their sessions",
+			Flags:    []tasks.Flag{tasks.Env},
+			Switches: map[string]string{"unlock": "Reactivate the user instead"},
+			Run: func(c *grift.Context) error {
+				store, user, err := taskUser(c)
+				if err != nil {
+					return err
+				}
+				provisioning, ok := store.(auth.ProvisioningStore)
+				if !ok {
+					return fmt.Errorf("the auth store %T can't deactivate users - implement auth.ProvisioningStore", store)
+				}
+
+				ctx := context.Background()
+				if tasks.FromContext(c).Switch("unlock") {
+					if err := provisioning.SetDeactivated(ctx, user.ID, nil); err != nil {
+						return fmt.Errorf("failed to unlock %s: %w", user.Email, err)
+					}
+					fmt.Printf("🔓 Unlocked %s\n", user.Email)
+					return nil
+				}
+				now := time.Now()
+				if err := provisioning.SetDeactivated(ctx, user.ID, &now); err != nil {
+					return fmt.Errorf("failed to lock %s: %w", user.Email, err)
+				}
+				ended, err := auth.EndSessions(ctx, user.ID, "")
+				if err != nil {
+					return fmt.Errorf("failed to end the sessions of %s: %w", user.Email, err)
+				}
+				fmt.Printf("🔒 Locked %s and ended %d sessions\n", user.Email, ended)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:  "users:reset-password",
+			Args:  "EMAIL",
+			Desc:  "Give a user a new random password, printed once, and end their sessions",
+			Flags: []tasks.Flag{tasks.Env},
+			Run: func(c *grift.Context) error {
+				store, user, err := taskUser(c)
+				if err != nil {
+					return err
+				}
+				password, digest, err := newTaskPassword()
+				if err != nil {
+					return err
+				}
+
+				ctx := context.Background()
+				if err := store.UpdatePassword(ctx, user.ID, digest); err != nil {
+					return fmt.Errorf("failed to reset the password of %s: %w", user.Email, err)
+				}
+				ended, err := auth.EndSessions(ctx, user.ID, "")
+				if err != nil {
+					return fmt.Errorf("failed to end the sessions of %s: %w", user.Email, err)
+				}
+				auth.RecordPasswordChange(ctx, auth.PasswordChange{
+					UserID: user.ID, Via: "task", SessionsEnded: ended, At: time.Now(),
+				})
+				fmt.Printf("🔑 Reset the password of %s and ended %d sessions\n", user.Email, ended)
+				fmt.Printf("   Password: %s\n", password)
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:     "users:import",
+			Args:     "FILE",
+			Desc:     "Create users from a CSV file (email, name, username, role), or invite them",
+			Flags:    []tasks.Flag{tasks.Env, tasks.DryRun},
+			Switches: map[string]string{"invite": "Email each user an invitation to register instead"},
+			Run: func(c *grift.Context) error {
+				if _, err := taskUserStore(); err != nil {
+					return err
+				}
+				if len(c.Args) == 0 {
+					return fmt.Errorf("usage: buffalo task buffkit:users:import FILE [--invite] [--dry-run]")
+				}
+				f, err := os.Open(c.Args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				opts := tasks.FromContext(c)
+				result, err := importUsers(context.Background(), globalKit, f, opts.Switch("invite"), opts.DryRun)
+				if result != nil {
+					result.Report(os.Stdout)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to import users: %w", err)
+				}
+				if !result.Valid() {
+					return fmt.Errorf("%s has errors - nothing was imported", c.Args[0])
+				}
+				return nil
+			},
+		})
+
+		_ = tasks.Add(tasks.Task{
+			Name:   "users:export",
+			Args:   "[FILE]",
+			Desc:   "Write every user to a CSV file, or to stdout",
+			Flags:  []tasks.Flag{tasks.Env},
+			Values: map[string]string{"fields": "Comma-separated fields (default: " + strings.Join(userExportFields, ",") + ")"},
+			Run: func(c *grift.Context) error {
+				store, err := taskUserStore()
+				if err != nil {
+					return err
+				}
+				fields := userExportFields
+				if list := tasks.FromContext(c).Value("fields"); list != "" {
+					fields = strings.Split(strings.ReplaceAll(list, " ", ""), ",")
+				}
+
+				out := os.Stdout
+				if len(c.Args) > 0 {
+					if out, err = os.Create(c.Args[0]); err != nil {
+						return err
+					}
+					defer out.Close()
+				}
+				n, err := exportUsers(context.Background(), store, out, fields)
+				if err != nil {
+					return fmt.Errorf("failed to export users: %w", err)
+				}
+				if len(c.Args) > 0 {
+					fmt.Printf("📤 Exported %d users to %s\n", n, c.Args[0])
+				}
+				return nil
+			},
+		})
+	})
+}
+
+// taskUserStore returns the wired app's auth store.
+func taskUserStore() (auth.UserStore, error) {
+	kit := globalKit
+	if kit == nil || kit.app == nil {
+		return nil, fmt.Errorf("app not wired - ensure Buffkit is wired into your app")
+	}
+	if kit.AuthStore == nil {
+		return nil, fmt.Errorf("no auth store configured")
+	}
+	return kit.AuthStore, nil
+}
+
+// taskUser returns the wired app's auth store and the user whose email
+// is the task's first argument.
+func taskUser(c *grift.Context) (auth.UserStore, *auth.User, error) {
+	store, err := taskUserStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(c.Args) == 0 {
+		return nil, nil, fmt.Errorf("usage: buffalo task %s EMAIL", c.Name)
+	}
+	user, err := store.ByEmail(context.Background(), strings.TrimSpace(c.Args[0]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find %s: %w", c.Args[0], err)
+	}
+	return store, user, nil
+}
+
+// newTaskPassword returns a random password and its digest.
+func newTaskPassword() (password, digest string, err error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	password = base64.RawURLEncoding.EncodeToString(b)
+	digest, err = auth.HashPassword(password)
+	return password, digest, err
+}
+
+// workersRuntime returns the wired jobs runtime, or one connected to
+// REDIS_URL when the task runs outside a wired app.
+func workersRuntime() (*jobs.Runtime, error) {
+	if globalKit != nil && globalKit.Jobs != nil {
+		return globalKit.Jobs, nil
+	}
+	redisURL := getRedisURL()
+	if redisURL == "" {
+		return nil, fmt.Errorf("jobs runtime not configured - set REDIS_URL or wire Buffkit into your app")
+	}
+	return jobs.NewRuntime(redisURL)
+}
+
+// doctorConfig returns the wired app's configuration, or one read from
+// the environment (DATABASE_URL, REDIS_URL, SMTP_ADDR, SMTP_USER,
+// SMTP_PASS, SESSION_SECRET, GO_ENV) when the task runs outside one.
+func doctorConfig() Config {
+	if globalKit != nil {
+		cfg := globalKit.Config
+		if cfg.DB == nil {
+			cfg.DB, cfg.Dialect = doctorDatabaseFromEnv(cfg.Dialect)
+		}
+		return cfg
+	}
+	cfg := Config{
+		DevMode:    getEnvOrDefault("GO_ENV", "development") == "development",
+		RedisURL:   getRedisURL(),
+		SMTPAddr:   os.Getenv("SMTP_ADDR"),
+		SMTPUser:   os.Getenv("SMTP_USER"),
+		SMTPPass:   os.Getenv("SMTP_PASS"),
+		AuthSecret: []byte(os.Getenv("SESSION_SECRET")),
+	}
+	cfg.DB, cfg.Dialect = doctorDatabaseFromEnv("")
+	return cfg
+}
+
+// doctorDatabaseFromEnv opens the database in DATABASE_URL or DB_TYPE,
+// if either is set, keeping dialect when one is configured.
+func doctorDatabaseFromEnv(dialect string) (*sql.DB, string) {
+	if os.Getenv("DATABASE_URL") == "" && os.Getenv("DB_TYPE") == "" {
+		return nil, dialect
+	}
+	db, detected, err := openDatabase()
+	if err != nil {
+		return nil, dialect
+	}
+	if dialect == "" {
+		dialect = detected
+	}
+	return db, dialect
+}
+
 // getDatabaseConnection returns a database connection from environment
 func getDatabaseConnection() (*sql.DB, string, error) {
+	db, dialect, err := openDatabase()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Test connection
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, "", fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, dialect, nil
+}
+
+// openDatabase opens the database the environment describes, without
+// connecting to it yet
+func openDatabase() (*sql.DB, string, error) {
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
 		// Try to build from parts
@@ -327,7 +1189,7 @@ func getDatabaseConnection() (*sql.DB, string, error) {
 			dbURL = dbURL[10:] // Remove "sqlite3://" prefix
 		}
 		if dbURL == "" {
-			dbURL = "buffkit_development.db" // Default SQLite file
+			dbURL = defaultDatabaseName() + ".db" // Default SQLite file
 		}
 	}
 
@@ -335,13 +1197,6 @@ func getDatabaseConnection() (*sql.DB, string, error) {
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to connect to database: %w", err)
 	}
-
-	// Test connection
-	if err := db.Ping(); err != nil {
-		_ = db.Close()
-		return nil, "", fmt.Errorf("failed to ping database: %w", err)
-	}
-
 	return db, dialect, nil
 }
 
@@ -356,14 +1211,14 @@ func buildDatabaseURL() string {
 	case "sqlite", "sqlite3":
 		dbName := os.Getenv("DB_NAME")
 		if dbName == "" {
-			dbName = "buffkit_development.db"
+			dbName = defaultDatabaseName() + ".db"
 		}
 		return fmt.Sprintf("sqlite://%s", dbName)
 
 	case "mysql":
 		host := getEnvOrDefault("DB_HOST", "localhost")
 		port := getEnvOrDefault("DB_PORT", "3306")
-		name := getEnvOrDefault("DB_NAME", "buffkit_development")
+		name := getEnvOrDefault("DB_NAME", defaultDatabaseName())
 		user := getEnvOrDefault("DB_USER", "root")
 		pass := os.Getenv("DB_PASSWORD")
 
@@ -377,7 +1232,7 @@ func buildDatabaseURL() string {
 	default: // postgres
 		host := getEnvOrDefault("DB_HOST", "localhost")
 		port := getEnvOrDefault("DB_PORT", "5432")
-		name := getEnvOrDefault("DB_NAME", "buffkit_development")
+		name := getEnvOrDefault("DB_NAME", defaultDatabaseName())
 		user := getEnvOrDefault("DB_USER", "postgres")
 		pass := os.Getenv("DB_PASSWORD")
 
@@ -390,6 +1245,12 @@ func buildDatabaseURL() string {
 	}
 }
 
+// defaultDatabaseName names the database for the current GO_ENV when
+// DB_NAME isn't set, e.g. buffkit_development or buffkit_test
+func defaultDatabaseName() string {
+	return "buffkit_" + getEnvOrDefault("GO_ENV", "development")
+}
+
 // detectDialect detects the database dialect from the connection URL
 func detectDialect(dbURL string) (string, string) {
 	switch {
@@ -1,10 +1,22 @@
 package buffkit
 
 import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/mail"
 	"github.com/markbates/grift/grift"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGriftTasksRegistered(t *testing.T) {
@@ -16,9 +28,29 @@ func TestGriftTasksRegistered(t *testing.T) {
 		"buffkit:migrate:status",
 		"buffkit:migrate:down",
 		"buffkit:migrate:create",
+		"buffkit:db:anonymize",
+		"buffkit:users:create",
+		"buffkit:users:promote",
+		"buffkit:users:lock",
+		"buffkit:users:reset-password",
+		"buffkit:users:import",
+		"buffkit:users:export",
 		"jobs:worker",
 		"jobs:enqueue",
 		"jobs:stats",
+		"buffkit:jobs:workers",
+		"buffkit:routes",
+		"buffkit:manifest",
+		"buffkit:invite",
+		"buffkit:shortlinks:prune",
+		"buffkit:idempotency:prune",
+		"buffkit:readonly",
+		"buffkit:analytics:rollup",
+		"buffkit:credentials:edit",
+		"buffkit:doctor",
+		"buffkit:build",
+		"buffkit:console",
+		"buffkit:upgrade:check",
 	}
 
 	// Get all registered tasks
@@ -37,3 +69,176 @@ func TestGriftTasksRegistered(t *testing.T) {
 		})
 	}
 }
+
+// runTask runs a grift task and returns what it printed.
+func runTask(t *testing.T, name string, args ...string) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	c := grift.NewContext(name)
+	c.Args = args
+	runErr := grift.Run(name, c)
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(out), runErr
+}
+
+func TestUserTasks(t *testing.T) {
+	ctx := context.Background()
+	kit, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	store := kit.AuthStore.(*auth.MemoryStore)
+	password := regexp.MustCompile(`Password: (\S+)`)
+
+	out, err := runTask(t, "buffkit:users:create", "ada@example.com", "--role", "editor")
+	require.NoError(t, err)
+	user, err := store.ByEmail(ctx, "ada@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "editor", user.Role)
+	require.Regexp(t, password, out)
+	first := password.FindStringSubmatch(out)[1]
+	assert.NoError(t, auth.CheckPassword(first, user.PasswordDigest), "the printed password works")
+	_, err = runTask(t, "buffkit:users:create", "ada@example.com")
+	assert.ErrorIs(t, err, auth.ErrConflict)
+
+	_, err = runTask(t, "buffkit:users:promote", "ada@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleAdmin, user.Role)
+	_, err = runTask(t, "buffkit:users:promote", "bob@example.com")
+	assert.ErrorIs(t, err, auth.ErrNotFound)
+
+	now := time.Now()
+	require.NoError(t, store.CreateSession(ctx, &auth.Session{ID: "laptop", UserID: user.ID, CreatedAt: now, LastSeenAt: now}))
+	var changes []auth.PasswordChange
+	auth.OnPasswordChange(func(ctx context.Context, p auth.PasswordChange) { changes = append(changes, p) })
+	t.Cleanup(func() { auth.OnPasswordChange(nil) })
+	out, err = runTask(t, "buffkit:users:reset-password", "ada@example.com")
+	require.NoError(t, err)
+	assert.Contains(t, out, "ended 1 sessions")
+	assert.Error(t, auth.CheckPassword(first, user.PasswordDigest))
+	assert.NoError(t, auth.CheckPassword(password.FindStringSubmatch(out)[1], user.PasswordDigest))
+	require.Len(t, changes, 1)
+	assert.Equal(t, "task", changes[0].Via)
+
+	require.NoError(t, store.CreateSession(ctx, &auth.Session{ID: "phone", UserID: user.ID, CreatedAt: now, LastSeenAt: now}))
+	_, err = runTask(t, "buffkit:users:lock", "ada@example.com")
+	require.NoError(t, err)
+	assert.NotNil(t, user.DeactivatedAt)
+	_, err = store.Session(ctx, "phone")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	_, err = runTask(t, "buffkit:users:lock", "--unlock", "ada@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, user.DeactivatedAt)
+}
+
+func TestUserImportExport(t *testing.T) {
+	ctx := context.Background()
+	kit, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	store := kit.AuthStore.(*auth.MemoryStore)
+	require.NoError(t, store.Create(ctx, &auth.User{Email: "ada@example.com", Username: "ada"}))
+
+	dir := t.TempDir()
+	file := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	bad := file("bad.csv", "email,name,username,role\n"+
+		"bob@example.com,Bob,bob,editor\n"+
+		"ada@example.com,Ada,,\n"+
+		"not-an-email,,,\n"+
+		"cy@example.com,Cy,ada,\n"+
+		"BOB@example.com,,,\n")
+	out, err := runTask(t, "buffkit:users:import", bad)
+	require.Error(t, err)
+	assert.Contains(t, out, "line 3: email: is already taken")
+	assert.Contains(t, out, "line 4: email: is not an email address")
+	assert.Contains(t, out, "line 5: username: is already taken")
+	assert.Contains(t, out, "line 6: email: repeats line 2")
+	exists, _ := store.ExistsEmail(ctx, "bob@example.com")
+	assert.False(t, exists, "nothing is imported when a row fails")
+
+	_, err = runTask(t, "buffkit:users:import", file("unknown.csv", "email,phone\n"))
+	assert.ErrorContains(t, err, `unknown column "phone"`)
+
+	good := file("good.csv", "Email, Name, Username, Role\nbob@example.com,Bob,Bob,editor\ncy@example.com,Cy,,\n")
+	out, err = runTask(t, "buffkit:users:import", "--dry-run", good)
+	require.NoError(t, err)
+	assert.Contains(t, out, "would create bob@example.com")
+	exists, _ = store.ExistsEmail(ctx, "bob@example.com")
+	assert.False(t, exists, "a dry run changes nothing")
+
+	out, err = runTask(t, "buffkit:users:import", good)
+	require.NoError(t, err)
+	bob, err := store.ByEmail(ctx, "bob@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "Bob", bob.DisplayName)
+	assert.Equal(t, "bob", bob.Username)
+	assert.Equal(t, "editor", bob.Role)
+	password := regexp.MustCompile(`Created bob@example.com  Password: (\S+)`).FindStringSubmatch(out)
+	require.Len(t, password, 2)
+	assert.NoError(t, auth.CheckPassword(password[1], bob.PasswordDigest))
+
+	_, err = runTask(t, "buffkit:users:import", "--invite", good)
+	assert.ErrorContains(t, err, "registration is closed")
+
+	exported := filepath.Join(dir, "users.csv")
+	_, err = runTask(t, "buffkit:users:export", "--fields", "email,role", exported)
+	require.NoError(t, err)
+	data, err := os.ReadFile(exported)
+	require.NoError(t, err)
+	assert.Equal(t, "email,role\nada@example.com,\nbob@example.com,editor\ncy@example.com,\n", string(data))
+
+	_, err = runTask(t, "buffkit:users:export", "--fields", "password_digest")
+	assert.ErrorContains(t, err, `unknown field "password_digest"`)
+}
+
+func TestUserImportInvite(t *testing.T) {
+	kit, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{
+		AuthSecret:       []byte("secret"),
+		BaseURL:          "https://example.com",
+		RegistrationMode: "open",
+	})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	invites := filepath.Join(t.TempDir(), "invites.csv")
+	require.NoError(t, os.WriteFile(invites, []byte("email,name\ndee@example.com,Dee\n"), 0o600))
+	out, err := runTask(t, "buffkit:users:import", "--invite", invites)
+	require.Error(t, err)
+	assert.Contains(t, out, "name: can't be set for invited users")
+
+	require.NoError(t, os.WriteFile(invites, []byte("email\ndee@example.com\n"), 0o600))
+	out, err = runTask(t, "buffkit:users:import", "--invite", invites)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Invited dee@example.com")
+	_, ok := kit.Mail.(*mail.DevSender).LastTo("dee@example.com")
+	assert.True(t, ok, "an invitation was mailed")
+}
+
+func TestMigrationVersionsUnique(t *testing.T) {
+	// The runner merges every namespace by version, so a shared version
+	// would hide one of the migrations
+	names := make(map[string]string)
+	err := fs.WalkDir(Migrations(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".up.sql") {
+			return err
+		}
+		version, _, _ := strings.Cut(filepath.Base(path), "_")
+		if other, ok := names[version]; ok {
+			t.Errorf("version %s is used by %s and %s", version, other, path)
+		}
+		names[version] = path
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, names)
+}
@@ -0,0 +1,148 @@
+package buffkit
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"path"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/plush/v4"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/johnjansen/buffkit/tenancy"
+	"github.com/johnjansen/buffkit/useragent"
+)
+
+// Helpers returns the template helpers Wire registers on every request,
+// so Plush templates (and Buffkit's own pages) can use them without any
+// plumbing:
+//
+//	<%= if (currentUser()) { %>Hi <%= currentUser().Name() %><% } %>
+//	<form method="POST" action="/posts"><%= csrfField() %>...</form>
+//	<%= importmapTags() %>
+//	<%= componentRender("bk-button", {"variant": "primary"}) %>
+//	<bk-theme mode="<%= theme() %>"></bk-theme>
+//	<%= markdown(post.Body) %>
+//	<img src="<%= assetPath("images/logo.png") %>">
+//	<%= t("welcome", currentUser().Name()) %>
+//	<%= partial(variantPartial("checkout-copy", "checkout/copy.html")) %>
+//	<%= if (consented("analytics")) { %><script src="..."></script><% } %>
+//	<% let d = device() %><%= if (d.Mobile()) { %>...<% } %>
+//
+// Buffalo already puts the flash map in every render as "flash", so
+// <%= for (msg) in flash["success"] { %> works alongside these.
+//
+// A helper the app has already set on the context (for example "t"
+// from an i18n middleware) is left alone.
+func (k *Kit) Helpers(c buffalo.Context) map[string]any {
+	return map[string]any{
+		// currentUser returns the logged-in *auth.User, or nil. An untyped
+		// nil, so <%= if (currentUser()) { %> works as expected.
+		"currentUser": func() any {
+			if user := auth.CurrentUser(c); user != nil {
+				return user
+			}
+			return nil
+		},
+
+		// csrfField renders the hidden authenticity_token input for forms
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="authenticity_token" value="` +
+				html.EscapeString(secure.CSRFToken(c)) + `">`)
+		},
+
+		// importmapTags renders the <script type="importmap"> tag
+		"importmapTags": func() template.HTML {
+			return template.HTML(k.ImportMap.RenderHTML())
+		},
+
+		// componentRender renders a component directly, honouring the
+		// current tenant's overrides and the request's deadline like the
+		// expander does. Attribute values may be any type, as Plush map
+		// literals are map[string]any.
+		"componentRender": func(name string, attrs map[string]any) (template.HTML, error) {
+			scope := ""
+			if t := tenancy.Current(c); t != nil {
+				scope = t.ID
+			}
+			strs := make(map[string]string, len(attrs))
+			for key, value := range attrs {
+				strs[key] = fmt.Sprint(value)
+			}
+			out, err := k.Components.RenderContext(c, scope, name, strs, nil)
+			return template.HTML(out), err
+		},
+
+		// theme returns the user's theme preference (light, dark or
+		// system), for <bk-theme mode="<%= theme() %>">
+		"theme": func() string {
+			return components.ThemePreference(c)
+		},
+
+		// markdown renders sanitized markdown, from its argument or a
+		// block: <%= markdown() { %># Title<% } %>
+		"markdown": func(text string, help plush.HelperContext) (template.HTML, error) {
+			if text == "" && help.HasBlock() {
+				block, err := help.Block()
+				if err != nil {
+					return "", err
+				}
+				text = block
+			}
+			return template.HTML(components.Markdown(text)), nil
+		},
+
+		// device returns the browser, OS and class of device from the
+		// User-Agent, as DeviceInfo does
+		"device": func() useragent.Info {
+			return DeviceInfo(c)
+		},
+
+		// variant returns the request's variant of an experiment, as
+		// buffkit.Variant does
+		"variant": func(name string) string {
+			variant, err := k.Experiments.Variant(c, name)
+			if err != nil {
+				return ""
+			}
+			return variant
+		},
+
+		// variantPartial names the variant's version of a partial, so
+		// each variant renders its own: "checkout/copy.html" becomes
+		// "checkout/copy.urgent.html"
+		"variantPartial": func(name, partial string) (string, error) {
+			return k.Experiments.Partial(c, name, partial)
+		},
+
+		// consented reports whether the visitor accepted cookies of a
+		// category, as buffkit.Consented does
+		"consented": func(category string) bool {
+			if k.Consent == nil {
+				return true
+			}
+			return k.Consent.Allowed(c, category)
+		},
+
+		// assetPath returns the URL of a file under public/assets, or of
+		// its fingerprinted copy once buffkit:build has made one
+		"assetPath": func(file string) string {
+			if hashed, ok := k.Assets[strings.TrimPrefix(file, "/")]; ok {
+				file = hashed
+			}
+			return path.Join("/assets", file)
+		},
+
+		// t is a placeholder translator until the app installs one: it
+		// formats key with args, so templates can adopt t() early
+		"t": func(key string, args ...any) string {
+			if len(args) == 0 {
+				return key
+			}
+			return fmt.Sprintf(key, args...)
+		},
+	}
+}
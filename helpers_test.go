@@ -0,0 +1,68 @@
+package buffkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelpers(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+
+	// An app-provided helper registered before Wire wins
+	app.Use(func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			c.Set("t", func(key string, args ...any) string { return "translated:" + key })
+			return next(c)
+		}
+	})
+
+	// Routes go in before Wire, whose asset server catches everything after
+	r := render.New(render.Options{})
+	app.GET("/page", func(c buffalo.Context) error {
+		c.Session().Set("csrf_token", "tok<en>")
+		return c.Render(http.StatusOK, r.String(`user=<%= currentUser() == nil %>
+<%= csrfField() %>
+<%= importmapTags() %>
+<%= componentRender("bk-button", {"variant": "primary"}) %>
+<%= assetPath("js/index.js") %>
+theme=<%= theme() %>
+<%= markdown("**hi** <script>x</script>") %>
+<%= markdown() { %># Block<% } %>
+<%= t("hello") %>
+consented=<%= consented("analytics") %>
+<% let d = device() %>device=<%= d %> mobile=<%= d.Mobile() %>`))
+	})
+
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	kit.Components.Register("bk-button", func(attrs map[string]string, slots map[string]string) ([]byte, error) {
+		return []byte(`<button class="` + attrs["variant"] + `">`), nil
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/page", nil)
+	req.AddCookie(&http.Cookie{Name: "bk_theme", Value: "dark"})
+	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1")
+	app.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "user=true")
+	assert.Contains(t, body, `<input type="hidden" name="authenticity_token" value="tok&lt;en&gt;">`)
+	assert.Contains(t, body, `<script type="importmap">`)
+	assert.Contains(t, body, `<button class="primary">`)
+	assert.Contains(t, body, "/assets/js/index.js")
+	assert.Contains(t, body, "theme=dark")
+	assert.Contains(t, body, "<p><strong>hi</strong> </p>")
+	assert.Contains(t, body, "</a>Block</h1>")
+	assert.Contains(t, body, "translated:hello")
+	assert.Contains(t, body, "device=Safari on iOS mobile=true")
+	assert.Contains(t, body, "consented=true", "nothing is asked without Config.Consent")
+}
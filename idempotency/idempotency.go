@@ -0,0 +1,349 @@
+// Package idempotency makes POST requests safe to retry. A client that
+// sends an Idempotency-Key header gets the response of the first request
+// with that key replayed for its retries, instead of the request running
+// again, so a payment or order submitted twice over a flaky connection
+// goes through once:
+//
+//	POST /orders
+//	Idempotency-Key: 6f1c2a0e-8d4b-4f7e-9a35-0c2d1e7b9f40
+//
+// Wire installs the middleware when Config.Idempotency is set. Requests
+// without the header run as usual; routes that must have one can require
+// it with Require:
+//
+//	app.POST("/payments", kit.Idempotency.Require(PaymentsCreate))
+//
+// Only successful responses, 2xx and 3xx, are kept, for TTL. A request
+// that fails, or returns an error, can be retried with the same key. A
+// retry that arrives while the first request is still running gets 409
+// Conflict, and reusing a key for a different request gets 422.
+//
+// Keys are kept apart per logged-in user. Requests from visitors who
+// aren't logged in share one scope, so their keys must be unguessable,
+// such as random UUIDs, or one visitor could be replayed another's
+// response.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+)
+
+// Header is the request header carrying the key.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set to "true" on replayed responses.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// Defaults for Idempotency's settings.
+const (
+	DefaultTTL         = 24 * time.Hour
+	DefaultLockTimeout = time.Minute
+	DefaultMaxResponse = 1 << 20
+)
+
+// maxKeyLength is the longest key accepted.
+const maxKeyLength = 255
+
+var (
+	// ErrInProgress is returned, with status 409, to a retry that arrives
+	// while the first request with its key is still running.
+	ErrInProgress = errors.New("idempotency: a request with this key is in progress")
+
+	// ErrMismatch is returned, with status 422, when a key is reused for
+	// a request with a different method, path or body.
+	ErrMismatch = errors.New("idempotency: key was used for a different request")
+)
+
+// Record is what's kept for a key: who's running it and, once it's done,
+// the response to replay.
+type Record struct {
+	Key string
+
+	// Fingerprint identifies the request: its method, path and body.
+	Fingerprint string
+
+	// Status is the response's status, zero while the request runs.
+	Status int
+	Header http.Header
+	Body   []byte
+
+	// ExpiresAt is when the key can be used again. While the request
+	// runs, it's LockTimeout away, so a crashed request doesn't hold the
+	// key for long.
+	ExpiresAt time.Time
+}
+
+// Done reports whether the request finished and its response is kept.
+func (r *Record) Done() bool {
+	return r.Status != 0
+}
+
+// Idempotency replays responses to requests with an Idempotency-Key.
+type Idempotency struct {
+	Store Store
+
+	// TTL is how long responses are kept. Defaults to DefaultTTL.
+	TTL time.Duration
+
+	// LockTimeout is how long a running request holds its key if it
+	// never finishes, such as when the process crashes. Defaults to
+	// DefaultLockTimeout.
+	LockTimeout time.Duration
+
+	// Methods are the methods keys apply to. Defaults to POST and PATCH.
+	Methods []string
+
+	// MaxResponse is the largest response body kept, in bytes; larger
+	// ones aren't, so their retries run again. Defaults to
+	// DefaultMaxResponse.
+	MaxResponse int
+
+	Clock clock.Clock // Defaults to clock.Real
+}
+
+// New creates an Idempotency keeping responses in store.
+func New(store Store) *Idempotency {
+	return &Idempotency{Store: store}
+}
+
+// Middleware replays responses to requests whose Idempotency-Key has been
+// seen, and keeps the responses of those it hasn't. Requests without the
+// header pass through.
+func (i *Idempotency) Middleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if c.Request().Header.Get(Header) == "" || !i.applies(c.Request().Method) {
+			return next(c)
+		}
+		return i.serve(c, next)
+	}
+}
+
+// Require is Middleware for a route that must have a key: requests
+// without one get 400 Bad Request.
+func (i *Idempotency) Require(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if c.Request().Header.Get(Header) == "" {
+			return c.Error(http.StatusBadRequest, errors.New("idempotency: "+Header+" header is required"))
+		}
+		if c.Value(handledKey) != nil {
+			return next(c)
+		}
+		return i.serve(c, next)
+	}
+}
+
+// handledKey marks requests the middleware has already handled, so
+// Require on a route doesn't claim the key again.
+const handledKey = "buffkit.idempotency"
+
+func (i *Idempotency) serve(c buffalo.Context, next buffalo.Handler) error {
+	c.Set(handledKey, true)
+	key := c.Request().Header.Get(Header)
+	if len(key) > maxKeyLength {
+		return c.Error(http.StatusBadRequest, errors.New("idempotency: key is too long"))
+	}
+	fingerprint, err := fingerprint(c.Request())
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	now := clock.Or(i.Clock).Now()
+	claim := &Record{
+		Key:         scopedKey(auth.GetUserSession(c), key),
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(i.lockTimeout()),
+	}
+	existing, err := i.Store.Begin(c, claim, now)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		switch {
+		case existing.Fingerprint != fingerprint:
+			return c.Error(http.StatusUnprocessableEntity, ErrMismatch)
+		case !existing.Done():
+			return c.Error(http.StatusConflict, ErrInProgress)
+		}
+		return replay(c, existing)
+	}
+
+	res, ok := c.Response().(*buffalo.Response)
+	if !ok {
+		// The response can't be captured, so nothing can be replayed
+		defer i.release(claim.Key)
+		return next(c)
+	}
+	w := &recorder{ResponseWriter: res.ResponseWriter, max: i.maxResponse()}
+	res.ResponseWriter = w
+	err = next(c)
+	res.ResponseWriter = w.ResponseWriter
+
+	if err != nil || w.status < 200 || w.status >= 400 || w.overflow {
+		i.release(claim.Key)
+		return err
+	}
+	claim.Status = w.status
+	claim.Header = w.header
+	claim.Body = w.body.Bytes()
+	now = clock.Or(i.Clock).Now()
+	claim.ExpiresAt = now.Add(i.ttl())
+	if err := i.Store.Complete(context.WithoutCancel(c), claim, now); err != nil {
+		log.Printf("idempotency: keeping response: %v", err)
+	}
+	return nil
+}
+
+// release frees a key whose request didn't succeed, so it can be retried.
+func (i *Idempotency) release(key string) {
+	if err := i.Store.Release(context.Background(), key); err != nil {
+		log.Printf("idempotency: releasing key: %v", err)
+	}
+}
+
+// Prune deletes the records that have expired, returning how many.
+func (i *Idempotency) Prune(ctx context.Context) (int, error) {
+	return i.Store.Prune(ctx, clock.Or(i.Clock).Now())
+}
+
+func (i *Idempotency) applies(method string) bool {
+	methods := i.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Idempotency) ttl() time.Duration {
+	if i.TTL > 0 {
+		return i.TTL
+	}
+	return DefaultTTL
+}
+
+func (i *Idempotency) lockTimeout() time.Duration {
+	if i.LockTimeout > 0 {
+		return i.LockTimeout
+	}
+	return DefaultLockTimeout
+}
+
+func (i *Idempotency) maxResponse() int {
+	if i.MaxResponse > 0 {
+		return i.MaxResponse
+	}
+	return DefaultMaxResponse
+}
+
+// replay writes a kept response.
+func replay(c buffalo.Context, rec *Record) error {
+	w := c.Response()
+	for name, values := range rec.Header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	_, err := w.Write(rec.Body)
+	return err
+}
+
+// scopedKey keeps users' keys apart, so one user can't replay another's
+// response by sending the same key. Visitors who aren't logged in all
+// have the empty user. It's hashed to a fixed length.
+func scopedKey(user, key string) string {
+	sum := sha256.Sum256([]byte(user + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint hashes the request's method, path, query and body. Buffalo has
+// already read url-encoded forms into PostForm; other bodies are read
+// and put back for the handler.
+func fingerprint(r *http.Request) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	if len(r.PostForm) > 0 {
+		io.WriteString(h, r.PostForm.Encode())
+	} else if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// skippedHeaders aren't replayed: they belong to the first response only.
+var skippedHeaders = map[string]bool{
+	"Set-Cookie":     true,
+	"Date":           true,
+	"Content-Length": true,
+	"Server-Timing":  true,
+}
+
+// recorder writes the response through while keeping a copy.
+type recorder struct {
+	http.ResponseWriter
+	max      int
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *recorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = make(http.Header)
+		for name, values := range w.ResponseWriter.Header() {
+			if !skippedHeaders[name] {
+				w.header[name] = append([]string(nil), values...)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.max {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,266 @@
+package idempotency_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/idempotency"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newApp wires an app whose /orders counts the orders it takes, and
+// whose /broken counts its attempts and fails.
+func newApp(t *testing.T, opts buffkittest.Options) (*buffkittest.App, *atomic.Int64) {
+	t.Helper()
+	var orders atomic.Int64
+	opts.Config.Idempotency = true
+	opts.Setup = func(app *buffalo.App) {
+		app.POST("/orders", func(c buffalo.Context) error {
+			if c.Param("item") == "" {
+				return c.Render(http.StatusUnprocessableEntity, render.String("item is required"))
+			}
+			n := orders.Add(1)
+			c.Response().Header().Set("Location", fmt.Sprintf("/orders/%d", n))
+			return c.Render(http.StatusCreated, render.String(fmt.Sprintf("order %d: %s", n, c.Param("item"))))
+		})
+		app.POST("/broken", func(c buffalo.Context) error {
+			orders.Add(1)
+			return c.Error(http.StatusInternalServerError, fmt.Errorf("down"))
+		})
+	}
+	app := buffkittest.NewApp(t, opts)
+	require.NotNil(t, app.Kit.Idempotency)
+	app.Kit.Idempotency.Clock = app.Clock
+	return app, &orders
+}
+
+func post(client *buffkittest.Client, path, key string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if key != "" {
+		req.Header.Set(idempotency.Header, key)
+	}
+	return client.Do(req)
+}
+
+func TestReplay(t *testing.T) {
+	app, orders := newApp(t, buffkittest.Options{})
+	client := app.Client()
+	form := url.Values{"item": {"book"}}
+
+	first := post(client, "/orders", "key-1", form)
+	require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+	assert.Equal(t, "order 1: book", first.Body.String())
+	assert.Empty(t, first.Header().Get(idempotency.ReplayedHeader))
+
+	retry := post(client, "/orders", "key-1", form)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "order 1: book", retry.Body.String())
+	assert.Equal(t, "/orders/1", retry.Header().Get("Location"))
+	assert.Equal(t, "true", retry.Header().Get(idempotency.ReplayedHeader))
+	assert.Equal(t, int64(1), orders.Load(), "the retry didn't run again")
+
+	t.Run("without a key", func(t *testing.T) {
+		post(client, "/orders", "", form)
+		post(client, "/orders", "", form)
+		assert.Equal(t, int64(3), orders.Load())
+	})
+
+	t.Run("another key", func(t *testing.T) {
+		assert.Equal(t, "order 4: book", post(client, "/orders", "key-2", form).Body.String())
+	})
+
+	t.Run("a different request", func(t *testing.T) {
+		res := post(client, "/orders", "key-1", url.Values{"item": {"lamp"}})
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+		assert.Equal(t, int64(4), orders.Load())
+	})
+
+	t.Run("a different query", func(t *testing.T) {
+		res := post(client, "/orders?coupon=SAVE10", "key-1", form)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+		assert.Equal(t, int64(4), orders.Load())
+	})
+
+	t.Run("another user", func(t *testing.T) {
+		ada := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com"})
+		res := post(ada, "/orders", "key-1", form)
+		assert.Equal(t, "order 5: book", res.Body.String(), "keys are per user")
+		assert.Equal(t, "order 5: book", post(ada, "/orders", "key-1", form).Body.String())
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		app.Clock.Advance(idempotency.DefaultTTL + time.Minute)
+		assert.Equal(t, "order 6: book", post(client, "/orders", "key-1", form).Body.String())
+	})
+}
+
+func TestRedis(t *testing.T) {
+	app, orders := newApp(t, buffkittest.Options{Jobs: true})
+	require.IsType(t, &idempotency.RedisStore{}, app.Kit.Idempotency.Store)
+	client := app.Client()
+	form := url.Values{"item": {"book"}}
+
+	assert.Equal(t, "order 1: book", post(client, "/orders", "key-1", form).Body.String())
+	assert.Equal(t, "order 1: book", post(client, "/orders", "key-1", form).Body.String())
+	assert.Equal(t, int64(1), orders.Load())
+}
+
+func TestFailuresAreRetried(t *testing.T) {
+	app, orders := newApp(t, buffkittest.Options{})
+	client := app.Client()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, post(client, "/orders", "key-1", nil).Code)
+	res := post(client, "/orders", "key-1", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.Empty(t, res.Header().Get(idempotency.ReplayedHeader), "4xx responses aren't kept")
+
+	assert.Equal(t, http.StatusInternalServerError, post(client, "/broken", "key-3", nil).Code)
+	assert.Equal(t, http.StatusInternalServerError, post(client, "/broken", "key-3", nil).Code)
+	assert.Equal(t, int64(2), orders.Load(), "errors aren't kept")
+}
+
+func TestInProgress(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+	i := idempotency.New(store)
+	started, finish := make(chan struct{}), make(chan struct{})
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(i.Middleware)
+	app.POST("/slow", func(c buffalo.Context) error {
+		close(started)
+		<-finish
+		return c.Render(http.StatusOK, render.String("done"))
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/slow", strings.NewReader("{}"))
+		req.Header.Set(idempotency.Header, "key-1")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- send() }()
+	<-started
+	assert.Equal(t, http.StatusConflict, send().Code)
+	close(finish)
+	assert.Equal(t, "done", (<-first).Body.String())
+	assert.Equal(t, "done", send().Body.String())
+}
+
+func TestRequire(t *testing.T) {
+	i := idempotency.New(idempotency.NewMemoryStore())
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(i.Middleware)
+	var charges int
+	app.POST("/checkout", i.Require(func(c buffalo.Context) error {
+		charges++
+		return c.Render(http.StatusOK, render.String("ok"))
+	}))
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/checkout", nil)
+		if key != "" {
+			req.Header.Set(idempotency.Header, key)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest, send("").Code)
+	assert.Equal(t, http.StatusOK, send("key-1").Code, "the middleware's claim isn't taken again")
+	assert.Equal(t, "true", send("key-1").Header().Get(idempotency.ReplayedHeader))
+	assert.Equal(t, 1, charges)
+}
+
+func TestStores(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	schema, err := os.ReadFile("../db/migrations/idempotency/20261017160000_create_idempotency_keys.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	ctx := context.Background()
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	for name, store := range map[string]idempotency.Store{
+		"memory": idempotency.NewMemoryStore(),
+		"sql":    idempotency.NewSQLStore(db, "sqlite"),
+		"redis":  idempotency.NewRedisStore(client),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// claim is a request for the key arriving at at
+			claim := func(at time.Time) *idempotency.Record {
+				return &idempotency.Record{Key: name + "-1", Fingerprint: "fp", ExpiresAt: at.Add(time.Minute)}
+			}
+			existing, err := store.Begin(ctx, claim(now), now)
+			require.NoError(t, err)
+			assert.Nil(t, existing, "claimed")
+
+			existing, err = store.Begin(ctx, claim(now), now)
+			require.NoError(t, err)
+			require.NotNil(t, existing)
+			assert.False(t, existing.Done())
+			assert.Equal(t, "fp", existing.Fingerprint)
+
+			done := claim(now)
+			done.Status = http.StatusCreated
+			done.Header = http.Header{"Location": {"/orders/1"}}
+			done.Body = []byte("created\x00")
+			done.ExpiresAt = now.Add(time.Hour)
+			require.NoError(t, store.Complete(ctx, done, now))
+
+			later := now.Add(30 * time.Minute)
+			existing, err = store.Begin(ctx, claim(later), later)
+			require.NoError(t, err)
+			require.NotNil(t, existing)
+			assert.True(t, existing.Done())
+			assert.Equal(t, http.StatusCreated, existing.Status)
+			assert.Equal(t, "/orders/1", existing.Header.Get("Location"))
+			assert.Equal(t, []byte("created\x00"), existing.Body)
+
+			require.NoError(t, store.Release(ctx, done.Key))
+			require.NoError(t, store.Release(ctx, "unknown"))
+			existing, err = store.Begin(ctx, claim(now), now)
+			require.NoError(t, err)
+			assert.Nil(t, existing, "released keys can be claimed again")
+
+			later = now.Add(2 * time.Minute)
+			if name == "redis" {
+				mr.FastForward(2 * time.Minute)
+			} else {
+				n, err := store.Prune(ctx, later)
+				require.NoError(t, err)
+				assert.Equal(t, 1, n)
+			}
+			existing, err = store.Begin(ctx, claim(later), later)
+			require.NoError(t, err)
+			assert.Nil(t, existing, "expired")
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/timing"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps Records. MemoryStore suits tests and a single process;
+// SQLStore and RedisStore share keys between processes.
+type Store interface {
+	// Begin claims rec.Key for a request, unless an unexpired record
+	// holds it, which is returned instead. Expired records are replaced.
+	Begin(ctx context.Context, rec *Record, now time.Time) (*Record, error)
+
+	// Complete keeps rec's response, replacing its claim.
+	Complete(ctx context.Context, rec *Record, now time.Time) error
+
+	// Release deletes key's record. Releasing an unknown key isn't an
+	// error.
+	Release(ctx context.Context, key string) error
+
+	// Prune deletes records that expired before now, returning how many.
+	Prune(ctx context.Context, now time.Time) (int, error)
+}
+
+// MemoryStore keeps records in memory, for tests and single-process apps.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+func (s *MemoryStore) Begin(ctx context.Context, rec *Record, now time.Time) (*Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[rec.Key]; ok && now.Before(existing.ExpiresAt) {
+		return clone(existing), nil
+	}
+	s.records[rec.Key] = clone(rec)
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, rec *Record, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.Key] = clone(rec)
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, now time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, rec := range s.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.records, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func clone(rec *Record) *Record {
+	c := *rec
+	c.Header = rec.Header.Clone()
+	c.Body = append([]byte(nil), rec.Body...)
+	return &c
+}
+
+// SQLStore keeps records in the idempotency_keys table created by the
+// db/migrations/idempotency migration, with bodies base64 encoded so the
+// column is TEXT in every database. Expired rows are replaced as keys
+// are reused; the buffkit:idempotency:prune task deletes the rest.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates an idempotency store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) Begin(ctx context.Context, rec *Record, now time.Time) (*Record, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	// Clear an expired record first, so the insert below decides which
+	// of two concurrent requests claims the key
+	if _, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"DELETE FROM idempotency_keys WHERE idempotency_key = ? AND expires_at <= ?"), rec.Key, now); err != nil {
+		return nil, err
+	}
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO idempotency_keys (idempotency_key, fingerprint, status, header, body, expires_at) VALUES (?, ?, 0, '', '', ?)"),
+		rec.Key, rec.Fingerprint, rec.ExpiresAt)
+	if err == nil {
+		return nil, nil
+	}
+	// Drivers word duplicate keys differently, so look for the record
+	existing, lookup := s.record(ctx, rec.Key)
+	if lookup != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *SQLStore) record(ctx context.Context, key string) (*Record, error) {
+	rec := Record{Key: key}
+	var header, body string
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT fingerprint, status, header, body, expires_at FROM idempotency_keys WHERE idempotency_key = ?"), key).
+		Scan(&rec.Fingerprint, &rec.Status, &header, &body, &rec.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Body, err = base64.StdEncoding.DecodeString(body); err != nil {
+		return nil, fmt.Errorf("idempotency: decode body: %w", err)
+	}
+	if header != "" {
+		if err := json.Unmarshal([]byte(header), &rec.Header); err != nil {
+			return nil, fmt.Errorf("idempotency: decode header: %w", err)
+		}
+	}
+	return &rec, nil
+}
+
+func (s *SQLStore) Complete(ctx context.Context, rec *Record, now time.Time) error {
+	defer timing.Start(ctx, timing.DB)()
+
+	header, err := json.Marshal(rec.Header)
+	if err != nil {
+		return fmt.Errorf("idempotency: encode header: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"UPDATE idempotency_keys SET status = ?, header = ?, body = ?, expires_at = ? WHERE idempotency_key = ?"),
+		rec.Status, string(header), base64.StdEncoding.EncodeToString(rec.Body), rec.ExpiresAt, rec.Key)
+	return err
+}
+
+func (s *SQLStore) Release(ctx context.Context, key string) error {
+	defer timing.Start(ctx, timing.DB)()
+
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM idempotency_keys WHERE idempotency_key = ?"), key)
+	return err
+}
+
+func (s *SQLStore) Prune(ctx context.Context, now time.Time) (int, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM idempotency_keys WHERE expires_at <= ?"), now)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// redisPrefix namespaces RedisStore's keys.
+const redisPrefix = "buffkit:idempotency:"
+
+// RedisStore keeps records in Redis, which expires them itself.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore creates an idempotency store using client.
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// redisRecord is a Record as stored in Redis.
+type redisRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+}
+
+func (s *RedisStore) Begin(ctx context.Context, rec *Record, now time.Time) (*Record, error) {
+	data, err := encode(rec)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.client.SetNX(ctx, redisPrefix+rec.Key, data, rec.ExpiresAt.Sub(now)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("idempotency: claim key: %w", err)
+	}
+	if ok {
+		return nil, nil
+	}
+	raw, err := s.client.Get(ctx, redisPrefix+rec.Key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// It expired in between; claim it again
+		return s.Begin(ctx, rec, now)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("idempotency: read key: %w", err)
+	}
+	var stored redisRecord
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return nil, fmt.Errorf("idempotency: decode record: %w", err)
+	}
+	return &Record{
+		Key:         rec.Key,
+		Fingerprint: stored.Fingerprint,
+		Status:      stored.Status,
+		Header:      stored.Header,
+		Body:        stored.Body,
+		ExpiresAt:   stored.ExpiresAt,
+	}, nil
+}
+
+func (s *RedisStore) Complete(ctx context.Context, rec *Record, now time.Time) error {
+	data, err := encode(rec)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, redisPrefix+rec.Key, data, rec.ExpiresAt.Sub(now)).Err(); err != nil {
+		return fmt.Errorf("idempotency: keep response: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, redisPrefix+key).Err()
+}
+
+// Prune does nothing: Redis expires records itself.
+func (s *RedisStore) Prune(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+// Close closes the store's Redis client.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func encode(rec *Record) ([]byte, error) {
+	data, err := json.Marshal(redisRecord{
+		Fingerprint: rec.Fingerprint,
+		Status:      rec.Status,
+		Header:      rec.Header,
+		Body:        rec.Body,
+		ExpiresAt:   rec.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("idempotency: encode record: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,135 @@
+package importmap
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// DefaultControllersDir is where an app keeps its JS controllers.
+const DefaultControllersDir = "app/javascript/controllers"
+
+// ControllersPath is the URL the controllers directory is served under,
+// matching the "controllers/" pin from LoadDefaults.
+const ControllersPath = "/assets/js/controllers"
+
+// Controller is a Stimulus controller file. Files follow the Stimulus
+// naming convention: hello_controller.js registers as "hello", and
+// users/list_controller.js as "users--list".
+type Controller struct {
+	Identifier string // the data-controller name
+	File       string // path relative to the controllers directory
+}
+
+// ScanControllers finds the *_controller.js (or *-controller.js) files
+// in fsys, sorted by identifier.
+func ScanControllers(fsys fs.FS) ([]Controller, error) {
+	var controllers []Controller
+	err := fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := strings.TrimSuffix(file, ".js")
+		for _, suffix := range []string{"_controller", "-controller"} {
+			if base := strings.TrimSuffix(name, suffix); base != name {
+				identifier := strings.ReplaceAll(strings.ReplaceAll(base, "_", "-"), "/", "--")
+				controllers = append(controllers, Controller{Identifier: identifier, File: file})
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(controllers, func(i, j int) bool { return controllers[i].Identifier < controllers[j].Identifier })
+	return controllers, nil
+}
+
+// PinControllers pins each controller as "controllers/<file>" (without
+// .js) under urlPath, and "controllers" to the bootstrapping module at
+// urlPath/index.js, which RenderModuleEntrypoint then imports.
+func (m *Manager) PinControllers(controllers []Controller, urlPath string) {
+	for _, c := range controllers {
+		m.imports["controllers/"+strings.TrimSuffix(c.File, ".js")] = path.Join(urlPath, c.File)
+	}
+	m.imports["controllers"] = path.Join(urlPath, "index.js")
+}
+
+// ControllersModule returns the bootstrapping module: it starts a
+// Stimulus application and registers every controller under its
+// identifier. Controllers are imported relative to the module, so it
+// must be served from the controllers' directory.
+func ControllersModule(controllers []Controller) string {
+	var b strings.Builder
+	b.WriteString("// Generated by Buffkit from the controllers in this directory\n")
+	b.WriteString("import { Application } from \"@hotwired/stimulus\";\n")
+	for i, c := range controllers {
+		fmt.Fprintf(&b, "import Controller%d from \"./%s\";\n", i, c.File)
+	}
+	b.WriteString("\nconst application = Application.start();\n")
+	for i, c := range controllers {
+		fmt.Fprintf(&b, "application.register(%q, Controller%d);\n", c.Identifier, i)
+	}
+	b.WriteString("window.Stimulus = application;\n\nexport { application };\n")
+	return b.String()
+}
+
+// ControllersHandler serves the controllers in dir, with the
+// bootstrapping module as index.js. The route needs a "file" parameter
+// holding the path within the directory:
+//
+//	app.GET("/assets/js/controllers/{file:.+}", importmap.ControllersHandler(dir, devMode))
+//
+// In dev mode the directory is rescanned on every request for index.js,
+// so new controllers register on reload; otherwise the module is built
+// once.
+func ControllersHandler(dir string, devMode bool) buffalo.Handler {
+	fsys := os.DirFS(dir)
+	var (
+		once   sync.Once
+		module string
+		err    error
+	)
+	build := func() (string, error) {
+		controllers, err := ScanControllers(fsys)
+		if err != nil {
+			return "", err
+		}
+		return ControllersModule(controllers), nil
+	}
+
+	return func(c buffalo.Context) error {
+		file := c.Param("file")
+		if file != "index.js" {
+			if !fs.ValidPath(file) || !strings.HasSuffix(file, ".js") {
+				return c.Error(http.StatusNotFound, fmt.Errorf("no controller %s", file))
+			}
+			c.Response().Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			http.ServeFileFS(c.Response(), c.Request(), fsys, file)
+			return nil
+		}
+
+		var source string
+		var buildErr error
+		if devMode {
+			source, buildErr = build()
+		} else {
+			once.Do(func() { module, err = build() })
+			source, buildErr = module, err
+		}
+		if buildErr != nil {
+			return c.Error(http.StatusInternalServerError, buildErr)
+		}
+		c.Response().Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		_, writeErr := c.Response().Write([]byte(source))
+		return writeErr
+	}
+}
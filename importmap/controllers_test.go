@@ -0,0 +1,75 @@
+package importmap
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestScanControllers(t *testing.T) {
+	fsys := fstest.MapFS{
+		"hello_controller.js":           {Data: []byte("export default class {}")},
+		"users/list_controller.js":      {Data: []byte("export default class {}")},
+		"date-picker-controller.js":     {Data: []byte("export default class {}")},
+		"helpers.js":                    {Data: []byte("export const x = 1")},
+		"admin/audit_log_controller.js": {Data: []byte("export default class {}")},
+	}
+	controllers, err := ScanControllers(fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Controller{
+		{Identifier: "admin--audit-log", File: "admin/audit_log_controller.js"},
+		{Identifier: "date-picker", File: "date-picker-controller.js"},
+		{Identifier: "hello", File: "hello_controller.js"},
+		{Identifier: "users--list", File: "users/list_controller.js"},
+	}
+	if len(controllers) != len(want) {
+		t.Fatalf("expected %v, got %v", want, controllers)
+	}
+	for i := range want {
+		if controllers[i] != want[i] {
+			t.Errorf("controller %d: expected %v, got %v", i, want[i], controllers[i])
+		}
+	}
+}
+
+func TestPinControllers(t *testing.T) {
+	manager := NewManager()
+	manager.LoadDefaults()
+	if strings.Contains(manager.RenderModuleEntrypoint(), `import "controllers"`) {
+		t.Error("expected no controllers import before PinControllers")
+	}
+
+	manager.PinControllers([]Controller{{Identifier: "users--list", File: "users/list_controller.js"}}, ControllersPath)
+
+	imports := manager.List()
+	if got := imports["controllers/users/list_controller"]; got != "/assets/js/controllers/users/list_controller.js" {
+		t.Errorf("unexpected controller pin %q", got)
+	}
+	if got := imports["controllers"]; got != "/assets/js/controllers/index.js" {
+		t.Errorf("unexpected bootstrap pin %q", got)
+	}
+	if !strings.Contains(manager.RenderModuleEntrypoint(), `import "controllers"`) {
+		t.Error("expected the entrypoint to import the controllers module")
+	}
+}
+
+func TestControllersModule(t *testing.T) {
+	module := ControllersModule([]Controller{
+		{Identifier: "hello", File: "hello_controller.js"},
+		{Identifier: "users--list", File: "users/list_controller.js"},
+	})
+	for _, want := range []string{
+		`import { Application } from "@hotwired/stimulus";`,
+		`import Controller0 from "./hello_controller.js";`,
+		`import Controller1 from "./users/list_controller.js";`,
+		`application.register("hello", Controller0);`,
+		`application.register("users--list", Controller1);`,
+	} {
+		if !strings.Contains(module, want) {
+			t.Errorf("expected module to contain %s, got:\n%s", want, module)
+		}
+	}
+}
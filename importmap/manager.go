@@ -180,6 +180,15 @@ func (m *Manager) RenderModuleEntrypoint() string {
 `
 	}
 
+	// Register the app's Stimulus controllers when PinControllers ran
+	controllersCode := ""
+	if _, ok := m.imports["controllers"]; ok {
+		controllersCode = `
+  // Start Stimulus with the app's controllers
+  import "controllers";
+`
+	}
+
 	return fmt.Sprintf(`<script type="module">%s
   // Import core libraries
   import "htmx.org";
@@ -191,7 +200,7 @@ func (m *Manager) RenderModuleEntrypoint() string {
 
   // Import app entry point
   import "app";
-
+%s
   // Setup SSE connection with reconnection support
   if (typeof EventSource !== 'undefined') {
     const source = new EventSource('/events', { withCredentials: true });
@@ -224,7 +233,7 @@ func (m *Manager) RenderModuleEntrypoint() string {
       // EventSource will automatically reconnect
     };
   }
-</script>`, debugCode)
+</script>`, debugCode, controllersCode)
 }
 
 // List returns all current imports
@@ -0,0 +1,889 @@
+// Package imports loads CSV files into the app. A user uploads a file,
+// matches its columns to the importer's fields, and a background job
+// validates and saves each row, pushing its progress over SSE. The
+// results page then shows what was imported and why each failed row
+// failed.
+//
+//	kit.Imports.Register(imports.Importer{
+//	    Name: "contacts",
+//	    Fields: []imports.Field{
+//	        {Name: "email", Label: "Email", Required: true},
+//	        {Name: "name", Label: "Name"},
+//	    },
+//	    Validate: func(ctx context.Context, row imports.Row) []imports.FieldError {
+//	        if !strings.Contains(row["email"], "@") {
+//	            return []imports.FieldError{{Field: "email", Message: "is not an email address"}}
+//	        }
+//	        return nil
+//	    },
+//	    Process: func(ctx context.Context, row imports.Row) error {
+//	        return contacts.Create(ctx, imports.Owner(ctx), row["email"], row["name"])
+//	    },
+//	})
+//
+// Users start at /imports/contacts. Wire mounts the pages when jobs are
+// configured; they render views.PageImportUpload, views.PageImportMap and
+// views.PageImportStatus, so apps can restyle them like Buffkit's other
+// pages.
+package imports
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/blob"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/export"
+	"github.com/johnjansen/buffkit/quota"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// DefaultMaxSize is the largest file users can upload when
+// Imports.MaxSize isn't set.
+const DefaultMaxSize = 10 << 20 // 10 MiB
+
+// batchSize is how many rows are processed between saves of an import's
+// progress.
+const batchSize = 100
+
+// maxShownErrors is how many row errors the results page lists; the
+// rest are in the errors download.
+const maxShownErrors = 100
+
+// runTask is the task type of the job that processes an import.
+const runTask = "import:run"
+
+// ErrNotFound is returned for an unknown import ID.
+var ErrNotFound = auth.NotFoundError("imports: import not found")
+
+// State is where an import is in its run.
+type State string
+
+const (
+	StateMapping State = "mapping" // uploaded, waiting for its columns to be mapped
+	StateQueued  State = "queued"
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed" // the file couldn't be read; see Import.Error
+)
+
+// Field is a value an importer takes from each row.
+type Field struct {
+	// Name is the field's key in a Row.
+	Name string
+
+	// Label is what the mapping page shows. Defaults to Name.
+	Label string
+
+	// Required fields must be mapped to a column, and rows without a
+	// value for them fail.
+	Required bool
+}
+
+func (f Field) label() string {
+	if f.Label != "" {
+		return f.Label
+	}
+	return f.Name
+}
+
+// Row is one line of an import, by field name.
+type Row map[string]string
+
+// FieldError is why a field of a row is invalid.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + " " + e.Message
+}
+
+// Importer turns a CSV's rows into the app's records.
+type Importer struct {
+	// Name identifies the importer in URLs: /imports/<name>.
+	Name string
+
+	Fields []Field
+
+	// Validate checks a row, after its required fields have been checked,
+	// and returns what's wrong with it. A row with errors isn't
+	// processed. Optional.
+	Validate func(ctx context.Context, row Row) []FieldError
+
+	// Process saves a valid row. An error fails the row, and a
+	// FieldError says which field it was about. A job that's retried
+	// carries on from the last progress it saved, so a few rows may be
+	// processed twice; make Process idempotent where that matters, such
+	// as by upserting. Owner(ctx) is the user who uploaded the file.
+	Process func(ctx context.Context, row Row) error
+}
+
+// Import is one uploaded file and its progress.
+type Import struct {
+	ID       string
+	Importer string
+
+	// Owner is the email of the user who uploaded the file. Only they
+	// can see the import.
+	Owner string
+
+	// Filename is the name the file was uploaded with.
+	Filename string
+
+	// Channel is the SSE channel progress is pushed to.
+	Channel string
+
+	// Header is the file's first line, the names of its columns.
+	Header []string
+
+	// Mapping holds the column (index into Header) each field is read
+	// from. Unmapped fields aren't in it.
+	Mapping map[string]int
+
+	State State
+	Error string
+
+	// Total is the number of rows after the header. Processed counts
+	// those done so far, which either Imported or Failed.
+	Total, Processed, Imported, Failed int
+
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// Finished reports whether the import has stopped, done or failed.
+func (imp *Import) Finished() bool {
+	return imp.State == StateDone || imp.State == StateFailed
+}
+
+// RowError is why a row failed.
+type RowError struct {
+	// Line is the row's line in the file, counting the header as 1.
+	Line    int
+	Field   string
+	Message string
+}
+
+// Store keeps imports and their row errors.
+type Store interface {
+	Create(ctx context.Context, imp *Import) error
+	Import(ctx context.Context, id string) (*Import, error)
+	Update(ctx context.Context, imp *Import) error
+	AddErrors(ctx context.Context, id string, errs []RowError) error
+
+	// Errors lists up to limit of an import's row errors, in line
+	// order; a limit of 0 lists them all.
+	Errors(ctx context.Context, id string, limit int) ([]RowError, error)
+}
+
+// Queue is the jobs runtime imports run on; *jobs.Runtime implements it.
+type Queue interface {
+	HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error)
+	EnqueueIn(delay time.Duration, taskType string, payload interface{}) error
+}
+
+// Publisher pushes events over SSE; *ssr.Broker implements it.
+type Publisher interface {
+	BroadcastChannel(channel, eventName string, html []byte)
+}
+
+// Imports runs registered importers and serves their pages.
+type Imports struct {
+	Queue Queue
+	Store Store
+
+	// Publisher pushes progress to the status page. Without one, the
+	// page shows progress as of when it was loaded.
+	Publisher Publisher
+
+	// Channel picks the SSE channel an upload's progress goes to, which
+	// should be the one its uploader is subscribed to: the broker's
+	// channel resolver. Nil uses the global channel.
+	Channel func(c buffalo.Context) string
+
+	// Files keeps uploaded files until they're processed, under
+	// tmp/imports/ so abandoned uploads expire. Nil keeps them in Dir.
+	Files blob.Store
+
+	// Dir is where uploaded files wait to be processed when there are no
+	// Files. The worker and the web process must both see it. Defaults
+	// to buffkit-imports in the system's temporary directory.
+	Dir string
+
+	// Path is where Mount puts the pages. Defaults to "/imports".
+	Path string
+
+	// EventsPath is where the status page connects for progress.
+	// Defaults to "/events".
+	EventsPath string
+
+	// MaxSize limits uploads, in bytes. Defaults to DefaultMaxSize.
+	MaxSize int64
+
+	// Quota, when set, counts each file against its uploader's storage
+	// until it's been imported. Nil doesn't limit them.
+	Quota *quota.Quota
+
+	// Clock stamps imports. Defaults to clock.Real.
+	Clock clock.Clock
+
+	importers map[string]Importer
+}
+
+// runPayload is the payload of an import job.
+type runPayload struct {
+	ImportID string `json:"import_id"`
+}
+
+// New creates an Imports and registers its job handler on queue.
+func New(queue Queue, store Store) *Imports {
+	i := &Imports{Queue: queue, Store: store, importers: make(map[string]Importer)}
+	queue.HandleFunc(runTask, func(ctx context.Context, t *asynq.Task) error {
+		var p runPayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return fmt.Errorf("imports: bad payload: %w", err)
+		}
+		return i.Run(ctx, p.ImportID)
+	})
+	return i
+}
+
+// Register adds importer x.
+func (i *Imports) Register(x Importer) error {
+	switch {
+	case x.Name == "":
+		return errors.New("imports: Name is required")
+	case len(x.Fields) == 0:
+		return fmt.Errorf("imports: %s: Fields are required", x.Name)
+	case x.Process == nil:
+		return fmt.Errorf("imports: %s: Process is required", x.Name)
+	}
+	if _, exists := i.importers[x.Name]; exists {
+		return fmt.Errorf("imports: %s is already registered", x.Name)
+	}
+	i.importers[x.Name] = x
+	return nil
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (i *Imports) Routes() [][2]string {
+	p := i.path()
+	return [][2]string{
+		{http.MethodGet, p + "/{importer}"},
+		{http.MethodPost, p + "/{importer}"},
+		{http.MethodGet, p + "/{importer}/{id}"},
+		{http.MethodPost, p + "/{importer}/{id}"},
+		{http.MethodGet, p + "/{importer}/{id}/errors.csv"},
+	}
+}
+
+// Mount adds the import pages to app. They all require login.
+func (i *Imports) Mount(app *buffalo.App) {
+	p := i.path()
+	app.GET(p+"/{importer}", auth.RequireLogin(i.New))
+	app.POST(p+"/{importer}", auth.RequireLogin(i.Upload))
+	app.GET(p+"/{importer}/{id}", auth.RequireLogin(i.Show))
+	app.POST(p+"/{importer}/{id}", auth.RequireLogin(i.Map))
+	app.GET(p+"/{importer}/{id}/errors.csv", auth.RequireLogin(i.ErrorsCSV))
+}
+
+// New renders the upload form.
+func (i *Imports) New(c buffalo.Context) error {
+	x, ok := i.importers[c.Param("importer")]
+	if !ok {
+		return c.Error(http.StatusNotFound, fmt.Errorf("imports: no importer %q", c.Param("importer")))
+	}
+	return i.renderUpload(c, http.StatusOK, x, nil)
+}
+
+// Upload saves an uploaded file and shows the page for mapping its
+// columns.
+func (i *Imports) Upload(c buffalo.Context) error {
+	x, ok := i.importers[c.Param("importer")]
+	if !ok {
+		return c.Error(http.StatusNotFound, fmt.Errorf("imports: no importer %q", c.Param("importer")))
+	}
+
+	maxSize := i.maxSize()
+	// Leave room for the multipart framing around the file
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxSize+4096)
+	file, header, err := c.Request().FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return i.renderUpload(c, http.StatusRequestEntityTooLarge, x, []string{sizeMessage(maxSize)})
+		}
+		return i.renderUpload(c, http.StatusUnprocessableEntity, x, []string{"Choose a CSV file to upload"})
+	}
+	defer func() { _ = file.Close() }()
+	if header.Size > maxSize {
+		return i.renderUpload(c, http.StatusRequestEntityTooLarge, x, []string{sizeMessage(maxSize)})
+	}
+
+	id, err := newID()
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	owner := auth.GetUserSession(c)
+	if i.Quota != nil {
+		if err := i.Quota.Reserve(c, quotaUser(c, owner), quotaItem(id), header.Size); err != nil {
+			var exceeded *quota.ExceededError
+			if errors.As(err, &exceeded) {
+				return i.renderUpload(c, http.StatusRequestEntityTooLarge, x, []string{exceeded.PublicMessage()})
+			}
+			return c.Error(http.StatusInternalServerError, err)
+		}
+	}
+	if err := i.save(c, id, file); err != nil {
+		i.release(c, owner, id)
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	columns, total, err := i.scan(c, id)
+	if err != nil {
+		i.remove(c, id)
+		i.release(c, owner, id)
+		return i.renderUpload(c, http.StatusUnprocessableEntity, x, []string{"Couldn't read the file: " + err.Error()})
+	}
+
+	imp := &Import{
+		ID:        id,
+		Importer:  x.Name,
+		Owner:     owner,
+		Filename:  filepath.Base(header.Filename),
+		Header:    columns,
+		Mapping:   guessMapping(x.Fields, columns),
+		State:     StateMapping,
+		Total:     total,
+		CreatedAt: clock.Or(i.Clock).Now(),
+	}
+	if i.Channel != nil {
+		imp.Channel = i.Channel(c)
+	}
+	if err := i.Store.Create(c, imp); err != nil {
+		i.remove(c, id)
+		i.release(c, owner, id)
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	log.Printf("Imports: uploaded id=%s importer=%s rows=%d", imp.ID, x.Name, total)
+	return c.Redirect(http.StatusSeeOther, i.importPath(imp))
+}
+
+// Show renders the mapping page for an import still being mapped, and
+// its progress or results after that.
+func (i *Imports) Show(c buffalo.Context) error {
+	x, imp, err := i.load(c)
+	if imp == nil {
+		return err
+	}
+	if imp.State == StateMapping {
+		return i.renderMap(c, http.StatusOK, x, imp, nil)
+	}
+
+	rowErrors, err := i.Store.Errors(c, imp.ID, maxShownErrors+1)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	more := len(rowErrors) > maxShownErrors
+	if more {
+		rowErrors = rowErrors[:maxShownErrors]
+	}
+	eventsPath := i.EventsPath
+	if eventsPath == "" {
+		eventsPath = "/events"
+	}
+	return views.Render(c, http.StatusOK, views.PageImportStatus, map[string]any{
+		"import":      imp,
+		"finished":    imp.Finished(),
+		"progress":    template.HTML(progressHTML(imp)),
+		"row_errors":  rowErrors,
+		"more_errors": more,
+		"errors_path": i.importPath(imp) + "/errors.csv",
+		"events_path": eventsPath,
+		"event":       progressEvent(imp.ID),
+	})
+}
+
+// Map saves the columns chosen for an import's fields and queues it.
+func (i *Imports) Map(c buffalo.Context) error {
+	x, imp, err := i.load(c)
+	if imp == nil {
+		return err
+	}
+	if imp.State != StateMapping {
+		return c.Redirect(http.StatusSeeOther, i.importPath(imp))
+	}
+
+	mapping := make(map[string]int)
+	var errs []string
+	for _, f := range x.Fields {
+		value := c.Param("map[" + f.Name + "]")
+		if value == "" {
+			if f.Required {
+				errs = append(errs, fmt.Sprintf("Choose the column for %s", f.label()))
+			}
+			continue
+		}
+		column, err := strconv.Atoi(value)
+		if err != nil || column < 0 || column >= len(imp.Header) {
+			errs = append(errs, fmt.Sprintf("Choose the column for %s", f.label()))
+			continue
+		}
+		mapping[f.Name] = column
+	}
+	imp.Mapping = mapping
+	if len(errs) > 0 {
+		return i.renderMap(c, http.StatusUnprocessableEntity, x, imp, errs)
+	}
+
+	imp.State = StateQueued
+	if err := i.Store.Update(c, imp); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if err := i.Queue.EnqueueIn(0, runTask, runPayload{ImportID: imp.ID}); err != nil {
+		return c.Error(http.StatusInternalServerError, fmt.Errorf("imports: %s: %w", imp.ID, err))
+	}
+	return c.Redirect(http.StatusSeeOther, i.importPath(imp))
+}
+
+// ErrorsCSV downloads every row error of an import.
+func (i *Imports) ErrorsCSV(c buffalo.Context) error {
+	_, imp, err := i.load(c)
+	if imp == nil {
+		return err
+	}
+	rowErrors, err := i.Store.Errors(c, imp.ID, 0)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	c.Response().Header().Set("Content-Type", "text/csv; charset=utf-8")
+	c.Response().Header().Set("Content-Disposition", export.ContentDisposition(imp.Importer+"-errors.csv"))
+	return export.WriteCSV(c.Response(), []string{"Line", "Field", "Error"}, func(yield func([]string, error) bool) {
+		for _, e := range rowErrors {
+			if !yield([]string{strconv.Itoa(e.Line), e.Field, e.Message}, nil) {
+				return
+			}
+		}
+	})
+}
+
+// load finds the import in the URL, for its owner only. A nil import
+// means the response is handled; the handler returns err as is.
+func (i *Imports) load(c buffalo.Context) (Importer, *Import, error) {
+	x, ok := i.importers[c.Param("importer")]
+	if !ok {
+		return x, nil, c.Error(http.StatusNotFound, fmt.Errorf("imports: no importer %q", c.Param("importer")))
+	}
+	imp, err := i.Store.Import(c, c.Param("id"))
+	if errors.Is(err, ErrNotFound) || (err == nil && (imp.Importer != x.Name || imp.Owner != auth.GetUserSession(c))) {
+		return x, nil, c.Error(http.StatusNotFound, ErrNotFound)
+	}
+	if err != nil {
+		return x, nil, c.Error(http.StatusInternalServerError, err)
+	}
+	return x, imp, nil
+}
+
+func (i *Imports) renderUpload(c buffalo.Context, status int, x Importer, errs []string) error {
+	return views.Render(c, status, views.PageImportUpload, map[string]any{
+		"importer":    x.Name,
+		"fields":      x.Fields,
+		"upload_path": i.path() + "/" + x.Name,
+		"errors":      errs,
+	})
+}
+
+// FieldColumn is a field on the mapping page, with the column it's
+// mapped to, or -1.
+type FieldColumn struct {
+	Field
+	Column int
+}
+
+func (i *Imports) renderMap(c buffalo.Context, status int, x Importer, imp *Import, errs []string) error {
+	fields := make([]FieldColumn, len(x.Fields))
+	for n, f := range x.Fields {
+		f.Label = f.label()
+		column, ok := imp.Mapping[f.Name]
+		if !ok {
+			column = -1
+		}
+		fields[n] = FieldColumn{Field: f, Column: column}
+	}
+	return views.Render(c, status, views.PageImportMap, map[string]any{
+		"import":   imp,
+		"fields":   fields,
+		"columns":  imp.Header,
+		"map_path": i.importPath(imp),
+		"errors":   errs,
+	})
+}
+
+// Run processes import id, from the last progress it saved. The job Map
+// queues calls it.
+func (i *Imports) Run(ctx context.Context, id string) error {
+	imp, err := i.Store.Import(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("imports: %s: %w", id, err)
+	}
+	if imp.State != StateQueued && imp.State != StateRunning {
+		return nil
+	}
+	x, ok := i.importers[imp.Importer]
+	if !ok {
+		return fmt.Errorf("imports: %s: %s is not registered", id, imp.Importer)
+	}
+
+	imp.State = StateRunning
+	if err := i.Store.Update(ctx, imp); err != nil {
+		return fmt.Errorf("imports: %s: %w", id, err)
+	}
+	i.publish(imp)
+
+	if err := i.process(withOwner(ctx, imp.Owner), x, imp); err != nil {
+		var readErr *readError
+		if !errors.As(err, &readErr) {
+			return fmt.Errorf("imports: %s: %w", id, err)
+		}
+		imp.State, imp.Error = StateFailed, readErr.Error()
+	} else {
+		imp.State = StateDone
+	}
+	finished := clock.Or(i.Clock).Now()
+	imp.FinishedAt = &finished
+	if err := i.Store.Update(ctx, imp); err != nil {
+		return fmt.Errorf("imports: %s: %w", id, err)
+	}
+	i.remove(ctx, id)
+	i.release(ctx, imp.Owner, id)
+	i.publish(imp)
+	log.Printf("Imports: %s id=%s imported=%d failed=%d", imp.State, id, imp.Imported, imp.Failed)
+	return nil
+}
+
+// readError is a file that can't be read, which fails the import rather
+// than the job.
+type readError struct{ err error }
+
+func (e *readError) Error() string { return e.err.Error() }
+
+// process runs the rows of imp not yet processed through x, saving its
+// progress after every batch.
+func (i *Imports) process(ctx context.Context, x Importer, imp *Import) error {
+	f, err := i.open(ctx, imp.ID)
+	if err != nil {
+		return &readError{fmt.Errorf("the uploaded file is gone: %w", err)}
+	}
+	defer f.Close()
+	r := newReader(f)
+	if _, err := r.Read(); err != nil {
+		return &readError{err}
+	}
+
+	var batch []RowError
+	save := func() error {
+		if len(batch) > 0 {
+			if err := i.Store.AddErrors(ctx, imp.ID, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if err := i.Store.Update(ctx, imp); err != nil {
+			return err
+		}
+		i.publish(imp)
+		return nil
+	}
+
+	for n := 0; ; n++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &readError{err}
+		}
+		if n < imp.Processed {
+			continue // done before the job was retried
+		}
+
+		line, _ := r.FieldPos(0)
+		errs := i.row(ctx, x, imp, record)
+		for _, e := range errs {
+			batch = append(batch, RowError{Line: line, Field: e.Field, Message: e.Message})
+		}
+		if len(errs) > 0 {
+			imp.Failed++
+		} else {
+			imp.Imported++
+		}
+		imp.Processed++
+		if imp.Processed%batchSize == 0 {
+			if err := save(); err != nil {
+				return err
+			}
+		}
+	}
+	return save()
+}
+
+// row validates and processes one record, returning why it failed.
+func (i *Imports) row(ctx context.Context, x Importer, imp *Import, record []string) []FieldError {
+	row := make(Row, len(x.Fields))
+	var errs []FieldError
+	for _, f := range x.Fields {
+		if column, ok := imp.Mapping[f.Name]; ok && column < len(record) {
+			row[f.Name] = strings.TrimSpace(record[column])
+		}
+		if f.Required && row[f.Name] == "" {
+			errs = append(errs, FieldError{Field: f.Name, Message: "is required"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if x.Validate != nil {
+		if errs := x.Validate(ctx, row); len(errs) > 0 {
+			return errs
+		}
+	}
+	if err := x.Process(ctx, row); err != nil {
+		var fieldErr FieldError
+		if errors.As(err, &fieldErr) {
+			return []FieldError{fieldErr}
+		}
+		return []FieldError{{Message: err.Error()}}
+	}
+	return nil
+}
+
+// publish pushes imp's progress to its status page.
+func (i *Imports) publish(imp *Import) {
+	if i.Publisher != nil {
+		i.Publisher.BroadcastChannel(imp.Channel, progressEvent(imp.ID), []byte(progressHTML(imp)))
+	}
+}
+
+// progressEvent is the SSE event an import's progress is pushed as.
+func progressEvent(id string) string {
+	return "import:" + id
+}
+
+// progressHTML shows imp's progress. The status page reloads for the
+// results when it gets one with data-finished.
+func progressHTML(imp *Import) string {
+	var b strings.Builder
+	b.WriteString(`<div class="bk-import-progress"`)
+	if imp.Finished() {
+		b.WriteString(` data-finished`)
+	}
+	fmt.Fprintf(&b, `><progress value="%d" max="%d"></progress> <span>%d of %d rows`, imp.Processed, imp.Total, imp.Processed, imp.Total)
+	if imp.Failed > 0 {
+		fmt.Fprintf(&b, `, %d failed`, imp.Failed)
+	}
+	fmt.Fprintf(&b, `</span> <span class="bk-import-state">%s</span></div>`, html.EscapeString(string(imp.State)))
+	return b.String()
+}
+
+// release frees the quota of the import's file, once it's removed.
+// Failing to is logged: the upload has been handled either way.
+func (i *Imports) release(ctx context.Context, owner, id string) {
+	if i.Quota == nil {
+		return
+	}
+	if err := i.Quota.Release(ctx, quotaUser(ctx, owner), quotaItem(id)); err != nil {
+		log.Printf("Imports: release quota id=%s: %v", id, err)
+	}
+}
+
+// quotaUser is the ID of the owner, whose quota the import's file
+// counts against. Owners are kept by email, which can change.
+func quotaUser(ctx context.Context, owner string) string {
+	if store := auth.GetStore(); store != nil {
+		if user, err := store.ByEmail(ctx, owner); err == nil {
+			return user.ID
+		}
+	}
+	return owner
+}
+
+// quotaItem names an import's file in the uploader's quota.
+func quotaItem(id string) string {
+	return "import:" + id
+}
+
+// save writes an upload to the file store.
+func (i *Imports) save(ctx context.Context, id string, r io.Reader) error {
+	store, key := i.file(id)
+	return store.Put(ctx, key, r, "text/csv")
+}
+
+// open opens the upload for id.
+func (i *Imports) open(ctx context.Context, id string) (io.ReadCloser, error) {
+	store, key := i.file(id)
+	f, _, err := store.Get(ctx, key)
+	return f, err
+}
+
+// remove deletes the upload for id.
+func (i *Imports) remove(ctx context.Context, id string) {
+	store, key := i.file(id)
+	if err := store.Delete(ctx, key); err != nil {
+		log.Printf("Imports: remove file id=%s error=%v", id, err)
+	}
+}
+
+// scan reads the header of the upload for id and counts its rows, which
+// also checks the whole file can be read before it's queued.
+func (i *Imports) scan(ctx context.Context, id string) ([]string, int, error) {
+	f, err := i.open(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	r := newReader(f)
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, 0, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	header = append([]string(nil), header...) // the reader reuses its records
+	for n, name := range header {
+		header[n] = strings.TrimSpace(name)
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff") // Excel's byte order mark
+
+	total := 0
+	for {
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		total++
+	}
+	if total == 0 {
+		return nil, 0, errors.New("the file has no rows after its header")
+	}
+	return header, total, nil
+}
+
+// newReader reads CSV as spreadsheets write it, with rows of any length.
+func newReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	return cr
+}
+
+// guessMapping maps each field to the column whose name matches its name
+// or label, ignoring case, spaces and punctuation.
+func guessMapping(fields []Field, header []string) map[string]int {
+	normalize := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, s)
+	}
+	mapping := make(map[string]int)
+	for _, f := range fields {
+		for column, name := range header {
+			if n := normalize(name); n != "" && (n == normalize(f.Name) || n == normalize(f.Label)) {
+				mapping[f.Name] = column
+				break
+			}
+		}
+	}
+	return mapping
+}
+
+func sizeMessage(max int64) string {
+	return fmt.Sprintf("The file must be at most %d MB", max>>20)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("imports: id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (i *Imports) importPath(imp *Import) string {
+	return i.path() + "/" + imp.Importer + "/" + imp.ID
+}
+
+// file returns the store that keeps the upload for id and its key there.
+func (i *Imports) file(id string) (blob.Store, string) {
+	if i.Files != nil {
+		return i.Files, blob.TempPrefix + "imports/" + id + ".csv"
+	}
+	return blob.NewDirStore(i.dir()), id + ".csv"
+}
+
+func (i *Imports) dir() string {
+	if i.Dir != "" {
+		return i.Dir
+	}
+	return filepath.Join(os.TempDir(), "buffkit-imports")
+}
+
+func (i *Imports) path() string {
+	if i.Path != "" {
+		return strings.TrimSuffix(i.Path, "/")
+	}
+	return "/imports"
+}
+
+func (i *Imports) maxSize() int64 {
+	if i.MaxSize > 0 {
+		return i.MaxSize
+	}
+	return DefaultMaxSize
+}
+
+type ownerKey struct{}
+
+func withOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// Owner returns the email of the user whose import a Validate or Process
+// call is for.
+func Owner(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	return owner
+}
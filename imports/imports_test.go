@@ -0,0 +1,336 @@
+package imports_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/imports"
+	"github.com/johnjansen/buffkit/quota"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublisher records pushed progress.
+type fakePublisher struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (p *fakePublisher) BroadcastChannel(channel, eventName string, html []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, eventName+" "+string(html))
+}
+
+type fixture struct {
+	app       *buffkittest.App
+	client    *buffkittest.Client
+	imports   *imports.Imports
+	publisher *fakePublisher
+	saved     map[string]string // email -> name
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	app := buffkittest.NewApp(t, buffkittest.Options{Jobs: true, Config: buffkit.Config{}})
+	require.NotNil(t, app.Kit.Imports)
+
+	user := &auth.User{Email: "ada@example.com", DisplayName: "Ada"}
+	require.NoError(t, app.Kit.AuthStore.Create(context.Background(), user))
+
+	f := &fixture{app: app, client: buffkittest.LoginAs(t, app, user), imports: app.Kit.Imports,
+		publisher: &fakePublisher{}, saved: make(map[string]string)}
+	f.imports.Publisher = f.publisher
+	f.imports.Dir = t.TempDir()
+	require.NoError(t, f.imports.Register(imports.Importer{
+		Name: "contacts",
+		Fields: []imports.Field{
+			{Name: "email", Label: "Email address", Required: true},
+			{Name: "name", Label: "Full name"},
+		},
+		Validate: func(ctx context.Context, row imports.Row) []imports.FieldError {
+			if !strings.Contains(row["email"], "@") {
+				return []imports.FieldError{{Field: "email", Message: "is not an email address"}}
+			}
+			return nil
+		},
+		Process: func(ctx context.Context, row imports.Row) error {
+			assert.Equal(t, "ada@example.com", imports.Owner(ctx))
+			if row["name"] == "Taken" {
+				return errors.New("already exists")
+			}
+			f.saved[row["email"]] = row["name"]
+			return nil
+		},
+	}))
+	return f
+}
+
+func (f *fixture) upload(client *buffkittest.Client, name, data string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", name)
+	_, _ = part.Write([]byte(data))
+	_ = w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/imports/contacts", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return client.Do(req)
+}
+
+const contactsCSV = "\ufeffE-mail Address,Full Name,Notes\n" +
+	"grace@example.com,Grace,\n" +
+	"not-an-email,Nobody,\n" +
+	"linus@example.com,Taken,\n" +
+	",Blank,\n" +
+	"barbara@example.com,\"Liskov, Barbara\",\"likes \"\"CLU\"\"\"\n"
+
+func TestImport(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	res := f.client.Get("/imports/contacts")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertElement(t, res.Body.String(), "input", "type", "file", "name", "file")
+	buffkittest.AssertText(t, res.Body.String(), "Email address (required)")
+
+	res = f.upload(f.client, "contacts.csv", contactsCSV)
+	require.Equal(t, http.StatusSeeOther, res.Code, res.Body.String())
+	path := res.Header().Get("Location")
+	require.True(t, strings.HasPrefix(path, "/imports/contacts/"), path)
+	id := strings.TrimPrefix(path, "/imports/contacts/")
+
+	imp, err := f.imports.Store.Import(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, imports.StateMapping, imp.State)
+	assert.Equal(t, []string{"E-mail Address", "Full Name", "Notes"}, imp.Header)
+	assert.Equal(t, 5, imp.Total)
+	assert.Equal(t, "contacts.csv", imp.Filename)
+
+	// Columns are guessed from their names
+	res = f.client.Get(path)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertElement(t, res.Body.String(), "select", "name", "map[email]")
+	buffkittest.AssertElement(t, res.Body.String(), "option", "value", "1", "selected", "")
+	assert.Equal(t, 2, buffkittest.CountElements(res.Body.String(), "option", "selected", ""))
+
+	res = f.client.Post(path, url.Values{"map[email]": {""}, "map[name]": {"1"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "Choose the column for Email address")
+
+	res = f.client.Post(path, url.Values{"map[email]": {"0"}, "map[name]": {"1"}})
+	buffkittest.AssertRedirect(t, res, path)
+	imp, err = f.imports.Store.Import(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, imports.StateQueued, imp.State)
+
+	res = f.client.Get(path)
+	require.Equal(t, http.StatusOK, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "0 of 5 rows")
+	assert.Contains(t, res.Body.String(), `addEventListener("import:`+id+`"`)
+
+	require.NoError(t, f.imports.Run(ctx, id))
+	assert.Equal(t, map[string]string{"grace@example.com": "Grace", "barbara@example.com": "Liskov, Barbara"}, f.saved)
+	require.NotEmpty(t, f.publisher.events)
+	last := f.publisher.events[len(f.publisher.events)-1]
+	assert.True(t, strings.HasPrefix(last, "import:"+id+" "), last)
+	assert.Contains(t, last, "data-finished")
+	assert.Contains(t, last, "5 of 5 rows, 3 failed")
+	_, err = os.Stat(f.imports.Dir + "/" + id + ".csv")
+	assert.True(t, os.IsNotExist(err), "the upload is removed when done")
+
+	res = f.client.Get(path)
+	require.Equal(t, http.StatusOK, res.Code)
+	body := res.Body.String()
+	buffkittest.AssertText(t, body, "2 imported, 3 failed, of 5 rows.")
+	buffkittest.AssertText(t, body, "is not an email address")
+	buffkittest.AssertText(t, body, "already exists")
+	buffkittest.AssertText(t, body, "is required")
+	assert.NotContains(t, body, "EventSource")
+
+	res = f.client.Get(path + "/errors.csv")
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "attachment; filename=contacts-errors.csv", res.Header().Get("Content-Disposition"))
+	assert.Equal(t, "Line,Field,Error\n3,email,is not an email address\n4,,already exists\n5,email,is required\n", res.Body.String())
+
+	// A finished import isn't run again
+	require.NoError(t, f.imports.Run(ctx, id))
+	assert.Len(t, f.saved, 2)
+}
+
+func TestUploadErrors(t *testing.T) {
+	f := newFixture(t)
+
+	for _, tc := range []struct{ name, data, message string }{
+		{"empty", "", "the file is empty"},
+		{"header only", "email,name\n", "no rows after its header"},
+		{"bad quotes", "email,name\n\"ada@example.com,Ada\n", "Couldn't read the file"},
+	} {
+		res := f.upload(f.client, "contacts.csv", tc.data)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code, tc.name)
+		buffkittest.AssertText(t, res.Body.String(), tc.message)
+	}
+	files, _ := os.ReadDir(f.imports.Dir)
+	assert.Empty(t, files, "rejected uploads aren't kept")
+
+	f.imports.MaxSize = 1 << 20
+	res := f.upload(f.client, "big.csv", "email\n"+strings.Repeat("a@example.com\n", 100000))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "at most 1 MB")
+
+	assert.Equal(t, http.StatusNotFound, f.client.Get("/imports/invoices").Code)
+	buffkittest.AssertRedirect(t, f.app.Client().Get("/imports/contacts"), "/login")
+
+	// Only the uploader sees an import
+	res = f.upload(f.client, "contacts.csv", contactsCSV)
+	path := res.Header().Get("Location")
+	grace := &auth.User{Email: "grace@example.com"}
+	require.NoError(t, f.app.Kit.AuthStore.Create(context.Background(), grace))
+	other := buffkittest.LoginAs(t, f.app, grace)
+	assert.Equal(t, http.StatusNotFound, other.Get(path).Code)
+	assert.Equal(t, http.StatusNotFound, other.Post(path, url.Values{"map[email]": {"0"}}).Code)
+	assert.Equal(t, http.StatusNotFound, f.client.Get(strings.Replace(path, "contacts", "invoices", 1)).Code)
+}
+
+func TestUploadQuota(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	f.imports.Quota = quota.New(quota.NewMemoryStore(), int64(len(contactsCSV))+10)
+	user, err := f.app.Kit.AuthStore.ByEmail(ctx, "ada@example.com")
+	require.NoError(t, err)
+
+	res := f.upload(f.client, "contacts.csv", contactsCSV)
+	require.Equal(t, http.StatusSeeOther, res.Code, res.Body.String())
+	path := res.Header().Get("Location")
+	id := strings.TrimPrefix(path, "/imports/contacts/")
+	used, _, err := f.imports.Quota.Usage(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contactsCSV)), used)
+
+	// Waiting files count until they're imported
+	res = f.upload(f.client, "more.csv", contactsCSV)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "You don't have room for this upload")
+
+	buffkittest.AssertRedirect(t, f.client.Post(path, url.Values{"map[email]": {"0"}, "map[name]": {"1"}}), path)
+	require.NoError(t, f.imports.Run(ctx, id))
+	used, _, err = f.imports.Quota.Usage(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Zero(t, used)
+	assert.Equal(t, http.StatusSeeOther, f.upload(f.client, "more.csv", contactsCSV).Code)
+}
+
+func TestRunResumes(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	res := f.upload(f.client, "contacts.csv", contactsCSV)
+	id := strings.TrimPrefix(res.Header().Get("Location"), "/imports/contacts/")
+	imp, err := f.imports.Store.Import(ctx, id)
+	require.NoError(t, err)
+
+	// A retried job carries on after the rows it saved
+	imp.State, imp.Processed, imp.Imported = imports.StateRunning, 4, 1
+	require.NoError(t, f.imports.Store.Update(ctx, imp))
+	require.NoError(t, f.imports.Run(ctx, id))
+	assert.Equal(t, map[string]string{"barbara@example.com": "Liskov, Barbara"}, f.saved)
+
+	imp, err = f.imports.Store.Import(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, imports.StateDone, imp.State)
+	assert.Equal(t, 5, imp.Processed)
+	assert.Equal(t, 2, imp.Imported)
+	require.NotNil(t, imp.FinishedAt)
+
+	// An import whose file is gone fails, rather than retrying forever
+	res = f.upload(f.client, "contacts.csv", contactsCSV)
+	id = strings.TrimPrefix(res.Header().Get("Location"), "/imports/contacts/")
+	imp, err = f.imports.Store.Import(ctx, id)
+	require.NoError(t, err)
+	imp.State = imports.StateQueued
+	require.NoError(t, f.imports.Store.Update(ctx, imp))
+	require.NoError(t, os.Remove(f.imports.Dir+"/"+id+".csv"))
+	require.NoError(t, f.imports.Run(ctx, id))
+	imp, err = f.imports.Store.Import(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, imports.StateFailed, imp.State)
+	assert.Contains(t, imp.Error, "the uploaded file is gone")
+}
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	schema, err := os.ReadFile("../db/migrations/imports/20261017090000_create_imports.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for name, store := range map[string]imports.Store{
+		"memory": imports.NewMemoryStore(),
+		"sql":    imports.NewSQLStore(db, "sqlite"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			created := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+			imp := &imports.Import{ID: "imp-" + name, Importer: "contacts", Owner: "ada@example.com", Filename: "c.csv",
+				Header: []string{"Email", "Name"}, Mapping: map[string]int{"email": 0}, State: imports.StateMapping,
+				Total: 3, CreatedAt: created}
+			require.NoError(t, store.Create(ctx, imp))
+
+			got, err := store.Import(ctx, imp.ID)
+			require.NoError(t, err)
+			assert.Equal(t, imp.Header, got.Header)
+			assert.Equal(t, imp.Mapping, got.Mapping)
+			assert.Nil(t, got.FinishedAt)
+
+			finished := created.Add(time.Minute)
+			got.State, got.Processed, got.Failed, got.FinishedAt = imports.StateDone, 3, 2, &finished
+			got.Mapping["name"] = 1
+			require.NoError(t, store.Update(ctx, got))
+			require.NoError(t, store.AddErrors(ctx, imp.ID, []imports.RowError{
+				{Line: 4, Field: "email", Message: "is required"},
+				{Line: 2, Field: "email", Message: "is not an email address"},
+				{Line: 2, Field: "name", Message: "is too long"},
+			}))
+
+			got, err = store.Import(ctx, imp.ID)
+			require.NoError(t, err)
+			assert.Equal(t, imports.StateDone, got.State)
+			assert.Equal(t, 2, got.Failed)
+			assert.Equal(t, map[string]int{"email": 0, "name": 1}, got.Mapping)
+			require.NotNil(t, got.FinishedAt)
+			assert.True(t, finished.Equal(*got.FinishedAt))
+
+			errs, err := store.Errors(ctx, imp.ID, 0)
+			require.NoError(t, err)
+			assert.Equal(t, []imports.RowError{
+				{Line: 2, Field: "email", Message: "is not an email address"},
+				{Line: 2, Field: "name", Message: "is too long"},
+				{Line: 4, Field: "email", Message: "is required"},
+			}, errs)
+			errs, err = store.Errors(ctx, imp.ID, 1)
+			require.NoError(t, err)
+			assert.Len(t, errs, 1)
+
+			_, err = store.Import(ctx, "missing")
+			assert.ErrorIs(t, err, imports.ErrNotFound)
+			assert.ErrorIs(t, store.Update(ctx, &imports.Import{ID: "missing"}), imports.ErrNotFound)
+		})
+	}
+}
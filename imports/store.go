@@ -0,0 +1,267 @@
+package imports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// MemoryStore keeps imports in memory, for tests and development.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	imports map[string]*Import
+	errors  map[string][]RowError
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		imports: make(map[string]*Import),
+		errors:  make(map[string][]RowError),
+	}
+}
+
+// clone copies imp, so callers can't change what's stored.
+func clone(imp *Import) *Import {
+	copied := *imp
+	copied.Header = append([]string(nil), imp.Header...)
+	copied.Mapping = make(map[string]int, len(imp.Mapping))
+	for k, v := range imp.Mapping {
+		copied.Mapping[k] = v
+	}
+	return &copied
+}
+
+func (s *MemoryStore) Create(ctx context.Context, imp *Import) error {
+	if err := readonly.Check("imports.Create"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.imports[imp.ID] = clone(imp)
+	return nil
+}
+
+func (s *MemoryStore) Import(ctx context.Context, id string) (*Import, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	imp, ok := s.imports[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(imp), nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, imp *Import) error {
+	if err := readonly.Check("imports.Update"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.imports[imp.ID]; !ok {
+		return ErrNotFound
+	}
+	s.imports[imp.ID] = clone(imp)
+	return nil
+}
+
+func (s *MemoryStore) AddErrors(ctx context.Context, id string, errs []RowError) error {
+	if err := readonly.Check("imports.AddErrors"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.imports[id]; !ok {
+		return ErrNotFound
+	}
+	s.errors[id] = append(s.errors[id], errs...)
+	return nil
+}
+
+func (s *MemoryStore) Errors(ctx context.Context, id string, limit int) ([]RowError, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := append([]RowError(nil), s.errors[id]...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Line < out[j].Line })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// SQLStore keeps imports in the imports and import_errors tables created
+// by the db/migrations/imports migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates an import store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) Create(ctx context.Context, imp *Import) error {
+	if err := readonly.Check("imports.Create"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	header, mapping, err := encode(imp)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO imports (id, importer, owner, filename, channel, header, mapping, state, error, total, processed, imported, failed, created_at, finished_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		imp.ID, imp.Importer, imp.Owner, imp.Filename, imp.Channel, header, mapping, string(imp.State), imp.Error,
+		imp.Total, imp.Processed, imp.Imported, imp.Failed, imp.CreatedAt, imp.FinishedAt)
+	return err
+}
+
+func (s *SQLStore) Import(ctx context.Context, id string) (*Import, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var imp Import
+	var header, mapping, state string
+	var finishedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT id, importer, owner, filename, channel, header, mapping, state, error, total, processed, imported, failed, created_at, finished_at FROM imports WHERE id = ?"), id).
+		Scan(&imp.ID, &imp.Importer, &imp.Owner, &imp.Filename, &imp.Channel, &header, &mapping, &state, &imp.Error,
+			&imp.Total, &imp.Processed, &imp.Imported, &imp.Failed, &imp.CreatedAt, &finishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(header), &imp.Header); err != nil {
+		return nil, fmt.Errorf("import %s: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(mapping), &imp.Mapping); err != nil {
+		return nil, fmt.Errorf("import %s: %w", id, err)
+	}
+	imp.State = State(state)
+	if finishedAt.Valid {
+		imp.FinishedAt = &finishedAt.Time
+	}
+	return &imp, nil
+}
+
+func (s *SQLStore) Update(ctx context.Context, imp *Import) error {
+	if err := readonly.Check("imports.Update"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	_, mapping, err := encode(imp)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"UPDATE imports SET mapping = ?, state = ?, error = ?, total = ?, processed = ?, imported = ?, failed = ?, finished_at = ? WHERE id = ?"),
+		mapping, string(imp.State), imp.Error, imp.Total, imp.Processed, imp.Imported, imp.Failed, imp.FinishedAt, imp.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) AddErrors(ctx context.Context, id string, errs []RowError) error {
+	if err := readonly.Check("imports.AddErrors"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	insert, err := tx.PrepareContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO import_errors (import_id, line, position, field, message) VALUES (?, ?, ?, ?, ?)"))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	// A row's errors are always added together, so their positions on
+	// the line start from 0
+	positions := make(map[int]int)
+	for _, e := range errs {
+		position := positions[e.Line]
+		positions[e.Line]++
+		if _, err := insert.ExecContext(ctx, id, e.Line, position, e.Field, e.Message); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Errors(ctx context.Context, id string, limit int) ([]RowError, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	query := "SELECT line, field, message FROM import_errors WHERE import_id = ? ORDER BY line, position"
+	args := []any{id}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []RowError
+	for rows.Next() {
+		var e RowError
+		if err := rows.Scan(&e.Line, &e.Field, &e.Message); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// encode returns imp's header and mapping as JSON.
+func encode(imp *Import) (string, string, error) {
+	header, err := json.Marshal(imp.Header)
+	if err != nil {
+		return "", "", err
+	}
+	mapping := imp.Mapping
+	if mapping == nil {
+		mapping = map[string]int{}
+	}
+	data, err := json.Marshal(mapping)
+	if err != nil {
+		return "", "", err
+	}
+	return string(header), string(data), nil
+}
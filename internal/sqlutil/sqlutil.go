@@ -0,0 +1,28 @@
+// Package sqlutil holds the small SQL helpers Buffkit's database/sql
+// stores share.
+package sqlutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rebind rewrites ? placeholders to $n when dialect is "postgres" and
+// returns query unchanged otherwise, so stores can write their queries
+// once for every dialect.
+func Rebind(dialect, query string) string {
+	if dialect != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,15 @@
+package sqlutil_test
+
+import (
+	"testing"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebind(t *testing.T) {
+	q := "SELECT * FROM t WHERE a = ? AND b = ?"
+	assert.Equal(t, q, sqlutil.Rebind("sqlite", q))
+	assert.Equal(t, q, sqlutil.Rebind("mysql", q))
+	assert.Equal(t, "SELECT * FROM t WHERE a = $1 AND b = $2", sqlutil.Rebind("postgres", q))
+}
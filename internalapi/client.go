@@ -0,0 +1,119 @@
+package internalapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client calls a Buffkit app's internal API from another Go service.
+type Client struct {
+	// BaseURL is the app's URL, with its MountPath if it has one.
+	BaseURL string
+
+	// Token is the app's Config.InternalAPIToken.
+	Token string
+
+	// Path is where the app mounts the endpoints. Defaults to
+	// "/internal".
+	Path string
+
+	// HTTPClient sends the requests. Defaults to a client with a 10
+	// second timeout.
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Client for the app at baseURL.
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: baseURL, Token: token}
+}
+
+// defaultHTTPClient sends requests for clients without an HTTPClient.
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Broadcast sends event, with html as its data, to the clients on
+// channel. An empty channel sends to every connected client.
+func (c *Client) Broadcast(ctx context.Context, channel, event, html string) error {
+	return c.post(ctx, "/broadcast", Broadcast{Channel: channel, Event: event, HTML: html})
+}
+
+// Enqueue queues a job of taskType with payload, which is marshaled to
+// JSON, to run straight away on the default queue.
+func (c *Client) Enqueue(ctx context.Context, taskType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("internalapi: %s payload: %w", taskType, err)
+	}
+	return c.EnqueueJob(ctx, Job{Type: taskType, Payload: data})
+}
+
+// EnqueueJob queues job, with its queue and run time.
+func (c *Client) EnqueueJob(ctx context.Context, job Job) error {
+	return c.post(ctx, "/jobs", job)
+}
+
+// post sends body as JSON to the endpoint at path, returning an *Error
+// if the app refused it.
+func (c *Client) post(ctx context.Context, path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("internalapi: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(path), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("internalapi: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("internalapi: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return errorFrom(res)
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+func (c *Client) url(path string) string {
+	prefix := c.Path
+	if prefix == "" {
+		prefix = "/internal"
+	}
+	return strings.TrimSuffix(c.BaseURL, "/") + prefix + path
+}
+
+// Error is a request the app refused, returned by Client.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("internalapi: %d %s", e.Status, e.Message)
+}
+
+// errorFrom reads the error response res into an *Error.
+func errorFrom(res *http.Response) error {
+	var body errorBody
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err := json.Unmarshal(data, &body); err != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(data))
+	}
+	if body.Error == "" {
+		body.Error = http.StatusText(res.StatusCode)
+	}
+	return &Error{Status: res.StatusCode, Message: body.Error}
+}
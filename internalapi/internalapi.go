@@ -0,0 +1,204 @@
+// Package internalapi lets other services, written in any language,
+// broadcast SSE events to a Buffkit app's pages and enqueue its jobs,
+// over authenticated HTTP with JSON bodies:
+//
+//	POST /internal/broadcast  {"channel": "user:7", "event": "order-shipped", "html": "<p>Shipped</p>"}
+//	POST /internal/jobs       {"type": "report:build", "payload": {"month": "2026-10"}, "queue": "low"}
+//
+// Both need "Authorization: Bearer <token>" and answer 202 Accepted, or
+// an {"error": "..."} body. Wire mounts them when Config.InternalAPIToken
+// is set. Services can only enqueue the task types in Server.Tasks:
+//
+//	kit.InternalAPI.Tasks = []string{"report:build"}
+//
+// Go services call them with Client:
+//
+//	api := internalapi.NewClient("https://app.internal", os.Getenv("BUFFKIT_INTERNAL_TOKEN"))
+//	err := api.Broadcast(ctx, "user:7", "order-shipped", "<p>Shipped</p>")
+//	err = api.Enqueue(ctx, "report:build", map[string]string{"month": "2026-10"})
+package internalapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// DefaultMaxBody is the largest request body the endpoints read.
+const DefaultMaxBody = 1 << 20 // 1 MiB
+
+// Publisher pushes events over SSE; *ssr.Broker implements it.
+type Publisher interface {
+	BroadcastChannel(channel, eventName string, html []byte)
+}
+
+// Queue is the jobs runtime jobs are enqueued on; *jobs.Runtime
+// implements it.
+type Queue interface {
+	Enqueue(taskType string, payload interface{}, opts ...asynq.Option) error
+}
+
+// Broadcast is the body of a broadcast request.
+type Broadcast struct {
+	// Channel is the SSE channel to send to. Empty sends to every
+	// connected client.
+	Channel string `json:"channel,omitempty"`
+	Event   string `json:"event"`
+	HTML    string `json:"html"`
+}
+
+// Job is the body of a job request.
+type Job struct {
+	Type string `json:"type"`
+
+	// Payload is passed to the job's handler as its task payload.
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// Queue is the queue the job goes on. Empty uses "default".
+	Queue string `json:"queue,omitempty"`
+
+	// RunAt delays the job until then. Nil runs it straight away.
+	RunAt *time.Time `json:"run_at,omitempty"`
+}
+
+// Server serves the internal API.
+type Server struct {
+	// Token is the bearer token services send. An empty token rejects
+	// every request.
+	Token string
+
+	Publisher Publisher
+
+	// Queue enqueues jobs. Nil answers job requests with 503.
+	Queue Queue
+
+	// Tasks are the task types services may enqueue. Others are refused
+	// with 403, so a leaked token can't run jobs that were never meant
+	// to be called from outside.
+	Tasks []string
+
+	// Path is where Mount puts the endpoints. Defaults to "/internal".
+	Path string
+
+	// MaxBody limits request bodies, in bytes. Defaults to
+	// DefaultMaxBody.
+	MaxBody int64
+}
+
+// New creates a Server that broadcasts through publisher and enqueues
+// jobs on queue.
+func New(token string, publisher Publisher, queue Queue) *Server {
+	return &Server{Token: token, Publisher: publisher, Queue: queue, Path: "/internal"}
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (s *Server) Routes() [][2]string {
+	return [][2]string{
+		{http.MethodPost, s.Path + "/broadcast"},
+		{http.MethodPost, s.Path + "/jobs"},
+	}
+}
+
+// Mount adds the endpoints to app, both behind the bearer token.
+func (s *Server) Mount(app *buffalo.App) {
+	requireToken := secure.RequireBearer(s.Token, "internal", unauthorized)
+	app.POST(s.Path+"/broadcast", requireToken(s.HandleBroadcast))
+	app.POST(s.Path+"/jobs", requireToken(s.HandleJob))
+}
+
+// HandleBroadcast sends the requested event to the channel's clients.
+func (s *Server) HandleBroadcast(c buffalo.Context) error {
+	var b Broadcast
+	if err := s.decode(c, &b); err != nil {
+		return writeError(c, http.StatusBadRequest, err.Error())
+	}
+	if b.Event == "" {
+		return writeError(c, http.StatusUnprocessableEntity, "event is required")
+	}
+	if strings.ContainsAny(b.Event, "\r\n") {
+		return writeError(c, http.StatusUnprocessableEntity, "event can't contain line breaks")
+	}
+	s.Publisher.BroadcastChannel(b.Channel, b.Event, []byte(b.HTML))
+	return writeJSON(c, http.StatusAccepted, map[string]string{"status": "sent"})
+}
+
+// HandleJob enqueues the requested job.
+func (s *Server) HandleJob(c buffalo.Context) error {
+	if s.Queue == nil {
+		return writeError(c, http.StatusServiceUnavailable, "jobs aren't configured")
+	}
+	var j Job
+	if err := s.decode(c, &j); err != nil {
+		return writeError(c, http.StatusBadRequest, err.Error())
+	}
+	if j.Type == "" {
+		return writeError(c, http.StatusUnprocessableEntity, "type is required")
+	}
+	if !slices.Contains(s.Tasks, j.Type) {
+		return writeError(c, http.StatusForbidden, fmt.Sprintf("%s can't be enqueued through the internal API", j.Type))
+	}
+
+	var opts []asynq.Option
+	if j.Queue != "" {
+		opts = append(opts, asynq.Queue(j.Queue))
+	}
+	if j.RunAt != nil {
+		opts = append(opts, asynq.ProcessAt(*j.RunAt))
+	}
+	payload := j.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	if err := s.Queue.Enqueue(j.Type, payload, opts...); err != nil {
+		return writeError(c, http.StatusBadGateway, err.Error())
+	}
+	return writeJSON(c, http.StatusAccepted, map[string]string{"status": "queued"})
+}
+
+// decode reads the JSON request body into v.
+func (s *Server) decode(c buffalo.Context, v any) error {
+	max := s.MaxBody
+	if max <= 0 {
+		max = DefaultMaxBody
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, max+1))
+	if err != nil {
+		return fmt.Errorf("can't read the body: %w", err)
+	}
+	if int64(len(body)) > max {
+		return fmt.Errorf("the body is over %d bytes", max)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("the body isn't valid JSON: %w", err)
+	}
+	return nil
+}
+
+// unauthorized answers requests without the bearer token.
+func unauthorized(c buffalo.Context) error {
+	return writeError(c, http.StatusUnauthorized, "missing or invalid bearer token")
+}
+
+// errorBody is the body of an error response.
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func writeError(c buffalo.Context, status int, message string) error {
+	return writeJSON(c, status, errorBody{Error: message})
+}
+
+func writeJSON(c buffalo.Context, status int, v any) error {
+	w := c.Response()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,178 @@
+package internalapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/internalapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const token = "internal-token"
+
+type published struct {
+	channel, event, html string
+}
+
+type fakePublisher struct {
+	mu     sync.Mutex
+	events []published
+}
+
+func (p *fakePublisher) BroadcastChannel(channel, eventName string, html []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, published{channel, eventName, string(html)})
+}
+
+type queued struct {
+	taskType string
+	payload  string
+	opts     []asynq.Option
+}
+
+type fakeQueue struct {
+	mu   sync.Mutex
+	jobs []queued
+	err  error
+}
+
+func (q *fakeQueue) Enqueue(taskType string, payload interface{}, opts ...asynq.Option) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return q.err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	q.jobs = append(q.jobs, queued{taskType, string(data), opts})
+	return nil
+}
+
+// newServer serves an internal API over HTTP, for Client to call.
+func newServer(t *testing.T) (*internalapi.Server, *fakePublisher, *fakeQueue, *httptest.Server) {
+	t.Helper()
+	pub, queue := &fakePublisher{}, &fakeQueue{}
+	s := internalapi.New(token, pub, queue)
+	s.Tasks = []string{"report:build"}
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	s.Mount(app)
+	srv := httptest.NewServer(app)
+	t.Cleanup(srv.Close)
+	return s, pub, queue, srv
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	_, pub, queue, srv := newServer(t)
+	client := internalapi.NewClient(srv.URL+"/", token)
+
+	require.NoError(t, client.Broadcast(ctx, "user:7", "order-shipped", "<p>Shipped</p>"))
+	assert.Equal(t, []published{{"user:7", "order-shipped", "<p>Shipped</p>"}}, pub.events)
+
+	require.NoError(t, client.Enqueue(ctx, "report:build", map[string]string{"month": "2026-10"}))
+	runAt := time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC)
+	require.NoError(t, client.EnqueueJob(ctx, internalapi.Job{Type: "report:build", Queue: "low", RunAt: &runAt}))
+	require.Len(t, queue.jobs, 2)
+	assert.Equal(t, "report:build", queue.jobs[0].taskType)
+	assert.JSONEq(t, `{"month": "2026-10"}`, queue.jobs[0].payload)
+	assert.Empty(t, queue.jobs[0].opts)
+	assert.JSONEq(t, `{}`, queue.jobs[1].payload, "a job without a payload gets an empty object")
+	assert.Len(t, queue.jobs[1].opts, 2, "queue and run time are passed on")
+
+	var apiErr *internalapi.Error
+	err := client.Enqueue(ctx, "users:delete_all", nil)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.Status, "only listed task types can be enqueued")
+	assert.Contains(t, apiErr.Message, "users:delete_all")
+
+	err = client.Broadcast(ctx, "", "", "<p>no event</p>")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.Status)
+
+	queue.err = errors.New("redis is down")
+	err = client.Enqueue(ctx, "report:build", nil)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.Status)
+
+	err = internalapi.NewClient(srv.URL, "wrong").Broadcast(ctx, "", "ping", "")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.Status)
+	assert.Len(t, pub.events, 1, "nothing was sent without the token")
+}
+
+func TestRequests(t *testing.T) {
+	s, _, _, srv := newServer(t)
+	s.MaxBody = 64
+
+	post := func(path, auth, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = res.Body.Close() })
+		return res
+	}
+
+	for name, auth := range map[string]string{"missing": "", "wrong": "Bearer nope", "basic": "Basic " + token} {
+		res := post("/internal/jobs", auth, `{"type": "report:build"}`)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, name)
+		assert.Equal(t, `Bearer realm="internal"`, res.Header.Get("WWW-Authenticate"), name)
+	}
+
+	res := post("/internal/broadcast", "Bearer "+token, `{"event": `)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "bad JSON")
+	res = post("/internal/broadcast", "Bearer "+token, `{"event": "big", "html": "`+strings.Repeat("x", 100)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "over MaxBody")
+	res = post("/internal/broadcast", "Bearer "+token, `{"event": "two\nlines"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+	res = post("/internal/jobs", "Bearer "+token, `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	s.Queue = nil
+	res = post("/internal/jobs", "Bearer "+token, `{"type": "report:build"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestWire(t *testing.T) {
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{InternalAPIToken: token},
+		Jobs:   true,
+	})
+	require.NotNil(t, app.Kit.InternalAPI)
+	app.Kit.InternalAPI.Tasks = []string{"report:build"}
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return app.Client().Do(req)
+	}
+	res := send("/internal/broadcast", `{"channel": "user:7", "event": "order-shipped", "html": "<p>Shipped</p>"}`)
+	assert.Equal(t, http.StatusAccepted, res.Code, res.Body.String())
+	res = send("/internal/jobs", `{"type": "report:build", "payload": {"month": "2026-10"}}`)
+	assert.Equal(t, http.StatusAccepted, res.Code, res.Body.String())
+
+	tasks, err := asynq.NewInspector(asynq.RedisClientOpt{Addr: app.Redis.Addr()}).ListPendingTasks("default")
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "report:build", tasks[0].Type)
+	assert.JSONEq(t, `{"month": "2026-10"}`, string(tasks[0].Payload))
+}
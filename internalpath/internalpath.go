@@ -0,0 +1,84 @@
+// Package internalpath lists the paths of Buffkit's own endpoints, such
+// as the mail preview and the SSE stream, so middlewares that shouldn't
+// count or limit them share one list instead of each keeping its own:
+//
+//	if internalpath.Is(c.Request().URL.Path) {
+//	    return next(c)
+//	}
+//
+// Request logging, analytics and rate limiting consult it. Apps add their
+// own, such as a metrics endpoint, with Register:
+//
+//	internalpath.Register("/metrics")
+package internalpath
+
+import (
+	"strings"
+	"sync"
+)
+
+// Defaults are the paths registered from the start. Wire registers them
+// again under MountPath when it's set.
+var Defaults = []string{
+	"/__mail",       // mail preview and template gallery
+	"/__jobs",       // job dashboards apps mount
+	"/__routes",     // the routes page
+	"/__templates",  // the templates page
+	"/__components", // component usage
+	"/events",       // the SSE stream, which reconnects often
+	"/healthz",      // load balancer and orchestrator probes
+}
+
+var (
+	mu       sync.RWMutex
+	prefixes = append([]string(nil), Defaults...)
+)
+
+// Register adds paths to the list. A path covers itself and everything
+// below it: "/__mail" covers "/__mail/preview" but not "/__mailbox".
+func Register(paths ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+next:
+	for _, p := range paths {
+		p = clean(p)
+		if p == "" {
+			continue
+		}
+		for _, existing := range prefixes {
+			if existing == p {
+				continue next
+			}
+		}
+		prefixes = append(prefixes, p)
+	}
+}
+
+// Is reports whether path is one of the listed paths or below one.
+func Is(path string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, p := range prefixes {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the listed paths, in the order they were registered.
+func List() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]string(nil), prefixes...)
+}
+
+// clean drops a trailing slash, so "/metrics/" covers what "/metrics"
+// does. "/" alone is ignored: it would cover every path.
+func clean(p string) string {
+	p = strings.TrimSuffix(p, "/")
+	if p == "" || !strings.HasPrefix(p, "/") {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,34 @@
+package internalpath_test
+
+import (
+	"testing"
+
+	"github.com/johnjansen/buffkit/internalpath"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIs(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/__mail":          true,
+		"/__mail/preview":  true,
+		"/events/":         true,
+		"/healthz":         true,
+		"/__mailbox":       false,
+		"/eventsfeed":      false,
+		"/":                false,
+		"/pricing":         false,
+		"/app/events":      false,
+		"/__jobs/queues/1": true,
+	} {
+		assert.Equal(t, want, internalpath.Is(path), path)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	before := len(internalpath.List())
+	internalpath.Register("/metrics/", "/metrics", "/", "relative")
+	assert.True(t, internalpath.Is("/metrics"))
+	assert.True(t, internalpath.Is("/metrics/go"))
+	assert.False(t, internalpath.Is("/pricing"), `"/" isn't registered`)
+	assert.Len(t, internalpath.List(), before+1)
+}
@@ -530,7 +530,7 @@ func (tc *jobsTestContext) theJobShouldNotBeQueued() error {
 
 // Concurrency limit scenarios
 func (tc *jobsTestContext) iHaveAJobsRuntimeWithConcurrencySetTo(limit int) error {
-	tc.redisURL = "redis://localhost:6379"
+	tc.redisURL = tc.redisContainer.URL()
 
 	runtime, err := jobs.NewRuntime(tc.redisURL)
 	if err != nil {
@@ -14,6 +14,13 @@ Feature: Background Jobs System
     And the ServeMux should be initialized
     And default handlers should be registered
 
+  Scenario: Initialize job runtime with in-memory Redis
+    Given I have Redis running at "memory://"
+    When I initialize the jobs runtime
+    Then the Asynq client should be created
+    And the ServeMux should be initialized
+    And default handlers should be registered
+
   Scenario: Initialize job runtime without Redis
     Given no Redis URL is configured
     When I initialize the jobs runtime
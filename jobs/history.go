@@ -0,0 +1,185 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/redact"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// DefaultHistoryRetention is how long job runs are kept when no retention
+// is configured.
+const DefaultHistoryRetention = 30 * 24 * time.Hour
+
+// Job run results.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Run is one recorded execution of a job.
+type Run struct {
+	ID          string        `json:"id" db:"id"`
+	TaskType    string        `json:"task_type" db:"task_type"`
+	TaskID      string        `json:"task_id" db:"task_id"`
+	Queue       string        `json:"queue" db:"queue"`
+	PayloadHash string        `json:"payload_hash" db:"payload_hash"`
+	Result      string        `json:"result" db:"result"`
+	Error       string        `json:"error" db:"error"`
+	RetryCount  int           `json:"retry_count" db:"retry_count"`
+	Duration    time.Duration `json:"duration" db:"duration_ms"`
+	StartedAt   time.Time     `json:"started_at" db:"started_at"`
+}
+
+// History records job executions in the job_runs table created by the
+// db/migrations/jobs migration, so job behaviour can be audited with plain
+// SQL. Payloads are stored as a SHA-256 hash only, since they may contain
+// personal data, and errors are redacted (see package redact).
+type History struct {
+	db        *sql.DB
+	dialect   string
+	Retention time.Duration // Defaults to DefaultHistoryRetention
+	Clock     clock.Clock   // Defaults to the runtime's clock, or clock.Real
+}
+
+// NewHistory creates a job history backed by database/sql.
+func NewHistory(db *sql.DB, dialect string) *History {
+	return &History{db: db, dialect: dialect, Retention: DefaultHistoryRetention}
+}
+
+// Record stores a job run.
+func (h *History) Record(ctx context.Context, run *Run) error {
+	defer timing.Start(ctx, timing.DB)()
+
+	if run.ID == "" {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		run.ID = hex.EncodeToString(b)
+	}
+
+	_, err := h.db.ExecContext(ctx, sqlutil.Rebind(h.dialect, `
+		INSERT INTO job_runs (id, task_type, task_id, queue, payload_hash, result, error, retry_count, duration_ms, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		run.ID, run.TaskType, run.TaskID, run.Queue, run.PayloadHash, run.Result, run.Error,
+		run.RetryCount, run.Duration.Milliseconds(), run.StartedAt)
+	if err != nil {
+		return fmt.Errorf("jobs: record run: %w", err)
+	}
+	return nil
+}
+
+// Recent returns the latest runs, newest first. An empty taskType
+// returns runs of every type.
+func (h *History) Recent(ctx context.Context, taskType string, limit int) ([]*Run, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	query := "SELECT id, task_type, task_id, queue, payload_hash, result, error, retry_count, duration_ms, started_at FROM job_runs"
+	var args []interface{}
+	if taskType != "" {
+		query += " WHERE task_type = ?"
+		args = append(args, taskType)
+	}
+	query += " ORDER BY started_at DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := h.db.QueryContext(ctx, sqlutil.Rebind(h.dialect, query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: list runs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var result []*Run
+	for rows.Next() {
+		var run Run
+		var taskID, queue, errMsg sql.NullString
+		var durationMS int64
+		if err := rows.Scan(&run.ID, &run.TaskType, &taskID, &queue, &run.PayloadHash, &run.Result,
+			&errMsg, &run.RetryCount, &durationMS, &run.StartedAt); err != nil {
+			return nil, err
+		}
+		run.TaskID, run.Queue, run.Error = taskID.String, queue.String, errMsg.String
+		run.Duration = time.Duration(durationMS) * time.Millisecond
+		result = append(result, &run)
+	}
+	return result, rows.Err()
+}
+
+// Prune deletes runs that started before the retention window and
+// returns how many were removed.
+func (h *History) Prune(ctx context.Context) (int64, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	retention := h.Retention
+	if retention == 0 {
+		retention = DefaultHistoryRetention
+	}
+
+	res, err := h.db.ExecContext(ctx,
+		sqlutil.Rebind(h.dialect, "DELETE FROM job_runs WHERE started_at < ?"), clock.Or(h.Clock).Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("jobs: prune runs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// Middleware records every task processed by the mux. Recording failures
+// are logged and never fail the job itself.
+func (h *History) Middleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		clk := clock.Or(h.Clock)
+		start := clk.Now()
+		err := next.ProcessTask(ctx, t)
+
+		sum := sha256.Sum256(t.Payload())
+		run := &Run{
+			TaskType:    t.Type(),
+			PayloadHash: hex.EncodeToString(sum[:]),
+			Result:      ResultSuccess,
+			Duration:    clk.Since(start),
+			StartedAt:   start,
+		}
+		run.TaskID, _ = asynq.GetTaskID(ctx)
+		run.Queue, _ = asynq.GetQueueName(ctx)
+		run.RetryCount, _ = asynq.GetRetryCount(ctx)
+		if err != nil {
+			run.Result = ResultFailure
+			run.Error = redact.String(err.Error())
+		}
+
+		if recErr := h.Record(context.WithoutCancel(ctx), run); recErr != nil {
+			log.Printf("Jobs: failed to record %s run: %v", t.Type(), recErr)
+		}
+		return err
+	})
+}
+
+// HandlePrune is the handler for the cleanup:job_runs task.
+func (h *History) HandlePrune(ctx context.Context, t *asynq.Task) error {
+	count, err := h.Prune(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Jobs: Pruned %d job runs older than %s", count, h.Retention)
+	return nil
+}
+
+// EnableHistory records every job processed by this runtime in h and
+// schedules daily pruning of runs older than h.Retention.
+func (r *Runtime) EnableHistory(h *History) error {
+	if h.Clock == nil {
+		h.Clock = r.clock
+	}
+	r.Mux.Use(h.Middleware)
+	r.HandleFunc("cleanup:job_runs", h.HandlePrune)
+	return r.Every(24*time.Hour, "cleanup:job_runs", map[string]string{}, asynq.Queue("low"))
+}
@@ -0,0 +1,122 @@
+package jobs_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/jobs"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newHistory(t *testing.T) *jobs.History {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	schema, err := os.ReadFile("../db/migrations/jobs/20261016092000_create_job_runs.up.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return jobs.NewHistory(db, "sqlite")
+}
+
+func TestHistoryMiddleware(t *testing.T) {
+	ctx := context.Background()
+	history := newHistory(t)
+
+	ok := history.Middleware(asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error { return nil }))
+	failing := history.Middleware(asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		return errors.New("smtp down")
+	}))
+
+	if err := ok.ProcessTask(ctx, asynq.NewTask("email:send", []byte(`{"to":"a@example.com"}`))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := failing.ProcessTask(ctx, asynq.NewTask("email:send", nil)); err == nil {
+		t.Fatal("expected the job error to be returned")
+	}
+
+	runs, err := history.Recent(ctx, "email:send", 10)
+	if err != nil {
+		t.Fatalf("Recent: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+
+	var failures int
+	for _, run := range runs {
+		if len(run.PayloadHash) != 64 {
+			t.Errorf("expected a SHA-256 payload hash, got %q", run.PayloadHash)
+		}
+		if run.Result == jobs.ResultFailure {
+			failures++
+			if run.Error != "smtp down" {
+				t.Errorf("unexpected error message %q", run.Error)
+			}
+		}
+	}
+	if failures != 1 {
+		t.Errorf("expected 1 failure, got %d", failures)
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	ctx := context.Background()
+	history := newHistory(t)
+	history.Retention = time.Hour
+
+	old := &jobs.Run{TaskType: "cleanup:sessions", PayloadHash: "x", Result: jobs.ResultSuccess, StartedAt: time.Now().Add(-2 * time.Hour)}
+	recent := &jobs.Run{TaskType: "cleanup:sessions", PayloadHash: "y", Result: jobs.ResultSuccess, StartedAt: time.Now()}
+	for _, run := range []*jobs.Run{old, recent} {
+		if err := history.Record(ctx, run); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	count, err := history.Prune(ctx)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 pruned run, got %d", count)
+	}
+
+	runs, err := history.Recent(ctx, "", 10)
+	if err != nil {
+		t.Fatalf("Recent: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != recent.ID {
+		t.Errorf("expected only the recent run to remain, got %+v", runs)
+	}
+}
+
+func TestHistoryRedactsErrors(t *testing.T) {
+	ctx := context.Background()
+	history := newHistory(t)
+
+	failing := history.Middleware(asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		return errors.New("mailbox ada@example.com is full")
+	}))
+	_ = failing.ProcessTask(ctx, asynq.NewTask("email:send", nil))
+
+	runs, err := history.Recent(ctx, "email:send", 10)
+	if err != nil {
+		t.Fatalf("Recent: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Error != "mailbox ***@example.com is full" {
+		t.Errorf("expected a redacted error, got %+v", runs)
+	}
+}
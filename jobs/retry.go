@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// BackoffFunc returns the base delay before retry number n (starting at 1).
+type BackoffFunc func(n int) time.Duration
+
+// ExponentialBackoff doubles the delay on each retry, starting at base and
+// capped at max.
+func ExponentialBackoff(base, max time.Duration) BackoffFunc {
+	return func(n int) time.Duration {
+		if n < 1 {
+			n = 1
+		}
+		d := float64(base) * math.Pow(2, float64(n-1))
+		if d > float64(max) {
+			return max
+		}
+		return time.Duration(d)
+	}
+}
+
+// ConstantBackoff waits the same delay before every retry.
+func ConstantBackoff(d time.Duration) BackoffFunc {
+	return func(int) time.Duration { return d }
+}
+
+// RetryPolicy controls how a failed job is retried.
+type RetryPolicy struct {
+	// MaxRetries is how many times a failed job is retried before it is
+	// archived as dead.
+	MaxRetries int
+
+	// Backoff computes the delay before each retry.
+	// Defaults to DefaultRetryPolicy's backoff.
+	Backoff BackoffFunc
+
+	// Jitter randomizes each delay by up to this fraction in either
+	// direction (0.2 means ±20%) so failed jobs don't retry in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy applies to task types without their own policy:
+// 10 retries, backing off exponentially from 10 seconds to an hour, ±20%.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 10,
+	Backoff:    ExponentialBackoff(10*time.Second, time.Hour),
+	Jitter:     0.2,
+}
+
+// Delay returns the jittered delay before retry number n.
+func (p RetryPolicy) Delay(n int) time.Duration {
+	backoff := p.Backoff
+	if backoff == nil {
+		backoff = DefaultRetryPolicy.Backoff
+	}
+	d := backoff(n)
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// retryPolicies maps task types to their registered policy.
+type retryPolicies struct {
+	mu       sync.RWMutex
+	policies map[string]RetryPolicy
+}
+
+func (rp *retryPolicies) get(taskType string) RetryPolicy {
+	rp.mu.RLock()
+	defer rp.mu.RUnlock()
+	if p, ok := rp.policies[taskType]; ok {
+		return p
+	}
+	return DefaultRetryPolicy
+}
+
+func (rp *retryPolicies) set(taskType string, p RetryPolicy) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.policies == nil {
+		rp.policies = make(map[string]RetryPolicy)
+	}
+	rp.policies[taskType] = p
+}
+
+// SetRetryPolicy registers the retry policy for taskType. Enqueue applies
+// its MaxRetries automatically and the worker uses it to space retries:
+//
+//	kit.Jobs.SetRetryPolicy("email:send", jobs.RetryPolicy{
+//	    MaxRetries: 5,
+//	    Backoff:    jobs.ExponentialBackoff(30*time.Second, 30*time.Minute),
+//	    Jitter:     0.1,
+//	})
+func (r *Runtime) SetRetryPolicy(taskType string, p RetryPolicy) {
+	r.retries.set(taskType, p)
+}
+
+// RetryPolicy returns the policy for taskType, or DefaultRetryPolicy.
+func (r *Runtime) RetryPolicy(taskType string) RetryPolicy {
+	return r.retries.get(taskType)
+}
+
+// retryDelay is the server's RetryDelayFunc.
+func (r *Runtime) retryDelay(n int, _ error, t *asynq.Task) time.Duration {
+	return r.retries.get(t.Type()).Delay(n)
+}
@@ -0,0 +1,49 @@
+package jobs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnjansen/buffkit/jobs"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := jobs.ExponentialBackoff(time.Second, 5*time.Second)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := backoff(i + 1); got != w {
+			t.Errorf("retry %d: got %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	policy := jobs.RetryPolicy{MaxRetries: 3, Backoff: jobs.ConstantBackoff(10 * time.Second), Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := policy.Delay(1)
+		if d < 5*time.Second || d > 15*time.Second {
+			t.Fatalf("delay %s outside the ±50%% jitter range", d)
+		}
+	}
+}
+
+func TestRuntimeRetryPolicies(t *testing.T) {
+	runtime, err := jobs.NewRuntime("")
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+
+	if got := runtime.RetryPolicy("email:send").MaxRetries; got != jobs.DefaultRetryPolicy.MaxRetries {
+		t.Errorf("expected the default policy, got %d retries", got)
+	}
+
+	runtime.SetRetryPolicy("email:send", jobs.RetryPolicy{MaxRetries: 2})
+	if got := runtime.RetryPolicy("email:send").MaxRetries; got != 2 {
+		t.Errorf("expected 2 retries, got %d", got)
+	}
+
+	// A policy without a backoff falls back to the default one
+	if d := runtime.RetryPolicy("email:send").Delay(1); d != 10*time.Second {
+		t.Errorf("expected the default backoff, got %s", d)
+	}
+}
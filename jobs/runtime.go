@@ -5,21 +5,59 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/hibiken/asynq"
 	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
 	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/redact"
+	"github.com/redis/go-redis/v9"
 )
 
 // Runtime encapsulates the Asynq client, server, and mux
 type Runtime struct {
-	Client *asynq.Client
-	Server *asynq.Server
-	Mux    *asynq.ServeMux
-	config Config
+	Client    *asynq.Client
+	Server    *asynq.Server
+	Mux       *asynq.ServeMux
+	Scheduler *asynq.Scheduler // Created in Start() when schedules are registered
+	config    Config
+	schedules []Schedule
+	heartbeat *heartbeater
+	retries   retryPolicies
+	handlers  []string // task types registered through Handle/HandleFunc
+	clock     clock.Clock
+	memory    *miniredis.Miniredis // embedded Redis when started with MemoryRedisURL
+
+	// how long sessions may sit idle and last in all before
+	// cleanup:sessions removes them; zero doesn't limit
+	sessionIdle, sessionMaxAge time.Duration
+
+	streams      []*streamConsumer     // registered through HandleStream
+	streamMu     sync.Mutex            // guards streamClient
+	streamClient redis.UniversalClient // shared by Publish
 }
 
+// MemoryRedisURL runs the runtime against an embedded, in-process Redis
+// (miniredis) instead of a server. Jobs are lost when the process exits and
+// other processes can't see them, so it's meant for tests, CI, and quick
+// local runs, not production.
+const MemoryRedisURL = "memory://"
+
+// Schedule is a task enqueued periodically by the worker's scheduler.
+type Schedule struct {
+	Spec     string // Cron spec or "@every <duration>"
+	TaskType string
+	Payload  []byte
+	Options  []asynq.Option
+}
+
+// DefaultSessionCleanupInterval is how often cleanup:sessions runs when
+// scheduled by ScheduleSessionCleanup with a zero interval.
+const DefaultSessionCleanupInterval = time.Hour
+
 // Config holds job runtime configuration
 type Config struct {
 	RedisURL    string
@@ -27,7 +65,8 @@ type Config struct {
 	Queues      map[string]int // Queue priorities
 }
 
-// NewRuntime creates a new job runtime
+// NewRuntime creates a new job runtime. An empty redisURL gives a no-op
+// runtime; MemoryRedisURL starts an embedded Redis owned by the runtime.
 func NewRuntime(redisURL string) (*Runtime, error) {
 	if redisURL == "" {
 		// Return a no-op runtime for development without Redis
@@ -39,9 +78,20 @@ func NewRuntime(redisURL string) (*Runtime, error) {
 		}, nil
 	}
 
+	var memory *miniredis.Miniredis
+	if redisURL == MemoryRedisURL {
+		var err error
+		memory, err = miniredis.Run()
+		if err != nil {
+			return nil, fmt.Errorf("failed to start in-memory Redis: %w", err)
+		}
+		redisURL = "redis://" + memory.Addr()
+	}
+
 	// Parse Redis connection options
 	opt, err := asynq.ParseRedisURI(redisURL)
 	if err != nil {
+		closeMemory(memory)
 		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
 	}
 
@@ -49,10 +99,11 @@ func NewRuntime(redisURL string) (*Runtime, error) {
 	// This will fail if Redis is not accessible
 	inspector := asynq.NewInspector(opt)
 	defer inspector.Close()
-	
+
 	// Try to get queue info as a connectivity test
 	_, err = inspector.Queues()
 	if err != nil {
+		closeMemory(memory)
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
@@ -69,6 +120,7 @@ func NewRuntime(redisURL string) (*Runtime, error) {
 		Client: client,
 		Server: nil, // Server will be created in Start() or when needed
 		Mux:    mux,
+		memory: memory,
 		config: Config{
 			RedisURL:    redisURL,
 			Concurrency: 10,
@@ -85,6 +137,14 @@ func NewRuntime(redisURL string) (*Runtime, error) {
 
 // Shutdown gracefully stops the jobs runtime
 func (r *Runtime) Shutdown() {
+	// Stop enqueuing scheduled jobs
+	if r.Scheduler != nil {
+		r.Scheduler.Shutdown()
+		r.Scheduler = nil
+	}
+	r.stopHeartbeat()
+	r.stopStreams()
+
 	// Shutdown server first (stops accepting new jobs)
 	if r.Server != nil {
 		r.Server.Shutdown()
@@ -96,6 +156,32 @@ func (r *Runtime) Shutdown() {
 	if r.Client != nil {
 		_ = r.Client.Close()
 	}
+
+	closeMemory(r.memory)
+	r.memory = nil
+}
+
+// closeMemory stops an embedded Redis, if there is one.
+func closeMemory(m *miniredis.Miniredis) {
+	if m != nil {
+		m.Close()
+	}
+}
+
+// SetClock sets the clock used for worker heartbeats and job history
+// timestamps. Call it before Start; nil means clock.Real.
+func (r *Runtime) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// SetSessionTimeouts sets how long sessions may sit idle and last in all
+// before the cleanup:sessions job removes them, to match
+// auth.UseSessionTimeouts. Wire calls it with Config.SessionIdleTimeout
+// and Config.SessionMaxAge. Call it before RegisterDefaults; when both
+// are zero the job falls back to DefaultSessionMaxAge and
+// DefaultSessionInactivity.
+func (r *Runtime) SetSessionTimeouts(idle, maxAge time.Duration) {
+	r.sessionIdle, r.sessionMaxAge = idle, maxAge
 }
 
 // RegisterDefaults registers default job handlers
@@ -105,9 +191,63 @@ func (r *Runtime) RegisterDefaults() {
 	}
 
 	// Register some default handlers
-	r.Mux.HandleFunc("email:send", HandleEmailSend)
-	r.Mux.HandleFunc("email:welcome", HandleWelcomeEmail)
-	r.Mux.HandleFunc("cleanup:sessions", HandleCleanupSessions)
+	r.HandleFunc("email:send", HandleEmailSend)
+	r.HandleFunc("email:welcome", HandleWelcomeEmail)
+	r.HandleFunc("cleanup:sessions", CleanupSessionsHandler(r.sessionMaxAge, r.sessionIdle))
+}
+
+// Handle registers handler for taskType on the runtime's mux and records
+// the task type so it shows up in Handlers.
+func (r *Runtime) Handle(taskType string, handler asynq.Handler) {
+	r.Mux.Handle(taskType, handler)
+	r.handlers = append(r.handlers, taskType)
+}
+
+// HandleFunc is Handle for a plain function.
+func (r *Runtime) HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error) {
+	r.Handle(taskType, asynq.HandlerFunc(handler))
+}
+
+// Handlers lists the task types registered through Handle and HandleFunc,
+// in registration order. Handlers added directly on Mux aren't included.
+func (r *Runtime) Handlers() []string {
+	return append([]string(nil), r.handlers...)
+}
+
+// Every registers taskType to be enqueued every interval while the worker
+// runs. Schedules are unique per interval, so running several workers
+// doesn't enqueue duplicates.
+func (r *Runtime) Every(interval time.Duration, taskType string, payload interface{}, opts ...asynq.Option) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid schedule interval %s for %s", interval, taskType)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	r.schedules = append(r.schedules, Schedule{
+		Spec:     "@every " + interval.String(),
+		TaskType: taskType,
+		Payload:  data,
+		Options:  append([]asynq.Option{asynq.Unique(interval)}, opts...),
+	})
+	return nil
+}
+
+// ScheduleSessionCleanup registers cleanup:sessions to run every interval
+// (DefaultSessionCleanupInterval if zero).
+func (r *Runtime) ScheduleSessionCleanup(interval time.Duration) error {
+	if interval == 0 {
+		interval = DefaultSessionCleanupInterval
+	}
+	return r.Every(interval, "cleanup:sessions", map[string]string{}, asynq.Queue("low"))
+}
+
+// Schedules returns the periodic tasks registered with Every.
+func (r *Runtime) Schedules() []Schedule {
+	return r.schedules
 }
 
 // Start begins processing jobs
@@ -117,6 +257,10 @@ func (r *Runtime) Start() error {
 		return nil
 	}
 
+	if err := r.startScheduler(); err != nil {
+		return err
+	}
+
 	// Create server now if it doesn't exist
 	if r.Server == nil {
 		opt, err := asynq.ParseRedisURI(r.config.RedisURL)
@@ -138,22 +282,74 @@ func (r *Runtime) Start() error {
 				"low":      1,
 			}
 		}
+		r.config.Concurrency, r.config.Queues = concurrency, queues
 
 		r.Server = asynq.NewServer(
 			opt,
 			asynq.Config{
-				Concurrency:  concurrency,
-				Queues:       queues,
-				ErrorHandler: asynq.ErrorHandlerFunc(handleError),
-				Logger:       &logger{},
+				Concurrency:    concurrency,
+				Queues:         queues,
+				ErrorHandler:   asynq.ErrorHandlerFunc(handleError),
+				RetryDelayFunc: r.retryDelay,
+				Logger:         &logger{},
 			},
 		)
 	}
 
+	// Publish liveness so `buffkit:jobs:workers` can see this worker
+	if r.heartbeat == nil {
+		client, err := r.RedisClient()
+		if err != nil {
+			return err
+		}
+		r.heartbeat = newHeartbeater(client, clock.Or(r.clock), r.config.Concurrency, r.config.Queues)
+		r.Mux.Use(r.heartbeat.middleware)
+		r.heartbeat.start()
+	}
+
+	if err := r.startStreams(); err != nil {
+		return err
+	}
+
 	log.Println("Jobs: Starting worker...")
 	return r.Server.Start(r.Mux)
 }
 
+// stopHeartbeat stops publishing heartbeats and removes this worker's record.
+func (r *Runtime) stopHeartbeat() {
+	if r.heartbeat != nil {
+		r.heartbeat.shutdown()
+		r.heartbeat = nil
+	}
+}
+
+// startScheduler starts enqueuing registered schedules, if any.
+func (r *Runtime) startScheduler() error {
+	if r.Scheduler != nil || len(r.schedules) == 0 {
+		return nil
+	}
+
+	opt, err := asynq.ParseRedisURI(r.config.RedisURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+
+	scheduler := asynq.NewScheduler(opt, &asynq.SchedulerOpts{Logger: &logger{}})
+	for _, s := range r.schedules {
+		opts := append([]asynq.Option{asynq.MaxRetry(r.retries.get(s.TaskType).MaxRetries)}, s.Options...)
+		if _, err := scheduler.Register(s.Spec, asynq.NewTask(s.TaskType, s.Payload, opts...)); err != nil {
+			return fmt.Errorf("failed to schedule %s: %w", s.TaskType, err)
+		}
+		log.Printf("Jobs: Scheduled %s (%s)", s.TaskType, s.Spec)
+	}
+	if err := scheduler.Start(); err != nil {
+		return fmt.Errorf("failed to start scheduler: %w", err)
+	}
+
+	r.Scheduler = scheduler
+	return nil
+}
+
 // IsReady checks if the runtime is properly initialized (has client and mux)
 // without starting the server. This is useful for tests.
 func (r *Runtime) IsReady() bool {
@@ -162,6 +358,13 @@ func (r *Runtime) IsReady() bool {
 
 // Stop gracefully shuts down the job processor
 func (r *Runtime) Stop() error {
+	if r.Scheduler != nil {
+		r.Scheduler.Shutdown()
+		r.Scheduler = nil
+	}
+	r.stopHeartbeat()
+	r.stopStreams()
+
 	if r.Server == nil {
 		return nil
 	}
@@ -174,7 +377,10 @@ func (r *Runtime) Stop() error {
 // Enqueue adds a job to the queue
 func (r *Runtime) Enqueue(taskType string, payload interface{}, opts ...asynq.Option) error {
 	if r.Client == nil {
-		log.Printf("Jobs: Would enqueue %s (Redis not configured)", taskType)
+		// Payloads are redacted, so tag fields that shouldn't be logged
+		// with redact:"mask"
+		logged, _ := json.Marshal(redact.Value(payload))
+		log.Printf("Jobs: Would enqueue %s (Redis not configured): %s", taskType, logged)
 		return nil
 	}
 
@@ -183,6 +389,9 @@ func (r *Runtime) Enqueue(taskType string, payload interface{}, opts ...asynq.Op
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	// Apply the task type's retry policy; explicit options still win
+	opts = append([]asynq.Option{asynq.MaxRetry(r.retries.get(taskType).MaxRetries)}, opts...)
+
 	task := asynq.NewTask(taskType, data, opts...)
 	info, err := r.Client.Enqueue(task)
 	if err != nil {
@@ -209,7 +418,7 @@ func (r *Runtime) EnqueueAt(at time.Time, taskType string, payload interface{})
 type EmailPayload struct {
 	To      string `json:"to"`
 	Subject string `json:"subject"`
-	Body    string `json:"body"`
+	Body    string `json:"body" redact:"mask"`
 }
 
 // HandleEmailSend processes email sending jobs
@@ -224,7 +433,7 @@ func HandleEmailSend(ctx context.Context, t *asynq.Task) error {
 	sender := mail.GetSender()
 	if sender == nil {
 		// If no sender configured, just log (dev mode)
-		log.Printf("Jobs: Would send email to %s: %s (no mail sender configured)", payload.To, payload.Subject)
+		log.Printf("Jobs: Would send email to %s: %s (no mail sender configured)", redact.String(payload.To), payload.Subject)
 		return nil
 	}
 
@@ -241,36 +450,57 @@ func HandleEmailSend(ctx context.Context, t *asynq.Task) error {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
-	log.Printf("Jobs: Email sent to %s: %s", payload.To, payload.Subject)
+	log.Printf("Jobs: Email sent to %s: %s", redact.String(payload.To), payload.Subject)
 	return nil
 }
 
-// HandleCleanupSessions removes expired sessions
-func HandleCleanupSessions(ctx context.Context, t *asynq.Task) error {
-	// Get the auth store to clean up sessions
-	store := auth.GetStore()
-	if store == nil {
-		log.Println("Jobs: No auth store configured, skipping session cleanup")
-		return nil
-	}
+// DefaultSessionMaxAge and DefaultSessionInactivity are the limits the
+// cleanup:sessions job uses when no session timeouts are configured, so
+// the session store doesn't grow without bound.
+const (
+	DefaultSessionMaxAge     = 24 * time.Hour
+	DefaultSessionInactivity = 2 * time.Hour
+)
 
-	// If the store supports session cleanup, do it
-	if extStore, ok := store.(auth.ExtendedUserStore); ok {
-		// Clean up sessions older than 24 hours or inactive for 2 hours
-		maxAge := 24 * time.Hour
-		maxInactivity := 2 * time.Hour
+// HandleCleanupSessions removes sessions older than DefaultSessionMaxAge
+// or inactive for DefaultSessionInactivity. RegisterDefaults registers
+// CleanupSessionsHandler with the runtime's SetSessionTimeouts instead.
+var HandleCleanupSessions = CleanupSessionsHandler(DefaultSessionMaxAge, DefaultSessionInactivity)
+
+// CleanupSessionsHandler returns a cleanup:sessions handler that removes
+// sessions older than maxAge or inactive for maxInactivity; zero doesn't
+// limit either, and when both are zero the defaults apply.
+func CleanupSessionsHandler(maxAge, maxInactivity time.Duration) func(ctx context.Context, t *asynq.Task) error {
+	return func(ctx context.Context, t *asynq.Task) error {
+		// Get the auth store to clean up sessions
+		store := auth.GetStore()
+		if store == nil {
+			log.Println("Jobs: No auth store configured, skipping session cleanup")
+			return nil
+		}
 
-		count, err := extStore.CleanupSessions(ctx, maxAge, maxInactivity)
+		// If the store supports session cleanup, do it
+		extStore, ok := store.(auth.ExtendedUserStore)
+		if !ok {
+			log.Println("Jobs: Auth store doesn't support session cleanup")
+			return nil
+		}
+		age, inactivity, note := maxAge, maxInactivity, ""
+		if age <= 0 && inactivity <= 0 {
+			age, inactivity = DefaultSessionMaxAge, DefaultSessionInactivity
+			note = "no timeouts configured, "
+		}
+
+		start := time.Now()
+		count, err := extStore.CleanupSessions(ctx, age, inactivity)
 		if err != nil {
 			return fmt.Errorf("failed to cleanup sessions: %w", err)
 		}
 
-		log.Printf("Jobs: Cleaned up %d expired sessions", count)
-	} else {
-		log.Println("Jobs: Auth store doesn't support session cleanup")
+		log.Printf("Jobs: Cleaned up %d expired sessions (%smax age %s, max inactivity %s) in %s",
+			count, note, age, inactivity, time.Since(start).Round(time.Millisecond))
+		return nil
 	}
-
-	return nil
 }
 
 // Helper functions for common job types
@@ -313,7 +543,7 @@ func HandleWelcomeEmail(ctx context.Context, t *asynq.Task) error {
 	// Get mail sender
 	sender := mail.GetSender()
 	if sender == nil {
-		log.Printf("Jobs: Would send welcome email to %s (no mail sender configured)", user.Email)
+		log.Printf("Jobs: Would send welcome email to %s (no mail sender configured)", redact.String(user.Email))
 		return nil
 	}
 
@@ -359,7 +589,7 @@ The Team`, user.Name(), user.Email)
 		return fmt.Errorf("failed to send welcome email: %w", err)
 	}
 
-	log.Printf("Jobs: Welcome email sent to %s", user.Email)
+	log.Printf("Jobs: Welcome email sent to %s", redact.String(user.Email))
 	return nil
 }
 
@@ -374,7 +604,7 @@ func (r *Runtime) EnqueueWelcomeEmail(userID string) error {
 
 // Error handling
 func handleError(ctx context.Context, task *asynq.Task, err error) {
-	log.Printf("Jobs: Error processing %s: %v", task.Type(), err)
+	log.Printf("Jobs: Error processing %s: %v", task.Type(), redact.Error(err))
 }
 
 // Custom logger for Asynq
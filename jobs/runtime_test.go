@@ -323,6 +323,10 @@ func (ctx *jobsTestContext) iHaveABuffaloApplicationWithBuffkitWired() error {
 }
 
 func (ctx *jobsTestContext) iHaveRedisRunningAt(redisURL string) error {
+	// Features name the conventional address; use the test Redis instead
+	if ctx.redisContainer != nil && redisURL != jobs.MemoryRedisURL {
+		redisURL = ctx.redisContainer.URL()
+	}
 	ctx.redisURL = redisURL
 	return nil
 }
@@ -0,0 +1,118 @@
+package jobs_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/jobs"
+)
+
+func TestScheduleSessionCleanup(t *testing.T) {
+	runtime, err := jobs.NewRuntime("")
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+
+	if err := runtime.ScheduleSessionCleanup(0); err != nil {
+		t.Fatalf("ScheduleSessionCleanup: %v", err)
+	}
+	if err := runtime.Every(-time.Minute, "noop", nil); err == nil {
+		t.Error("expected an error for a negative interval")
+	}
+
+	schedules := runtime.Schedules()
+	if len(schedules) != 1 {
+		t.Fatalf("expected 1 schedule, got %d", len(schedules))
+	}
+	if schedules[0].TaskType != "cleanup:sessions" || schedules[0].Spec != "@every 1h0m0s" {
+		t.Errorf("unexpected schedule: %+v", schedules[0])
+	}
+
+	// Without Redis, starting is a no-op and no scheduler is created
+	if err := runtime.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if runtime.Scheduler != nil {
+		t.Error("expected no scheduler without Redis")
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	runtime, err := jobs.NewRuntime("")
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+
+	runtime.RegisterDefaults()
+	runtime.HandleFunc("report:build", func(ctx context.Context, task *asynq.Task) error { return nil })
+
+	want := []string{"email:send", "email:welcome", "cleanup:sessions", "report:build"}
+	if got := runtime.Handlers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Handlers() = %v, want %v", got, want)
+	}
+}
+
+func TestSessionCleanupUsesTimeouts(t *testing.T) {
+	ctx := context.Background()
+	store := auth.NewMemoryStore()
+	auth.UseStore(store)
+	defer auth.UseStore(nil)
+	now := time.Now()
+	for id, seen := range map[string]time.Duration{"idle-3h": 3 * time.Hour, "idle-5h": 5 * time.Hour} {
+		s := &auth.Session{ID: id, UserID: "u", CreatedAt: now.Add(-6 * time.Hour), LastSeenAt: now.Add(-seen)}
+		if err := store.CreateSession(ctx, s); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+
+	runtime, err := jobs.NewRuntime("")
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+	runtime.SetSessionTimeouts(4*time.Hour, 48*time.Hour)
+	runtime.RegisterDefaults()
+	if err := runtime.Mux.ProcessTask(ctx, asynq.NewTask("cleanup:sessions", nil)); err != nil {
+		t.Fatalf("cleanup:sessions: %v", err)
+	}
+
+	if _, err := store.Session(ctx, "idle-3h"); err != nil {
+		t.Errorf("a session within the idle timeout was removed: %v", err)
+	}
+	if _, err := store.Session(ctx, "idle-5h"); err == nil {
+		t.Error("a session past the idle timeout was kept")
+	}
+}
+
+func TestSessionCleanupDefaultsWithoutTimeouts(t *testing.T) {
+	ctx := context.Background()
+	store := auth.NewMemoryStore()
+	auth.UseStore(store)
+	defer auth.UseStore(nil)
+	now := time.Now()
+	for id, seen := range map[string]time.Duration{"idle-1h": time.Hour, "idle-3h": 3 * time.Hour} {
+		s := &auth.Session{ID: id, UserID: "u", CreatedAt: now.Add(-6 * time.Hour), LastSeenAt: now.Add(-seen)}
+		if err := store.CreateSession(ctx, s); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+
+	runtime, err := jobs.NewRuntime("")
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+	runtime.RegisterDefaults()
+	if err := runtime.Mux.ProcessTask(ctx, asynq.NewTask("cleanup:sessions", nil)); err != nil {
+		t.Fatalf("cleanup:sessions: %v", err)
+	}
+
+	if _, err := store.Session(ctx, "idle-1h"); err != nil {
+		t.Errorf("a recently used session was removed: %v", err)
+	}
+	if _, err := store.Session(ctx, "idle-3h"); err == nil {
+		t.Error("a session idle past the default limit was kept")
+	}
+}
@@ -0,0 +1,383 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/redact"
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream consumer defaults.
+const (
+	DefaultStreamGroup     = "buffkit"
+	DefaultStreamBatch     = 10
+	DefaultStreamBlock     = 5 * time.Second
+	DefaultStreamClaimIdle = time.Minute
+)
+
+// StreamConsumer reads a Redis Stream through a consumer group. Every
+// worker process joins the group, so each message is handled by one of
+// them.
+type StreamConsumer struct {
+	Stream string
+
+	// Group is the consumer group. Defaults to DefaultStreamGroup.
+	Group string
+
+	// Consumer names this process within the group. Defaults to
+	// "<hostname>:<pid>".
+	Consumer string
+
+	// Batch is how many messages are read at a time. Defaults to
+	// DefaultStreamBatch.
+	Batch int64
+
+	// Block is how long a read waits for new messages. Defaults to
+	// DefaultStreamBlock.
+	Block time.Duration
+
+	// ClaimIdle is how long a message stays unacknowledged before it's
+	// claimed again, whether its handler failed or its worker died.
+	// Defaults to DefaultStreamClaimIdle.
+	ClaimIdle time.Duration
+
+	// FromStart makes a new group read the messages already in the
+	// stream. By default it starts with the next message published.
+	FromStart bool
+}
+
+// StreamTaskType is the task type handlers for stream receive, so mux
+// middlewares and Handlers can tell stream messages apart.
+func StreamTaskType(stream string) string {
+	return "stream:" + stream
+}
+
+// DeadStream is where messages that failed more often than their task
+// type's RetryPolicy.MaxRetries end up, with an "error" field added.
+func DeadStream(stream string) string {
+	return stream + ":dead"
+}
+
+// streamMessageIDKey is the context key holding the message ID.
+type streamMessageIDKey struct{}
+
+// StreamMessageID returns the ID of the stream message a handler is
+// processing.
+func StreamMessageID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(streamMessageIDKey{}).(string)
+	return id, ok
+}
+
+// HandleStream registers handler for the messages on c.Stream. Messages
+// go through the mux like tasks, typed StreamTaskType(c.Stream), so
+// history and heartbeats cover them. A message published with Publish
+// arrives with its payload; others arrive as a JSON object of their
+// fields. Messages are handled one at a time, in order, and acknowledged
+// when the handler returns nil:
+//
+//	kit.Jobs.HandleStreamFunc(jobs.StreamConsumer{Stream: "orders"}, func(ctx context.Context, t *asynq.Task) error {
+//	    var order Order
+//	    if err := json.Unmarshal(t.Payload(), &order); err != nil {
+//	        return err
+//	    }
+//	    return fulfil(ctx, order)
+//	})
+//
+// A failed message is retried once it has been idle for c.ClaimIdle, and
+// moved to DeadStream(c.Stream) after RetryPolicy(type).MaxRetries
+// retries. Consumers start with Start.
+func (r *Runtime) HandleStream(c StreamConsumer, handler asynq.Handler) error {
+	if c.Stream == "" {
+		return fmt.Errorf("jobs: stream consumer needs a stream")
+	}
+	for _, s := range r.streams {
+		if s.Stream == c.Stream {
+			return fmt.Errorf("jobs: stream %s already has a consumer", c.Stream)
+		}
+	}
+	if c.Group == "" {
+		c.Group = DefaultStreamGroup
+	}
+	if c.Consumer == "" {
+		hostname, _ := os.Hostname()
+		c.Consumer = hostname + ":" + strconv.Itoa(os.Getpid())
+	}
+	if c.Batch <= 0 {
+		c.Batch = DefaultStreamBatch
+	}
+	if c.Block <= 0 {
+		c.Block = DefaultStreamBlock
+	}
+	if c.ClaimIdle <= 0 {
+		c.ClaimIdle = DefaultStreamClaimIdle
+	}
+
+	r.Handle(StreamTaskType(c.Stream), handler)
+	r.streams = append(r.streams, &streamConsumer{StreamConsumer: c, runtime: r})
+	return nil
+}
+
+// HandleStreamFunc is HandleStream for a plain function.
+func (r *Runtime) HandleStreamFunc(c StreamConsumer, handler func(context.Context, *asynq.Task) error) error {
+	return r.HandleStream(c, asynq.HandlerFunc(handler))
+}
+
+// Publish adds payload, marshaled to JSON, to stream and returns the
+// message ID. It works from any process connected to the same Redis.
+func (r *Runtime) Publish(ctx context.Context, stream string, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("jobs: %s payload: %w", stream, err)
+	}
+	if r.config.RedisURL == "" {
+		logged, _ := json.Marshal(redact.Value(payload))
+		log.Printf("Jobs: Would publish to %s (Redis not configured): %s", stream, logged)
+		return "", nil
+	}
+
+	client, err := r.publisher()
+	if err != nil {
+		return "", err
+	}
+	id, err := client.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: map[string]interface{}{"payload": string(data)}}).Result()
+	if err != nil {
+		return "", fmt.Errorf("jobs: publish to %s: %w", stream, err)
+	}
+	return id, nil
+}
+
+// publisher returns the client Publish shares, creating it on first use.
+func (r *Runtime) publisher() (redis.UniversalClient, error) {
+	r.streamMu.Lock()
+	defer r.streamMu.Unlock()
+	if r.streamClient == nil {
+		client, err := r.RedisClient()
+		if err != nil {
+			return nil, err
+		}
+		r.streamClient = client
+	}
+	return r.streamClient, nil
+}
+
+// startStreams creates the consumer groups and starts reading them.
+func (r *Runtime) startStreams() error {
+	if len(r.streams) == 0 || r.streams[0].client != nil {
+		return nil
+	}
+	for _, s := range r.streams {
+		client, err := r.RedisClient()
+		if err != nil {
+			return err
+		}
+		if err := s.createGroup(client); err != nil {
+			_ = client.Close()
+			r.stopStreams()
+			return err
+		}
+		s.client = client
+		s.start()
+		log.Printf("Jobs: Consuming stream %s as %s/%s", s.Stream, s.Group, s.Consumer)
+	}
+	return nil
+}
+
+// stopStreams stops the consumers, letting in-flight messages finish,
+// and closes the Publish client.
+func (r *Runtime) stopStreams() {
+	for _, s := range r.streams {
+		if s.client != nil {
+			s.shutdown()
+		}
+	}
+
+	r.streamMu.Lock()
+	defer r.streamMu.Unlock()
+	if r.streamClient != nil {
+		_ = r.streamClient.Close()
+		r.streamClient = nil
+	}
+}
+
+// streamConsumer runs one StreamConsumer until shut down.
+type streamConsumer struct {
+	StreamConsumer
+	runtime *Runtime
+	client  redis.UniversalClient
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (s *streamConsumer) createGroup(client redis.UniversalClient) error {
+	start := "$"
+	if s.FromStart {
+		start = "0"
+	}
+	err := client.XGroupCreateMkStream(context.Background(), s.Stream, s.Group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("jobs: create group %s on stream %s: %w", s.Group, s.Stream, err)
+	}
+	return nil
+}
+
+func (s *streamConsumer) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+	go s.run(ctx)
+}
+
+func (s *streamConsumer) shutdown() {
+	s.cancel()
+	<-s.done
+	_ = s.client.Close()
+	s.client = nil
+}
+
+// run claims stale messages every half ClaimIdle and reads new ones in
+// between, until ctx is cancelled.
+func (s *streamConsumer) run(ctx context.Context) {
+	defer close(s.done)
+	var claimed time.Time
+	for ctx.Err() == nil {
+		if time.Since(claimed) >= s.ClaimIdle/2 {
+			claimed = time.Now()
+			if err := s.claim(ctx); err != nil {
+				s.pause(ctx, err)
+				continue
+			}
+		}
+		if err := s.read(ctx); err != nil {
+			s.pause(ctx, err)
+		}
+	}
+}
+
+// pause logs a Redis error and waits a Block before trying again.
+func (s *streamConsumer) pause(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	log.Printf("Jobs: reading stream %s failed: %v", s.Stream, err)
+	select {
+	case <-ctx.Done():
+	case <-time.After(s.Block):
+	}
+}
+
+// read handles the new messages delivered to this consumer.
+func (s *streamConsumer) read(ctx context.Context) error {
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.Group,
+		Consumer: s.Consumer,
+		Streams:  []string{s.Stream, ">"},
+		Count:    s.Batch,
+		Block:    s.Block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			s.process(msg, 1)
+		}
+	}
+	return nil
+}
+
+// claim takes over the group's messages that have gone unacknowledged
+// for ClaimIdle and handles them again.
+func (s *streamConsumer) claim(ctx context.Context) error {
+	start := "0-0"
+	for {
+		msgs, next, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   s.Stream,
+			Group:    s.Group,
+			Consumer: s.Consumer,
+			MinIdle:  s.ClaimIdle,
+			Start:    start,
+			Count:    s.Batch,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			s.process(msg, s.deliveries(ctx, msg.ID))
+		}
+		if next == "0-0" || len(msgs) == 0 || ctx.Err() != nil {
+			return nil
+		}
+		start = next
+	}
+}
+
+// deliveries returns how many times the message has been delivered,
+// counting the claim that just happened.
+func (s *streamConsumer) deliveries(ctx context.Context, id string) int64 {
+	pending, err := s.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: s.Stream,
+		Group:  s.Group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 1
+	}
+	return pending[0].RetryCount
+}
+
+// process runs msg through the mux and acknowledges it if the handler
+// succeeded or the message has run out of retries.
+func (s *streamConsumer) process(msg redis.XMessage, deliveries int64) {
+	taskType := StreamTaskType(s.Stream)
+	ctx := context.WithValue(context.Background(), streamMessageIDKey{}, msg.ID)
+	err := s.runtime.Mux.ProcessTask(ctx, asynq.NewTask(taskType, streamPayload(msg)))
+	if err != nil {
+		if deliveries <= int64(s.runtime.retries.get(taskType).MaxRetries) {
+			log.Printf("Jobs: %s message %s failed, retrying in %s: %v", s.Stream, msg.ID, s.ClaimIdle, err)
+			return
+		}
+		if deadErr := s.bury(ctx, msg, err); deadErr != nil {
+			log.Printf("Jobs: failed to move %s message %s to %s: %v", s.Stream, msg.ID, DeadStream(s.Stream), deadErr)
+			return
+		}
+		log.Printf("Jobs: %s message %s failed %d times, moved to %s: %v", s.Stream, msg.ID, deliveries, DeadStream(s.Stream), err)
+	}
+	if err := s.client.XAck(ctx, s.Stream, s.Group, msg.ID).Err(); err != nil {
+		log.Printf("Jobs: failed to acknowledge %s message %s: %v", s.Stream, msg.ID, err)
+	}
+}
+
+// bury copies msg to the dead stream along with the error that failed it.
+func (s *streamConsumer) bury(ctx context.Context, msg redis.XMessage, failure error) error {
+	values := make(map[string]interface{}, len(msg.Values)+2)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["id"] = msg.ID
+	values["error"] = redact.String(failure.Error())
+	return s.client.XAdd(ctx, &redis.XAddArgs{Stream: DeadStream(s.Stream), Values: values}).Err()
+}
+
+// streamPayload is the task payload for msg: the "payload" field of
+// messages sent with Publish, or all fields as a JSON object.
+func streamPayload(msg redis.XMessage) []byte {
+	if payload, ok := msg.Values["payload"].(string); ok && len(msg.Values) == 1 {
+		return []byte(payload)
+	}
+	data, _ := json.Marshal(msg.Values)
+	return data
+}
@@ -0,0 +1,120 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/jobs"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStreams(t *testing.T) {
+	ctx := context.Background()
+	runtime, err := jobs.NewRuntime(jobs.MemoryRedisURL)
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+	defer runtime.Shutdown()
+
+	var mu sync.Mutex
+	var received []string
+	attempts := map[string]int{}
+	consumer := jobs.StreamConsumer{Stream: "orders", Block: 20 * time.Millisecond, ClaimIdle: 100 * time.Millisecond}
+	err = runtime.HandleStreamFunc(consumer, func(ctx context.Context, task *asynq.Task) error {
+		id, _ := jobs.StreamMessageID(ctx)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[id]++
+		switch string(task.Payload()) {
+		case `{"order":"flaky"}`:
+			if attempts[id] == 1 {
+				return errors.New("warehouse unavailable")
+			}
+		case `{"order":"broken"}`:
+			return errors.New("no such product")
+		}
+		received = append(received, string(task.Payload()))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("HandleStreamFunc: %v", err)
+	}
+	if err := runtime.HandleStreamFunc(jobs.StreamConsumer{Stream: "orders"}, nil); err == nil {
+		t.Error("expected an error for a second consumer of the same stream")
+	}
+	runtime.SetRetryPolicy(jobs.StreamTaskType("orders"), jobs.RetryPolicy{MaxRetries: 1})
+
+	if err := runtime.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	client, err := runtime.RedisClient()
+	if err != nil {
+		t.Fatalf("RedisClient: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	for _, order := range []string{"first", "flaky", "broken"} {
+		if _, err := runtime.Publish(ctx, "orders", map[string]string{"order": order}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	// Messages from other producers arrive as their fields
+	if err := client.XAdd(ctx, &redis.XAddArgs{Stream: "orders", Values: map[string]interface{}{"order": "external", "source": "shop"}}).Err(); err != nil {
+		t.Fatalf("XAdd: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := client.XPending(ctx, "orders", jobs.DefaultStreamGroup).Result()
+		if err != nil {
+			t.Fatalf("XPending: %v", err)
+		}
+		dead, _ := client.XLen(ctx, jobs.DeadStream("orders")).Result()
+		if pending.Count == 0 && dead == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("messages still pending: %+v, %d dead", pending, dead)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{`{"order":"first"}`, `{"order":"external","source":"shop"}`, `{"order":"flaky"}`}
+	if len(received) != len(want) {
+		t.Fatalf("received %v, want %v", received, want)
+	}
+	for i := range want {
+		if received[i] != want[i] {
+			t.Errorf("received[%d] = %s, want %s", i, received[i], want[i])
+		}
+	}
+
+	dead, err := client.XRange(ctx, jobs.DeadStream("orders"), "-", "+").Result()
+	if err != nil {
+		t.Fatalf("XRange: %v", err)
+	}
+	if dead[0].Values["error"] != "no such product" || dead[0].Values["payload"] != `{"order":"broken"}` {
+		t.Errorf("unexpected dead message: %v", dead[0].Values)
+	}
+	if n := attempts[dead[0].Values["id"].(string)]; n != 2 {
+		t.Errorf("expected the broken message to be tried twice, got %d", n)
+	}
+}
+
+func TestPublishWithoutRedis(t *testing.T) {
+	runtime, err := jobs.NewRuntime("")
+	if err != nil {
+		t.Fatalf("NewRuntime: %v", err)
+	}
+	id, err := runtime.Publish(context.Background(), "orders", map[string]string{"order": "first"})
+	if err != nil || id != "" {
+		t.Errorf("Publish = %q, %v; want a logged no-op", id, err)
+	}
+}
@@ -6,16 +6,22 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/alicebob/miniredis/v2"
 )
 
-// RedisContainer manages a Redis Docker container for testing
+// RedisContainer manages the Redis used for testing: an embedded
+// miniredis by default, or a Docker container with REDIS_DOCKER=true.
 type RedisContainer struct {
 	containerID string
 	port        string
 	isGHA       bool
+	memory      *miniredis.Miniredis
 }
 
-// StartRedisContainer starts a Redis container for testing
+// StartRedisContainer starts a Redis for testing. It uses an embedded
+// miniredis unless USE_EXISTING_REDIS=true (Redis on port 6379) or
+// REDIS_DOCKER=true (a redis:7-alpine container) asks for a real server.
 func StartRedisContainer() (*RedisContainer, error) {
 	// Check if we should use existing Redis
 	if os.Getenv("USE_EXISTING_REDIS") == "true" {
@@ -26,16 +32,15 @@ func StartRedisContainer() (*RedisContainer, error) {
 		}, nil
 	}
 	
-	// Check if we're running in GitHub Actions
-	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		// GHA provides Redis as a service on port 6379
-		return &RedisContainer{
-			port:  "6379",
-			isGHA: true,
-		}, nil
+	if os.Getenv("REDIS_DOCKER") != "true" {
+		memory, err := miniredis.Run()
+		if err != nil {
+			return nil, fmt.Errorf("failed to start in-memory Redis: %w", err)
+		}
+		return &RedisContainer{memory: memory}, nil
 	}
 
-	// For local testing, require Docker
+	// A real server was requested, so require Docker
 	if _, err := exec.LookPath("docker"); err != nil {
 		return nil, fmt.Errorf("docker not found: install Docker and try again")
 	}
@@ -95,6 +100,10 @@ func StartRedisContainer() (*RedisContainer, error) {
 
 // Stop stops the Redis container
 func (rc *RedisContainer) Stop() error {
+	if rc.memory != nil {
+		rc.memory.Close()
+		return nil
+	}
 	if rc.isGHA {
 		// Don't stop GHA's Redis service
 		return nil
@@ -107,11 +116,18 @@ func (rc *RedisContainer) Stop() error {
 
 // URL returns the Redis connection URL
 func (rc *RedisContainer) URL() string {
+	if rc.memory != nil {
+		return "redis://" + rc.memory.Addr()
+	}
 	return fmt.Sprintf("redis://localhost:%s", rc.port)
 }
 
 // FlushAll clears all data from Redis
 func (rc *RedisContainer) FlushAll() error {
+	if rc.memory != nil {
+		rc.memory.FlushAll()
+		return nil
+	}
 	if rc.isGHA {
 		// In GHA, connect to Redis service directly
 		// We could use redis-cli if available, but let's use a simple network approach
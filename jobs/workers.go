@@ -0,0 +1,238 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// Heartbeat timing. A worker that hasn't reported within WorkerTTL is
+// considered dead; dead entries are dropped after WorkerForgetAfter.
+const (
+	HeartbeatInterval = 5 * time.Second
+	WorkerTTL         = 3 * HeartbeatInterval
+	WorkerForgetAfter = time.Hour
+)
+
+// workersKey is the Redis hash holding one JSON WorkerStatus per worker.
+const workersKey = "buffkit:workers"
+
+// WorkerStatus is the liveness record a worker publishes on every heartbeat.
+type WorkerStatus struct {
+	ID            string         `json:"id"`
+	Hostname      string         `json:"hostname"`
+	PID           int            `json:"pid"`
+	Queues        map[string]int `json:"queues"`
+	Concurrency   int            `json:"concurrency"`
+	StartedAt     time.Time      `json:"started_at"`
+	LastHeartbeat time.Time      `json:"last_heartbeat"`
+
+	// Processing counts in-flight tasks by type at the last heartbeat.
+	Processing map[string]int `json:"processing"`
+}
+
+// Alive reports whether the worker has sent a heartbeat within WorkerTTL.
+func (w WorkerStatus) Alive() bool {
+	return w.AliveAt(time.Now())
+}
+
+// AliveAt is Alive as of now.
+func (w WorkerStatus) AliveAt(now time.Time) bool {
+	return now.Sub(w.LastHeartbeat) < WorkerTTL
+}
+
+// WorkerRegistry stores worker heartbeats in Redis.
+type WorkerRegistry struct {
+	client redis.UniversalClient
+	Clock  clock.Clock // Defaults to clock.Real
+}
+
+// NewWorkerRegistry creates a registry using client.
+func NewWorkerRegistry(client redis.UniversalClient) *WorkerRegistry {
+	return &WorkerRegistry{client: client}
+}
+
+// Beat records status as the worker's latest heartbeat.
+func (wr *WorkerRegistry) Beat(ctx context.Context, status WorkerStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("jobs: encode worker status: %w", err)
+	}
+	if err := wr.client.HSet(ctx, workersKey, status.ID, data).Err(); err != nil {
+		return fmt.Errorf("jobs: record heartbeat: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes a worker's record, e.g. on graceful shutdown.
+func (wr *WorkerRegistry) Remove(ctx context.Context, id string) error {
+	return wr.client.HDel(ctx, workersKey, id).Err()
+}
+
+// List returns known workers, alive ones first, then by hostname and PID.
+// Workers silent for longer than WorkerForgetAfter are removed.
+func (wr *WorkerRegistry) List(ctx context.Context) ([]WorkerStatus, error) {
+	entries, err := wr.client.HGetAll(ctx, workersKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("jobs: list workers: %w", err)
+	}
+
+	now := clock.Or(wr.Clock).Now()
+	var workers []WorkerStatus
+	for id, data := range entries {
+		var w WorkerStatus
+		if err := json.Unmarshal([]byte(data), &w); err != nil || now.Sub(w.LastHeartbeat) > WorkerForgetAfter {
+			_ = wr.Remove(ctx, id)
+			continue
+		}
+		workers = append(workers, w)
+	}
+
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].AliveAt(now) != workers[j].AliveAt(now) {
+			return workers[i].AliveAt(now)
+		}
+		if workers[i].Hostname != workers[j].Hostname {
+			return workers[i].Hostname < workers[j].Hostname
+		}
+		return workers[i].PID < workers[j].PID
+	})
+	return workers, nil
+}
+
+// heartbeater publishes this process's WorkerStatus until stopped and
+// tracks which tasks are in flight.
+type heartbeater struct {
+	registry *WorkerRegistry
+	client   redis.UniversalClient
+	clock    clock.Clock
+
+	mu         sync.Mutex
+	status     WorkerStatus
+	processing map[string]int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newHeartbeater(client redis.UniversalClient, clk clock.Clock, concurrency int, queues map[string]int) *heartbeater {
+	hostname, _ := os.Hostname()
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return &heartbeater{
+		registry: &WorkerRegistry{client: client, Clock: clk},
+		client:   client,
+		clock:    clk,
+		status: WorkerStatus{
+			ID:          hostname + ":" + hex.EncodeToString(b),
+			Hostname:    hostname,
+			PID:         os.Getpid(),
+			Queues:      queues,
+			Concurrency: concurrency,
+			StartedAt:   clk.Now(),
+		},
+		processing: make(map[string]int),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// middleware counts in-flight tasks so heartbeats show what the worker is doing.
+func (h *heartbeater) middleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		h.mu.Lock()
+		h.processing[t.Type()]++
+		h.mu.Unlock()
+
+		defer func() {
+			h.mu.Lock()
+			if h.processing[t.Type()]--; h.processing[t.Type()] <= 0 {
+				delete(h.processing, t.Type())
+			}
+			h.mu.Unlock()
+		}()
+
+		return next.ProcessTask(ctx, t)
+	})
+}
+
+func (h *heartbeater) beat() {
+	h.mu.Lock()
+	status := h.status
+	status.LastHeartbeat = h.clock.Now()
+	status.Processing = make(map[string]int, len(h.processing))
+	for k, v := range h.processing {
+		status.Processing[k] = v
+	}
+	h.mu.Unlock()
+
+	if err := h.registry.Beat(context.Background(), status); err != nil {
+		log.Printf("Jobs: heartbeat failed: %v", err)
+	}
+}
+
+func (h *heartbeater) start() {
+	h.beat()
+	go func() {
+		defer close(h.done)
+		ticker := h.clock.NewTicker(HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				h.beat()
+			case <-h.stop:
+				_ = h.registry.Remove(context.Background(), h.status.ID)
+				_ = h.client.Close()
+				return
+			}
+		}
+	}()
+}
+
+func (h *heartbeater) shutdown() {
+	close(h.stop)
+	<-h.done
+}
+
+// RedisClient builds a go-redis client from the runtime's Redis URL, for
+// features that keep their own data in the same Redis. The caller closes
+// it.
+func (r *Runtime) RedisClient() (redis.UniversalClient, error) {
+	if r.config.RedisURL == "" {
+		return nil, fmt.Errorf("jobs: Redis not configured")
+	}
+	opt, err := asynq.ParseRedisURI(r.config.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	client, ok := opt.MakeRedisClient().(redis.UniversalClient)
+	if !ok {
+		return nil, fmt.Errorf("jobs: unsupported Redis connection")
+	}
+	return client, nil
+}
+
+// Workers returns the workers that have registered heartbeats, including
+// recently dead ones (see WorkerStatus.Alive). It works from any process
+// connected to the same Redis, not only from workers.
+func (r *Runtime) Workers(ctx context.Context) ([]WorkerStatus, error) {
+	client, err := r.RedisClient()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = client.Close() }()
+	return (&WorkerRegistry{client: client, Clock: r.clock}).List(ctx)
+}
@@ -0,0 +1,61 @@
+package jobs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/johnjansen/buffkit/jobs"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWorkerRegistry(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = client.Close() }()
+
+	registry := jobs.NewWorkerRegistry(client)
+
+	beats := []jobs.WorkerStatus{
+		{ID: "b", Hostname: "web-2", PID: 2, LastHeartbeat: time.Now(), Processing: map[string]int{"email:send": 1}},
+		{ID: "a", Hostname: "web-1", PID: 1, LastHeartbeat: time.Now().Add(-time.Minute)},
+		{ID: "gone", Hostname: "web-0", PID: 9, LastHeartbeat: time.Now().Add(-2 * jobs.WorkerForgetAfter)},
+	}
+	for _, b := range beats {
+		if err := registry.Beat(ctx, b); err != nil {
+			t.Fatalf("Beat: %v", err)
+		}
+	}
+
+	workers, err := registry.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(workers) != 2 {
+		t.Fatalf("expected 2 workers, got %d", len(workers))
+	}
+	if workers[0].ID != "b" || !workers[0].Alive() {
+		t.Errorf("expected the live worker first, got %+v", workers[0])
+	}
+	if workers[1].ID != "a" || workers[1].Alive() {
+		t.Errorf("expected the stale worker to be reported dead, got %+v", workers[1])
+	}
+	if workers[0].Processing["email:send"] != 1 {
+		t.Errorf("expected in-flight tasks to round-trip, got %v", workers[0].Processing)
+	}
+
+	// Long-dead workers are forgotten
+	if mr.HGet("buffkit:workers", "gone") != "" {
+		t.Error("expected the long-dead worker to be removed")
+	}
+
+	if err := registry.Remove(ctx, "a"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	workers, _ = registry.List(ctx)
+	if len(workers) != 1 {
+		t.Errorf("expected 1 worker after removal, got %d", len(workers))
+	}
+}
@@ -0,0 +1,328 @@
+// Package loader batches and caches the data a request loads (the
+// dataloader pattern). A page with fifty <bk-avatar user-id="..."> tags
+// then costs one query for the fifty users, rather than fifty queries.
+//
+// A Loader is defined once, with a function that loads many keys at once:
+//
+//	var Users = loader.New(func(ctx context.Context, ids []string) (map[string]*User, error) {
+//	    return store.UsersByID(ctx, ids) // SELECT ... WHERE id IN (...)
+//	})
+//
+// Handlers and components then load one key at a time, and get the
+// request's copy if it has been loaded already:
+//
+//	user, err := Users.Load(c, c.Param("user_id"))
+//
+// Keys are only batched if they're known before the first of them is
+// loaded. Queue them, or let the components registry do it: a component
+// registered with RegisterPrefetch queues its keys before any component
+// on the page renders:
+//
+//	registry.RegisterPrefetch("bk-avatar", func(c buffalo.Context, attrs map[string]string) {
+//	    Users.Queue(c, attrs["user-id"])
+//	})
+//
+// What's loaded is kept for the rest of the request by the cache
+// Middleware installs (Wire does). Without a cache, each Load runs the
+// batch function for its key alone.
+package loader
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// ContextKey is the key Middleware stores the request's cache under in
+// the Buffalo context.
+const ContextKey = "loader_cache"
+
+// ErrNotFound is returned by Load for a key the batch function left out
+// of its result.
+var ErrNotFound = errors.New("loader: not found")
+
+// errBatchPanicked is what the keys of a batch whose function panicked
+// get, so their waiters don't wait forever.
+var errBatchPanicked = errors.New("loader: batch function panicked")
+
+// BatchFunc loads the values for keys in one go. Keys with no value are
+// left out of the map.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader loads values of one kind by key, batching the keys a request
+// asks for. A Loader holds no data itself, so one is shared by all
+// requests; the data lives in each request's Cache.
+type Loader[K comparable, V any] struct {
+	batch BatchFunc[K, V]
+
+	// MaxBatch caps the keys passed to the batch function at once, for
+	// databases that limit the size of IN (...) lists. 0 means no cap.
+	MaxBatch int
+}
+
+// New creates a Loader that loads with batch.
+func New[K comparable, V any](batch BatchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{batch: batch}
+}
+
+// Cache holds what one request's loaders have loaded.
+type Cache struct {
+	mu    sync.Mutex
+	state map[any]any // *Loader[K, V] -> *state[K, V]
+}
+
+// NewCache creates an empty cache.
+func NewCache() *Cache {
+	return &Cache{state: make(map[any]any)}
+}
+
+// cacheKey is the context key used by WithCache for plain contexts.
+type cacheKey struct{}
+
+// WithCache returns a copy of ctx with a cache of its own. Use it in
+// background jobs and other code that runs outside a request.
+func WithCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheKey{}, NewCache())
+}
+
+// FromContext returns the cache in ctx, or nil. It understands both
+// WithCache contexts and Buffalo request contexts.
+func FromContext(ctx context.Context) *Cache {
+	if ctx == nil {
+		return nil
+	}
+	if cache, ok := ctx.Value(cacheKey{}).(*Cache); ok {
+		return cache
+	}
+	if cache, ok := ctx.Value(ContextKey).(*Cache); ok {
+		return cache
+	}
+	return nil
+}
+
+// Middleware gives each request a cache of its own.
+func Middleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		c.Set(ContextKey, NewCache())
+		return next(c)
+	}
+}
+
+// state is one loader's share of a request's cache.
+type state[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]*entry[V]
+	queued  []K // keys with entries that haven't been loaded yet
+}
+
+// entry is a key's value, once done is closed.
+type entry[V any] struct {
+	started bool
+	done    chan struct{}
+	value   V
+	err     error
+}
+
+// state returns the loader's state in ctx's cache, or nil if ctx has no
+// cache.
+func (l *Loader[K, V]) state(ctx context.Context) *state[K, V] {
+	cache := FromContext(ctx)
+	if cache == nil {
+		return nil
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	s, ok := cache.state[l].(*state[K, V])
+	if !ok {
+		s = &state[K, V]{entries: make(map[K]*entry[V])}
+		cache.state[l] = s
+	}
+	return s
+}
+
+// queue adds entries for the keys not seen yet. s.mu must be held.
+func (s *state[K, V]) queue(keys []K) {
+	for _, key := range keys {
+		if _, ok := s.entries[key]; !ok {
+			s.entries[key] = &entry[V]{done: make(chan struct{})}
+			s.queued = append(s.queued, key)
+		}
+	}
+}
+
+// Queue notes keys the request is going to load, so that they're loaded
+// in the same batch as the next key it does load. Keys already loaded or
+// queued are ignored, as is everything when ctx has no cache.
+func (l *Loader[K, V]) Queue(ctx context.Context, keys ...K) {
+	s := l.state(ctx)
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue(keys)
+}
+
+// Prime stores value for key in the request's cache, for values the
+// request already has, such as a record it has just created.
+func (l *Loader[K, V]) Prime(ctx context.Context, key K, value V) {
+	s := l.state(ctx)
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry[V]{done: make(chan struct{})}
+		s.entries[key] = e
+	}
+	if e.started {
+		return
+	}
+	e.started, e.value = true, value
+	close(e.done)
+}
+
+// Load returns the value for key, loading it with the keys queued so far
+// unless the request has loaded it already. Loading fails with
+// ErrNotFound when the batch function has no value for key, and with
+// ctx's error when ctx is done first.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	values, err := l.LoadMany(ctx, []K{key})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	value, ok := values[key]
+	if !ok {
+		var zero V
+		return zero, ErrNotFound
+	}
+	return value, nil
+}
+
+// LoadMany returns the values for keys, loading them in one batch with
+// the keys queued so far. Keys with no value are left out of the map.
+// The error is the first a batch for one of the keys returned. Errors are
+// kept for the request like values, except ctx's own: a batch that ran
+// out of time is tried again by the next Load.
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) (map[K]V, error) {
+	s := l.state(ctx)
+	if s == nil {
+		return l.load(ctx, keys)
+	}
+
+	s.mu.Lock()
+	s.queue(keys)
+	waits := make([]*entry[V], len(keys))
+	for i, key := range keys {
+		waits[i] = s.entries[key]
+	}
+	var batch []K
+	for _, e := range waits {
+		if !e.started {
+			batch = s.take()
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if len(batch) > 0 {
+		l.run(ctx, s, batch)
+	}
+
+	values := make(map[K]V, len(keys))
+	for i, e := range waits {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if errors.Is(e.err, ErrNotFound) {
+			continue
+		}
+		if e.err != nil {
+			return nil, e.err
+		}
+		values[keys[i]] = e.value
+	}
+	return values, nil
+}
+
+// take removes the queued keys that still need loading, marking their
+// entries started. s.mu must be held.
+func (s *state[K, V]) take() []K {
+	var batch []K
+	for _, key := range s.queued {
+		if e := s.entries[key]; !e.started {
+			e.started = true
+			batch = append(batch, key)
+		}
+	}
+	s.queued = nil
+	return batch
+}
+
+// run loads batch, in chunks of MaxBatch, into the entries for its keys.
+func (l *Loader[K, V]) run(ctx context.Context, s *state[K, V], batch []K) {
+	for len(batch) > 0 {
+		n := len(batch)
+		if l.MaxBatch > 0 && n > l.MaxBatch {
+			n = l.MaxBatch
+		}
+		l.runChunk(ctx, s, batch[:n])
+		batch = batch[n:]
+	}
+}
+
+func (l *Loader[K, V]) runChunk(ctx context.Context, s *state[K, V], keys []K) {
+	values, err := map[K]V(nil), errBatchPanicked
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, key := range keys {
+			e := s.entries[key]
+			value, ok := values[key]
+			switch {
+			case err != nil:
+				e.err = err
+			case !ok:
+				e.err = ErrNotFound
+			default:
+				e.value = value
+			}
+			close(e.done)
+			// A batch cut short by its context may work for the next caller
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				delete(s.entries, key)
+			}
+		}
+	}()
+	values, err = l.batch(ctx, keys)
+}
+
+// load runs the batch function for keys directly, for contexts without a
+// cache.
+func (l *Loader[K, V]) load(ctx context.Context, keys []K) (map[K]V, error) {
+	values := make(map[K]V, len(keys))
+	for start := 0; start < len(keys); {
+		end := len(keys)
+		if l.MaxBatch > 0 && end-start > l.MaxBatch {
+			end = start + l.MaxBatch
+		}
+		loaded, err := l.batch(ctx, keys[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys[start:end] {
+			if value, ok := loaded[key]; ok {
+				values[key] = value
+			}
+		}
+		start = end
+	}
+	return values, nil
+}
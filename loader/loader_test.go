@@ -0,0 +1,209 @@
+package loader_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a batch function that names users after their IDs and
+// records the batches it was called with.
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]int
+	err     error
+}
+
+func (r *recorder) load(ctx context.Context, ids []int) (map[int]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	batch := append([]int(nil), ids...)
+	sort.Ints(batch)
+	r.batches = append(r.batches, batch)
+	if r.err != nil {
+		return nil, r.err
+	}
+	users := make(map[int]string)
+	for _, id := range ids {
+		if id > 0 {
+			users[id] = fmt.Sprintf("user %d", id)
+		}
+	}
+	return users, nil
+}
+
+func TestLoadBatchesQueuedKeys(t *testing.T) {
+	rec := &recorder{}
+	users := loader.New(rec.load)
+	ctx := loader.WithCache(context.Background())
+
+	users.Queue(ctx, 3, 1, 2, 1)
+	name, err := users.Load(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "user 1", name)
+
+	// Queued keys came along; loaded ones aren't loaded again
+	name, err = users.Load(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "user 3", name)
+	many, err := users.LoadMany(ctx, []int{2, 4, -1})
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{2: "user 2", 4: "user 4"}, many)
+	assert.Equal(t, [][]int{{1, 2, 3}, {-1, 4}}, rec.batches)
+
+	// Missing keys are remembered too
+	_, err = users.Load(ctx, -1)
+	assert.ErrorIs(t, err, loader.ErrNotFound)
+	assert.Len(t, rec.batches, 2)
+
+	// Another request starts from scratch
+	_, err = users.Load(loader.WithCache(context.Background()), 1)
+	require.NoError(t, err)
+	assert.Len(t, rec.batches, 3)
+}
+
+func TestLoadWithoutCache(t *testing.T) {
+	rec := &recorder{}
+	users := loader.New(rec.load)
+	users.MaxBatch = 2
+
+	users.Queue(context.Background(), 9) // ignored
+	many, err := users.LoadMany(context.Background(), []int{1, 2, 3})
+	require.NoError(t, err)
+	assert.Len(t, many, 3)
+	_, err = users.Load(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2}, {3}, {1}}, rec.batches)
+}
+
+func TestMaxBatch(t *testing.T) {
+	rec := &recorder{}
+	users := loader.New(rec.load)
+	users.MaxBatch = 2
+	ctx := loader.WithCache(context.Background())
+
+	users.Queue(ctx, 1, 2, 3, 4, 5)
+	_, err := users.Load(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, rec.batches)
+}
+
+func TestPrime(t *testing.T) {
+	rec := &recorder{}
+	users := loader.New(rec.load)
+	ctx := loader.WithCache(context.Background())
+
+	users.Queue(ctx, 1, 2)
+	users.Prime(ctx, 1, "just created")
+	users.Prime(ctx, 3, "also created")
+
+	name, err := users.Load(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "just created", name)
+	name, err = users.Load(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "user 2", name)
+	assert.Equal(t, [][]int{{2}}, rec.batches)
+}
+
+func TestLoadErrors(t *testing.T) {
+	rec := &recorder{err: errors.New("database is down")}
+	users := loader.New(rec.load)
+	ctx := loader.WithCache(context.Background())
+
+	_, err := users.Load(ctx, 1)
+	assert.EqualError(t, err, "database is down")
+	_, err = users.Load(ctx, 1)
+	assert.EqualError(t, err, "database is down")
+	assert.Len(t, rec.batches, 1, "errors are kept for the request")
+
+	// A batch that ran out of time is tried again
+	rec.err = context.DeadlineExceeded
+	_, err = users.Load(ctx, 2)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	rec.err = nil
+	name, err := users.Load(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "user 2", name)
+
+	// A panicking batch function doesn't leave other loads waiting
+	panicky := loader.New(func(ctx context.Context, ids []int) (map[int]string, error) {
+		panic("boom")
+	})
+	panicky.Queue(ctx, 2)
+	assert.Panics(t, func() { _, _ = panicky.Load(ctx, 1) })
+	_, err = panicky.Load(ctx, 2)
+	assert.Error(t, err)
+}
+
+func TestConcurrentLoadsShareABatch(t *testing.T) {
+	release := make(chan struct{})
+	var calls int
+	var mu sync.Mutex
+	users := loader.New(func(ctx context.Context, ids []int) (map[int]string, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		return map[int]string{1: "user 1"}, nil
+	})
+	ctx := loader.WithCache(context.Background())
+
+	var wg sync.WaitGroup
+	names := make([]string, 5)
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			names[i], _ = users.Load(ctx, 1)
+		}(i)
+	}
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+	wg.Wait()
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{"user 1", "user 1", "user 1", "user 1", "user 1"}, names)
+
+	// Waiting stops with the caller's context
+	started := make(chan struct{})
+	stuck := loader.New(func(ctx context.Context, ids []int) (map[int]string, error) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return nil, nil
+	})
+	go func() { _, _ = stuck.Load(ctx, 1) }()
+	<-started
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	_, err := stuck.Load(short, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMiddleware(t *testing.T) {
+	rec := &recorder{}
+	users := loader.New(rec.load)
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(loader.Middleware)
+	app.GET("/", func(c buffalo.Context) error {
+		users.Queue(c, 1, 2)
+		_, _ = users.Load(c, 1)
+		_, _ = users.Load(c, 2)
+		return c.Render(http.StatusOK, nil)
+	})
+
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, [][]int{{1, 2}, {1, 2}}, rec.batches, "one batch per request")
+}
@@ -0,0 +1,293 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+)
+
+// CampaignState is where a campaign is in its run.
+type CampaignState string
+
+const (
+	CampaignSending  CampaignState = "sending"
+	CampaignPaused   CampaignState = "paused"
+	CampaignCanceled CampaignState = "canceled"
+	CampaignDone     CampaignState = "done"
+)
+
+// RecipientStatus is whether a campaign's message reached a recipient.
+type RecipientStatus string
+
+const (
+	RecipientPending RecipientStatus = "pending"
+	RecipientSent    RecipientStatus = "sent"
+	RecipientFailed  RecipientStatus = "failed"
+)
+
+// DefaultBatchSize is the batch size of campaigns that don't set one.
+const DefaultBatchSize = 100
+
+// campaignTask is the task type of a campaign batch job.
+const campaignTask = "mail:campaign:batch"
+
+// ErrCampaignNotFound is returned for an unknown campaign ID.
+var ErrCampaignNotFound = auth.NotFoundError("mail: campaign not found")
+
+// Campaign is a template sent to a recipient list.
+type Campaign struct {
+	ID       string
+	Template string
+
+	// BatchSize is how many messages one job sends. Defaults to
+	// DefaultBatchSize.
+	BatchSize int
+
+	// Rate is the most messages sent a minute; batches are spaced to
+	// keep under it. Zero sends batches back to back.
+	Rate int
+
+	State     CampaignState
+	CreatedAt time.Time
+
+	// Run counts the campaign's starts and resumes. A batch job carries
+	// the run it belongs to and stops if the campaign has moved on, so
+	// pausing and resuming never leaves two batch chains sending.
+	Run int
+}
+
+// Recipient is one address on a campaign, with the data its message is
+// rendered with.
+type Recipient struct {
+	Email  string
+	Data   map[string]any
+	Status RecipientStatus
+	Error  string     // why sending failed
+	SentAt *time.Time // when the message was sent or failed
+}
+
+// CampaignStore keeps campaigns and their recipients' status.
+type CampaignStore interface {
+	CreateCampaign(ctx context.Context, c *Campaign, recipients []Recipient) error
+	Campaign(ctx context.Context, id string) (*Campaign, error)
+	UpdateCampaign(ctx context.Context, c *Campaign) error
+	// Recipients returns up to limit of the campaign's recipients with
+	// status, in the order they were added.
+	Recipients(ctx context.Context, id string, status RecipientStatus, limit int) ([]Recipient, error)
+	MarkRecipient(ctx context.Context, id, email string, status RecipientStatus, sendErr string, at time.Time) error
+	RecipientCounts(ctx context.Context, id string) (map[RecipientStatus]int, error)
+}
+
+// Queue is the jobs runtime campaigns send through; *jobs.Runtime
+// implements it.
+type Queue interface {
+	HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error)
+	EnqueueIn(delay time.Duration, taskType string, payload interface{}) error
+}
+
+// Campaigns send one template to a list of recipients, such as a product
+// announcement. The list is sent in batches by background jobs, at most
+// Rate messages a minute so a provider's sending limits are respected.
+// Each recipient's status is recorded, and a campaign can be paused,
+// resumed, or canceled while it sends:
+//
+//	c, err := kit.Campaigns.Start(ctx, mail.Campaign{
+//	    Template:  "news/october",
+//	    BatchSize: 50,
+//	    Rate:      600,
+//	}, []mail.Recipient{{Email: "ada@example.com", Data: map[string]any{"Name": "Ada"}}})
+//
+//	kit.Campaigns.Pause(ctx, c.ID)
+//	progress, err := kit.Campaigns.Progress(ctx, c.ID) // progress[mail.RecipientSent] == 50
+//
+// The template receives the Recipient, so it can use {{.Email}} and
+// {{.Data.Name}}.
+type Campaigns struct {
+	Queue  Queue
+	Store  CampaignStore
+	Sender Sender
+
+	// Clock stamps campaigns and sends. Defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// batchPayload is the payload of a campaign batch job.
+type batchPayload struct {
+	CampaignID string `json:"campaign_id"`
+	Run        int    `json:"run"`
+}
+
+// NewCampaigns creates a Campaigns and registers its batch job handler
+// on queue.
+func NewCampaigns(queue Queue, store CampaignStore, sender Sender) *Campaigns {
+	cs := &Campaigns{Queue: queue, Store: store, Sender: sender}
+	queue.HandleFunc(campaignTask, func(ctx context.Context, t *asynq.Task) error {
+		var p batchPayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return fmt.Errorf("mail: campaign batch: bad payload: %w", err)
+		}
+		return cs.SendBatch(ctx, p.CampaignID, p.Run)
+	})
+	return cs
+}
+
+// Start records campaign c for recipients and queues its first batch.
+// c.Template must be registered. The returned campaign has its ID set.
+func (cs *Campaigns) Start(ctx context.Context, c Campaign, recipients []Recipient) (*Campaign, error) {
+	templatesMu.RLock()
+	_, ok := templates[c.Template]
+	templatesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("mail: no template named %s", c.Template)
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("mail: campaign has no recipients")
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("mail: campaign id: %w", err)
+	}
+	c.ID = hex.EncodeToString(id)
+	c.State = CampaignSending
+	c.CreatedAt = clock.Or(cs.Clock).Now()
+	c.Run = 1
+
+	list := make([]Recipient, len(recipients))
+	for i, r := range recipients {
+		list[i] = Recipient{Email: r.Email, Data: r.Data, Status: RecipientPending}
+	}
+	if err := cs.Store.CreateCampaign(ctx, &c, list); err != nil {
+		return nil, fmt.Errorf("mail: create campaign: %w", err)
+	}
+	if err := cs.Queue.EnqueueIn(0, campaignTask, batchPayload{CampaignID: c.ID, Run: c.Run}); err != nil {
+		return nil, fmt.Errorf("mail: campaign %s: %w", c.ID, err)
+	}
+	log.Printf("Mail: Started campaign %s (%s) for %d recipient(s)", c.ID, c.Template, len(list))
+	return &c, nil
+}
+
+// SendBatch sends the next batch of campaign id and queues the one after
+// it. The batch job calls it; run is the run the job was queued for, and
+// a batch from an earlier run, or for a paused or canceled campaign,
+// sends nothing.
+func (cs *Campaigns) SendBatch(ctx context.Context, id string, run int) error {
+	c, err := cs.Store.Campaign(ctx, id)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("mail: campaign %s: %w", id, err)
+	}
+	if c.State != CampaignSending || c.Run != run {
+		return nil
+	}
+
+	batch, err := cs.Store.Recipients(ctx, id, RecipientPending, c.BatchSize)
+	if err != nil {
+		return fmt.Errorf("mail: campaign %s: %w", id, err)
+	}
+	for _, r := range batch {
+		status, sendErr := RecipientSent, ""
+		if err := cs.send(ctx, c, r); err != nil {
+			status, sendErr = RecipientFailed, err.Error()
+		}
+		if err := cs.Store.MarkRecipient(ctx, id, r.Email, status, sendErr, clock.Or(cs.Clock).Now()); err != nil {
+			return fmt.Errorf("mail: campaign %s: %w", id, err)
+		}
+	}
+
+	if len(batch) < c.BatchSize {
+		c.State = CampaignDone
+		if err := cs.Store.UpdateCampaign(ctx, c); err != nil {
+			return fmt.Errorf("mail: campaign %s: %w", id, err)
+		}
+		log.Printf("Mail: Campaign %s done", id)
+		return nil
+	}
+	return cs.Queue.EnqueueIn(c.interval(), campaignTask, batchPayload{CampaignID: id, Run: run})
+}
+
+// send renders and sends the campaign's message to one recipient.
+func (cs *Campaigns) send(ctx context.Context, c *Campaign, r Recipient) error {
+	msg, err := Render(c.Template, r.Email, r)
+	if err != nil {
+		return err
+	}
+	return cs.Sender.Send(ctx, msg)
+}
+
+// interval is the delay between batches that keeps c under its Rate.
+func (c *Campaign) interval() time.Duration {
+	if c.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(c.BatchSize) * time.Minute / time.Duration(c.Rate)
+}
+
+// Pause stops campaign id after the batch in progress. Resume continues
+// with the recipients not yet sent.
+func (cs *Campaigns) Pause(ctx context.Context, id string) error {
+	return cs.transition(ctx, id, CampaignPaused, CampaignSending)
+}
+
+// Resume continues a paused campaign.
+func (cs *Campaigns) Resume(ctx context.Context, id string) error {
+	if err := cs.transition(ctx, id, CampaignSending, CampaignPaused); err != nil {
+		return err
+	}
+	c, err := cs.Store.Campaign(ctx, id)
+	if err != nil {
+		return fmt.Errorf("mail: campaign %s: %w", id, err)
+	}
+	return cs.Queue.EnqueueIn(0, campaignTask, batchPayload{CampaignID: id, Run: c.Run})
+}
+
+// Cancel stops campaign id for good. Recipients not yet sent stay
+// pending.
+func (cs *Campaigns) Cancel(ctx context.Context, id string) error {
+	return cs.transition(ctx, id, CampaignCanceled, CampaignSending, CampaignPaused)
+}
+
+// transition moves campaign id to state, if it's in one of from.
+func (cs *Campaigns) transition(ctx context.Context, id string, state CampaignState, from ...CampaignState) error {
+	c, err := cs.Store.Campaign(ctx, id)
+	if err != nil {
+		return fmt.Errorf("mail: campaign %s: %w", id, err)
+	}
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || c.State == s
+	}
+	if !allowed {
+		return fmt.Errorf("mail: campaign %s is %s, can't make it %s", id, c.State, state)
+	}
+	c.State = state
+	if state == CampaignSending {
+		c.Run++
+	}
+	if err := cs.Store.UpdateCampaign(ctx, c); err != nil {
+		return fmt.Errorf("mail: campaign %s: %w", id, err)
+	}
+	return nil
+}
+
+// Progress counts campaign id's recipients by status.
+func (cs *Campaigns) Progress(ctx context.Context, id string) (map[RecipientStatus]int, error) {
+	if _, err := cs.Store.Campaign(ctx, id); err != nil {
+		return nil, fmt.Errorf("mail: campaign %s: %w", id, err)
+	}
+	return cs.Store.RecipientCounts(ctx, id)
+}
@@ -0,0 +1,281 @@
+package mail
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// MemoryCampaignStore keeps campaigns in memory, for tests and
+// development.
+type MemoryCampaignStore struct {
+	mu         sync.RWMutex
+	campaigns  map[string]*Campaign
+	recipients map[string][]*Recipient // campaign ID -> recipients, in order
+}
+
+// NewMemoryCampaignStore creates an empty MemoryCampaignStore.
+func NewMemoryCampaignStore() *MemoryCampaignStore {
+	return &MemoryCampaignStore{
+		campaigns:  make(map[string]*Campaign),
+		recipients: make(map[string][]*Recipient),
+	}
+}
+
+func (s *MemoryCampaignStore) CreateCampaign(ctx context.Context, c *Campaign, recipients []Recipient) error {
+	if err := readonly.Check("mail.CreateCampaign"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *c
+	s.campaigns[c.ID] = &stored
+	list := make([]*Recipient, len(recipients))
+	for i := range recipients {
+		r := recipients[i]
+		list[i] = &r
+	}
+	s.recipients[c.ID] = list
+	return nil
+}
+
+func (s *MemoryCampaignStore) Campaign(ctx context.Context, id string) (*Campaign, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.campaigns[id]
+	if !ok {
+		return nil, ErrCampaignNotFound
+	}
+	copied := *c
+	return &copied, nil
+}
+
+func (s *MemoryCampaignStore) UpdateCampaign(ctx context.Context, c *Campaign) error {
+	if err := readonly.Check("mail.UpdateCampaign"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.campaigns[c.ID]; !ok {
+		return ErrCampaignNotFound
+	}
+	stored := *c
+	s.campaigns[c.ID] = &stored
+	return nil
+}
+
+func (s *MemoryCampaignStore) Recipients(ctx context.Context, id string, status RecipientStatus, limit int) ([]Recipient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Recipient
+	for _, r := range s.recipients[id] {
+		if len(out) == limit {
+			break
+		}
+		if r.Status == status {
+			out = append(out, *r)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryCampaignStore) MarkRecipient(ctx context.Context, id, email string, status RecipientStatus, sendErr string, at time.Time) error {
+	if err := readonly.Check("mail.MarkRecipient"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.recipients[id] {
+		if r.Email == email {
+			r.Status, r.Error, r.SentAt = status, sendErr, &at
+			return nil
+		}
+	}
+	return fmt.Errorf("mail: campaign %s has no recipient %s", id, email)
+}
+
+func (s *MemoryCampaignStore) RecipientCounts(ctx context.Context, id string) (map[RecipientStatus]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[RecipientStatus]int)
+	for _, r := range s.recipients[id] {
+		counts[r.Status]++
+	}
+	return counts, nil
+}
+
+// SQLCampaignStore keeps campaigns in the mail_campaigns and
+// mail_campaign_recipients tables created by the db/migrations/mail
+// migration.
+type SQLCampaignStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLCampaignStore creates a campaign store backed by database/sql.
+func NewSQLCampaignStore(db *sql.DB, dialect string) *SQLCampaignStore {
+	return &SQLCampaignStore{db: db, dialect: dialect}
+}
+
+func (s *SQLCampaignStore) CreateCampaign(ctx context.Context, c *Campaign, recipients []Recipient) error {
+	if err := readonly.Check("mail.CreateCampaign"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO mail_campaigns (id, template, batch_size, rate, state, run, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+		c.ID, c.Template, c.BatchSize, c.Rate, string(c.State), c.Run, c.CreatedAt); err != nil {
+		return err
+	}
+	insert, err := tx.PrepareContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO mail_campaign_recipients (campaign_id, position, email, data, status) VALUES (?, ?, ?, ?, ?)"))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for i, r := range recipients {
+		data, err := json.Marshal(r.Data)
+		if err != nil {
+			return fmt.Errorf("recipient %s: %w", r.Email, err)
+		}
+		if _, err := insert.ExecContext(ctx, c.ID, i, r.Email, string(data), string(r.Status)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLCampaignStore) Campaign(ctx context.Context, id string) (*Campaign, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var c Campaign
+	var state string
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT id, template, batch_size, rate, state, run, created_at FROM mail_campaigns WHERE id = ?"), id).
+		Scan(&c.ID, &c.Template, &c.BatchSize, &c.Rate, &state, &c.Run, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCampaignNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.State = CampaignState(state)
+	return &c, nil
+}
+
+func (s *SQLCampaignStore) UpdateCampaign(ctx context.Context, c *Campaign) error {
+	if err := readonly.Check("mail.UpdateCampaign"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"UPDATE mail_campaigns SET batch_size = ?, rate = ?, state = ?, run = ? WHERE id = ?"),
+		c.BatchSize, c.Rate, string(c.State), c.Run, c.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrCampaignNotFound
+	}
+	return nil
+}
+
+func (s *SQLCampaignStore) Recipients(ctx context.Context, id string, status RecipientStatus, limit int) ([]Recipient, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT email, data, status, error, sent_at FROM mail_campaign_recipients WHERE campaign_id = ? AND status = ? ORDER BY position LIMIT ?"),
+		id, string(status), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Recipient
+	for rows.Next() {
+		var r Recipient
+		var data, state string
+		var sendErr sql.NullString
+		var sentAt sql.NullTime
+		if err := rows.Scan(&r.Email, &data, &state, &sendErr, &sentAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &r.Data); err != nil {
+			return nil, fmt.Errorf("recipient %s: %w", r.Email, err)
+		}
+		r.Status, r.Error = RecipientStatus(state), sendErr.String
+		if sentAt.Valid {
+			r.SentAt = &sentAt.Time
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLCampaignStore) MarkRecipient(ctx context.Context, id, email string, status RecipientStatus, sendErr string, at time.Time) error {
+	if err := readonly.Check("mail.MarkRecipient"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"UPDATE mail_campaign_recipients SET status = ?, error = ?, sent_at = ? WHERE campaign_id = ? AND email = ?"),
+		string(status), sendErr, at, id, email)
+	return err
+}
+
+func (s *SQLCampaignStore) RecipientCounts(ctx context.Context, id string) (map[RecipientStatus]int, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT status, COUNT(*) FROM mail_campaign_recipients WHERE campaign_id = ? GROUP BY status"), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[RecipientStatus]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[RecipientStatus(status)] = n
+	}
+	return counts, rows.Err()
+}
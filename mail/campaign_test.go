@@ -0,0 +1,214 @@
+package mail
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQueue records enqueued batch jobs instead of running them.
+type fakeQueue struct {
+	handlers map[string]func(context.Context, *asynq.Task) error
+	queued   []queuedJob
+}
+
+type queuedJob struct {
+	delay   time.Duration
+	payload batchPayload
+}
+
+func (q *fakeQueue) HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error) {
+	if q.handlers == nil {
+		q.handlers = make(map[string]func(context.Context, *asynq.Task) error)
+	}
+	q.handlers[taskType] = handler
+}
+
+func (q *fakeQueue) EnqueueIn(delay time.Duration, taskType string, payload interface{}) error {
+	q.queued = append(q.queued, queuedJob{delay: delay, payload: payload.(batchPayload)})
+	return nil
+}
+
+// runNext runs the oldest queued job through the registered handler.
+func (q *fakeQueue) runNext(t *testing.T) queuedJob {
+	t.Helper()
+	require.NotEmpty(t, q.queued)
+	job := q.queued[0]
+	q.queued = q.queued[1:]
+	data, err := json.Marshal(job.payload)
+	require.NoError(t, err)
+	require.NoError(t, q.handlers[campaignTask](context.Background(), asynq.NewTask(campaignTask, data)))
+	return job
+}
+
+// failingSender fails for one address and records the rest.
+type failingSender struct {
+	*DevSender
+	fail string
+}
+
+func (s failingSender) Send(ctx context.Context, msg Message) error {
+	if msg.To == s.fail {
+		return errors.New("mailbox unavailable")
+	}
+	return s.DevSender.Send(ctx, msg)
+}
+
+func recipients(n int) []Recipient {
+	list := make([]Recipient, n)
+	for i := range list {
+		list[i] = Recipient{Email: fmt.Sprintf("user%d@example.com", i), Data: map[string]any{"Name": fmt.Sprintf("User %d", i)}}
+	}
+	return list
+}
+
+func TestCampaignSendsInThrottledBatches(t *testing.T) {
+	require.NoError(t, RegisterTemplate("test/campaign", Template{Subject: "News", Text: "Hi {{.Data.Name}}"}))
+	queue := &fakeQueue{}
+	sender := failingSender{DevSender: NewDevSender(), fail: "user3@example.com"}
+	campaigns := NewCampaigns(queue, NewMemoryCampaignStore(), sender)
+	ctx := context.Background()
+
+	_, err := campaigns.Start(ctx, Campaign{Template: "test/missing"}, recipients(1))
+	assert.Error(t, err)
+	_, err = campaigns.Start(ctx, Campaign{Template: "test/campaign"}, nil)
+	assert.Error(t, err)
+
+	c, err := campaigns.Start(ctx, Campaign{Template: "test/campaign", BatchSize: 2, Rate: 60}, recipients(5))
+	require.NoError(t, err)
+	assert.Equal(t, CampaignSending, c.State)
+
+	assert.Equal(t, time.Duration(0), queue.runNext(t).delay)
+	sender.AssertSentCount(t, 2)
+	msg, ok := sender.LastTo("user1@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Hi User 1", msg.Text)
+
+	// 2 messages at 60 a minute: the next batch waits two seconds
+	assert.Equal(t, 2*time.Second, queue.runNext(t).delay)
+	queue.runNext(t)
+	assert.Empty(t, queue.queued)
+
+	progress, err := campaigns.Progress(ctx, c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[RecipientStatus]int{RecipientSent: 4, RecipientFailed: 1}, progress)
+	failed, err := campaigns.Store.Recipients(ctx, c.ID, RecipientFailed, 10)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "user3@example.com", failed[0].Email)
+	assert.Equal(t, "mailbox unavailable", failed[0].Error)
+
+	done, err := campaigns.Store.Campaign(ctx, c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CampaignDone, done.State)
+}
+
+func TestCampaignPauseResumeCancel(t *testing.T) {
+	require.NoError(t, RegisterTemplate("test/campaign", Template{Subject: "News", Text: "Hi {{.Data.Name}}"}))
+	queue := &fakeQueue{}
+	sender := NewDevSender()
+	campaigns := NewCampaigns(queue, NewMemoryCampaignStore(), sender)
+	ctx := context.Background()
+
+	c, err := campaigns.Start(ctx, Campaign{Template: "test/campaign", BatchSize: 2}, recipients(6))
+	require.NoError(t, err)
+	queue.runNext(t)
+
+	require.NoError(t, campaigns.Pause(ctx, c.ID))
+	assert.Error(t, campaigns.Pause(ctx, c.ID), "already paused")
+	queue.runNext(t) // the batch queued before the pause
+	sender.AssertSentCount(t, 2)
+
+	require.NoError(t, campaigns.Resume(ctx, c.ID))
+	require.Len(t, queue.queued, 1)
+	queue.runNext(t)
+	sender.AssertSentCount(t, 4)
+
+	// Pausing and resuming again leaves the old run's job behind; only
+	// the new run's job sends
+	require.NoError(t, campaigns.Pause(ctx, c.ID))
+	require.NoError(t, campaigns.Resume(ctx, c.ID))
+	require.Len(t, queue.queued, 2)
+	queue.runNext(t)
+	sender.AssertSentCount(t, 4)
+
+	require.NoError(t, campaigns.Cancel(ctx, c.ID))
+	queue.runNext(t)
+	sender.AssertSentCount(t, 4)
+	assert.Error(t, campaigns.Resume(ctx, c.ID), "canceled campaigns stay canceled")
+
+	progress, err := campaigns.Progress(ctx, c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[RecipientStatus]int{RecipientSent: 4, RecipientPending: 2}, progress)
+
+	_, err = campaigns.Progress(ctx, "nope")
+	assert.ErrorIs(t, err, ErrCampaignNotFound)
+}
+
+func TestSQLCampaignStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	schema, err := os.ReadFile("../db/migrations/mail/20261016140000_create_mail_campaigns.up.sql")
+	require.NoError(t, err)
+	for _, stmt := range strings.Split(string(schema), ";") {
+		if strings.TrimSpace(stmt) != "" {
+			_, err = db.Exec(stmt)
+			require.NoError(t, err)
+		}
+	}
+
+	ctx := context.Background()
+	store := NewSQLCampaignStore(db, "sqlite")
+	created := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	c := &Campaign{ID: "c1", Template: "news", BatchSize: 2, Rate: 60, State: CampaignSending, Run: 1, CreatedAt: created}
+	list := recipients(3)
+	for i := range list {
+		list[i].Status = RecipientPending
+	}
+	require.NoError(t, store.CreateCampaign(ctx, c, list))
+
+	loaded, err := store.Campaign(ctx, "c1")
+	require.NoError(t, err)
+	assert.Equal(t, "news", loaded.Template)
+	assert.Equal(t, CampaignSending, loaded.State)
+	_, err = store.Campaign(ctx, "c2")
+	assert.ErrorIs(t, err, ErrCampaignNotFound)
+
+	loaded.State, loaded.Run = CampaignPaused, 2
+	require.NoError(t, store.UpdateCampaign(ctx, loaded))
+	loaded, err = store.Campaign(ctx, "c1")
+	require.NoError(t, err)
+	assert.Equal(t, CampaignPaused, loaded.State)
+	assert.Equal(t, 2, loaded.Run)
+
+	pending, err := store.Recipients(ctx, "c1", RecipientPending, 2)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, "user0@example.com", pending[0].Email)
+	assert.Equal(t, "User 0", pending[0].Data["Name"])
+
+	require.NoError(t, store.MarkRecipient(ctx, "c1", "user0@example.com", RecipientSent, "", created))
+	require.NoError(t, store.MarkRecipient(ctx, "c1", "user1@example.com", RecipientFailed, "bounced", created))
+	failed, err := store.Recipients(ctx, "c1", RecipientFailed, 10)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "bounced", failed[0].Error)
+	require.NotNil(t, failed[0].SentAt)
+
+	counts, err := store.RecipientCounts(ctx, "c1")
+	require.NoError(t, err)
+	assert.Equal(t, map[RecipientStatus]int{RecipientSent: 1, RecipientFailed: 1, RecipientPending: 1}, counts)
+}
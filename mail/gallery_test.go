@@ -0,0 +1,59 @@
+package mail_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateGallery(t *testing.T) {
+	require.NoError(t, mail.RegisterTemplate("gallery/receipt", mail.Template{
+		Subject: "Receipt {{.Number}}",
+		Text:    "Total: {{.Total}}",
+		HTML:    "<p>Total: <b>{{.Total}}</b></p>",
+		Sample:  map[string]any{"Number": "A-1", "Total": "$12"},
+	}))
+	require.NoError(t, mail.RegisterTemplate("gallery/broken", mail.Template{
+		Subject: "{{.Missing.Field}}",
+		Text:    "x",
+		Sample:  map[string]any{},
+	}))
+
+	app := buffkittest.NewApp(t, buffkittest.Options{Config: buffkit.Config{DevMode: true}})
+	client := buffkittest.LoginAs(t, app, &auth.User{Email: "designer@example.com"})
+
+	res := client.Get("/__mail/templates?name=gallery/receipt")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	body := res.Body.String()
+	buffkittest.AssertElement(t, body, "a", "href", "/__mail/templates?name=gallery/broken")
+	buffkittest.AssertText(t, body, "Receipt A-1")
+	buffkittest.AssertText(t, body, "Total: $12")
+	buffkittest.AssertElement(t, body, "iframe", "srcdoc", "<p>Total: <b>$12</b></p>")
+	buffkittest.AssertElement(t, body, "input", "name", "to", "value", "designer@example.com")
+
+	res = client.Get("/__mail/templates?name=gallery/broken")
+	require.Equal(t, http.StatusOK, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "gallery/broken")
+
+	res = client.Post("/__mail/templates/send", url.Values{"name": {"gallery/receipt"}, "to": {"designer@example.com"}})
+	buffkittest.AssertRedirect(t, res, "/__mail/templates?name=gallery%2Freceipt&to=designer%40example.com")
+	msg, ok := app.Mailbox().LastTo("designer@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "[Test] Receipt A-1", msg.Subject)
+
+	res = client.Post("/__mail/templates/send", url.Values{"name": {"gallery/missing"}, "to": {"designer@example.com"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	app.Mailbox().AssertSentCount(t, 1)
+}
+
+func TestTemplateGalleryOnlyInDevMode(t *testing.T) {
+	app := buffkittest.NewApp(t, buffkittest.Options{})
+	assert.Equal(t, http.StatusNotFound, app.Client().Get("/__mail/templates").Code)
+}
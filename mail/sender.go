@@ -2,16 +2,26 @@ package mail
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"html"
+	"html/template"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gobuffalo/buffalo"
-	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/blob"
+	"github.com/johnjansen/buffkit/views"
 )
 
 // Message represents an email message
@@ -23,6 +33,17 @@ type Message struct {
 	Subject string   // Email subject
 	Text    string   // Plain text body
 	HTML    string   // HTML body (optional)
+
+	// Attachments are sent as files alongside the body. AttachBlob
+	// loads one from a blob store.
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a Message.
+type Attachment struct {
+	Filename    string
+	ContentType string // Defaults to one going by Filename's extension
+	Data        []byte
 }
 
 // Sender is the interface for sending emails
@@ -81,13 +102,17 @@ func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
 
 	// Determine content type and body
 	var body string
+	contentType := "text/plain; charset=\"UTF-8\""
 	if msg.HTML != "" {
-		headers.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+		contentType = "text/html; charset=\"UTF-8\""
 		body = msg.HTML
 	} else {
-		headers.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
 		body = msg.Text
 	}
+	if len(msg.Attachments) > 0 {
+		contentType, body = withAttachments(contentType, body, msg.Attachments)
+	}
+	headers.WriteString(fmt.Sprintf("Content-Type: %s\r\n", contentType))
 
 	headers.WriteString("\r\n")
 	fullMessage := headers.String() + body
@@ -116,8 +141,60 @@ func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
 	return nil
 }
 
-// DevSender logs emails instead of sending them (for development)
+// withAttachments wraps a body of contentType and attachments in a
+// multipart/mixed body, returning its content type and the body.
+func withAttachments(contentType, body string, attachments []Attachment) (string, string) {
+	var b strings.Builder
+	w := multipart.NewWriter(&b)
+	part, _ := w.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	_, _ = part.Write([]byte(body))
+
+	for _, a := range attachments {
+		ct := a.ContentType
+		if ct == "" {
+			ct = mime.TypeByExtension(filepath.Ext(a.Filename))
+		}
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {ct},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			_, _ = part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		_, _ = part.Write([]byte(encoded + "\r\n"))
+	}
+	_ = w.Close()
+	return "multipart/mixed; boundary=" + w.Boundary(), b.String()
+}
+
+// AttachBlob loads the object at key in store as an attachment named
+// filename, such as a generated PDF:
+//
+//	invoice, err := mail.AttachBlob(ctx, kit.Blobs.Store, "invoices/42.pdf", "invoice-42.pdf")
+func AttachBlob(ctx context.Context, store blob.Store, key, filename string) (Attachment, error) {
+	r, info, err := store.Get(ctx, key)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("mail: attach %s: %w", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("mail: attach %s: %w", key, err)
+	}
+	return Attachment{Filename: filename, ContentType: info.ContentType, Data: data}, nil
+}
+
+// DevSender logs emails instead of sending them (for development). It
+// keeps every message it was given, so tests can query what was sent with
+// LastTo, Find, and AssertSentCount. It is safe for concurrent use.
 type DevSender struct {
+	mu       sync.Mutex
 	messages []Message // Store messages for preview
 }
 
@@ -140,14 +217,113 @@ func (d *DevSender) Send(ctx context.Context, msg Message) error {
 	}
 
 	// Store for preview
+	d.mu.Lock()
 	d.messages = append(d.messages, msg)
+	d.mu.Unlock()
 
 	return nil
 }
 
-// GetMessages returns stored messages (for preview)
+// GetMessages returns a copy of the stored messages, oldest first.
 func (d *DevSender) GetMessages() []Message {
-	return d.messages
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Message(nil), d.messages...)
+}
+
+// LastTo returns the most recent message addressed to email (matched
+// case-insensitively against To, Cc, and Bcc).
+func (d *DevSender) LastTo(email string) (Message, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := len(d.messages) - 1; i >= 0; i-- {
+		if d.messages[i].sentTo(email) {
+			return d.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// Find returns the messages whose subject contains subjectContains,
+// oldest first.
+func (d *DevSender) Find(subjectContains string) []Message {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var found []Message
+	for _, msg := range d.messages {
+		if strings.Contains(msg.Subject, subjectContains) {
+			found = append(found, msg)
+		}
+	}
+	return found
+}
+
+// Reset forgets all stored messages.
+func (d *DevSender) Reset() {
+	d.mu.Lock()
+	d.messages = nil
+	d.mu.Unlock()
+}
+
+// TestingT is the part of *testing.T that AssertSentCount uses.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// AssertSentCount fails the test unless exactly n messages were sent.
+func (d *DevSender) AssertSentCount(t TestingT, n int) bool {
+	t.Helper()
+	messages := d.GetMessages()
+	if len(messages) == n {
+		return true
+	}
+	subjects := make([]string, len(messages))
+	for i, msg := range messages {
+		subjects[i] = fmt.Sprintf("%q to %s", msg.Subject, msg.To)
+	}
+	t.Errorf("mail: expected %d messages sent, got %d: [%s]", n, len(messages), strings.Join(subjects, ", "))
+	return false
+}
+
+func (m Message) sentTo(email string) bool {
+	if strings.EqualFold(m.To, email) {
+		return true
+	}
+	for _, addr := range append(append([]string(nil), m.Cc...), m.Bcc...) {
+		if strings.EqualFold(addr, email) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	hrefPattern = regexp.MustCompile(`(?i)href\s*=\s*["']([^"']+)["']`)
+	urlPattern  = regexp.MustCompile(`https?://[^\s"'<>]+`)
+)
+
+// ExtractLinks returns the links in the message: href targets from the
+// HTML body, then absolute URLs from the text body, without duplicates.
+// Useful for following confirmation and reset links in tests.
+func (m Message) ExtractLinks() []string {
+	var links []string
+	seen := map[string]bool{}
+	add := func(link string) {
+		if link != "" && !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	for _, match := range hrefPattern.FindAllStringSubmatch(m.HTML, -1) {
+		add(html.UnescapeString(match[1]))
+	}
+	for _, link := range urlPattern.FindAllString(m.Text, -1) {
+		// Sentence punctuation right after a URL isn't part of it
+		add(strings.TrimRight(link, ".,;:!?)"))
+	}
+	return links
 }
 
 // NoOpSender does nothing (for testing)
@@ -179,94 +355,42 @@ func Send(ctx context.Context, msg Message) error {
 	return GetSender().Send(ctx, msg)
 }
 
-// PreviewHandler shows sent emails in development mode
+// previewMessage is a Message as the preview page sees it, with the HTML
+// body marked safe so template engines don't escape it.
+type previewMessage struct {
+	Subject string
+	To      string
+	Text    string
+	HTML    template.HTML
+}
+
+// PreviewHandler shows sent emails in development mode, newest first.
+// The page is views.PageMailPreview, so apps can restyle it.
 func PreviewHandler(c buffalo.Context) error {
-	// Get dev sender
-	sender := GetSender()
-	devSender, ok := sender.(*DevSender)
+	devSender, ok := GetSender().(*DevSender)
 	if !ok {
-		html := `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Mail Preview</title>
-    <style>
-        body { font-family: system-ui, sans-serif; padding: 20px; }
-        .error { color: red; }
-    </style>
-</head>
-<body>
-    <h1>Mail Preview</h1>
-    <p class="error">Mail preview is only available with DevSender</p>
-</body>
-</html>
-		`
-		return c.Render(http.StatusOK, mailRenderer{html: html})
+		return views.Render(c, http.StatusOK, views.PageMailPreview, map[string]any{
+			"available": false,
+			"messages":  []previewMessage{},
+		})
 	}
 
-	// Build preview HTML
 	messages := devSender.GetMessages()
-	var preview strings.Builder
-	preview.WriteString(`
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Mail Preview</title>
-    <style>
-        body { font-family: system-ui, sans-serif; padding: 20px; }
-        .message { border: 1px solid #ddd; margin: 20px 0; padding: 15px; }
-        .header { background: #f5f5f5; padding: 10px; margin: -15px -15px 15px; }
-        .subject { font-weight: bold; font-size: 1.2em; }
-        .meta { color: #666; font-size: 0.9em; margin: 5px 0; }
-        .body { margin-top: 15px; padding: 10px; background: #fafafa; }
-        pre { white-space: pre-wrap; word-wrap: break-word; }
-    </style>
-</head>
-<body>
-    <h1>Mail Preview (Development)</h1>
-    <p>Showing ` + fmt.Sprintf("%d", len(messages)) + ` message(s)</p>
-`)
-
-	if len(messages) == 0 {
-		preview.WriteString(`<p><em>No messages sent yet</em></p>`)
-	}
-
+	preview := make([]previewMessage, 0, len(messages))
 	for i := len(messages) - 1; i >= 0; i-- {
 		msg := messages[i]
-		preview.WriteString(`
-    <div class="message">
-        <div class="header">
-            <div class="subject">` + msg.Subject + `</div>
-            <div class="meta">To: ` + msg.To + `</div>
-        </div>
-`)
-		if msg.HTML != "" {
-			preview.WriteString(`
-        <div class="body">
-            <strong>HTML Body:</strong>
-            <div style="border: 1px solid #ccc; padding: 10px; margin-top: 5px;">
-                ` + msg.HTML + `
-            </div>
-        </div>
-`)
-		}
-		if msg.Text != "" {
-			preview.WriteString(`
-        <div class="body">
-            <strong>Text Body:</strong>
-            <pre>` + msg.Text + `</pre>
-        </div>
-`)
-		}
-		preview.WriteString(`</div>`)
+		preview = append(preview, previewMessage{
+			Subject: msg.Subject,
+			To:      msg.To,
+			Text:    msg.Text,
+			HTML:    template.HTML(msg.HTML),
+		})
 	}
 
-	preview.WriteString(`
-</body>
-</html>
-`)
-
-	return c.Render(http.StatusOK, mailRenderer{html: preview.String()})
+	return views.Render(c, http.StatusOK, views.PageMailPreview, map[string]any{
+		"available": true,
+		"messages":  preview,
+	})
 }
 
 // Helper functions
@@ -277,24 +401,3 @@ func truncate(s string, max int) string {
 	}
 	return s[:max] + "..."
 }
-
-// Simple HTML renderer for stub
-type mailRenderer struct {
-	html string
-}
-
-func (mailRenderer) HTML(s string) mailRenderer {
-	return mailRenderer{html: s}
-}
-
-func (r mailRenderer) ContentType() string {
-	return "text/html; charset=utf-8"
-}
-
-func (r mailRenderer) Render(w io.Writer, data render.Data) error {
-	if hw, ok := w.(http.ResponseWriter); ok {
-		hw.Header().Set("Content-Type", r.ContentType())
-	}
-	_, err := w.Write([]byte(r.html))
-	return err
-}
@@ -0,0 +1,130 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/johnjansen/buffkit/blob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestDevSenderQueries(t *testing.T) {
+	ctx := context.Background()
+	sender := NewDevSender()
+	require.NoError(t, sender.Send(ctx, Message{To: "ada@example.com", Subject: "Welcome"}))
+	require.NoError(t, sender.Send(ctx, Message{To: "bob@example.com", Cc: []string{"Ada@Example.com"}, Subject: "Reset your password"}))
+	require.NoError(t, sender.Send(ctx, Message{To: "ada@example.com", Subject: "Reset your password again"}))
+
+	last, ok := sender.LastTo("ada@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Reset your password again", last.Subject)
+
+	_, ok = sender.LastTo("nobody@example.com")
+	assert.False(t, ok)
+
+	found := sender.Find("Reset")
+	require.Len(t, found, 2)
+	assert.Equal(t, "bob@example.com", found[0].To)
+
+	assert.True(t, sender.AssertSentCount(t, 3))
+
+	rec := &recordingT{}
+	assert.False(t, sender.AssertSentCount(rec, 1))
+	require.Len(t, rec.errors, 1)
+	assert.Contains(t, rec.errors[0], `"Welcome" to ada@example.com`)
+
+	sender.Reset()
+	assert.Empty(t, sender.GetMessages())
+}
+
+func TestExtractLinks(t *testing.T) {
+	msg := Message{
+		HTML: `<a href="https://app.test/confirm?token=a&amp;b=1">Confirm</a> <a href='/help'>Help</a>`,
+		Text: "Confirm at https://app.test/confirm?token=a&b=1. Or visit https://app.test/help.",
+	}
+
+	assert.Equal(t, []string{
+		"https://app.test/confirm?token=a&b=1",
+		"/help",
+		"https://app.test/help",
+	}, msg.ExtractLinks())
+	assert.Empty(t, Message{Text: "no links here"}.ExtractLinks())
+}
+
+func TestDevSenderConcurrentSends(t *testing.T) {
+	sender := NewDevSender()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = sender.Send(context.Background(), Message{To: fmt.Sprintf("user%d@example.com", i)})
+			_ = sender.GetMessages()
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, sender.GetMessages(), 50)
+}
+
+func TestAttachments(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemoryStore()
+	pdf := bytes.Repeat([]byte("%PDF-1.7 "), 20)
+	require.NoError(t, store.Put(ctx, "invoices/42.pdf", bytes.NewReader(pdf), ""))
+	invoice, err := AttachBlob(ctx, store, "invoices/42.pdf", "invoice-42.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", invoice.ContentType)
+	_, err = AttachBlob(ctx, store, "invoices/43.pdf", "invoice-43.pdf")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	contentType, body := withAttachments("text/plain; charset=UTF-8", "See attached.", []Attachment{
+		invoice,
+		{Filename: "notes.txt", Data: []byte("hi")},
+	})
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	r := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	part, err := r.NextPart()
+	require.NoError(t, err)
+	text, _ := io.ReadAll(part)
+	assert.Equal(t, "See attached.", string(text))
+
+	part, err = r.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "invoice-42.pdf", part.FileName())
+	assert.Equal(t, "application/pdf", part.Header.Get("Content-Type"))
+	encoded, _ := io.ReadAll(part)
+	for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\r\n") {
+		assert.LessOrEqual(t, len(line), 76)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, pdf, data)
+
+	part, err = r.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", part.Header.Get("Content-Type"), "guessed from the file name")
+	_, err = r.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
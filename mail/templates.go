@@ -0,0 +1,216 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// Template is a mail message written as Go templates. Subject and Text
+// are text/template; HTML is html/template, so data is escaped. Each
+// receives the data passed to Render. <bk-*> components in the HTML, such
+// as <bk-email-layout>, are expanded after it executes.
+type Template struct {
+	Subject string
+	Text    string
+	HTML    string // optional
+
+	// Sample is the data the development template gallery
+	// (/__mail/templates) renders the template with.
+	Sample any
+}
+
+// parsedTemplate is a Template ready to execute.
+type parsedTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+	sample  any
+}
+
+var (
+	templatesMu sync.RWMutex
+	templates   = make(map[string]*parsedTemplate)
+	registry    *components.Registry
+)
+
+// UseComponents sets the registry whose components are expanded in the
+// HTML of rendered templates, such as the bk-email-* layout components.
+// buffkit.Wire calls it with the app's registry.
+func UseComponents(r *components.Registry) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	registry = r
+}
+
+// RegisterTemplate parses t and registers it as name, replacing any
+// template already registered under that name.
+//
+//	mail.RegisterTemplate("digest/weekly", mail.Template{
+//	    Subject: "Your week: {{.Count}} updates",
+//	    Text:    "Hi {{.User.Name}}, ...",
+//	})
+func RegisterTemplate(name string, t Template) error {
+	if t.Subject == "" || t.Text == "" {
+		return fmt.Errorf("mail: template %s needs a Subject and Text", name)
+	}
+	p := &parsedTemplate{sample: t.Sample}
+	var err error
+	if p.subject, err = texttemplate.New(name + ".subject").Parse(t.Subject); err != nil {
+		return fmt.Errorf("mail: template %s: %w", name, err)
+	}
+	if p.text, err = texttemplate.New(name + ".text").Parse(t.Text); err != nil {
+		return fmt.Errorf("mail: template %s: %w", name, err)
+	}
+	if t.HTML != "" {
+		if p.html, err = htmltemplate.New(name + ".html").Parse(t.HTML); err != nil {
+			return fmt.Errorf("mail: template %s: %w", name, err)
+		}
+	}
+
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	templates[name] = p
+	return nil
+}
+
+// TemplateNames lists the registered templates, sorted.
+func TemplateNames() []string {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render executes template name with data and returns the message,
+// addressed to to.
+func Render(name, to string, data any) (Message, error) {
+	templatesMu.RLock()
+	p, ok := templates[name]
+	expander := registry
+	templatesMu.RUnlock()
+	if !ok {
+		return Message{}, fmt.Errorf("mail: no template named %s", name)
+	}
+
+	msg := Message{To: to}
+	var buf bytes.Buffer
+	if err := p.subject.Execute(&buf, data); err != nil {
+		return Message{}, fmt.Errorf("mail: render %s: %w", name, err)
+	}
+	// A subject is one line, however the template was written
+	msg.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := p.text.Execute(&buf, data); err != nil {
+		return Message{}, fmt.Errorf("mail: render %s: %w", name, err)
+	}
+	msg.Text = buf.String()
+
+	if p.html != nil {
+		buf.Reset()
+		if err := p.html.Execute(&buf, data); err != nil {
+			return Message{}, fmt.Errorf("mail: render %s: %w", name, err)
+		}
+		msg.HTML = buf.String()
+		if expander != nil && strings.Contains(msg.HTML, "<bk-") {
+			expanded, err := expander.Expand(buf.Bytes())
+			if err != nil {
+				return Message{}, fmt.Errorf("mail: render %s: %w", name, err)
+			}
+			msg.HTML = string(expanded)
+		}
+	}
+	return msg, nil
+}
+
+// RenderSample renders template name with its Sample data.
+func RenderSample(name, to string) (Message, error) {
+	templatesMu.RLock()
+	p, ok := templates[name]
+	templatesMu.RUnlock()
+	if !ok {
+		return Message{}, fmt.Errorf("mail: no template named %s", name)
+	}
+	return Render(name, to, p.sample)
+}
+
+// TemplatesHandler is the development template gallery: it lists the
+// registered templates and renders the one in the "name" parameter with
+// its sample data, fresh on every request, so edits show on reload. The
+// page is views.PageMailTemplates.
+func TemplatesHandler(c buffalo.Context) error {
+	names := TemplateNames()
+	selected := c.Param("name")
+	if selected == "" && len(names) > 0 {
+		selected = names[0]
+	}
+
+	to := c.Param("to")
+	if user := auth.CurrentUser(c); to == "" && user != nil {
+		to = user.Email
+	}
+
+	data := map[string]any{
+		"templates":    names,
+		"selected":     selected,
+		"to":           to,
+		"gallery_path": galleryPath(c),
+	}
+	if selected != "" {
+		msg, err := RenderSample(selected, to)
+		if err != nil {
+			data["error"] = err.Error()
+		} else {
+			data["subject"], data["text"], data["html"] = msg.Subject, msg.Text, msg.HTML
+		}
+	}
+	return views.Render(c, http.StatusOK, views.PageMailTemplates, data)
+}
+
+// SendTestHandler renders the template in the "name" form field with its
+// sample data and sends it through the configured sender to the "to"
+// field, with "[Test]" before the subject. It redirects back to the
+// gallery.
+func SendTestHandler(c buffalo.Context) error {
+	name := c.Request().FormValue("name")
+	to := strings.TrimSpace(c.Request().FormValue("to"))
+	back := galleryPath(c) + "?name=" + url.QueryEscape(name) + "&to=" + url.QueryEscape(to)
+	if !strings.Contains(to, "@") {
+		c.Flash().Add("danger", "Enter an address to send the test to")
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+
+	msg, err := RenderSample(name, to)
+	if err != nil {
+		return c.Error(http.StatusUnprocessableEntity, err)
+	}
+	msg.Subject = "[Test] " + msg.Subject
+	if err := GetSender().Send(c, msg); err != nil {
+		return c.Error(http.StatusBadGateway, err)
+	}
+	c.Flash().Add("success", "Sent "+name+" to "+to)
+	return c.Redirect(http.StatusSeeOther, back)
+}
+
+// galleryPath is the gallery's path, whichever of its routes is serving
+// the request, so it works under any MountPath.
+func galleryPath(c buffalo.Context) string {
+	p := strings.TrimSuffix(c.Request().URL.Path, "/")
+	return strings.TrimSuffix(p, "/send")
+}
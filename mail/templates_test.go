@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/johnjansen/buffkit/components"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	require.NoError(t, RegisterTemplate("test/welcome", Template{
+		Subject: "Welcome,\n  {{.Name}}",
+		Text:    "Hello {{.Name}}",
+		HTML:    "<p>Hello {{.Name}}</p>",
+	}))
+	assert.Contains(t, TemplateNames(), "test/welcome")
+
+	msg, err := Render("test/welcome", "ada@example.com", map[string]string{"Name": "<Ada>"})
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", msg.To)
+	assert.Equal(t, "Welcome, <Ada>", msg.Subject)
+	assert.Equal(t, "Hello <Ada>", msg.Text)
+	assert.Equal(t, "<p>Hello &lt;Ada&gt;</p>", msg.HTML)
+
+	_, err = Render("test/missing", "ada@example.com", nil)
+	assert.Error(t, err)
+	assert.Error(t, RegisterTemplate("test/broken", Template{Subject: "{{.Name", Text: "x"}))
+	assert.Error(t, RegisterTemplate("test/empty", Template{Subject: "Hi"}))
+}
+
+func TestRenderTemplateExpandsComponents(t *testing.T) {
+	registry := components.NewRegistry()
+	registry.RegisterEmail()
+	UseComponents(registry)
+	t.Cleanup(func() { UseComponents(nil) })
+
+	require.NoError(t, RegisterTemplate("test/button", Template{
+		Subject: "Confirm",
+		Text:    "Confirm: {{.URL}}",
+		HTML:    `<bk-email-layout><bk-email-row><bk-email-button href="{{.URL}}">Confirm</bk-email-button></bk-email-row></bk-email-layout>`,
+	}))
+	msg, err := Render("test/button", "ada@example.com", map[string]string{"URL": "https://example.com/confirm?t=1"})
+	require.NoError(t, err)
+	assert.NotContains(t, msg.HTML, "<bk-")
+	assert.Contains(t, msg.HTML, `<a href="https://example.com/confirm?t=1" target="_blank"`)
+	assert.Contains(t, msg.HTML, `role="presentation"`)
+}
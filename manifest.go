@@ -0,0 +1,78 @@
+package buffkit
+
+import (
+	"io/fs"
+	"sort"
+)
+
+// Manifest describes everything Wire installed into the app. It's meant
+// for generating documentation and for asserting in tests that Buffkit is
+// wired the way you expect:
+//
+//	m := kit.Manifest()
+//	assert.Contains(t, m.JobHandlers, "cleanup:sessions")
+//
+// The buffkit:manifest task prints it as JSON.
+type Manifest struct {
+	// Routes Wire mounted, as listed by Routes.
+	Routes []RouteEntry `json:"routes"`
+
+	// Middleware Wire added to the app's stack, in order.
+	Middleware []string `json:"middleware"`
+
+	// Tasks are the grift tasks Buffkit registers.
+	Tasks []string `json:"tasks"`
+
+	// Migrations are the namespaces under db/migrations Buffkit ships
+	// migrations for (e.g. "auth", "jobs").
+	Migrations []string `json:"migrations"`
+
+	// Components are the registered component names.
+	Components []string `json:"components"`
+
+	// JobHandlers are the task types the jobs runtime handles. Empty
+	// when RedisURL isn't configured.
+	JobHandlers []string `json:"job_handlers"`
+}
+
+// Manifest returns what Wire installed. It reflects the current state, so
+// components or job handlers registered after Wire are included.
+func (k *Kit) Manifest() Manifest {
+	m := Manifest{
+		Routes:      []RouteEntry{},
+		Middleware:  append([]string{}, k.middleware...),
+		Tasks:       append([]string{}, buffkitTasks...),
+		Migrations:  migrationNamespaces(),
+		Components:  []string{},
+		JobHandlers: []string{},
+	}
+	sort.Strings(m.Tasks)
+
+	for _, r := range k.Routes() {
+		if r.Buffkit {
+			m.Routes = append(m.Routes, r)
+		}
+	}
+	if k.Components != nil {
+		m.Components = k.Components.Names()
+	}
+	if k.Jobs != nil {
+		m.JobHandlers = k.Jobs.Handlers()
+	}
+	return m
+}
+
+// migrationNamespaces lists the directories under db/migrations.
+func migrationNamespaces() []string {
+	names := []string{}
+	entries, err := fs.ReadDir(migrationFS, "db/migrations")
+	if err != nil {
+		return names
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
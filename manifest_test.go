@@ -0,0 +1,40 @@
+package buffkit
+
+import (
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	before := len(middlewareNames(app))
+
+	kit, err := Wire(app, Config{DevMode: true, AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	kit.Components.Register("bk-alert", func(attrs map[string]string, slots map[string]string) ([]byte, error) {
+		return nil, nil
+	})
+
+	m := kit.Manifest()
+
+	paths := map[string]bool{}
+	for _, r := range m.Routes {
+		assert.True(t, r.Buffkit)
+		paths[r.Method+" "+r.Path] = true
+	}
+	assert.True(t, paths["GET /login/"])
+	assert.True(t, paths["GET /__mail/preview/"])
+
+	assert.Len(t, m.Middleware, len(middlewareNames(app))-before)
+	assert.NotEmpty(t, m.Middleware)
+	assert.Contains(t, m.Tasks, "buffkit:migrate")
+	assert.Contains(t, m.Tasks, "jobs:worker")
+	assert.Contains(t, m.Migrations, "jobs")
+	assert.Equal(t, []string{"bk-alert", "bk-barcode", "bk-chart", "bk-code", "bk-email-button", "bk-email-layout", "bk-email-row", "bk-form", "bk-markdown", "bk-qr", "bk-readonly-banner", "bk-table", "bk-theme"}, m.Components)
+	assert.Empty(t, m.JobHandlers, "no RedisURL, no jobs runtime")
+}
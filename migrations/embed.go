@@ -11,6 +11,8 @@ import (
 // - jobs: buffkit_jobs
 // - mail: buffkit_mail_log
 //
+// Deprecated: use buffkit.Migrations(), the set buffkit:migrate applies.
+//
 //go:embed buffkit/*.sql
 var BuffkitMigrations embed.FS
 
@@ -28,6 +30,8 @@ var BuffkitMigrations embed.FS
 //	    runner := migrations.NewRunner(db, combinedFS, dialect)
 //	    runner.Migrate(ctx)
 //	}
+//
+// Deprecated: use buffkit.Migrations(), the set buffkit:migrate applies.
 func GetBuffkitMigrations() embed.FS {
 	return BuffkitMigrations
 }
@@ -35,6 +39,8 @@ func GetBuffkitMigrations() embed.FS {
 // MigrationList returns a list of all Buffkit migration names
 // in the order they should be applied. This is useful for
 // host apps that need to know what migrations Buffkit provides.
+//
+// Deprecated: use Runner.Status on buffkit.Migrations().
 func MigrationList() []string {
 	return []string{
 		"001_create_users",
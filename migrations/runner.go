@@ -101,7 +101,9 @@ func (r *Runner) getAppliedMigrations(ctx context.Context) (map[string]Migration
 	return applied, rows.Err()
 }
 
-// loadMigrations reads all migration files from the embedded filesystem
+// loadMigrations reads all migration files from the embedded filesystem.
+// Two migrations sharing a version is an error, since one would hide the
+// other.
 func (r *Runner) loadMigrations() ([]Migration, error) {
 	var migrations []Migration
 
@@ -159,6 +161,9 @@ func (r *Runner) loadMigrations() ([]Migration, error) {
 			}
 		}
 
+		if migration != nil && migration.Name != name {
+			return fmt.Errorf("migration version %s is used by both %s and %s", version, migration.Name, name)
+		}
 		if migration == nil {
 			migrations = append(migrations, Migration{
 				Version: version,
@@ -191,6 +196,16 @@ func (r *Runner) loadMigrations() ([]Migration, error) {
 
 // Migrate applies all pending migrations in order
 func (r *Runner) Migrate(ctx context.Context) error {
+	return r.Up(ctx, 0)
+}
+
+// Up applies the next n pending migrations in order, or all of them when
+// n is 0
+func (r *Runner) Up(ctx context.Context, n int) error {
+	if n < 0 {
+		return fmt.Errorf("n must not be negative")
+	}
+
 	// Ensure migrations table exists
 	if err := r.ensureTable(ctx); err != nil {
 		return fmt.Errorf("creating migrations table: %w", err)
@@ -209,7 +224,12 @@ func (r *Runner) Migrate(ctx context.Context) error {
 	}
 
 	// Apply pending migrations
+	done := 0
 	for _, migration := range migrations {
+		if n > 0 && done == n {
+			break
+		}
+
 		// Skip if already applied
 		if _, exists := applied[migration.Version]; exists {
 			continue
@@ -227,6 +247,7 @@ func (r *Runner) Migrate(ctx context.Context) error {
 		}
 
 		fmt.Printf("Applied migration: %s_%s\n", migration.Version, migration.Name)
+		done++
 	}
 
 	return nil
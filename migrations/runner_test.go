@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"embed"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +15,11 @@ import (
 //go:embed testdata/*.sql
 var testMigrations embed.FS
 
+// duplicateMigrations holds two namespaces' migrations sharing a version
+//
+//go:embed testdata/duplicate
+var duplicateMigrations embed.FS
+
 // setupTestDB creates a new in-memory SQLite database for testing
 func setupTestDB(t *testing.T) *sql.DB {
 	db, err := sql.Open("sqlite3", ":memory:")
@@ -131,6 +137,15 @@ func TestLoadMigrations(t *testing.T) {
 	}
 }
 
+func TestLoadMigrationsDuplicateVersion(t *testing.T) {
+	runner := NewRunner(nil, duplicateMigrations, "sqlite3")
+
+	_, err := runner.loadMigrations()
+	if err == nil || !strings.Contains(err.Error(), "20240101120000") {
+		t.Fatalf("Expected a duplicate version error, got %v", err)
+	}
+}
+
 func TestMigrate(t *testing.T) {
 	db := setupTestDB(t)
 	defer func() { _ = db.Close() }()
@@ -261,6 +276,45 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func TestUp(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	runner := NewRunner(db, testMigrations, "sqlite3")
+	ctx := context.Background()
+
+	if err := runner.Up(ctx, -1); err == nil {
+		t.Error("Expected error for negative n")
+	}
+
+	// One step at a time
+	if err := runner.Up(ctx, 1); err != nil {
+		t.Fatalf("Failed to apply one migration: %v", err)
+	}
+	applied, pending, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if len(applied) != 1 || applied[0] != "20240101120000_create_users_table" {
+		t.Errorf("Expected only the first migration applied, got %v", applied)
+	}
+	if len(pending) != 1 {
+		t.Errorf("Expected 1 pending migration, got %d", len(pending))
+	}
+
+	// More steps than are pending applies the rest
+	if err := runner.Up(ctx, 5); err != nil {
+		t.Fatalf("Failed to apply remaining migrations: %v", err)
+	}
+	_, pending, err = runner.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected 0 pending migrations, got %d", len(pending))
+	}
+}
+
 func TestDown(t *testing.T) {
 	db := setupTestDB(t)
 	defer func() { _ = db.Close() }()
@@ -0,0 +1 @@
+CREATE TABLE imports (id TEXT PRIMARY KEY);
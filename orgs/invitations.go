@@ -0,0 +1,256 @@
+package orgs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/mail"
+)
+
+// DefaultInvitationTTL is how long an invitation link stays valid.
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+// Inviter creates invitations and emails signed links for them.
+type Inviter struct {
+	Store   Store
+	Sender  mail.Sender
+	Secret  []byte        // HMAC key for invitation tokens, usually Config.AuthSecret
+	BaseURL string        // Absolute URL of the app, e.g. "https://app.example.com"
+	TTL     time.Duration // Defaults to DefaultInvitationTTL
+
+	// PreviousSecrets are still accepted when verifying tokens, so links
+	// already sent keep working after Secret is rotated.
+	PreviousSecrets [][]byte
+
+	// AcceptPath is where AcceptHandler is mounted.
+	// Defaults to "/invitations/accept".
+	AcceptPath string
+
+	// Clock sets invitation expiry and checks it. Defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// NewInviter creates an Inviter with default TTL and accept path.
+func NewInviter(store Store, sender mail.Sender, secret []byte, baseURL string) *Inviter {
+	return &Inviter{
+		Store:      store,
+		Sender:     sender,
+		Secret:     secret,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		TTL:        DefaultInvitationTTL,
+		AcceptPath: "/invitations/accept",
+	}
+}
+
+// Invite records an invitation for email to join org with role and sends
+// the invitation email. invitedBy is the inviting user's ID.
+func (i *Inviter) Invite(ctx context.Context, org *Organization, email string, role Role, invitedBy string) (*Invitation, error) {
+	if !role.Valid() {
+		return nil, fmt.Errorf("orgs: invalid role %q", role)
+	}
+
+	ttl := i.TTL
+	if ttl == 0 {
+		ttl = DefaultInvitationTTL
+	}
+
+	inv := &Invitation{
+		OrgID:     org.ID,
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		Role:      role,
+		InvitedBy: invitedBy,
+		ExpiresAt: clock.Or(i.Clock).Now().Add(ttl),
+	}
+	if err := i.Store.CreateInvitation(ctx, inv); err != nil {
+		return nil, fmt.Errorf("orgs: create invitation: %w", err)
+	}
+
+	link := i.AcceptURL(inv)
+	msg := mail.Message{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("You've been invited to join %s", org.Name),
+		Text: fmt.Sprintf(`Hello,
+
+You've been invited to join %s as %s.
+
+Accept the invitation by opening this link:
+%s
+
+This invitation expires on %s.
+
+If you weren't expecting this invitation, you can ignore this email.`,
+			org.Name, inv.Role, link, inv.ExpiresAt.Format("January 2, 2006")),
+		HTML: fmt.Sprintf(`<p>Hello,</p>
+<p>You've been invited to join <strong>%s</strong> as %s.</p>
+<p><a href="%s">Accept the invitation</a></p>
+<p>This invitation expires on %s.</p>
+<p>If you weren't expecting this invitation, you can ignore this email.</p>`,
+			html.EscapeString(org.Name), html.EscapeString(string(inv.Role)), html.EscapeString(link),
+			inv.ExpiresAt.Format("January 2, 2006")),
+	}
+
+	if i.Sender != nil {
+		if err := i.Sender.Send(ctx, msg); err != nil {
+			return inv, fmt.Errorf("orgs: send invitation: %w", err)
+		}
+	}
+
+	return inv, nil
+}
+
+// AcceptURL returns the absolute link that accepts inv.
+func (i *Inviter) AcceptURL(inv *Invitation) string {
+	path := i.AcceptPath
+	if path == "" {
+		path = "/invitations/accept"
+	}
+	return i.BaseURL + path + "?token=" + url.QueryEscape(i.Token(inv))
+}
+
+// Token returns the signed token for inv. The token binds the invitation
+// ID to its expiry so neither can be altered without the secret.
+func (i *Inviter) Token(inv *Invitation) string {
+	payload := inv.ID + "." + strconv.FormatInt(inv.ExpiresAt.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sign(i.Secret, payload)
+}
+
+// validSignature reports whether sig matches payload under the current
+// secret or any previous one.
+func (i *Inviter) validSignature(payload, sig string) bool {
+	for _, key := range append([][]byte{i.Secret}, i.PreviousSecrets...) {
+		if len(key) > 0 && hmac.Equal([]byte(sig), []byte(sign(key, payload))) {
+			return true
+		}
+	}
+	return false
+}
+
+func sign(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a token's signature and expiry and returns the pending
+// invitation it refers to.
+func (i *Inviter) Verify(ctx context.Context, token string) (*Invitation, error) {
+	inv, err := i.invitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if inv.AcceptedAt != nil {
+		return nil, ErrInvitationInvalid
+	}
+	return inv, nil
+}
+
+// invitation checks a token's signature and expiry and returns the
+// invitation it refers to, whether or not it was accepted.
+func (i *Inviter) invitation(ctx context.Context, token string) (*Invitation, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvitationInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvitationInvalid
+	}
+	payload := string(raw)
+	if !i.validSignature(payload, sig) {
+		return nil, ErrInvitationInvalid
+	}
+
+	id, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return nil, ErrInvitationInvalid
+	}
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || clock.Or(i.Clock).Now().Unix() > exp {
+		return nil, ErrInvitationInvalid
+	}
+
+	inv, err := i.Store.InvitationByID(ctx, id)
+	if err != nil {
+		return nil, ErrInvitationInvalid
+	}
+	return inv, nil
+}
+
+// Accept verifies token and adds user to the invited organization. The
+// invitation can only be used once, and only by a user with the email it
+// was sent to; others get ErrInvitationEmail. Accepting it again once
+// the user is a member returns their membership.
+func (i *Inviter) Accept(ctx context.Context, token string, user *auth.User) (*Membership, error) {
+	inv, err := i.invitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(strings.TrimSpace(user.Email), inv.Email) {
+		return nil, ErrInvitationEmail
+	}
+	if inv.AcceptedAt != nil {
+		return i.accepted(ctx, inv, user)
+	}
+
+	// Use the invitation up and add the member in one step, so two
+	// requests racing with the same token can't both add a member, and
+	// a failed add doesn't use the invitation up.
+	ms := &Membership{OrgID: inv.OrgID, UserID: user.ID, Role: inv.Role}
+	if err := i.Store.AcceptInvitation(ctx, inv.ID, ms, clock.Or(i.Clock).Now()); err != nil {
+		if errors.Is(err, ErrInvitationInvalid) {
+			return i.accepted(ctx, inv, user)
+		}
+		return nil, fmt.Errorf("orgs: accept invitation: %w", err)
+	}
+	return ms, nil
+}
+
+// accepted handles an invitation that was already accepted, such as by
+// a second click on the link: user's membership of its organization
+// when they have one, and ErrInvitationInvalid otherwise.
+func (i *Inviter) accepted(ctx context.Context, inv *Invitation, user *auth.User) (*Membership, error) {
+	ms, err := i.Store.Membership(ctx, inv.OrgID, user.ID)
+	if err != nil {
+		return nil, ErrInvitationInvalid
+	}
+	return ms, nil
+}
+
+// AcceptHandler accepts the invitation in the "token" query parameter for
+// the logged-in user, then redirects to the organization. Mount it behind
+// RequireLogin so invitees sign in (or register) first.
+func AcceptHandler(i *Inviter) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		user := auth.CurrentUser(c)
+		if user == nil {
+			return c.Redirect(http.StatusSeeOther, auth.LoginPath())
+		}
+
+		ms, err := i.Accept(c, c.Param("token"), user)
+		if errors.Is(err, ErrInvitationEmail) {
+			return c.Error(http.StatusForbidden, err)
+		}
+		if err != nil {
+			return c.Error(http.StatusBadRequest, err)
+		}
+
+		org, err := i.Store.OrgByID(c, ms.OrgID)
+		if err != nil {
+			return c.Error(http.StatusNotFound, err)
+		}
+		return c.Redirect(http.StatusSeeOther, "/orgs/"+org.Slug)
+	}
+}
@@ -0,0 +1,76 @@
+package orgs
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+)
+
+// Context keys set by the org middleware.
+const (
+	// OrgContextKey holds the *Organization for the current route.
+	OrgContextKey = "current_org"
+
+	// MembershipContextKey holds the current user's *Membership in that org.
+	MembershipContextKey = "current_membership"
+)
+
+// RequireOrgMember ensures the logged-in user belongs to the organization
+// named by the {org} route parameter (its slug). Non-members get 404 rather
+// than 403 so org slugs can't be probed. The org and membership are added
+// to context for handlers and templates.
+func RequireOrgMember(store Store) buffalo.MiddlewareFunc {
+	return RequireOrgRole(store, RoleMember)
+}
+
+// RequireOrgRole is like RequireOrgMember but also requires at least role,
+// e.g. RequireOrgRole(store, orgs.RoleAdmin) for settings pages.
+// Members without the role get 403.
+func RequireOrgRole(store Store, role Role) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			user := auth.CurrentUser(c)
+			if user == nil {
+				return c.Redirect(http.StatusSeeOther, auth.LoginPath())
+			}
+
+			org, err := store.OrgBySlug(c, c.Param("org"))
+			if errors.Is(err, ErrOrgNotFound) {
+				return c.Error(http.StatusNotFound, err)
+			}
+			if err != nil {
+				return c.Error(http.StatusInternalServerError, err)
+			}
+
+			ms, err := store.Membership(c, org.ID, user.ID)
+			if errors.Is(err, ErrNotMember) {
+				return c.Error(http.StatusNotFound, ErrOrgNotFound)
+			}
+			if err != nil {
+				return c.Error(http.StatusInternalServerError, err)
+			}
+
+			if !ms.Role.AtLeast(role) {
+				return c.Error(http.StatusForbidden, errors.New("insufficient organization role"))
+			}
+
+			c.Set(OrgContextKey, org)
+			c.Set(MembershipContextKey, ms)
+			return next(c)
+		}
+	}
+}
+
+// CurrentOrg returns the organization set by RequireOrgMember, or nil.
+func CurrentOrg(c buffalo.Context) *Organization {
+	org, _ := c.Value(OrgContextKey).(*Organization)
+	return org
+}
+
+// CurrentMembership returns the membership set by RequireOrgMember, or nil.
+func CurrentMembership(c buffalo.Context) *Membership {
+	ms, _ := c.Value(MembershipContextKey).(*Membership)
+	return ms
+}
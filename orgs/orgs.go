@@ -0,0 +1,346 @@
+// Package orgs adds organizations and team membership to Buffkit apps.
+// Most real applications outgrow single-user accounts quickly: users belong to
+// one or more organizations, each with a role, and new members join through
+// emailed invitations.
+//
+// The package provides:
+//   - Organization, Membership, and Invitation records with a Store interface
+//   - Memory and SQL store implementations
+//   - Signed, expiring invitation tokens delivered through mail.Sender
+//   - RequireOrgMember / RequireOrgRole middleware for org-scoped routes
+//
+// Example:
+//
+//	store := orgs.NewSQLStore(db, "postgres")
+//	inviter := orgs.NewInviter(store, kit.Mail, secret, "https://app.example.com")
+//
+//	team := app.Group("/orgs/{org}")
+//	team.Use(buffkit.RequireLogin, orgs.RequireOrgMember(store))
+//	app.GET("/invitations/accept", buffkit.RequireLogin(orgs.AcceptHandler(inviter)))
+package orgs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/readonly"
+)
+
+// Role is a member's role within an organization.
+type Role string
+
+// Built-in roles, from most to least privileged.
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+)
+
+// rank orders roles so "at least admin" checks are simple comparisons.
+var rank = map[Role]int{
+	RoleOwner:  3,
+	RoleAdmin:  2,
+	RoleMember: 1,
+}
+
+// AtLeast reports whether r is as privileged as min.
+// Unknown roles are never privileged.
+func (r Role) AtLeast(min Role) bool {
+	return rank[r] > 0 && rank[r] >= rank[min]
+}
+
+// Valid reports whether r is one of the built-in roles.
+func (r Role) Valid() bool {
+	_, ok := rank[r]
+	return ok
+}
+
+// Organization is a group of users that share data and billing.
+type Organization struct {
+	ID        string    `json:"id" db:"id"`
+	Slug      string    `json:"slug" db:"slug"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Membership links a user to an organization with a role.
+type Membership struct {
+	OrgID     string    `json:"org_id" db:"org_id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Role      Role      `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Invitation is a pending offer for an email address to join an organization.
+type Invitation struct {
+	ID         string     `json:"id" db:"id"`
+	OrgID      string     `json:"org_id" db:"org_id"`
+	Email      string     `json:"email" db:"email"`
+	Role       Role       `json:"role" db:"role"`
+	InvitedBy  string     `json:"invited_by" db:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at" db:"accepted_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Store persists organizations, memberships, and invitations.
+type Store interface {
+	CreateOrg(ctx context.Context, org *Organization) error
+	OrgByID(ctx context.Context, id string) (*Organization, error)
+	OrgBySlug(ctx context.Context, slug string) (*Organization, error)
+	OrgsForUser(ctx context.Context, userID string) ([]*Organization, error)
+
+	AddMember(ctx context.Context, m *Membership) error
+	RemoveMember(ctx context.Context, orgID, userID string) error
+	Membership(ctx context.Context, orgID, userID string) (*Membership, error)
+	Members(ctx context.Context, orgID string) ([]*Membership, error)
+
+	CreateInvitation(ctx context.Context, inv *Invitation) error
+	InvitationByID(ctx context.Context, id string) (*Invitation, error)
+	// AcceptInvitation records that invitation id was accepted at at
+	// and adds m, as one step. It returns ErrInvitationInvalid, changing
+	// nothing, if the invitation already was accepted, so each
+	// invitation is accepted once even by racing requests.
+	AcceptInvitation(ctx context.Context, id string, m *Membership, at time.Time) error
+}
+
+var (
+	// ErrOrgNotFound is returned when an organization lookup fails.
+	ErrOrgNotFound = auth.NotFoundError("organization not found")
+
+	// ErrOrgExists is returned when creating an organization with a taken slug.
+	ErrOrgExists = auth.ConflictError("organization already exists")
+
+	// ErrNotMember is returned when a user has no membership in an organization.
+	ErrNotMember = auth.NotFoundError("not a member of this organization")
+
+	// ErrInvitationNotFound is returned when an invitation lookup fails.
+	ErrInvitationNotFound = auth.NotFoundError("invitation not found")
+
+	// ErrInvitationInvalid is returned for tampered, expired, or used invitations.
+	ErrInvitationInvalid = errors.New("invitation is invalid or has expired")
+
+	// ErrInvitationEmail is returned when accepting an invitation sent to
+	// another email address.
+	ErrInvitationEmail = errors.New("invitation was sent to a different email address")
+)
+
+// newID generates a random identifier for records created by this package.
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MemoryStore keeps organizations in memory. Useful for tests and development.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	orgs        map[string]*Organization // keyed by ID
+	memberships map[string]*Membership   // keyed by orgID + "/" + userID
+	invitations map[string]*Invitation   // keyed by ID
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orgs:        make(map[string]*Organization),
+		memberships: make(map[string]*Membership),
+		invitations: make(map[string]*Invitation),
+	}
+}
+
+func (m *MemoryStore) CreateOrg(ctx context.Context, org *Organization) error {
+	if err := readonly.Check("orgs.CreateOrg"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.orgs {
+		if existing.Slug == org.Slug {
+			return ErrOrgExists
+		}
+	}
+	if org.ID == "" {
+		org.ID = newID()
+	}
+	if org.CreatedAt.IsZero() {
+		org.CreatedAt = time.Now()
+	}
+	m.orgs[org.ID] = org
+	return nil
+}
+
+func (m *MemoryStore) OrgByID(ctx context.Context, id string) (*Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if org, ok := m.orgs[id]; ok {
+		return org, nil
+	}
+	return nil, ErrOrgNotFound
+}
+
+func (m *MemoryStore) OrgBySlug(ctx context.Context, slug string) (*Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, org := range m.orgs {
+		if org.Slug == slug {
+			return org, nil
+		}
+	}
+	return nil, ErrOrgNotFound
+}
+
+func (m *MemoryStore) OrgsForUser(ctx context.Context, userID string) ([]*Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []*Organization
+	for _, ms := range m.memberships {
+		if ms.UserID == userID {
+			if org, ok := m.orgs[ms.OrgID]; ok {
+				result = append(result, org)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (m *MemoryStore) AddMember(ctx context.Context, ms *Membership) error {
+	if err := readonly.Check("orgs.AddMember"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.orgs[ms.OrgID]; !ok {
+		return ErrOrgNotFound
+	}
+	if ms.CreatedAt.IsZero() {
+		ms.CreatedAt = time.Now()
+	}
+	m.memberships[ms.OrgID+"/"+ms.UserID] = ms
+	return nil
+}
+
+func (m *MemoryStore) RemoveMember(ctx context.Context, orgID, userID string) error {
+	if err := readonly.Check("orgs.RemoveMember"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := orgID + "/" + userID
+	if _, ok := m.memberships[key]; !ok {
+		return ErrNotMember
+	}
+	delete(m.memberships, key)
+	return nil
+}
+
+func (m *MemoryStore) Membership(ctx context.Context, orgID, userID string) (*Membership, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if ms, ok := m.memberships[orgID+"/"+userID]; ok {
+		return ms, nil
+	}
+	return nil, ErrNotMember
+}
+
+func (m *MemoryStore) Members(ctx context.Context, orgID string) ([]*Membership, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []*Membership
+	for _, ms := range m.memberships {
+		if ms.OrgID == orgID {
+			result = append(result, ms)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+func (m *MemoryStore) CreateInvitation(ctx context.Context, inv *Invitation) error {
+	if err := readonly.Check("orgs.CreateInvitation"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if inv.ID == "" {
+		inv.ID = newID()
+	}
+	if inv.CreatedAt.IsZero() {
+		inv.CreatedAt = time.Now()
+	}
+	m.invitations[inv.ID] = inv
+	return nil
+}
+
+func (m *MemoryStore) InvitationByID(ctx context.Context, id string) (*Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if inv, ok := m.invitations[id]; ok {
+		return inv, nil
+	}
+	return nil, ErrInvitationNotFound
+}
+
+func (m *MemoryStore) AcceptInvitation(ctx context.Context, id string, ms *Membership, at time.Time) error {
+	if err := readonly.Check("orgs.AcceptInvitation"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv, ok := m.invitations[id]
+	if !ok {
+		return ErrInvitationNotFound
+	}
+	if inv.AcceptedAt != nil {
+		return ErrInvitationInvalid
+	}
+	if _, ok := m.orgs[ms.OrgID]; !ok {
+		return ErrOrgNotFound
+	}
+	if ms.CreatedAt.IsZero() {
+		ms.CreatedAt = at
+	}
+	inv.AcceptedAt = &at
+	m.memberships[ms.OrgID+"/"+ms.UserID] = ms
+	return nil
+}
@@ -0,0 +1,208 @@
+package orgs
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/readonly"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	assert.True(t, RoleOwner.AtLeast(RoleAdmin))
+	assert.True(t, RoleAdmin.AtLeast(RoleAdmin))
+	assert.False(t, RoleMember.AtLeast(RoleAdmin))
+	assert.False(t, Role("guest").AtLeast(RoleMember))
+}
+
+func TestInvitationFlow(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	sender := mail.NewDevSender()
+	inviter := NewInviter(store, sender, []byte("secret"), "https://app.test")
+
+	org := &Organization{Slug: "acme", Name: "Acme <Corp>"}
+	require.NoError(t, store.CreateOrg(ctx, org))
+
+	inv, err := inviter.Invite(ctx, org, "New@Example.com", RoleAdmin, "owner-1")
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", inv.Email)
+
+	messages := sender.GetMessages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Text, inviter.AcceptURL(inv))
+	assert.Contains(t, messages[0].HTML, "Acme &lt;Corp&gt;")
+	assert.NotContains(t, messages[0].HTML, "<Corp>")
+
+	invitee := &auth.User{ID: "user-1", Email: "new@example.com"}
+
+	token := inviter.Token(inv)
+
+	t.Run("tampered token is rejected", func(t *testing.T) {
+		_, err := inviter.Accept(ctx, strings.Replace(token, ".", "x.", 1), invitee)
+		assert.ErrorIs(t, err, ErrInvitationInvalid)
+	})
+
+	t.Run("only the invited email can accept", func(t *testing.T) {
+		_, err := inviter.Accept(ctx, token, &auth.User{ID: "user-2", Email: "eve@example.com"})
+		assert.ErrorIs(t, err, ErrInvitationEmail)
+		_, err = store.Membership(ctx, org.ID, "user-2")
+		assert.ErrorIs(t, err, ErrNotMember)
+	})
+
+	t.Run("valid token adds membership once", func(t *testing.T) {
+		ms, err := inviter.Accept(ctx, token, &auth.User{ID: "user-1", Email: "New@Example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, RoleAdmin, ms.Role)
+
+		found, err := store.Membership(ctx, org.ID, "user-1")
+		require.NoError(t, err)
+		assert.Equal(t, RoleAdmin, found.Role)
+
+		again, err := inviter.Accept(ctx, token, invitee)
+		require.NoError(t, err, "a second click finds the membership")
+		assert.Equal(t, found, again)
+
+		racer := &Membership{OrgID: org.ID, UserID: "user-4", Role: RoleAdmin}
+		assert.ErrorIs(t, store.AcceptInvitation(ctx, inv.ID, racer, time.Now()), ErrInvitationInvalid,
+			"racing accepts can't both use the invitation")
+		_, err = store.Membership(ctx, org.ID, "user-4")
+		assert.ErrorIs(t, err, ErrNotMember)
+	})
+
+	t.Run("a failed accept leaves the invitation pending", func(t *testing.T) {
+		orphan := &Invitation{OrgID: "gone", Email: "orphan@example.com", Role: RoleMember, ExpiresAt: time.Now().Add(time.Hour)}
+		require.NoError(t, store.CreateInvitation(ctx, orphan))
+		_, err := inviter.Accept(ctx, inviter.Token(orphan), &auth.User{ID: "user-5", Email: "orphan@example.com"})
+		assert.ErrorIs(t, err, ErrOrgNotFound)
+		_, err = inviter.Verify(ctx, inviter.Token(orphan))
+		assert.NoError(t, err)
+	})
+
+	t.Run("expired token is rejected", func(t *testing.T) {
+		old, err := inviter.Invite(ctx, org, "late@example.com", RoleMember, "owner-1")
+		require.NoError(t, err)
+		old.ExpiresAt = time.Now().Add(-time.Minute)
+		_, err = inviter.Accept(ctx, inviter.Token(old), &auth.User{ID: "user-3", Email: "late@example.com"})
+		assert.ErrorIs(t, err, ErrInvitationInvalid)
+	})
+
+	t.Run("token expires on the inviter's clock", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		timed := NewInviter(store, nil, []byte("secret"), "https://app.test")
+		timed.Clock = clk
+
+		inv, err := timed.Invite(ctx, org, "soon@example.com", RoleMember, "owner-1")
+		require.NoError(t, err)
+		_, err = timed.Verify(ctx, timed.Token(inv))
+		require.NoError(t, err)
+
+		clk.Advance(DefaultInvitationTTL + time.Minute)
+		_, err = timed.Verify(ctx, timed.Token(inv))
+		assert.ErrorIs(t, err, ErrInvitationInvalid)
+	})
+
+	t.Run("token signed with a previous secret still verifies", func(t *testing.T) {
+		pending, err := inviter.Invite(ctx, org, "rotated@example.com", RoleMember, "owner-1")
+		require.NoError(t, err)
+		oldToken := inviter.Token(pending)
+
+		rotated := NewInviter(store, nil, []byte("new-secret"), "https://app.test")
+		_, err = rotated.Verify(ctx, oldToken)
+		assert.ErrorIs(t, err, ErrInvitationInvalid)
+
+		rotated.PreviousSecrets = [][]byte{[]byte("secret")}
+		found, err := rotated.Verify(ctx, oldToken)
+		require.NoError(t, err)
+		assert.Equal(t, pending.ID, found.ID)
+	})
+}
+
+func TestSQLStore(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	schema, err := os.ReadFile("../db/migrations/orgs/20261016091000_create_organizations.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	store := NewSQLStore(db, "sqlite")
+	org := &Organization{Slug: "acme", Name: "Acme"}
+	require.NoError(t, store.CreateOrg(ctx, org))
+	assert.ErrorIs(t, store.CreateOrg(ctx, &Organization{Slug: "acme", Name: "Dup"}), ErrOrgExists)
+	assert.ErrorIs(t, store.CreateOrg(ctx, &Organization{Slug: "acme", Name: "Dup"}), auth.ErrConflict)
+	_, err = store.OrgBySlug(ctx, "nope")
+	assert.ErrorIs(t, err, auth.ErrNotFound)
+
+	require.NoError(t, store.AddMember(ctx, &Membership{OrgID: org.ID, UserID: "u1", Role: RoleMember}))
+	require.NoError(t, store.AddMember(ctx, &Membership{OrgID: org.ID, UserID: "u1", Role: RoleOwner}))
+
+	ms, err := store.Membership(ctx, org.ID, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, RoleOwner, ms.Role)
+
+	orgs, err := store.OrgsForUser(ctx, "u1")
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+	assert.Equal(t, "acme", orgs[0].Slug)
+
+	require.NoError(t, store.RemoveMember(ctx, org.ID, "u1"))
+	_, err = store.Membership(ctx, org.ID, "u1")
+	assert.ErrorIs(t, err, ErrNotMember)
+
+	inv := &Invitation{OrgID: org.ID, Email: "new@example.com", Role: RoleMember, InvitedBy: "u1", ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, store.CreateInvitation(ctx, inv))
+	require.NoError(t, store.AcceptInvitation(ctx, inv.ID, &Membership{OrgID: org.ID, UserID: "u2", Role: RoleMember}, time.Now()))
+	ms, err = store.Membership(ctx, org.ID, "u2")
+	require.NoError(t, err)
+	assert.Equal(t, RoleMember, ms.Role)
+	assert.ErrorIs(t, store.AcceptInvitation(ctx, inv.ID, &Membership{OrgID: org.ID, UserID: "u3", Role: RoleMember}, time.Now()), ErrInvitationInvalid)
+	_, err = store.Membership(ctx, org.ID, "u3")
+	assert.ErrorIs(t, err, ErrNotMember, "nothing changes when the invitation was used")
+	assert.ErrorIs(t, store.AcceptInvitation(ctx, "nope", &Membership{OrgID: org.ID, UserID: "u3"}, time.Now()), ErrInvitationNotFound)
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	schema, err := os.ReadFile("../db/migrations/orgs/20261016091000_create_organizations.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "sql": NewSQLStore(db, "sqlite")} {
+		t.Run(name, func(t *testing.T) {
+			org := &Organization{Slug: "acme-" + name, Name: "Acme"}
+			require.NoError(t, store.CreateOrg(ctx, org))
+			require.NoError(t, store.AddMember(ctx, &Membership{OrgID: org.ID, UserID: "u1", Role: RoleOwner}))
+			inv := &Invitation{OrgID: org.ID, Email: "new@example.com", Role: RoleMember, InvitedBy: "u1", ExpiresAt: time.Now().Add(time.Hour)}
+			require.NoError(t, store.CreateInvitation(ctx, inv))
+
+			require.NoError(t, readonly.Default.Enable(ctx, ""))
+			t.Cleanup(readonly.Default.Reset)
+
+			assert.ErrorIs(t, store.CreateOrg(ctx, &Organization{Slug: "other-" + name, Name: "Other"}), readonly.ErrReadOnly)
+			assert.ErrorIs(t, store.AddMember(ctx, &Membership{OrgID: org.ID, UserID: "u2", Role: RoleMember}), readonly.ErrReadOnly)
+			assert.ErrorIs(t, store.RemoveMember(ctx, org.ID, "u1"), readonly.ErrReadOnly)
+			assert.ErrorIs(t, store.CreateInvitation(ctx, &Invitation{OrgID: org.ID, Email: "x@example.com", Role: RoleMember}), readonly.ErrReadOnly)
+			assert.ErrorIs(t, store.AcceptInvitation(ctx, inv.ID, &Membership{OrgID: org.ID, UserID: "u2", Role: RoleMember}, time.Now()), readonly.ErrReadOnly)
+
+			_, err := store.Membership(ctx, org.ID, "u1")
+			assert.NoError(t, err, "reads carry on")
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package orgs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// SQLStore persists organizations in the tables created by the
+// db/migrations/orgs migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates an organization store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) CreateOrg(ctx context.Context, org *Organization) error {
+	if err := readonly.Check("orgs.CreateOrg"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	if org.ID == "" {
+		org.ID = newID()
+	}
+	if org.CreatedAt.IsZero() {
+		org.CreatedAt = time.Now()
+	}
+
+	var exists int
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect, "SELECT COUNT(*) FROM organizations WHERE slug = ?"), org.Slug).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("orgs: check slug: %w", err)
+	}
+	if exists > 0 {
+		return ErrOrgExists
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		sqlutil.Rebind(s.dialect, "INSERT INTO organizations (id, slug, name, created_at) VALUES (?, ?, ?, ?)"),
+		org.ID, org.Slug, org.Name, org.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("orgs: create organization: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) OrgByID(ctx context.Context, id string) (*Organization, error) {
+	return s.findOrg(ctx, "id", id)
+}
+
+func (s *SQLStore) OrgBySlug(ctx context.Context, slug string) (*Organization, error) {
+	return s.findOrg(ctx, "slug", slug)
+}
+
+func (s *SQLStore) findOrg(ctx context.Context, column, value string) (*Organization, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var org Organization
+	err := s.db.QueryRowContext(ctx,
+		sqlutil.Rebind(s.dialect, "SELECT id, slug, name, created_at FROM organizations WHERE "+column+" = ?"), value).
+		Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrgNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("orgs: find organization: %w", err)
+	}
+	return &org, nil
+}
+
+func (s *SQLStore) OrgsForUser(ctx context.Context, userID string) ([]*Organization, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect, `
+		SELECT o.id, o.slug, o.name, o.created_at
+		FROM organizations o
+		JOIN org_memberships m ON m.org_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY o.name`), userID)
+	if err != nil {
+		return nil, fmt.Errorf("orgs: list organizations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var result []*Organization
+	for rows.Next() {
+		var org Organization
+		if err := rows.Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, &org)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) AddMember(ctx context.Context, m *Membership) error {
+	if err := readonly.Check("orgs.AddMember"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	return s.addMember(ctx, s.db, m)
+}
+
+// execer is a *sql.DB or *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// addMember adds or updates m through db.
+func (s *SQLStore) addMember(ctx context.Context, db execer, m *Membership) error {
+	// Upsert by hand so the same code works on all three dialects
+	res, err := db.ExecContext(ctx,
+		sqlutil.Rebind(s.dialect, "UPDATE org_memberships SET role = ? WHERE org_id = ? AND user_id = ?"),
+		string(m.Role), m.OrgID, m.UserID)
+	if err != nil {
+		return fmt.Errorf("orgs: update membership: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	_, err = db.ExecContext(ctx,
+		sqlutil.Rebind(s.dialect, "INSERT INTO org_memberships (org_id, user_id, role, created_at) VALUES (?, ?, ?, ?)"),
+		m.OrgID, m.UserID, string(m.Role), m.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("orgs: add membership: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) RemoveMember(ctx context.Context, orgID, userID string) error {
+	if err := readonly.Check("orgs.RemoveMember"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	res, err := s.db.ExecContext(ctx,
+		sqlutil.Rebind(s.dialect, "DELETE FROM org_memberships WHERE org_id = ? AND user_id = ?"), orgID, userID)
+	if err != nil {
+		return fmt.Errorf("orgs: remove membership: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+func (s *SQLStore) Membership(ctx context.Context, orgID, userID string) (*Membership, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var m Membership
+	var role string
+	err := s.db.QueryRowContext(ctx,
+		sqlutil.Rebind(s.dialect, "SELECT org_id, user_id, role, created_at FROM org_memberships WHERE org_id = ? AND user_id = ?"),
+		orgID, userID).Scan(&m.OrgID, &m.UserID, &role, &m.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("orgs: find membership: %w", err)
+	}
+	m.Role = Role(role)
+	return &m, nil
+}
+
+func (s *SQLStore) Members(ctx context.Context, orgID string) ([]*Membership, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx,
+		sqlutil.Rebind(s.dialect, "SELECT org_id, user_id, role, created_at FROM org_memberships WHERE org_id = ? ORDER BY created_at"),
+		orgID)
+	if err != nil {
+		return nil, fmt.Errorf("orgs: list members: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var result []*Membership
+	for rows.Next() {
+		var m Membership
+		var role string
+		if err := rows.Scan(&m.OrgID, &m.UserID, &role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.Role = Role(role)
+		result = append(result, &m)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLStore) CreateInvitation(ctx context.Context, inv *Invitation) error {
+	if err := readonly.Check("orgs.CreateInvitation"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	if inv.ID == "" {
+		inv.ID = newID()
+	}
+	if inv.CreatedAt.IsZero() {
+		inv.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, `
+		INSERT INTO org_invitations (id, org_id, email, role, invited_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		inv.ID, inv.OrgID, inv.Email, string(inv.Role), inv.InvitedBy, inv.ExpiresAt, inv.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("orgs: create invitation: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) InvitationByID(ctx context.Context, id string) (*Invitation, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var inv Invitation
+	var role string
+	var acceptedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect, `
+		SELECT id, org_id, email, role, invited_by, expires_at, accepted_at, created_at
+		FROM org_invitations WHERE id = ?`), id).
+		Scan(&inv.ID, &inv.OrgID, &inv.Email, &role, &inv.InvitedBy, &inv.ExpiresAt, &acceptedAt, &inv.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("orgs: find invitation: %w", err)
+	}
+	inv.Role = Role(role)
+	if acceptedAt.Valid {
+		inv.AcceptedAt = &acceptedAt.Time
+	}
+	return &inv, nil
+}
+
+func (s *SQLStore) AcceptInvitation(ctx context.Context, id string, m *Membership, at time.Time) error {
+	if err := readonly.Check("orgs.AcceptInvitation"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = at
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		sqlutil.Rebind(s.dialect, "UPDATE org_invitations SET accepted_at = ? WHERE id = ? AND accepted_at IS NULL"), at, id)
+	if err != nil {
+		return fmt.Errorf("orgs: accept invitation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		_ = tx.Rollback()
+		if _, err := s.InvitationByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrInvitationInvalid
+	}
+	if err := s.addMember(ctx, tx, m); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
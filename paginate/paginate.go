@@ -0,0 +1,187 @@
+// Package paginate pages through large tables by keyset (cursor) rather
+// than by offset. OFFSET n makes the database read and throw away n rows,
+// so the deep pages of a big table get slower and slower; a keyset query
+// seeks straight past the last row shown, using the index on the order.
+// The cost is that pages can't be jumped to by number, only followed.
+//
+// A Keyset is the order rows are paged in. Each page's query takes the
+// rows after the previous page's cursor, one more than fit so it's known
+// whether there's a next page:
+//
+//	order := paginate.Order("id", paginate.Key{Column: "created_at", Desc: true})
+//
+//	after, err := paginate.ParseCursor(c.Param("after"))
+//	...
+//	where, args, err := order.Where(after) // "" on the first page
+//	query := "SELECT id, email, created_at FROM users"
+//	if where != "" {
+//	    query += " WHERE " + where
+//	}
+//	query += " ORDER BY " + order.OrderBy() + " LIMIT ?"
+//	rows := ... // db.QueryContext(c, query, append(args, perPage+1)...), scanned
+//	rows, more := paginate.Split(rows, perPage)
+//	if more {
+//	    next = order.CursorFor(rows[len(rows)-1]).String()
+//	}
+//
+// Queries use ? placeholders; rebind them for PostgreSQL as Buffkit's
+// stores do. Cursor values are the key columns as text, which SQLite,
+// PostgreSQL and MySQL all compare against the columns' own types.
+package paginate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't made by Cursor's
+// String, or was made for a different order.
+var ErrInvalidCursor = errors.New("paginate: invalid cursor")
+
+// Key is a column rows are ordered by.
+type Key struct {
+	Column string
+	Desc   bool
+}
+
+// column matches the column names a Keyset puts in SQL.
+var column = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Keyset is an order to page rows in. Make one with Order.
+type Keyset struct {
+	keys []Key
+}
+
+// Order returns the keyset ordering rows by keys, then by unique (usually
+// the primary key) if it isn't among them, so rows with equal keys keep
+// the same order from one page to the next. unique takes the direction
+// of the last key. Column names go into the SQL as they are, so Order
+// panics on one that isn't a plain (optionally table-qualified) name.
+func Order(unique string, keys ...Key) Keyset {
+	keys = append([]Key(nil), keys...)
+	found := false
+	for _, k := range keys {
+		found = found || k.Column == unique
+	}
+	if !found {
+		desc := len(keys) > 0 && keys[len(keys)-1].Desc
+		keys = append(keys, Key{Column: unique, Desc: desc})
+	}
+	for _, k := range keys {
+		if !column.MatchString(k.Column) {
+			panic(fmt.Sprintf("paginate: invalid column %q", k.Column))
+		}
+	}
+	return Keyset{keys: keys}
+}
+
+// Keys returns the columns rows are ordered by, the unique one last.
+func (k Keyset) Keys() []Key {
+	return append([]Key(nil), k.keys...)
+}
+
+// OrderBy returns the ORDER BY list for the keyset, such as
+// "created_at DESC, id DESC".
+func (k Keyset) OrderBy() string {
+	parts := make([]string, len(k.keys))
+	for i, key := range k.keys {
+		dir := "ASC"
+		if key.Desc {
+			dir = "DESC"
+		}
+		parts[i] = key.Column + " " + dir
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Where returns the condition for the rows after cursor, and its
+// arguments, for a query's WHERE clause. It's empty for the zero cursor,
+// the first page. Each key's direction is honoured, so a keyset can mix
+// ascending and descending keys.
+func (k Keyset) Where(cursor Cursor) (string, []any, error) {
+	if len(cursor) == 0 {
+		return "", nil, nil
+	}
+	if len(cursor) != len(k.keys) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	// (a > ?) OR (a = ? AND b > ?) OR ...
+	var ors []string
+	var args []any
+	for i, key := range k.keys {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, k.keys[j].Column+" = ?")
+			args = append(args, cursor[j])
+		}
+		op := " > ?"
+		if key.Desc {
+			op = " < ?"
+		}
+		ands = append(ands, key.Column+op)
+		args = append(args, cursor[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args, nil
+}
+
+// CursorFor returns the cursor after row, which holds its values by
+// column name (without the table, for qualified columns), as the rows of
+// a components.Dataset do.
+func (k Keyset) CursorFor(row map[string]string) Cursor {
+	cursor := make(Cursor, len(k.keys))
+	for i, key := range k.keys {
+		name := key.Column
+		if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+			name = name[dot+1:]
+		}
+		cursor[i] = row[name]
+	}
+	return cursor
+}
+
+// Cursor is a position in a keyset order: the key values of the row
+// before it. The zero Cursor is the start.
+type Cursor []string
+
+// String encodes the cursor as opaque text for a URL, or "" for the zero
+// Cursor. The text isn't secret or signed; it only carries key values,
+// which Where passes to the database as arguments.
+func (c Cursor) String() string {
+	if len(c) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal([]string(c))
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor made by String. Empty text is the zero
+// Cursor.
+func ParseCursor(s string) (Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil || len(values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return Cursor(values), nil
+}
+
+// Split returns the first perPage of rows, and whether there were more,
+// for a page queried with a LIMIT of perPage+1.
+func Split[T any](rows []T, perPage int) ([]T, bool) {
+	if len(rows) > perPage {
+		return rows[:perPage], true
+	}
+	return rows, false
+}
@@ -0,0 +1,138 @@
+package paginate
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrder(t *testing.T) {
+	order := Order("id", Key{Column: "created_at", Desc: true})
+	assert.Equal(t, []Key{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}}, order.Keys())
+	assert.Equal(t, "created_at DESC, id DESC", order.OrderBy())
+
+	// The unique column isn't added twice
+	assert.Equal(t, "u.name ASC, u.id DESC", Order("u.id", Key{Column: "u.name"}, Key{Column: "u.id", Desc: true}).OrderBy())
+	assert.Equal(t, "id ASC", Order("id").OrderBy())
+
+	where, args, err := Order("id", Key{Column: "score", Desc: true}, Key{Column: "name"}).Where(Cursor{"7", "b", "3"})
+	require.NoError(t, err)
+	assert.Equal(t, "((score < ?) OR (score = ? AND name > ?) OR (score = ? AND name = ? AND id > ?))", where)
+	assert.Equal(t, []any{"7", "7", "b", "7", "b", "3"}, args)
+
+	where, args, err = order.Where(nil)
+	require.NoError(t, err)
+	assert.Empty(t, where)
+	assert.Nil(t, args)
+
+	_, _, err = order.Where(Cursor{"1"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	assert.PanicsWithValue(t, `paginate: invalid column "id; DROP TABLE users"`, func() {
+		Order("id; DROP TABLE users")
+	})
+
+	assert.Equal(t, Cursor{"2024-01-02", "9"}, order.CursorFor(map[string]string{"created_at": "2024-01-02", "id": "9", "email": "x"}))
+	assert.Equal(t, Cursor{"9"}, Order("users.id").CursorFor(map[string]string{"id": "9"}))
+}
+
+func TestCursor(t *testing.T) {
+	cursor := Cursor{"2024-01-02 10:00:00", "42", "a,b\"c"}
+	s := cursor.String()
+	assert.NotContains(t, s, "42", "opaque")
+	assert.NotContains(t, s, "=", "unpadded, for URLs")
+
+	parsed, err := ParseCursor(s)
+	require.NoError(t, err)
+	assert.Equal(t, cursor, parsed)
+
+	assert.Empty(t, Cursor(nil).String())
+	parsed, err = ParseCursor("")
+	require.NoError(t, err)
+	assert.Nil(t, parsed)
+
+	// Not base64, "not json", and "[]"
+	for _, bad := range []string{"!!!", "bm90IGpzb24", "W10"} {
+		_, err := ParseCursor(bad)
+		assert.ErrorIs(t, err, ErrInvalidCursor, bad)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	rows, more := Split([]int{1, 2, 3}, 2)
+	assert.Equal(t, []int{1, 2}, rows)
+	assert.True(t, more)
+
+	rows, more = Split([]int{1, 2}, 2)
+	assert.Equal(t, []int{1, 2}, rows)
+	assert.False(t, more)
+}
+
+// TestKeysetPaging pages through a table with repeated keys and checks
+// every row comes once, in the same order as the query without paging.
+func TestKeysetPaging(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, score INTEGER NOT NULL, name TEXT NOT NULL)")
+	require.NoError(t, err)
+	for i := 1; i <= 23; i++ {
+		_, err := db.Exec("INSERT INTO items (id, score, name) VALUES (?, ?, ?)", i, i%4, fmt.Sprintf("item-%d", i%3))
+		require.NoError(t, err)
+	}
+
+	ids := func(rows *sql.Rows) []map[string]string {
+		defer rows.Close()
+		var out []map[string]string
+		for rows.Next() {
+			var id, score, name string
+			require.NoError(t, rows.Scan(&id, &score, &name))
+			out = append(out, map[string]string{"id": id, "score": score, "name": name})
+		}
+		require.NoError(t, rows.Err())
+		return out
+	}
+
+	for _, order := range []Keyset{
+		Order("id"),
+		Order("id", Key{Column: "score"}),
+		Order("id", Key{Column: "score", Desc: true}),
+		Order("id", Key{Column: "name"}, Key{Column: "score", Desc: true}),
+	} {
+		t.Run(order.OrderBy(), func(t *testing.T) {
+			rows, err := db.Query("SELECT id, score, name FROM items ORDER BY " + order.OrderBy())
+			require.NoError(t, err)
+			want := ids(rows)
+
+			var got []map[string]string
+			var after Cursor
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, 10, "paging doesn't end")
+				where, args, err := order.Where(after)
+				require.NoError(t, err)
+				query := []string{"SELECT id, score, name FROM items"}
+				if where != "" {
+					query = append(query, "WHERE "+where)
+				}
+				query = append(query, "ORDER BY "+order.OrderBy(), "LIMIT ?")
+				rows, err := db.Query(strings.Join(query, " "), append(args, 5+1)...)
+				require.NoError(t, err)
+
+				page, more := Split(ids(rows), 5)
+				got = append(got, page...)
+				if !more {
+					break
+				}
+				next, err := ParseCursor(order.CursorFor(page[len(page)-1]).String())
+				require.NoError(t, err)
+				after = next
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package buffkit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/pdf"
+)
+
+// RenderPDF renders template with data and sends it as a PDF:
+//
+//	return buffkit.RenderPDF(c, "invoices/show.plush.html", map[string]any{
+//	    "invoice": invoice,
+//	}, pdf.Attachment("invoice-42.pdf"))
+//
+// The template gets the same data as c.Render would give it, plus data.
+// The PDF opens in the browser unless disposition says to download it.
+// It's converted by Config.PDF, or by wkhtmltopdf or Chromium when one
+// is installed. Documents too heavy for a request can be rendered by a
+// job instead; see Kit.PDFJobs.
+func RenderPDF(c buffalo.Context, template string, data map[string]any, disposition ...pdf.Disposition) error {
+	if globalKit == nil || globalKit.PDF == nil {
+		return fmt.Errorf("buffkit: RenderPDF called before Wire")
+	}
+	d := pdf.Disposition{}
+	if len(disposition) > 0 {
+		d = disposition[0]
+	}
+	return c.Render(http.StatusOK, pdfResponse{c: c, renderer: globalKit.PDF, template: template, data: data, disposition: d})
+}
+
+// pdfResponse is a render.Renderer for RenderPDF.
+type pdfResponse struct {
+	c           buffalo.Context
+	renderer    *pdf.Renderer
+	template    string
+	data        map[string]any
+	disposition pdf.Disposition
+}
+
+func (p pdfResponse) ContentType() string {
+	return "application/pdf"
+}
+
+func (p pdfResponse) Render(w io.Writer, data render.Data) error {
+	merged := make(map[string]any, len(data)+len(p.data))
+	for k, v := range data {
+		merged[k] = v
+	}
+	for k, v := range p.data {
+		merged[k] = v
+	}
+	b, err := p.renderer.Render(p.c, p.template, merged)
+	if err != nil {
+		return err
+	}
+	// Set once the PDF is made, so an error page isn't sent as a download
+	p.c.Response().Header().Set("Content-Disposition", p.disposition.Header())
+	_, err = w.Write(b)
+	return err
+}
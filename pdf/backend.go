@@ -0,0 +1,141 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoBackend is returned when there's no backend to convert HTML to
+// PDF with: none was configured and Detect found none installed.
+var ErrNoBackend = errors.New("pdf: no backend; install wkhtmltopdf or Chromium, or set Config.PDF")
+
+// Backend converts an HTML document to PDF.
+type Backend interface {
+	Convert(ctx context.Context, html []byte, w io.Writer) error
+}
+
+// BackendFunc adapts a function to a Backend, for services that render
+// PDFs over HTTP and for tests.
+type BackendFunc func(ctx context.Context, html []byte, w io.Writer) error
+
+func (f BackendFunc) Convert(ctx context.Context, html []byte, w io.Writer) error {
+	return f(ctx, html, w)
+}
+
+// Wkhtmltopdf converts with the wkhtmltopdf command. The HTML is piped
+// to it, so links to stylesheets and images must be absolute URLs.
+type Wkhtmltopdf struct {
+	// Path is the command to run. Defaults to "wkhtmltopdf" on the PATH.
+	Path string
+
+	// Args are passed before the input and output, e.g.
+	// []string{"--page-size", "A4", "--margin-top", "20mm"}. Defaults to
+	// --quiet.
+	Args []string
+}
+
+func (b Wkhtmltopdf) Convert(ctx context.Context, html []byte, w io.Writer) error {
+	path := b.Path
+	if path == "" {
+		path = "wkhtmltopdf"
+	}
+	args := b.Args
+	if args == nil {
+		args = []string{"--quiet"}
+	}
+	cmd := exec.CommandContext(ctx, path, append(append([]string(nil), args...), "-", "-")...)
+	cmd.Stdin = bytes.NewReader(html)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pdf: wkhtmltopdf: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// Chrome converts with headless Chrome or Chromium. The HTML is written
+// to a temporary file first, so links to stylesheets and images must be
+// absolute URLs.
+type Chrome struct {
+	// Path is the browser to run. Defaults to the first of chromium,
+	// chromium-browser and google-chrome on the PATH.
+	Path string
+
+	// Args are passed along with the ones that print to PDF, e.g.
+	// []string{"--no-sandbox"} to run as root in a container.
+	Args []string
+}
+
+// chromes are the names Chrome looks for on the PATH.
+var chromes = []string{"chromium", "chromium-browser", "google-chrome"}
+
+func (b Chrome) Convert(ctx context.Context, html []byte, w io.Writer) error {
+	path := b.Path
+	if path == "" {
+		for _, name := range chromes {
+			if found, err := exec.LookPath(name); err == nil {
+				path = found
+				break
+			}
+		}
+		if path == "" {
+			return ErrNoBackend
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "buffkit-pdf-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	page := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(page, html, 0o600); err != nil {
+		return err
+	}
+	output := filepath.Join(dir, "page.pdf")
+
+	args := append([]string{
+		"--headless",
+		"--disable-gpu",
+		"--no-pdf-header-footer",
+		"--print-to-pdf=" + output,
+	}, b.Args...)
+	cmd := exec.CommandContext(ctx, path, append(args, (&url.URL{Scheme: "file", Path: page}).String())...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pdf: chrome: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		return fmt.Errorf("pdf: chrome: no output: %w", err)
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Detect returns a backend for the first converter installed:
+// wkhtmltopdf, then Chrome. It returns ErrNoBackend when there's none.
+func Detect() (Backend, error) {
+	if path, err := exec.LookPath("wkhtmltopdf"); err == nil {
+		return Wkhtmltopdf{Path: path}, nil
+	}
+	for _, name := range chromes {
+		if path, err := exec.LookPath(name); err == nil {
+			return Chrome{Path: path}, nil
+		}
+	}
+	return nil, ErrNoBackend
+}
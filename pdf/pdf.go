@@ -0,0 +1,218 @@
+// Package pdf renders Plush templates to PDF, for invoices, reports and
+// other printable documents. The HTML is converted by a pluggable
+// Backend: wkhtmltopdf, headless Chrome, or anything else that
+// implements Convert.
+//
+// Small documents are rendered within the request:
+//
+//	return buffkit.RenderPDF(c, "invoices/show.plush.html", map[string]any{
+//	    "invoice": invoice,
+//	}, pdf.Attachment("invoice-42.pdf"))
+//
+// Heavy ones run as background jobs, which send a signed download link
+// the way exports do (see export.Exports.Deliver):
+//
+//	err := kit.PDFJobs.Start(c, pdf.Document{
+//	    Template: "reports/annual.plush.html",
+//	    Data:     map[string]any{"year": 2026},
+//	    Filename: "annual-report-2026.pdf",
+//	}, export.Request{Email: user.Email})
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/blob"
+	"github.com/johnjansen/buffkit/export"
+)
+
+// Renderer renders templates to HTML and converts them to PDF.
+type Renderer struct {
+	// Backend converts the HTML. Nil makes Render fail with
+	// ErrNoBackend.
+	Backend Backend
+
+	// Templates holds the documents' Plush templates. Defaults to the
+	// templates directory.
+	Templates fs.FS
+
+	// Layout wraps every document, e.g. "layouts/pdf.plush.html" with
+	// the print stylesheet. None by default.
+	Layout string
+
+	once   sync.Once
+	engine *render.Engine
+}
+
+// HTML renders template with data, without converting it.
+func (r *Renderer) HTML(template string, data map[string]any) ([]byte, error) {
+	r.once.Do(func() {
+		templates := r.Templates
+		if templates == nil {
+			templates = os.DirFS("templates")
+		}
+		r.engine = render.New(render.Options{TemplatesFS: templates, HTMLLayout: r.Layout})
+	})
+	// The engine adds its own values, so it gets a copy
+	copied := make(render.Data, len(data))
+	for k, v := range data {
+		copied[k] = v
+	}
+	var buf bytes.Buffer
+	if err := r.engine.HTML(template).Render(&buf, copied); err != nil {
+		return nil, fmt.Errorf("pdf: render %s: %w", template, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Render renders template with data and converts it to PDF.
+func (r *Renderer) Render(ctx context.Context, template string, data map[string]any) ([]byte, error) {
+	if r.Backend == nil {
+		return nil, ErrNoBackend
+	}
+	html, err := r.HTML(template, data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := r.Backend.Convert(ctx, html, &buf); err != nil {
+		return nil, fmt.Errorf("pdf: convert %s: %w", template, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Save renders template with data and stores the PDF at key, to be
+// linked to with blob.Server.URL or attached with mail.AttachBlob.
+func (r *Renderer) Save(ctx context.Context, store blob.Store, key, template string, data map[string]any) error {
+	pdf, err := r.Render(ctx, template, data)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, bytes.NewReader(pdf), "application/pdf")
+}
+
+// Disposition says whether a PDF opens in the browser or downloads, and
+// the file name it's saved as.
+type Disposition struct {
+	Attachment bool
+	Filename   string
+}
+
+// Inline opens the PDF in the browser, saving it as filename.
+func Inline(filename string) Disposition {
+	return Disposition{Filename: filename}
+}
+
+// Attachment downloads the PDF as filename.
+func Attachment(filename string) Disposition {
+	return Disposition{Attachment: true, Filename: filename}
+}
+
+// Header returns d as a Content-Disposition header.
+func (d Disposition) Header() string {
+	kind := "inline"
+	if d.Attachment {
+		kind = "attachment"
+	}
+	if d.Filename == "" {
+		return kind
+	}
+	if v := mime.FormatMediaType(kind, map[string]string{"filename": d.Filename}); v != "" {
+		return v
+	}
+	return kind
+}
+
+// Task is the job type of background PDF renders.
+const Task = "pdf:render"
+
+// Document is a PDF for a background job to render.
+type Document struct {
+	Template string
+
+	// Data is passed to the job as JSON, so it should hold plain values
+	// (numbers come back as float64), not models with methods.
+	Data map[string]any
+
+	// Filename is what the PDF downloads as. Defaults to document.pdf.
+	Filename string
+}
+
+// Jobs renders documents as background jobs and sends their download
+// links through Exports.
+type Jobs struct {
+	Queue    export.Queue
+	Renderer *Renderer
+	Exports  *export.Exports
+}
+
+// payload is the payload of a PDF job.
+type payload struct {
+	Document Document `json:"document"`
+	Email    string   `json:"email,omitempty"`
+	Channel  string   `json:"channel,omitempty"`
+}
+
+// NewJobs creates Jobs and handles their tasks on queue.
+func NewJobs(queue export.Queue, renderer *Renderer, exports *export.Exports) *Jobs {
+	j := &Jobs{Queue: queue, Renderer: renderer, Exports: exports}
+	queue.HandleFunc(Task, func(ctx context.Context, t *asynq.Task) error {
+		var p payload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return fmt.Errorf("pdf: bad payload: %w", err)
+		}
+		return j.Run(ctx, p.Document, export.Request{Email: p.Email, Channel: p.Channel})
+	})
+	return j
+}
+
+// Start queues doc to be rendered. req must have an Email or a Channel
+// to send the link to; its Params aren't used.
+func (j *Jobs) Start(ctx context.Context, doc Document, req export.Request) error {
+	if doc.Template == "" {
+		return errors.New("pdf: Document.Template is required")
+	}
+	if req.Email == "" && req.Channel == "" {
+		return fmt.Errorf("pdf: %s: the request needs an Email or Channel to send the link to", doc.Template)
+	}
+	return j.Queue.EnqueueIn(0, Task, payload{Document: doc, Email: req.Email, Channel: req.Channel})
+}
+
+// Run renders doc and sends its link. The job Start queues calls it;
+// it's exported for rendering without the queue, such as in tests.
+func (j *Jobs) Run(ctx context.Context, doc Document, req export.Request) error {
+	name := doc.Filename
+	if name == "" {
+		name = "document.pdf"
+	}
+	if !strings.EqualFold(path.Ext(name), ".pdf") {
+		name += ".pdf"
+	}
+
+	pdf, err := j.Renderer.Render(ctx, doc.Template, doc.Data)
+	if err != nil {
+		return err
+	}
+	log.Printf("PDF: rendered template=%s bytes=%d", doc.Template, len(pdf))
+	return j.Exports.Deliver(ctx, export.File{
+		Name: name,
+		Write: func(w io.Writer) error {
+			_, err := w.Write(pdf)
+			return err
+		},
+	}, req)
+}
@@ -0,0 +1,187 @@
+package pdf_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/blob"
+	"github.com/johnjansen/buffkit/export"
+	"github.com/johnjansen/buffkit/pdf"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePDF "converts" HTML by prefixing it with a PDF header.
+var fakePDF = pdf.BackendFunc(func(ctx context.Context, html []byte, w io.Writer) error {
+	_, err := w.Write(append([]byte("%PDF-"), html...))
+	return err
+})
+
+var templates = fstest.MapFS{
+	"invoices/show.plush.html": {Data: []byte(`<h1>Invoice <%= number %></h1>`)},
+	"layouts/pdf.plush.html":   {Data: []byte(`<html><%= yield %></html>`)},
+}
+
+func TestRenderer(t *testing.T) {
+	ctx := context.Background()
+	r := &pdf.Renderer{Backend: fakePDF, Templates: templates, Layout: "layouts/pdf.plush.html"}
+
+	b, err := r.Render(ctx, "invoices/show.plush.html", map[string]any{"number": 42})
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-<html><h1>Invoice 42</h1></html>", string(b))
+
+	_, err = r.Render(ctx, "invoices/missing.plush.html", nil)
+	assert.Error(t, err)
+
+	failed := errors.New("out of paper")
+	r = &pdf.Renderer{Templates: templates, Backend: pdf.BackendFunc(func(context.Context, []byte, io.Writer) error { return failed })}
+	_, err = r.Render(ctx, "invoices/show.plush.html", map[string]any{"number": 42})
+	assert.ErrorIs(t, err, failed)
+
+	_, err = (&pdf.Renderer{Templates: templates}).Render(ctx, "invoices/show.plush.html", nil)
+	assert.ErrorIs(t, err, pdf.ErrNoBackend)
+}
+
+func TestSave(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewMemoryStore()
+	r := &pdf.Renderer{Backend: fakePDF, Templates: templates}
+	require.NoError(t, r.Save(ctx, store, "invoices/42.pdf", "invoices/show.plush.html", map[string]any{"number": 42}))
+
+	body, info, err := store.Get(ctx, "invoices/42.pdf")
+	require.NoError(t, err)
+	defer body.Close()
+	b, _ := io.ReadAll(body)
+	assert.Equal(t, "%PDF-<h1>Invoice 42</h1>", string(b))
+	assert.Equal(t, "application/pdf", info.ContentType)
+
+	assert.Error(t, r.Save(ctx, store, "../42.pdf", "invoices/show.plush.html", map[string]any{"number": 42}))
+}
+
+func TestDisposition(t *testing.T) {
+	assert.Equal(t, "inline", pdf.Disposition{}.Header())
+	assert.Equal(t, "inline; filename=invoice-42.pdf", pdf.Inline("invoice-42.pdf").Header())
+	assert.Equal(t, "attachment; filename=invoice-42.pdf", pdf.Attachment("invoice-42.pdf").Header())
+	assert.Equal(t, `attachment; filename="report 2026.pdf"`, pdf.Attachment("report 2026.pdf").Header())
+}
+
+// script writes an executable shell script to a temporary directory.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	path := filepath.Join(t.TempDir(), "convert")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o700))
+	return path
+}
+
+func TestWkhtmltopdf(t *testing.T) {
+	ctx := context.Background()
+	// Echoes its arguments, then the HTML it was piped
+	backend := pdf.Wkhtmltopdf{Path: script(t, `echo "$@"; cat`)}
+	var out strings.Builder
+	require.NoError(t, backend.Convert(ctx, []byte("<h1>Hi</h1>"), &out))
+	assert.Equal(t, "--quiet - -\n<h1>Hi</h1>", out.String())
+
+	backend.Args = []string{"--page-size", "A4"}
+	out.Reset()
+	require.NoError(t, backend.Convert(ctx, nil, &out))
+	assert.Equal(t, "--page-size A4 - -\n", out.String())
+
+	backend = pdf.Wkhtmltopdf{Path: script(t, `echo "bad page" >&2; exit 1`)}
+	err := backend.Convert(ctx, nil, &out)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad page")
+}
+
+func TestChrome(t *testing.T) {
+	ctx := context.Background()
+	// Prints the page it was given to the --print-to-pdf file
+	backend := pdf.Chrome{Path: script(t, `
+for arg; do
+  case "$arg" in
+    --print-to-pdf=*) out="${arg#--print-to-pdf=}" ;;
+    file://*) page="${arg#file://}" ;;
+  esac
+done
+printf '%%PDF-' > "$out"
+cat "$page" >> "$out"
+`), Args: []string{"--no-sandbox"}}
+	var out strings.Builder
+	require.NoError(t, backend.Convert(ctx, []byte("<h1>Hi</h1>"), &out))
+	assert.Equal(t, "%PDF-<h1>Hi</h1>", out.String())
+
+	backend = pdf.Chrome{Path: script(t, `exit 0`)}
+	assert.Error(t, backend.Convert(ctx, nil, &out), "no output")
+}
+
+// fakeQueue records queued jobs instead of running them.
+type fakeQueue struct {
+	handlers map[string]func(context.Context, *asynq.Task) error
+	queued   []*asynq.Task
+}
+
+func (q *fakeQueue) HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error) {
+	if q.handlers == nil {
+		q.handlers = make(map[string]func(context.Context, *asynq.Task) error)
+	}
+	q.handlers[taskType] = handler
+}
+
+func (q *fakeQueue) EnqueueIn(delay time.Duration, taskType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	q.queued = append(q.queued, asynq.NewTask(taskType, data))
+	return nil
+}
+
+// fakePublisher records pushed events.
+type fakePublisher struct {
+	channel, html string
+}
+
+func (p *fakePublisher) BroadcastChannel(channel, eventName string, html []byte) {
+	p.channel, p.html = channel, string(html)
+}
+
+func TestJobs(t *testing.T) {
+	ctx := context.Background()
+	queue := &fakeQueue{}
+	publisher := &fakePublisher{}
+	exports := export.New(queue, secure.NewURLSigner([]byte("test-secret")))
+	exports.Publisher = publisher
+	exports.Dir = t.TempDir()
+	jobs := pdf.NewJobs(queue, &pdf.Renderer{Backend: fakePDF, Templates: templates}, exports)
+	assert.Contains(t, queue.handlers, pdf.Task)
+
+	doc := pdf.Document{Template: "invoices/show.plush.html", Data: map[string]any{"number": 42}, Filename: "invoice-42"}
+	assert.Error(t, jobs.Start(ctx, pdf.Document{}, export.Request{Channel: "user:1"}), "no template")
+	assert.Error(t, jobs.Start(ctx, doc, export.Request{}), "nowhere to send the link")
+	require.NoError(t, jobs.Start(ctx, doc, export.Request{Channel: "user:1"}))
+	require.Len(t, queue.queued, 1)
+	task := queue.queued[0]
+	require.NoError(t, queue.handlers[task.Type()](ctx, task))
+
+	assert.Equal(t, "user:1", publisher.channel)
+	assert.Contains(t, publisher.html, "Download invoice-42.pdf")
+	files, err := filepath.Glob(filepath.Join(exports.Dir, "*.pdf"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-<h1>Invoice 42</h1>", string(b))
+}
@@ -0,0 +1,59 @@
+package buffkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/pdf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderPDF(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/invoice", func(c buffalo.Context) error {
+		return RenderPDF(c, "invoices/show.plush.html", map[string]any{"number": 42})
+	})
+	app.GET("/invoice/download", func(c buffalo.Context) error {
+		return RenderPDF(c, "invoices/show.plush.html", map[string]any{"number": 42}, pdf.Attachment("invoice-42.pdf"))
+	})
+	app.GET("/missing", func(c buffalo.Context) error {
+		return RenderPDF(c, "invoices/missing.plush.html", nil, pdf.Attachment("missing.pdf"))
+	})
+
+	kit, err := Wire(app, Config{
+		AuthSecret: []byte("secret"),
+		PDF: pdf.BackendFunc(func(ctx context.Context, html []byte, w io.Writer) error {
+			_, err := w.Write(append([]byte("%PDF-"), html...))
+			return err
+		}),
+		PDFTemplates: fstest.MapFS{
+			"invoices/show.plush.html": {Data: []byte(`Invoice <%= number %> from <%= current_path %>`)},
+		},
+	})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/invoice", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "inline", rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "%PDF-Invoice 42 from /invoice/", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/invoice/download", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "attachment; filename=invoice-42.pdf", rec.Header().Get("Content-Disposition"))
+
+	// A failed render is an error page, not a download
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Disposition"))
+}
@@ -0,0 +1,139 @@
+// Package quota limits how much storage each user's uploads take up.
+// Each stored file is an item with a size; a user's usage is the total
+// of their items, and uploads that would take it over their limit are
+// refused:
+//
+//	if err := kit.Quota.Reserve(c, user.ID, "attachment:"+id, header.Size); err != nil {
+//	    return c.Error(http.StatusRequestEntityTooLarge, err) // a *quota.ExceededError
+//	}
+//	...
+//	kit.Quota.Release(ctx, user.ID, "attachment:"+id) // once the file is deleted
+//
+// Reserving an item again replaces its size, so an avatar that's
+// replaced is only counted once. Wire sets Config.StorageQuota's quota
+// on CSV imports and account avatars.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// ExceededError is returned by Reserve when an item doesn't fit in the
+// user's quota.
+type ExceededError struct {
+	Limit int64 // the user's quota
+	Used  int64 // what their other items take up
+	Size  int64 // the item's size
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota: %d bytes don't fit in %d of %d", e.Size, e.Limit-e.Used, e.Limit)
+}
+
+// PublicMessage says how much space is left, for the error page and
+// upload forms.
+func (e *ExceededError) PublicMessage() string {
+	left := e.Limit - e.Used
+	if left < 0 {
+		left = 0
+	}
+	return fmt.Sprintf("You don't have room for this upload. It's %s, and %s of your %s of storage is left.",
+		secure.FormatBytes(e.Size), secure.FormatBytes(left), secure.FormatBytes(e.Limit))
+}
+
+// Quota enforces per-user storage limits.
+type Quota struct {
+	Store Store
+
+	// Limit is each user's storage, in bytes. Zero doesn't limit it.
+	Limit int64
+
+	// LimitFor, when set, gives a user's limit instead of Limit, such as
+	// more for paid plans. Zero doesn't limit them.
+	LimitFor func(ctx context.Context, userID string) (int64, error)
+
+	// mu keeps a user's concurrent uploads in this process from both
+	// fitting in the room left for one.
+	mu sync.Mutex
+}
+
+// New creates a Quota giving each user limit bytes.
+func New(store Store, limit int64) *Quota {
+	return &Quota{Store: store, Limit: limit}
+}
+
+// Reserve records item, of size bytes, against userID's quota, or
+// returns an *ExceededError if it doesn't fit. An item already recorded
+// is replaced, so only the difference counts.
+func (q *Quota) Reserve(ctx context.Context, userID, item string, size int64) error {
+	if userID == "" {
+		return errors.New("quota: no user")
+	}
+	limit, err := q.limit(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if limit > 0 {
+		items, err := q.Store.Items(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("quota: %w", err)
+		}
+		var used int64
+		for name, n := range items {
+			if name != item {
+				used += n
+			}
+		}
+		if used+size > limit {
+			return &ExceededError{Limit: limit, Used: used, Size: size}
+		}
+	}
+	if err := q.Store.SetItem(ctx, userID, item, size); err != nil {
+		return fmt.Errorf("quota: %w", err)
+	}
+	return nil
+}
+
+// Release removes item from userID's usage, once it's deleted.
+func (q *Quota) Release(ctx context.Context, userID, item string) error {
+	if err := q.Store.DeleteItem(ctx, userID, item); err != nil {
+		return fmt.Errorf("quota: %w", err)
+	}
+	return nil
+}
+
+// Usage returns how much of their quota userID has used, and their
+// limit (zero when unlimited).
+func (q *Quota) Usage(ctx context.Context, userID string) (used, limit int64, err error) {
+	limit, err = q.limit(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	items, err := q.Store.Items(ctx, userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("quota: %w", err)
+	}
+	for _, n := range items {
+		used += n
+	}
+	return used, limit, nil
+}
+
+func (q *Quota) limit(ctx context.Context, userID string) (int64, error) {
+	if q.LimitFor == nil {
+		return q.Limit, nil
+	}
+	limit, err := q.LimitFor(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("quota: limit of %s: %w", userID, err)
+	}
+	return limit, nil
+}
@@ -0,0 +1,95 @@
+package quota_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/johnjansen/buffkit/quota"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserve(t *testing.T) {
+	ctx := context.Background()
+	q := quota.New(quota.NewMemoryStore(), 1000)
+
+	require.NoError(t, q.Reserve(ctx, "u1", "avatar", 600))
+	require.NoError(t, q.Reserve(ctx, "u1", "avatar", 900), "a replaced item only counts once")
+	require.NoError(t, q.Reserve(ctx, "u2", "avatar", 1000), "each user has their own quota")
+
+	err := q.Reserve(ctx, "u1", "file:1", 200)
+	var exceeded *quota.ExceededError
+	require.True(t, errors.As(err, &exceeded), "%v", err)
+	assert.Equal(t, quota.ExceededError{Limit: 1000, Used: 900, Size: 200}, *exceeded)
+	assert.Equal(t, "You don't have room for this upload. It's 200 bytes, and 100 bytes of your 1000 bytes of storage is left.", exceeded.PublicMessage())
+
+	used, limit, err := q.Usage(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(900), used)
+	assert.Equal(t, int64(1000), limit)
+
+	require.NoError(t, q.Release(ctx, "u1", "avatar"))
+	require.NoError(t, q.Release(ctx, "u1", "missing"))
+	require.NoError(t, q.Reserve(ctx, "u1", "file:1", 200))
+
+	assert.Error(t, q.Reserve(ctx, "", "file:2", 1))
+}
+
+func TestLimitFor(t *testing.T) {
+	ctx := context.Background()
+	q := quota.New(quota.NewMemoryStore(), 100)
+	q.LimitFor = func(ctx context.Context, userID string) (int64, error) {
+		switch userID {
+		case "pro":
+			return 10 << 20, nil
+		case "staff":
+			return 0, nil
+		}
+		return 100, nil
+	}
+
+	assert.NoError(t, q.Reserve(ctx, "pro", "big", 5<<20))
+	assert.NoError(t, q.Reserve(ctx, "staff", "huge", 1<<40), "zero is unlimited")
+	assert.Error(t, q.Reserve(ctx, "free", "big", 5<<20))
+}
+
+func TestStores(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	schema, err := os.ReadFile("../db/migrations/quota/20261017150000_create_storage_items.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for name, store := range map[string]quota.Store{
+		"memory": quota.NewMemoryStore(),
+		"sql":    quota.NewSQLStore(db, "sqlite"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, store.SetItem(ctx, "u1", "avatar", 10))
+			require.NoError(t, store.SetItem(ctx, "u1", "avatar", 20))
+			require.NoError(t, store.SetItem(ctx, "u1", "file:1", 5))
+			require.NoError(t, store.SetItem(ctx, "u2", "avatar", 7))
+
+			items, err := store.Items(ctx, "u1")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]int64{"avatar": 20, "file:1": 5}, items)
+
+			require.NoError(t, store.DeleteItem(ctx, "u1", "avatar"))
+			require.NoError(t, store.DeleteItem(ctx, "u1", "missing"))
+			items, err = store.Items(ctx, "u1")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]int64{"file:1": 5}, items)
+
+			items, err = store.Items(ctx, "nobody")
+			require.NoError(t, err)
+			assert.Empty(t, items)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// Store keeps the size of each user's items. MemoryStore suits tests and
+// development; SQLStore keeps them in the database.
+type Store interface {
+	// Items returns userID's items and their sizes.
+	Items(ctx context.Context, userID string) (map[string]int64, error)
+
+	// SetItem records item's size, replacing any it had.
+	SetItem(ctx context.Context, userID, item string, size int64) error
+
+	// DeleteItem removes item. Removing an unknown item isn't an error.
+	DeleteItem(ctx context.Context, userID, item string) error
+}
+
+// MemoryStore keeps item sizes in memory, for tests and development.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	items map[string]map[string]int64
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]map[string]int64)}
+}
+
+func (s *MemoryStore) Items(ctx context.Context, userID string) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make(map[string]int64, len(s.items[userID]))
+	for item, size := range s.items[userID] {
+		items[item] = size
+	}
+	return items, nil
+}
+
+func (s *MemoryStore) SetItem(ctx context.Context, userID, item string, size int64) error {
+	if err := readonly.Check("quota.SetItem"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.items[userID] == nil {
+		s.items[userID] = make(map[string]int64)
+	}
+	s.items[userID][item] = size
+	return nil
+}
+
+func (s *MemoryStore) DeleteItem(ctx context.Context, userID, item string) error {
+	if err := readonly.Check("quota.DeleteItem"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items[userID], item)
+	return nil
+}
+
+// SQLStore keeps item sizes in the storage_items table created by the
+// db/migrations/quota migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates a quota store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) Items(ctx context.Context, userID string) (map[string]int64, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect, "SELECT item, size FROM storage_items WHERE user_id = ?"), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[string]int64)
+	for rows.Next() {
+		var item string
+		var size int64
+		if err := rows.Scan(&item, &size); err != nil {
+			return nil, err
+		}
+		items[item] = size
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLStore) SetItem(ctx context.Context, userID, item string, size int64) error {
+	if err := readonly.Check("quota.SetItem"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM storage_items WHERE user_id = ? AND item = ?"), userID, item); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(s.dialect, "INSERT INTO storage_items (user_id, item, size) VALUES (?, ?, ?)"), userID, item, size); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteItem(ctx context.Context, userID, item string) error {
+	if err := readonly.Check("quota.DeleteItem"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM storage_items WHERE user_id = ? AND item = ?"), userID, item)
+	return err
+}
@@ -0,0 +1,258 @@
+// Package readonly puts an app in read-only mode, for maintenance or
+// while a database replica is promoted. Writes to Buffkit's stores fail
+// with an *Error matching ErrReadOnly, reads carry on, and pages can
+// show a banner:
+//
+//	err := kit.ReadOnly.Enable(ctx, "Upgrading the database, back by 10:00 UTC")
+//
+// Stores check the process-wide Default switch, which Wire configures.
+// With Redis, the switch is shared: Enable and Disable in one process
+// reach every web server and worker within Interval.
+//
+// Counters and idempotency keys keep working, as they hold no app data,
+// and so do sign-ins and sign-outs. Stores of the app's own can call
+// Check before writing.
+package readonly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrReadOnly matches the errors of writes refused in read-only mode.
+var ErrReadOnly = errors.New("read-only mode")
+
+// Error is a write refused in read-only mode.
+type Error struct {
+	// Op is the refused write, e.g. "shortlinks.Create".
+	Op string
+
+	// Reason is the reason given when read-only mode was enabled.
+	Reason string
+}
+
+func (e *Error) Error() string {
+	if e.Reason == "" {
+		return e.Op + ": read-only mode"
+	}
+	return e.Op + ": read-only mode: " + e.Reason
+}
+
+// Is makes errors.Is(err, ErrReadOnly) match.
+func (e *Error) Is(target error) bool {
+	return target == ErrReadOnly
+}
+
+// State is whether a Switch is on, why, and since when.
+type State struct {
+	On     bool      `json:"on"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+}
+
+// Key is the Redis key a shared Switch keeps its State in.
+const Key = "buffkit:readonly"
+
+// DefaultInterval is how often Watch reads a shared Switch's State.
+const DefaultInterval = 5 * time.Second
+
+// DefaultMessage is the banner's text when no reason was given.
+const DefaultMessage = "The site is read-only for maintenance, so changes can't be saved right now."
+
+// Switch turns read-only mode on and off. The zero value is off and
+// local to the process.
+type Switch struct {
+	// Redis shares the switch between processes. Enable and Disable
+	// write Key, and Refresh and Watch read it. Nil keeps the switch to
+	// this process.
+	Redis redis.UniversalClient
+
+	// Interval is how often Watch reads Key. Defaults to
+	// DefaultInterval.
+	Interval time.Duration
+
+	// Clock stamps State.Since. Defaults to clock.Real.
+	Clock clock.Clock
+
+	mu    sync.RWMutex
+	state State
+}
+
+// New creates a Switch that is off.
+func New() *Switch {
+	return &Switch{}
+}
+
+// Default is the switch Buffkit's stores check.
+var Default = New()
+
+// Check returns an *Error for op when Default is on.
+func Check(op string) error {
+	return Default.Check(op)
+}
+
+// Check returns an *Error for op when s is on, and nil otherwise or when
+// s is nil.
+func (s *Switch) Check(op string) error {
+	if s == nil {
+		return nil
+	}
+	state := s.State()
+	if !state.On {
+		return nil
+	}
+	return &Error{Op: op, Reason: state.Reason}
+}
+
+// State returns the switch's state as this process last saw it.
+func (s *Switch) State() State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// Enabled reports whether read-only mode is on.
+func (s *Switch) Enabled() bool {
+	return s.State().On
+}
+
+// Enable turns read-only mode on, with a reason shown in the banner and
+// errors.
+func (s *Switch) Enable(ctx context.Context, reason string) error {
+	return s.set(ctx, State{On: true, Reason: reason, Since: clock.Or(s.Clock).Now()})
+}
+
+// Disable turns read-only mode off.
+func (s *Switch) Disable(ctx context.Context) error {
+	return s.set(ctx, State{})
+}
+
+func (s *Switch) set(ctx context.Context, state State) error {
+	if s.Redis != nil {
+		var err error
+		if state.On {
+			var data []byte
+			data, err = json.Marshal(state)
+			if err == nil {
+				err = s.Redis.Set(ctx, Key, data, 0).Err()
+			}
+		} else {
+			err = s.Redis.Del(ctx, Key).Err()
+		}
+		if err != nil {
+			return fmt.Errorf("readonly: %w", err)
+		}
+	}
+	s.store(state)
+	return nil
+}
+
+func (s *Switch) store(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state.On != s.state.On {
+		if state.On {
+			log.Printf("ReadOnly: on reason=%q", state.Reason)
+		} else {
+			log.Printf("ReadOnly: off")
+		}
+	}
+	s.state = state
+}
+
+// Reset turns the switch off in this process only, without touching
+// Redis.
+func (s *Switch) Reset() {
+	s.store(State{})
+}
+
+// Refresh reads the shared state from Redis. It does nothing when Redis
+// isn't set.
+func (s *Switch) Refresh(ctx context.Context) error {
+	if s.Redis == nil {
+		return nil
+	}
+	data, err := s.Redis.Get(ctx, Key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		s.store(State{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("readonly: %w", err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("readonly: bad state in %s: %w", Key, err)
+	}
+	s.store(state)
+	return nil
+}
+
+// Watch refreshes the shared state every Interval until ctx is done.
+// Failed reads keep the last state.
+func (s *Switch) Watch(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("ReadOnly: refresh error=%v", err)
+			}
+		}
+	}
+}
+
+// Middleware answers 503 Service Unavailable when a handler fails
+// because of read-only mode.
+func (s *Switch) Middleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		err := next(c)
+		if err == nil || !errors.Is(err, ErrReadOnly) {
+			return err
+		}
+		c.Response().Header().Set("Retry-After", "60")
+		return c.Error(http.StatusServiceUnavailable, err)
+	}
+}
+
+// BannerCSS sets the banner above the page with the theme tokens.
+const BannerCSS = `.bk-readonly { padding: 0.75rem 1rem; background: var(--bk-surface, #f4f4f5); color: var(--bk-text, #18181b); border-bottom: 2px solid var(--bk-danger, #dc2626); }`
+
+// Banner renders <bk-readonly-banner>, which Wire registers. It renders
+// nothing unless read-only mode is on, and then shows the reason given
+// to Enable, or its content, or DefaultMessage:
+//
+//	<bk-readonly-banner></bk-readonly-banner>
+func (s *Switch) Banner(attrs, slots map[string]string) ([]byte, error) {
+	state := s.State()
+	if !state.On {
+		return nil, nil
+	}
+	message := html.EscapeString(state.Reason)
+	if message == "" {
+		message = slots["default"]
+	}
+	if strings.TrimSpace(message) == "" {
+		message = html.EscapeString(DefaultMessage)
+	}
+	return []byte(`<div class="bk-readonly" role="status">` + message + `</div>`), nil
+}
@@ -0,0 +1,154 @@
+package readonly_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/shortlinks"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwitch(t *testing.T) {
+	ctx := context.Background()
+	s := readonly.New()
+	assert.NoError(t, s.Check("shortlinks.Create"))
+
+	require.NoError(t, s.Enable(ctx, "Upgrading the database"))
+	assert.True(t, s.Enabled())
+	assert.False(t, s.State().Since.IsZero())
+	err := s.Check("shortlinks.Create")
+	require.ErrorIs(t, err, readonly.ErrReadOnly)
+	var roErr *readonly.Error
+	require.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &roErr))
+	assert.Equal(t, "shortlinks.Create", roErr.Op)
+	assert.Equal(t, "shortlinks.Create: read-only mode: Upgrading the database", err.Error())
+
+	require.NoError(t, s.Disable(ctx))
+	assert.NoError(t, s.Check("shortlinks.Create"))
+
+	var none *readonly.Switch
+	assert.NoError(t, none.Check("shortlinks.Create"), "a nil switch never refuses")
+}
+
+func TestShared(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	shared := func() *readonly.Switch {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		s := readonly.New()
+		s.Redis = client
+		s.Interval = 10 * time.Millisecond
+		return s
+	}
+	web, worker := shared(), shared()
+
+	require.NoError(t, web.Enable(ctx, "Promoting the replica"))
+	assert.True(t, mr.Exists(readonly.Key))
+	assert.False(t, worker.Enabled(), "until it reads Redis")
+	require.NoError(t, worker.Refresh(ctx))
+	assert.Equal(t, "Promoting the replica", worker.State().Reason)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go worker.Watch(watchCtx)
+	require.NoError(t, web.Disable(ctx))
+	assert.Eventually(t, func() bool { return !worker.Enabled() }, time.Second, 5*time.Millisecond)
+
+	mr.Set(readonly.Key, "not json")
+	assert.Error(t, worker.Refresh(ctx))
+	assert.False(t, worker.Enabled(), "a bad state keeps the last one")
+}
+
+func TestBanner(t *testing.T) {
+	ctx := context.Background()
+	s := readonly.New()
+	out, err := s.Banner(nil, map[string]string{"default": "Back soon"})
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	require.NoError(t, s.Enable(ctx, ""))
+	out, _ = s.Banner(nil, map[string]string{"default": "Back <b>soon</b>"})
+	assert.Equal(t, `<div class="bk-readonly" role="status">Back <b>soon</b></div>`, string(out))
+	out, _ = s.Banner(nil, nil)
+	assert.Contains(t, string(out), html.EscapeString(readonly.DefaultMessage))
+
+	require.NoError(t, s.Enable(ctx, "Moving to <new> servers"))
+	out, _ = s.Banner(nil, map[string]string{"default": "Back soon"})
+	assert.Equal(t, `<div class="bk-readonly" role="status">Moving to &lt;new&gt; servers</div>`, string(out))
+}
+
+func TestMiddleware(t *testing.T) {
+	s := readonly.New()
+	require.NoError(t, s.Enable(context.Background(), ""))
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(s.Middleware)
+	app.POST("/notes", func(c buffalo.Context) error {
+		return fmt.Errorf("saving note: %w", s.Check("notes.Create"))
+	})
+	app.POST("/broken", func(c buffalo.Context) error {
+		return errors.New("disk on fire")
+	})
+
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/notes", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "60", res.Header().Get("Retry-After"))
+
+	res = httptest.NewRecorder()
+	app.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/broken", nil))
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+}
+
+// htmlString renders a Plush string as HTML, so its components expand.
+type htmlString struct{ render.Renderer }
+
+func (htmlString) ContentType() string { return "text/html; charset=utf-8" }
+
+func TestWire(t *testing.T) {
+	t.Cleanup(readonly.Default.Reset)
+	var app *buffkittest.App
+	app = buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{ReadOnly: true, Shortlinks: true},
+		Jobs:   true,
+		Setup: func(a *buffalo.App) {
+			a.GET("/home", func(c buffalo.Context) error {
+				return c.Render(http.StatusOK, htmlString{render.String(`<html><body><bk-readonly-banner></bk-readonly-banner><h1>Home</h1></body></html>`)})
+			})
+			a.GET("/shorten", func(c buffalo.Context) error {
+				link, err := app.Kit.Shortlinks.Create(c, "https://example.com/spring", shortlinks.Options{})
+				if err != nil {
+					return err
+				}
+				return c.Render(http.StatusOK, render.String(link.Code))
+			})
+		},
+	})
+	require.Same(t, readonly.Default, app.Kit.ReadOnly)
+	assert.True(t, app.Redis.Exists(readonly.Key), "Config.ReadOnly turns it on for every process")
+
+	res := app.Client().Get("/home")
+	require.Equal(t, http.StatusOK, res.Code)
+	buffkittest.AssertElement(t, res.Body.String(), "div", "class", "bk-readonly")
+	assert.Equal(t, http.StatusServiceUnavailable, app.Client().Get("/shorten").Code)
+
+	require.NoError(t, app.Kit.ReadOnly.Disable(context.Background()))
+	assert.False(t, app.Redis.Exists(readonly.Key))
+	res = app.Client().Get("/home")
+	buffkittest.AssertNoElement(t, res.Body.String(), "div", "class", "bk-readonly")
+	assert.Equal(t, http.StatusOK, app.Client().Get("/shorten").Code)
+}
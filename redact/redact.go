@@ -0,0 +1,349 @@
+// Package redact masks personal data and secrets before they're written
+// somewhere they'd outlive the request: logs, error reports, job history
+// and audit details. Emails, bearer tokens, JWTs, passwords in URLs and
+// the values of fields named like secrets are masked out of the box:
+//
+//	redact.String("reset for ada@example.com?token=abc")
+//	// "reset for ***@example.com?token=[REDACTED]"
+//
+// Wire installs a Redactor on the app's logger and the standard library
+// logger, and job history stores redacted errors. Structs, such as job
+// payloads and form bindings, say how their fields are treated with a
+// redact tag:
+//
+//	type InvitePayload struct {
+//	    Email   string `json:"email"`                 // masked as an email
+//	    Message string `json:"message" redact:"mask"` // always masked
+//	    TeamID  string `json:"team_id" redact:"keep"` // never masked
+//	    Avatar  []byte `json:"avatar" redact:"omit"`  // left out
+//	}
+package redact
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// Mask replaces redacted values.
+const Mask = "[REDACTED]"
+
+// DefaultFields are the field names whose values are always masked. A
+// field matches when its name, lower-cased without "_", "-" and ".",
+// contains one of them, so "password_confirmation" and "X-Api-Key" match.
+var DefaultFields = []string{
+	"password", "passwd", "secret", "token", "apikey", "authorization",
+	"cookie", "session", "csrf", "otp", "ssn", "creditcard", "cardnumber",
+	"cvv", "privatekey",
+}
+
+var (
+	emailPattern    = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9\-]+\.)+[A-Za-z]{2,}`)
+	userinfoPattern = regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`)
+	bearerPattern   = regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9\-._~+/]{8,}=*`)
+	jwtPattern      = regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	paramPattern    = regexp.MustCompile(`([A-Za-z0-9_.\-]+)=([^&\s;,"']+)`)
+	jsonPattern     = regexp.MustCompile(`"([A-Za-z0-9_.\-]+)"(\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// Redactor masks sensitive values. The zero value masks emails, tokens
+// and DefaultFields; Fields and Patterns add to them.
+type Redactor struct {
+	// Fields are more field names whose values are masked, matched like
+	// DefaultFields.
+	Fields []string
+
+	// Patterns are masked wherever they appear in text, e.g. account
+	// numbers: regexp.MustCompile(`\bACC-\d{8}\b`).
+	Patterns []*regexp.Regexp
+}
+
+// Sensitive reports whether values of the field called name are masked.
+func (r *Redactor) Sensitive(name string) bool {
+	key := normalize(name)
+	if key == "" {
+		return false
+	}
+	for _, field := range DefaultFields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	for _, field := range r.Fields {
+		if f := normalize(field); f != "" && strings.Contains(key, f) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(name string) string {
+	return strings.NewReplacer("_", "", "-", "", ".", "").Replace(strings.ToLower(name))
+}
+
+// String masks the sensitive parts of s: emails keep their domain, and
+// tokens, passwords in URLs, values of sensitive parameters and matches
+// of Patterns are replaced with Mask.
+func (r *Redactor) String(s string) string {
+	if s == "" {
+		return s
+	}
+	s = userinfoPattern.ReplaceAllString(s, "${1}"+Mask+"@")
+	s = bearerPattern.ReplaceAllString(s, "$1 "+Mask)
+	s = jwtPattern.ReplaceAllString(s, Mask)
+	s = jsonPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := jsonPattern.FindStringSubmatch(m)
+		if !r.Sensitive(sub[1]) {
+			return m
+		}
+		return `"` + sub[1] + `"` + sub[2] + `"` + Mask + `"`
+	})
+	s = paramPattern.ReplaceAllStringFunc(s, func(m string) string {
+		key, _, _ := strings.Cut(m, "=")
+		if !r.Sensitive(key) {
+			return m
+		}
+		return key + "=" + Mask
+	})
+	s = emailPattern.ReplaceAllStringFunc(s, func(m string) string {
+		_, domain, _ := strings.Cut(m, "@")
+		return "***@" + domain
+	})
+	for _, p := range r.Patterns {
+		s = p.ReplaceAllString(s, Mask)
+	}
+	return s
+}
+
+// Field returns v redacted as the value of the field called name: all
+// of it is masked when the name is sensitive, otherwise it goes through
+// Value.
+func (r *Redactor) Field(name string, v any) any {
+	if r.Sensitive(name) && v != nil {
+		return Mask
+	}
+	return r.Value(v)
+}
+
+// Value returns a redacted copy of v, for logging or storing it. Strings
+// and errors go through String. Maps, slices and structs are copied with
+// each entry redacted; structs become maps keyed by their json (or form)
+// names and honour redact tags. Other values are returned as they are.
+func (r *Redactor) Value(v any) any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return r.String(v)
+	case error:
+		return r.String(v.Error())
+	case fmt.Stringer:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Struct {
+			return r.String(v.String()) // e.g. time.Time
+		}
+	}
+	return r.value(reflect.ValueOf(v))
+}
+
+func (r *Redactor) value(rv reflect.Value) any {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return r.Value(rv.Elem().Interface())
+	case reflect.String:
+		return r.String(rv.String())
+	case reflect.Map:
+		out := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			out[key] = r.Field(key, iter.Value().Interface())
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Interface() // []byte
+		}
+		out := make([]any, rv.Len())
+		for i := range out {
+			out[i] = r.Value(rv.Index(i).Interface())
+		}
+		return out
+	case reflect.Struct:
+		return r.structValue(rv)
+	}
+	if rv.IsValid() && rv.CanInterface() {
+		return rv.Interface()
+	}
+	return nil
+}
+
+func (r *Redactor) structValue(rv reflect.Value) map[string]any {
+	out := map[string]any{}
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := fieldName(f)
+		if name == "" {
+			continue
+		}
+		v := rv.Field(i).Interface()
+		switch f.Tag.Get("redact") {
+		case "omit":
+		case "mask":
+			out[name] = Mask
+		case "keep":
+			out[name] = v
+		default:
+			out[name] = r.Field(name, v)
+		}
+	}
+	return out
+}
+
+// fieldName is f's json name, else its form name, else its Go name. It
+// is empty for fields left out with json:"-".
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		tag, ok := f.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// Error returns err with its message redacted. errors.Is and errors.As
+// still see the original error.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{msg: r.String(err.Error()), err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Writer returns a writer that redacts what's written to w, for the
+// standard library logger: log.SetOutput(r.Writer(os.Stderr)). Each
+// write should be whole lines, as the log package's are.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if rw, ok := w.(*writer); ok {
+		w = rw.w
+	}
+	return &writer{r: r, w: w}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Logger returns l with its messages and fields redacted. Wire wraps the
+// app's logger with it.
+func (r *Redactor) Logger(l buffalo.Logger) buffalo.Logger {
+	if rl, ok := l.(*logger); ok {
+		l = rl.l
+	}
+	return &logger{r: r, l: l}
+}
+
+type logger struct {
+	r *Redactor
+	l buffalo.Logger
+}
+
+func (l *logger) WithField(key string, v any) buffalo.Logger {
+	return &logger{r: l.r, l: l.l.WithField(key, l.r.Field(key, v))}
+}
+
+func (l *logger) WithFields(fields map[string]any) buffalo.Logger {
+	redacted := make(map[string]any, len(fields))
+	for k, v := range fields {
+		redacted[k] = l.r.Field(k, v)
+	}
+	return &logger{r: l.r, l: l.l.WithFields(redacted)}
+}
+
+func (l *logger) sprint(args []any) string { return l.r.String(fmt.Sprint(args...)) }
+func (l *logger) sprintf(f string, args []any) string {
+	return l.r.String(fmt.Sprintf(f, args...))
+}
+
+func (l *logger) Debugf(f string, args ...any) { l.l.Debug(l.sprintf(f, args)) }
+func (l *logger) Infof(f string, args ...any)  { l.l.Info(l.sprintf(f, args)) }
+func (l *logger) Printf(f string, args ...any) { l.l.Printf("%s", l.sprintf(f, args)) }
+func (l *logger) Warnf(f string, args ...any)  { l.l.Warn(l.sprintf(f, args)) }
+func (l *logger) Errorf(f string, args ...any) { l.l.Error(l.sprintf(f, args)) }
+func (l *logger) Fatalf(f string, args ...any) { l.l.Fatal(l.sprintf(f, args)) }
+func (l *logger) Debug(args ...any)            { l.l.Debug(l.sprint(args)) }
+func (l *logger) Info(args ...any)             { l.l.Info(l.sprint(args)) }
+func (l *logger) Warn(args ...any)             { l.l.Warn(l.sprint(args)) }
+func (l *logger) Error(args ...any)            { l.l.Error(l.sprint(args)) }
+func (l *logger) Fatal(args ...any)            { l.l.Fatal(l.sprint(args)) }
+func (l *logger) Panic(args ...any)            { l.l.Panic(l.sprint(args)) }
+
+var (
+	mu      sync.RWMutex
+	current = &Redactor{}
+)
+
+// Use sets the Redactor the package functions use. Wire calls it with
+// Config.Redact. Nil restores the defaults.
+func Use(r *Redactor) {
+	mu.Lock()
+	defer mu.Unlock()
+	if r == nil {
+		r = &Redactor{}
+	}
+	current = r
+}
+
+// Current returns the Redactor set by Use.
+func Current() *Redactor {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// String redacts s with the current Redactor.
+func String(s string) string { return Current().String(s) }
+
+// Value redacts v with the current Redactor. Use it for audit details
+// and the context sent with error reports:
+//
+//	c.Logger().WithField("order", redact.Value(order)).Error(err)
+func Value(v any) any { return Current().Value(v) }
+
+// Error redacts err's message with the current Redactor.
+func Error(err error) error { return Current().Error(err) }
@@ -0,0 +1,120 @@
+package redact_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/logger"
+	"github.com/johnjansen/buffkit/redact"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString(t *testing.T) {
+	r := &redact.Redactor{}
+	cases := map[string]string{
+		"welcome ada@example.com":                        "welcome ***@example.com",
+		"GET /reset?token=abc123&page=2":                 "GET /reset?token=[REDACTED]&page=2",
+		"Authorization: Bearer sk_live_abcdefgh":         "Authorization: Bearer [REDACTED]",
+		"postgres://app:hunter2@db:5432/app":             "postgres://app:[REDACTED]@db:5432/app",
+		`{"email":"a@b.io","password":"hunter2"}`:        `{"email":"***@b.io","password":"[REDACTED]"}`,
+		"jwt eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig-x": "jwt [REDACTED]",
+		"processed 3 orders":                             "processed 3 orders",
+		"":                                               "",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, r.String(in), in)
+	}
+
+	r = &redact.Redactor{Fields: []string{"iban"}, Patterns: []*regexp.Regexp{regexp.MustCompile(`\bACC-\d{8}\b`)}}
+	assert.Equal(t, "account [REDACTED], iban=[REDACTED]", r.String("account ACC-12345678, iban=GB33BUKB"))
+	assert.True(t, r.Sensitive("Customer_IBAN"))
+	assert.True(t, r.Sensitive("X-Api-Key"))
+	assert.False(t, r.Sensitive("name"))
+}
+
+func TestValue(t *testing.T) {
+	type payload struct {
+		Email    string            `json:"email"`
+		Password string            `form:"password"`
+		Message  string            `json:"message" redact:"mask"`
+		TeamID   string            `json:"team_id" redact:"keep"`
+		Avatar   []byte            `json:"avatar" redact:"omit"`
+		Internal string            `json:"-"`
+		Count    int               `json:"count"`
+		At       time.Time         `json:"at"`
+		Headers  map[string]string `json:"headers"`
+		Tags     []string          `json:"tags"`
+		Next     *payload          `json:"next"`
+		secret   string
+	}
+	at := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	p := &payload{
+		Email: "ada@example.com", Password: "hunter2", Message: "hello", TeamID: "token=keep-me",
+		Avatar: []byte("png"), Internal: "x", Count: 3, At: at,
+		Headers: map[string]string{"Cookie": "s=1", "Accept": "text/html"},
+		Tags:    []string{"grace@example.com"},
+		secret:  "unexported",
+	}
+
+	r := &redact.Redactor{}
+	assert.Equal(t, map[string]any{
+		"email":    "***@example.com",
+		"password": redact.Mask,
+		"message":  redact.Mask,
+		"team_id":  "token=keep-me",
+		"count":    3,
+		"at":       at.String(),
+		"headers":  map[string]any{"Cookie": redact.Mask, "Accept": "text/html"},
+		"tags":     []any{"***@example.com"},
+		"next":     nil,
+	}, r.Value(p))
+
+	assert.Equal(t, redact.Mask, r.Field("api_token", 42))
+	assert.Nil(t, r.Field("password", nil))
+	assert.Equal(t, "failed for ***@example.com", r.Value(errors.New("failed for ada@example.com")))
+}
+
+func TestError(t *testing.T) {
+	err := redact.Error(&fs.PathError{Op: "open", Path: "/users/ada@example.com", Err: fs.ErrNotExist})
+	assert.Equal(t, "open /users/***@example.com: file does not exist", err.Error())
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Nil(t, redact.Error(nil))
+}
+
+func TestLogging(t *testing.T) {
+	r := &redact.Redactor{}
+
+	var buf bytes.Buffer
+	l := log.New(r.Writer(&buf), "", 0)
+	l.Printf("sent to %s", "ada@example.com")
+	assert.Equal(t, "sent to ***@example.com\n", buf.String())
+
+	buf.Reset()
+	base := logrus.New()
+	base.SetOutput(&buf)
+	base.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	fl := r.Logger(logger.Logrus{FieldLogger: base})
+	fl.WithField("password", "hunter2").WithFields(map[string]any{"email": "ada@example.com"}).Errorf("login failed for %s", "ada@example.com")
+	out := buf.String()
+	assert.NotContains(t, out, "hunter2")
+	assert.NotContains(t, out, "ada@")
+	assert.Contains(t, out, "login failed for ***@example.com")
+
+	// Wrapping twice doesn't redact twice
+	assert.Equal(t, r.Logger(fl), r.Logger(r.Logger(fl)))
+}
+
+func TestUse(t *testing.T) {
+	t.Cleanup(func() { redact.Use(nil) })
+	redact.Use(&redact.Redactor{Fields: []string{"nickname"}})
+	assert.Equal(t, map[string]any{"nickname": redact.Mask}, redact.Value(map[string]string{"nickname": "Ada"}))
+	redact.Use(nil)
+	assert.Equal(t, "Ada", redact.String("Ada"))
+	assert.NotNil(t, redact.Current())
+}
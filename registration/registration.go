@@ -0,0 +1,340 @@
+// Package registration adds the page where visitors create an account,
+// and decides who may use it:
+//
+//   - Open lets anyone register.
+//   - InviteOnly only lets in visitors holding an invitation link. Each
+//     link is signed, expires, and registers one user.
+//   - Closed mounts no registration page at all.
+//
+// Wire mounts it at /register (under MountPath and AuthPath) according
+// to Config.RegistrationMode. Admins create invitations from code or
+// with the buffkit:invite task:
+//
+//	link, err := kit.Registration.InviteURL("ada@example.com") // just the link
+//	link, err = kit.Registration.Invite(ctx, "ada@example.com") // and email it
+//
+// The page renders views.PageRegister, so apps can restyle it like
+// Buffkit's other pages.
+package registration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/account"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// Mode says who may register.
+type Mode string
+
+// Registration modes for Config.RegistrationMode.
+const (
+	Open       Mode = "open"
+	InviteOnly Mode = "invite"
+	Closed     Mode = "closed"
+)
+
+// Valid reports whether m is one of the modes above.
+func (m Mode) Valid() bool {
+	switch m {
+	case Open, InviteOnly, Closed:
+		return true
+	}
+	return false
+}
+
+// DefaultInviteTTL is how long an invitation link stays valid.
+const DefaultInviteTTL = 7 * 24 * time.Hour
+
+const maxDisplayNameLength = 100
+
+var (
+	// ErrInvitationRequired is returned when registering without an
+	// invitation in InviteOnly mode.
+	ErrInvitationRequired = errors.New("registration: an invitation is required to register")
+
+	// ErrClosed is returned when inviting while registration is closed.
+	ErrClosed = errors.New("registration: registration is closed")
+)
+
+// Registration serves the registration page for users in Store.
+type Registration struct {
+	Store  auth.UserStore
+	Sender mail.Sender
+
+	// Signer signs invitation links.
+	Signer *secure.URLSigner
+
+	// Mode says who may register. Defaults to Open.
+	Mode Mode
+
+	// Path is where Mount puts the page. Defaults to "/register".
+	Path string
+
+	// BaseURL is the absolute URL of the app, e.g.
+	// "https://app.example.com", for invitation links. Invitations are
+	// usually created outside a request, so there's no host to go on.
+	BaseURL string
+
+	// InviteTTL is how long invitation links stay valid. Defaults to
+	// DefaultInviteTTL.
+	InviteTTL time.Duration
+
+	// Clock sets invitation expiry and records when they're used.
+	// Defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// New creates an open Registration with default settings.
+func New(store auth.UserStore, sender mail.Sender, signer *secure.URLSigner) *Registration {
+	return &Registration{
+		Store:     store,
+		Sender:    sender,
+		Signer:    signer,
+		Mode:      Open,
+		Path:      "/register",
+		InviteTTL: DefaultInviteTTL,
+	}
+}
+
+// Routes lists the method and path of every route Mount adds; none when
+// registration is closed.
+func (r *Registration) Routes() [][2]string {
+	if r.Mode == Closed {
+		return nil
+	}
+	return [][2]string{
+		{http.MethodGet, r.Path},
+		{http.MethodPost, r.Path},
+	}
+}
+
+// Mount adds the registration routes to app.
+func (r *Registration) Mount(app *buffalo.App) {
+	if r.Mode == Closed {
+		return
+	}
+	app.GET(r.Path, r.Show)
+	app.POST(r.Path, r.Register)
+}
+
+// InviteURL returns a signed link that registers one user. With an
+// email, that address is the one registered; with none, the invitee
+// picks it. The link is relative when BaseURL is empty.
+func (r *Registration) InviteURL(email string) (string, error) {
+	if r.Mode == Closed {
+		return "", ErrClosed
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("registration: invitation id: %w", err)
+	}
+	claims := map[string]string{"invite": hex.EncodeToString(id)}
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		claims["email"] = email
+	}
+
+	ttl := r.InviteTTL
+	if ttl <= 0 {
+		ttl = DefaultInviteTTL
+	}
+	link, err := r.Signer.Sign(r.Path, clock.Or(r.Clock).Now().Add(ttl), claims)
+	if err != nil {
+		return "", fmt.Errorf("registration: sign invitation: %w", err)
+	}
+	return strings.TrimSuffix(r.BaseURL, "/") + link, nil
+}
+
+// Invite emails email an invitation link and returns the link.
+func (r *Registration) Invite(ctx context.Context, email string) (string, error) {
+	if !strings.Contains(email, "@") {
+		return "", fmt.Errorf("registration: invalid email %q", email)
+	}
+	if r.BaseURL == "" {
+		return "", errors.New("registration: BaseURL is needed to email invitations")
+	}
+	link, err := r.InviteURL(email)
+	if err != nil {
+		return "", err
+	}
+
+	err = r.Sender.Send(ctx, mail.Message{
+		To:      strings.ToLower(strings.TrimSpace(email)),
+		Subject: "You've been invited to create an account",
+		Text: "You've been invited to create an account. Register by opening:\n\n" + link + "\n\n" +
+			"If you weren't expecting this invitation, you can ignore this email.\n",
+		HTML: `<p>You've been invited to create an account.</p><p><a href="` + html.EscapeString(link) + `">Register</a></p>` +
+			`<p>If you weren't expecting this invitation, you can ignore this email.</p>`,
+	})
+	if err != nil {
+		return link, fmt.Errorf("registration: send invitation: %w", err)
+	}
+	return link, nil
+}
+
+// invitation is a verified invitation from the request URL.
+type invitation struct {
+	ID    string
+	Email string
+}
+
+// invitation verifies the invitation the request carries, which may be
+// nil unless the mode is InviteOnly. On error, status is the response
+// to give.
+func (r *Registration) invitation(c buffalo.Context) (inv *invitation, status int, err error) {
+	if c.Request().URL.Query().Get("invite") == "" {
+		if r.Mode == InviteOnly {
+			return nil, http.StatusForbidden, ErrInvitationRequired
+		}
+		return nil, 0, nil
+	}
+
+	claims, err := r.Signer.Verify(c.Request().URL)
+	if errors.Is(err, secure.ErrExpiredSignature) {
+		return nil, http.StatusGone, err
+	}
+	if err != nil {
+		return nil, http.StatusForbidden, err
+	}
+
+	store, ok := r.Store.(auth.InvitationStore)
+	if !ok {
+		return nil, http.StatusInternalServerError, fmt.Errorf("registration: invitations need an auth.InvitationStore, got %T", r.Store)
+	}
+	used, err := store.InvitationUsed(c, claims["invite"])
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if used {
+		return nil, http.StatusGone, auth.ErrInvitationUsed
+	}
+	return &invitation{ID: claims["invite"], Email: claims["email"]}, 0, nil
+}
+
+// Show renders the registration form.
+func (r *Registration) Show(c buffalo.Context) error {
+	inv, status, err := r.invitation(c)
+	if err != nil {
+		return c.Error(status, err)
+	}
+	data := r.data(c, inv)
+	if inv != nil {
+		data["email"] = inv.Email
+	}
+	return views.Render(c, http.StatusOK, views.PageRegister, data)
+}
+
+// Register creates the user, records the invitation as used, and logs
+// them in the way LoginHandler does.
+func (r *Registration) Register(c buffalo.Context) error {
+	inv, status, err := r.invitation(c)
+	if err != nil {
+		return c.Error(status, err)
+	}
+
+	req := c.Request()
+	email := strings.ToLower(strings.TrimSpace(req.FormValue("email")))
+	if inv != nil && inv.Email != "" {
+		email = inv.Email
+	}
+	name := strings.TrimSpace(req.FormValue("display_name"))
+	usernames := auth.CurrentLoginIdentifier().AcceptsUsername()
+	username := ""
+	if usernames {
+		username = auth.NormalizeUsername(req.FormValue("username"))
+	}
+	password := req.FormValue("password")
+
+	data := r.data(c, inv)
+	data["email"], data["display_name"], data["username"] = email, name, username
+	fail := func(msg string) error {
+		data["errors"] = []string{msg}
+		return views.Render(c, http.StatusUnprocessableEntity, views.PageRegister, data)
+	}
+
+	switch {
+	case !strings.Contains(email, "@"):
+		return fail("Enter a valid email address")
+	case len(name) > maxDisplayNameLength:
+		return fail(fmt.Sprintf("Name must be at most %d characters", maxDisplayNameLength))
+	case len(password) < account.MinPasswordLength:
+		return fail(fmt.Sprintf("Password must be at least %d characters", account.MinPasswordLength))
+	case password != req.FormValue("password_confirmation"):
+		return fail("Passwords don't match")
+	}
+	if usernames {
+		if err := auth.ValidateUsername(username); err != nil {
+			msg := err.Error()
+			return fail(strings.ToUpper(msg[:1]) + msg[1:])
+		}
+		store, ok := r.Store.(auth.UsernameStore)
+		if !ok {
+			return c.Error(http.StatusInternalServerError, fmt.Errorf("registration: usernames need an auth.UsernameStore, got %T", r.Store))
+		}
+		if taken, err := store.ExistsUsername(c, username); err != nil {
+			return c.Error(http.StatusInternalServerError, err)
+		} else if taken {
+			return fail("That username is already taken")
+		}
+	}
+	if taken, err := r.Store.ExistsEmail(c, email); err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	} else if taken {
+		return fail("That email address is already registered")
+	}
+
+	digest, err := auth.HashPassword(password)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	user := &auth.User{Email: email, DisplayName: name, Username: username, PasswordDigest: digest, IsActive: true}
+	now := clock.Or(r.Clock).Now()
+	if inv != nil && inv.Email != "" {
+		// The link was mailed to this address, so it's theirs
+		user.EmailVerifiedAt = &now
+	}
+	if inv != nil {
+		// The invitation is used as the user is created, so a concurrent
+		// registration with the same link creates nobody
+		err = r.Store.(auth.InvitationStore).CreateInvited(c, user, inv.ID, now)
+	} else {
+		err = r.Store.Create(c, user)
+	}
+	if errors.Is(err, auth.ErrInvitationUsed) {
+		return c.Error(http.StatusGone, err)
+	}
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return auth.CompleteLogin(c, user, "")
+}
+
+// data is the page data shared by Show and Register. The form posts back
+// to the same URL, so the invitation's signature goes with it.
+func (r *Registration) data(c buffalo.Context, inv *invitation) map[string]any {
+	action := r.Path
+	if inv != nil {
+		action += "?" + c.Request().URL.RawQuery
+	}
+	return map[string]any{
+		"register_path": action,
+		"usernames":     auth.CurrentLoginIdentifier().AcceptsUsername(),
+		"invited":       inv != nil && inv.Email != "",
+	}
+}
+
+// compile-time check that the memory store can back invitations
+var _ auth.InvitationStore = (*auth.MemoryStore)(nil)
@@ -0,0 +1,150 @@
+package registration_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/registration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRegistrationApp(t *testing.T, mode registration.Mode) *buffkittest.App {
+	t.Helper()
+	return buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{RegistrationMode: mode, BaseURL: "https://app.example.com"},
+	})
+}
+
+func form(email string) url.Values {
+	return url.Values{
+		"email":                 {email},
+		"display_name":          {"Ada"},
+		"password":              {"secret123"},
+		"password_confirmation": {"secret123"},
+	}
+}
+
+// requestURI returns link without its scheme and host.
+func requestURI(t *testing.T, link string) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	return u.RequestURI()
+}
+
+func TestOpenRegistration(t *testing.T) {
+	app := newRegistrationApp(t, registration.Open)
+	client := app.Client()
+
+	res := client.Get("/register")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertElement(t, res.Body.String(), "input", "name", "email")
+
+	res = client.Post("/register", url.Values{"email": {"ada@example.com"}, "password": {"short"}, "password_confirmation": {"short"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "at least 8 characters")
+
+	res = client.Post("/register", form(" Ada@Example.com "))
+	buffkittest.AssertRedirect(t, res, "/")
+	user, err := app.Kit.AuthStore.ByEmail(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", user.DisplayName)
+	assert.Nil(t, user.EmailVerifiedAt)
+
+	res = app.Client().Post("/register", form("ada@example.com"))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "already registered")
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	app := newRegistrationApp(t, registration.InviteOnly)
+
+	assert.Equal(t, http.StatusForbidden, app.Client().Get("/register").Code)
+	assert.Equal(t, http.StatusForbidden, app.Client().Post("/register", form("eve@example.com")).Code)
+
+	link, err := app.Kit.Registration.Invite(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	msg, ok := app.Mailbox().LastTo("ada@example.com")
+	require.True(t, ok)
+	assert.Contains(t, msg.Text, link)
+	uri := requestURI(t, link)
+
+	res := app.Client().Get(uri)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	buffkittest.AssertElement(t, res.Body.String(), "input", "name", "email", "value", "ada@example.com")
+	buffkittest.AssertElement(t, res.Body.String(), "form", "action", uri)
+
+	// The invited address wins over whatever the form sends
+	res = app.Client().Post(uri, form("eve@example.com"))
+	buffkittest.AssertRedirect(t, res, "/")
+	user, err := app.Kit.AuthStore.ByEmail(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	t.Run("links register one user", func(t *testing.T) {
+		assert.Equal(t, http.StatusGone, app.Client().Get(uri).Code)
+		assert.Equal(t, http.StatusGone, app.Client().Post(uri, form("ada@example.com")).Code)
+	})
+
+	t.Run("open invitations let the invitee pick the email", func(t *testing.T) {
+		link, err := app.Kit.Registration.InviteURL("")
+		require.NoError(t, err)
+		res := app.Client().Post(requestURI(t, link), form("grace@example.com"))
+		buffkittest.AssertRedirect(t, res, "/")
+		_, err = app.Kit.AuthStore.ByEmail(context.Background(), "grace@example.com")
+		require.NoError(t, err)
+	})
+
+	t.Run("tampered and expired links are refused", func(t *testing.T) {
+		link, err := app.Kit.Registration.InviteURL("bob@example.com")
+		require.NoError(t, err)
+		uri := requestURI(t, link)
+
+		tampered, err := url.Parse(uri)
+		require.NoError(t, err)
+		q := tampered.Query()
+		q.Set("email", "eve@example.com")
+		tampered.RawQuery = q.Encode()
+		assert.Equal(t, http.StatusForbidden, app.Client().Get(tampered.RequestURI()).Code)
+
+		app.Clock.Advance(registration.DefaultInviteTTL + time.Minute)
+		assert.Equal(t, http.StatusGone, app.Client().Get(uri).Code)
+	})
+}
+
+func TestClosedRegistration(t *testing.T) {
+	app := newRegistrationApp(t, "")
+	assert.Nil(t, app.Kit.Registration)
+	assert.Equal(t, http.StatusNotFound, app.Client().Get("/register").Code)
+}
+
+func TestRegisterWithUsername(t *testing.T) {
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{RegistrationMode: registration.Open, LoginIdentifier: auth.LoginWithUsername},
+	})
+	t.Cleanup(func() { auth.UseLoginIdentifier("") })
+	client := app.Client()
+
+	res := client.Post("/register", form("ada@example.com"))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+
+	values := form("ada@example.com")
+	values.Set("username", "Ada")
+	buffkittest.AssertRedirect(t, client.Post("/register", values), "/")
+	user, err := app.Kit.AuthStore.ByEmail(context.Background(), "ada@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ada", user.Username)
+
+	values = form("other@example.com")
+	values.Set("username", "ada")
+	res = app.Client().Post("/register", values)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "already taken")
+}
@@ -0,0 +1,270 @@
+package buffkit
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// Format is a kind of response Respond can choose between.
+type Format struct {
+	// Name is what handlers offer the format by (Responder.Format) and
+	// what ?format= selects it by, e.g. "json".
+	Name string
+
+	// ContentType is sent with responses in this format. Its media type
+	// is matched against the request's Accept header.
+	ContentType string
+
+	// Match, if set, picks the format for the requests it returns true
+	// for, ahead of the Accept header. htmx requests are told apart by
+	// their HX-Request header this way, as they accept text/html like any
+	// page load does. A format with Match isn't chosen by Accept.
+	Match func(r *http.Request) bool
+}
+
+// The formats Responder has shorthands for.
+var (
+	FormatHTML  = Format{Name: "html", ContentType: "text/html; charset=utf-8"}
+	FormatJSON  = Format{Name: "json", ContentType: "application/json; charset=utf-8"}
+	FormatTurbo = Format{Name: "turbo", ContentType: "text/vnd.turbo-stream.html; charset=utf-8"}
+	FormatHTMX  = Format{Name: "htmx", ContentType: "text/html; charset=utf-8", Match: func(r *http.Request) bool {
+		return r.Header.Get("HX-Request") == "true"
+	}}
+)
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]Format{
+		FormatHTML.Name:  FormatHTML,
+		FormatJSON.Name:  FormatJSON,
+		FormatTurbo.Name: FormatTurbo,
+		FormatHTMX.Name:  FormatHTMX,
+	}
+)
+
+// RegisterFormat adds f to the formats handlers can offer with
+// Responder.Format, replacing any of the same name:
+//
+//	buffkit.RegisterFormat(buffkit.Format{Name: "csv", ContentType: "text/csv"})
+func RegisterFormat(f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[f.Name] = f
+}
+
+// Responder renders one response in whichever of the formats a handler
+// offers the request prefers. Start one with Respond.
+type Responder struct {
+	c      buffalo.Context
+	data   any
+	status int
+	offers []offer
+	err    error
+}
+
+// offer is a format a handler can respond in, and how.
+type offer struct {
+	format   Format
+	renderer render.Renderer
+}
+
+// Respond starts a response with data, for a handler that serves pages
+// and API clients alike. Offer the formats it can be rendered in, then
+// Send it:
+//
+//	return buffkit.Respond(c, map[string]any{"post": post}).
+//	    HTML(r.HTML("posts/show.plush.html")).
+//	    Turbo(r.HTML("posts/show.turbo.html")).
+//	    JSON().
+//	    Send()
+//
+// A map's keys are added to the data templates get, as c.Set would add
+// them; anything else is there as "data". JSON renders data itself.
+func Respond(c buffalo.Context, data any) *Responder {
+	return &Responder{c: c, data: data, status: http.StatusOK}
+}
+
+// Status sets the response's status code, 200 by default.
+func (r *Responder) Status(code int) *Responder {
+	r.status = code
+	return r
+}
+
+// HTML offers a page, rendered by rr.
+func (r *Responder) HTML(rr render.Renderer) *Responder {
+	return r.Format(FormatHTML.Name, rr)
+}
+
+// JSON offers the data as JSON.
+func (r *Responder) JSON() *Responder {
+	return r.Format(FormatJSON.Name, render.JSON(r.data))
+}
+
+// Turbo offers a Turbo Stream, rendered by rr, for Turbo's form
+// submissions and fetches.
+func (r *Responder) Turbo(rr render.Renderer) *Responder {
+	return r.Format(FormatTurbo.Name, rr)
+}
+
+// HTMX offers a fragment, rendered by rr, for htmx requests.
+func (r *Responder) HTMX(rr render.Renderer) *Responder {
+	return r.Format(FormatHTMX.Name, rr)
+}
+
+// Format offers the registered format name, rendered by rr. Send fails
+// if name isn't registered.
+func (r *Responder) Format(name string, rr render.Renderer) *Responder {
+	formatsMu.RLock()
+	f, ok := formats[name]
+	formatsMu.RUnlock()
+	if !ok {
+		if r.err == nil {
+			r.err = fmt.Errorf("buffkit: Respond: unknown format %q", name)
+		}
+		return r
+	}
+	r.offers = append(r.offers, offer{format: f, renderer: rr})
+	return r
+}
+
+// Send renders the response in the format the request prefers: the one
+// ?format= names, then one whose Match accepts the request, then the
+// first the Accept header allows, by preference. Without an Accept
+// header it's the first format offered. When none is acceptable, the
+// request fails with 406 Not Acceptable.
+func (r *Responder) Send() error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.offers) == 0 {
+		return fmt.Errorf("buffkit: Respond: no formats offered")
+	}
+
+	// Caches keep the formats apart
+	vary := "Accept"
+	for _, o := range r.offers {
+		if o.format.Match != nil {
+			vary = "Accept, HX-Request"
+			break
+		}
+	}
+	r.c.Response().Header().Add("Vary", vary)
+
+	o, ok := r.negotiate(r.c.Request())
+	if !ok {
+		names := make([]string, len(r.offers))
+		for i, o := range r.offers {
+			names[i] = o.format.Name
+		}
+		return r.c.Error(http.StatusNotAcceptable,
+			fmt.Errorf("buffkit: Respond: %q accepts none of %s", r.c.Request().Header.Get("Accept"), strings.Join(names, ", ")))
+	}
+	return r.c.Render(r.status, negotiated{Renderer: o.renderer, contentType: o.format.ContentType, data: r.data})
+}
+
+// negotiate picks the offer for req.
+func (r *Responder) negotiate(req *http.Request) (offer, bool) {
+	if name := r.c.Param("format"); name != "" {
+		for _, o := range r.offers {
+			if o.format.Name == name {
+				return o, true
+			}
+		}
+	}
+	for _, o := range r.offers {
+		if o.format.Match != nil && o.format.Match(req) {
+			return o, true
+		}
+	}
+
+	accept := req.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return r.offers[0], true
+	}
+	for _, mediaRange := range parseAccept(accept) {
+		for _, o := range r.offers {
+			if o.format.Match != nil {
+				continue
+			}
+			if mediaType, _, err := mime.ParseMediaType(o.format.ContentType); err == nil && acceptsMediaType(mediaRange, mediaType) {
+				return o, true
+			}
+		}
+	}
+	return offer{}, false
+}
+
+// parseAccept returns the media ranges in an Accept header that are
+// acceptable at all, most preferred first. Ranges with the same quality
+// keep their order.
+func parseAccept(header string) []string {
+	type weighted struct {
+		mediaRange string
+		q          float64
+	}
+	var ranges []weighted
+	for _, part := range strings.Split(header, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, weighted{mediaRange, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	out := make([]string, len(ranges))
+	for i, w := range ranges {
+		out[i] = w.mediaRange
+	}
+	return out
+}
+
+// acceptsMediaType reports whether mediaRange ("text/html", "text/*" or
+// "*/*") covers mediaType.
+func acceptsMediaType(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// negotiated is the renderer of the chosen offer, sent with its format's
+// content type and the responder's data.
+type negotiated struct {
+	render.Renderer
+	contentType string
+	data        any
+}
+
+func (n negotiated) ContentType() string {
+	return n.contentType
+}
+
+func (n negotiated) Render(w io.Writer, data render.Data) error {
+	if m, ok := n.data.(map[string]any); ok {
+		for k, v := range m {
+			data[k] = v
+		}
+	} else if n.data != nil {
+		data["data"] = n.data
+	}
+	return n.Renderer.Render(w, data)
+}
@@ -0,0 +1,86 @@
+package buffkit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRespond(t *testing.T) {
+	RegisterFormat(Format{Name: "csv", ContentType: "text/csv"})
+	defer func() {
+		formatsMu.Lock()
+		delete(formats, "csv")
+		formatsMu.Unlock()
+	}()
+
+	// text renders the data a template would see
+	text := func(prefix string) render.Renderer {
+		return render.Func("text/plain", func(w io.Writer, data render.Data) error {
+			_, err := fmt.Fprintf(w, "%s %v", prefix, data["title"])
+			return err
+		})
+	}
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/post", func(c buffalo.Context) error {
+		return Respond(c, map[string]any{"title": "Hello"}).
+			HTML(text("page")).
+			HTMX(text("fragment")).
+			Turbo(text("stream")).
+			JSON().
+			Format("csv", text("csv")).
+			Send()
+	})
+	app.POST("/post", func(c buffalo.Context) error {
+		return Respond(c, map[string]any{"title": "Hello"}).Status(http.StatusCreated).JSON().Send()
+	})
+	app.GET("/unknown", func(c buffalo.Context) error {
+		return Respond(c, nil).Format("xml", text("xml")).Send()
+	})
+
+	tests := []struct {
+		name, method, path string
+		header             map[string]string
+		status             int
+		contentType, body  string
+	}{
+		{"no accept", "GET", "/post", nil, 200, "text/html; charset=utf-8", "page Hello"},
+		{"browser", "GET", "/post", map[string]string{"Accept": "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}, 200, "text/html; charset=utf-8", "page Hello"},
+		{"api", "GET", "/post", map[string]string{"Accept": "application/json"}, 200, "application/json; charset=utf-8", `{"title":"Hello"}` + "\n"},
+		{"preference", "GET", "/post", map[string]string{"Accept": "text/html;q=0.5, application/json"}, 200, "application/json; charset=utf-8", `{"title":"Hello"}` + "\n"},
+		{"turbo", "GET", "/post", map[string]string{"Accept": "text/vnd.turbo-stream.html, text/html, application/xhtml+xml"}, 200, "text/vnd.turbo-stream.html; charset=utf-8", "stream Hello"},
+		{"htmx", "GET", "/post", map[string]string{"HX-Request": "true", "Accept": "text/html"}, 200, "text/html; charset=utf-8", "fragment Hello"},
+		{"wildcard", "GET", "/post", map[string]string{"Accept": "text/*"}, 200, "text/html; charset=utf-8", "page Hello"},
+		{"registered", "GET", "/post", map[string]string{"Accept": "text/csv"}, 200, "text/csv", "csv Hello"},
+		{"param", "GET", "/post?format=json", map[string]string{"Accept": "text/html"}, 200, "application/json; charset=utf-8", `{"title":"Hello"}` + "\n"},
+		{"status", "POST", "/post", nil, 201, "application/json; charset=utf-8", `{"title":"Hello"}` + "\n"},
+		{"not acceptable", "GET", "/post", map[string]string{"Accept": "image/png"}, 406, "", ""},
+		{"unknown format", "GET", "/unknown", nil, 500, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.status < 300 {
+				assert.Equal(t, tt.contentType, rec.Header().Get("Content-Type"))
+				assert.Equal(t, tt.body, rec.Body.String())
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/post", nil))
+	assert.Equal(t, "Accept, HX-Request", rec.Header().Get("Vary"))
+}
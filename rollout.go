@@ -0,0 +1,24 @@
+package buffkit
+
+import (
+	"github.com/johnjansen/buffkit/rollout"
+)
+
+// Rollout creates a rollout that sends percent of visitors to the new
+// version of a page:
+//
+//	dashboard, err := kit.Rollout("new_dashboard", 10)
+//	app.GET("/dashboard", dashboard.Handler(OldDashboard, NewDashboard))
+//
+// When Config.Settings is on, the percentage is the "rollout.<name>"
+// setting, starting at percent, so admins can raise it or turn the
+// rollout off from the settings page. Names must be unique.
+func (k *Kit) Rollout(name string, percent int) (*rollout.Rollout, error) {
+	r := rollout.New(name, percent)
+	if k.Settings != nil {
+		if err := r.Use(k.Settings); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,233 @@
+// Package rollout sends part of the traffic to a new version of a page,
+// so a redesign can go out to a few visitors first and then to everyone:
+//
+//	dashboard := rollout.New("new_dashboard", 10) // 10% of visitors
+//	app.GET("/dashboard", dashboard.Handler(OldDashboard, NewDashboard))
+//
+// Or, when the versions differ only in their templates:
+//
+//	page := dashboard.Page(c, "dashboard/index", "dashboard/index_v2")
+//
+// Visitors are placed by a cookie, so each one keeps seeing the same
+// version, and raising the percentage only adds visitors to the new
+// one. A header or cookie can opt a request in or out regardless, for
+// staff and tests:
+//
+//	curl -H "X-Rollout: new_dashboard" https://app.example.com/dashboard
+//
+// With Use, the percentage is a setting in the settings store, so an
+// admin can dial it up (or back to 0) on the settings page without a
+// deploy.
+package rollout
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/settings"
+)
+
+// VisitorCookie holds the random ID that places a visitor in rollouts.
+// One ID serves every rollout, each of which hashes it with its name.
+const VisitorCookie = "bk_visitor"
+
+// DefaultHeader is the request header that opts a request in or out of
+// rollouts when Header isn't set. It lists rollout names, each optionally
+// with "=off": "X-Rollout: new_dashboard, new_nav=off".
+const DefaultHeader = "X-Rollout"
+
+// ContextKey is where Middleware keeps the request's rollouts, a
+// map[string]bool of name to whether it's on, for templates:
+//
+//	<%= if (rollouts["new_dashboard"]) { %>...<% } %>
+const ContextKey = "rollouts"
+
+// Flags reads the percentage of a rollout from a flag store; a
+// *settings.Settings is one.
+type Flags interface {
+	Int(ctx context.Context, key string) (int, error)
+}
+
+// Rollout sends Percent of visitors to the new version of something.
+type Rollout struct {
+	// Name identifies the rollout in the header and cookie overrides, in
+	// its setting's key, and in how visitors are placed: rollouts with
+	// different names place visitors independently.
+	Name string
+
+	// Percent is the share of visitors, from 0 to 100, who get the new
+	// version, unless Flags sets it.
+	Percent int
+
+	// Flags, when set, gives the percentage as the Int under Key,
+	// falling back to Percent if it can't be read. Use sets it.
+	Flags Flags
+
+	// Header is the request header that opts in or out; DefaultHeader
+	// when empty.
+	Header string
+
+	// Cookie, when set, names a cookie that opts in ("on", "1" or
+	// "true") or out (anything else) of this rollout.
+	Cookie string
+}
+
+// New creates a Rollout that sends percent of visitors to the new
+// version.
+func New(name string, percent int) *Rollout {
+	return &Rollout{Name: name, Percent: percent}
+}
+
+// Key is the rollout's key in the flag store: "rollout.<name>".
+func (r *Rollout) Key() string {
+	return "rollout." + r.Name
+}
+
+// Use defines the rollout's percentage as an Int setting, defaulting to
+// Percent, and reads it from s from now on.
+func (r *Rollout) Use(s *settings.Settings) error {
+	err := s.Define(settings.Setting{
+		Key:     r.Key(),
+		Kind:    settings.Int,
+		Default: fmt.Sprint(r.Percent),
+		Label:   "Rollout: " + r.Name,
+		Help:    "Percentage of visitors (0-100) who get the new version",
+	})
+	if err != nil {
+		return fmt.Errorf("rollout: %w", err)
+	}
+	r.Flags = s
+	return nil
+}
+
+// Enabled reports whether the request gets the new version. The first
+// time a visitor is seen, it sets the cookie that keeps them placed.
+func (r *Rollout) Enabled(c buffalo.Context) bool {
+	if on, ok := r.override(c.Request()); ok {
+		return on
+	}
+	percent := r.percent(c)
+	if percent <= 0 {
+		return false
+	}
+	if percent >= 100 {
+		return true
+	}
+	return bucket(r.Name, Visitor(c)) < percent
+}
+
+// Handler serves stable to visitors outside the rollout and canary to
+// those in it.
+func (r *Rollout) Handler(stable, canary buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if r.Enabled(c) {
+			return canary(c)
+		}
+		return stable(c)
+	}
+}
+
+// Page returns canary for visitors in the rollout and stable for the
+// rest, for choosing between two templates.
+func (r *Rollout) Page(c buffalo.Context, stable, canary string) string {
+	if r.Enabled(c) {
+		return canary
+	}
+	return stable
+}
+
+// Middleware records whether each request is in the rollout under
+// ContextKey, for templates that change only in places.
+func (r *Rollout) Middleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		on := r.Enabled(c)
+		rollouts, _ := c.Value(ContextKey).(map[string]bool)
+		merged := make(map[string]bool, len(rollouts)+1)
+		for name, v := range rollouts {
+			merged[name] = v
+		}
+		merged[r.Name] = on
+		c.Set(ContextKey, merged)
+		return next(c)
+	}
+}
+
+// percent is the share of visitors in the rollout, from Flags when it
+// can be read.
+func (r *Rollout) percent(ctx context.Context) int {
+	if r.Flags != nil {
+		if p, err := r.Flags.Int(ctx, r.Key()); err == nil {
+			return p
+		}
+	}
+	return r.Percent
+}
+
+// override reports the header's or cookie's choice, if they make one.
+func (r *Rollout) override(req *http.Request) (on, ok bool) {
+	header := r.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+	for _, value := range req.Header.Values(header) {
+		for _, item := range strings.Split(value, ",") {
+			name, setting, hasSetting := strings.Cut(strings.TrimSpace(item), "=")
+			if name != r.Name {
+				continue
+			}
+			return !hasSetting || truthy(setting), true
+		}
+	}
+	if r.Cookie != "" {
+		if cookie, err := req.Cookie(r.Cookie); err == nil {
+			return truthy(cookie.Value), true
+		}
+	}
+	return false, false
+}
+
+func truthy(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "on", "1", "true":
+		return true
+	}
+	return false
+}
+
+// Visitor returns the ID in the visitor's VisitorCookie, giving them one
+// if they're new. Experiments place visitors by it too.
+func Visitor(c buffalo.Context) string {
+	if cookie, err := c.Request().Cookie(VisitorCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	if id, ok := c.Value(VisitorCookie).(string); ok {
+		// Already given one earlier in this request
+		return id
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     VisitorCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Set(VisitorCookie, id)
+	return id
+}
+
+// bucket places id in one of 100 buckets for the named rollout.
+func bucket(name, id string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + ":" + id))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,143 @@
+package rollout_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/rollout"
+	"github.com/johnjansen/buffkit/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func page(name string) buffalo.Handler {
+	return func(c buffalo.Context) error { return c.Render(http.StatusOK, render.String(name)) }
+}
+
+func serve(app *buffalo.App, setup func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/page", nil)
+	if setup != nil {
+		setup(req)
+	}
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+// visitorCookies returns the visitor cookies res sets.
+func visitorCookies(res *httptest.ResponseRecorder) []*http.Cookie {
+	var out []*http.Cookie
+	for _, c := range res.Result().Cookies() {
+		if c.Name == rollout.VisitorCookie {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func visitor(id string) func(*http.Request) {
+	return func(req *http.Request) { req.AddCookie(&http.Cookie{Name: rollout.VisitorCookie, Value: id}) }
+}
+
+func TestHandlerSplitsVisitors(t *testing.T) {
+	r := rollout.New("redesign", 30)
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/page", r.Handler(page("old"), page("new")))
+
+	canary := 0
+	for i := 0; i < 1000; i++ {
+		res := serve(app, visitor(fmt.Sprint("visitor-", i)))
+		if res.Body.String() == "new" {
+			canary++
+		}
+		// Visitors stay where they were placed
+		assert.Equal(t, res.Body.String(), serve(app, visitor(fmt.Sprint("visitor-", i))).Body.String())
+	}
+	assert.InDelta(t, 300, canary, 60)
+
+	// New visitors are given a cookie that keeps them placed
+	res := serve(app, nil)
+	cookies := visitorCookies(res)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, res.Body.String(), serve(app, visitor(cookies[0].Value)).Body.String())
+}
+
+func TestRaisingPercentKeepsVisitors(t *testing.T) {
+	ids := make([]string, 200)
+	for i := range ids {
+		ids[i] = fmt.Sprint("visitor-", i)
+	}
+	placed := func(percent int) map[string]bool {
+		r := rollout.New("redesign", percent)
+		app := buffalo.New(buffalo.Options{Env: "test"})
+		app.GET("/page", r.Handler(page("old"), page("new")))
+		in := make(map[string]bool)
+		for _, id := range ids {
+			in[id] = serve(app, visitor(id)).Body.String() == "new"
+		}
+		return in
+	}
+	low, high := placed(10), placed(50)
+	for id, in := range low {
+		if in {
+			assert.True(t, high[id], id)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	r := &rollout.Rollout{Name: "redesign", Percent: 0, Cookie: "bk_redesign"}
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/page", r.Handler(page("old"), page("new")))
+
+	assert.Equal(t, "old", serve(app, nil).Body.String())
+	assert.Equal(t, "new", serve(app, func(req *http.Request) {
+		req.Header.Set("X-Rollout", "other, redesign")
+	}).Body.String())
+	assert.Equal(t, "new", serve(app, func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "bk_redesign", Value: "on"})
+	}).Body.String())
+
+	r.Percent = 100
+	assert.Equal(t, "new", serve(app, nil).Body.String())
+	assert.Equal(t, "old", serve(app, func(req *http.Request) {
+		req.Header.Set("X-Rollout", "redesign=off")
+	}).Body.String())
+}
+
+func TestUseSettings(t *testing.T) {
+	s := settings.New(settings.NewMemoryStore())
+	r := rollout.New("redesign", 0)
+	require.NoError(t, r.Use(s))
+	require.Error(t, r.Use(s), "defined twice")
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/page", r.Handler(page("old"), page("new")))
+	assert.Equal(t, "old", serve(app, visitor("ada")).Body.String())
+
+	require.NoError(t, s.Set(context.Background(), "rollout.redesign", 100))
+	assert.Equal(t, "new", serve(app, visitor("ada")).Body.String())
+}
+
+func TestMiddleware(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(rollout.New("new_nav", 100).Middleware)
+	app.Use(rollout.New("new_footer", 0).Middleware)
+	app.GET("/page", func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, render.String(`nav=<%= rollouts["new_nav"] %> footer=<%= rollouts["new_footer"] %>`))
+	})
+
+	assert.Equal(t, "nav=true footer=false", serve(app, nil).Body.String())
+
+	// The visitor cookie is set once, though both rollouts need it
+	app = buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(rollout.New("new_nav", 50).Middleware)
+	app.Use(rollout.New("new_footer", 50).Middleware)
+	app.GET("/page", page("ok"))
+	assert.Len(t, visitorCookies(serve(app, nil)), 1)
+}
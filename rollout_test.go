@@ -0,0 +1,26 @@
+package buffkit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKitRollout(t *testing.T) {
+	kit, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{AuthSecret: []byte("secret"), Settings: true})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	r, err := kit.Rollout("redesign", 25)
+	require.NoError(t, err)
+	assert.Equal(t, kit.Settings, r.Flags)
+	percent, err := kit.Settings.Int(context.Background(), "rollout.redesign")
+	require.NoError(t, err)
+	assert.Equal(t, 25, percent)
+
+	_, err = kit.Rollout("redesign", 50)
+	assert.Error(t, err, "names are unique")
+}
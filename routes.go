@@ -0,0 +1,437 @@
+package buffkit
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/account"
+	"github.com/johnjansen/buffkit/analytics"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/auth/reset"
+	"github.com/johnjansen/buffkit/auth/saml"
+	"github.com/johnjansen/buffkit/comments"
+	"github.com/johnjansen/buffkit/consent"
+	"github.com/johnjansen/buffkit/importmap"
+	"github.com/johnjansen/buffkit/imports"
+	"github.com/johnjansen/buffkit/internalapi"
+	"github.com/johnjansen/buffkit/mail"
+	"github.com/johnjansen/buffkit/registration"
+	"github.com/johnjansen/buffkit/scim"
+	"github.com/johnjansen/buffkit/secure"
+	"github.com/johnjansen/buffkit/settings"
+	"github.com/johnjansen/buffkit/shortlinks"
+	"github.com/johnjansen/buffkit/tags"
+	"github.com/johnjansen/buffkit/tenancy"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// modulePath is trimmed from handler names to keep listings readable.
+const modulePath = "github.com/johnjansen/buffkit"
+
+// RouteEntry describes one mounted route for the route listing.
+type RouteEntry struct {
+	Method     string   `json:"method"`
+	Path       string   `json:"path"`
+	Handler    string   `json:"handler"`
+	Middleware []string `json:"middleware"`
+
+	// Buffkit is true for routes Wire mounted (login, /events, etc.).
+	Buffkit bool `json:"buffkit"`
+}
+
+// routeKey identifies a route by method and path.
+func routeKey(ri *buffalo.RouteInfo) string {
+	return ri.Method + " " + ri.Path
+}
+
+// routeKeys returns the keys of every route currently mounted on app.
+func routeKeys(app *buffalo.App) map[string]bool {
+	keys := make(map[string]bool)
+	for _, ri := range app.Routes() {
+		keys[routeKey(ri)] = true
+	}
+	return keys
+}
+
+// mountPath returns p under Config.MountPath, e.g. "/kit/login".
+func (cfg Config) mountPath(p string) string {
+	return path.Join("/", cfg.MountPath, p)
+}
+
+// authPath returns p under MountPath and AuthPath, e.g. "/auth/login".
+func (cfg Config) authPath(p string) string {
+	return cfg.mountPath(path.Join("/", cfg.AuthPath, p))
+}
+
+// buffkitRoutes lists the method and path of every route Wire mounts for
+// cfg, so they can be checked for collisions before anything is mounted.
+// Keep it in step with the mounts in Wire.
+func (cfg Config) buffkitRoutes() [][2]string {
+	routes := [][2]string{
+		{http.MethodGet, "/barcodes/{image}"},
+		{http.MethodGet, "/blobs/{key:.+}"},
+		{http.MethodGet, "/events"},
+		{http.MethodGet, "/events/poll"},
+		{http.MethodGet, "/tables/{dataset}"},
+		{http.MethodPost, "/theme"},
+	}
+	if cfg.DevMode {
+		routes = append(routes,
+			[2]string{http.MethodGet, "/__components/usage"},
+			[2]string{http.MethodGet, "/__mail/preview"},
+			[2]string{http.MethodGet, "/__mail/templates"},
+			[2]string{http.MethodPost, "/__mail/templates/send"},
+			[2]string{http.MethodGet, "/__routes"},
+			[2]string{http.MethodGet, "/__templates"})
+	}
+	if cfg.RedisURL != "" {
+		routes = append(routes, [2]string{http.MethodGet, "/exports/{file}"})
+	}
+	for i := range routes {
+		routes[i][1] = cfg.mountPath(routes[i][1])
+	}
+	routes = append(routes,
+		[2]string{http.MethodGet, cfg.authPath("/login")},
+		[2]string{http.MethodPost, cfg.authPath("/login")},
+		[2]string{http.MethodPost, cfg.authPath("/logout")})
+	if cfg.RedisURL != "" {
+		routes = append(routes, (&imports.Imports{Path: cfg.mountPath("/imports")}).Routes()...)
+	}
+	if cfg.Shortlinks {
+		routes = append(routes, cfg.shortlinks(nil, nil).Routes()...)
+	}
+	if cfg.Comments {
+		routes = append(routes, cfg.comments(nil).Routes()...)
+	}
+	if cfg.Settings {
+		routes = append(routes, cfg.settings(nil).Routes()...)
+	}
+	if cfg.Tags {
+		routes = append(routes, cfg.tags(nil).Routes()...)
+	}
+	if cfg.Consent {
+		routes = append(routes, cfg.consent(nil).Routes()...)
+	}
+	if cfg.Analytics {
+		routes = append(routes, cfg.analytics(nil, nil).Routes()...)
+	}
+	if cfg.Account {
+		routes = append(routes, cfg.account(nil, nil, nil).Routes()...)
+	}
+	routes = append(routes, cfg.registration(nil, nil, nil).Routes()...)
+	if cfg.PasswordReset {
+		routes = append(routes, cfg.passwordReset(nil, nil).Routes()...)
+	}
+	if cfg.SCIMToken != "" {
+		routes = append(routes, cfg.scim(nil).Routes()...)
+	}
+	if cfg.InternalAPIToken != "" {
+		routes = append(routes, cfg.internalAPI(nil).Routes()...)
+	}
+	if cfg.SAML != nil {
+		routes = append(routes, (&saml.SP{Config: cfg.samlConfig()}).Routes()...)
+	}
+	if cfg.jsControllersDir() != "" {
+		// Served with the static assets, so never under MountPath
+		routes = append(routes, [2]string{http.MethodGet, importmap.ControllersPath + "/{file:.+}"})
+	}
+	return routes
+}
+
+// jsControllersDir returns the JS controllers directory, or "" when the
+// app doesn't have one.
+func (cfg Config) jsControllersDir() string {
+	dir := cfg.JSControllers
+	if dir == "" {
+		dir = importmap.DefaultControllersDir
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return ""
+	}
+	return dir
+}
+
+// templatesDir is where the app's templates for Buffkit's pages live
+// when Config.Templates isn't set.
+const templatesDir = "templates/buffkit"
+
+// templates returns the app's templates for Buffkit's pages:
+// Config.Templates, or templates/buffkit if it exists, or nil.
+func (cfg Config) templates() fs.FS {
+	if cfg.Templates != nil {
+		return cfg.Templates
+	}
+	if info, err := os.Stat(templatesDir); err != nil || !info.IsDir() {
+		return nil
+	}
+	return os.DirFS(templatesDir)
+}
+
+// templateResolver resolves Buffkit's pages for cfg: the app's templates,
+// then tenants' overrides, then the built-ins.
+func (cfg Config) templateResolver() *views.Resolver {
+	r := &views.Resolver{App: cfg.templates()}
+	if cfg.Tenancy != nil && cfg.Tenancy.Templates != nil {
+		src := cfg.Tenancy.Templates
+		r.Tenant = func(ctx context.Context) fs.FS {
+			return tenancy.OverridesFS(ctx, src)
+		}
+	}
+	return r
+}
+
+// account configures the account pages for cfg.
+func (cfg Config) account(store auth.ProfileStore, sender mail.Sender, signer *secure.URLSigner) *account.Account {
+	a := account.New(store, sender, signer)
+	a.Path = cfg.mountPath("/account")
+	a.BaseURL = cfg.BaseURL
+	a.Clock = cfg.Clock
+	a.Avatars = cfg.Avatars
+	a.Usernames = cfg.LoginIdentifier.AcceptsUsername()
+	// Stores that keep sessions get the sessions page. The route listing
+	// has no store, so it includes the page's routes
+	_, keepsSessions := store.(auth.SessionStore)
+	a.Sessions = keepsSessions || store == nil
+	return a
+}
+
+// shortlinks configures short links for cfg.
+func (cfg Config) shortlinks(store shortlinks.Store, signer *secure.URLSigner) *shortlinks.Shortlinks {
+	s := shortlinks.New(store, signer)
+	s.Path = cfg.mountPath("/s")
+	s.BaseURL = cfg.BaseURL
+	s.Clock = cfg.Clock
+	return s
+}
+
+// internalAPI configures the internal API for cfg.
+func (cfg Config) internalAPI(publisher internalapi.Publisher) *internalapi.Server {
+	s := internalapi.New(cfg.InternalAPIToken, publisher, nil)
+	s.Path = cfg.mountPath("/internal")
+	return s
+}
+
+// comments configures comments for cfg.
+func (cfg Config) comments(store comments.Store) *comments.Comments {
+	m := comments.New(store)
+	m.Path = cfg.mountPath("/comments")
+	m.Clock = cfg.Clock
+	return m
+}
+
+// settings configures settings for cfg.
+func (cfg Config) settings(store settings.Store) *settings.Settings {
+	s := settings.New(store)
+	s.Path = cfg.mountPath("/settings")
+	s.Clock = cfg.Clock
+	return s
+}
+
+// tags configures tags for cfg.
+func (cfg Config) tags(store tags.Store) *tags.Tags {
+	t := tags.New(store)
+	t.Path = cfg.mountPath("/tags")
+	return t
+}
+
+// consent configures cookie consent for cfg.
+func (cfg Config) consent(signer *secure.URLSigner) *consent.Consent {
+	k := consent.New(signer)
+	k.Path = cfg.mountPath("/consent")
+	k.Clock = cfg.Clock
+	return k
+}
+
+// analytics configures first-party analytics for cfg.
+func (cfg Config) analytics(store analytics.Store, salt []byte) *analytics.Analytics {
+	a := analytics.New(store, salt)
+	a.Path = cfg.mountPath("/analytics")
+	a.CollectPath = cfg.mountPath("/__collect")
+	a.Clock = cfg.Clock
+	return a
+}
+
+// registration configures the registration page for cfg.
+func (cfg Config) registration(store auth.UserStore, sender mail.Sender, signer *secure.URLSigner) *registration.Registration {
+	r := registration.New(store, sender, signer)
+	r.Mode = cfg.RegistrationMode
+	if r.Mode == "" {
+		r.Mode = registration.Closed
+	}
+	r.Path = cfg.authPath("/register")
+	r.BaseURL = cfg.BaseURL
+	r.Clock = cfg.Clock
+	return r
+}
+
+// passwordReset configures the password reset pages for cfg.
+func (cfg Config) passwordReset(store auth.ResetTokenStore, sender mail.Sender) *reset.Reset {
+	r := reset.New(store, sender)
+	r.ForgotPath = cfg.authPath("/forgot-password")
+	r.ResetPath = cfg.authPath("/reset-password")
+	r.BaseURL = cfg.BaseURL
+	r.Clock = cfg.Clock
+	return r
+}
+
+// scim configures the SCIM endpoint for cfg.
+func (cfg Config) scim(store auth.ProvisioningStore) *scim.Server {
+	s := scim.New(store, cfg.SCIMToken)
+	s.Path = cfg.mountPath("/scim/v2")
+	s.Clock = cfg.Clock
+	return s
+}
+
+// samlConfig is Config.SAML with its path defaulted under AuthPath.
+func (cfg Config) samlConfig() saml.Config {
+	c := *cfg.SAML
+	if c.Path == "" {
+		c.Path = cfg.authPath("/saml")
+	}
+	return c
+}
+
+// restrictHosts wraps handlers so they only answer requests for one of
+// hosts, with 404 for any other host as if the route didn't exist. The
+// port is ignored. No hosts means no restriction.
+func restrictHosts(hosts []string) func(buffalo.Handler) buffalo.Handler {
+	return func(next buffalo.Handler) buffalo.Handler {
+		if len(hosts) == 0 {
+			return next
+		}
+		return func(c buffalo.Context) error {
+			host := c.Request().Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			for _, allowed := range hosts {
+				if strings.EqualFold(host, allowed) {
+					return next(c)
+				}
+			}
+			return c.Error(http.StatusNotFound, fmt.Errorf("no route for host %s", host))
+		}
+	}
+}
+
+// checkRoutes returns an error naming the first Buffkit route that would
+// replace one the app already has. Buffalo silently overwrites a route
+// mounted twice, so this is the only chance to catch it. Paths are
+// normalized the way Buffalo stores them (app prefix, trailing slash).
+func checkRoutes(app *buffalo.App, cfg Config) error {
+	existing := make(map[string]*buffalo.RouteInfo)
+	for _, ri := range app.Routes() {
+		existing[routeKey(ri)] = ri
+	}
+
+	for _, r := range cfg.buffkitRoutes() {
+		p := path.Join(app.Prefix, r[1])
+		if !strings.HasSuffix(p, "/") {
+			p += "/"
+		}
+		if ri, ok := existing[r[0]+" "+p]; ok {
+			return fmt.Errorf("buffkit: route %s %s is already mounted by %s; set Config.MountPath to mount Buffkit under a prefix",
+				r[0], p, shortName(ri.HandlerName))
+		}
+	}
+	return nil
+}
+
+// middlewareNames returns the names of the app's middleware, in order.
+func middlewareNames(app *buffalo.App) []string {
+	stack := app.Middleware.String()
+	if stack == "" {
+		return nil
+	}
+	return strings.Split(stack, "\n")
+}
+
+// Routes lists every route mounted on the app, sorted by path and method,
+// with the middleware stack each one runs through. Routes added by Wire
+// are flagged so you can see what Buffkit mounted.
+func (k *Kit) Routes() []RouteEntry {
+	var entries []RouteEntry
+	for _, ri := range k.app.Routes() {
+		entry := RouteEntry{
+			Method:  ri.Method,
+			Path:    ri.Path,
+			Handler: ri.HandlerName,
+			Buffkit: k.mounted[routeKey(ri)],
+		}
+		if ri.App != nil {
+			entry.Middleware = middlewareNames(ri.App)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Method < entries[j].Method
+	})
+	return entries
+}
+
+// shortName trims the module path so listings stay readable.
+func shortName(name string) string {
+	return strings.TrimPrefix(name, modulePath+"/")
+}
+
+// RoutesHandler renders the route listing as an HTML page. Wire mounts it
+// at /__routes in DevMode.
+func (k *Kit) RoutesHandler(c buffalo.Context) error {
+	routes := k.Routes()
+
+	var page strings.Builder
+	page.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Routes</title>
+    <style>
+        body { font-family: system-ui, sans-serif; padding: 20px; }
+        table { border-collapse: collapse; width: 100%; }
+        th, td { text-align: left; padding: 6px 10px; border-bottom: 1px solid #ddd; vertical-align: top; }
+        th { background: #f5f5f5; }
+        code { font-size: 0.9em; }
+        .buffkit { background: #f0f7ff; }
+        .tag { color: #0366d6; font-size: 0.8em; }
+        .middleware { color: #666; font-size: 0.85em; }
+    </style>
+</head>
+<body>
+    <h1>Routes (Development)</h1>
+`)
+	fmt.Fprintf(&page, "    <p>%d route(s). Routes mounted by Buffkit are highlighted.</p>\n", len(routes))
+	page.WriteString("    <table>\n        <tr><th>Method</th><th>Path</th><th>Handler</th><th>Middleware</th></tr>\n")
+
+	for _, r := range routes {
+		class, tag := "", ""
+		if r.Buffkit {
+			class, tag = ` class="buffkit"`, ` <span class="tag">buffkit</span>`
+		}
+		middleware := make([]string, len(r.Middleware))
+		for i, mw := range r.Middleware {
+			middleware[i] = html.EscapeString(shortName(mw))
+		}
+		fmt.Fprintf(&page, "        <tr%s><td>%s</td><td><code>%s</code>%s</td><td><code>%s</code></td><td class=\"middleware\">%s</td></tr>\n",
+			class, r.Method, html.EscapeString(r.Path), tag,
+			html.EscapeString(shortName(r.Handler)), strings.Join(middleware, "<br>"))
+	}
+
+	page.WriteString("    </table>\n</body>\n</html>\n")
+
+	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err := c.Response().Write([]byte(page.String()))
+	return err
+}
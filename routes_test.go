@@ -0,0 +1,53 @@
+package buffkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appHandler(c buffalo.Context) error {
+	return c.Render(http.StatusOK, nil)
+}
+
+func TestRoutes(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{DevMode: true, AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	app.GET("/dashboard", appHandler)
+
+	byPath := map[string]RouteEntry{}
+	for _, r := range kit.Routes() {
+		byPath[r.Method+" "+r.Path] = r
+	}
+
+	login, ok := byPath["GET /login/"]
+	require.True(t, ok, "expected Wire's login route to be listed")
+	assert.True(t, login.Buffkit)
+	assert.NotEmpty(t, login.Middleware)
+
+	dashboard, ok := byPath["GET /dashboard/"]
+	require.True(t, ok)
+	assert.False(t, dashboard.Buffkit)
+
+	t.Run("dev page lists routes", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "/__routes", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "/dashboard/")
+		assert.Contains(t, rec.Body.String(), "/events/")
+	})
+
+	t.Run("dev page lists templates", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "/__templates", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "<code>auth/login.plush.html</code>")
+	})
+}
@@ -0,0 +1,377 @@
+// Package sagas runs multi-step jobs whose steps can't share a
+// transaction, such as charging a card, reserving stock and booking a
+// courier. Each step runs as its own job, retried by the jobs runtime's
+// retry policy. When a step fails for good, the steps before it are
+// undone, latest first, by their compensating actions:
+//
+//	kit.Sagas.Register(sagas.Definition{
+//	    Name: "checkout",
+//	    Steps: []sagas.Step{
+//	        {
+//	            Name: "charge",
+//	            Do: func(ctx context.Context, s *sagas.Saga) error {
+//	                id, err := payments.Charge(ctx, s.Data["order"])
+//	                s.Data["charge"] = id
+//	                return err
+//	            },
+//	            Compensate: func(ctx context.Context, s *sagas.Saga) error {
+//	                return payments.Refund(ctx, s.Data["charge"])
+//	            },
+//	        },
+//	        {Name: "reserve", Do: reserveStock, Compensate: releaseStock},
+//	        {Name: "ship", Do: bookCourier},
+//	    },
+//	})
+//
+//	saga, err := kit.Sagas.Start(ctx, "checkout", map[string]string{"order": order.ID})
+//
+// A saga's state, the step it has reached and its Data are saved after
+// every step, so a worker restart carries on where it stopped. Jobs run
+// at least once, so steps and compensations must be safe to repeat.
+package sagas
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+)
+
+// State is where a saga is in its run.
+type State string
+
+const (
+	// StateRunning sagas are running their steps.
+	StateRunning State = "running"
+	// StateCompensating sagas had a step fail and are undoing the ones
+	// before it.
+	StateCompensating State = "compensating"
+	// StateDone sagas ran every step.
+	StateDone State = "done"
+	// StateCompensated sagas had a step fail and undid the ones before it.
+	StateCompensated State = "compensated"
+	// StateFailed sagas had a compensation fail too, and need someone to
+	// clean up after them by hand.
+	StateFailed State = "failed"
+)
+
+// Task types of saga jobs.
+const (
+	stepTask       = "saga:step"
+	compensateTask = "saga:compensate"
+)
+
+// ErrNotFound is returned for an unknown saga ID.
+var ErrNotFound = auth.NotFoundError("sagas: saga not found")
+
+// Step is one step of a saga.
+type Step struct {
+	Name string
+
+	// Do runs the step. It may set s.Data, such as to the ID Compensate
+	// needs, and its changes are saved even if it fails. Returning an
+	// error retries the step; once its retries run out, or for an error
+	// from Permanent, the saga compensates.
+	Do func(ctx context.Context, s *Saga) error
+
+	// Compensate undoes a step that ran. It isn't called for the step
+	// that failed, so Do should leave nothing behind when it fails. Nil
+	// for steps with nothing to undo.
+	Compensate func(ctx context.Context, s *Saga) error
+}
+
+// Definition is a named list of steps.
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+// Saga is one run of a Definition.
+type Saga struct {
+	ID   string
+	Name string
+
+	State State
+
+	// Step is the index of the step running or, while compensating, of
+	// the step being undone.
+	Step int
+
+	// Data is what the saga was started with and what its steps pass on
+	// to later steps and to compensations.
+	Data map[string]string
+
+	// Error is why the saga compensated or failed.
+	Error string
+
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// Finished reports whether the saga has stopped, one way or another.
+func (s *Saga) Finished() bool {
+	return s.State == StateDone || s.State == StateCompensated || s.State == StateFailed
+}
+
+// Store keeps sagas.
+type Store interface {
+	Create(ctx context.Context, s *Saga) error
+	Saga(ctx context.Context, id string) (*Saga, error)
+	Update(ctx context.Context, s *Saga) error
+}
+
+// Queue is the jobs runtime sagas run on; *jobs.Runtime implements it.
+type Queue interface {
+	HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error)
+	EnqueueIn(delay time.Duration, taskType string, payload interface{}) error
+}
+
+// Sagas runs registered saga definitions.
+type Sagas struct {
+	Queue Queue
+	Store Store
+
+	// Clock stamps sagas. Defaults to clock.Real.
+	Clock clock.Clock
+
+	definitions map[string]Definition
+}
+
+// stepPayload is the payload of a step or compensation job. A job for a
+// step the saga has moved past does nothing, so a repeated job can't run
+// a step twice in a row.
+type stepPayload struct {
+	SagaID string `json:"saga_id"`
+	Step   int    `json:"step"`
+}
+
+// New creates a Sagas and registers its job handlers on queue.
+func New(queue Queue, store Store) *Sagas {
+	s := &Sagas{Queue: queue, Store: store, definitions: make(map[string]Definition)}
+	queue.HandleFunc(stepTask, func(ctx context.Context, t *asynq.Task) error {
+		var p stepPayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return fmt.Errorf("sagas: bad payload: %w", err)
+		}
+		return s.RunStep(ctx, p.SagaID, p.Step)
+	})
+	queue.HandleFunc(compensateTask, func(ctx context.Context, t *asynq.Task) error {
+		var p stepPayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return fmt.Errorf("sagas: bad payload: %w", err)
+		}
+		return s.Compensate(ctx, p.SagaID, p.Step)
+	})
+	return s
+}
+
+// Register adds definition d. Register every definition before starting
+// the worker.
+func (s *Sagas) Register(d Definition) error {
+	if d.Name == "" {
+		return errors.New("sagas: Name is required")
+	}
+	if len(d.Steps) == 0 {
+		return fmt.Errorf("sagas: %s: Steps are required", d.Name)
+	}
+	for i, step := range d.Steps {
+		if step.Name == "" || step.Do == nil {
+			return fmt.Errorf("sagas: %s: step %d needs a Name and Do", d.Name, i)
+		}
+	}
+	if _, exists := s.definitions[d.Name]; exists {
+		return fmt.Errorf("sagas: %s is already registered", d.Name)
+	}
+	s.definitions[d.Name] = d
+	return nil
+}
+
+// Start records a run of definition name with data and queues its first
+// step.
+func (s *Sagas) Start(ctx context.Context, name string, data map[string]string) (*Saga, error) {
+	if _, ok := s.definitions[name]; !ok {
+		return nil, fmt.Errorf("sagas: %s is not registered", name)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("sagas: id: %w", err)
+	}
+	now := clock.Or(s.Clock).Now()
+	saga := &Saga{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		State:     StateRunning,
+		Data:      make(map[string]string, len(data)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for k, v := range data {
+		saga.Data[k] = v
+	}
+	if err := s.Store.Create(ctx, saga); err != nil {
+		return nil, fmt.Errorf("sagas: create %s: %w", name, err)
+	}
+	if err := s.Queue.EnqueueIn(0, stepTask, stepPayload{SagaID: saga.ID, Step: 0}); err != nil {
+		return nil, fmt.Errorf("sagas: %s: %w", saga.ID, err)
+	}
+	return saga, nil
+}
+
+// Saga returns saga id, to check on its progress.
+func (s *Sagas) Saga(ctx context.Context, id string) (*Saga, error) {
+	return s.Store.Saga(ctx, id)
+}
+
+// RunStep runs step of saga id and queues the next one, or starts
+// compensating if it failed for good. The step job calls it.
+func (s *Sagas) RunStep(ctx context.Context, id string, step int) error {
+	saga, d, err := s.load(ctx, id)
+	if err != nil || saga == nil {
+		return err
+	}
+	if saga.State != StateRunning || saga.Step != step {
+		return nil
+	}
+	if step < 0 || step >= len(d.Steps) {
+		return fmt.Errorf("sagas: %s: %s has no step %d", id, saga.Name, step)
+	}
+
+	current := d.Steps[step]
+	if err := current.Do(ctx, saga); err != nil {
+		if !permanent(ctx, err) {
+			// Keep what the attempt recorded for the next one
+			if saveErr := s.save(ctx, saga); saveErr != nil {
+				return saveErr
+			}
+			return fmt.Errorf("sagas: %s %s: %s: %w", saga.Name, id, current.Name, err)
+		}
+		log.Printf("Sagas: %s %s: %s failed, compensating: %v", saga.Name, id, current.Name, err)
+		saga.State = StateCompensating
+		saga.Error = fmt.Sprintf("%s: %v", current.Name, err)
+		saga.Step = step - 1
+		return s.next(ctx, saga, d, compensateTask)
+	}
+
+	saga.Step++
+	return s.next(ctx, saga, d, stepTask)
+}
+
+// Compensate undoes step of saga id and queues the compensation of the
+// step before it. The compensation job calls it.
+func (s *Sagas) Compensate(ctx context.Context, id string, step int) error {
+	saga, d, err := s.load(ctx, id)
+	if err != nil || saga == nil {
+		return err
+	}
+	if saga.State != StateCompensating || saga.Step != step {
+		return nil
+	}
+	if step < 0 || step >= len(d.Steps) {
+		return fmt.Errorf("sagas: %s: %s has no step %d", id, saga.Name, step)
+	}
+
+	current := d.Steps[step]
+	if current.Compensate != nil {
+		if err := current.Compensate(ctx, saga); err != nil {
+			if !permanent(ctx, err) {
+				if saveErr := s.save(ctx, saga); saveErr != nil {
+					return saveErr
+				}
+				return fmt.Errorf("sagas: %s %s: compensating %s: %w", saga.Name, id, current.Name, err)
+			}
+			log.Printf("Sagas: %s %s: compensating %s failed, giving up: %v", saga.Name, id, current.Name, err)
+			saga.State = StateFailed
+			saga.Error += fmt.Sprintf("; compensating %s: %v", current.Name, err)
+			return s.finish(ctx, saga)
+		}
+	}
+
+	saga.Step--
+	return s.next(ctx, saga, d, compensateTask)
+}
+
+// next saves saga and queues its next step or compensation, or finishes
+// it when there are none left.
+func (s *Sagas) next(ctx context.Context, saga *Saga, d Definition, task string) error {
+	switch {
+	case task == stepTask && saga.Step >= len(d.Steps):
+		saga.State = StateDone
+		return s.finish(ctx, saga)
+	case task == compensateTask && saga.Step < 0:
+		saga.State = StateCompensated
+		return s.finish(ctx, saga)
+	}
+	if err := s.save(ctx, saga); err != nil {
+		return err
+	}
+	if err := s.Queue.EnqueueIn(0, task, stepPayload{SagaID: saga.ID, Step: saga.Step}); err != nil {
+		return fmt.Errorf("sagas: %s: %w", saga.ID, err)
+	}
+	return nil
+}
+
+// finish saves saga as finished, in the state it's been given.
+func (s *Sagas) finish(ctx context.Context, saga *Saga) error {
+	finished := clock.Or(s.Clock).Now()
+	saga.FinishedAt = &finished
+	if err := s.save(ctx, saga); err != nil {
+		return err
+	}
+	log.Printf("Sagas: %s %s %s", saga.Name, saga.ID, saga.State)
+	return nil
+}
+
+func (s *Sagas) save(ctx context.Context, saga *Saga) error {
+	saga.UpdatedAt = clock.Or(s.Clock).Now()
+	if err := s.Store.Update(ctx, saga); err != nil {
+		return fmt.Errorf("sagas: %s: %w", saga.ID, err)
+	}
+	return nil
+}
+
+// load returns saga id and its definition, or a nil saga if it's gone.
+func (s *Sagas) load(ctx context.Context, id string) (*Saga, Definition, error) {
+	saga, err := s.Store.Saga(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, Definition{}, nil
+	}
+	if err != nil {
+		return nil, Definition{}, fmt.Errorf("sagas: %s: %w", id, err)
+	}
+	d, ok := s.definitions[saga.Name]
+	if !ok {
+		return nil, Definition{}, fmt.Errorf("sagas: %s: %s is not registered", id, saga.Name)
+	}
+	return saga, d, nil
+}
+
+// Permanent marks err as one retrying won't fix, such as a declined
+// card, so the saga compensates without waiting for its retries to run
+// out.
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", err, asynq.SkipRetry)
+}
+
+// permanent reports whether err is a step's last failure: it's marked
+// Permanent, it's the job's last retry, or the step isn't running in a
+// job that will retry it.
+func permanent(ctx context.Context, err error) bool {
+	if errors.Is(err, asynq.SkipRetry) {
+		return true
+	}
+	retried, ok := asynq.GetRetryCount(ctx)
+	max, hasMax := asynq.GetMaxRetry(ctx)
+	if !ok || !hasMax {
+		return true
+	}
+	return retried >= max
+}
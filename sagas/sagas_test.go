@@ -0,0 +1,226 @@
+package sagas
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQueue records enqueued jobs instead of running them.
+type fakeQueue struct {
+	handlers map[string]func(context.Context, *asynq.Task) error
+	queued   []queuedJob
+}
+
+type queuedJob struct {
+	taskType string
+	payload  stepPayload
+}
+
+func (q *fakeQueue) HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error) {
+	if q.handlers == nil {
+		q.handlers = make(map[string]func(context.Context, *asynq.Task) error)
+	}
+	q.handlers[taskType] = handler
+}
+
+func (q *fakeQueue) EnqueueIn(delay time.Duration, taskType string, payload interface{}) error {
+	q.queued = append(q.queued, queuedJob{taskType: taskType, payload: payload.(stepPayload)})
+	return nil
+}
+
+// run runs queued jobs through their handlers until there are none left,
+// and returns the task types it ran.
+func (q *fakeQueue) run(t *testing.T) []string {
+	t.Helper()
+	var ran []string
+	for len(q.queued) > 0 {
+		job := q.queued[0]
+		q.queued = q.queued[1:]
+		data, err := json.Marshal(job.payload)
+		require.NoError(t, err)
+		require.NoError(t, q.handlers[job.taskType](context.Background(), asynq.NewTask(job.taskType, data)))
+		ran = append(ran, job.taskType)
+	}
+	return ran
+}
+
+// checkout is a three-step saga that logs what it does to calls, and
+// fails at the step named in its "fail" data.
+func checkout(calls *[]string) Definition {
+	step := func(name string, compensate bool) Step {
+		s := Step{
+			Name: name,
+			Do: func(ctx context.Context, s *Saga) error {
+				*calls = append(*calls, name)
+				if s.Data["fail"] == name {
+					return errors.New(name + " unavailable")
+				}
+				s.Data[name] = "ok"
+				return nil
+			},
+		}
+		if compensate {
+			s.Compensate = func(ctx context.Context, s *Saga) error {
+				*calls = append(*calls, "undo "+name)
+				if s.Data["fail undo"] == name {
+					return errors.New("can't undo " + name)
+				}
+				return nil
+			}
+		}
+		return s
+	}
+	return Definition{Name: "checkout", Steps: []Step{step("charge", true), step("reserve", true), step("notify", false), step("ship", false)}}
+}
+
+func newSagas(t *testing.T) (*Sagas, *fakeQueue, *[]string) {
+	t.Helper()
+	queue := &fakeQueue{}
+	s := New(queue, NewMemoryStore())
+	calls := &[]string{}
+	require.NoError(t, s.Register(checkout(calls)))
+	return s, queue, calls
+}
+
+func TestSagaRunsEveryStep(t *testing.T) {
+	ctx := context.Background()
+	s, queue, calls := newSagas(t)
+
+	saga, err := s.Start(ctx, "checkout", map[string]string{"order": "7"})
+	require.NoError(t, err)
+	assert.Equal(t, StateRunning, saga.State)
+	assert.Equal(t, []string{stepTask, stepTask, stepTask, stepTask}, queue.run(t), "each step is its own job")
+	assert.Equal(t, []string{"charge", "reserve", "notify", "ship"}, *calls)
+
+	saga, err = s.Saga(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StateDone, saga.State)
+	assert.True(t, saga.Finished())
+	assert.NotNil(t, saga.FinishedAt)
+	assert.Equal(t, map[string]string{"order": "7", "charge": "ok", "reserve": "ok", "notify": "ok", "ship": "ok"}, saga.Data)
+
+	// a repeated job for a step the saga has moved past does nothing
+	require.NoError(t, s.RunStep(ctx, saga.ID, 1))
+	assert.Len(t, *calls, 4)
+	require.NoError(t, s.RunStep(ctx, "unknown", 0), "a saga that's gone is nothing to do")
+}
+
+func TestSagaCompensates(t *testing.T) {
+	ctx := context.Background()
+	s, queue, calls := newSagas(t)
+
+	saga, err := s.Start(ctx, "checkout", map[string]string{"fail": "ship"})
+	require.NoError(t, err)
+	queue.run(t)
+	assert.Equal(t, []string{"charge", "reserve", "notify", "ship", "undo reserve", "undo charge"}, *calls,
+		"the steps before the failed one are undone, latest first, skipping those with nothing to undo")
+
+	saga, err = s.Saga(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StateCompensated, saga.State)
+	assert.Equal(t, "ship: ship unavailable", saga.Error)
+	assert.NotNil(t, saga.FinishedAt)
+
+	// a failed first step has nothing to undo
+	*calls = nil
+	saga, err = s.Start(ctx, "checkout", map[string]string{"fail": "charge"})
+	require.NoError(t, err)
+	queue.run(t)
+	assert.Equal(t, []string{"charge"}, *calls)
+	saga, err = s.Saga(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StateCompensated, saga.State)
+}
+
+func TestSagaFailsWhenCompensationFails(t *testing.T) {
+	ctx := context.Background()
+	s, queue, calls := newSagas(t)
+
+	saga, err := s.Start(ctx, "checkout", map[string]string{"fail": "notify", "fail undo": "reserve"})
+	require.NoError(t, err)
+	queue.run(t)
+	assert.Equal(t, []string{"charge", "reserve", "notify", "undo reserve"}, *calls, "it stops at the compensation that failed")
+
+	saga, err = s.Saga(ctx, saga.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StateFailed, saga.State)
+	assert.Equal(t, 1, saga.Step, "Step is the step left to undo by hand")
+	assert.Equal(t, "notify: notify unavailable; compensating reserve: can't undo reserve", saga.Error)
+}
+
+func TestPermanent(t *testing.T) {
+	err := Permanent(errors.New("card declined"))
+	assert.ErrorIs(t, err, asynq.SkipRetry)
+	assert.Contains(t, err.Error(), "card declined")
+	assert.True(t, permanent(context.Background(), err))
+	assert.True(t, permanent(context.Background(), errors.New("timeout")), "outside a job nothing retries it")
+}
+
+func TestRegister(t *testing.T) {
+	s := New(&fakeQueue{}, NewMemoryStore())
+	do := func(context.Context, *Saga) error { return nil }
+	assert.Error(t, s.Register(Definition{Steps: []Step{{Name: "a", Do: do}}}))
+	assert.Error(t, s.Register(Definition{Name: "empty"}))
+	assert.Error(t, s.Register(Definition{Name: "nameless", Steps: []Step{{Do: do}}}))
+	require.NoError(t, s.Register(Definition{Name: "one", Steps: []Step{{Name: "a", Do: do}}}))
+	assert.Error(t, s.Register(Definition{Name: "one", Steps: []Step{{Name: "a", Do: do}}}), "names are unique")
+
+	_, err := s.Start(context.Background(), "unknown", nil)
+	assert.Error(t, err)
+}
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	schema, err := os.ReadFile("../db/migrations/sagas/20261017170000_create_sagas.up.sql")
+	require.NoError(t, err)
+	for _, stmt := range strings.Split(string(schema), ";") {
+		if strings.TrimSpace(stmt) != "" {
+			_, err = db.Exec(stmt)
+			require.NoError(t, err)
+		}
+	}
+
+	ctx := context.Background()
+	store := NewSQLStore(db, "sqlite")
+	created := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	saga := &Saga{ID: "s1", Name: "checkout", State: StateRunning, Data: map[string]string{"order": "7"}, CreatedAt: created, UpdatedAt: created}
+	require.NoError(t, store.Create(ctx, saga))
+
+	loaded, err := store.Saga(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "checkout", loaded.Name)
+	assert.Equal(t, StateRunning, loaded.State)
+	assert.Equal(t, map[string]string{"order": "7"}, loaded.Data)
+	assert.Nil(t, loaded.FinishedAt)
+	_, err = store.Saga(ctx, "s2")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	finished := created.Add(time.Minute)
+	loaded.State, loaded.Step, loaded.Error, loaded.FinishedAt = StateCompensated, -1, "ship: no courier", &finished
+	loaded.Data["charge"] = "ch_1"
+	require.NoError(t, store.Update(ctx, loaded))
+	loaded, err = store.Saga(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, StateCompensated, loaded.State)
+	assert.Equal(t, -1, loaded.Step)
+	assert.Equal(t, "ship: no courier", loaded.Error)
+	assert.Equal(t, "ch_1", loaded.Data["charge"])
+	require.NotNil(t, loaded.FinishedAt)
+	assert.True(t, finished.Equal(*loaded.FinishedAt))
+
+	assert.ErrorIs(t, store.Update(ctx, &Saga{ID: "s2"}), ErrNotFound)
+}
@@ -0,0 +1,172 @@
+package sagas
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// MemoryStore keeps sagas in memory, for tests and development.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	sagas map[string]*Saga
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sagas: make(map[string]*Saga)}
+}
+
+// clone copies saga, so callers can't change what's stored.
+func clone(saga *Saga) *Saga {
+	copied := *saga
+	copied.Data = make(map[string]string, len(saga.Data))
+	for k, v := range saga.Data {
+		copied.Data[k] = v
+	}
+	if saga.FinishedAt != nil {
+		finished := *saga.FinishedAt
+		copied.FinishedAt = &finished
+	}
+	return &copied
+}
+
+func (s *MemoryStore) Create(ctx context.Context, saga *Saga) error {
+	if err := readonly.Check("sagas.Create"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sagas[saga.ID] = clone(saga)
+	return nil
+}
+
+func (s *MemoryStore) Saga(ctx context.Context, id string) (*Saga, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	saga, ok := s.sagas[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(saga), nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, saga *Saga) error {
+	if err := readonly.Check("sagas.Update"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sagas[saga.ID]; !ok {
+		return ErrNotFound
+	}
+	s.sagas[saga.ID] = clone(saga)
+	return nil
+}
+
+// SQLStore keeps sagas in the sagas table created by the
+// db/migrations/sagas migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates a saga store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) Create(ctx context.Context, saga *Saga) error {
+	if err := readonly.Check("sagas.Create"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	data, err := encode(saga)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO sagas (id, name, state, step, data, error, created_at, updated_at, finished_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		saga.ID, saga.Name, string(saga.State), saga.Step, data, saga.Error, saga.CreatedAt, saga.UpdatedAt, saga.FinishedAt)
+	return err
+}
+
+func (s *SQLStore) Saga(ctx context.Context, id string) (*Saga, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var saga Saga
+	var state, data string
+	var finishedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT id, name, state, step, data, error, created_at, updated_at, finished_at FROM sagas WHERE id = ?"), id).
+		Scan(&saga.ID, &saga.Name, &state, &saga.Step, &data, &saga.Error, &saga.CreatedAt, &saga.UpdatedAt, &finishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &saga.Data); err != nil {
+		return nil, fmt.Errorf("saga %s: %w", id, err)
+	}
+	if saga.Data == nil {
+		saga.Data = map[string]string{}
+	}
+	saga.State = State(state)
+	if finishedAt.Valid {
+		saga.FinishedAt = &finishedAt.Time
+	}
+	return &saga, nil
+}
+
+func (s *SQLStore) Update(ctx context.Context, saga *Saga) error {
+	if err := readonly.Check("sagas.Update"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	data, err := encode(saga)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"UPDATE sagas SET state = ?, step = ?, data = ?, error = ?, updated_at = ?, finished_at = ? WHERE id = ?"),
+		string(saga.State), saga.Step, data, saga.Error, saga.UpdatedAt, saga.FinishedAt, saga.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// encode returns saga's data as JSON.
+func encode(saga *Saga) (string, error) {
+	data := saga.Data
+	if data == nil {
+		data = map[string]string{}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
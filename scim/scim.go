@@ -0,0 +1,125 @@
+// Package scim serves a SCIM 2.0 (RFC 7643/7644) Users endpoint so an
+// enterprise identity provider such as Okta or Entra ID can provision
+// accounts into the app: create users, update their name and email, and
+// deactivate them when they leave. Requests authenticate with a bearer
+// token shared with the identity provider.
+//
+// Wire mounts it at /scim/v2 when Config.SCIMToken is set. To mount it
+// yourself:
+//
+//	srv := scim.New(store, os.Getenv("SCIM_TOKEN"))
+//	srv.Mount(app)
+//
+// Deleting a user through SCIM deactivates it rather than removing it, so
+// its data stays in place; deactivated users can't log in.
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// SCIM media type and schema URNs.
+const (
+	ContentType = "application/scim+json"
+
+	UserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// DefaultMaxResults caps the users returned by one list request.
+const DefaultMaxResults = 100
+
+// Server serves the SCIM Users resource for users in Store.
+type Server struct {
+	Store auth.ProvisioningStore
+
+	// Token is the bearer token the identity provider sends. An empty
+	// token rejects every request.
+	Token string
+
+	// Path is where Mount puts the endpoint. Defaults to "/scim/v2".
+	Path string
+
+	// MaxResults caps the users returned by one list request. Defaults
+	// to DefaultMaxResults.
+	MaxResults int
+
+	// Clock stamps deactivations. Defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// New creates a Server with default settings.
+func New(store auth.ProvisioningStore, token string) *Server {
+	return &Server{
+		Store:      store,
+		Token:      token,
+		Path:       "/scim/v2",
+		MaxResults: DefaultMaxResults,
+	}
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (s *Server) Routes() [][2]string {
+	users := s.Path + "/Users"
+	return [][2]string{
+		{http.MethodGet, users},
+		{http.MethodPost, users},
+		{http.MethodGet, users + "/{id}"},
+		{http.MethodPut, users + "/{id}"},
+		{http.MethodPatch, users + "/{id}"},
+		{http.MethodDelete, users + "/{id}"},
+	}
+}
+
+// Mount adds the SCIM routes to app, all behind the bearer token.
+func (s *Server) Mount(app *buffalo.App) {
+	requireToken := secure.RequireBearer(s.Token, "scim", unauthorized)
+	users := s.Path + "/Users"
+	app.GET(users, requireToken(s.ListUsers))
+	app.POST(users, requireToken(s.CreateUser))
+	app.GET(users+"/{id}", requireToken(s.GetUser))
+	app.PUT(users+"/{id}", requireToken(s.ReplaceUser))
+	app.PATCH(users+"/{id}", requireToken(s.PatchUser))
+	app.DELETE(users+"/{id}", requireToken(s.DeleteUser))
+}
+
+// unauthorized answers requests without the bearer token.
+func unauthorized(c buffalo.Context) error {
+	return writeError(c, http.StatusUnauthorized, "", "missing or invalid bearer token")
+}
+
+// ErrorResponse is a SCIM error body.
+type ErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// write sends v as a SCIM JSON response.
+func write(c buffalo.Context, status int, v any) error {
+	w := c.Response()
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// writeError sends a SCIM error. scimType is one of the RFC 7644 error
+// types, such as "uniqueness" or "invalidFilter", or empty.
+func writeError(c buffalo.Context, status int, scimType, detail string) error {
+	return write(c, status, ErrorResponse{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,219 @@
+package scim_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/scim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const token = "provisioning-token"
+
+func newSCIMApp(t *testing.T) *buffkittest.App {
+	t.Helper()
+	return buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{SCIMToken: token},
+	})
+}
+
+// do sends a SCIM request with the bearer token and decodes the response
+// into out, when given.
+func do(t *testing.T, app *buffkittest.App, method, path, body string, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", scim.ContentType)
+	res := app.Client().Do(req)
+	if out != nil {
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), out), res.Body.String())
+	}
+	return res
+}
+
+func TestRequiresToken(t *testing.T) {
+	app := newSCIMApp(t)
+
+	for name, header := range map[string]string{
+		"missing": "",
+		"wrong":   "Bearer nope",
+		"basic":   "Basic " + token,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		res := app.Client().Do(req)
+		assert.Equal(t, http.StatusUnauthorized, res.Code, name)
+		assert.Equal(t, scim.ContentType, res.Header().Get("Content-Type"), name)
+	}
+}
+
+func TestProvisioning(t *testing.T) {
+	app := newSCIMApp(t)
+	ctx := context.Background()
+
+	var created scim.User
+	res := do(t, app, http.MethodPost, "/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "Grace@Example.com",
+		"name": {"givenName": "Grace", "familyName": "Hopper"},
+		"active": true
+	}`, &created)
+	require.Equal(t, http.StatusCreated, res.Code, res.Body.String())
+	assert.Equal(t, "grace@example.com", created.UserName)
+	assert.Equal(t, "Grace Hopper", created.DisplayName)
+	assert.True(t, *created.Active)
+	assert.Equal(t, created.Meta.Location, res.Header().Get("Location"))
+
+	user, err := app.Kit.AuthStore.ByEmail(ctx, "grace@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, user.ID)
+
+	t.Run("duplicate userName", func(t *testing.T) {
+		var e scim.ErrorResponse
+		res := do(t, app, http.MethodPost, "/scim/v2/Users", `{"userName": "grace@example.com"}`, &e)
+		assert.Equal(t, http.StatusConflict, res.Code)
+		assert.Equal(t, "uniqueness", e.SCIMType)
+	})
+
+	t.Run("filter by userName", func(t *testing.T) {
+		var list scim.ListResponse
+		q := url.Values{"filter": {`userName eq "grace@example.com"`}}
+		res := do(t, app, http.MethodGet, "/scim/v2/Users?"+q.Encode(), "", &list)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, 1, list.TotalResults)
+		require.Len(t, list.Resources, 1)
+		assert.Equal(t, created.ID, list.Resources[0].ID)
+
+		q = url.Values{"filter": {`userName eq "nobody@example.com"`}}
+		do(t, app, http.MethodGet, "/scim/v2/Users?"+q.Encode(), "", &list)
+		assert.Equal(t, 0, list.TotalResults)
+		assert.Empty(t, list.Resources)
+
+		q = url.Values{"filter": {`emails co "example"`}}
+		res = do(t, app, http.MethodGet, "/scim/v2/Users?"+q.Encode(), "", nil)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		var got scim.User
+		res := do(t, app, http.MethodPut, "/scim/v2/Users/"+created.ID, `{
+			"userName": "grace.hopper@example.com",
+			"displayName": "Rear Admiral Hopper"
+		}`, &got)
+		require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		assert.Equal(t, "grace.hopper@example.com", got.UserName)
+		assert.Equal(t, "Rear Admiral Hopper", got.DisplayName)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		res := do(t, app, http.MethodGet, "/scim/v2/Users/nobody", "", nil)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+	})
+}
+
+func TestDeactivation(t *testing.T) {
+	app := newSCIMApp(t)
+	ctx := context.Background()
+
+	digest, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user := &auth.User{Email: "ada@example.com", PasswordDigest: digest}
+	require.NoError(t, app.Kit.AuthStore.Create(ctx, user))
+
+	login := func() int {
+		return app.Client().Post("/login", url.Values{"email": {"ada@example.com"}, "password": {"password123"}}).Code
+	}
+	require.Equal(t, http.StatusSeeOther, login())
+
+	// Entra ID sends a pathless op with the value as a string
+	var got scim.User
+	res := do(t, app, http.MethodPatch, "/scim/v2/Users/"+user.ID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "value": {"active": "False"}}]
+	}`, &got)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	assert.False(t, *got.Active)
+	assert.Equal(t, app.Clock.Now(), *user.DeactivatedAt)
+	assert.Equal(t, http.StatusUnprocessableEntity, login())
+
+	res = do(t, app, http.MethodPatch, "/scim/v2/Users/"+user.ID, `{
+		"Operations": [{"op": "replace", "path": "active", "value": true}]
+	}`, &got)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	assert.True(t, *got.Active)
+	assert.Equal(t, http.StatusSeeOther, login())
+
+	// DELETE deactivates but keeps the user
+	res = do(t, app, http.MethodDelete, "/scim/v2/Users/"+user.ID, "", nil)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	do(t, app, http.MethodGet, "/scim/v2/Users/"+user.ID, "", &got)
+	assert.False(t, *got.Active)
+	assert.Equal(t, http.StatusUnprocessableEntity, login())
+
+	t.Run("unsupported path", func(t *testing.T) {
+		var e scim.ErrorResponse
+		res := do(t, app, http.MethodPatch, "/scim/v2/Users/"+user.ID, `{
+			"Operations": [{"op": "replace", "path": "title", "value": "Countess"}]
+		}`, &e)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, "invalidPath", e.SCIMType)
+	})
+}
+
+func TestDeactivationEndsSessions(t *testing.T) {
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{SCIMToken: token},
+		Setup: func(app *buffalo.App) {
+			app.GET("/dashboard", buffkit.RequireLogin(func(c buffalo.Context) error {
+				return c.Render(http.StatusOK, render.String("dashboard"))
+			}))
+		},
+	})
+	for i, deactivate := range []func(id string) *httptest.ResponseRecorder{
+		func(id string) *httptest.ResponseRecorder {
+			return do(t, app, http.MethodDelete, "/scim/v2/Users/"+id, "", nil)
+		},
+		func(id string) *httptest.ResponseRecorder {
+			return do(t, app, http.MethodPatch, "/scim/v2/Users/"+id, `{
+				"Operations": [{"op": "replace", "path": "active", "value": false}]
+			}`, nil)
+		},
+	} {
+		user := &auth.User{Email: fmt.Sprintf("user%d@example.com", i)}
+		client := buffkittest.LoginAs(t, app, user)
+		require.Equal(t, http.StatusOK, client.Get("/dashboard").Code)
+
+		res := deactivate(user.ID)
+		require.Less(t, res.Code, 300, res.Body.String())
+		buffkittest.AssertRedirect(t, client.Get("/dashboard"), "/login")
+	}
+}
+
+func TestListPaging(t *testing.T) {
+	app := newSCIMApp(t)
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		require.NoError(t, app.Kit.AuthStore.Create(context.Background(), &auth.User{Email: email}))
+	}
+
+	var list scim.ListResponse
+	res := do(t, app, http.MethodGet, "/scim/v2/Users?startIndex=2&count=1", "", &list)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 3, list.TotalResults)
+	assert.Equal(t, 2, list.StartIndex)
+	require.Len(t, list.Resources, 1)
+	assert.Equal(t, "b@example.com", list.Resources[0].UserName)
+}
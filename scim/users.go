@@ -0,0 +1,444 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+)
+
+// User is the SCIM representation of an auth.User. userName is the
+// user's email address; displayName (or name.formatted) is their display
+// name.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Name is the SCIM name attribute.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Email is one entry of the SCIM emails attribute.
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Meta is the SCIM resource metadata.
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+// ListResponse is a page of users.
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []User   `json:"Resources"`
+}
+
+// email is the address a SCIM user maps to: userName when it looks like
+// an address, otherwise the primary (or first) email.
+func (u User) email() string {
+	email := u.UserName
+	if !strings.Contains(email, "@") {
+		for i, e := range u.Emails {
+			if e.Primary || i == 0 {
+				email = e.Value
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// displayName is displayName, or else the name parts.
+func (u User) displayName() string {
+	if u.DisplayName != "" || u.Name == nil {
+		return strings.TrimSpace(u.DisplayName)
+	}
+	if u.Name.Formatted != "" {
+		return strings.TrimSpace(u.Name.Formatted)
+	}
+	return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+}
+
+// resource converts user for a response.
+func (s *Server) resource(c buffalo.Context, user *auth.User) User {
+	active := user.DeactivatedAt == nil
+	res := User{
+		Schemas:     []string{UserSchema},
+		ID:          user.ID,
+		UserName:    user.Email,
+		DisplayName: user.DisplayName,
+		Emails:      []Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta:        &Meta{ResourceType: "User", Location: s.location(c.Request(), user.ID)},
+	}
+	if user.DisplayName != "" {
+		res.Name = &Name{Formatted: user.DisplayName}
+	}
+	return res
+}
+
+// location is the absolute URL of the user with id.
+func (s *Server) location(r *http.Request, id string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.Path + "/Users/" + id
+}
+
+// userNameFilter matches the one filter identity providers send when
+// looking a user up before creating it.
+var userNameFilter = regexp.MustCompile(`(?i)^\s*userName\s+eq\s+"([^"]*)"\s*$`)
+
+// ListUsers pages through users, 1-based by startIndex and count, or
+// looks one up by filter=userName eq "...".
+func (s *Server) ListUsers(c buffalo.Context) error {
+	q := c.Request().URL.Query()
+	start, err := queryInt(q.Get("startIndex"), 1)
+	if err != nil {
+		return writeError(c, http.StatusBadRequest, "invalidValue", "startIndex must be a number")
+	}
+	count, err := queryInt(q.Get("count"), s.maxResults())
+	if err != nil {
+		return writeError(c, http.StatusBadRequest, "invalidValue", "count must be a number")
+	}
+	start = max(start, 1)
+	count = min(max(count, 0), s.maxResults())
+
+	var users []*auth.User
+	var total int
+	if filter := q.Get("filter"); filter != "" {
+		m := userNameFilter.FindStringSubmatch(filter)
+		if m == nil {
+			return writeError(c, http.StatusBadRequest, "invalidFilter", `only userName eq "..." filters are supported`)
+		}
+		user, err := s.Store.ByEmail(c, strings.ToLower(m[1]))
+		if err != nil && !errors.Is(err, auth.ErrUserNotFound) {
+			return err
+		}
+		if user != nil {
+			total = 1
+			if start == 1 && count > 0 {
+				users = []*auth.User{user}
+			}
+		}
+	} else {
+		users, total, err = s.Store.ListUsers(c, start-1, count)
+		if err != nil {
+			return err
+		}
+	}
+
+	res := ListResponse{
+		Schemas:      []string{ListSchema},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(users),
+		Resources:    make([]User, 0, len(users)),
+	}
+	for _, user := range users {
+		res.Resources = append(res.Resources, s.resource(c, user))
+	}
+	return write(c, http.StatusOK, res)
+}
+
+// CreateUser provisions a user. Users without a password can't log in
+// with one until they reset it, which suits users who sign in through
+// the identity provider.
+func (s *Server) CreateUser(c buffalo.Context) error {
+	var in User
+	if err := json.NewDecoder(c.Request().Body).Decode(&in); err != nil {
+		return writeError(c, http.StatusBadRequest, "invalidSyntax", "invalid JSON body")
+	}
+	email := in.email()
+	if !strings.Contains(email, "@") {
+		return writeError(c, http.StatusBadRequest, "invalidValue", "userName or emails must hold an email address")
+	}
+	if taken, err := s.Store.ExistsEmail(c, email); err != nil {
+		return err
+	} else if taken {
+		return writeError(c, http.StatusConflict, "uniqueness", "a user with that userName already exists")
+	}
+
+	user := &auth.User{Email: email, DisplayName: in.displayName()}
+	if in.Password != "" {
+		digest, err := auth.HashPassword(in.Password)
+		if err != nil {
+			return err
+		}
+		user.PasswordDigest = digest
+	}
+	if in.Active != nil && !*in.Active {
+		now := clock.Or(s.Clock).Now()
+		user.DeactivatedAt = &now
+	}
+
+	err := s.Store.Create(c, user)
+	if errors.Is(err, auth.ErrUserExists) {
+		return writeError(c, http.StatusConflict, "uniqueness", "a user with that userName already exists")
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", s.location(c.Request(), user.ID))
+	return write(c, http.StatusCreated, s.resource(c, user))
+}
+
+// GetUser returns one user.
+func (s *Server) GetUser(c buffalo.Context) error {
+	user, err := s.user(c)
+	if user == nil {
+		return err
+	}
+	return write(c, http.StatusOK, s.resource(c, user))
+}
+
+// ReplaceUser applies a full SCIM user. Attributes Buffkit doesn't store
+// are ignored.
+func (s *Server) ReplaceUser(c buffalo.Context) error {
+	user, err := s.user(c)
+	if user == nil {
+		return err
+	}
+	var in User
+	if err := json.NewDecoder(c.Request().Body).Decode(&in); err != nil {
+		return writeError(c, http.StatusBadRequest, "invalidSyntax", "invalid JSON body")
+	}
+	name := in.displayName()
+	return s.update(c, user, changes{email: in.email(), name: &name, password: in.Password, active: in.Active})
+}
+
+// patchRequest is a SCIM PATCH body.
+type patchRequest struct {
+	Operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	} `json:"Operations"`
+}
+
+// PatchUser applies add and replace operations to active, userName,
+// displayName, name.formatted, and password. An operation without a path
+// takes an object of those attributes, as Entra ID sends.
+func (s *Server) PatchUser(c buffalo.Context) error {
+	user, err := s.user(c)
+	if user == nil {
+		return err
+	}
+	var req patchRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return writeError(c, http.StatusBadRequest, "invalidSyntax", "invalid JSON body")
+	}
+
+	var ch changes
+	for _, op := range req.Operations {
+		if kind := strings.ToLower(op.Op); kind != "add" && kind != "replace" {
+			return writeError(c, http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("unsupported op %q", op.Op))
+		}
+		if op.Path != "" {
+			err = ch.set(op.Path, op.Value)
+		} else {
+			var attrs map[string]json.RawMessage
+			if err = json.Unmarshal(op.Value, &attrs); err != nil {
+				err = errInvalidValue
+			}
+			for path, value := range attrs {
+				if err == nil {
+					err = ch.set(path, value)
+				}
+			}
+		}
+		var pathErr invalidPathError
+		if errors.As(err, &pathErr) {
+			return writeError(c, http.StatusBadRequest, "invalidPath", err.Error())
+		}
+		if err != nil {
+			return writeError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		}
+	}
+	return s.update(c, user, ch)
+}
+
+// DeleteUser deactivates the user and logs them out everywhere. Their
+// record stays so it can be reactivated with active: true.
+func (s *Server) DeleteUser(c buffalo.Context) error {
+	user, err := s.user(c)
+	if user == nil {
+		return err
+	}
+	if user.DeactivatedAt == nil {
+		now := clock.Or(s.Clock).Now()
+		if err := s.deactivate(c, user, &now); err != nil {
+			return err
+		}
+	}
+	return c.Render(http.StatusNoContent, nil)
+}
+
+// changes are the attributes a PUT or PATCH sets; zero values leave the
+// attribute alone.
+type changes struct {
+	email    string
+	name     *string
+	password string
+	active   *bool
+}
+
+var errInvalidValue = errors.New("invalid value")
+
+type invalidPathError string
+
+func (e invalidPathError) Error() string { return fmt.Sprintf("unsupported path %q", string(e)) }
+
+// set records a PATCH of path to raw.
+func (ch *changes) set(path string, raw json.RawMessage) error {
+	switch strings.ToLower(path) {
+	case "active":
+		// Entra ID sends "True" and "False" as strings
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			var s string
+			if json.Unmarshal(raw, &s) != nil {
+				return errInvalidValue
+			}
+			if b, err = strconv.ParseBool(s); err != nil {
+				return errInvalidValue
+			}
+		}
+		ch.active = &b
+		return nil
+	case "username", "displayname", "name.formatted", "password":
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return errInvalidValue
+		}
+		switch strings.ToLower(path) {
+		case "username":
+			ch.email = strings.ToLower(strings.TrimSpace(s))
+		case "password":
+			ch.password = s
+		default:
+			s = strings.TrimSpace(s)
+			ch.name = &s
+		}
+		return nil
+	default:
+		return invalidPathError(path)
+	}
+}
+
+// update applies ch to user and responds with the result.
+func (s *Server) update(c buffalo.Context, user *auth.User, ch changes) error {
+	if ch.email != "" && ch.email != user.Email {
+		if !strings.Contains(ch.email, "@") {
+			return writeError(c, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+		}
+		err := s.Store.UpdateEmail(c, user.ID, ch.email)
+		if errors.Is(err, auth.ErrUserExists) {
+			return writeError(c, http.StatusConflict, "uniqueness", "a user with that userName already exists")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if ch.name != nil && *ch.name != user.DisplayName {
+		if err := s.Store.UpdateDisplayName(c, user.ID, *ch.name); err != nil {
+			return err
+		}
+	}
+	if ch.password != "" {
+		digest, err := auth.HashPassword(ch.password)
+		if err != nil {
+			return err
+		}
+		if err := s.Store.UpdatePassword(c, user.ID, digest); err != nil {
+			return err
+		}
+		if err := auth.PasswordChanged(c, user, "scim"); err != nil {
+			return err
+		}
+	}
+	if ch.active != nil && *ch.active != (user.DeactivatedAt == nil) {
+		var at *time.Time
+		if !*ch.active {
+			now := clock.Or(s.Clock).Now()
+			at = &now
+		}
+		if err := s.deactivate(c, user, at); err != nil {
+			return err
+		}
+	}
+
+	user, err := s.Store.ByID(c, user.ID)
+	if err != nil {
+		return err
+	}
+	return write(c, http.StatusOK, s.resource(c, user))
+}
+
+// deactivate sets or, with a nil at, clears user's deactivation. A
+// deactivated user's sessions are ended so they're logged out right away.
+func (s *Server) deactivate(c buffalo.Context, user *auth.User, at *time.Time) error {
+	if err := s.Store.SetDeactivated(c, user.ID, at); err != nil {
+		return err
+	}
+	if at == nil {
+		return nil
+	}
+	_, err := auth.EndSessions(c, user.ID, "")
+	return err
+}
+
+// user loads the user named by the {id} route parameter. A nil user
+// means the 404 has been sent; the handler returns err as is.
+func (s *Server) user(c buffalo.Context) (*auth.User, error) {
+	user, err := s.Store.ByID(c, c.Param("id"))
+	if errors.Is(err, auth.ErrUserNotFound) {
+		return nil, writeError(c, http.StatusNotFound, "", "user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Server) maxResults() int {
+	if s.MaxResults > 0 {
+		return s.MaxResults
+	}
+	return DefaultMaxResults
+}
+
+// queryInt parses a query parameter, or returns def when it's empty.
+func queryInt(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,47 @@
+package buffkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSecrets(t *testing.T) {
+	assert.Nil(t, Config{}.Secrets())
+	assert.Equal(t, [][]byte{[]byte("a")}, Config{AuthSecret: []byte("a")}.Secrets())
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("a")},
+		Config{AuthSecret: []byte("a"), AuthSecrets: [][]byte{[]byte("b"), []byte("a")}}.Secrets())
+}
+
+func TestSessionStoreRotation(t *testing.T) {
+	oldKey, newKey := []byte("old-secret"), []byte("new-secret")
+
+	// Issue a cookie with the old key
+	before := newSessionStore([][]byte{oldKey}, false)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	sess, err := before.New(req, "_buffalo_session")
+	require.NoError(t, err)
+	sess.Values["user_id"] = "user@example.com"
+	require.NoError(t, sess.Save(req, rec))
+	cookie := rec.Result().Cookies()[0]
+
+	read := func(keys ...[]byte) (interface{}, error) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		sess, err := newSessionStore(keys, false).Get(req, "_buffalo_session")
+		return sess.Values["user_id"], err
+	}
+
+	// After rotation the old cookie still decodes
+	v, err := read(newKey, oldKey)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", v)
+
+	// Once the old key is retired it doesn't
+	_, err = read(newKey)
+	assert.Error(t, err)
+}
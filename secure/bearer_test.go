@@ -0,0 +1,48 @@
+package secure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireBearer(t *testing.T) {
+	reject := func(c buffalo.Context) error {
+		return c.Render(http.StatusUnauthorized, render.String("denied"))
+	}
+	ok := func(c buffalo.Context) error { return c.Render(http.StatusOK, render.String("ok")) }
+
+	app := buffalo.New(buffalo.Options{})
+	app.GET("/api", RequireBearer("s3cret", "api", reject)(ok))
+	app.GET("/none", RequireBearer("", "api", reject)(ok))
+
+	for header, want := range map[string]int{
+		"Bearer s3cret": http.StatusOK,
+		"":              http.StatusUnauthorized,
+		"Bearer nope":   http.StatusUnauthorized,
+		"Basic s3cret":  http.StatusUnauthorized,
+		"s3cret":        http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, req)
+		assert.Equal(t, want, res.Code, header)
+		if want == http.StatusUnauthorized {
+			assert.Equal(t, `Bearer realm="api"`, res.Header().Get("WWW-Authenticate"), header)
+			assert.Equal(t, "denied", res.Body.String(), header)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/none", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusUnauthorized, res.Code, "an empty token lets nobody in")
+}
@@ -0,0 +1,129 @@
+package secure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// BodyLimits caps the size of request bodies. Wire installs it with
+// Config.MaxBodySize and Config.MaxBodySizes.
+type BodyLimits struct {
+	// Max is the largest body, in bytes, of requests not under Paths.
+	// Zero doesn't limit them.
+	Max int64
+
+	// Paths sets the limit of requests whose path is under a prefix,
+	// raising or lowering Max for them, e.g. {"/uploads": 50 << 20}. The
+	// longest matching prefix wins. Zero doesn't limit them.
+	Paths map[string]int64
+}
+
+// TooLargeError is returned, with status 413, for requests whose body
+// is over its limit.
+type TooLargeError struct {
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("secure: request body is larger than %s", FormatBytes(e.Limit))
+}
+
+// PublicMessage is shown on the 413 page by views.ErrorHandler.
+func (e *TooLargeError) PublicMessage() string {
+	return fmt.Sprintf("What you sent is too large. The limit is %s.", FormatBytes(e.Limit))
+}
+
+// Limit returns the limit of requests to path.
+func (l BodyLimits) Limit(path string) int64 {
+	limit, longest := l.Max, -1
+	for prefix, n := range l.Paths {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > longest {
+			limit, longest = n, len(prefix)
+		}
+	}
+	return limit
+}
+
+// BodyLimitMiddleware answers 413 Request Entity Too Large, through the
+// app's error handler for the status, to requests whose body is over
+// its limit: at once when Content-Length says so, or when the handler
+// reads past the limit and fails. Install views.ErrorHandler for 413 to
+// show Buffkit's error page.
+func BodyLimitMiddleware(limits BodyLimits) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			limit := limits.Limit(c.Request().URL.Path)
+			if limit <= 0 {
+				return next(c)
+			}
+			return limitBody(c, limit, next)
+		}
+	}
+}
+
+// MaxBody limits the bodies of a route or group's requests to max bytes,
+// like BodyLimitMiddleware:
+//
+//	app.POST("/feedback", secure.MaxBody(64<<10)(FeedbackHandler))
+//
+// It can only lower the app's limit, which has already applied by the
+// time it runs; raise it for a path with BodyLimits.Paths.
+func MaxBody(max int64) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			return limitBody(c, max, next)
+		}
+	}
+}
+
+func limitBody(c buffalo.Context, limit int64, next buffalo.Handler) error {
+	r := c.Request()
+	if r.ContentLength > limit {
+		return c.Error(http.StatusRequestEntityTooLarge, &TooLargeError{Limit: limit})
+	}
+	body := &limitedBody{ReadCloser: http.MaxBytesReader(c.Response(), r.Body, limit)}
+	r.Body = body
+	err := next(c)
+	if err != nil && body.exceeded {
+		return c.Error(http.StatusRequestEntityTooLarge, &TooLargeError{Limit: limit})
+	}
+	return err
+}
+
+// limitedBody notes when the handler read past the limit, however it
+// reported the error.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// FormatBytes formats n bytes for people: "512 bytes", "64 KB", "1.5 MB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	value, suffix := float64(n)/unit, "KB"
+	for _, next := range []string{"MB", "GB", "TB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + " " + suffix
+}
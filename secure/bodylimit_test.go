@@ -0,0 +1,81 @@
+package secure
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyLimitsLimit(t *testing.T) {
+	limits := BodyLimits{Max: 100, Paths: map[string]int64{
+		"/uploads":        1000,
+		"/uploads/small/": 10,
+		"/open":           0,
+	}}
+	assert.Equal(t, int64(100), limits.Limit("/"))
+	assert.Equal(t, int64(100), limits.Limit("/uploadsx"))
+	assert.Equal(t, int64(1000), limits.Limit("/uploads"))
+	assert.Equal(t, int64(1000), limits.Limit("/uploads/big/"))
+	assert.Equal(t, int64(10), limits.Limit("/uploads/small/"))
+	assert.Equal(t, int64(0), limits.Limit("/open/"))
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	app := buffalo.New(buffalo.Options{})
+	app.Use(BodyLimitMiddleware(BodyLimits{Max: 16, Paths: map[string]int64{"/big": 1024}}))
+	read := func(c buffalo.Context) error {
+		if _, err := io.ReadAll(c.Request().Body); err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, nil)
+	}
+	app.POST("/small", read)
+	app.POST("/big", read)
+	app.POST("/tiny", MaxBody(4)(read))
+
+	post := func(path, body string, streamed bool) int {
+		var r io.Reader = strings.NewReader(body)
+		if streamed {
+			r = io.MultiReader(r) // hides the length
+		}
+		req := httptest.NewRequest(http.MethodPost, path, r)
+		if streamed {
+			req.ContentLength = -1
+		}
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	long := strings.Repeat("x", 100)
+	assert.Equal(t, http.StatusOK, post("/small", "short", false))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/small", long, false))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/small", long, true), "read past the limit")
+	assert.Equal(t, http.StatusOK, post("/big", long, true))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/tiny", "short", false))
+}
+
+func TestTooLargeError(t *testing.T) {
+	err := &TooLargeError{Limit: 2 << 20}
+	require.Contains(t, err.Error(), "2 MB")
+	assert.Equal(t, "What you sent is too large. The limit is 2 MB.", err.PublicMessage())
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:          "0 bytes",
+		512:        "512 bytes",
+		64 << 10:   "64 KB",
+		1536 << 10: "1.5 MB",
+		3 << 30:    "3 GB",
+		5 << 40:    "5 TB",
+	} {
+		assert.Equal(t, want, FormatBytes(n), n)
+	}
+}
@@ -0,0 +1,115 @@
+package secure
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// errNoKeyring is returned by the encrypted column types before Wire.
+var errNoKeyring = errors.New("secure: no keyring; call UseKeyring (Wire does)")
+
+// EncryptedString is a string stored encrypted, with a random nonce, by
+// the keyring set with UseKeyring. Use it as a model field's type and
+// the column holds ciphertext while the field holds the value:
+//
+//	type Patient struct {
+//	    Notes secure.EncryptedString `db:"notes"`
+//	}
+//
+// The column should be TEXT. Empty strings are stored empty.
+type EncryptedString string
+
+// Value encrypts s for the database.
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	k := CurrentKeyring()
+	if k == nil {
+		return nil, errNoKeyring
+	}
+	return k.Encrypt(string(s))
+}
+
+// Scan decrypts a column value into s.
+func (s *EncryptedString) Scan(src any) error {
+	plain, err := scanEncrypted(src)
+	*s = EncryptedString(plain)
+	return err
+}
+
+// String returns s as a string.
+func (s EncryptedString) String() string {
+	return string(s)
+}
+
+// DeterministicString is EncryptedString encrypted deterministically, so
+// rows can be found by it: query with the value's Lookups.
+//
+//	type User struct {
+//	    Email secure.DeterministicString `db:"email"`
+//	}
+//
+// The column should be VARCHAR(512), or TEXT, and can be indexed.
+type DeterministicString string
+
+// Value encrypts s for the database.
+func (s DeterministicString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	k := CurrentKeyring()
+	if k == nil {
+		return nil, errNoKeyring
+	}
+	return k.EncryptDeterministic(string(s)), nil
+}
+
+// Scan decrypts a column value into s.
+func (s *DeterministicString) Scan(src any) error {
+	plain, err := scanEncrypted(src)
+	*s = DeterministicString(plain)
+	return err
+}
+
+// String returns s as a string.
+func (s DeterministicString) String() string {
+	return string(s)
+}
+
+// Lookups returns s as it's stored under each of the keyring's keys,
+// for WHERE column IN (...) queries.
+func (s DeterministicString) Lookups() ([]any, error) {
+	k := CurrentKeyring()
+	if k == nil {
+		return nil, errNoKeyring
+	}
+	var out []any
+	for _, v := range k.Lookups(string(s)) {
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func scanEncrypted(src any) (string, error) {
+	var ciphertext string
+	switch v := src.(type) {
+	case nil:
+		return "", nil
+	case string:
+		ciphertext = v
+	case []byte:
+		ciphertext = string(v)
+	default:
+		return "", fmt.Errorf("secure: can't decrypt a %T", src)
+	}
+	if ciphertext == "" {
+		return "", nil
+	}
+	k := CurrentKeyring()
+	if k == nil {
+		return "", errNoKeyring
+	}
+	return k.Decrypt(ciphertext)
+}
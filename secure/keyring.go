@@ -0,0 +1,246 @@
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrUndecryptable is returned for ciphertext no key in the keyring
+// opens: it was tampered with, or its key has been retired.
+var ErrUndecryptable = errors.New("secure: value can't be decrypted")
+
+// Keyring encrypts sensitive values, such as database columns, with
+// AES-256-GCM. Its keys are derived from the app's secrets, so there is
+// nothing new to manage: Wire builds one from Config.AuthSecrets as
+// kit.Keyring. The first secret's key encrypts and every key decrypts,
+// so secrets rotate the same way as for signed URLs; re-encrypt values
+// to retire an old secret.
+//
+// Encrypt gives a different ciphertext each time. EncryptDeterministic
+// gives the same one for the same value, so the column can be searched
+// with an equality match (see Lookups), at the cost of showing which
+// rows hold equal values. Keep it for fields you must look up by.
+type Keyring struct {
+	keys []keyringKey
+}
+
+// keyringKey is the key derived from one secret.
+type keyringKey struct {
+	id    string // identifies the key in ciphertext
+	aead  cipher.AEAD
+	nonce []byte // HMAC key deriving deterministic nonces
+}
+
+// NewKeyring creates a keyring from secrets. secrets[0] encrypts; all
+// of them decrypt.
+func NewKeyring(secrets ...[]byte) (*Keyring, error) {
+	if len(secrets) == 0 || len(secrets[0]) == 0 {
+		return nil, errors.New("secure: keyring has no secret")
+	}
+	k := &Keyring{}
+	for _, secret := range secrets {
+		enc := derive(secret, "buffkit field encryption")
+		block, err := aes.NewCipher(enc)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := sha256.Sum256(enc)
+		k.keys = append(k.keys, keyringKey{
+			id:    hex.EncodeToString(id[:4]),
+			aead:  aead,
+			nonce: derive(secret, "buffkit field encryption nonce"),
+		})
+	}
+	return k, nil
+}
+
+// derive returns a 32 byte key for purpose from secret.
+func derive(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Encrypt encrypts plain with a random nonce. The result is text, safe
+// to store in a TEXT column.
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	key := k.keys[0]
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("secure: encrypt: %w", err)
+	}
+	return key.seal(nonce, plain), nil
+}
+
+// EncryptDeterministic encrypts plain so that the same value always
+// gives the same ciphertext under the same key. The nonce is an HMAC of
+// the value, so different values don't share one.
+func (k *Keyring) EncryptDeterministic(plain string) string {
+	return k.keys[0].deterministic(plain)
+}
+
+// Lookups returns plain encrypted deterministically with each key, for
+// finding rows by an encrypted column while secrets are being rotated:
+//
+//	values := kit.Keyring.Lookups(email)
+//	// SELECT ... WHERE email IN (?, ?) with values
+func (k *Keyring) Lookups(plain string) []string {
+	out := make([]string, len(k.keys))
+	for i, key := range k.keys {
+		out[i] = key.deterministic(plain)
+	}
+	return out
+}
+
+// Decrypt decrypts what Encrypt or EncryptDeterministic returned, with
+// whichever key encrypted it.
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	id, data, ok := strings.Cut(ciphertext, "$")
+	if !ok {
+		return "", ErrUndecryptable
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return "", ErrUndecryptable
+	}
+	for _, key := range k.keys {
+		if key.id != id || len(sealed) < key.aead.NonceSize() {
+			continue
+		}
+		n := key.aead.NonceSize()
+		plain, err := key.aead.Open(nil, sealed[:n], sealed[n:], []byte(id))
+		if err == nil {
+			return string(plain), nil
+		}
+	}
+	return "", ErrUndecryptable
+}
+
+// Encrypted reports whether s looks like ciphertext from one of the
+// keyring's keys, for migrations that encrypt a column in place.
+func (k *Keyring) Encrypted(s string) bool {
+	id, data, ok := strings.Cut(s, "$")
+	if !ok {
+		return false
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(data); err != nil {
+		return false
+	}
+	for _, key := range k.keys {
+		if key.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (key keyringKey) deterministic(plain string) string {
+	mac := hmac.New(sha256.New, key.nonce)
+	mac.Write([]byte(plain))
+	return key.seal(mac.Sum(nil)[:key.aead.NonceSize()], plain)
+}
+
+// seal returns "<key id>$<nonce and ciphertext>". The key ID is also
+// authenticated, so ciphertext can't be moved to another key.
+func (key keyringKey) seal(nonce []byte, plain string) string {
+	sealed := key.aead.Seal(nonce, nonce, []byte(plain), []byte(key.id))
+	return key.id + "$" + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// EncryptFields encrypts the string fields of the struct v points to
+// that are tagged encrypt:"random" or encrypt:"deterministic", in place.
+// Empty strings are left empty. Use it before saving a record, and
+// DecryptFields after loading one:
+//
+//	type Patient struct {
+//	    Name string
+//	    SSN  string `encrypt:"deterministic"`
+//	    Notes string `encrypt:"random"`
+//	}
+func (k *Keyring) EncryptFields(v any) error {
+	return k.fields(v, func(tag, s string) (string, error) {
+		if tag == "deterministic" {
+			return k.EncryptDeterministic(s), nil
+		}
+		return k.Encrypt(s)
+	})
+}
+
+// DecryptFields decrypts the fields EncryptFields encrypts, in place.
+func (k *Keyring) DecryptFields(v any) error {
+	return k.fields(v, func(tag, s string) (string, error) {
+		return k.Decrypt(s)
+	})
+}
+
+// fields applies fn to v's tagged, non-empty string fields.
+func (k *Keyring) fields(v any, fn func(tag, s string) (string, error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("secure: encrypting fields needs a pointer to a struct, got %T", v)
+	}
+	rv = rv.Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		tag, ok := f.Tag.Lookup("encrypt")
+		if !ok {
+			continue
+		}
+		if tag != "random" && tag != "deterministic" {
+			return fmt.Errorf("secure: %s: encrypt tag must be \"random\" or \"deterministic\", not %q", f.Name, tag)
+		}
+		field := rv.Field(i)
+		if field.Kind() == reflect.Pointer && field.Type().Elem().Kind() == reflect.String {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		if field.Kind() != reflect.String || !field.CanSet() {
+			return fmt.Errorf("secure: %s: only exported string fields can be encrypted", f.Name)
+		}
+		if field.String() == "" {
+			continue
+		}
+		s, err := fn(tag, field.String())
+		if err != nil {
+			return fmt.Errorf("secure: %s: %w", f.Name, err)
+		}
+		field.SetString(s)
+	}
+	return nil
+}
+
+var (
+	keyringMu     sync.RWMutex
+	globalKeyring *Keyring
+)
+
+// UseKeyring sets the keyring EncryptedString and DeterministicString
+// use. Wire calls it with kit.Keyring.
+func UseKeyring(k *Keyring) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	globalKeyring = k
+}
+
+// CurrentKeyring returns the keyring set by UseKeyring, or nil.
+func CurrentKeyring() *Keyring {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+	return globalKeyring
+}
@@ -0,0 +1,146 @@
+package secure
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring(t *testing.T) {
+	k, err := NewKeyring([]byte("current-key"))
+	require.NoError(t, err)
+
+	a, err := k.Encrypt("123-45-6789")
+	require.NoError(t, err)
+	b, err := k.Encrypt("123-45-6789")
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b, "random nonces")
+	assert.NotContains(t, a, "6789")
+	plain, err := k.Decrypt(a)
+	require.NoError(t, err)
+	assert.Equal(t, "123-45-6789", plain)
+
+	d := k.EncryptDeterministic("ada@example.com")
+	assert.Equal(t, d, k.EncryptDeterministic("ada@example.com"))
+	assert.NotEqual(t, d, k.EncryptDeterministic("grace@example.com"))
+	plain, err = k.Decrypt(d)
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", plain)
+	assert.True(t, k.Encrypted(d))
+	assert.False(t, k.Encrypted("ada@example.com"))
+
+	// Tampering and foreign keys are refused
+	other, err := NewKeyring([]byte("other-key"))
+	require.NoError(t, err)
+	_, err = other.Decrypt(a)
+	assert.ErrorIs(t, err, ErrUndecryptable)
+	assert.False(t, other.Encrypted(a))
+	tampered := []byte(a)
+	i := strings.Index(a, "$") + 20
+	tampered[i] = map[bool]byte{true: 'B', false: 'A'}[tampered[i] == 'A']
+	_, err = k.Decrypt(string(tampered))
+	assert.ErrorIs(t, err, ErrUndecryptable)
+	_, err = k.Decrypt("plain text")
+	assert.ErrorIs(t, err, ErrUndecryptable)
+
+	_, err = NewKeyring()
+	assert.Error(t, err)
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := NewKeyring([]byte("old-key"))
+	require.NoError(t, err)
+	before, err := old.Encrypt("secret")
+	require.NoError(t, err)
+	beforeLookup := old.EncryptDeterministic("ada@example.com")
+
+	rotated, err := NewKeyring([]byte("new-key"), []byte("old-key"))
+	require.NoError(t, err)
+	plain, err := rotated.Decrypt(before)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", plain)
+
+	// New values use the new key, and lookups find rows under either
+	lookups := rotated.Lookups("ada@example.com")
+	require.Len(t, lookups, 2)
+	assert.Equal(t, rotated.EncryptDeterministic("ada@example.com"), lookups[0])
+	assert.Equal(t, beforeLookup, lookups[1])
+	assert.NotEqual(t, beforeLookup, lookups[0])
+}
+
+func TestEncryptFields(t *testing.T) {
+	k, err := NewKeyring([]byte("current-key"))
+	require.NoError(t, err)
+
+	type patient struct {
+		Name  string
+		SSN   string  `encrypt:"deterministic"`
+		Notes *string `encrypt:"random"`
+		Blank string  `encrypt:"random"`
+	}
+	notes := "allergic to penicillin"
+	p := patient{Name: "Ada", SSN: "123-45-6789", Notes: &notes}
+	require.NoError(t, k.EncryptFields(&p))
+	assert.Equal(t, "Ada", p.Name)
+	assert.Equal(t, k.EncryptDeterministic("123-45-6789"), p.SSN)
+	assert.True(t, k.Encrypted(*p.Notes))
+	assert.Empty(t, p.Blank)
+
+	require.NoError(t, k.DecryptFields(&p))
+	assert.Equal(t, "123-45-6789", p.SSN)
+	assert.Equal(t, "allergic to penicillin", *p.Notes)
+
+	assert.Error(t, k.EncryptFields(p), "needs a pointer")
+	bad := struct {
+		Age int `encrypt:"random"`
+	}{Age: 3}
+	assert.Error(t, k.EncryptFields(&bad))
+	wrongTag := struct {
+		SSN string `encrypt:"yes"`
+	}{SSN: "1"}
+	assert.Error(t, k.EncryptFields(&wrongTag))
+}
+
+func TestEncryptedColumns(t *testing.T) {
+	UseKeyring(nil)
+	_, err := EncryptedString("x").Value()
+	assert.Error(t, err, "no keyring yet")
+
+	k, err := NewKeyring([]byte("current-key"))
+	require.NoError(t, err)
+	UseKeyring(k)
+	t.Cleanup(func() { UseKeyring(nil) })
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE patients (email VARCHAR(512) NOT NULL, notes TEXT)`)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO patients (email, notes) VALUES (?, ?), (?, ?)`,
+		DeterministicString("ada@example.com"), EncryptedString("private"),
+		DeterministicString("grace@example.com"), (*EncryptedString)(nil))
+	require.NoError(t, err)
+
+	var raw string
+	require.NoError(t, db.QueryRow(`SELECT notes FROM patients WHERE notes IS NOT NULL`).Scan(&raw))
+	assert.NotEqual(t, "private", raw, "stored encrypted")
+
+	lookups, err := DeterministicString("ada@example.com").Lookups()
+	require.NoError(t, err)
+	var email DeterministicString
+	var notes *EncryptedString
+	require.NoError(t, db.QueryRow(`SELECT email, notes FROM patients WHERE email IN (?)`, lookups...).Scan(&email, &notes))
+	assert.Equal(t, "ada@example.com", email.String())
+	require.NotNil(t, notes)
+	assert.Equal(t, "private", notes.String())
+
+	lookups, err = DeterministicString("grace@example.com").Lookups()
+	require.NoError(t, err)
+	require.NoError(t, db.QueryRow(`SELECT email, notes FROM patients WHERE email IN (?)`, lookups...).Scan(&email, &notes))
+	assert.Nil(t, notes)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/internalpath"
 )
 
 // Options configures the security middleware
@@ -70,51 +71,72 @@ func Middleware(opts Options) buffalo.MiddlewareFunc {
 
 	return func(next buffalo.Handler) buffalo.Handler {
 		return func(c buffalo.Context) error {
-			// Get response writer
-			w := c.Response()
+			// Note which headers are set, for Skip
+			var set []string
+			header := func(name, value string) {
+				c.Response().Header().Set(name, value)
+				set = append(set, name)
+			}
 
 			// Apply security headers
 			if opts.ContentTypeNosniff {
-				w.Header().Set("X-Content-Type-Options", "nosniff")
+				header("X-Content-Type-Options", "nosniff")
 			}
 
 			// Frame options
 			if opts.FrameDeny {
-				w.Header().Set("X-Frame-Options", "DENY")
+				header("X-Frame-Options", "DENY")
 			} else if opts.FrameSameOrigin {
-				w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+				header("X-Frame-Options", "SAMEORIGIN")
 			}
 
 			// XSS Protection
 			if opts.XSSProtection {
-				w.Header().Set("X-XSS-Protection", "1; mode=block")
+				header("X-XSS-Protection", "1; mode=block")
 			}
 
 			// Content Security Policy
 			if opts.ContentSecurityPolicy != "" {
-				w.Header().Set("Content-Security-Policy", opts.ContentSecurityPolicy)
+				header("Content-Security-Policy", opts.ContentSecurityPolicy)
 			}
 
 			// Strict Transport Security (only in production)
 			if !opts.DevMode && opts.STSSeconds > 0 {
 				value := formatSTSHeader(opts.STSSeconds, opts.STSIncludeSubdomains, opts.STSPreload)
-				w.Header().Set("Strict-Transport-Security", value)
+				header("Strict-Transport-Security", value)
 			}
 
 			// Referrer Policy
 			if opts.ReferrerPolicy != "" {
-				w.Header().Set("Referrer-Policy", opts.ReferrerPolicy)
+				header("Referrer-Policy", opts.ReferrerPolicy)
 			}
 
 			// Additional security headers
-			w.Header().Set("X-Permitted-Cross-Domain-Policies", "none")
-			w.Header().Set("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
+			header("X-Permitted-Cross-Domain-Policies", "none")
+			header("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
+
+			c.Set(skipKey, set)
 
 			return next(c)
 		}
 	}
 }
 
+// skipKey is where Middleware keeps, in the Buffalo context, the headers
+// it set for the request.
+const skipKey = "secure.headers"
+
+// Skip removes the headers Middleware set for the request c, for routes
+// that need to go without them, such as a webhook receiver or a file
+// meant to be framed by another site. Call it before writing the
+// response; buffkit.Skip does.
+func Skip(c buffalo.Context) {
+	names, _ := c.Value(skipKey).([]string)
+	for _, name := range names {
+		c.Response().Header().Del(name)
+	}
+}
+
 // CSRFMiddleware wraps Buffalo's CSRF middleware with better defaults
 func CSRFMiddleware() buffalo.MiddlewareFunc {
 	return func(next buffalo.Handler) buffalo.Handler {
@@ -166,7 +188,22 @@ func CSRFMiddleware() buffalo.MiddlewareFunc {
 	}
 }
 
-// RateLimitMiddleware provides basic rate limiting
+// CSRFToken returns the request's CSRF token: Buffalo's when its CSRF
+// middleware is installed, otherwise the one CSRFMiddleware keeps in the
+// session. Forms send it back as the authenticity_token field.
+func CSRFToken(c buffalo.Context) string {
+	if token, ok := c.Value("authenticity_token").(string); ok {
+		return token
+	}
+	if token, ok := c.Session().Get("csrf_token").(string); ok {
+		return token
+	}
+	return ""
+}
+
+// RateLimitMiddleware provides basic rate limiting. Buffkit's own
+// endpoints (see internalpath) aren't limited, so SSE reconnects and
+// health checks don't use up a client's allowance.
 func RateLimitMiddleware(requestsPerMinute int) buffalo.MiddlewareFunc {
 	// Simple in-memory rate limiter (for demo purposes)
 	// In production, use a proper rate limiter with Redis
@@ -174,6 +211,10 @@ func RateLimitMiddleware(requestsPerMinute int) buffalo.MiddlewareFunc {
 
 	return func(next buffalo.Handler) buffalo.Handler {
 		return func(c buffalo.Context) error {
+			if internalpath.Is(c.Request().URL.Path) {
+				return next(c)
+			}
+
 			// Get client IP
 			ip := getClientIP(c.Request())
 
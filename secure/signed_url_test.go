@@ -0,0 +1,114 @@
+package secure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner([]byte("current-key"))
+
+	link, err := signer.Sign("/downloads/report.pdf?format=a4", time.Now().Add(time.Hour), map[string]string{"user": "42"})
+	require.NoError(t, err)
+
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+
+	claims, err := signer.Verify(u)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"user": "42", "format": "a4"}, claims)
+
+	t.Run("tampered claim", func(t *testing.T) {
+		bad, _ := url.Parse(strings.Replace(link, "user=42", "user=43", 1))
+		_, err := signer.Verify(bad)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("tampered path", func(t *testing.T) {
+		bad, _ := url.Parse(strings.Replace(link, "report", "secret", 1))
+		_, err := signer.Verify(bad)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		old, err := signer.Sign("/downloads/report.pdf", time.Now().Add(-time.Second), nil)
+		require.NoError(t, err)
+		u, _ := url.Parse(old)
+		_, err = signer.Verify(u)
+		assert.ErrorIs(t, err, ErrExpiredSignature)
+	})
+
+	t.Run("reserved claim", func(t *testing.T) {
+		_, err := signer.Sign("/x", time.Now().Add(time.Hour), map[string]string{"expires": "never"})
+		assert.Error(t, err)
+	})
+}
+
+func TestURLSignerKeyRotation(t *testing.T) {
+	oldSigner := NewURLSigner([]byte("old-key"))
+	link, err := oldSigner.Sign("/preview", time.Now().Add(time.Hour), nil)
+	require.NoError(t, err)
+	u, _ := url.Parse(link)
+
+	rotated := NewURLSigner([]byte("new-key"), []byte("old-key"))
+	_, err = rotated.Verify(u)
+	assert.NoError(t, err, "links signed with a previous key should still verify")
+
+	retired := NewURLSigner([]byte("new-key"))
+	_, err = retired.Verify(u)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestURLSignerClock(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	signer := NewURLSigner([]byte("key"))
+	signer.SetClock(clk)
+
+	link, err := signer.Sign("/preview", clk.Now().Add(time.Hour), nil)
+	require.NoError(t, err)
+	u, _ := url.Parse(link)
+
+	_, err = signer.Verify(u)
+	require.NoError(t, err)
+
+	clk.Advance(time.Hour + time.Second)
+	_, err = signer.Verify(u)
+	assert.ErrorIs(t, err, ErrExpiredSignature)
+}
+
+func TestSignedURLMiddleware(t *testing.T) {
+	signer := NewURLSigner([]byte("key"))
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/files/{name}", SignedURLMiddleware(signer)(func(c buffalo.Context) error {
+		claims := c.Value(SignedClaimsKey).(map[string]string)
+		_, err := c.Response().Write([]byte(claims["user"]))
+		return err
+	}))
+
+	valid, _ := signer.Sign("/files/a.txt", time.Now().Add(time.Minute), map[string]string{"user": "7"})
+	expired, _ := signer.Sign("/files/a.txt", time.Now().Add(-time.Minute), nil)
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{valid, http.StatusOK},
+		{expired, http.StatusGone},
+		{"/files/a.txt", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, httptest.NewRequest("GET", tt.url, nil))
+		assert.Equal(t, tt.status, res.Code, tt.url)
+	}
+}
@@ -0,0 +1,630 @@
+// Package settings keeps application and per-user settings, so apps
+// don't each invent a settings table. Settings are defined up front,
+// with a kind, a default and a label for the admin page:
+//
+//	kit.Settings.Define(settings.Setting{Key: "signups_open", Kind: settings.Bool, Default: "true"})
+//	kit.Settings.Define(settings.Setting{Key: "digest_every", Kind: settings.Duration, Default: "24h", User: true})
+//
+//	open, err := kit.Settings.Bool(ctx, "signups_open")
+//	every, err := kit.Settings.User(userID).Duration(ctx, "digest_every")
+//
+// Settings marked User can also be set for each user, whose value
+// overrides the application's. Values are cached for TTL, so reading a
+// setting on every request doesn't hit the database each time.
+//
+// Wire mounts the admin page when Config.Settings is set; CanEdit says
+// who may use it.
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/views"
+)
+
+// DefaultTTL is how long values are cached when TTL isn't set.
+const DefaultTTL = 30 * time.Second
+
+// ErrUndefined is returned for keys no Setting defines.
+var ErrUndefined = auth.NotFoundError("settings: setting not defined")
+
+// Kind is the type of a setting's value.
+type Kind string
+
+// Kinds of setting. Values are stored as text: "true" and "false" for
+// Bool, and Duration in time.ParseDuration's form, such as "1h30m".
+const (
+	String   Kind = "string"
+	Bool     Kind = "bool"
+	Int      Kind = "int"
+	Float    Kind = "float"
+	Duration Kind = "duration"
+)
+
+// Setting defines a setting.
+type Setting struct {
+	// Key names the setting: letters, digits, underscores, dots and
+	// hyphens.
+	Key  string
+	Kind Kind
+
+	// Default is the value until one is set, as text.
+	Default string
+
+	// Label and Help describe the setting on the admin page. Label
+	// defaults to Key.
+	Label string
+	Help  string
+
+	// Choices, when set, are the only values a String setting takes.
+	Choices []string
+
+	// User lets each user set their own value, overriding the
+	// application's.
+	User bool
+}
+
+// Store keeps the values that have been set. The application's values
+// are kept under the empty scope, and each user's under their ID.
+// MemoryStore suits tests and development; SQLStore keeps them in the
+// database.
+type Store interface {
+	// Values returns scope's values, by key.
+	Values(ctx context.Context, scope string) (map[string]string, error)
+
+	// Set sets scope's value for key.
+	Set(ctx context.Context, scope, key, value string, at time.Time) error
+
+	// Delete removes scope's value for key, if it has one.
+	Delete(ctx context.Context, scope, key string) error
+}
+
+// Settings reads and writes settings, caching what it reads.
+type Settings struct {
+	Store Store
+
+	// Path is where the admin page is mounted. Defaults to "/settings".
+	Path string
+
+	// TTL is how long values are cached. Other processes see a change
+	// once their cache expires. Defaults to DefaultTTL; negative disables
+	// caching.
+	TTL time.Duration
+
+	// CanEdit reports whether the request may use the admin page. Nil
+	// lets no one.
+	CanEdit func(c buffalo.Context) bool
+
+	Clock clock.Clock
+
+	mu       sync.RWMutex
+	defined  map[string]Setting
+	order    []string
+	cache    map[string]cached
+	cacheGen uint64
+}
+
+// cached is a scope's values, until expires.
+type cached struct {
+	values  map[string]string
+	expires time.Time
+}
+
+// New creates a Settings that keeps values in store.
+func New(store Store) *Settings {
+	return &Settings{Store: store, defined: make(map[string]Setting), cache: make(map[string]cached)}
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,255}$`)
+
+// Define adds setting. Its Default must be a valid value; Kind
+// defaults to String.
+func (s *Settings) Define(setting Setting) error {
+	switch setting.Kind {
+	case String, Bool, Int, Float, Duration:
+	case "":
+		setting.Kind = String
+	default:
+		return fmt.Errorf("settings: %s: unknown kind %q", setting.Key, setting.Kind)
+	}
+	if !keyPattern.MatchString(setting.Key) {
+		return fmt.Errorf("settings: invalid key %q", setting.Key)
+	}
+	if len(setting.Choices) > 0 && setting.Kind != String {
+		return fmt.Errorf("settings: %s: only string settings have choices", setting.Key)
+	}
+	if _, err := setting.parse(setting.Default); err != nil {
+		return fmt.Errorf("settings: %s: default: %w", setting.Key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.defined[setting.Key]; exists {
+		return fmt.Errorf("settings: %s is already defined", setting.Key)
+	}
+	s.defined[setting.Key] = setting
+	s.order = append(s.order, setting.Key)
+	return nil
+}
+
+// Defined returns the settings defined, in the order they were.
+func (s *Settings) Defined() []Setting {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Setting, len(s.order))
+	for i, key := range s.order {
+		out[i] = s.defined[key]
+	}
+	return out
+}
+
+// User returns the settings as user sees them: their own values for
+// User settings, and the application's otherwise.
+func (s *Settings) User(id string) Scope {
+	return Scope{settings: s, user: id}
+}
+
+// app is the application's scope.
+func (s *Settings) app() Scope {
+	return Scope{settings: s}
+}
+
+// String returns the application's value of the string setting key.
+func (s *Settings) String(ctx context.Context, key string) (string, error) {
+	return s.app().String(ctx, key)
+}
+
+// Bool returns the application's value of the bool setting key.
+func (s *Settings) Bool(ctx context.Context, key string) (bool, error) {
+	return s.app().Bool(ctx, key)
+}
+
+// Int returns the application's value of the int setting key.
+func (s *Settings) Int(ctx context.Context, key string) (int, error) {
+	return s.app().Int(ctx, key)
+}
+
+// Float returns the application's value of the float setting key.
+func (s *Settings) Float(ctx context.Context, key string) (float64, error) {
+	return s.app().Float(ctx, key)
+}
+
+// Duration returns the application's value of the duration setting
+// key.
+func (s *Settings) Duration(ctx context.Context, key string) (time.Duration, error) {
+	return s.app().Duration(ctx, key)
+}
+
+// Set sets the application's value of key. value may be text, as typed
+// into a form, or of the setting's kind.
+func (s *Settings) Set(ctx context.Context, key string, value any) error {
+	return s.app().Set(ctx, key, value)
+}
+
+// Reset puts key back to its default for the application.
+func (s *Settings) Reset(ctx context.Context, key string) error {
+	return s.app().Reset(ctx, key)
+}
+
+// Scope is the settings as one user, or the application, sees them.
+type Scope struct {
+	settings *Settings
+	user     string
+}
+
+// String returns the value of the string setting key.
+func (sc Scope) String(ctx context.Context, key string) (string, error) {
+	v, err := sc.value(ctx, key, String)
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// Bool returns the value of the bool setting key.
+func (sc Scope) Bool(ctx context.Context, key string) (bool, error) {
+	v, err := sc.value(ctx, key, Bool)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// Int returns the value of the int setting key.
+func (sc Scope) Int(ctx context.Context, key string) (int, error) {
+	v, err := sc.value(ctx, key, Int)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int), nil
+}
+
+// Float returns the value of the float setting key.
+func (sc Scope) Float(ctx context.Context, key string) (float64, error) {
+	v, err := sc.value(ctx, key, Float)
+	if err != nil {
+		return 0, err
+	}
+	return v.(float64), nil
+}
+
+// Duration returns the value of the duration setting key.
+func (sc Scope) Duration(ctx context.Context, key string) (time.Duration, error) {
+	v, err := sc.value(ctx, key, Duration)
+	if err != nil {
+		return 0, err
+	}
+	return v.(time.Duration), nil
+}
+
+// Set sets the scope's value of key. value may be text, as typed into a
+// form, or of the setting's kind. Only User settings can be set for a
+// user.
+func (sc Scope) Set(ctx context.Context, key string, value any) error {
+	setting, err := sc.settings.setting(key)
+	if err != nil {
+		return err
+	}
+	if sc.user != "" && !setting.User {
+		return fmt.Errorf("settings: %s can't be set per user", key)
+	}
+	text, err := setting.format(value)
+	if err != nil {
+		return err
+	}
+	now := clock.Or(sc.settings.Clock).Now()
+	if err := sc.settings.Store.Set(ctx, sc.user, key, text, now); err != nil {
+		return err
+	}
+	sc.settings.forget(sc.user)
+	return nil
+}
+
+// Reset removes the scope's value of key, so it reads as the default
+// again: the application's value for a user, Default for the
+// application.
+func (sc Scope) Reset(ctx context.Context, key string) error {
+	if _, err := sc.settings.setting(key); err != nil {
+		return err
+	}
+	if err := sc.settings.Store.Delete(ctx, sc.user, key); err != nil {
+		return err
+	}
+	sc.settings.forget(sc.user)
+	return nil
+}
+
+// value returns key's value, checking the setting is of kind.
+func (sc Scope) value(ctx context.Context, key string, kind Kind) (any, error) {
+	setting, err := sc.settings.setting(key)
+	if err != nil {
+		return nil, err
+	}
+	if setting.Kind != kind {
+		return nil, fmt.Errorf("settings: %s is a %s setting, not %s", key, setting.Kind, kind)
+	}
+	text, _, err := sc.settings.lookup(ctx, sc.user, setting)
+	if err != nil {
+		return nil, err
+	}
+	v, err := setting.parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("settings: %s: %w", key, err)
+	}
+	return v, nil
+}
+
+// lookup returns setting's text for scope, and whether it has been set
+// rather than being the default.
+func (s *Settings) lookup(ctx context.Context, scope string, setting Setting) (string, bool, error) {
+	if scope != "" && setting.User {
+		values, err := s.values(ctx, scope)
+		if err != nil {
+			return "", false, err
+		}
+		if v, ok := values[setting.Key]; ok {
+			return v, true, nil
+		}
+	}
+	values, err := s.values(ctx, "")
+	if err != nil {
+		return "", false, err
+	}
+	if v, ok := values[setting.Key]; ok {
+		return v, true, nil
+	}
+	return setting.Default, false, nil
+}
+
+// values returns scope's values, from the cache when it can.
+func (s *Settings) values(ctx context.Context, scope string) (map[string]string, error) {
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	now := clock.Or(s.Clock).Now()
+	if ttl > 0 {
+		s.mu.RLock()
+		c, ok := s.cache[scope]
+		s.mu.RUnlock()
+		if ok && now.Before(c.expires) {
+			return c.values, nil
+		}
+	}
+
+	s.mu.RLock()
+	gen := s.cacheGen
+	s.mu.RUnlock()
+	values, err := s.Store.Values(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		s.mu.Lock()
+		// Don't cache what was read before a change to it
+		if gen == s.cacheGen {
+			s.prune(now)
+			s.cache[scope] = cached{values: values, expires: now.Add(ttl)}
+		}
+		s.mu.Unlock()
+	}
+	return values, nil
+}
+
+// forget drops scope's cached values.
+func (s *Settings) forget(scope string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, scope)
+	s.cacheGen++
+}
+
+// prune drops expired values, so users who've gone don't stay cached.
+// Call it with s.mu held.
+func (s *Settings) prune(now time.Time) {
+	for scope, c := range s.cache {
+		if !now.Before(c.expires) {
+			delete(s.cache, scope)
+		}
+	}
+}
+
+func (s *Settings) setting(key string) (Setting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	setting, ok := s.defined[key]
+	if !ok {
+		return Setting{}, fmt.Errorf("%w: %s", ErrUndefined, key)
+	}
+	return setting, nil
+}
+
+// parse reads text as a value of the setting's kind.
+func (setting Setting) parse(text string) (any, error) {
+	switch setting.Kind {
+	case Bool:
+		return strconv.ParseBool(text)
+	case Int:
+		return strconv.Atoi(text)
+	case Float:
+		return strconv.ParseFloat(text, 64)
+	case Duration:
+		return time.ParseDuration(text)
+	}
+	if len(setting.Choices) > 0 {
+		for _, choice := range setting.Choices {
+			if text == choice {
+				return text, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of %s", text, strings.Join(setting.Choices, ", "))
+	}
+	return text, nil
+}
+
+// format returns value as the setting's text, checking it's valid.
+func (setting Setting) format(value any) (string, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+		if setting.Kind == String {
+			text = v
+		}
+	case bool:
+		text = strconv.FormatBool(v)
+	case int:
+		text = strconv.Itoa(v)
+	case float64:
+		text = strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Duration:
+		text = v.String()
+	default:
+		return "", fmt.Errorf("settings: %s: can't store a %T", setting.Key, value)
+	}
+	if _, err := setting.parse(text); err != nil {
+		return "", &ValidationError{Key: setting.Key, Err: err}
+	}
+	return text, nil
+}
+
+// ValidationError is returned by Set for a value that doesn't suit the
+// setting.
+type ValidationError struct {
+	Key string
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("settings: %s: %v", e.Key, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Field is a setting as the admin page shows it.
+type Field struct {
+	Setting
+
+	// Value is the application's value, as text.
+	Value string
+
+	// Overridden is whether Value has been set rather than being the
+	// default.
+	Overridden bool
+}
+
+// Input returns the type of input the admin page shows for the
+// field: "checkbox", "select", "number" (for Int) or "text".
+func (f Field) Input() string {
+	switch {
+	case f.Kind == Bool:
+		return "checkbox"
+	case len(f.Choices) > 0:
+		return "select"
+	case f.Kind == Int:
+		return "number"
+	}
+	return "text"
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (s *Settings) Routes() [][2]string {
+	p := s.path()
+	return [][2]string{
+		{http.MethodGet, p},
+		{http.MethodPost, p},
+		{http.MethodPost, p + "/{key}/reset"},
+	}
+}
+
+// Mount adds the admin page to app. It requires login, and CanEdit.
+func (s *Settings) Mount(app *buffalo.App) {
+	p := s.path()
+	app.GET(p, auth.RequireLogin(s.Show))
+	app.POST(p, auth.RequireLogin(s.Update))
+	app.POST(p+"/{key}/reset", auth.RequireLogin(s.ResetHandler))
+}
+
+// Show renders the admin page.
+func (s *Settings) Show(c buffalo.Context) error {
+	if !s.canEdit(c) {
+		return c.Error(http.StatusForbidden, errors.New("settings: not allowed"))
+	}
+	return s.render(c, http.StatusOK, nil, nil)
+}
+
+// Update saves the admin page's form. Each setting's value is in the
+// field named by its key, and settings left out aren't changed; a bool
+// setting's checkbox follows a hidden "false" field, so an unchecked
+// box saves false. Nothing is saved unless every value is valid.
+func (s *Settings) Update(c buffalo.Context) error {
+	if !s.canEdit(c) {
+		return c.Error(http.StatusForbidden, errors.New("settings: not allowed"))
+	}
+	if err := c.Request().ParseForm(); err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	submitted := make(map[string]string)
+	var errs []string
+	for _, setting := range s.Defined() {
+		values, ok := c.Request().Form[setting.Key]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		// A checked box follows its hidden "false"
+		submitted[setting.Key] = values[len(values)-1]
+		if _, err := setting.format(submitted[setting.Key]); err != nil {
+			var verr *ValidationError
+			if errors.As(err, &verr) {
+				errs = append(errs, fmt.Sprintf("%s: %v", setting.label(), verr.Err))
+				continue
+			}
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return s.render(c, http.StatusUnprocessableEntity, submitted, errs)
+	}
+
+	keys := make([]string, 0, len(submitted))
+	for key := range submitted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := s.Set(c, key, submitted[key]); err != nil {
+			return err
+		}
+	}
+	c.Flash().Add("success", "Settings saved.")
+	return c.Redirect(http.StatusSeeOther, s.path())
+}
+
+// ResetHandler puts the setting named in the path back to its default.
+func (s *Settings) ResetHandler(c buffalo.Context) error {
+	if !s.canEdit(c) {
+		return c.Error(http.StatusForbidden, errors.New("settings: not allowed"))
+	}
+	if err := s.Reset(c, c.Param("key")); err != nil {
+		if errors.Is(err, ErrUndefined) {
+			return c.Error(http.StatusNotFound, err)
+		}
+		return err
+	}
+	c.Flash().Add("success", "Setting reset.")
+	return c.Redirect(http.StatusSeeOther, s.path())
+}
+
+// render renders the admin page, showing submitted values in place of
+// the saved ones.
+func (s *Settings) render(c buffalo.Context, status int, submitted map[string]string, errs []string) error {
+	var fields []Field
+	for _, setting := range s.Defined() {
+		setting.Label = setting.label()
+		value, overridden, err := s.lookup(c, "", setting)
+		if err != nil {
+			return err
+		}
+		if v, ok := submitted[setting.Key]; ok {
+			value = v
+		}
+		fields = append(fields, Field{Setting: setting, Value: value, Overridden: overridden})
+	}
+	return views.Render(c, status, views.PageSettings, map[string]any{
+		"settings":      fields,
+		"settings_path": s.path(),
+		"errors":        errs,
+	})
+}
+
+func (s *Settings) canEdit(c buffalo.Context) bool {
+	return s.CanEdit != nil && s.CanEdit(c)
+}
+
+func (setting Setting) label() string {
+	if setting.Label != "" {
+		return setting.Label
+	}
+	return setting.Key
+}
+
+func (s *Settings) path() string {
+	if s.Path != "" {
+		return strings.TrimSuffix(s.Path, "/")
+	}
+	return "/settings"
+}
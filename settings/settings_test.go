@@ -0,0 +1,227 @@
+package settings_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/settings"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newApp(t *testing.T) *buffkittest.App {
+	t.Helper()
+	app := buffkittest.NewApp(t, buffkittest.Options{Config: buffkit.Config{Settings: true}})
+	s := app.Kit.Settings
+	require.NotNil(t, s)
+	s.CanEdit = func(c buffalo.Context) bool {
+		return auth.GetUserSession(c) == "admin@example.com"
+	}
+	for _, setting := range []settings.Setting{
+		{Key: "site_name", Default: "Buffkit", Label: "Site name"},
+		{Key: "signups_open", Kind: settings.Bool, Default: "true", Help: "Let people register"},
+		{Key: "page_size", Kind: settings.Int, Default: "20"},
+		{Key: "theme", Default: "light", Choices: []string{"light", "dark"}, User: true},
+		{Key: "digest_every", Kind: settings.Duration, Default: "24h", User: true},
+	} {
+		require.NoError(t, s.Define(setting))
+	}
+	return app
+}
+
+func TestTyped(t *testing.T) {
+	app := newApp(t)
+	s := app.Kit.Settings
+	ctx := context.Background()
+
+	name, err := s.String(ctx, "site_name")
+	require.NoError(t, err)
+	assert.Equal(t, "Buffkit", name)
+	open, err := s.Bool(ctx, "signups_open")
+	require.NoError(t, err)
+	assert.True(t, open)
+
+	require.NoError(t, s.Set(ctx, "page_size", 50))
+	require.NoError(t, s.Set(ctx, "signups_open", "false"))
+	size, err := s.Int(ctx, "page_size")
+	require.NoError(t, err)
+	assert.Equal(t, 50, size)
+	open, err = s.Bool(ctx, "signups_open")
+	require.NoError(t, err)
+	assert.False(t, open)
+
+	var verr *settings.ValidationError
+	assert.ErrorAs(t, s.Set(ctx, "page_size", "lots"), &verr)
+	assert.ErrorAs(t, s.Set(ctx, "theme", "purple"), &verr)
+	assert.Error(t, s.Set(ctx, "page_size", time.Second), "wrong kind")
+	_, err = s.Bool(ctx, "page_size")
+	assert.Error(t, err, "wrong getter")
+	_, err = s.String(ctx, "nope")
+	assert.ErrorIs(t, err, settings.ErrUndefined)
+
+	require.NoError(t, s.Reset(ctx, "page_size"))
+	size, err = s.Int(ctx, "page_size")
+	require.NoError(t, err)
+	assert.Equal(t, 20, size)
+}
+
+func TestUser(t *testing.T) {
+	app := newApp(t)
+	s := app.Kit.Settings
+	ctx := context.Background()
+	ada := s.User("ada@example.com")
+
+	require.NoError(t, s.Set(ctx, "digest_every", time.Hour))
+	every, err := ada.Duration(ctx, "digest_every")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, every, "users start with the application's value")
+
+	require.NoError(t, ada.Set(ctx, "digest_every", "30m"))
+	every, err = ada.Duration(ctx, "digest_every")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, every)
+	every, err = s.User("grace@example.com").Duration(ctx, "digest_every")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, every)
+
+	assert.Error(t, ada.Set(ctx, "page_size", 5), "only User settings")
+	name, err := ada.String(ctx, "site_name")
+	require.NoError(t, err)
+	assert.Equal(t, "Buffkit", name)
+
+	require.NoError(t, ada.Reset(ctx, "digest_every"))
+	every, err = ada.Duration(ctx, "digest_every")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, every)
+}
+
+func TestCache(t *testing.T) {
+	app := newApp(t)
+	s := app.Kit.Settings
+	ctx := context.Background()
+
+	_, err := s.String(ctx, "site_name")
+	require.NoError(t, err)
+	// Another process changes it
+	require.NoError(t, s.Store.Set(ctx, "", "site_name", "Elsewhere", app.Clock.Now()))
+	name, err := s.String(ctx, "site_name")
+	require.NoError(t, err)
+	assert.Equal(t, "Buffkit", name, "cached")
+
+	app.Clock.Advance(settings.DefaultTTL)
+	name, err = s.String(ctx, "site_name")
+	require.NoError(t, err)
+	assert.Equal(t, "Elsewhere", name)
+
+	// Changes made here are seen at once
+	require.NoError(t, s.Set(ctx, "site_name", "Here"))
+	name, err = s.String(ctx, "site_name")
+	require.NoError(t, err)
+	assert.Equal(t, "Here", name)
+}
+
+func TestDefine(t *testing.T) {
+	s := settings.New(settings.NewMemoryStore())
+	require.NoError(t, s.Define(settings.Setting{Key: "a"}))
+	assert.Error(t, s.Define(settings.Setting{Key: "a"}), "already defined")
+	assert.Error(t, s.Define(settings.Setting{Key: "bad key"}))
+	assert.Error(t, s.Define(settings.Setting{Key: "n", Kind: settings.Int, Default: "x"}))
+	assert.Error(t, s.Define(settings.Setting{Key: "k", Kind: "color"}))
+	assert.Error(t, s.Define(settings.Setting{Key: "c", Kind: settings.Int, Default: "1", Choices: []string{"1"}}))
+	assert.Len(t, s.Defined(), 1)
+}
+
+func TestAdminPage(t *testing.T) {
+	app := newApp(t)
+	ctx := context.Background()
+
+	buffkittest.AssertRedirect(t, app.Client().Get("/settings"), "/login")
+	ada := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com"})
+	assert.Equal(t, http.StatusForbidden, ada.Get("/settings").Code)
+	assert.Equal(t, http.StatusForbidden, ada.Post("/settings", url.Values{"page_size": {"5"}}).Code)
+
+	admin := buffkittest.LoginAs(t, app, &auth.User{Email: "admin@example.com"})
+	res := admin.Get("/settings")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	body := res.Body.String()
+	buffkittest.AssertElement(t, body, "input", "name", "site_name", "value", "Buffkit")
+	buffkittest.AssertElement(t, body, "input", "type", "checkbox", "name", "signups_open", "checked", "")
+	buffkittest.AssertElement(t, body, "input", "type", "number", "name", "page_size")
+	buffkittest.AssertElement(t, body, "select", "name", "theme")
+	buffkittest.AssertText(t, body, "Let people register")
+	buffkittest.AssertNoElement(t, body, "button", "formaction", "/settings/page_size/reset")
+
+	// Nothing is saved unless everything is valid
+	res = admin.Post("/settings", url.Values{"site_name": {"Acme"}, "page_size": {"lots"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	buffkittest.AssertText(t, res.Body.String(), "page_size: ")
+	buffkittest.AssertElement(t, res.Body.String(), "input", "name", "site_name", "value", "Acme")
+	name, err := app.Kit.Settings.String(ctx, "site_name")
+	require.NoError(t, err)
+	assert.Equal(t, "Buffkit", name)
+
+	res = admin.Post("/settings", url.Values{"site_name": {"Acme"}, "page_size": {"50"}, "signups_open": {"false"}})
+	buffkittest.AssertRedirect(t, res, "/settings")
+	size, err := app.Kit.Settings.Int(ctx, "page_size")
+	require.NoError(t, err)
+	assert.Equal(t, 50, size)
+	open, err := app.Kit.Settings.Bool(ctx, "signups_open")
+	require.NoError(t, err)
+	assert.False(t, open, "unchecked")
+	body = admin.Get("/settings").Body.String()
+	buffkittest.AssertText(t, body, "Settings saved.")
+	buffkittest.AssertElement(t, body, "button", "formaction", "/settings/page_size/reset")
+
+	buffkittest.AssertRedirect(t, admin.Post("/settings/page_size/reset", url.Values{}), "/settings")
+	size, err = app.Kit.Settings.Int(ctx, "page_size")
+	require.NoError(t, err)
+	assert.Equal(t, 20, size)
+	assert.Equal(t, http.StatusNotFound, admin.Post("/settings/nope/reset", url.Values{}).Code)
+}
+
+func TestStores(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	schema, err := os.ReadFile("../db/migrations/settings/20261017130000_create_settings.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	for name, store := range map[string]settings.Store{
+		"memory": settings.NewMemoryStore(),
+		"sql":    settings.NewSQLStore(db, "sqlite"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, store.Set(ctx, "", "a", "1", now))
+			require.NoError(t, store.Set(ctx, "", "a", "2", now))
+			require.NoError(t, store.Set(ctx, "", "a", "2", now), "unchanged")
+			require.NoError(t, store.Set(ctx, "ada@example.com", "a", "3", now))
+
+			values, err := store.Values(ctx, "")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"a": "2"}, values)
+			values, err = store.Values(ctx, "ada@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"a": "3"}, values)
+
+			require.NoError(t, store.Delete(ctx, "", "a"))
+			require.NoError(t, store.Delete(ctx, "", "a"), "already gone")
+			values, err = store.Values(ctx, "")
+			require.NoError(t, err)
+			assert.Empty(t, values)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// MemoryStore keeps values in memory, for tests and development.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	scopes map[string]map[string]string
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{scopes: make(map[string]map[string]string)}
+}
+
+func (s *MemoryStore) Values(ctx context.Context, scope string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]string, len(s.scopes[scope]))
+	for k, v := range s.scopes[scope] {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, scope, key, value string, at time.Time) error {
+	if err := readonly.Check("settings.Set"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scopes[scope] == nil {
+		s.scopes[scope] = make(map[string]string)
+	}
+	s.scopes[scope][key] = value
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, scope, key string) error {
+	if err := readonly.Check("settings.Delete"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scopes[scope], key)
+	return nil
+}
+
+// SQLStore keeps values in the settings table created by the
+// db/migrations/settings migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates a settings store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) Values(ctx context.Context, scope string) (map[string]string, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect, "SELECT name, value FROM settings WHERE scope = ?"), scope)
+	if err != nil {
+		return nil, fmt.Errorf("settings: values: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		out[key] = value
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLStore) Set(ctx context.Context, scope, key, value string, at time.Time) error {
+	if err := readonly.Check("settings.Set"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	// Upsert by hand so the same code works on all three dialects
+	res, err := s.db.ExecContext(ctx,
+		sqlutil.Rebind(s.dialect, "UPDATE settings SET value = ?, updated_at = ? WHERE scope = ? AND name = ?"),
+		value, at, scope, key)
+	if err != nil {
+		return fmt.Errorf("settings: update: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = s.db.ExecContext(ctx,
+		sqlutil.Rebind(s.dialect, "INSERT INTO settings (scope, name, value, updated_at) VALUES (?, ?, ?, ?)"),
+		scope, key, value, at)
+	if err != nil {
+		// MySQL counts only changed rows, so an unchanged value lands
+		// here too
+		var n int
+		if s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect, "SELECT COUNT(*) FROM settings WHERE scope = ? AND name = ? AND value = ?"),
+			scope, key, value).Scan(&n) == nil && n > 0 {
+			return nil
+		}
+		return fmt.Errorf("settings: insert: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, scope, key string) error {
+	if err := readonly.Check("settings.Delete"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM settings WHERE scope = ? AND name = ?"), scope, key)
+	if err != nil {
+		return fmt.Errorf("settings: delete: %w", err)
+	}
+	return nil
+}
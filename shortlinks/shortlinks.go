@@ -0,0 +1,298 @@
+// Package shortlinks makes short URLs that redirect to longer ones, for
+// SMS messages, printed material and QR codes. Stored links have a code
+// such as /s/x7Kp2Qa, an optional expiry, and count how often they're
+// followed:
+//
+//	link, err := kit.Shortlinks.Create(ctx, "https://example.com/offers/spring?ref=sms",
+//	    shortlinks.Options{TTL: 30 * 24 * time.Hour})
+//	sms.Send(phone, "Spring offers: "+kit.Shortlinks.URL(link))
+//
+// Signed links need no store: the target and expiry travel in the link,
+// signed so it can't be pointed elsewhere. They're longer and their
+// clicks aren't counted.
+//
+//	link, err := kit.Shortlinks.Sign("/invoices/42", 7*24*time.Hour)
+//
+// Expired stored links answer 410 Gone until they're pruned, which the
+// buffkit:shortlinks:prune task does.
+package shortlinks
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// codeLength is the length of generated codes. 62^7 is about 3.5
+// trillion, so they can't practically be guessed or run out.
+const codeLength = 7
+
+// codeAlphabet is what generated codes are made of.
+const codeAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// targetClaim is the signed link's claim holding its target.
+const targetClaim = "to"
+
+var (
+	// ErrNotFound is returned for an unknown code.
+	ErrNotFound = auth.NotFoundError("shortlinks: link not found")
+
+	// ErrExists is returned when creating a link whose code is taken.
+	ErrExists = errors.New("shortlinks: code is taken")
+)
+
+// validCode is what custom codes may look like.
+var validCode = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Link is a stored short link.
+type Link struct {
+	Code string
+
+	// URL is where the link redirects: an absolute http or https URL, or
+	// a path on this site.
+	URL string
+
+	// Clicks is how many times the link has been followed.
+	Clicks int64
+
+	CreatedAt time.Time
+
+	// ExpiresAt is when the link stops redirecting. Nil never expires.
+	ExpiresAt *time.Time
+}
+
+// Expired reports whether the link has expired at now.
+func (l *Link) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// Store keeps short links. MemoryStore suits tests and development;
+// SQLStore keeps them in the database.
+type Store interface {
+	// Create saves a new link, or returns ErrExists if its code is taken.
+	Create(ctx context.Context, link *Link) error
+
+	// Link returns the link with code, or ErrNotFound.
+	Link(ctx context.Context, code string) (*Link, error)
+
+	// Click adds one to the link's clicks.
+	Click(ctx context.Context, code string) error
+
+	// Prune deletes links that expired before before, and returns how
+	// many it deleted.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// Options are the optional settings of a new link.
+type Options struct {
+	// Code is the link's code, such as "spring-sale". Empty generates a
+	// random one.
+	Code string
+
+	// TTL is how long the link works. Zero never expires.
+	TTL time.Duration
+}
+
+// Shortlinks creates short links and redirects them.
+type Shortlinks struct {
+	Store Store
+
+	// Signer signs stateless links made by Sign. Nil disables them.
+	Signer *secure.URLSigner
+
+	// Path is where links are served. Defaults to "/s".
+	Path string
+
+	// BaseURL prefixes the links URL and Sign return, e.g.
+	// "https://example.com". Empty gives paths.
+	BaseURL string
+
+	// Clock is used for expiry. Nil uses the real clock.
+	Clock clock.Clock
+}
+
+// New creates a Shortlinks that keeps links in store and signs stateless
+// links with signer.
+func New(store Store, signer *secure.URLSigner) *Shortlinks {
+	return &Shortlinks{Store: store, Signer: signer}
+}
+
+// Create stores a short link to target. target must be an absolute http
+// or https URL, or a path on this site such as "/offers"; anything else
+// could be used to send people somewhere dangerous from a link that
+// looks like the app's.
+func (s *Shortlinks) Create(ctx context.Context, target string, opts Options) (*Link, error) {
+	if err := checkTarget(target); err != nil {
+		return nil, err
+	}
+	if opts.Code != "" && !validCode.MatchString(opts.Code) {
+		return nil, fmt.Errorf("shortlinks: code %q must be 1 to 64 letters, digits, - or _", opts.Code)
+	}
+
+	now := clock.Or(s.Clock).Now()
+	link := &Link{Code: opts.Code, URL: target, CreatedAt: now}
+	if opts.TTL > 0 {
+		expires := now.Add(opts.TTL)
+		link.ExpiresAt = &expires
+	}
+	if link.Code != "" {
+		if err := s.Store.Create(ctx, link); err != nil {
+			return nil, err
+		}
+		return link, nil
+	}
+
+	// A generated code is unlikely to be taken, but try a few in case
+	for attempt := 0; ; attempt++ {
+		code, err := newCode()
+		if err != nil {
+			return nil, err
+		}
+		link.Code = code
+		err = s.Store.Create(ctx, link)
+		if errors.Is(err, ErrExists) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return link, nil
+	}
+}
+
+// URL returns the link's short URL.
+func (s *Shortlinks) URL(link *Link) string {
+	return s.BaseURL + s.path() + "/" + url.PathEscape(link.Code)
+}
+
+// Sign returns a signed link to target that works for ttl, without
+// storing anything. target is checked as for Create.
+func (s *Shortlinks) Sign(target string, ttl time.Duration) (string, error) {
+	if s.Signer == nil {
+		return "", errors.New("shortlinks: signed links need a signer")
+	}
+	if err := checkTarget(target); err != nil {
+		return "", err
+	}
+	link, err := s.Signer.Sign(s.path(), clock.Or(s.Clock).Now().Add(ttl), map[string]string{targetClaim: target})
+	if err != nil {
+		return "", err
+	}
+	return s.BaseURL + link, nil
+}
+
+// Prune deletes links that have expired, and returns how many it deleted.
+func (s *Shortlinks) Prune(ctx context.Context) (int, error) {
+	return s.Store.Prune(ctx, clock.Or(s.Clock).Now())
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (s *Shortlinks) Routes() [][2]string {
+	p := s.path()
+	return [][2]string{
+		{http.MethodGet, p},
+		{http.MethodGet, p + "/{code}"},
+	}
+}
+
+// Mount adds the redirects to app.
+func (s *Shortlinks) Mount(app *buffalo.App) {
+	p := s.path()
+	app.GET(p, s.Follow)
+	app.GET(p+"/{code}", s.Redirect)
+}
+
+// Redirect sends the visitor on to a stored link's target and counts the
+// click. Unknown codes get 404 and expired links 410 Gone.
+func (s *Shortlinks) Redirect(c buffalo.Context) error {
+	code := c.Param("code")
+	link, err := s.Store.Link(c, code)
+	if errors.Is(err, ErrNotFound) {
+		return c.Error(http.StatusNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+	if link.Expired(clock.Or(s.Clock).Now()) {
+		return c.Error(http.StatusGone, fmt.Errorf("shortlinks: link %s has expired", code))
+	}
+
+	// A click that isn't counted shouldn't stop the link working, and
+	// isn't worth logging in read-only mode
+	if err := s.Store.Click(c, code); err != nil && !errors.Is(err, readonly.ErrReadOnly) {
+		log.Printf("Shortlinks: counting click code=%s error=%v", code, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Redirect(http.StatusFound, link.URL)
+}
+
+// Follow sends the visitor on to a signed link's target. Links that
+// aren't validly signed get 403, and expired ones 410 Gone.
+func (s *Shortlinks) Follow(c buffalo.Context) error {
+	if s.Signer == nil {
+		return c.Error(http.StatusNotFound, errors.New("shortlinks: signed links are disabled"))
+	}
+	return secure.SignedURLMiddleware(s.Signer)(func(c buffalo.Context) error {
+		target := c.Param(targetClaim)
+		if err := checkTarget(target); err != nil {
+			return c.Error(http.StatusBadRequest, err)
+		}
+		return c.Redirect(http.StatusFound, target)
+	})(c)
+}
+
+// checkTarget returns an error unless target is an absolute http or
+// https URL, or a path on this site.
+func checkTarget(target string) error {
+	if strings.HasPrefix(target, "/") {
+		// "//host" and "/\host" are other sites to browsers
+		if strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+			return fmt.Errorf("shortlinks: %q isn't a path on this site", target)
+		}
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("shortlinks: %q must be an http or https URL or a path", target)
+	}
+	return nil
+}
+
+// newCode returns a random code of codeLength characters.
+func newCode() (string, error) {
+	code := make([]byte, 0, codeLength)
+	b := make([]byte, codeLength*2)
+	for len(code) < codeLength {
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("shortlinks: code: %w", err)
+		}
+		for _, v := range b {
+			// 248 is the largest multiple of 62 below 256; skipping
+			// bytes above it keeps every character equally likely
+			if v < 248 && len(code) < codeLength {
+				code = append(code, codeAlphabet[v%62])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+func (s *Shortlinks) path() string {
+	if s.Path != "" {
+		return strings.TrimSuffix(s.Path, "/")
+	}
+	return "/s"
+}
@@ -0,0 +1,139 @@
+package shortlinks_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/johnjansen/buffkit/shortlinks"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newApp(t *testing.T) (*buffkittest.App, *clock.Fake) {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+	app := buffkittest.NewApp(t, buffkittest.Options{Config: buffkit.Config{Shortlinks: true, Clock: clk}})
+	require.NotNil(t, app.Kit.Shortlinks)
+	return app, clk
+}
+
+func TestRedirect(t *testing.T) {
+	app, clk := newApp(t)
+	links := app.Kit.Shortlinks
+	ctx := context.Background()
+	client := app.Client()
+
+	link, err := links.Create(ctx, "https://example.com/offers/spring?ref=sms", shortlinks.Options{TTL: time.Hour})
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9A-Za-z]{7}$`), link.Code)
+	assert.Equal(t, "/s/"+link.Code, links.URL(link))
+
+	for i := 0; i < 2; i++ {
+		res := client.Get(links.URL(link))
+		require.Equal(t, http.StatusFound, res.Code, res.Body.String())
+		assert.Equal(t, "https://example.com/offers/spring?ref=sms", res.Header().Get("Location"))
+	}
+	got, err := links.Store.Link(ctx, link.Code)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), got.Clicks)
+
+	assert.Equal(t, http.StatusNotFound, client.Get("/s/nope").Code)
+
+	clk.Advance(time.Hour)
+	assert.Equal(t, http.StatusGone, client.Get(links.URL(link)).Code)
+	got, err = links.Store.Link(ctx, link.Code)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), got.Clicks, "expired links aren't counted")
+}
+
+func TestCreate(t *testing.T) {
+	app, _ := newApp(t)
+	links := app.Kit.Shortlinks
+	ctx := context.Background()
+
+	link, err := links.Create(ctx, "/offers", shortlinks.Options{Code: "spring-sale"})
+	require.NoError(t, err)
+	assert.Nil(t, link.ExpiresAt)
+	buffkittest.AssertRedirect(t, app.Client().Get("/s/spring-sale"), "/offers")
+
+	_, err = links.Create(ctx, "/other", shortlinks.Options{Code: "spring-sale"})
+	assert.ErrorIs(t, err, shortlinks.ErrExists)
+	_, err = links.Create(ctx, "/offers", shortlinks.Options{Code: "no spaces"})
+	assert.Error(t, err)
+
+	for _, target := range []string{"", "offers", "//evil.example", "/\\evil.example", "javascript:alert(1)", "ftp://example.com/f", "https:///path"} {
+		_, err := links.Create(ctx, target, shortlinks.Options{})
+		assert.Error(t, err, target)
+	}
+}
+
+func TestSign(t *testing.T) {
+	app, clk := newApp(t)
+	links := app.Kit.Shortlinks
+	client := app.Client()
+
+	link, err := links.Sign("/invoices/42", time.Hour)
+	require.NoError(t, err)
+	assert.Regexp(t, `^/s\?`, link)
+	buffkittest.AssertRedirect(t, client.Get(link), "/invoices/42")
+
+	_, err = links.Sign("//evil.example", time.Hour)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, client.Get("/s?to=https://evil.example").Code)
+
+	clk.Advance(2 * time.Hour)
+	assert.Equal(t, http.StatusGone, client.Get(link).Code)
+}
+
+func TestStores(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	schema, err := os.ReadFile("../db/migrations/shortlinks/20261017100000_create_shortlinks.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for name, store := range map[string]shortlinks.Store{
+		"memory": shortlinks.NewMemoryStore(),
+		"sql":    shortlinks.NewSQLStore(db, "sqlite"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+			expired := now.Add(-time.Minute)
+			later := now.Add(time.Hour)
+			require.NoError(t, store.Create(ctx, &shortlinks.Link{Code: "old", URL: "/a", CreatedAt: now, ExpiresAt: &expired}))
+			require.NoError(t, store.Create(ctx, &shortlinks.Link{Code: "new", URL: "/b", CreatedAt: now, ExpiresAt: &later}))
+			require.NoError(t, store.Create(ctx, &shortlinks.Link{Code: "forever", URL: "/c", CreatedAt: now}))
+			assert.ErrorIs(t, store.Create(ctx, &shortlinks.Link{Code: "new", URL: "/d", CreatedAt: now}), shortlinks.ErrExists)
+
+			require.NoError(t, store.Click(ctx, "new"))
+			require.NoError(t, store.Click(ctx, "new"))
+			assert.ErrorIs(t, store.Click(ctx, "missing"), shortlinks.ErrNotFound)
+			link, err := store.Link(ctx, "new")
+			require.NoError(t, err)
+			assert.Equal(t, "/b", link.URL)
+			assert.Equal(t, int64(2), link.Clicks)
+			require.NotNil(t, link.ExpiresAt)
+			assert.True(t, later.Equal(*link.ExpiresAt))
+
+			n, err := store.Prune(ctx, now)
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+			_, err = store.Link(ctx, "old")
+			assert.ErrorIs(t, err, shortlinks.ErrNotFound)
+			_, err = store.Link(ctx, "forever")
+			assert.NoError(t, err)
+		})
+	}
+}
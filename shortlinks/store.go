@@ -0,0 +1,180 @@
+package shortlinks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// MemoryStore keeps links in memory, for tests and development.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	links map[string]*Link
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{links: make(map[string]*Link)}
+}
+
+// clone copies link, so callers can't change what's stored.
+func clone(link *Link) *Link {
+	copied := *link
+	if link.ExpiresAt != nil {
+		expires := *link.ExpiresAt
+		copied.ExpiresAt = &expires
+	}
+	return &copied
+}
+
+func (s *MemoryStore) Create(ctx context.Context, link *Link) error {
+	if err := readonly.Check("shortlinks.Create"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[link.Code]; ok {
+		return ErrExists
+	}
+	s.links[link.Code] = clone(link)
+	return nil
+}
+
+func (s *MemoryStore) Link(ctx context.Context, code string) (*Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	link, ok := s.links[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(link), nil
+}
+
+func (s *MemoryStore) Click(ctx context.Context, code string) error {
+	if err := readonly.Check("shortlinks.Click"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.links[code]
+	if !ok {
+		return ErrNotFound
+	}
+	link.Clicks++
+	return nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	if err := readonly.Check("shortlinks.Prune"); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for code, link := range s.links {
+		if link.ExpiresAt != nil && link.ExpiresAt.Before(before) {
+			delete(s.links, code)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// SQLStore keeps links in the shortlinks table created by the
+// db/migrations/shortlinks migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates a link store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) Create(ctx context.Context, link *Link) error {
+	if err := readonly.Check("shortlinks.Create"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	_, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+		"INSERT INTO shortlinks (code, url, clicks, created_at, expires_at) VALUES (?, ?, ?, ?, ?)"),
+		link.Code, link.URL, link.Clicks, link.CreatedAt, link.ExpiresAt)
+	if err != nil {
+		// Drivers word duplicate keys differently, so look for the code
+		if _, lookup := s.Link(ctx, link.Code); lookup == nil {
+			return ErrExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) Link(ctx context.Context, code string) (*Link, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	var link Link
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect,
+		"SELECT code, url, clicks, created_at, expires_at FROM shortlinks WHERE code = ?"), code).
+		Scan(&link.Code, &link.URL, &link.Clicks, &link.CreatedAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		link.ExpiresAt = &expiresAt.Time
+	}
+	return &link, nil
+}
+
+func (s *SQLStore) Click(ctx context.Context, code string) error {
+	if err := readonly.Check("shortlinks.Click"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, "UPDATE shortlinks SET clicks = clicks + 1 WHERE code = ?"), code)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	if err := readonly.Check("shortlinks.Prune"); err != nil {
+		return 0, err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	res, err := s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM shortlinks WHERE expires_at IS NOT NULL AND expires_at < ?"), before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,57 @@
+package buffkit
+
+import (
+	"fmt"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/secure"
+)
+
+// Middleware names one of the middlewares Wire installs that a route can
+// opt out of with Skip.
+type Middleware string
+
+const (
+	// SecurityHeaders is the middleware that sets the Content-Security-
+	// Policy, X-Frame-Options, HSTS and similar headers.
+	SecurityHeaders Middleware = "security-headers"
+
+	// ComponentExpansion is the middleware that buffers HTML responses to
+	// expand their <bk-*> components.
+	ComponentExpansion Middleware = "component-expansion"
+)
+
+// skippers take a request out of each Middleware, once it has run.
+var skippers = map[Middleware]func(buffalo.Context){
+	SecurityHeaders:    secure.Skip,
+	ComponentExpansion: components.SkipExpansion,
+}
+
+// Skip wraps h so its route bypasses the named Buffkit middlewares, for
+// routes they get in the way of: raw file downloads, SSE streams, or a
+// third-party webhook receiver:
+//
+//	app.GET("/exports/{id}", buffkit.Skip(ExportHandler, buffkit.ComponentExpansion))
+//	app.POST("/webhooks/stripe", buffkit.Skip(StripeWebhook, buffkit.SecurityHeaders, buffkit.ComponentExpansion))
+//
+// The middlewares still run for the route, but undo their work before h
+// does: the headers SecurityHeaders set are removed, and the response is
+// no longer buffered for ComponentExpansion. Skip panics on a Middleware
+// it doesn't know, as routes are set up when the app starts.
+func Skip(h buffalo.Handler, mws ...Middleware) buffalo.Handler {
+	skips := make([]func(buffalo.Context), 0, len(mws))
+	for _, mw := range mws {
+		skip, ok := skippers[mw]
+		if !ok {
+			panic(fmt.Sprintf("buffkit: Skip: unknown middleware %q", mw))
+		}
+		skips = append(skips, skip)
+	}
+	return func(c buffalo.Context) error {
+		for _, skip := range skips {
+			skip(c)
+		}
+		return h(c)
+	}
+}
@@ -0,0 +1,68 @@
+package buffkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkip(t *testing.T) {
+	page := func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, render.Func("text/html; charset=utf-8", func(w io.Writer, _ render.Data) error {
+			_, err := io.WriteString(w, `<html><body><bk-markdown text="**hi**"></bk-markdown></body></html>`)
+			return err
+		}))
+	}
+	raw := func(c buffalo.Context) error {
+		c.Response().Header().Set("Content-Type", "text/html")
+		c.Response().WriteHeader(http.StatusOK)
+		_, err := io.WriteString(c.Response(), `<bk-markdown text="**hi**"></bk-markdown>`)
+		c.Response().(http.Flusher).Flush()
+		return err
+	}
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/page", page)
+	app.GET("/raw", Skip(raw, ComponentExpansion))
+	app.GET("/bare", Skip(page, SecurityHeaders))
+	app.GET("/both", Skip(page, SecurityHeaders, ComponentExpansion))
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	get := func(path string) *flushRecorder {
+		rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		return rec
+	}
+
+	rec := get("/page")
+	assert.Contains(t, rec.Body.String(), "<strong>hi</strong>")
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+
+	// Written straight through, as it was flushed
+	rec = get("/raw")
+	assert.Equal(t, []string{`<bk-markdown text="**hi**"></bk-markdown>`}, rec.chunks)
+	assert.Equal(t, `<bk-markdown text="**hi**"></bk-markdown>`, rec.Body.String())
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+
+	rec = get("/bare")
+	assert.Contains(t, rec.Body.String(), "<strong>hi</strong>")
+	assert.Empty(t, rec.Header().Get("X-Frame-Options"))
+	assert.Empty(t, rec.Header().Get("Content-Security-Policy"))
+
+	rec = get("/both")
+	assert.Contains(t, rec.Body.String(), `<bk-markdown text="**hi**">`)
+	assert.Empty(t, rec.Header().Get("X-Frame-Options"))
+
+	assert.PanicsWithValue(t, `buffkit: Skip: unknown middleware "csrf"`, func() {
+		Skip(page, Middleware("csrf"))
+	})
+}
@@ -0,0 +1,160 @@
+package ssr
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// AccessMode controls who may open the event stream.
+type AccessMode string
+
+const (
+	// AccessPublic lets anyone connect. Use only for non-sensitive streams.
+	AccessPublic AccessMode = "public"
+
+	// AccessLogin requires a logged-in session.
+	AccessLogin AccessMode = "login"
+
+	// AccessToken requires a token in the query string, verified by
+	// AccessOptions.VerifyToken. Use this for cross-origin embeds, where
+	// session cookies aren't available.
+	AccessToken AccessMode = "token"
+)
+
+// SubjectContextKey holds the subject returned by VerifyToken for
+// connections admitted in AccessToken mode.
+const SubjectContextKey = "sse_subject"
+
+// AccessOptions configures authentication and Origin checks for the
+// event stream endpoint.
+type AccessOptions struct {
+	// Mode defaults to AccessPublic.
+	Mode AccessMode
+
+	// AllowedOrigins lists origins (e.g. "https://partner.example.com")
+	// allowed to connect cross-origin; "*" allows any, but without
+	// cookies, so it can't be used with AccessLogin. Same-origin requests
+	// and requests without an Origin header are always allowed.
+	AllowedOrigins []string
+
+	// Authenticate reports whether the request has a logged-in user, for
+	// AccessLogin. Defaults to checking for "user_id" in the session.
+	Authenticate func(c buffalo.Context) bool
+
+	// VerifyToken validates a token for AccessToken and returns the
+	// subject it was issued to. Required in that mode.
+	VerifyToken func(token string) (string, error)
+
+	// TokenParam is the query parameter carrying the token.
+	// Defaults to "token".
+	TokenParam string
+}
+
+// Validate reports configuration errors, such as token mode without a verifier.
+func (o AccessOptions) Validate() error {
+	switch o.Mode {
+	case "", AccessPublic:
+		return nil
+	case AccessLogin:
+		for _, allowed := range o.AllowedOrigins {
+			if allowed == "*" {
+				return errors.New(`ssr: AccessLogin mode can't allow origin "*"; list the origins sent session cookies`)
+			}
+		}
+		return nil
+	case AccessToken:
+		if o.VerifyToken == nil {
+			return errors.New("ssr: AccessToken mode requires VerifyToken")
+		}
+		return nil
+	default:
+		return errors.New("ssr: unknown access mode " + string(o.Mode))
+	}
+}
+
+// Guard returns middleware enforcing opts on the events endpoint:
+//
+//	app.GET("/events", ssr.Guard(ssr.AccessOptions{Mode: ssr.AccessLogin})(broker.ServeHTTP))
+//
+// Disallowed origins get 403 and unauthenticated clients 401. Allowed
+// cross-origin requests receive the CORS headers EventSource needs;
+// only listed origins are allowed credentials, never those let in by "*".
+func Guard(opts AccessOptions) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			r := c.Request()
+
+			if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(r, origin) {
+				allowed, listed := opts.originAllowed(origin)
+				if !allowed {
+					return c.Error(http.StatusForbidden, errors.New("origin not allowed"))
+				}
+				h := c.Response().Header()
+				if listed {
+					h.Set("Access-Control-Allow-Origin", origin)
+					h.Set("Access-Control-Allow-Credentials", "true")
+					h.Add("Vary", "Origin")
+				} else {
+					h.Set("Access-Control-Allow-Origin", "*")
+				}
+			}
+
+			switch opts.Mode {
+			case AccessLogin:
+				if !opts.authenticated(c) {
+					return c.Error(http.StatusUnauthorized, errors.New("login required"))
+				}
+			case AccessToken:
+				param := opts.TokenParam
+				if param == "" {
+					param = "token"
+				}
+				token := r.URL.Query().Get(param)
+				if token == "" || opts.VerifyToken == nil {
+					return c.Error(http.StatusUnauthorized, errors.New("token required"))
+				}
+				subject, err := opts.VerifyToken(token)
+				if err != nil {
+					return c.Error(http.StatusUnauthorized, err)
+				}
+				c.Set(SubjectContextKey, subject)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// originAllowed reports whether origin may connect, and whether it's
+// listed by name rather than only let in by "*".
+func (o AccessOptions) originAllowed(origin string) (allowed, listed bool) {
+	for _, a := range o.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return true, true
+		}
+		if a == "*" {
+			allowed = true
+		}
+	}
+	return allowed, false
+}
+
+func (o AccessOptions) authenticated(c buffalo.Context) bool {
+	if o.Authenticate != nil {
+		return o.Authenticate(c)
+	}
+	return c.Session().Get("user_id") != nil
+}
+
+// sameOrigin reports whether origin matches the host the request was sent to.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
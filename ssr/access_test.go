@@ -0,0 +1,103 @@
+package ssr
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveGuarded(opts AccessOptions, req *http.Request) *httptest.ResponseRecorder {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/events", Guard(opts)(func(c buffalo.Context) error {
+		subject, _ := c.Value(SubjectContextKey).(string)
+		c.Response().WriteHeader(http.StatusOK)
+		_, err := c.Response().Write([]byte(subject))
+		return err
+	}))
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGuardOrigins(t *testing.T) {
+	opts := AccessOptions{AllowedOrigins: []string{"https://partner.example.com"}}
+
+	t.Run("same origin is allowed", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://app.example.com/events", nil)
+		req.Header.Set("Origin", "http://app.example.com")
+		rec := serveGuarded(opts, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("listed origin gets CORS headers", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://app.example.com/events", nil)
+		req.Header.Set("Origin", "https://partner.example.com")
+		rec := serveGuarded(opts, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "https://partner.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("wildcard origins get no credentials", func(t *testing.T) {
+		opts := AccessOptions{AllowedOrigins: []string{"*"}}
+		req := httptest.NewRequest("GET", "http://app.example.com/events", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		rec := serveGuarded(opts, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+
+		assert.Error(t, AccessOptions{Mode: AccessLogin, AllowedOrigins: []string{"*"}}.Validate())
+		assert.NoError(t, AccessOptions{Mode: AccessLogin, AllowedOrigins: []string{"https://partner.example.com"}}.Validate())
+	})
+
+	t.Run("other origins are refused", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://app.example.com/events", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		rec := serveGuarded(opts, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestGuardModes(t *testing.T) {
+	t.Run("login mode rejects anonymous clients", func(t *testing.T) {
+		opts := AccessOptions{Mode: AccessLogin}
+		rec := serveGuarded(opts, httptest.NewRequest("GET", "/events", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		opts.Authenticate = func(buffalo.Context) bool { return true }
+		rec = serveGuarded(opts, httptest.NewRequest("GET", "/events", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("token mode verifies the query token", func(t *testing.T) {
+		opts := AccessOptions{
+			Mode: AccessToken,
+			VerifyToken: func(token string) (string, error) {
+				if token != "good" {
+					return "", errors.New("bad token")
+				}
+				return "user-1", nil
+			},
+		}
+		require.NoError(t, opts.Validate())
+
+		rec := serveGuarded(opts, httptest.NewRequest("GET", "/events?token=bad", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec = serveGuarded(opts, httptest.NewRequest("GET", "/events?token=good", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user-1", rec.Body.String())
+	})
+
+	t.Run("token mode requires a verifier", func(t *testing.T) {
+		assert.Error(t, AccessOptions{Mode: AccessToken}.Validate())
+	})
+}
@@ -12,18 +12,57 @@
 //	broker.Broadcast("update", []byte(`<div>New content</div>`))
 //
 // Client-side JavaScript connects to /events and listens for messages.
+//
+// # Event stream contract
+//
+// Every frame follows the SSE wire format:
+//
+//	id: 42
+//	event: update
+//	data: <div id="item-7">first line
+//	data: second line</div>
+//
+// Clients can rely on the following:
+//   - The first frame is "connected", whose data is {"id": "<client id>"}.
+//   - "heartbeat" frames arrive every 25 seconds with an RFC 3339 timestamp
+//     as data and no id; they can be ignored.
+//   - Broadcast events carry increasing numeric ids. Data spanning several
+//     lines is sent as one data: field per line, which EventSource joins
+//     back together with "\n".
+//   - Events sent with BroadcastJSON carry a single JSON document; parse it
+//     with JSON.parse(event.data). Other events carry HTML fragments.
+//
+// A typical client:
+//
+//	const source = new EventSource("/events");
+//	source.addEventListener("update", (e) => {
+//	    document.querySelector("#feed").insertAdjacentHTML("afterbegin", e.data);
+//	});
+//	source.addEventListener("job-progress", (e) => {
+//	    const { done, total } = JSON.parse(e.data);
+//	});
+//
+// Clients behind proxies that break streaming can long-poll /events/poll
+// instead (see PollHTTP). It returns the same events as JSON batches of
+// {"id", "event", "data"} together with a cursor for the next request.
 package ssr
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/clock"
 )
 
 // Event represents a server-sent event that will be sent to clients.
@@ -38,6 +77,48 @@ type Event struct {
 	// For Buffkit, this is usually rendered HTML that will replace elements
 	// on the page via JavaScript.
 	Data []byte
+
+	// Channel restricts delivery to clients subscribed to that channel.
+	// Empty means the event goes to every connected client.
+	Channel string
+
+	// ID is sent as the event's id: field. Browsers echo the last ID seen
+	// in the Last-Event-ID header when they reconnect. Broadcasts assign
+	// sequential IDs automatically when this is empty.
+	ID string
+
+	// Retry, if set, tells the browser how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// Write formats the event as an SSE frame. Multi-line data is split into
+// one data: field per line, so payloads containing newlines arrive intact.
+// Newlines in Name and ID would break the frame, so they are removed.
+func (e Event) Write(w io.Writer) error {
+	var b bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", stripNewlines(e.ID))
+	}
+	if e.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", stripNewlines(e.Name))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+
+	data := strings.ReplaceAll(string(e.Data), "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
 }
 
 // Client represents a connected SSE client.
@@ -60,6 +141,10 @@ type Client struct {
 	// Response is the underlying HTTP response writer for this SSE connection.
 	// We write SSE-formatted data directly to this writer.
 	Response http.ResponseWriter
+
+	// Channel is the channel this client was subscribed to when it connected,
+	// as determined by the broker's channel resolver. Empty for global clients.
+	Channel string
 }
 
 // Broker manages SSE connections and broadcasts.
@@ -103,8 +188,34 @@ type Broker struct {
 
 	// isShuttingDown prevents multiple shutdown calls
 	isShuttingDown bool
+
+	// channelResolver picks the channel for a connecting client.
+	// Set via SetChannelResolver; nil means all clients are global.
+	channelResolver func(c buffalo.Context) string
+
+	// history keeps recent events for PollHTTP and assigns event IDs.
+	history *history
+
+	// pollTimeout bounds how long PollHTTP waits for new events.
+	pollTimeout time.Duration
+
+	// clock drives heartbeats and poll timeouts; a fake in tests.
+	clock clock.Clock
+
+	// conns tracks ServeHTTP goroutines so Shutdown can wait for them
+	// to flush their queued events.
+	conns sync.WaitGroup
+
+	// onSubscribe and onUnsubscribe hold hooks registered with
+	// OnSubscribe and OnUnsubscribe. Protected by mu.
+	onSubscribe   []func(c buffalo.Context, client *Client) error
+	onUnsubscribe []func(client *Client)
 }
 
+// DefaultDrainTimeout bounds how long Shutdown waits for connected
+// clients to receive events that were queued before shutdown.
+const DefaultDrainTimeout = 5 * time.Second
+
 // NewBroker creates a new SSE broker and starts its event loops.
 // The broker immediately begins running in goroutines to handle:
 //   - Client registration/unregistration
@@ -116,6 +227,13 @@ type Broker struct {
 //	broker := ssr.NewBroker()
 //	app.GET("/events", broker.ServeHTTP)
 func NewBroker() *Broker {
+	return NewBrokerWithClock(clock.Real)
+}
+
+// NewBrokerWithClock creates a broker whose heartbeats and poll timeouts
+// follow clk, so tests can trigger them with a clock.Fake instead of
+// waiting.
+func NewBrokerWithClock(clk clock.Clock) *Broker {
 	broker := &Broker{
 		broadcast:         make(chan Event, 100),    // Buffer prevents blocking on broadcast
 		register:          make(chan *Client),       // Unbuffered for immediate handling
@@ -123,6 +241,9 @@ func NewBroker() *Broker {
 		clients:           make(map[string]*Client), // Active client registry
 		heartbeatInterval: 25 * time.Second,         // Conservative heartbeat interval
 		shutdown:          make(chan struct{}),      // Shutdown signal channel
+		history:           newHistory(DefaultHistorySize),
+		pollTimeout:       DefaultPollTimeout,
+		clock:             clock.Or(clk),
 	}
 
 	// Start the broker's main event loop in a goroutine.
@@ -156,10 +277,20 @@ func (b *Broker) run() {
 	for {
 		select {
 		case <-b.shutdown:
-			// Clean up all clients
+			// Deliver anything still queued, then tell every connection
+			// to flush its buffer and close.
+		drain:
+			for {
+				select {
+				case event := <-b.broadcast:
+					b.deliver(event)
+				default:
+					break drain
+				}
+			}
 			b.mu.Lock()
 			for _, client := range b.clients {
-				close(client.Events)
+				close(client.Closing)
 			}
 			b.clients = make(map[string]*Client)
 			b.mu.Unlock()
@@ -181,19 +312,29 @@ func (b *Broker) run() {
 			}
 
 		case event := <-b.broadcast:
-			// Broadcast event to all connected clients.
-			// Each client gets the event in their personal channel.
-			for _, client := range b.clients {
-				select {
-				case client.Events <- event:
-					// Event successfully queued for this client
-				default:
-					// Client's event buffer is full - drop the event.
-					// This prevents slow clients from blocking everyone.
-					// In production, you might want to disconnect slow clients.
-					log.Printf("SSE: Dropping event for slow client %s", client.ID)
-				}
-			}
+			b.deliver(event)
+		}
+	}
+}
+
+// deliver queues event for every client subscribed to its channel.
+// Only called from run.
+func (b *Broker) deliver(event Event) {
+	// Broadcast event to all connected clients.
+	// Each client gets the event in their personal channel.
+	for _, client := range b.clients {
+		// Channel-scoped events only go to clients on that channel
+		if event.Channel != "" && event.Channel != client.Channel {
+			continue
+		}
+		select {
+		case client.Events <- event:
+			// Event successfully queued for this client
+		default:
+			// Client's event buffer is full - drop the event.
+			// This prevents slow clients from blocking everyone.
+			// In production, you might want to disconnect slow clients.
+			log.Printf("SSE: Dropping event for slow client %s", client.ID)
 		}
 	}
 }
@@ -206,36 +347,87 @@ func (b *Broker) run() {
 // Heartbeats are sent as regular SSE events that clients can ignore or use
 // to verify the connection is still alive.
 func (b *Broker) heartbeat() {
-	ticker := time.NewTicker(b.heartbeatInterval)
+	ticker := b.clock.NewTicker(b.heartbeatInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-b.shutdown:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			// Send heartbeat event with current timestamp.
 			// Clients can use this to detect connection health.
-			b.broadcast <- Event{
+			select {
+			case b.broadcast <- Event{
 				Name: "heartbeat",
-				Data: []byte(time.Now().Format(time.RFC3339)),
+				Data: []byte(b.clock.Now().Format(time.RFC3339)),
+			}:
+			case <-b.shutdown:
+				return
 			}
 		}
 	}
 }
 
-// Shutdown gracefully stops the broker and all its goroutines
+// Shutdown gracefully stops the broker and all its goroutines.
+// Events queued before the call are still delivered; connections get up
+// to DefaultDrainTimeout to write them out before Shutdown returns.
 func (b *Broker) Shutdown() {
+	b.ShutdownWithTimeout(DefaultDrainTimeout)
+}
+
+// ShutdownWithTimeout is Shutdown with a custom drain timeout. It reports
+// whether every connection finished within the timeout.
+func (b *Broker) ShutdownWithTimeout(timeout time.Duration) bool {
 	b.mu.Lock()
 	if b.isShuttingDown {
 		b.mu.Unlock()
-		return
+		return true
 	}
 	b.isShuttingDown = true
 	b.mu.Unlock()
 
 	close(b.shutdown)
 	b.wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		b.conns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		log.Printf("SSE: Timed out after %s waiting for clients to drain", timeout)
+		return false
+	}
+}
+
+// OnSubscribe registers a hook that runs when a client connects, before
+// it receives any events. Returning an error rejects the connection with
+// 403, so hooks can enforce per-connection authorization as well as track
+// presence or metrics:
+//
+//	broker.OnSubscribe(func(c buffalo.Context, client *ssr.Client) error {
+//	    presence.Join(client.Channel, client.ID)
+//	    return nil
+//	})
+//
+// Hooks run on the connection's goroutine and should not block.
+func (b *Broker) OnSubscribe(fn func(c buffalo.Context, client *Client) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onSubscribe = append(b.onSubscribe, fn)
+}
+
+// OnUnsubscribe registers a hook that runs after a subscribed client
+// disconnects, including connections closed by Shutdown.
+func (b *Broker) OnUnsubscribe(fn func(client *Client)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onUnsubscribe = append(b.onUnsubscribe, fn)
 }
 
 // Broadcast sends an event to all connected clients.
@@ -251,10 +443,44 @@ func (b *Broker) Shutdown() {
 // is dropped with a warning log. This prevents a backup of events from blocking
 // the application.
 func (b *Broker) Broadcast(eventName string, html []byte) {
-	event := Event{
+	b.Publish(Event{
 		Name: eventName,
 		Data: html,
+	})
+}
+
+// BroadcastChannel sends an event only to clients subscribed to channel.
+// Use this to keep events private to a group of clients, e.g. a tenant:
+//
+//	broker.BroadcastChannel(tenancy.Channel(t), "update", html)
+//
+// An empty channel behaves like Broadcast.
+func (b *Broker) BroadcastChannel(channel, eventName string, html []byte) {
+	b.Publish(Event{Name: eventName, Data: html, Channel: channel})
+}
+
+// BroadcastJSON encodes v as JSON and sends it as eventName to clients on
+// channel (or everyone, if channel is empty). Clients parse it with
+// JSON.parse(event.data):
+//
+//	err := broker.BroadcastJSON("", "job-progress", map[string]int{"done": 3, "total": 10})
+func (b *Broker) BroadcastJSON(channel, eventName string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("ssr: encode %s event: %w", eventName, err)
 	}
+	b.Publish(Event{Name: eventName, Data: data, Channel: channel})
+	return nil
+}
+
+// Publish sends a fully specified event, assigning it the next sequential
+// ID if it has none. Use it when you need to set Retry or a custom ID.
+//
+// Publishing is non-blocking - if the broadcast channel is full, the event
+// is dropped with a warning log.
+func (b *Broker) Publish(event Event) {
+	// Record for long-polling clients; this also assigns the ID
+	b.history.add(&event)
 
 	// Non-blocking send to prevent deadlocks.
 	// If the broadcast buffer is full, we drop the event rather than block.
@@ -264,19 +490,72 @@ func (b *Broker) Broadcast(eventName string, html []byte) {
 	default:
 		// Broadcast channel is full - this indicates a serious problem
 		// (either too many events or the broker goroutine is stuck)
-		log.Printf("SSE: Broadcast channel full, dropping event %s", eventName)
+		log.Printf("SSE: Broadcast channel full, dropping event %s", event.Name)
 	}
 }
 
+// ErrBrokerShutdown is returned by PublishContext once the broker is
+// shut down.
+var ErrBrokerShutdown = errors.New("ssr: broker is shut down")
+
+// BroadcastContext is Broadcast for a caller that would rather wait than
+// drop the event: see PublishContext.
+func (b *Broker) BroadcastContext(ctx context.Context, eventName string, html []byte) error {
+	return b.PublishContext(ctx, Event{Name: eventName, Data: html})
+}
+
+// PublishContext is Publish that waits for room when the broadcast
+// buffer is full instead of dropping the event, until ctx is done. Pass
+// the request so a handler stops waiting when its client goes away:
+//
+//	if err := broker.PublishContext(c, event); err != nil {
+//	    return err
+//	}
+//
+// It returns ctx's error if ctx ends first, in which case connected
+// clients miss the event (long-polling clients still see it), or
+// ErrBrokerShutdown after Shutdown.
+func (b *Broker) PublishContext(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-b.shutdown:
+		return ErrBrokerShutdown
+	default:
+	}
+
+	b.history.add(&event)
+	select {
+	case b.broadcast <- event:
+		return nil
+	case <-b.shutdown:
+		return ErrBrokerShutdown
+	case <-ctx.Done():
+		log.Printf("SSE: Gave up broadcasting event %s: %v", event.Name, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// SetChannelResolver installs a function that determines which channel a
+// connecting client subscribes to. It is evaluated once per connection:
+//
+//	broker.SetChannelResolver(tenancy.SSEChannel)
+//
+// Must be called before clients connect.
+func (b *Broker) SetChannelResolver(fn func(c buffalo.Context) string) {
+	b.channelResolver = fn
+}
+
 // ServeHTTP handles SSE connections from clients.
 // This is a Buffalo handler that should be mounted on a GET route:
 //
 //	app.GET("/events", broker.ServeHTTP)
 //
 // When a client connects, this handler:
-//  1. Sets appropriate SSE headers
-//  2. Creates a Client instance
-//  3. Registers the client with the broker
+//  1. Creates a Client instance and runs OnSubscribe hooks
+//  2. Registers the client with the broker
+//  3. Sets appropriate SSE headers
 //  4. Sends an initial connection event
 //  5. Enters a loop sending events until disconnect
 //
@@ -286,13 +565,6 @@ func (b *Broker) ServeHTTP(c buffalo.Context) error {
 	w := c.Response()
 	r := c.Request()
 
-	// Set SSE-specific headers.
-	// These tell the browser this is an event stream, not a regular response.
-	w.Header().Set("Content-Type", "text/event-stream") // SSE MIME type
-	w.Header().Set("Cache-Control", "no-cache")         // Prevent caching of events
-	w.Header().Set("Connection", "keep-alive")          // Keep connection open
-	w.Header().Set("X-Accel-Buffering", "no")           // Disable Nginx buffering
-
 	// Create new client instance for this connection.
 	// Each connection gets a unique ID and its own event channel.
 	client := &Client{
@@ -301,15 +573,59 @@ func (b *Broker) ServeHTTP(c buffalo.Context) error {
 		Closing:  make(chan bool, 1),                       // Signal channel for shutdown
 		Response: w,                                        // Store response writer
 	}
+	if b.channelResolver != nil {
+		client.Channel = b.channelResolver(c)
+	}
+
+	b.mu.RLock()
+	subscribeHooks := b.onSubscribe
+	unsubscribeHooks := b.onUnsubscribe
+	b.mu.RUnlock()
+
+	for _, hook := range subscribeHooks {
+		if err := hook(c, client); err != nil {
+			return c.Error(http.StatusForbidden, err)
+		}
+	}
+
+	// Count the connection before registering it, under the lock
+	// ShutdownWithTimeout takes, so its drain can't start without it.
+	b.mu.Lock()
+	if b.isShuttingDown {
+		b.mu.Unlock()
+		return c.Error(http.StatusServiceUnavailable, fmt.Errorf("event stream is shutting down"))
+	}
+	b.conns.Add(1)
+	b.mu.Unlock()
 
 	// Register client with broker.
 	// This adds the client to the active clients map.
-	b.register <- client
+	select {
+	case b.register <- client:
+	case <-b.shutdown:
+		b.conns.Done()
+		return c.Error(http.StatusServiceUnavailable, fmt.Errorf("event stream is shutting down"))
+	}
+
+	// Set SSE-specific headers.
+	// These tell the browser this is an event stream, not a regular response.
+	w.Header().Set("Content-Type", "text/event-stream") // SSE MIME type
+	w.Header().Set("Cache-Control", "no-cache")         // Prevent caching of events
+	w.Header().Set("Connection", "keep-alive")          // Keep connection open
+	w.Header().Set("X-Accel-Buffering", "no")           // Disable Nginx buffering
 
 	// Ensure cleanup when this function exits.
-	// This handles both normal disconnects and errors.
+	// This handles both normal disconnects and errors. After shutdown the
+	// broker has already dropped the client, so there is nothing to send.
 	defer func() {
-		b.unregister <- client
+		select {
+		case b.unregister <- client:
+		case <-b.shutdown:
+		}
+		for _, hook := range unsubscribeHooks {
+			hook(client)
+		}
+		b.conns.Done()
 	}()
 
 	// Get flusher for immediate writes.
@@ -322,7 +638,7 @@ func (b *Broker) ServeHTTP(c buffalo.Context) error {
 	// Send initial connection event.
 	// This confirms to the client that SSE is working and provides the client ID.
 	// Format: "event: connected\ndata: {json}\n\n"
-	_, _ = fmt.Fprintf(w, "event: connected\ndata: {\"id\":\"%s\"}\n\n", client.ID)
+	_ = Event{Name: "connected", Data: []byte(fmt.Sprintf(`{"id":"%s"}`, client.ID))}.Write(w)
 	flusher.Flush()
 
 	// Listen for client disconnect via request context.
@@ -335,12 +651,9 @@ func (b *Broker) ServeHTTP(c buffalo.Context) error {
 		select {
 		case event := <-client.Events:
 			// Send event to client in SSE format.
-			// Format: "event: <name>\ndata: <data>\n\n"
+			// Format: "id: <id>\nevent: <name>\ndata: <data>\n\n"
 			// The double newline signals end of event.
-			if event.Name != "" {
-				_, _ = fmt.Fprintf(w, "event: %s\n", event.Name)
-			}
-			_, _ = fmt.Fprintf(w, "data: %s\n\n", event.Data)
+			_ = event.Write(w)
 			flusher.Flush() // Immediately send to client
 
 		case <-notify:
@@ -350,8 +663,17 @@ func (b *Broker) ServeHTTP(c buffalo.Context) error {
 
 		case <-client.Closing:
 			// Server closing this connection (shutdown, max clients, etc).
-			// Exit gracefully - cleanup handled by defer.
-			return nil
+			// Flush events already queued for this client, then exit;
+			// cleanup handled by defer.
+			for {
+				select {
+				case event := <-client.Events:
+					_ = event.Write(w)
+				default:
+					flusher.Flush()
+					return nil
+				}
+			}
 		}
 	}
 }
@@ -0,0 +1,167 @@
+package ssr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventWrite(t *testing.T) {
+	var buf bytes.Buffer
+	err := Event{
+		ID:    "7",
+		Name:  "update",
+		Data:  []byte("<p>one</p>\r\n<p>two</p>\n"),
+		Retry: 3 * time.Second,
+	}.Write(&buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, "id: 7\nevent: update\nretry: 3000\ndata: <p>one</p>\ndata: <p>two</p>\ndata: \n\n", buf.String())
+}
+
+func TestEventWriteStripsNewlinesFromFields(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Event{Name: "bad\nevent: injected", Data: []byte("x")}.Write(&buf))
+	assert.Equal(t, "event: badevent: injected\ndata: x\n\n", buf.String())
+}
+
+func TestBroadcastJSON(t *testing.T) {
+	broker := NewBroker()
+	defer broker.Shutdown()
+
+	client := &Client{ID: "c1", Events: make(chan Event, 10), Closing: make(chan bool, 1), Channel: "tenant:1"}
+	broker.register <- client
+
+	require.NoError(t, broker.BroadcastJSON("tenant:2", "progress", map[string]int{"done": 1}))
+	require.NoError(t, broker.BroadcastJSON("tenant:1", "progress", map[string]int{"done": 2}))
+	assert.Error(t, broker.BroadcastJSON("", "bad", make(chan int)))
+
+	select {
+	case event := <-client.Events:
+		assert.Equal(t, "progress", event.Name)
+		assert.JSONEq(t, `{"done":2}`, string(event.Data))
+		assert.Equal(t, "2", event.ID, "IDs are assigned to every broadcast")
+	case <-time.After(time.Second):
+		t.Fatal("expected an event for the client's channel")
+	}
+}
+
+func TestSubscribeHooks(t *testing.T) {
+	broker := NewBroker()
+	defer broker.Shutdown()
+
+	subscribed := make(chan string, 1)
+	unsubscribed := make(chan string, 1)
+	broker.OnSubscribe(func(c buffalo.Context, client *Client) error {
+		if c.Param("deny") != "" {
+			return errors.New("denied")
+		}
+		subscribed <- client.ID
+		return nil
+	})
+	broker.OnUnsubscribe(func(client *Client) { unsubscribed <- client.ID })
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/events", broker.ServeHTTP)
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?deny=1")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/events", nil)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	id := <-subscribed
+	cancel()
+
+	select {
+	case got := <-unsubscribed:
+		assert.Equal(t, id, got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnUnsubscribe was not called after disconnect")
+	}
+}
+
+func TestShutdownDrainsQueuedEvents(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	broker := NewBroker()
+	connected := make(chan struct{}, 1)
+	broker.OnSubscribe(func(buffalo.Context, *Client) error {
+		connected <- struct{}{}
+		return nil
+	})
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/events", broker.ServeHTTP)
+	srv := httptest.NewServer(app)
+
+	transport := &http.Transport{}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(srv.URL + "/events")
+	require.NoError(t, err)
+	<-connected
+
+	// Give the run loop a moment to register the client
+	time.Sleep(50 * time.Millisecond)
+	broker.Broadcast("final", []byte("bye"))
+	assert.True(t, broker.ShutdownWithTimeout(2*time.Second), "connections should drain before the timeout")
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Contains(t, string(body), "event: final\ndata: bye\n\n")
+
+	// Shutdown is idempotent
+	broker.Shutdown()
+
+	srv.Close()
+	transport.CloseIdleConnections()
+
+	// Every broker and connection goroutine should be gone
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), baseline, "goroutines leaked after shutdown")
+}
+
+func TestPublishContext(t *testing.T) {
+	// No run loop, so sends block until something receives
+	broker := &Broker{broadcast: make(chan Event), shutdown: make(chan struct{}), history: newHistory(10)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := broker.BroadcastContext(ctx, "update", []byte("<p>1</p>"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, broker.PublishContext(canceled, Event{Name: "update"}), context.Canceled)
+	events, _, _, _ := broker.history.since(0, "")
+	assert.Len(t, events, 1, "an already canceled publish isn't recorded")
+
+	received := make(chan Event, 1)
+	go func() { received <- <-broker.broadcast }()
+	require.NoError(t, broker.PublishContext(context.Background(), Event{Name: "update", Data: []byte("<p>2</p>")}))
+	assert.Equal(t, "<p>2</p>", string((<-received).Data))
+
+	close(broker.shutdown)
+	assert.ErrorIs(t, broker.PublishContext(context.Background(), Event{Name: "update"}), ErrBrokerShutdown)
+}
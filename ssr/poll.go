@@ -0,0 +1,166 @@
+package ssr
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// DefaultHistorySize is how many recent events the broker keeps for
+// long-polling clients.
+const DefaultHistorySize = 256
+
+// DefaultPollTimeout is how long a poll waits for new events before
+// returning an empty batch.
+const DefaultPollTimeout = 25 * time.Second
+
+// history is a ring of recently published events, numbered by a
+// sequence that doubles as the long-polling cursor.
+type history struct {
+	mu      sync.Mutex
+	size    int
+	seq     uint64
+	entries []historyEntry
+	changed chan struct{} // closed and replaced on every append
+}
+
+type historyEntry struct {
+	seq   uint64
+	event Event
+}
+
+func newHistory(size int) *history {
+	return &history{size: size, changed: make(chan struct{})}
+}
+
+// add records event, assigning its ID from the sequence if it has none.
+func (h *history) add(event *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	if event.ID == "" {
+		event.ID = strconv.FormatUint(h.seq, 10)
+	}
+	h.entries = append(h.entries, historyEntry{seq: h.seq, event: *event})
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// since returns events after cursor visible on channel, the cursor to
+// poll from next, whether events between cursor and the oldest retained
+// event were lost, and a channel closed when more events arrive. A
+// cursor ahead of the sequence, such as one kept across a restart, is
+// missed too, so the client resyncs from the current sequence.
+func (h *history) since(cursor uint64, channel string) ([]Event, uint64, bool, <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if cursor > h.seq {
+		return nil, h.seq, true, h.changed
+	}
+	missed := len(h.entries) > 0 && cursor+1 < h.entries[0].seq
+	var events []Event
+	for _, e := range h.entries {
+		if e.seq <= cursor {
+			continue
+		}
+		if e.event.Channel != "" && e.event.Channel != channel {
+			continue
+		}
+		events = append(events, e.event)
+	}
+	return events, h.seq, missed, h.changed
+}
+
+// PollEvent is one event in a long-poll response.
+type PollEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  string `json:"data"`
+}
+
+// PollResponse is the body returned by PollHTTP.
+type PollResponse struct {
+	// Events published since the request's cursor, oldest first.
+	Events []PollEvent `json:"events"`
+
+	// Cursor to send as ?cursor= on the next poll.
+	Cursor string `json:"cursor"`
+
+	// Missed is true when the cursor was older than the broker's history,
+	// or newer than any event it has seen, as after a restart, so some
+	// events were lost. Clients should reload the affected view.
+	Missed bool `json:"missed"`
+}
+
+// PollHTTP is a long-polling fallback for clients whose proxies break
+// SSE. Mount it next to the stream:
+//
+//	app.GET("/events/poll", broker.PollHTTP)
+//
+// Clients call it with the cursor from the previous response. Without a
+// cursor it returns immediately with the current cursor, so the first poll
+// starts "from now". Otherwise it waits up to DefaultPollTimeout for events
+// after the cursor. Events are scoped by the channel resolver exactly like
+// stream clients; heartbeats are never included.
+func (b *Broker) PollHTTP(c buffalo.Context) error {
+	channel := ""
+	if b.channelResolver != nil {
+		channel = b.channelResolver(c)
+	}
+
+	raw := c.Param("cursor")
+	if raw == "" {
+		_, seq, _, _ := b.history.since(0, channel)
+		return c.Render(http.StatusOK, render.JSON(PollResponse{
+			Events: []PollEvent{},
+			Cursor: strconv.FormatUint(seq, 10),
+		}))
+	}
+
+	cursor, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	timeout := b.clock.After(b.pollTimeout)
+
+	for {
+		events, seq, missed, changed := b.history.since(cursor, channel)
+		if len(events) > 0 || missed {
+			return c.Render(http.StatusOK, render.JSON(newPollResponse(events, seq, missed)))
+		}
+
+		select {
+		case <-changed:
+			// New event published; it may be on another channel, so re-check
+		case <-timeout:
+			return c.Render(http.StatusOK, render.JSON(newPollResponse(nil, seq, false)))
+		case <-c.Request().Context().Done():
+			return nil
+		case <-b.shutdown:
+			return c.Render(http.StatusOK, render.JSON(newPollResponse(nil, seq, false)))
+		}
+	}
+}
+
+func newPollResponse(events []Event, seq uint64, missed bool) PollResponse {
+	resp := PollResponse{
+		Events: make([]PollEvent, 0, len(events)),
+		Cursor: strconv.FormatUint(seq, 10),
+		Missed: missed,
+	}
+	for _, e := range events {
+		resp.Events = append(resp.Events, PollEvent{ID: e.ID, Event: e.Name, Data: string(e.Data)})
+	}
+	return resp
+}
@@ -0,0 +1,108 @@
+package ssr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func poll(t *testing.T, app *buffalo.App, query string) PollResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/events/poll"+query, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp PollResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestPollHTTP(t *testing.T) {
+	broker := NewBroker()
+	defer broker.Shutdown()
+	broker.pollTimeout = 50 * time.Millisecond
+	broker.SetChannelResolver(func(c buffalo.Context) string { return c.Param("channel") })
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/events/poll", broker.PollHTTP)
+
+	broker.Broadcast("before", []byte("old"))
+
+	first := poll(t, app, "")
+	assert.Empty(t, first.Events, "the first poll starts from now")
+
+	broker.Broadcast("update", []byte("<p>hi</p>"))
+	broker.BroadcastChannel("tenant:2", "private", []byte("secret"))
+	require.NoError(t, broker.BroadcastJSON("tenant:1", "progress", map[string]int{"done": 1}))
+
+	resp := poll(t, app, "?channel=tenant:1&cursor="+first.Cursor)
+	require.Len(t, resp.Events, 2)
+	assert.Equal(t, "update", resp.Events[0].Event)
+	assert.Equal(t, "<p>hi</p>", resp.Events[0].Data)
+	assert.Equal(t, "progress", resp.Events[1].Event)
+	assert.False(t, resp.Missed)
+
+	t.Run("times out with an empty batch", func(t *testing.T) {
+		empty := poll(t, app, "?cursor="+resp.Cursor)
+		assert.Empty(t, empty.Events)
+		assert.Equal(t, resp.Cursor, empty.Cursor)
+	})
+
+	t.Run("waits for the next event", func(t *testing.T) {
+		broker.pollTimeout = 2 * time.Second
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			broker.Broadcast("late", []byte("x"))
+		}()
+		next := poll(t, app, "?cursor="+resp.Cursor)
+		require.Len(t, next.Events, 1)
+		assert.Equal(t, "late", next.Events[0].Event)
+	})
+
+	t.Run("reports missed events", func(t *testing.T) {
+		broker.history = newHistory(2)
+		for i := 0; i < 5; i++ {
+			broker.Broadcast("flood", []byte("x"))
+		}
+		missed := poll(t, app, "?cursor=1")
+		assert.True(t, missed.Missed)
+		assert.Len(t, missed.Events, 2)
+
+		// A cursor from before a restart is ahead of the new sequence
+		ahead := poll(t, app, "?cursor=99")
+		assert.True(t, ahead.Missed)
+		assert.Empty(t, ahead.Events)
+		assert.Equal(t, "5", ahead.Cursor)
+	})
+}
+
+func TestPollTimeoutFollowsClock(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	broker := NewBrokerWithClock(clk)
+	defer broker.Shutdown()
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/events/poll", broker.PollHTTP)
+	first := poll(t, app, "")
+
+	done := make(chan PollResponse)
+	go func() { done <- poll(t, app, "?cursor="+first.Cursor) }()
+
+	// The broker's heartbeat ticker is always pending; the poll adds a timer.
+	require.Eventually(t, func() bool { return clk.Timers() >= 2 }, time.Second, time.Millisecond)
+	clk.Advance(DefaultPollTimeout)
+
+	select {
+	case resp := <-done:
+		assert.Empty(t, resp.Events)
+	case <-time.After(time.Second):
+		t.Fatal("poll did not time out when the clock advanced")
+	}
+}
@@ -0,0 +1,56 @@
+package buffkit
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrStaleRecord matches, with errors.Is, the *StaleRecordError a
+// generated model's Update returns when the record changed since it was
+// loaded.
+var ErrStaleRecord = errors.New("buffkit: record changed since it was loaded")
+
+// StaleRecordError is returned by generated models' Update methods when
+// the record's lock_version no longer matches the one it was loaded
+// with: someone else saved it in between, or deleted it. Handlers
+// re-render the form with PublicMessage instead of overwriting their
+// changes:
+//
+//	var stale *buffkit.StaleRecordError
+//	if errors.As(err, &stale) {
+//	    c.Set("conflict", stale.PublicMessage())
+//	    return c.Render(http.StatusConflict, r.HTML("posts/edit.plush.html"))
+//	}
+type StaleRecordError struct {
+	Table string
+	ID    any
+}
+
+func (e *StaleRecordError) Error() string {
+	return fmt.Sprintf("buffkit: %s %v changed since it was loaded", e.Table, e.ID)
+}
+
+// Is makes errors.Is(err, ErrStaleRecord) true.
+func (e *StaleRecordError) Is(target error) bool {
+	return target == ErrStaleRecord
+}
+
+// PublicMessage is the conflict message for the form.
+func (e *StaleRecordError) PublicMessage() string {
+	return "Someone else changed this while you were editing it. Check their changes, then save yours again."
+}
+
+// CheckLockVersion returns a *StaleRecordError when res, the result of
+// an UPDATE ... WHERE id = ? AND lock_version = ?, changed no rows.
+// Generated models' Update methods call it.
+func CheckLockVersion(res sql.Result, table string, id any) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("buffkit: check lock_version of %s %v: %w", table, id, err)
+	}
+	if n == 0 {
+		return &StaleRecordError{Table: table, ID: id}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package buffkit
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLockVersion(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT, lock_version INTEGER NOT NULL DEFAULT 1)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO posts (id, title) VALUES (1, 'Draft')`)
+	require.NoError(t, err)
+
+	// update saves title over the version the editor loaded
+	update := func(title string, version int) error {
+		res, err := db.Exec(`UPDATE posts SET title = ?, lock_version = lock_version + 1 WHERE id = ? AND lock_version = ?`, title, 1, version)
+		require.NoError(t, err)
+		return CheckLockVersion(res, "posts", 1)
+	}
+
+	require.NoError(t, update("First", 1))
+	err = update("Second", 1)
+	require.Error(t, err, "the first save moved the version on")
+	assert.True(t, errors.Is(err, ErrStaleRecord))
+	var stale *StaleRecordError
+	require.True(t, errors.As(err, &stale))
+	assert.Equal(t, "posts", stale.Table)
+	assert.Equal(t, "buffkit: posts 1 changed since it was loaded", err.Error())
+	assert.Contains(t, stale.PublicMessage(), "Someone else changed this")
+
+	require.NoError(t, update("Second", 2))
+	var title string
+	require.NoError(t, db.QueryRow(`SELECT title FROM posts WHERE id = 1`).Scan(&title))
+	assert.Equal(t, "Second", title)
+}
@@ -0,0 +1,69 @@
+package tags
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/components"
+)
+
+// tagInputCSS sizes the field with the theme tokens.
+const tagInputCSS = `.bk-tag-input { display: block; }
+.bk-tag-input input { display: block; width: 100%; margin-top: 0.25rem; }
+.bk-tag-input small { color: var(--bk-muted, #71717a); }`
+
+// RegisterComponents registers <bk-tag-input>, a comma separated tags
+// field that suggests existing tags as people type:
+//
+//	<bk-tag-input name="tags" target="posts:<%= post.ID %>"></bk-tag-input>
+//	<bk-tag-input name="tags" value="<%= tags %>" label="Topics"></bk-tag-input>
+//
+// The field is filled from value or, if there's none, the tags of the
+// record target names. Suggestions come from the autocomplete endpoint,
+// through htmx, into a <datalist>. Parse reads the submitted field.
+func (t *Tags) RegisterComponents(r *components.Registry) {
+	r.RegisterContext("bk-tag-input", func(c buffalo.Context, attrs, slots map[string]string) ([]byte, error) {
+		name := attrs["name"]
+		if name == "" {
+			name = "tags"
+		}
+		value, ok := attrs["value"]
+		if target := attrs["target"]; !ok && target != "" {
+			typ, id, found := strings.Cut(target, ":")
+			if !found || typ == "" || id == "" {
+				return nil, fmt.Errorf("bk-tag-input: target %q is not type:id", target)
+			}
+			if c == nil {
+				return nil, fmt.Errorf("bk-tag-input: %s must be rendered for a request", target)
+			}
+			list, err := t.Store.Tags(c, typ, id)
+			if err != nil {
+				return nil, err
+			}
+			value = Join(list)
+		}
+		id := attrs["id"]
+		if id == "" {
+			id = "bk-tag-input-" + name
+		}
+		label := attrs["label"]
+		if label == "" {
+			label = "Tags"
+		}
+
+		list := "bk-tags-" + name
+		var b strings.Builder
+		fmt.Fprintf(&b, `<label class="bk-tag-input" for="%s">%s`, html.EscapeString(id), html.EscapeString(label))
+		fmt.Fprintf(&b, `<input type="text" id="%s" name="%s" value="%s" list="%s" autocomplete="off"`,
+			html.EscapeString(id), html.EscapeString(name), html.EscapeString(value), html.EscapeString(list))
+		fmt.Fprintf(&b, ` hx-get="%s?input=%s" hx-trigger="input changed delay:200ms" hx-target="#%s" hx-swap="innerHTML">`,
+			html.EscapeString(t.path()), html.EscapeString(url.QueryEscape(name)), html.EscapeString(list))
+		b.WriteString(`<small>Separate tags with commas.</small></label>`)
+		fmt.Fprintf(&b, `<datalist id="%s"></datalist>`, html.EscapeString(list))
+		return []byte(b.String()), nil
+	})
+	r.RegisterCSS("bk-tag-input", tagInputCSS)
+}
@@ -0,0 +1,292 @@
+package tags
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnjansen/buffkit/internal/sqlutil"
+	"github.com/johnjansen/buffkit/readonly"
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// MemoryStore keeps tags in memory, for tests and development.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	tags     map[string]Tag      // by slug
+	taggings map[record][]string // tag IDs, by record
+}
+
+// record is a tagged record.
+type record struct {
+	typ, id string
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tags: make(map[string]Tag), taggings: make(map[record][]string)}
+}
+
+func (s *MemoryStore) Ensure(ctx context.Context, names []string) ([]Tag, error) {
+	if err := readonly.Check("tags.Ensure"); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Tag
+	for _, name := range names {
+		slug := Slug(name)
+		tag, ok := s.tags[slug]
+		if !ok {
+			id, err := newID()
+			if err != nil {
+				return nil, err
+			}
+			tag = Tag{ID: id, Name: normalize(name), Slug: slug}
+			s.tags[slug] = tag
+		}
+		out = append(out, tag)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Tags(ctx context.Context, typ, id string) ([]Tag, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make(map[string]bool)
+	for _, tagID := range s.taggings[record{typ, id}] {
+		ids[tagID] = true
+	}
+	var out []Tag
+	for _, tag := range s.tags {
+		if ids[tag.ID] {
+			out = append(out, tag)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Slug < out[j].Slug })
+	return out, nil
+}
+
+func (s *MemoryStore) Replace(ctx context.Context, typ, id string, tagIDs []string) error {
+	if err := readonly.Check("tags.Replace"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(tagIDs) == 0 {
+		delete(s.taggings, record{typ, id})
+		return nil
+	}
+	s.taggings[record{typ, id}] = append([]string(nil), tagIDs...)
+	return nil
+}
+
+func (s *MemoryStore) Search(ctx context.Context, prefix string, limit int) ([]Tag, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, ids := range s.taggings {
+		for _, id := range ids {
+			counts[id]++
+		}
+	}
+	var out []Tag
+	for slug, tag := range s.tags {
+		if strings.HasPrefix(slug, prefix) {
+			tag.Count = counts[tag.ID]
+			out = append(out, tag)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Slug < out[j].Slug
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Tagged(ctx context.Context, typ, slug string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tag, ok := s.tags[slug]
+	if !ok {
+		return nil, nil
+	}
+	var out []string
+	for r, ids := range s.taggings {
+		if r.typ != typ {
+			continue
+		}
+		for _, id := range ids {
+			if id == tag.ID {
+				out = append(out, r.id)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// SQLStore keeps tags in the tags and taggings tables created by the
+// db/migrations/tags migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates a tag store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) Ensure(ctx context.Context, names []string) ([]Tag, error) {
+	if err := readonly.Check("tags.Ensure"); err != nil {
+		return nil, err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	var out []Tag
+	for _, name := range names {
+		tag, err := s.bySlug(ctx, Slug(name))
+		if errors.Is(err, sql.ErrNoRows) {
+			id, err := newID()
+			if err != nil {
+				return nil, err
+			}
+			tag = Tag{ID: id, Name: normalize(name), Slug: Slug(name)}
+			_, err = s.db.ExecContext(ctx, sqlutil.Rebind(s.dialect, "INSERT INTO tags (id, name, slug) VALUES (?, ?, ?)"), tag.ID, tag.Name, tag.Slug)
+			if err != nil {
+				// Someone else may have just created it
+				if tag, err = s.bySlug(ctx, tag.Slug); err != nil {
+					return nil, err
+				}
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		out = append(out, tag)
+	}
+	return out, nil
+}
+
+func (s *SQLStore) bySlug(ctx context.Context, slug string) (Tag, error) {
+	var tag Tag
+	err := s.db.QueryRowContext(ctx, sqlutil.Rebind(s.dialect, "SELECT id, name, slug FROM tags WHERE slug = ?"), slug).
+		Scan(&tag.ID, &tag.Name, &tag.Slug)
+	return tag, err
+}
+
+func (s *SQLStore) Tags(ctx context.Context, typ, id string) ([]Tag, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	return s.query(ctx, `SELECT t.id, t.name, t.slug, 0 FROM tags t
+		JOIN taggings g ON g.tag_id = t.id
+		WHERE g.taggable_type = ? AND g.taggable_id = ?
+		ORDER BY t.slug`, typ, id)
+}
+
+func (s *SQLStore) Replace(ctx context.Context, typ, id string, tagIDs []string) error {
+	if err := readonly.Check("tags.Replace"); err != nil {
+		return err
+	}
+	defer timing.Start(ctx, timing.DB)()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, sqlutil.Rebind(s.dialect, "DELETE FROM taggings WHERE taggable_type = ? AND taggable_id = ?"), typ, id); err != nil {
+		return err
+	}
+	for _, tagID := range tagIDs {
+		if _, err := tx.ExecContext(ctx, sqlutil.Rebind(s.dialect,
+			"INSERT INTO taggings (tag_id, taggable_type, taggable_id) VALUES (?, ?, ?)"), tagID, typ, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Search(ctx context.Context, prefix string, limit int) ([]Tag, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	// Slugs are letters, digits and hyphens, so the prefix has no LIKE
+	// wildcards to escape
+	query := `SELECT t.id, t.name, t.slug, COUNT(g.tag_id) FROM tags t
+		LEFT JOIN taggings g ON g.tag_id = t.id
+		WHERE t.slug LIKE ?
+		GROUP BY t.id, t.name, t.slug
+		ORDER BY COUNT(g.tag_id) DESC, t.slug`
+	args := []any{prefix + "%"}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	return s.query(ctx, query, args...)
+}
+
+func (s *SQLStore) Tagged(ctx context.Context, typ, slug string) ([]string, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect, `SELECT g.taggable_id FROM taggings g
+		JOIN tags t ON t.id = g.tag_id
+		WHERE g.taggable_type = ? AND t.slug = ?
+		ORDER BY g.taggable_id`), typ, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// query returns the tags query selects: id, name, slug and count.
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) ([]Tag, error) {
+	rows, err := s.db.QueryContext(ctx, sqlutil.Rebind(s.dialect, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, tag)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,286 @@
+// Package tags lets users tag any record: posts, products, tickets.
+// Tags are shared across record types and matched by slug, so "Go",
+// "go" and " GO " are one tag. Records take part by implementing
+// Taggable, which models generated with --taggable do:
+//
+//	buffalo task buffkit:generate:model post title:string --taggable
+//
+//	err := kit.Tags.Set(ctx, post, tags.Parse(c.Param("tags")))
+//	list, err := kit.Tags.For(ctx, post)
+//	ids, err := kit.Tags.Tagged(ctx, "posts", "go")
+//
+// Wire mounts the autocomplete endpoint when Config.Tags is set, and
+// registers <bk-tag-input>, a text field that suggests existing tags as
+// people type.
+package tags
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+)
+
+// MaxLength is the longest tag name, in characters; longer names are
+// cut short.
+const MaxLength = 50
+
+// suggestions is how many tags the autocomplete endpoint suggests.
+const suggestions = 10
+
+// Tag is a label records can share.
+type Tag struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+
+	// Count is how many records have the tag, where a query says so.
+	Count int `json:"count"`
+}
+
+// Taggable is a record that can be tagged. TaggableType names the kind
+// of record, usually its table ("posts"), and TaggableID the record.
+type Taggable interface {
+	TaggableType() string
+	TaggableID() string
+}
+
+// Store keeps tags and which records have them. MemoryStore suits tests
+// and development; SQLStore keeps them in the database.
+type Store interface {
+	// Ensure returns the tags named names, creating those that don't
+	// exist. Names are matched by slug.
+	Ensure(ctx context.Context, names []string) ([]Tag, error)
+
+	// Tags returns the tags of the record typ and id, by name.
+	Tags(ctx context.Context, typ, id string) ([]Tag, error)
+
+	// Replace sets the tags of the record typ and id to tagIDs.
+	Replace(ctx context.Context, typ, id string, tagIDs []string) error
+
+	// Search returns up to limit tags whose slugs start with prefix,
+	// with their counts, most used first.
+	Search(ctx context.Context, prefix string, limit int) ([]Tag, error)
+
+	// Tagged returns the IDs of typ's records tagged slug.
+	Tagged(ctx context.Context, typ, slug string) ([]string, error)
+}
+
+// Tags tags records and suggests tags.
+type Tags struct {
+	Store Store
+
+	// Path is where the autocomplete endpoint is mounted. Defaults to
+	// "/tags".
+	Path string
+}
+
+// New creates a Tags that keeps tags in store.
+func New(store Store) *Tags {
+	return &Tags{Store: store}
+}
+
+// For returns record's tags, by name.
+func (t *Tags) For(ctx context.Context, record Taggable) ([]Tag, error) {
+	return t.Store.Tags(ctx, record.TaggableType(), record.TaggableID())
+}
+
+// Set replaces record's tags with the tags named names, creating any
+// that don't exist yet. Parse turns a form field into names.
+func (t *Tags) Set(ctx context.Context, record Taggable, names []string) error {
+	names = clean(names)
+	var ids []string
+	if len(names) > 0 {
+		list, err := t.Store.Ensure(ctx, names)
+		if err != nil {
+			return err
+		}
+		for _, tag := range list {
+			ids = append(ids, tag.ID)
+		}
+	}
+	return t.Store.Replace(ctx, record.TaggableType(), record.TaggableID(), ids)
+}
+
+// Add gives record the tags named names, keeping those it has.
+func (t *Tags) Add(ctx context.Context, record Taggable, names ...string) error {
+	current, err := t.For(ctx, record)
+	if err != nil {
+		return err
+	}
+	return t.Set(ctx, record, append(Names(current), names...))
+}
+
+// Remove takes the tags named names off record.
+func (t *Tags) Remove(ctx context.Context, record Taggable, names ...string) error {
+	current, err := t.For(ctx, record)
+	if err != nil {
+		return err
+	}
+	drop := make(map[string]bool, len(names))
+	for _, name := range names {
+		drop[Slug(name)] = true
+	}
+	var keep []string
+	for _, tag := range current {
+		if !drop[tag.Slug] {
+			keep = append(keep, tag.Name)
+		}
+	}
+	return t.Set(ctx, record, keep)
+}
+
+// Tagged returns the IDs of typ's records tagged name.
+func (t *Tags) Tagged(ctx context.Context, typ, name string) ([]string, error) {
+	return t.Store.Tagged(ctx, typ, Slug(name))
+}
+
+// Routes lists the method and path of every route Mount adds.
+func (t *Tags) Routes() [][2]string {
+	return [][2]string{{http.MethodGet, t.path()}}
+}
+
+// Mount adds the autocomplete endpoint to app. It requires login.
+func (t *Tags) Mount(app *buffalo.App) {
+	app.GET(t.path(), auth.RequireLogin(t.Suggest))
+}
+
+// Suggest answers autocomplete queries: q is what's been typed, a comma
+// separated list whose last entry is being completed. It returns
+// <option> elements for a <datalist>, each the whole list with the last
+// entry completed, or JSON tags when the request accepts
+// application/json. <bk-tag-input> sends the field's own parameter,
+// named by input, in place of q.
+func (t *Tags) Suggest(c buffalo.Context) error {
+	q := c.Param("q")
+	if input := c.Param("input"); q == "" && input != "" {
+		q = c.Param(input)
+	}
+	done, last := "", q
+	if i := strings.LastIndex(q, ","); i >= 0 {
+		done, last = q[:i+1]+" ", q[i+1:]
+	}
+
+	var found []Tag
+	if prefix := Slug(last); prefix != "" {
+		var err error
+		if found, err = t.Store.Search(c, prefix, suggestions+len(Parse(done))); err != nil {
+			return err
+		}
+	}
+	// Don't suggest what's already in the list
+	have := make(map[string]bool)
+	for _, name := range Parse(done) {
+		have[Slug(name)] = true
+	}
+	out := make([]Tag, 0, len(found))
+	for _, tag := range found {
+		if !have[tag.Slug] && len(out) < suggestions {
+			out = append(out, tag)
+		}
+	}
+
+	if strings.Contains(c.Request().Header.Get("Accept"), "application/json") {
+		c.Response().Header().Set("Content-Type", "application/json")
+		c.Response().WriteHeader(http.StatusOK)
+		return json.NewEncoder(c.Response()).Encode(out)
+	}
+	var b strings.Builder
+	for _, tag := range out {
+		fmt.Fprintf(&b, `<option value="%s">`, html.EscapeString(strings.TrimLeft(done, " ")+tag.Name))
+	}
+	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err := c.Response().Write([]byte(b.String()))
+	return err
+}
+
+func (t *Tags) path() string {
+	if t.Path != "" {
+		return strings.TrimSuffix(t.Path, "/")
+	}
+	return "/tags"
+}
+
+// Parse splits a comma separated list of tags, as typed into a
+// <bk-tag-input>, into names. Spaces are tidied, blank entries dropped,
+// and repeats kept once.
+func Parse(s string) []string {
+	return clean(strings.Split(s, ","))
+}
+
+// Names returns the names of list.
+func Names(list []Tag) []string {
+	names := make([]string, len(list))
+	for i, tag := range list {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// Join returns the names of list as a comma separated list, as a
+// <bk-tag-input> shows them.
+func Join(list []Tag) string {
+	return strings.Join(Names(list), ", ")
+}
+
+// Slug returns the form of name tags are matched by: lower case, with
+// runs of anything but letters and digits turned into a hyphen.
+func Slug(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(normalize(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
+
+// normalize tidies a tag name's spaces and cuts it to MaxLength.
+func normalize(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if utf8.RuneCountInString(name) > MaxLength {
+		name = strings.TrimSpace(string([]rune(name)[:MaxLength]))
+	}
+	return name
+}
+
+// clean normalizes names and drops blank and repeated ones.
+func clean(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var out []string
+	for _, name := range names {
+		name = normalize(name)
+		slug := Slug(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		out = append(out, name)
+	}
+	return out
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("tags: id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
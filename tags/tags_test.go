@@ -0,0 +1,179 @@
+package tags_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/buffkittest"
+	"github.com/johnjansen/buffkit/tags"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type post struct{ id string }
+
+func (p post) TaggableType() string { return "posts" }
+func (p post) TaggableID() string   { return p.id }
+
+func editPage(c buffalo.Context) error {
+	c.Response().Header().Set("Content-Type", "text/html")
+	_, err := c.Response().Write([]byte(`<html><body><form><bk-tag-input name="topics" target="posts:1" label="Topics"></bk-tag-input></form></body></html>`))
+	return err
+}
+
+func newApp(t *testing.T) *buffkittest.App {
+	t.Helper()
+	app := buffkittest.NewApp(t, buffkittest.Options{
+		Config: buffkit.Config{Tags: true},
+		Setup: func(a *buffalo.App) {
+			a.GET("/posts/1/edit", editPage)
+		},
+	})
+	require.NotNil(t, app.Kit.Tags)
+	return app
+}
+
+func TestTagging(t *testing.T) {
+	app := newApp(t)
+	ctx := context.Background()
+	kit := app.Kit.Tags
+
+	require.NoError(t, kit.Set(ctx, post{"1"}, tags.Parse("Go, web ,go,  Open   Source, ")))
+	list, err := kit.For(ctx, post{"1"})
+	require.NoError(t, err)
+	assert.Equal(t, "Go, Open Source, web", tags.Join(list))
+	assert.Equal(t, "open-source", list[1].Slug)
+
+	require.NoError(t, kit.Add(ctx, post{"1"}, "HTMX", "WEB"))
+	require.NoError(t, kit.Remove(ctx, post{"1"}, "open source"))
+	list, err = kit.For(ctx, post{"1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Go", "HTMX", "web"}, tags.Names(list))
+
+	require.NoError(t, kit.Set(ctx, post{"2"}, []string{"go"}))
+	ids, err := kit.Tagged(ctx, "posts", "GO")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+	ids, err = kit.Tagged(ctx, "products", "go")
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	require.NoError(t, kit.Set(ctx, post{"2"}, nil))
+	list, err = kit.For(ctx, post{"2"})
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestSuggest(t *testing.T) {
+	app := newApp(t)
+	ctx := context.Background()
+	kit := app.Kit.Tags
+	require.NoError(t, kit.Set(ctx, post{"1"}, []string{"Go", "Gophers", "web"}))
+	require.NoError(t, kit.Set(ctx, post{"2"}, []string{"Gophers"}))
+
+	// Visitors must log in
+	buffkittest.AssertRedirect(t, app.Client().Get("/tags?q=go"), "/login")
+
+	client := buffkittest.LoginAs(t, app, &auth.User{Email: "ada@example.com"})
+	res := client.Get("/tags?q=go")
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	assert.Equal(t, `<option value="Gophers"><option value="Go">`, res.Body.String(), "most used first")
+
+	// The last entry is completed, and tags already listed are skipped
+	res = client.Get("/tags?input=topics&topics=gophers,+g")
+	assert.Equal(t, `<option value="gophers, Go">`, res.Body.String())
+	assert.Empty(t, client.Get("/tags?q=web,+").Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/tags?q=w", nil)
+	req.Header.Set("Accept", "application/json")
+	res = client.Do(req)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	var found []tags.Tag
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &found))
+	require.Len(t, found, 1)
+	assert.Equal(t, "web", found[0].Slug)
+	assert.Equal(t, 1, found[0].Count)
+}
+
+func TestTagInput(t *testing.T) {
+	app := newApp(t)
+	require.NoError(t, app.Kit.Tags.Set(context.Background(), post{"1"}, []string{"Go", "web"}))
+
+	body := app.Client().Get("/posts/1/edit").Body.String()
+	buffkittest.AssertElement(t, body, "input", "name", "topics", "value", "Go, web", "list", "bk-tags-topics")
+	buffkittest.AssertElement(t, body, "input", "hx-get", "/tags?input=topics", "hx-target", "#bk-tags-topics")
+	buffkittest.AssertElement(t, body, "datalist", "id", "bk-tags-topics")
+	buffkittest.AssertText(t, body, "Topics")
+}
+
+func TestSlug(t *testing.T) {
+	for name, slug := range map[string]string{
+		"Go":              "go",
+		"  Open  Source ": "open-source",
+		"C++":             "c",
+		"node.js":         "node-js",
+		"Café":            "café",
+		"!!!":             "",
+	} {
+		assert.Equal(t, slug, tags.Slug(name), name)
+	}
+	assert.Equal(t, []string{"Go", "web"}, tags.Parse(" Go ,, web, GO"))
+	assert.Len(t, tags.Parse(strings.Repeat("é", 80))[0], 2*tags.MaxLength, "cut to MaxLength characters")
+}
+
+func TestStores(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	schema, err := os.ReadFile("../db/migrations/tags/20261017120000_create_tags.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for name, store := range map[string]tags.Store{
+		"memory": tags.NewMemoryStore(),
+		"sql":    tags.NewSQLStore(db, "sqlite"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			created, err := store.Ensure(ctx, []string{"Go", "web"})
+			require.NoError(t, err)
+			require.Len(t, created, 2)
+			again, err := store.Ensure(ctx, []string{"GO"})
+			require.NoError(t, err)
+			assert.Equal(t, created[0].ID, again[0].ID, "matched by slug")
+			assert.Equal(t, "Go", again[0].Name)
+
+			require.NoError(t, store.Replace(ctx, "posts", "1", []string{created[0].ID, created[1].ID}))
+			require.NoError(t, store.Replace(ctx, "posts", "2", []string{created[1].ID}))
+			list, err := store.Tags(ctx, "posts", "1")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"Go", "web"}, tags.Names(list))
+
+			found, err := store.Search(ctx, "", 1)
+			require.NoError(t, err)
+			require.Len(t, found, 1)
+			assert.Equal(t, "web", found[0].Slug)
+			assert.Equal(t, 2, found[0].Count)
+
+			require.NoError(t, store.Replace(ctx, "posts", "1", nil))
+			ids, err := store.Tagged(ctx, "posts", "web")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"2"}, ids)
+			found, err = store.Search(ctx, "g", 10)
+			require.NoError(t, err)
+			require.Len(t, found, 1)
+			assert.Zero(t, found[0].Count)
+		})
+	}
+}
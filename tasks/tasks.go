@@ -0,0 +1,255 @@
+// Package tasks parses the arguments of Buffkit's grift tasks. Every task
+// accepts --help, which prints usage generated from the task, and may
+// accept the flags the tasks share (--env, --steps, --queue, --dry-run)
+// and switches of its own. Flags and positional arguments can come in
+// any order:
+//
+//	buffalo task buffkit:migrate:down --steps 2 --dry-run
+//	buffalo task jobs:enqueue report:build --queue critical
+//	buffalo task buffkit:users:create ada@example.com --role admin
+//
+// A task is registered with Add inside a grift.Namespace, and reads its
+// positional arguments from c.Args as before and its flags with
+// FromContext:
+//
+//	_ = grift.Namespace("buffkit", func() {
+//	    _ = tasks.Add(tasks.Task{
+//	        Name:  "migrate:down",
+//	        Args:  "[N]",
+//	        Desc:  "Roll back the last N migrations (default: 1)",
+//	        Flags: []tasks.Flag{tasks.Steps, tasks.DryRun},
+//	        Run: func(c *grift.Context) error {
+//	            opts := tasks.FromContext(c)
+//	            ...
+//	        },
+//	    })
+//	})
+package tasks
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/markbates/grift/grift"
+)
+
+// Flag is a flag shared by Buffkit's tasks.
+type Flag string
+
+// The shared flags.
+const (
+	Env    Flag = "env"     // --env NAME: run with GO_ENV set to NAME
+	Steps  Flag = "steps"   // --steps N: how many to apply or roll back
+	Queue  Flag = "queue"   // --queue NAME: the job queue to use
+	DryRun Flag = "dry-run" // --dry-run: report what would happen instead
+)
+
+// flagHelp is how --help shows each shared flag.
+var flagHelp = map[Flag][2]string{
+	Env:    {"--env NAME", "Run with GO_ENV set to NAME (e.g. production)"},
+	Steps:  {"--steps N", "How many to apply or roll back"},
+	Queue:  {"--queue NAME", "The job queue to use (default: default)"},
+	DryRun: {"--dry-run", "Show what would happen without changing anything"},
+}
+
+// contextKey is the grift context key Add stores a task's Options under.
+const contextKey = "buffkit_task_options"
+
+// Task is a grift task with flags.
+type Task struct {
+	// Name is the task's name within the current grift namespace.
+	Name string
+
+	// Args describes the positional arguments for --help, such as
+	// "NAME [MODULE]".
+	Args string
+
+	// Desc is the one-line description grift lists the task with.
+	Desc string
+
+	// Flags are the shared flags the task accepts.
+	Flags []Flag
+
+	// Switches are boolean flags of the task's own, by name, with their
+	// descriptions. One-letter names are written -v, longer ones --send.
+	Switches map[string]string
+
+	// Values are flags of the task's own that take a value, by name, with
+	// their descriptions. They're written --role admin or --role=admin.
+	Values map[string]string
+
+	// Run runs the task, with c.Args holding only the positional
+	// arguments.
+	Run grift.Grift
+}
+
+// Options are the flags a task was run with.
+type Options struct {
+	Env    string
+	Steps  int
+	Queue  string
+	DryRun bool
+
+	switches map[string]bool
+	values   map[string]string
+}
+
+// Switch reports whether the task's switch name was given.
+func (o Options) Switch(name string) bool {
+	return o.switches[name]
+}
+
+// Value returns the value given for the task's flag name, or "".
+func (o Options) Value(name string) string {
+	return o.values[name]
+}
+
+// Add registers t with grift. Call it inside grift.Namespace, as
+// grift.Add would be. Bad flags fail the task with its usage; --help and
+// -h print the usage instead of running it. Tasks without a Desc are
+// registered without one, as aliases are.
+func Add(t Task) error {
+	if t.Desc != "" {
+		if err := grift.Desc(t.Name, t.Desc); err != nil {
+			return err
+		}
+	}
+	return grift.Add(t.Name, func(c *grift.Context) error {
+		name := c.Name
+		if name == "" {
+			name = t.Name
+		}
+		opts, args, err := t.Parse(c.Args)
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Print(t.Help(name))
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w\n\n%s", err, t.Help(name))
+		}
+		if opts.Env != "" {
+			if err := os.Setenv("GO_ENV", opts.Env); err != nil {
+				return err
+			}
+		}
+		c.Args = args
+		c.Set(contextKey, opts)
+		return t.Run(c)
+	})
+}
+
+// FromContext returns the options the running task was given. Tasks not
+// registered with Add get the zero Options.
+func FromContext(c *grift.Context) Options {
+	opts, _ := c.Value(contextKey).(Options)
+	return opts
+}
+
+// Parse separates args into the task's options and its positional
+// arguments. Everything after "--" is positional. It returns
+// flag.ErrHelp for -h and --help.
+func (t Task) Parse(args []string) (Options, []string, error) {
+	opts := Options{switches: make(map[string]bool), values: make(map[string]string)}
+	fs := flag.NewFlagSet(t.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	for _, f := range t.Flags {
+		switch f {
+		case Env:
+			fs.StringVar(&opts.Env, string(f), "", "")
+		case Steps:
+			fs.IntVar(&opts.Steps, string(f), 0, "")
+		case Queue:
+			fs.StringVar(&opts.Queue, string(f), "", "")
+		case DryRun:
+			fs.BoolVar(&opts.DryRun, string(f), false, "")
+		}
+	}
+	switches := make(map[string]*bool, len(t.Switches))
+	for name := range t.Switches {
+		switches[name] = fs.Bool(name, false, "")
+	}
+	values := make(map[string]*string, len(t.Values))
+	for name := range t.Values {
+		values[name] = fs.String(name, "", "")
+	}
+
+	// The flag package stops at the first positional argument, so parse
+	// again after each one
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return opts, nil, err
+			}
+			return opts, nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	if opts.Steps < 0 {
+		return opts, nil, fmt.Errorf("%s: --steps must be positive", t.Name)
+	}
+	for name, set := range switches {
+		opts.switches[name] = *set
+	}
+	for name, v := range values {
+		opts.values[name] = *v
+	}
+	return opts, positional, nil
+}
+
+// Help returns the usage --help prints, for the task run as name.
+func (t Task) Help(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage: buffalo task %s", name)
+	if t.Args != "" {
+		fmt.Fprintf(&b, " %s", t.Args)
+	}
+	b.WriteString(" [flags]\n")
+	if t.Desc != "" {
+		fmt.Fprintf(&b, "\n%s\n", t.Desc)
+	}
+
+	var rows [][2]string
+	for _, f := range t.Flags {
+		rows = append(rows, flagHelp[f])
+	}
+	for name, desc := range t.Switches {
+		if len(name) == 1 {
+			rows = append(rows, [2]string{"-" + name, desc})
+		} else {
+			rows = append(rows, [2]string{"--" + name, desc})
+		}
+	}
+	for name, desc := range t.Values {
+		rows = append(rows, [2]string{"--" + name + " " + strings.ToUpper(name), desc})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return strings.TrimLeft(rows[i][0], "-") < strings.TrimLeft(rows[j][0], "-")
+	})
+	rows = append(rows, [2]string{"-h, --help", "Show this help"})
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row[0]))
+	}
+	b.WriteString("\nFlags:\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, row[0], row[1])
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package tasks
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/markbates/grift/grift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	task := Task{
+		Name:     "migrate:down",
+		Flags:    []Flag{Env, Steps, Queue, DryRun},
+		Switches: map[string]string{"v": "Verbose"},
+		Values:   map[string]string{"role": "Role"},
+	}
+
+	opts, args, err := task.Parse([]string{"first", "--steps", "2", "second", "--dry-run", "-v", "--queue=critical", "--env", "test", "--role", "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, args)
+	assert.Equal(t, 2, opts.Steps)
+	assert.True(t, opts.DryRun)
+	assert.True(t, opts.Switch("v"))
+	assert.False(t, opts.Switch("other"))
+	assert.Equal(t, "critical", opts.Queue)
+	assert.Equal(t, "test", opts.Env)
+	assert.Equal(t, "admin", opts.Value("role"))
+	assert.Empty(t, opts.Value("other"))
+
+	// Old positional use still works
+	opts, args, err = task.Parse([]string{"3"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, args)
+	assert.Zero(t, opts.Steps)
+
+	// Everything after -- is positional
+	_, args, err = task.Parse([]string{"a", "--", "--dry-run", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "--dry-run", "b"}, args)
+
+	_, _, err = task.Parse([]string{"--help"})
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+
+	_, _, err = task.Parse([]string{"--steps", "-1"})
+	assert.EqualError(t, err, "migrate:down: --steps must be positive")
+
+	_, _, err = task.Parse([]string{"--steps", "many"})
+	assert.Error(t, err)
+
+	// Flags a task doesn't take are refused
+	_, _, err = Task{Name: "routes"}.Parse([]string{"--queue", "critical"})
+	assert.ErrorContains(t, err, "flag provided but not defined: -queue")
+}
+
+func TestHelp(t *testing.T) {
+	task := Task{
+		Name:     "invite",
+		Args:     "[EMAIL]",
+		Desc:     "Create a registration invitation link",
+		Flags:    []Flag{DryRun, Env},
+		Switches: map[string]string{"send": "Email it", "v": "Verbose"},
+		Values:   map[string]string{"role": "The role to give"},
+	}
+	assert.Equal(t, `Usage: buffalo task buffkit:invite [EMAIL] [flags]
+
+Create a registration invitation link
+
+Flags:
+  --dry-run    Show what would happen without changing anything
+  --env NAME   Run with GO_ENV set to NAME (e.g. production)
+  --role ROLE  The role to give
+  --send       Email it
+  -v           Verbose
+  -h, --help   Show this help
+`, task.Help("buffkit:invite"))
+}
+
+func TestAdd(t *testing.T) {
+	t.Setenv("GO_ENV", "development")
+
+	var got Options
+	var gotArgs []string
+	require.NoError(t, grift.Namespace("taskstest", func() {
+		require.NoError(t, Add(Task{
+			Name:  "run",
+			Desc:  "A test task",
+			Flags: []Flag{Env, Steps},
+			Run: func(c *grift.Context) error {
+				got, gotArgs = FromContext(c), c.Args
+				return nil
+			},
+		}))
+	}))
+
+	c := grift.NewContext("taskstest:run")
+	c.Args = []string{"x", "--steps", "4", "--env", "test"}
+	require.NoError(t, grift.Run("taskstest:run", c))
+	assert.Equal(t, 4, got.Steps)
+	assert.Equal(t, []string{"x"}, gotArgs)
+	assert.Equal(t, "test", os.Getenv("GO_ENV"))
+
+	// Help doesn't run the task
+	got = Options{}
+	c = grift.NewContext("taskstest:run")
+	c.Args = []string{"--help"}
+	require.NoError(t, grift.Run("taskstest:run", c))
+	assert.Zero(t, got.Steps)
+
+	c = grift.NewContext("taskstest:run")
+	c.Args = []string{"--bogus"}
+	err := grift.Run("taskstest:run", c)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Usage: buffalo task taskstest:run [flags]")
+
+	assert.Equal(t, Options{}, FromContext(grift.NewContext("other")))
+}
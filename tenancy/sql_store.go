@@ -0,0 +1,51 @@
+package tenancy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// SQLStore reads tenants from the tenants table created by the
+// db/migrations/tenancy migration.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore creates a tenant store backed by database/sql.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) BySlug(ctx context.Context, slug string) (*Tenant, error) {
+	return s.find(ctx, "slug", slug)
+}
+
+func (s *SQLStore) ByID(ctx context.Context, id string) (*Tenant, error) {
+	return s.find(ctx, "id", id)
+}
+
+func (s *SQLStore) find(ctx context.Context, column, value string) (*Tenant, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	placeholder := "?"
+	if s.dialect == "postgres" {
+		placeholder = "$1"
+	}
+
+	query := fmt.Sprintf("SELECT id, slug, name, active FROM tenants WHERE %s = %s", column, placeholder)
+
+	var t Tenant
+	err := s.db.QueryRowContext(ctx, query, value).Scan(&t.ID, &t.Slug, &t.Name, &t.Active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tenancy: lookup by %s: %w", column, err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,183 @@
+package tenancy
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/johnjansen/buffkit/timing"
+)
+
+// TemplateSource supplies tenant-specific template overrides.
+// Template returns fs.ErrNotExist when the tenant has no override for name,
+// in which case the caller falls back to the shared template.
+type TemplateSource interface {
+	Template(ctx context.Context, t *Tenant, name string) ([]byte, error)
+}
+
+// TemplatesFS returns a filesystem that serves the current tenant's override
+// for a template when one exists, and base otherwise. Use it when building
+// the per-request renderer so each tenant gets its own look:
+//
+//	c.Set("render", render.New(render.Options{
+//	    HTMLLayout:  "application.plush.html",
+//	    TemplatesFS: tenancy.TemplatesFS(c, templates, tenancy.DirSource{Root: "tenants"}),
+//	}))
+//
+// Requests without a tenant get base unchanged.
+func TemplatesFS(ctx context.Context, base fs.FS, src TemplateSource) fs.FS {
+	t := FromContext(ctx)
+	if t == nil || src == nil {
+		return base
+	}
+	return &overlayFS{ctx: ctx, tenant: t, base: base, src: src}
+}
+
+// OverridesFS returns the current tenant's overrides alone, or nil for
+// requests without a tenant. views.Resolver uses it to put tenant
+// overrides between the app's templates and Buffkit's built-ins.
+func OverridesFS(ctx context.Context, src TemplateSource) fs.FS {
+	t := FromContext(ctx)
+	if t == nil || src == nil {
+		return nil
+	}
+	return &overlayFS{ctx: ctx, tenant: t, base: emptyFS{}, src: src}
+}
+
+// emptyFS has no files.
+type emptyFS struct{}
+
+func (emptyFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// overlayFS checks the tenant's TemplateSource before the base filesystem.
+// Directory listings come from base, so overrides can shadow existing
+// templates but not add new ones.
+type overlayFS struct {
+	ctx    context.Context
+	tenant *Tenant
+	base   fs.FS
+	src    TemplateSource
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	body, err := o.src.Template(o.ctx, o.tenant, name)
+	switch {
+	case err == nil:
+		return &memFile{name: path.Base(name), Reader: bytes.NewReader(body), size: int64(len(body))}, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return o.base.Open(name)
+	default:
+		return nil, err
+	}
+}
+
+// DirSource reads overrides from disk, laid out as Root/<tenant slug>/<template>.
+// For example the override for "auth/login.plush.html" for tenant "acme"
+// lives at tenants/acme/auth/login.plush.html when Root is "tenants".
+type DirSource struct {
+	Root string
+}
+
+func (d DirSource) Template(ctx context.Context, t *Tenant, name string) ([]byte, error) {
+	if !fs.ValidPath(name) || !fs.ValidPath(t.Slug) {
+		return nil, fs.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(d.Root, t.Slug, filepath.FromSlash(name)))
+}
+
+// MemorySource keeps overrides in memory, keyed by tenant ID.
+// Handy for tests and for caching overrides loaded from elsewhere.
+type MemorySource struct {
+	mu        sync.RWMutex
+	templates map[string]map[string][]byte
+}
+
+// NewMemorySource creates an empty in-memory override source.
+func NewMemorySource() *MemorySource {
+	return &MemorySource{templates: make(map[string]map[string][]byte)}
+}
+
+// Set stores an override for a tenant.
+func (m *MemorySource) Set(tenantID, name string, body []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.templates[tenantID] == nil {
+		m.templates[tenantID] = make(map[string][]byte)
+	}
+	m.templates[tenantID][name] = body
+}
+
+func (m *MemorySource) Template(ctx context.Context, t *Tenant, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if body, ok := m.templates[t.ID][name]; ok {
+		return body, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+// SQLSource reads overrides from the tenant_templates table, so tenants can
+// edit their templates from an admin screen without a deploy.
+type SQLSource struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLSource creates an override source backed by database/sql.
+func NewSQLSource(db *sql.DB, dialect string) *SQLSource {
+	return &SQLSource{db: db, dialect: dialect}
+}
+
+func (s *SQLSource) Template(ctx context.Context, t *Tenant, name string) ([]byte, error) {
+	defer timing.Start(ctx, timing.DB)()
+
+	query := "SELECT body FROM tenant_templates WHERE tenant_id = ? AND name = ?"
+	if s.dialect == "postgres" {
+		query = "SELECT body FROM tenant_templates WHERE tenant_id = $1 AND name = $2"
+	}
+
+	var body []byte
+	err := s.db.QueryRowContext(ctx, query, t.ID, name).Scan(&body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tenancy: load template %s: %w", name, err)
+	}
+	return body, nil
+}
+
+// memFile is a read-only fs.File over an override's bytes.
+type memFile struct {
+	*bytes.Reader
+	name string
+	size int64
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *memFile) Close() error               { return nil }
+
+// fs.FileInfo implementation
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return f.size }
+func (f *memFile) Mode() fs.FileMode  { return 0444 }
+func (f *memFile) ModTime() time.Time { return time.Time{} }
+func (f *memFile) IsDir() bool        { return false }
+func (f *memFile) Sys() interface{}   { return nil }
@@ -0,0 +1,64 @@
+package tenancy
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplatesFS(t *testing.T) {
+	base := fstest.MapFS{
+		"auth/login.plush.html": {Data: []byte("shared login")},
+		"home.plush.html":       {Data: []byte("shared home")},
+	}
+
+	src := NewMemorySource()
+	src.Set("acme", "auth/login.plush.html", []byte("acme login"))
+
+	t.Run("tenant override wins", func(t *testing.T) {
+		ctx := WithTenant(context.Background(), &Tenant{ID: "acme", Slug: "acme"})
+		fsys := TemplatesFS(ctx, base, src)
+
+		body, err := fs.ReadFile(fsys, "auth/login.plush.html")
+		require.NoError(t, err)
+		assert.Equal(t, "acme login", string(body))
+
+		body, err = fs.ReadFile(fsys, "home.plush.html")
+		require.NoError(t, err)
+		assert.Equal(t, "shared home", string(body))
+	})
+
+	t.Run("other tenants fall back", func(t *testing.T) {
+		ctx := WithTenant(context.Background(), &Tenant{ID: "globex", Slug: "globex"})
+		body, err := fs.ReadFile(TemplatesFS(ctx, base, src), "auth/login.plush.html")
+		require.NoError(t, err)
+		assert.Equal(t, "shared login", string(body))
+	})
+
+	t.Run("no tenant returns base", func(t *testing.T) {
+		fsys := TemplatesFS(context.Background(), base, src)
+		assert.Equal(t, fs.FS(base), fsys)
+	})
+}
+
+func TestOverridesFS(t *testing.T) {
+	src := NewMemorySource()
+	src.Set("acme", "auth/login.plush.html", []byte("acme login"))
+
+	assert.Nil(t, OverridesFS(context.Background(), src), "no tenant")
+
+	ctx := WithTenant(context.Background(), &Tenant{ID: "acme", Slug: "acme"})
+	assert.Nil(t, OverridesFS(ctx, nil), "no source")
+
+	fsys := OverridesFS(ctx, src)
+	body, err := fs.ReadFile(fsys, "auth/login.plush.html")
+	require.NoError(t, err)
+	assert.Equal(t, "acme login", string(body))
+
+	_, err = fs.ReadFile(fsys, "home.plush.html")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
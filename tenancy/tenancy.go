@@ -0,0 +1,403 @@
+// Package tenancy provides per-tenant scoping for SaaS applications built on Buffkit.
+// A tenant is resolved once per request (from the subdomain, a header, or the
+// URL path), looked up in a Store, and placed in the request context. Everything
+// downstream - database queries, SSE channels, cache keys - can then be scoped
+// to that tenant without passing it around explicitly.
+//
+// Example wiring:
+//
+//	kit, err := buffkit.Wire(app, buffkit.Config{
+//	    AuthSecret: secret,
+//	    Tenancy: &tenancy.Options{
+//	        Store:     tenancy.NewSQLStore(db, "postgres"),
+//	        Resolvers: []tenancy.Resolver{tenancy.FromSubdomain("example.com")},
+//	        Required:  true,
+//	    },
+//	})
+//
+// Handlers then read the tenant with tenancy.Current(c).
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/auth"
+)
+
+// ContextKey is the key the middleware uses to store the resolved tenant
+// in the Buffalo context. Templates can read it as <%= tenant.Name %>.
+const ContextKey = "tenant"
+
+// Tenant is the record for a single customer account in a multi-tenant app.
+type Tenant struct {
+	ID     string `json:"id" db:"id"`
+	Slug   string `json:"slug" db:"slug"`
+	Name   string `json:"name" db:"name"`
+	Active bool   `json:"active" db:"active"`
+}
+
+var (
+	// ErrTenantNotFound is returned by stores when no tenant matches.
+	ErrTenantNotFound = auth.NotFoundError("tenant not found")
+
+	// ErrNoTenant is returned by scoping helpers when the context has no tenant.
+	ErrNoTenant = errors.New("no tenant in context")
+)
+
+// Store looks up tenants by the key a Resolver extracted from the request.
+type Store interface {
+	BySlug(ctx context.Context, slug string) (*Tenant, error)
+	ByID(ctx context.Context, id string) (*Tenant, error)
+}
+
+// Resolver extracts a tenant slug from a request.
+// It returns "" when the request doesn't identify a tenant this way.
+type Resolver func(r *http.Request) string
+
+// FromSubdomain resolves the tenant from the leftmost label of the host,
+// e.g. "acme.example.com" -> "acme" with baseDomain "example.com".
+// Requests to the bare domain or "www" don't resolve a tenant.
+func FromSubdomain(baseDomain string) Resolver {
+	suffix := "." + strings.TrimPrefix(strings.ToLower(baseDomain), ".")
+	return func(r *http.Request) string {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.HasSuffix(host, suffix) {
+			return ""
+		}
+		sub := strings.TrimSuffix(host, suffix)
+		if sub == "" || sub == "www" || strings.Contains(sub, ".") {
+			return ""
+		}
+		return sub
+	}
+}
+
+// FromHeader resolves the tenant from a request header such as "X-Tenant".
+// Useful behind gateways that already know which tenant a request is for.
+func FromHeader(name string) Resolver {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(name))
+	}
+}
+
+// FromPath resolves the tenant from the first path segment after prefix,
+// e.g. FromPath("/t/") resolves "acme" from "/t/acme/dashboard".
+func FromPath(prefix string) Resolver {
+	return func(r *http.Request) string {
+		path := r.URL.Path
+		if !strings.HasPrefix(path, prefix) {
+			return ""
+		}
+		rest := strings.TrimPrefix(path, prefix)
+		if i := strings.Index(rest, "/"); i != -1 {
+			rest = rest[:i]
+		}
+		return rest
+	}
+}
+
+// Options configures tenant resolution.
+type Options struct {
+	// Store looks up tenants. Required.
+	Store Store
+
+	// Resolvers are tried in order; the first non-empty slug wins.
+	Resolvers []Resolver
+
+	// Required rejects requests that don't resolve to an active tenant
+	// with 404. When false, such requests continue without a tenant.
+	Required bool
+
+	// Templates supplies tenants' overrides of Buffkit's pages, checked
+	// after the app's templates and before the built-ins. Nil means
+	// tenants get the same pages.
+	Templates TemplateSource
+}
+
+// Middleware resolves the tenant for each request and stores it in context.
+// Unknown or inactive tenants are treated like requests without a tenant.
+func Middleware(opts Options) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			tenant, err := Resolve(c.Request(), opts)
+			if err != nil && !errors.Is(err, ErrTenantNotFound) {
+				return c.Error(http.StatusInternalServerError, err)
+			}
+
+			if tenant == nil {
+				if opts.Required {
+					return c.Error(http.StatusNotFound, ErrTenantNotFound)
+				}
+				return next(c)
+			}
+
+			c.Set(ContextKey, tenant)
+			return next(c)
+		}
+	}
+}
+
+// Resolve runs the configured resolvers against the request and looks the
+// slug up in the store. It returns ErrTenantNotFound if nothing matches.
+func Resolve(r *http.Request, opts Options) (*Tenant, error) {
+	if opts.Store == nil {
+		return nil, ErrTenantNotFound
+	}
+
+	for _, resolve := range opts.Resolvers {
+		slug := resolve(r)
+		if slug == "" {
+			continue
+		}
+
+		tenant, err := opts.Store.BySlug(r.Context(), slug)
+		if err != nil {
+			return nil, err
+		}
+		if !tenant.Active {
+			return nil, ErrTenantNotFound
+		}
+		return tenant, nil
+	}
+
+	return nil, ErrTenantNotFound
+}
+
+// tenantKey is the context key used by WithTenant for plain contexts.
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant. Use this in
+// background jobs and other code that runs outside a request.
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// FromContext returns the tenant stored in ctx, or nil.
+// It understands both WithTenant contexts and Buffalo request contexts.
+func FromContext(ctx context.Context) *Tenant {
+	if ctx == nil {
+		return nil
+	}
+	if t, ok := ctx.Value(tenantKey{}).(*Tenant); ok {
+		return t
+	}
+	if t, ok := ctx.Value(ContextKey).(*Tenant); ok {
+		return t
+	}
+	return nil
+}
+
+// Current returns the tenant for the current request, or nil.
+func Current(c buffalo.Context) *Tenant {
+	return FromContext(c)
+}
+
+// Filter returns the tenant condition for callers that write it into
+// their own query, and the argument that goes with it. n is how many
+// arguments come before it, for numbering Postgres placeholders:
+//
+//	cond, tenantID, err := tenancy.Filter(ctx, "postgres", 1)
+//	q := "SELECT * FROM projects WHERE archived = $1 AND " + cond + " ORDER BY created_at"
+//	rows, err := db.QueryContext(ctx, q, false, tenantID)
+//
+// The tenant column is always "tenant_id".
+func Filter(ctx context.Context, dialect string, n int) (string, interface{}, error) {
+	t := FromContext(ctx)
+	if t == nil {
+		return "", nil, ErrNoTenant
+	}
+	placeholder := "?"
+	if dialect == "postgres" {
+		placeholder = fmt.Sprintf("$%d", n+1)
+	}
+	return "tenant_id = " + placeholder, t.ID, nil
+}
+
+// Scope adds the tenant filter to a single SELECT, UPDATE or DELETE so it
+// only touches the current tenant's rows. An existing WHERE condition is
+// parenthesized, so an OR in it can't reach other tenants' rows, and
+// ORDER BY, LIMIT and the like stay after it:
+//
+//	q, args, err := tenancy.Scope(ctx, "postgres", "SELECT * FROM projects WHERE archived = $1 ORDER BY created_at", false)
+//	// SELECT * FROM projects WHERE (archived = $1) AND tenant_id = $2 ORDER BY created_at
+//
+// Only the outermost WHERE is scoped, not those in subqueries. Writing
+// the condition with Filter is clearer for anything more involved.
+func Scope(ctx context.Context, dialect, query string, args ...interface{}) (string, []interface{}, error) {
+	cond, tenantID, err := Filter(ctx, dialect, len(args))
+	if err != nil {
+		return "", nil, err
+	}
+
+	where, end, marks := clauses(query)
+	var scoped string
+	if where >= 0 {
+		predicate := strings.TrimSpace(query[where+len("WHERE") : end])
+		scoped = query[:where] + "WHERE (" + predicate + ") AND " + cond
+	} else {
+		scoped = strings.TrimRight(query[:end], " \t\r\n") + " WHERE " + cond
+	}
+	if rest := strings.TrimSpace(query[end:]); rest != "" {
+		scoped += " " + rest
+	}
+
+	scopedArgs := make([]interface{}, 0, len(args)+1)
+	if dialect == "postgres" || marks > len(args) {
+		// Numbered placeholders don't depend on order, and a count that
+		// can't be right leaves the argument last
+		marks = len(args)
+	}
+	scopedArgs = append(scopedArgs, args[:marks]...)
+	scopedArgs = append(scopedArgs, tenantID)
+	scopedArgs = append(scopedArgs, args[marks:]...)
+	return scoped, scopedArgs, nil
+}
+
+// trailingClauses are the keywords that can follow a statement's WHERE
+// condition.
+var trailingClauses = map[string]bool{
+	"GROUP": true, "HAVING": true, "WINDOW": true, "ORDER": true, "LIMIT": true,
+	"OFFSET": true, "FETCH": true, "FOR": true, "UNION": true, "INTERSECT": true,
+	"EXCEPT": true, "RETURNING": true,
+}
+
+// clauses finds where the outermost WHERE of query starts (-1 without
+// one) and where the clauses after its condition start (len(query)
+// without any), skipping strings, comments and parentheses. marks is
+// how many ? placeholders come before that end.
+func clauses(query string) (where, end, marks int) {
+	where = -1
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		switch ch := query[i]; {
+		case ch == '\'' || ch == '"' || ch == '`':
+			j := strings.IndexByte(query[i+1:], ch)
+			if j < 0 {
+				return where, len(query), marks
+			}
+			i += j + 1
+		case strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				return where, len(query), marks
+			}
+			i += j
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == '?':
+			marks++
+		case depth == 0 && isLetter(ch) && (i == 0 || !isWordChar(query[i-1])):
+			j := i
+			for j < len(query) && isWordChar(query[j]) {
+				j++
+			}
+			switch word := strings.ToUpper(query[i:j]); {
+			case word == "WHERE" && where < 0:
+				where = i
+			case trailingClauses[word]:
+				return where, i, marks
+			}
+			i = j - 1
+		}
+	}
+	return where, len(query), marks
+}
+
+func isLetter(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func isWordChar(ch byte) bool {
+	return isLetter(ch) || ch >= '0' && ch <= '9' || ch == '_' || ch == '$'
+}
+
+// Channel returns the SSE channel name for a tenant. Events broadcast on
+// this channel are only delivered to clients connected under that tenant.
+func Channel(t *Tenant) string {
+	if t == nil {
+		return ""
+	}
+	return "tenant:" + t.ID
+}
+
+// SSEChannel resolves the SSE channel for a connecting client.
+// Wire installs it on the broker when tenancy is configured.
+func SSEChannel(c buffalo.Context) string {
+	return Channel(Current(c))
+}
+
+// CacheKey builds a cache key namespaced by the context's tenant, so two
+// tenants never read each other's cached values:
+//
+//	key := tenancy.CacheKey(ctx, "dashboard", userID) // "tenant:42:dashboard:7"
+//
+// Without a tenant the key is namespaced as "global".
+func CacheKey(ctx context.Context, parts ...string) string {
+	prefix := "global"
+	if t := FromContext(ctx); t != nil {
+		prefix = "tenant:" + t.ID
+	}
+	return prefix + ":" + strings.Join(parts, ":")
+}
+
+// MemoryStore keeps tenants in memory. Useful for tests and small apps
+// with a fixed set of tenants.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	tenants map[string]*Tenant // keyed by slug
+}
+
+// NewMemoryStore creates an empty in-memory tenant store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tenants: make(map[string]*Tenant),
+	}
+}
+
+// Add registers a tenant. An existing tenant with the same slug is replaced.
+func (m *MemoryStore) Add(t *Tenant) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.ID == "" {
+		t.ID = t.Slug
+	}
+	m.tenants[t.Slug] = t
+}
+
+func (m *MemoryStore) BySlug(ctx context.Context, slug string) (*Tenant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if t, ok := m.tenants[slug]; ok {
+		return t, nil
+	}
+	return nil, ErrTenantNotFound
+}
+
+func (m *MemoryStore) ByID(ctx context.Context, id string) (*Tenant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, t := range m.tenants {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return nil, ErrTenantNotFound
+}
@@ -0,0 +1,112 @@
+package tenancy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvers(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://acme.example.com:3000/t/globex/dashboard", nil)
+	req.Header.Set("X-Tenant", "initech")
+
+	assert.Equal(t, "acme", FromSubdomain("example.com")(req))
+	assert.Equal(t, "initech", FromHeader("X-Tenant")(req))
+	assert.Equal(t, "globex", FromPath("/t/")(req))
+
+	bare := httptest.NewRequest("GET", "http://www.example.com/", nil)
+	assert.Equal(t, "", FromSubdomain("example.com")(bare))
+}
+
+func TestScope(t *testing.T) {
+	ctx := WithTenant(context.Background(), &Tenant{ID: "t1"})
+
+	q, args, err := Scope(ctx, "postgres", "SELECT * FROM projects WHERE archived = $1", false)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM projects WHERE (archived = $1) AND tenant_id = $2", q)
+	assert.Equal(t, []interface{}{false, "t1"}, args)
+
+	q, args, err = Scope(ctx, "sqlite", "SELECT * FROM projects")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM projects WHERE tenant_id = ?", q)
+	assert.Equal(t, []interface{}{"t1"}, args)
+
+	q, args, err = Scope(ctx, "postgres", "SELECT * FROM projects WHERE owner_id = $1 OR public = $2", 7, true)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM projects WHERE (owner_id = $1 OR public = $2) AND tenant_id = $3", q, "OR can't escape the tenant")
+	assert.Equal(t, []interface{}{7, true, "t1"}, args)
+
+	q, args, err = Scope(ctx, "sqlite", "SELECT * FROM projects WHERE name = 'where or limit' OR owner_id = ? ORDER BY name LIMIT ?", 7, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM projects WHERE (name = 'where or limit' OR owner_id = ?) AND tenant_id = ? ORDER BY name LIMIT ?", q)
+	assert.Equal(t, []interface{}{7, "t1", 10}, args, "the tenant goes before the LIMIT argument")
+
+	q, args, err = Scope(ctx, "sqlite", "SELECT * FROM projects ORDER BY name LIMIT ?", 10)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM projects WHERE tenant_id = ? ORDER BY name LIMIT ?", q)
+	assert.Equal(t, []interface{}{"t1", 10}, args)
+
+	q, _, err = Scope(ctx, "sqlite", "SELECT * FROM projects WHERE id IN (SELECT project_id FROM stars WHERE user_id = ?) GROUP BY owner_id", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM projects WHERE (id IN (SELECT project_id FROM stars WHERE user_id = ?)) AND tenant_id = ? GROUP BY owner_id", q, "subqueries are left alone")
+
+	q, _, err = Scope(ctx, "sqlite", "SELECT * FROM (SELECT * FROM projects WHERE archived = ?) p", false)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM projects WHERE archived = ?) p WHERE tenant_id = ?", q)
+
+	cond, tenantID, err := Filter(ctx, "postgres", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant_id = $2", cond)
+	assert.Equal(t, "t1", tenantID)
+
+	_, _, err = Scope(context.Background(), "sqlite", "SELECT 1")
+	assert.ErrorIs(t, err, ErrNoTenant)
+}
+
+func TestCacheKey(t *testing.T) {
+	ctx := WithTenant(context.Background(), &Tenant{ID: "42"})
+	assert.Equal(t, "tenant:42:dashboard:7", CacheKey(ctx, "dashboard", "7"))
+	assert.Equal(t, "global:dashboard", CacheKey(context.Background(), "dashboard"))
+}
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore()
+	store.Add(&Tenant{ID: "1", Slug: "acme", Name: "Acme", Active: true})
+	store.Add(&Tenant{ID: "2", Slug: "closed", Name: "Closed", Active: false})
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(Middleware(Options{
+		Store:     store,
+		Resolvers: []Resolver{FromHeader("X-Tenant")},
+		Required:  true,
+	}))
+	app.GET("/whoami", func(c buffalo.Context) error {
+		_, err := c.Response().Write([]byte(Current(c).Name))
+		return err
+	})
+
+	tests := []struct {
+		tenant string
+		status int
+	}{
+		{"acme", http.StatusOK},
+		{"closed", http.StatusNotFound},
+		{"missing", http.StatusNotFound},
+		{"", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/whoami", nil)
+		req.Header.Set("X-Tenant", tt.tenant)
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, req)
+		assert.Equal(t, tt.status, res.Code, "tenant %q", tt.tenant)
+		if tt.status == http.StatusOK {
+			assert.Equal(t, "Acme", res.Body.String())
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package timing measures where a request spends its time in Buffkit —
+// the database, rendering, components and auth — and reports it in a
+// Server-Timing header, which browser devtools show with each request
+// (Network, then Timing, in Chrome and Firefox).
+//
+// Middleware (installed by Wire in DevMode, or with Config.ServerTiming)
+// gives each request its Timings. Code that does some of a request's work
+// times it with Start:
+//
+//	defer timing.Start(ctx, timing.DB)()
+//
+// Without the middleware, Start does nothing, so instrumented code costs
+// next to nothing when timing is off.
+//
+// A metric is the total of everything timed under its name, and work
+// can be timed under more than one: an auth lookup that queries the
+// database counts towards both auth and db. Components rendered in
+// parallel each add their own time, so a metric can exceed the request's.
+package timing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// ContextKey is the key Middleware stores the request's Timings under in
+// the Buffalo context.
+const ContextKey = "server_timing"
+
+// The metrics Buffkit records.
+const (
+	DB         = "db"
+	Render     = "render"
+	Components = "components"
+	Auth       = "auth"
+)
+
+// descriptions are what devtools show for Buffkit's metrics.
+var descriptions = map[string]string{
+	DB:         "Database",
+	Render:     "Templates",
+	Components: "Components",
+	Auth:       "Auth",
+}
+
+// Timings holds the time one request has spent under each metric.
+type Timings struct {
+	mu      sync.Mutex
+	names   []string // in the order they were first recorded
+	metrics map[string]*metric
+}
+
+// metric is the time recorded under one name.
+type metric struct {
+	dur   time.Duration
+	count int
+}
+
+// New creates empty Timings.
+func New() *Timings {
+	return &Timings{metrics: make(map[string]*metric)}
+}
+
+// Add records d under name. It's safe to call from several goroutines,
+// and does nothing on nil Timings.
+func (t *Timings) Add(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m, ok := t.metrics[name]
+	if !ok {
+		m = &metric{}
+		t.metrics[name] = m
+		t.names = append(t.names, name)
+	}
+	m.dur += d
+	m.count++
+}
+
+// Duration returns the total time recorded under name.
+func (t *Timings) Duration(name string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m, ok := t.metrics[name]; ok {
+		return m.dur
+	}
+	return 0
+}
+
+// Header returns the Server-Timing header value for what's been recorded
+// so far, e.g. `db;dur=3.25;desc="Database (2)", render;dur=1.50;desc="Templates"`.
+// Durations are in milliseconds; the description counts the timings
+// added up when there's more than one.
+func (t *Timings) Header() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := make([]string, 0, len(t.names))
+	for _, name := range t.names {
+		m := t.metrics[name]
+		entry := fmt.Sprintf("%s;dur=%.2f", name, float64(m.dur)/float64(time.Millisecond))
+		desc := descriptions[name]
+		if m.count > 1 {
+			desc = strings.TrimSpace(fmt.Sprintf("%s (%d)", desc, m.count))
+		}
+		if desc != "" {
+			entry += fmt.Sprintf(";desc=%q", desc)
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, ", ")
+}
+
+// timingsKey is the context.Context key for Timings outside Buffalo.
+type timingsKey struct{}
+
+// WithTimings returns a copy of ctx that records into t, for work done
+// outside a Buffalo request, such as in tests.
+func WithTimings(ctx context.Context, t *Timings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// FromContext returns the Timings ctx records into, or nil if timing is
+// off for it.
+func FromContext(ctx context.Context) *Timings {
+	if ctx == nil {
+		return nil
+	}
+	if t, ok := ctx.Value(timingsKey{}).(*Timings); ok {
+		return t
+	}
+	if t, ok := ctx.Value(ContextKey).(*Timings); ok {
+		return t
+	}
+	return nil
+}
+
+// Start starts timing name for the request ctx belongs to, and returns
+// the func that stops it.
+func Start(ctx context.Context, name string) func() {
+	t := FromContext(ctx)
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { t.Add(name, time.Since(start)) }
+}
+
+// Middleware gives each request Timings, times what the handler renders
+// with c.Render, and sends the Server-Timing header with the response.
+// The header goes out when the response starts, so install Middleware
+// before middleware that buffers the response (the components expander
+// does) to include what that middleware does with it.
+func Middleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		t := New()
+		c.Set(ContextKey, t)
+
+		if res, ok := c.Response().(*buffalo.Response); ok {
+			w := &responseWriter{ResponseWriter: res.ResponseWriter, timings: t}
+			res.ResponseWriter = w
+			defer func() { res.ResponseWriter = w.ResponseWriter }()
+		}
+		return next(&renderContext{Context: c})
+	}
+}
+
+// responseWriter sets the Server-Timing header just before the response
+// starts.
+type responseWriter struct {
+	http.ResponseWriter
+	timings *Timings
+	started bool
+}
+
+func (w *responseWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	if h := w.timings.Header(); h != "" {
+		w.Header().Set("Server-Timing", h)
+	}
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	w.start()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.start()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	w.start()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// renderContext times what handlers render. Buffalo renders into a
+// buffer before writing the response, so the time is recorded before
+// the header goes out.
+type renderContext struct {
+	buffalo.Context
+}
+
+func (c *renderContext) Render(status int, r render.Renderer) error {
+	if r != nil {
+		r = renderer{Renderer: r, ctx: c.Context}
+	}
+	return c.Context.Render(status, r)
+}
+
+// renderer is a render.Renderer timed under Render.
+type renderer struct {
+	render.Renderer
+	ctx context.Context
+}
+
+func (r renderer) Render(w io.Writer, data render.Data) error {
+	defer Start(r.ctx, Render)()
+	return r.Renderer.Render(w, data)
+}
@@ -0,0 +1,78 @@
+package timing_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/timing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeader(t *testing.T) {
+	timings := timing.New()
+	assert.Equal(t, "", timings.Header())
+
+	timings.Add(timing.DB, 1500*time.Microsecond)
+	timings.Add(timing.Render, 2*time.Millisecond)
+	timings.Add(timing.DB, 1750*time.Microsecond)
+	timings.Add("cache", 250*time.Microsecond)
+	timings.Add("cache", 250*time.Microsecond)
+	assert.Equal(t, `db;dur=3.25;desc="Database (2)", render;dur=2.00;desc="Templates", cache;dur=0.50;desc="(2)"`, timings.Header())
+	assert.Equal(t, 3250*time.Microsecond, timings.Duration(timing.DB))
+	assert.Zero(t, timings.Duration(timing.Auth))
+
+	// Nil Timings, as FromContext returns when timing is off, are usable
+	var off *timing.Timings
+	off.Add(timing.DB, time.Second)
+	assert.Equal(t, "", off.Header())
+}
+
+func TestStart(t *testing.T) {
+	// Timing is off without Timings in the context
+	timing.Start(context.Background(), timing.DB)()
+
+	timings := timing.New()
+	ctx := timing.WithTimings(context.Background(), timings)
+	require.Same(t, timings, timing.FromContext(ctx))
+
+	stop := timing.Start(ctx, timing.Auth)
+	time.Sleep(time.Millisecond)
+	stop()
+	assert.GreaterOrEqual(t, timings.Duration(timing.Auth), time.Millisecond)
+}
+
+func TestMiddleware(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(timing.Middleware)
+	app.GET("/", func(c buffalo.Context) error {
+		timing.Start(c, timing.DB)()
+		return c.Render(http.StatusOK, render.Func("text/html; charset=utf-8", func(w io.Writer, _ render.Data) error {
+			_, err := io.WriteString(w, "<p>hello</p>")
+			return err
+		}))
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<p>hello</p>", rec.Body.String())
+	assert.Regexp(t, regexp.MustCompile(`^db;dur=\d+\.\d\d;desc="Database", render;dur=\d+\.\d\d;desc="Templates"$`), rec.Header().Get("Server-Timing"))
+
+	// Without the middleware there's no header
+	plain := buffalo.New(buffalo.Options{Env: "test"})
+	plain.GET("/", func(c buffalo.Context) error {
+		timing.Start(c, timing.DB)()
+		return c.Render(http.StatusOK, nil)
+	})
+	rec = httptest.NewRecorder()
+	plain.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Empty(t, rec.Header().Get("Server-Timing"))
+}
@@ -0,0 +1,87 @@
+package buffkit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// TxKey is the key Transactional stores the request's *sql.Tx under in
+// the Buffalo context, the same key Buffalo's pop middleware uses.
+const TxKey = "tx"
+
+// Querier is what *sql.DB and *sql.Tx have in common, for stores that
+// run in a request's transaction when there is one.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Transactional is middleware that runs each request in a transaction on
+// db, for plain database/sql what Buffalo's pop middleware is for pop:
+//
+//	app.Use(buffkit.Transactional(db))
+//
+// The transaction is committed when the handler returns without an error
+// and with a 2xx or 3xx status. It's rolled back when the handler returns
+// an error, sends any other status, or panics (the panic carries on to
+// Buffalo's recovery). Handlers and stores get it with TxFromContext, or
+// with DBFrom to fall back on db outside a transaction:
+//
+//	_, err := buffkit.DBFrom(c, db).ExecContext(c, "UPDATE ...")
+//
+// The transaction belongs to the request's context, so it's rolled back
+// if the client goes away before the handler is done.
+//
+// It covers the app's own queries only. Buffkit's stores, such as the
+// orgs, settings and tags ones, write through their *sql.DB, so their
+// writes stand whether or not the request's transaction commits.
+func Transactional(db *sql.DB) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			tx, err := db.BeginTx(c, nil)
+			if err != nil {
+				return fmt.Errorf("buffkit: begin transaction: %w", err)
+			}
+			c.Set(TxKey, tx)
+
+			committed := false
+			defer func() {
+				if !committed {
+					_ = tx.Rollback()
+				}
+			}()
+
+			if err := next(c); err != nil {
+				return err
+			}
+			// A handler that has sent nothing hasn't failed
+			if res, ok := c.Response().(*buffalo.Response); ok && res.Status != 0 && (res.Status < 200 || res.Status >= 400) {
+				return nil
+			}
+			committed = true
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("buffkit: commit transaction: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// TxFromContext returns the transaction Transactional started for the
+// request, or nil.
+func TxFromContext(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(TxKey).(*sql.Tx)
+	return tx
+}
+
+// DBFrom returns the request's transaction, or db when ctx has none.
+func DBFrom(ctx context.Context, db *sql.DB) Querier {
+	if tx := TxFromContext(ctx); tx != nil {
+		return tx
+	}
+	return db
+}
@@ -0,0 +1,69 @@
+package buffkit
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactional(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:tx?mode=memory&cache=shared")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE notes (body TEXT)`)
+	require.NoError(t, err)
+
+	insert := func(c buffalo.Context) error {
+		require.NotNil(t, TxFromContext(c))
+		_, err := DBFrom(c, db).ExecContext(c, `INSERT INTO notes (body) VALUES (?)`, c.Param("body"))
+		return err
+	}
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.Use(Transactional(db))
+	app.POST("/ok", func(c buffalo.Context) error {
+		if err := insert(c); err != nil {
+			return err
+		}
+		return c.Render(http.StatusCreated, nil)
+	})
+	app.POST("/error", func(c buffalo.Context) error {
+		_ = insert(c)
+		return errors.New("validation failed")
+	})
+	app.POST("/status", func(c buffalo.Context) error {
+		_ = insert(c)
+		return c.Render(http.StatusUnprocessableEntity, nil)
+	})
+	app.POST("/panic", func(c buffalo.Context) error {
+		_ = insert(c)
+		panic("boom")
+	})
+	app.POST("/silent", insert)
+
+	for _, path := range []string{"/ok?body=ok", "/error?body=error", "/status?body=status", "/panic?body=panic", "/silent?body=silent"} {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	var bodies []string
+	rows, err := db.Query(`SELECT body FROM notes ORDER BY rowid`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var body string
+		require.NoError(t, rows.Scan(&body))
+		bodies = append(bodies, body)
+	}
+	assert.Equal(t, []string{"ok", "silent"}, bodies, "only successful requests commit")
+
+	// Outside a transaction stores use the database directly
+	assert.Nil(t, TxFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()))
+	assert.Equal(t, Querier(db), DBFrom(httptest.NewRequest(http.MethodGet, "/", nil).Context(), db))
+}
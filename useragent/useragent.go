@@ -0,0 +1,187 @@
+// Package useragent reads the browser, operating system and kind of device
+// from a User-Agent header:
+//
+//	info := useragent.Parse(r.UserAgent())
+//	info.String() // "Chrome on macOS"
+//	info.Device   // useragent.Desktop
+//
+// It recognizes the common browsers and platforms with a few substring
+// checks, which is enough to describe a session or adapt a page. It isn't
+// a full user agent database, and user agents can say anything, so don't
+// make security decisions on it.
+package useragent
+
+import (
+	"strings"
+)
+
+// Class is the kind of device.
+type Class string
+
+// Device classes. An unrecognized user agent has none.
+const (
+	Desktop Class = "desktop"
+	Mobile  Class = "mobile"
+	Tablet  Class = "tablet"
+	Bot     Class = "bot"
+)
+
+// Info is what a User-Agent header says about the client. Fields it
+// doesn't say are empty.
+type Info struct {
+	Browser        string `json:"browser,omitempty"`         // "Chrome", "Safari", "curl"
+	BrowserVersion string `json:"browser_version,omitempty"` // "126.0"
+	OS             string `json:"os,omitempty"`              // "macOS", "iOS", "Windows"
+	OSVersion      string `json:"os_version,omitempty"`      // "10.15.7", "17.5", "10"
+	Device         Class  `json:"device,omitempty"`
+}
+
+// String names the browser and operating system, such as "Chrome on
+// macOS", or "Unknown device" when neither is recognized.
+func (i Info) String() string {
+	switch {
+	case i.Browser != "" && i.OS != "":
+		return i.Browser + " on " + i.OS
+	case i.Browser != "":
+		return i.Browser
+	case i.OS != "":
+		return "Browser on " + i.OS
+	}
+	return "Unknown device"
+}
+
+// Mobile reports whether the client is a phone.
+func (i Info) Mobile() bool { return i.Device == Mobile }
+
+// Tablet reports whether the client is a tablet.
+func (i Info) Tablet() bool { return i.Device == Tablet }
+
+// Desktop reports whether the client is a desktop or laptop.
+func (i Info) Desktop() bool { return i.Device == Desktop }
+
+// Bot reports whether the client is a crawler or a command-line tool.
+func (i Info) Bot() bool { return i.Device == Bot }
+
+// SameDevice reports whether i and o look like the same device: the same
+// browser on the same operating system and class of device. Versions are
+// ignored, so updates don't make a device new.
+func (i Info) SameDevice(o Info) bool {
+	return i.Browser == o.Browser && i.OS == o.OS && i.Device == o.Device
+}
+
+// browsers are matched in order, as most user agents name several; a
+// token with a version reads it from after the token.
+var browsers = []struct{ token, name string }{
+	{"Edg/", "Edge"}, {"EdgA/", "Edge"}, {"EdgiOS/", "Edge"}, {"Edge/", "Edge"},
+	{"OPR/", "Opera"}, {"OPiOS/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"}, {"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"}, {"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"MSIE ", "Internet Explorer"}, {"Trident/", "Internet Explorer"},
+}
+
+// tools are command-line clients and libraries, named by their first
+// product token.
+var tools = []string{"curl/", "Wget/", "python-requests/", "Go-http-client/", "okhttp/", "PostmanRuntime/"}
+
+// windowsVersions maps Windows NT versions to their marketing names.
+var windowsVersions = map[string]string{"10.0": "10", "6.3": "8.1", "6.2": "8", "6.1": "7"}
+
+// Parse reads ua, a User-Agent header.
+func Parse(ua string) Info {
+	var info Info
+	if ua == "" {
+		return info
+	}
+
+	for _, tool := range tools {
+		if strings.HasPrefix(ua, tool) {
+			info.Browser = strings.TrimSuffix(tool, "/")
+			info.BrowserVersion = version(ua[len(tool):])
+			info.Device = Bot
+			return info
+		}
+	}
+	lower := strings.ToLower(ua)
+	for _, word := range []string{"bot", "crawl", "spider", "slurp"} {
+		if strings.Contains(lower, word) {
+			info.Browser = botName(ua)
+			info.Device = Bot
+			return info
+		}
+	}
+
+	for _, b := range browsers {
+		if i := strings.Index(ua, b.token); i >= 0 {
+			info.Browser = b.name
+			info.BrowserVersion = version(ua[i+len(b.token):])
+			break
+		}
+	}
+	if info.Browser == "Safari" {
+		// Safari/ carries the WebKit build; the release is in Version/
+		info.BrowserVersion = ""
+		if i := strings.Index(ua, "Version/"); i >= 0 {
+			info.BrowserVersion = version(ua[i+len("Version/"):])
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		info.OS, info.OSVersion, info.Device = "iOS", osVersion(ua, "OS "), Mobile
+	case strings.Contains(ua, "iPad"):
+		info.OS, info.OSVersion, info.Device = "iPadOS", osVersion(ua, "OS "), Tablet
+	case strings.Contains(ua, "Android"):
+		info.OS, info.OSVersion, info.Device = "Android", osVersion(ua, "Android "), Tablet
+		if strings.Contains(ua, "Mobile") {
+			info.Device = Mobile
+		}
+	case strings.Contains(ua, "Windows Phone"):
+		info.OS, info.OSVersion, info.Device = "Windows Phone", osVersion(ua, "Windows Phone "), Mobile
+	case strings.Contains(ua, "Windows"):
+		info.OS, info.Device = "Windows", Desktop
+		nt := osVersion(ua, "Windows NT ")
+		info.OSVersion = windowsVersions[nt]
+	case strings.Contains(ua, "CrOS"):
+		info.OS, info.Device = "ChromeOS", Desktop
+	case strings.Contains(ua, "Mac OS X") || strings.Contains(ua, "Macintosh"):
+		info.OS, info.OSVersion, info.Device = "macOS", osVersion(ua, "Mac OS X "), Desktop
+	case strings.Contains(ua, "Linux"):
+		info.OS, info.Device = "Linux", Desktop
+	}
+	return info
+}
+
+// version reads a version number from the start of s.
+func version(s string) string {
+	end := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.Trim(s[:end], ".")
+}
+
+// osVersion reads the version after prefix, where underscores may
+// separate its parts ("Mac OS X 10_15_7").
+func osVersion(ua, prefix string) string {
+	i := strings.Index(ua, prefix)
+	if i < 0 {
+		return ""
+	}
+	rest := strings.ReplaceAll(ua[i+len(prefix):], "_", ".")
+	return version(rest)
+}
+
+// botName is a crawler's product name, such as "Googlebot" from
+// "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)".
+func botName(ua string) string {
+	for _, field := range strings.FieldsFunc(ua, func(r rune) bool { return r == ' ' || r == ';' || r == '(' || r == ')' }) {
+		name, _, _ := strings.Cut(field, "/")
+		lower := strings.ToLower(name)
+		if strings.Contains(lower, "bot") || strings.Contains(lower, "crawl") || strings.Contains(lower, "spider") || strings.Contains(lower, "slurp") {
+			return name
+		}
+	}
+	return "Bot"
+}
@@ -0,0 +1,60 @@
+package useragent_test
+
+import (
+	"testing"
+
+	"github.com/johnjansen/buffkit/useragent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]useragent.Info{
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.6478.127 Safari/537.36": {
+			Browser: "Chrome", BrowserVersion: "126.0.6478.127", OS: "macOS", OSVersion: "10.15.7", Device: useragent.Desktop,
+		},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1": {
+			Browser: "Safari", BrowserVersion: "17.5", OS: "iOS", OSVersion: "17.5", Device: useragent.Mobile,
+		},
+		"Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0 Mobile/15E148 Safari/604.1": {
+			Browser: "Chrome", BrowserVersion: "126.0", OS: "iPadOS", OSVersion: "17.5", Device: useragent.Tablet,
+		},
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Mobile Safari/537.36": {
+			Browser: "Chrome", BrowserVersion: "126.0", OS: "Android", OSVersion: "14", Device: useragent.Mobile,
+		},
+		"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/25.0 Chrome/121.0 Safari/537.36": {
+			Browser: "Samsung Internet", BrowserVersion: "25.0", OS: "Android", OSVersion: "13", Device: useragent.Tablet,
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:127.0) Gecko/20100101 Firefox/127.0": {
+			Browser: "Firefox", BrowserVersion: "127.0", OS: "Windows", OSVersion: "10", Device: useragent.Desktop,
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36 Edg/126.0": {
+			Browser: "Edge", BrowserVersion: "126.0", OS: "Windows", OSVersion: "10", Device: useragent.Desktop,
+		},
+		"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36": {
+			Browser: "Chrome", BrowserVersion: "126.0", OS: "ChromeOS", Device: useragent.Desktop,
+		},
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {
+			Browser: "Googlebot", Device: useragent.Bot,
+		},
+		"curl/8.4.0": {Browser: "curl", BrowserVersion: "8.4.0", Device: useragent.Bot},
+		"":           {},
+	}
+	for ua, want := range cases {
+		assert.Equal(t, want, useragent.Parse(ua), ua)
+	}
+}
+
+func TestInfoString(t *testing.T) {
+	assert.Equal(t, "Chrome on macOS", useragent.Info{Browser: "Chrome", OS: "macOS"}.String())
+	assert.Equal(t, "curl", useragent.Info{Browser: "curl"}.String())
+	assert.Equal(t, "Browser on Linux", useragent.Info{OS: "Linux"}.String())
+	assert.Equal(t, "Unknown device", useragent.Info{}.String())
+}
+
+func TestSameDevice(t *testing.T) {
+	a := useragent.Info{Browser: "Chrome", BrowserVersion: "125.0", OS: "macOS", Device: useragent.Desktop}
+	b := useragent.Info{Browser: "Chrome", BrowserVersion: "126.0", OS: "macOS", Device: useragent.Desktop}
+	assert.True(t, a.SameDevice(b))
+	b.OS = "Windows"
+	assert.False(t, a.SameDevice(b))
+}
@@ -0,0 +1,277 @@
+package buffkit
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/export"
+)
+
+// userImportColumns are the columns buffkit:users:import reads. Only
+// email is required.
+var userImportColumns = []string{"email", "name", "username", "role"}
+
+// userExportFields are the fields buffkit:users:export can write, in the
+// order it writes them by default.
+var userExportFields = []string{"id", "email", "username", "name", "role", "email_verified_at", "deactivated_at"}
+
+// userImportRow is one user read from an import file.
+type userImportRow struct {
+	Line   int
+	Fields map[string]string
+	Errors []string
+
+	// Password is the temporary password the user was created with.
+	Password string
+}
+
+// userImport is what buffkit:users:import did, or would do.
+type userImport struct {
+	Rows   []*userImportRow
+	Invite bool
+	DryRun bool
+}
+
+// Valid reports whether every row passed validation.
+func (r *userImport) Valid() bool {
+	for _, row := range r.Rows {
+		if len(row.Errors) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Report writes a line for each row, saying what happened to it or why
+// it failed validation.
+func (r *userImport) Report(w io.Writer) {
+	for _, row := range r.Rows {
+		email := row.Fields["email"]
+		switch {
+		case len(row.Errors) > 0:
+			fmt.Fprintf(w, "❌ line %d: %s\n", row.Line, strings.Join(row.Errors, "; "))
+		case r.DryRun && r.Invite:
+			fmt.Fprintf(w, "   would invite %s\n", email)
+		case r.DryRun:
+			fmt.Fprintf(w, "   would create %s\n", email)
+		case r.Invite:
+			fmt.Fprintf(w, "✉️  Invited %s\n", email)
+		default:
+			fmt.Fprintf(w, "👤 Created %s  Password: %s\n", email, row.Password)
+		}
+	}
+}
+
+// importUsers reads users from a CSV file with a header row and creates
+// each one with a random temporary password, or with invite emails them
+// an invitation to register instead. Every row is validated first, and
+// nothing is created unless they all pass; with dryRun nothing is
+// created either way.
+func importUsers(ctx context.Context, kit *Kit, r io.Reader, invite, dryRun bool) (*userImport, error) {
+	store := kit.AuthStore
+	if invite && kit.Registration == nil {
+		return nil, fmt.Errorf("registration is closed - set Config.RegistrationMode to invite users")
+	}
+	if invite && kit.Registration.BaseURL == "" {
+		return nil, fmt.Errorf("set Config.BaseURL to invite users - invitations link back to the app")
+	}
+
+	in := csv.NewReader(r)
+	in.TrimLeadingSpace = true
+	header, err := in.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(userImportColumns, header[i]) {
+			return nil, fmt.Errorf("unknown column %q - use %s", name, strings.Join(userImportColumns, ", "))
+		}
+	}
+	if !slices.Contains(header, "email") {
+		return nil, fmt.Errorf("an email column is required")
+	}
+	in.FieldsPerRecord = len(header)
+
+	result := &userImport{Invite: invite, DryRun: dryRun}
+	seen := make(map[string]int)
+	for {
+		record, err := in.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := in.FieldPos(0)
+		row := &userImportRow{Line: line, Fields: make(map[string]string, len(header))}
+		for i, value := range record {
+			row.Fields[header[i]] = strings.TrimSpace(value)
+		}
+		row.Errors = validateUserImport(ctx, store, row.Fields, invite)
+		if email := strings.ToLower(row.Fields["email"]); email != "" {
+			if first, ok := seen[email]; ok {
+				row.Errors = append(row.Errors, fmt.Sprintf("email: repeats line %d", first))
+			} else {
+				seen[email] = line
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if !result.Valid() || dryRun {
+		return result, nil
+	}
+
+	for _, row := range result.Rows {
+		if invite {
+			if _, err := kit.Registration.Invite(ctx, row.Fields["email"]); err != nil {
+				return result, fmt.Errorf("line %d: %w", row.Line, err)
+			}
+			continue
+		}
+		if err := createImportedUser(ctx, store, row); err != nil {
+			return result, fmt.Errorf("line %d: %w", row.Line, err)
+		}
+	}
+	return result, nil
+}
+
+// validateUserImport returns what's wrong with a row, checked against
+// the store.
+func validateUserImport(ctx context.Context, store auth.UserStore, fields map[string]string, invite bool) []string {
+	var errs []string
+	email := fields["email"]
+	if !strings.Contains(email, "@") || strings.ContainsAny(email, " ,;<>") {
+		errs = append(errs, "email: is not an email address")
+	} else if exists, err := store.ExistsEmail(ctx, email); err != nil {
+		errs = append(errs, "email: "+err.Error())
+	} else if exists {
+		errs = append(errs, "email: is already taken")
+	}
+	if invite {
+		for _, column := range []string{"name", "username", "role"} {
+			if fields[column] != "" {
+				errs = append(errs, column+": can't be set for invited users, who choose their own")
+			}
+		}
+		return errs
+	}
+	if username := auth.NormalizeUsername(fields["username"]); username != "" {
+		if usernames, ok := store.(auth.UsernameStore); !ok {
+			errs = append(errs, "username: the auth store doesn't keep usernames")
+		} else if err := auth.ValidateUsername(username); err != nil {
+			errs = append(errs, "username: "+err.Error())
+		} else if taken, err := usernames.ExistsUsername(ctx, username); err != nil {
+			errs = append(errs, "username: "+err.Error())
+		} else if taken {
+			errs = append(errs, "username: is already taken")
+		}
+	}
+	if _, ok := store.(auth.RoleStore); fields["role"] != "" && !ok {
+		errs = append(errs, "role: the auth store doesn't keep roles")
+	}
+	return errs
+}
+
+// createImportedUser creates a validated row's user with a random
+// temporary password.
+func createImportedUser(ctx context.Context, store auth.UserStore, row *userImportRow) error {
+	password, digest, err := newTaskPassword()
+	if err != nil {
+		return err
+	}
+	user := &auth.User{
+		Email:          row.Fields["email"],
+		DisplayName:    row.Fields["name"],
+		Username:       auth.NormalizeUsername(row.Fields["username"]),
+		Role:           row.Fields["role"],
+		PasswordDigest: digest,
+		IsActive:       true,
+	}
+	if err := store.Create(ctx, user); err != nil {
+		return err
+	}
+	if roles, ok := store.(auth.RoleStore); ok && user.Role != "" {
+		if err := roles.SetRole(ctx, user.ID, user.Role); err != nil {
+			return err
+		}
+	}
+	row.Password = password
+	return nil
+}
+
+// exportUsers writes every user in store to w as CSV, with a header row
+// and the given fields, and returns how many it wrote.
+func exportUsers(ctx context.Context, store auth.UserStore, w io.Writer, fields []string) (int, error) {
+	list, ok := store.(auth.ProvisioningStore)
+	if !ok {
+		return 0, fmt.Errorf("the auth store %T can't list users - implement auth.ProvisioningStore", store)
+	}
+	for _, field := range fields {
+		if !slices.Contains(userExportFields, field) {
+			return 0, fmt.Errorf("unknown field %q - use %s", field, strings.Join(userExportFields, ", "))
+		}
+	}
+
+	const page = 500
+	n := 0
+	err := export.WriteCSV(w, fields, func(yield func([]string, error) bool) {
+		for offset := 0; ; offset += page {
+			users, total, err := list.ListUsers(ctx, offset, page)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, user := range users {
+				n++
+				if !yield(userExportRow(user, fields), nil) {
+					return
+				}
+			}
+			if len(users) == 0 || offset+len(users) >= total {
+				return
+			}
+		}
+	})
+	return n, err
+}
+
+// userExportRow returns the fields of user, with times as RFC 3339.
+func userExportRow(user *auth.User, fields []string) []string {
+	timestamp := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		switch field {
+		case "id":
+			row[i] = user.ID
+		case "email":
+			row[i] = user.Email
+		case "username":
+			row[i] = user.Username
+		case "name":
+			row[i] = user.DisplayName
+		case "role":
+			row[i] = user.Role
+		case "email_verified_at":
+			row[i] = timestamp(user.EmailVerifiedAt)
+		case "deactivated_at":
+			row[i] = timestamp(user.DeactivatedAt)
+		}
+	}
+	return row
+}
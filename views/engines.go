@@ -0,0 +1,131 @@
+package views
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/gobuffalo/plush/v4"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+// defaultTemplates returns the built-in page templates.
+func defaultTemplates() fs.FS {
+	sub, err := fs.Sub(templatesFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// PlushEngine renders Plush templates from a filesystem. Page names map
+// to files with Ext appended, so PageLogin is "auth/login.plush.html".
+type PlushEngine struct {
+	FS  fs.FS
+	Ext string
+}
+
+// NewPlushEngine creates a Plush engine reading *.plush.html from fsys.
+func NewPlushEngine(fsys fs.FS) *PlushEngine {
+	return &PlushEngine{FS: fsys, Ext: ".plush.html"}
+}
+
+func (e *PlushEngine) Render(w io.Writer, name string, data map[string]any) error {
+	src, err := fs.ReadFile(e.FS, name+e.Ext)
+	if err != nil {
+		return fmt.Errorf("views: %s: %w", name, err)
+	}
+	return renderPlush(w, name, src, data, e.partial)
+}
+
+// renderPlush renders a page's Plush source to w, reading partials with
+// partial.
+func renderPlush(w io.Writer, name string, src []byte, data map[string]any, partial func(string) (string, error)) error {
+	// Plush fails on unknown identifiers, so fill in optional keys even
+	// when called directly rather than through Execute
+	data = withDefaults(name, data)
+	if data == nil {
+		data = map[string]any{}
+	}
+	ctx := plush.NewContextWith(data)
+	ctx.Set("partialFeeder", partial)
+	out, err := plush.Render(string(src), ctx)
+	if err != nil {
+		return fmt.Errorf("views: render %s: %w", name, err)
+	}
+	_, err = io.WriteString(w, out)
+	return err
+}
+
+// partial reads a page for Plush's partial helper, so one page can
+// include another: <%= partial("auth/login_form") %>. Pages the engine
+// doesn't have come from the built-in templates, so an app overriding
+// PageLogin can still include the built-in PageLoginForm.
+func (e *PlushEngine) partial(name string) (string, error) {
+	src, err := fs.ReadFile(e.FS, name+e.Ext)
+	if errors.Is(err, fs.ErrNotExist) {
+		src, err = fs.ReadFile(defaultTemplates(), name+".plush.html")
+	}
+	if err != nil {
+		return "", fmt.Errorf("views: partial %s: %w", name, err)
+	}
+	return string(src), nil
+}
+
+// TemplateEngine renders html/template files from a filesystem. Page
+// names map to files with Ext appended, so PageLogin is
+// "auth/login.html". Parsed templates are cached.
+type TemplateEngine struct {
+	FS    fs.FS
+	Ext   string
+	Funcs template.FuncMap
+
+	mu    sync.Mutex
+	cache map[string]*template.Template
+}
+
+// NewTemplateEngine creates an html/template engine reading *.html from fsys.
+func NewTemplateEngine(fsys fs.FS) *TemplateEngine {
+	return &TemplateEngine{FS: fsys, Ext: ".html"}
+}
+
+func (e *TemplateEngine) Render(w io.Writer, name string, data map[string]any) error {
+	t, err := e.lookup(name)
+	if err != nil {
+		return err
+	}
+	if err := t.Execute(w, data); err != nil {
+		return fmt.Errorf("views: render %s: %w", name, err)
+	}
+	return nil
+}
+
+func (e *TemplateEngine) lookup(name string) (*template.Template, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if t, ok := e.cache[name]; ok {
+		return t, nil
+	}
+
+	src, err := fs.ReadFile(e.FS, name+e.Ext)
+	if err != nil {
+		return nil, fmt.Errorf("views: %s: %w", name, err)
+	}
+	t, err := template.New(name).Funcs(e.Funcs).Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("views: parse %s: %w", name, err)
+	}
+
+	if e.cache == nil {
+		e.cache = make(map[string]*template.Template)
+	}
+	e.cache[name] = t
+	return t, nil
+}
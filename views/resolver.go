@@ -0,0 +1,199 @@
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// Where a page's template can come from, in the order a Resolver checks.
+const (
+	SourceApp     = "app"
+	SourceTenant  = "tenant"
+	SourceBuffkit = "buffkit"
+)
+
+// pages lists every page Buffkit renders.
+var pages = []string{
+	PageLogin, PageLoginForm, PageRegister, PageForgotPassword,
+	PageResetPassword, PageAccount, PageSessions, PageMailPreview,
+	PageMailTemplates, PageImportUpload, PageImportMap, PageImportStatus,
+	PageSettings, PageConsent, PageAnalytics, PageError,
+}
+
+// Pages returns the names of the pages Buffkit renders, each of which an
+// app can supply its own template for.
+func Pages() []string {
+	return append([]string(nil), pages...)
+}
+
+// Resolver finds the Plush template for each of Buffkit's pages: the
+// app's own first, then the current tenant's override, then the built-in
+// one. Templates are laid out like the built-ins, so the login page is
+// auth/login.plush.html in each. Partials resolve the same way, so an app
+// can replace the login form alone and keep the built-in login page
+// around it.
+type Resolver struct {
+	// App holds the app's templates. Wire uses Config.Templates, or the
+	// templates/buffkit directory. Nil skips it.
+	App fs.FS
+
+	// Tenant returns the current tenant's overrides, or nil when the
+	// request has none (see tenancy.OverridesFS). Nil skips tenants.
+	Tenant func(ctx context.Context) fs.FS
+}
+
+// Resolution says where a page's template was found.
+type Resolution struct {
+	Page string `json:"page"`
+
+	// Source is SourceApp, SourceTenant or SourceBuffkit.
+	Source string `json:"source"`
+
+	// Path is the template's file within the source.
+	Path string `json:"path"`
+
+	// Shadows lists the sources after Source that have the page too, and
+	// are hidden by it.
+	Shadows []string `json:"shadows,omitempty"`
+}
+
+// UseResolver sets the resolver Execute falls back to when Config.Views
+// doesn't render a page. Wire calls it; nil restores the built-in
+// templates alone.
+func UseResolver(r *Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+	globalResolver = r
+}
+
+// layer is one source of templates.
+type layer struct {
+	source string
+	fsys   fs.FS
+}
+
+// layers returns the sources to check for ctx, in order.
+func (r *Resolver) layers(ctx context.Context) []layer {
+	var layers []layer
+	if r.App != nil {
+		layers = append(layers, layer{SourceApp, r.App})
+	}
+	if r.Tenant != nil {
+		if tenant := r.Tenant(ctx); tenant != nil {
+			layers = append(layers, layer{SourceTenant, tenant})
+		}
+	}
+	return append(layers, layer{SourceBuffkit, defaultTemplates()})
+}
+
+// Resolve reports where page's template is found for ctx. It returns an
+// error wrapping fs.ErrNotExist when no source has it.
+func (r *Resolver) Resolve(ctx context.Context, page string) (Resolution, error) {
+	res, _, err := r.resolve(ctx, page)
+	return res, err
+}
+
+func (r *Resolver) resolve(ctx context.Context, page string) (Resolution, []byte, error) {
+	res := Resolution{Page: page, Path: page + ".plush.html"}
+	var src []byte
+	for _, l := range r.layers(ctx) {
+		body, err := fs.ReadFile(l.fsys, res.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return res, nil, fmt.Errorf("views: %s: %w", page, err)
+		}
+		if res.Source == "" {
+			res.Source, src = l.source, body
+		} else {
+			res.Shadows = append(res.Shadows, l.source)
+		}
+	}
+	if res.Source == "" {
+		return res, nil, fmt.Errorf("views: %s: %w", page, fs.ErrNotExist)
+	}
+	return res, src, nil
+}
+
+// Resolutions reports where each of Buffkit's pages resolves for ctx.
+func (r *Resolver) Resolutions(ctx context.Context) []Resolution {
+	resolutions := make([]Resolution, 0, len(pages))
+	for _, page := range pages {
+		res, _ := r.Resolve(ctx, page)
+		resolutions = append(resolutions, res)
+	}
+	return resolutions
+}
+
+// Render renders page with the template it resolves to for ctx.
+func (r *Resolver) Render(ctx context.Context, w io.Writer, page string, data map[string]any) error {
+	_, src, err := r.resolve(ctx, page)
+	if err != nil {
+		return err
+	}
+	return renderPlush(w, page, src, data, func(name string) (string, error) {
+		_, src, err := r.resolve(ctx, name)
+		if err != nil {
+			return "", fmt.Errorf("views: partial %s: %w", name, err)
+		}
+		return string(src), nil
+	})
+}
+
+// Handler serves the page at /__templates in development: which file
+// each of Buffkit's pages resolves to for this request, and what it
+// shadows. ?format=json returns the same as JSON.
+func (r *Resolver) Handler(c buffalo.Context) error {
+	resolutions := r.Resolutions(c)
+	if c.Param("format") == "json" {
+		c.Response().Header().Set("Content-Type", "application/json")
+		c.Response().WriteHeader(http.StatusOK)
+		return json.NewEncoder(c.Response()).Encode(resolutions)
+	}
+
+	var page strings.Builder
+	page.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Templates</title>
+    <style>
+        body { font-family: system-ui, sans-serif; padding: 20px; }
+        table { border-collapse: collapse; width: 100%; }
+        th, td { text-align: left; padding: 6px 10px; border-bottom: 1px solid #ddd; }
+        th { background: #f5f5f5; }
+        .buffkit { color: #999; }
+    </style>
+</head>
+<body>
+    <h1>Templates (Development)</h1>
+    <p>Each page uses the first template found in the app's templates, then the tenant's overrides, then Buffkit's built-ins.</p>
+`)
+	mu.RLock()
+	custom := globalEngine != nil
+	mu.RUnlock()
+	if custom {
+		page.WriteString("    <p>Config.Views is set: pages it renders take precedence over these.</p>\n")
+	}
+	page.WriteString("    <table>\n        <tr><th>Page</th><th>Source</th><th>File</th><th>Shadows</th></tr>\n")
+	for _, res := range resolutions {
+		fmt.Fprintf(&page, "        <tr class=\"%s\"><td><code>%s</code></td><td>%s</td><td><code>%s</code></td><td>%s</td></tr>\n",
+			html.EscapeString(res.Source), html.EscapeString(res.Page), html.EscapeString(res.Source),
+			html.EscapeString(res.Path), html.EscapeString(strings.Join(res.Shadows, ", ")))
+	}
+	page.WriteString("    </table>\n</body>\n</html>\n")
+
+	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err := io.WriteString(c.Response(), page.String())
+	return err
+}
@@ -0,0 +1,97 @@
+package views_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/views"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantKey struct{}
+
+func TestResolver(t *testing.T) {
+	r := &views.Resolver{
+		App: fstest.MapFS{
+			"auth/login_form.plush.html": {Data: []byte(`<form class="app"><%= login_path %></form>`)},
+			"errors/error.plush.html":    {Data: []byte(`app error <%= status %>`)},
+		},
+		Tenant: func(ctx context.Context) fs.FS {
+			if ctx.Value(tenantKey{}) == nil {
+				return nil
+			}
+			return fstest.MapFS{
+				"errors/error.plush.html":  {Data: []byte(`tenant error`)},
+				"mail/preview.plush.html":  {Data: []byte(`tenant preview`)},
+				"auth/register.plush.html": {Data: []byte(`tenant register`)},
+			}
+		},
+	}
+	ctx := context.Background()
+	tenantCtx := context.WithValue(ctx, tenantKey{}, "acme")
+
+	res, err := r.Resolve(ctx, views.PageLogin)
+	require.NoError(t, err)
+	assert.Equal(t, views.Resolution{Page: views.PageLogin, Source: views.SourceBuffkit, Path: "auth/login.plush.html"}, res)
+
+	res, err = r.Resolve(tenantCtx, views.PageError)
+	require.NoError(t, err)
+	assert.Equal(t, views.SourceApp, res.Source, "the app's templates come first")
+	assert.Equal(t, []string{views.SourceTenant, views.SourceBuffkit}, res.Shadows)
+
+	res, err = r.Resolve(tenantCtx, views.PageRegister)
+	require.NoError(t, err)
+	assert.Equal(t, views.SourceTenant, res.Source)
+
+	res, err = r.Resolve(ctx, views.PageRegister)
+	require.NoError(t, err)
+	assert.Equal(t, views.SourceBuffkit, res.Source, "other requests don't see the tenant's")
+
+	_, err = r.Resolve(ctx, "missing/page")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.Len(t, r.Resolutions(ctx), len(views.Pages()))
+
+	// The built-in login page includes the app's login form
+	var buf bytes.Buffer
+	require.NoError(t, r.Render(ctx, &buf, views.PageLogin, map[string]any{"login_path": "/login"}))
+	assert.Contains(t, buf.String(), `<form class="app">/login</form>`)
+
+	// Execute goes through the resolver when the engine has no page
+	views.UseResolver(r)
+	defer views.UseResolver(nil)
+	buf.Reset()
+	require.NoError(t, views.ExecuteContext(tenantCtx, &buf, views.PageMailPreview, nil))
+	assert.Equal(t, "tenant preview", buf.String())
+	buf.Reset()
+	require.NoError(t, views.Execute(&buf, views.PageError, map[string]any{"status": 500}))
+	assert.Equal(t, "app error 500", buf.String())
+}
+
+func TestResolverHandler(t *testing.T) {
+	r := &views.Resolver{App: fstest.MapFS{
+		"auth/login.plush.html": {Data: []byte("app login")},
+	}}
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/__templates", r.Handler)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/__templates?format=json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resolutions []views.Resolution
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resolutions))
+	require.NotEmpty(t, resolutions)
+	assert.Equal(t, views.Resolution{Page: views.PageLogin, Source: views.SourceApp, Path: "auth/login.plush.html", Shadows: []string{views.SourceBuffkit}}, resolutions[0])
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/__templates", nil))
+	assert.Contains(t, rec.Body.String(), `<tr class="app"><td><code>auth/login</code></td><td>app</td><td><code>auth/login.plush.html</code></td><td>buffkit</td></tr>`)
+}
@@ -0,0 +1,85 @@
+package views
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// Stream writes an HTML response in parts, sending each to the client as
+// soon as it has rendered. Put the layout's <head> first, with the import
+// map and stylesheets, so the browser fetches those while a slow body is
+// still being rendered:
+//
+//	parts := render.New(render.Options{TemplatesFS: templates.FS()}) // no layout
+//	return views.Stream(c, http.StatusOK,
+//	    parts.HTML("layouts/head.plush.html"),
+//	    views.StreamFunc(func(w io.Writer, data render.Data) error {
+//	        data["report"] = slowReport(c)
+//	        return parts.HTML("reports/show.plush.html").Render(w, data)
+//	    }),
+//	    parts.HTML("layouts/foot.plush.html"),
+//	)
+//
+// The first part goes through c.Render as usual, so its errors are
+// handled as usual and it gets the usual data: the context's values,
+// Buffkit's template helpers, params and flash. The parts after it share
+// that data, and see what earlier parts added to it. Load the slow data
+// in a part, not in the handler, or there's nothing to gain.
+//
+// Each part is rendered whole before it's sent, so a part that fails
+// isn't sent half-written. By then the status has been sent, so the
+// error can't make an error page; Stream logs it and ends the response.
+// Components are expanded part by part (see
+// components.ExpanderMiddleware); keep each one within a part.
+func Stream(c buffalo.Context, status int, parts ...render.Renderer) error {
+	if len(parts) == 0 {
+		return c.Render(status, nil)
+	}
+
+	first := &capturePart{Renderer: parts[0]}
+	if err := c.Render(status, first); err != nil {
+		return err
+	}
+	flush(c.Response())
+
+	var buf bytes.Buffer
+	for _, part := range parts[1:] {
+		buf.Reset()
+		if err := part.Render(&buf, first.data); err != nil {
+			c.Logger().Errorf("views: stream: %v", err)
+			return nil
+		}
+		if _, err := c.Response().Write(buf.Bytes()); err != nil {
+			return err
+		}
+		flush(c.Response())
+	}
+	return nil
+}
+
+// StreamFunc makes fn a part for Stream.
+func StreamFunc(fn render.RendererFunc) render.Renderer {
+	return render.Func("text/html; charset=utf-8", fn)
+}
+
+// capturePart renders a part, keeping the data c.Render gave it for the
+// parts after it.
+type capturePart struct {
+	render.Renderer
+	data render.Data
+}
+
+func (p *capturePart) Render(w io.Writer, data render.Data) error {
+	p.data = data
+	return p.Renderer.Render(w, data)
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
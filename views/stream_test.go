@@ -0,0 +1,83 @@
+package views_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/johnjansen/buffkit/views"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flushRecorder records what had been sent at each flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	chunks []string
+}
+
+func (r *flushRecorder) Flush() {
+	r.chunks = append(r.chunks, r.Body.String())
+	r.ResponseRecorder.Flush()
+}
+
+func TestStream(t *testing.T) {
+	head := views.StreamFunc(func(w io.Writer, data render.Data) error {
+		_, err := io.WriteString(w, "<html><head><title>"+data["title"].(string)+"</title></head><body>")
+		return err
+	})
+	foot := views.StreamFunc(func(w io.Writer, data render.Data) error {
+		_, err := io.WriteString(w, "</body></html>")
+		return err
+	})
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	var res *flushRecorder
+	var sentBeforeBody []string
+	app.GET("/", func(c buffalo.Context) error {
+		c.Set("title", "Report")
+		return views.Stream(c, http.StatusAccepted, head,
+			views.StreamFunc(func(w io.Writer, data render.Data) error {
+				// The head is on its way while the body renders
+				sentBeforeBody = append(sentBeforeBody, res.Body.String())
+				data["rows"] = 3
+				_, err := io.WriteString(w, "<p>"+data["params"].(map[string]string)["q"]+"</p>")
+				return err
+			}),
+			views.StreamFunc(func(w io.Writer, data render.Data) error {
+				_, err := io.WriteString(w, "<p>rows from an earlier part</p>")
+				if data["rows"] != 3 {
+					return errors.New("missing rows")
+				}
+				return err
+			}),
+			foot)
+	})
+	app.GET("/broken", func(c buffalo.Context) error {
+		c.Set("title", "Broken")
+		return views.Stream(c, http.StatusOK, head,
+			views.StreamFunc(func(w io.Writer, data render.Data) error {
+				_, _ = io.WriteString(w, "<p>half</p>")
+				return errors.New("database went away")
+			}),
+			foot)
+	})
+
+	res = &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	app.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/?q=sales", nil))
+	assert.Equal(t, http.StatusAccepted, res.Code)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Equal(t, "<html><head><title>Report</title></head><body><p>sales</p><p>rows from an earlier part</p></body></html>", res.Body.String())
+	require.Len(t, res.chunks, 4)
+	assert.Equal(t, []string{"<html><head><title>Report</title></head><body>"}, sentBeforeBody)
+
+	// A failing part is dropped whole, and ends the response
+	res = &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	app.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/broken", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "<html><head><title>Broken</title></head><body>", res.Body.String())
+}
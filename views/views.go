@@ -0,0 +1,310 @@
+// Package views renders the pages Buffkit itself serves: the login form,
+// the mail preview, and error pages. Rendering goes through a small Engine
+// interface so apps built on templ or html/template don't need Plush just
+// for Buffkit's pages. The default engine is Plush with built-in templates.
+//
+// Apps only have to provide the pages they want to change. When their
+// engine has no template for a page (fs.ErrNotExist), the built-in one is
+// used instead.
+//
+// Stream is for the app's own pages: it sends a page in parts, so the
+// <head> reaches the browser before a slow body has rendered.
+package views
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+)
+
+// Names of the pages Buffkit renders, and the data each one receives.
+const (
+	// PageLogin is the login page. Data: "login_path" (form action),
+	// "identifier" (what users log in with: "email", "username", or
+	// "email_or_username"), "email" (the email or username typed, to
+	// refill the field), "errors" ([]string),
+	// "return_to" (where to go after login, for a hidden field; already
+	// checked by auth.SafeReturnTo), "forgot_password_path" (where to
+	// link for a password reset; empty without one), and Buffalo's
+	// "flash" (with auth.SessionExpiredMessage under "warning" after a
+	// timeout, and reset.SuccessMessage under "success" after a password
+	// reset).
+	PageLogin = "auth/login"
+
+	// PageLoginForm is the login form alone, with the same data as
+	// PageLogin. The built-in login page includes it, and htmx requests
+	// get it back after a failed login.
+	PageLoginForm = "auth/login_form"
+
+	// PageRegister is the registration page from the registration
+	// package. Data: "register_path" (form action, carrying the
+	// invitation when there is one), "email", "display_name", and
+	// "username" (to refill the fields), "usernames" (whether to ask for
+	// a username), "invited" (whether the email comes from the
+	// invitation and can't be changed), and "errors" ([]string).
+	PageRegister = "auth/register"
+
+	// PageForgotPassword asks for the email to send a password reset
+	// link to, from the auth/reset package. Data:
+	// "forgot_password_path" (form action), "email" (to refill the
+	// field), "sent" (whether a link was sent, if the email is
+	// registered), and "errors" ([]string).
+	PageForgotPassword = "auth/forgot_password"
+
+	// PageResetPassword is where a password reset link leads, from the
+	// auth/reset package. Data: "reset_password_path" (form action),
+	// "forgot_password_path" (to ask for another link), "invalid"
+	// (whether the link is unknown, used, or expired), and "errors"
+	// ([]string).
+	PageResetPassword = "auth/reset_password"
+
+	// PageAccount is the account page from the account package. Data:
+	// "user" (*auth.User, whose PendingEmail awaits confirmation),
+	// "email_verified", "account_path" (where its
+	// forms post), "avatars" (whether avatar upload is enabled),
+	// "usernames" (whether users pick a username), "sessions" (whether
+	// the sessions page is mounted), "errors" ([]string), and Buffalo's
+	// "flash".
+	PageAccount = "account/profile"
+
+	// PageSessions lists where the user is logged in, from the account
+	// package. Data: "user" (*auth.User), "sessions" ([]*auth.Session,
+	// the current one first, each with a Description such as "Chrome on
+	// macOS — Berlin, DE"), "current_session" (the current one's ID),
+	// "account_path" (a session is ended by posting to
+	// "<account_path>/sessions/<id>/end", and all others to
+	// "<account_path>/sessions/end-others"), and Buffalo's "flash".
+	PageSessions = "account/sessions"
+
+	// PageMailPreview is the development mail preview. Data: "available"
+	// (false when the sender isn't a DevSender) and "messages", newest
+	// first, each with Subject, To, Text, and HTML (template.HTML).
+	PageMailPreview = "mail/preview"
+
+	// PageMailTemplates is the development mail template gallery. Data:
+	// "templates" (registered names), "selected" (the one shown),
+	// "gallery_path" (where the page and its test-send form live), "to"
+	// (address to send tests to), the rendered "subject", "text", and
+	// "html" (a string, for an iframe's srcdoc), "error" (set instead
+	// when rendering failed), and Buffalo's "flash".
+	PageMailTemplates = "mail/templates"
+
+	// PageImportUpload is the upload form of the imports package. Data:
+	// "importer" (its name), "fields" ([]imports.Field), "upload_path"
+	// (form action; the file goes in "file"), and "errors" ([]string).
+	PageImportUpload = "imports/upload"
+
+	// PageImportMap is where an uploaded file's columns are matched to
+	// the importer's fields. Data: "import" (*imports.Import), "columns"
+	// (the file's header), "fields" ([]imports.FieldColumn, each with
+	// the Column it's mapped to or -1), "map_path" (form action; each
+	// field's column index goes in "map[<field name>]"), and "errors"
+	// ([]string).
+	PageImportMap = "imports/map"
+
+	// PageImportStatus shows an import's progress and then its results.
+	// Data: "import" (*imports.Import), "finished", "progress" (HTML that
+	// the import's SSE events replace), "events_path" and "event" (the
+	// SSE endpoint and event name to listen for), "row_errors"
+	// ([]imports.RowError, the first of them), "more_errors" (whether
+	// there are more than listed), and "errors_path" (a CSV of them all).
+	PageImportStatus = "imports/status"
+
+	// PageSettings is the settings admin page from the settings package.
+	// Data: "settings" ([]settings.Field, each a Setting with its Value
+	// and whether it's Overridden), "settings_path" (where the form
+	// posts; resetting a setting posts to "<settings_path>/<key>/reset"),
+	// "errors" ([]string), and Buffalo's "flash".
+	PageSettings = "settings/index"
+
+	// PageConsent is the cookie preferences page from the consent
+	// package. Data: "categories" ([]consent.Field, each a Category with
+	// its Key, Label, Help, whether it's Required, and whether it's
+	// Checked), "given" (whether the visitor has chosen before),
+	// "consent_path" (where the form posts the checked "categories"),
+	// "return_to", and Buffalo's "flash".
+	PageConsent = "consent/preferences"
+
+	// PageAnalytics is the dashboard from the analytics package. Data:
+	// "report" (analytics.Report, with the period's Views, Visitors,
+	// Days, Pages, Referrers, Devices and Events), "days" (the period's
+	// length, from the "days" query parameter) and "analytics_path".
+	PageAnalytics = "analytics/dashboard"
+
+	// PageError is the page rendered by ErrorHandler. Data: "status"
+	// (int), "status_text" and "message" (what the error tells the
+	// visitor, or "").
+	PageError = "errors/error"
+)
+
+// optional holds defaults for page data callers may leave out, so
+// templates can use every documented key.
+var optional = map[string]map[string]any{
+	PageLogin:          {"email": "", "identifier": "email", "errors": []string(nil), "return_to": "", "forgot_password_path": "", "flash": map[string][]string{}},
+	PageLoginForm:      {"email": "", "identifier": "email", "errors": []string(nil), "return_to": "", "forgot_password_path": ""},
+	PageRegister:       {"email": "", "display_name": "", "username": "", "usernames": false, "invited": false, "errors": []string(nil)},
+	PageForgotPassword: {"email": "", "sent": false, "errors": []string(nil)},
+	PageResetPassword:  {"invalid": false, "errors": []string(nil)},
+	PageMailTemplates: {"selected": "", "to": "", "subject": "", "text": "", "html": "", "error": "",
+		"flash": map[string][]string{}},
+	PageAccount:      {"usernames": false, "sessions": false, "errors": []string(nil), "flash": map[string][]string{}},
+	PageSessions:     {"flash": map[string][]string{}},
+	PageImportUpload: {"errors": []string(nil)},
+	PageImportMap:    {"errors": []string(nil)},
+	PageSettings:     {"errors": []string(nil), "flash": map[string][]string{}},
+	PageConsent:      {"return_to": "", "flash": map[string][]string{}},
+	PageError:        {"message": ""},
+}
+
+// Engine renders a named page with data to w. Implementations return an
+// error wrapping fs.ErrNotExist when they have no template for name.
+type Engine interface {
+	Render(w io.Writer, name string, data map[string]any) error
+}
+
+// EngineFunc adapts a function to Engine. Use it to plug in templ, whose
+// templates are Go functions rather than files:
+//
+//	views.Use(views.EngineFunc(func(w io.Writer, name string, data map[string]any) error {
+//	    switch name {
+//	    case views.PageLogin:
+//	        return pages.Login(data["login_path"].(string)).Render(context.Background(), w)
+//	    }
+//	    return fs.ErrNotExist
+//	}))
+type EngineFunc func(w io.Writer, name string, data map[string]any) error
+
+// Render calls f.
+func (f EngineFunc) Render(w io.Writer, name string, data map[string]any) error {
+	return f(w, name, data)
+}
+
+var (
+	mu             sync.RWMutex
+	globalEngine   Engine
+	globalResolver *Resolver
+	defaultEngine  = NewPlushEngine(defaultTemplates())
+)
+
+// Use sets the engine for Buffkit's pages. Wire calls it with
+// Config.Views; nil restores the default.
+func Use(e Engine) {
+	mu.Lock()
+	defer mu.Unlock()
+	globalEngine = e
+}
+
+// Default returns the built-in Plush engine.
+func Default() Engine {
+	return defaultEngine
+}
+
+// Execute renders page name with the configured engine, falling back to
+// the built-in template when the engine doesn't have one.
+func Execute(w io.Writer, name string, data map[string]any) error {
+	return ExecuteContext(context.Background(), w, name, data)
+}
+
+// ExecuteContext is Execute for a request: when the engine doesn't have
+// the page, the configured Resolver picks the template for ctx, which
+// may be a tenant's override.
+func ExecuteContext(ctx context.Context, w io.Writer, name string, data map[string]any) error {
+	data = withDefaults(name, data)
+
+	mu.RLock()
+	e, r := globalEngine, globalResolver
+	mu.RUnlock()
+
+	if e != nil {
+		err := e.Render(w, name, data)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if r != nil {
+		return r.Render(ctx, w, name, data)
+	}
+	return defaultEngine.Render(w, name, data)
+}
+
+// withDefaults returns data with the page's optional keys filled in. The
+// caller's map isn't modified.
+func withDefaults(name string, data map[string]any) map[string]any {
+	defaults := optional[name]
+	if len(defaults) == 0 {
+		return data
+	}
+	merged := make(map[string]any, len(data)+len(defaults))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Render writes page name as an HTML response with status. It goes
+// through c.Render, so the page also sees everything a Buffalo template
+// would (context values, helpers, flash, params), with data taking
+// precedence. The page is rendered to a buffer first so a template error
+// doesn't leave a half-written response.
+func Render(c buffalo.Context, status int, name string, data map[string]any) error {
+	return c.Render(status, page{ctx: c, name: name, data: data})
+}
+
+// page is a render.Renderer for one of Buffkit's pages.
+type page struct {
+	ctx  context.Context
+	name string
+	data map[string]any
+}
+
+func (p page) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+func (p page) Render(w io.Writer, data render.Data) error {
+	merged := make(map[string]any, len(data)+len(p.data))
+	for k, v := range data {
+		merged[k] = v
+	}
+	for k, v := range p.data {
+		merged[k] = v
+	}
+	return ExecuteContext(p.ctx, w, p.name, merged)
+}
+
+// ErrorHandler renders PageError. Install it for the statuses you want
+// Buffkit's error page for:
+//
+//	app.ErrorHandlers[http.StatusNotFound] = views.ErrorHandler
+//	app.ErrorHandlers[http.StatusInternalServerError] = views.ErrorHandler
+//
+// The error itself isn't shown, so it's safe in production, unless it
+// (or an error it wraps) is a PublicError, whose message is.
+func ErrorHandler(status int, err error, c buffalo.Context) error {
+	c.Logger().Error(err)
+	data := map[string]any{
+		"status":      status,
+		"status_text": http.StatusText(status),
+	}
+	var public PublicError
+	if errors.As(err, &public) {
+		data["message"] = public.PublicMessage()
+	}
+	return Render(c, status, PageError, data)
+}
+
+// PublicError is an error with a message safe to show visitors, such as
+// "Uploads can be at most 10 MB".
+type PublicError interface {
+	error
+	PublicMessage() string
+}
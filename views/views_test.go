@@ -0,0 +1,90 @@
+package views_test
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/johnjansen/buffkit/views"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultTemplates(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, views.Default().Render(&buf, views.PageLogin, map[string]any{"login_path": "/auth/login"}))
+	assert.Contains(t, buf.String(), `action="/auth/login"`)
+
+	buf.Reset()
+	require.NoError(t, views.Default().Render(&buf, views.PageMailPreview, map[string]any{
+		"available": true,
+		"messages": []struct {
+			Subject, To, Text string
+			HTML              template.HTML
+		}{{Subject: "<Hi>", To: "a@example.com", HTML: "<b>bold</b>"}},
+	}))
+	assert.Contains(t, buf.String(), "Showing 1 message(s)")
+	assert.Contains(t, buf.String(), "&lt;Hi&gt;", "plain fields are escaped")
+	assert.Contains(t, buf.String(), "<b>bold</b>", "the HTML body is not")
+	assert.NotContains(t, buf.String(), "Text Body")
+
+	err := views.Default().Render(&buf, "missing/page", nil)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestTemplateEngine(t *testing.T) {
+	engine := views.NewTemplateEngine(fstest.MapFS{
+		"auth/login.html": {Data: []byte(`<form action="{{.login_path}}">custom</form>`)},
+	})
+	views.Use(engine)
+	defer views.Use(nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, views.Execute(&buf, views.PageLogin, map[string]any{"login_path": "/login"}))
+	assert.Equal(t, `<form action="/login">custom</form>`, buf.String())
+
+	// Pages the engine doesn't have fall back to the built-in templates
+	buf.Reset()
+	require.NoError(t, views.Execute(&buf, views.PageError, map[string]any{"status": 404, "status_text": "Not Found"}))
+	assert.Contains(t, buf.String(), "Not Found")
+}
+
+func TestPlushPartialFallsBackToBuiltIn(t *testing.T) {
+	engine := views.NewPlushEngine(fstest.MapFS{
+		"auth/login.plush.html": {Data: []byte(`<main class="custom"><%= partial("auth/login_form") %></main>`)},
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, engine.Render(&buf, views.PageLogin, map[string]any{
+		"login_path": "/login",
+		"errors":     []string{"invalid email or password"},
+	}))
+	assert.Contains(t, buf.String(), `<main class="custom"><form`)
+	assert.Contains(t, buf.String(), "<li>invalid email or password</li>")
+}
+
+func TestEngineFunc(t *testing.T) {
+	views.Use(views.EngineFunc(func(w io.Writer, name string, data map[string]any) error {
+		if name != views.PageError {
+			return fs.ErrNotExist
+		}
+		_, err := io.WriteString(w, "oops")
+		return err
+	}))
+	defer views.Use(nil)
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.ErrorHandlers[http.StatusNotFound] = views.ErrorHandler
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "oops", rec.Body.String())
+}
@@ -0,0 +1,359 @@
+package buffkit
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/logger"
+	"github.com/hibiken/asynq"
+	"github.com/johnjansen/buffkit/auth"
+	"github.com/johnjansen/buffkit/components"
+	"github.com/johnjansen/buffkit/internalpath"
+	"github.com/johnjansen/buffkit/registration"
+	"github.com/johnjansen/buffkit/views"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWireTwice(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	_, err = Wire(app, Config{AuthSecret: []byte("secret"), MountPath: "/other"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already called")
+}
+
+func TestWireRouteCollision(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/login", appHandler)
+	routes := len(app.Routes())
+
+	_, err := Wire(app, Config{AuthSecret: []byte("secret")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "GET /login/")
+	assert.Contains(t, err.Error(), "appHandler")
+	assert.Contains(t, err.Error(), "MountPath")
+	assert.Len(t, app.Routes(), routes, "nothing should be mounted on failure")
+}
+
+func TestWireConfigMistake(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	routes := len(app.Routes())
+	logger := app.Logger
+
+	_, err := Wire(app, Config{AuthSecret: []byte("secret"), PasswordReset: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Config.BaseURL")
+	assert.Len(t, app.Routes(), routes, "nothing should be mounted on failure")
+	assert.Equal(t, logger, app.Logger, "the app's logger should be left alone")
+
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret"), PasswordReset: true, BaseURL: "https://example.com"})
+	require.NoError(t, err, "a corrected config wires the same app")
+	defer kit.Shutdown()
+}
+
+func TestWireFailureCleansUp(t *testing.T) {
+	output := log.Writer()
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	logger := app.Logger
+
+	// The bridge URL is only opened after the jobs runtime has started
+	// its embedded Redis
+	_, err := Wire(app, Config{AuthSecret: []byte("secret"), RedisURL: "memory://", EventBridgeURL: "bogus://bridge"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bogus")
+	assert.Equal(t, logger, app.Logger)
+	assert.Equal(t, output, log.Writer())
+}
+
+func TestWireMountPath(t *testing.T) {
+	defer auth.UseLoginPath("/login")
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/login", appHandler)
+
+	kit, err := Wire(app, Config{DevMode: true, AuthSecret: []byte("secret"), MountPath: "/kit"})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	keys := routeKeys(app)
+	for _, key := range []string{"GET /kit/login/", "POST /kit/login/", "POST /kit/logout/", "GET /kit/events/", "GET /kit/__routes/"} {
+		assert.True(t, keys[key], "expected %s", key)
+	}
+	assert.True(t, keys["GET /login/"], "the app's own route is untouched")
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/kit/logout", nil))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/kit/login", rec.Header().Get("Location"))
+}
+
+func TestWireQuietsInternalPaths(t *testing.T) {
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&buf)
+	base.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+
+	app := buffalo.New(buffalo.Options{Env: "test", Logger: logger.Logrus{FieldLogger: base}})
+	app.GET("/healthz", appHandler)
+	app.GET("/home", appHandler)
+
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret"), MountPath: "/kit"})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	for _, path := range []string{"/healthz", "/home"} {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Contains(t, buf.String(), "path=/home/")
+	assert.NotContains(t, buf.String(), "healthz", "internal paths aren't logged")
+	assert.True(t, internalpath.Is("/kit/events/"), "registered under MountPath too")
+}
+
+func TestWireBodyLimits(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.POST("/feedback", appHandler)
+	app.POST("/uploads", appHandler)
+
+	kit, err := Wire(app, Config{
+		AuthSecret:   []byte("secret"),
+		MaxBodySize:  1 << 10,
+		MaxBodySizes: map[string]int64{"/uploads": 1 << 20},
+		StorageQuota: 10 << 20,
+	})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	require.NotNil(t, kit.Quota)
+
+	post := func(path string, size int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(strings.Repeat("x", size)))
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, post("/feedback", 100).Code)
+	rec := post("/feedback", 4<<10)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "The limit is 1 KB.")
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, post("/uploads", 4<<10).Code)
+}
+
+func TestWireAuthPathAndHosts(t *testing.T) {
+	defer auth.UseLoginPath("/login")
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/login", appHandler)
+
+	kit, err := Wire(app, Config{
+		AuthSecret: []byte("secret"),
+		AuthPath:   "/auth",
+		AuthHosts:  []string{"accounts.example.com"},
+	})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	keys := routeKeys(app)
+	assert.True(t, keys["GET /auth/login/"])
+	assert.True(t, keys["POST /auth/logout/"])
+	assert.True(t, keys["GET /events/"], "AuthPath only moves the auth routes")
+
+	get := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth/login", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusOK, get("accounts.example.com:3000").Code)
+	assert.Equal(t, http.StatusNotFound, get("www.example.com").Code)
+
+	assert.Equal(t, "//accounts.example.com/auth/login", auth.LoginPath())
+}
+
+func TestWireMemoryRedis(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret"), RedisURL: "memory://"})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	require.True(t, kit.Jobs.IsReady())
+	info, err := kit.Jobs.Client.Enqueue(asynq.NewTask("email:send", []byte("{}")))
+	require.NoError(t, err)
+	assert.NotEmpty(t, info.ID)
+}
+
+func TestWireLoginIdentifier(t *testing.T) {
+	defer auth.UseLoginIdentifier("")
+
+	_, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{AuthSecret: []byte("secret"), LoginIdentifier: "phone"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"phone"`)
+
+	kit, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{AuthSecret: []byte("secret"), LoginIdentifier: auth.LoginWithUsername})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	assert.Equal(t, auth.LoginWithUsername, auth.CurrentLoginIdentifier())
+}
+
+func TestWireGeoIP(t *testing.T) {
+	_, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{AuthSecret: []byte("secret"), GeoIPDatabase: "testdata/missing.mmdb"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing.mmdb")
+}
+
+func TestWireRegistrationMode(t *testing.T) {
+	_, err := Wire(buffalo.New(buffalo.Options{Env: "test"}), Config{AuthSecret: []byte("secret"), RegistrationMode: "waitlist"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"waitlist"`)
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret"), AuthPath: "/auth", RegistrationMode: registration.InviteOnly})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	require.NotNil(t, kit.Registration)
+	assert.Equal(t, "/auth/register", kit.Registration.Path)
+}
+
+func TestWireJSControllers(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "users"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello_controller.js"), []byte("export default class {}"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "users", "list_controller.js"), []byte("export default class {}"), 0o644))
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{DevMode: true, AuthSecret: []byte("secret"), JSControllers: dir})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	assert.Equal(t, "/assets/js/controllers/hello_controller.js", kit.ImportMap.List()["controllers/hello_controller"])
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	rec := get("/assets/js/controllers/index.js")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+	assert.Contains(t, rec.Body.String(), `application.register("users--list", Controller1);`)
+
+	// Dev mode picks up controllers added after Wire
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tabs_controller.js"), []byte("export default class {}"), 0o644))
+	assert.Contains(t, get("/assets/js/controllers/index.js").Body.String(), `"tabs"`)
+
+	rec = get("/assets/js/controllers/users/list_controller.js")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "export default class {}", strings.TrimSpace(rec.Body.String()))
+	assert.Equal(t, http.StatusNotFound, get("/assets/js/controllers/missing_controller.js").Code)
+}
+
+func TestWireCodeStylesheet(t *testing.T) {
+	// The shipped stylesheet is generated; regenerate it when the
+	// highlighting styles change
+	want, err := components.CodeCSS()
+	require.NoError(t, err)
+	shipped, err := publicFS.ReadFile("public" + components.CodeStylesheet)
+	require.NoError(t, err)
+	assert.Equal(t, want, string(shipped), "public/assets/css/bk-code.css is out of date")
+
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, components.CodeStylesheet, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), ".bk-chroma")
+}
+
+func TestWireStream(t *testing.T) {
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/report", func(c buffalo.Context) error {
+		return views.Stream(c, http.StatusOK,
+			views.StreamFunc(func(w io.Writer, data render.Data) error {
+				tags := data["importmapTags"].(func() template.HTML)()
+				_, err := io.WriteString(w, "<!DOCTYPE html><html><head>"+string(tags)+"</head><body>")
+				return err
+			}),
+			views.StreamFunc(func(w io.Writer, data render.Data) error {
+				_, err := io.WriteString(w, `<bk-markdown text="**slow**"></bk-markdown></body></html>`)
+				return err
+			}))
+	})
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/report", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotEmpty(t, rec.chunks)
+	assert.Contains(t, rec.chunks[0], `<script type="importmap">`)
+	assert.NotContains(t, rec.chunks[0], "slow")
+	assert.Contains(t, rec.Body.String(), `<div class="bk-markdown"><p><strong>slow</strong></p>`)
+}
+
+// flushRecorder records what had been sent at each flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	chunks []string
+}
+
+func (r *flushRecorder) Flush() {
+	r.chunks = append(r.chunks, r.Body.String())
+	r.ResponseRecorder.Flush()
+}
+
+func TestWireServerTiming(t *testing.T) {
+	handler := func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, render.Func("text/html; charset=utf-8", func(w io.Writer, _ render.Data) error {
+			_, err := io.WriteString(w, `<html><body><bk-markdown text="hi"></bk-markdown></body></html>`)
+			return err
+		}))
+	}
+
+	for _, cfg := range []Config{{DevMode: true}, {ServerTiming: true}} {
+		app := buffalo.New(buffalo.Options{Env: "test"})
+		app.GET("/page", handler)
+		cfg.AuthSecret = []byte("secret")
+		kit, err := Wire(app, cfg)
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page", nil))
+		kit.Shutdown()
+		require.Equal(t, http.StatusOK, rec.Code)
+		header := rec.Header().Get("Server-Timing")
+		assert.Contains(t, header, "render;dur=")
+		assert.Contains(t, header, `components;dur=`)
+	}
+
+	// Off by default in production
+	app := buffalo.New(buffalo.Options{Env: "test"})
+	app.GET("/page", handler)
+	kit, err := Wire(app, Config{AuthSecret: []byte("secret")})
+	require.NoError(t, err)
+	defer kit.Shutdown()
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page", nil))
+	assert.Empty(t, rec.Header().Get("Server-Timing"))
+}